@@ -4,22 +4,17 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 	"github.com/yoanesber/Go-Department-CRUD/config/db/postgresdb"
-	"github.com/yoanesber/Go-Department-CRUD/config/db/redisdb"
+	"github.com/yoanesber/Go-Department-CRUD/internal/audit"
+	"github.com/yoanesber/Go-Department-CRUD/internal/legacy"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/seed"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/app"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loadtest"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
-	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
-	"github.com/yoanesber/Go-Department-CRUD/routes"
-)
-
-var (
-	Environment string
-	Port        string
-	IsSSL       string
-	APIVersion  string
-	SSLKeys     string
-	SSLCert     string
+	"github.com/yoanesber/Go-Department-CRUD/pkg/selftest"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/server"
 )
 
 // Init function to initialize the application
@@ -29,67 +24,65 @@ func init() {
 	logger.InitLoggers()
 }
 
-// Main function to start the Gin server and set up routes
-// It loads environment variables, sets up middleware, and defines API routes
+// Main function to start the servers of the API (see pkg/app) or to run one of the subcommands
 func main() {
-	// Load environment variables from .env file
-	// _ = godotenv.Load(".env")
-
-	// Get environment variable from .env file
-	Environment := os.Getenv("ENV")
-	Port := os.Getenv("PORT")
-	IsSSL := os.Getenv("IS_SSL")
-	APIVersion := os.Getenv("API_VERSION")
-	SSLKeys := os.Getenv("SSL_KEYS")
-	SSLCert := os.Getenv("SSL_CERT")
+	// Run the load test harness instead of the server with "app loadtest [flags]"
+	// The harness only needs the target URL and credentials, not the database or Redis
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		os.Exit(loadtest.Run(os.Args[2:], os.Stdout))
+	}
 
-	// Set the Gin mode based on the environment
-	gin.SetMode(gin.DebugMode)
-	if Environment == "PRODUCTION" {
-		gin.SetMode(gin.ReleaseMode)
+	// Run the post-deploy smoke test against a running instance with "app selftest [flags]"
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		os.Exit(selftest.Run(os.Args[2:], os.Stdout))
 	}
 
-	// Initialize the PostgreSQL database connection using the configuration from the .env file
-	postgresdb.LoadEnv()
-	postgresdb.InitDB()
+	// Load environment variables from .env file
+	// _ = godotenv.Load(".env")
 
-	// Initialize the Redis client using the configuration from the .env file
-	redisdb.LoadEnv()
-	redisdb.InitRedis()
+	// The legacy import, the demo data and the audit replay only need the database
+	if len(os.Args) > 1 && (os.Args[1] == "migrate-legacy" || os.Args[1] == "seed" || os.Args[1] == "audit") {
+		postgresdb.LoadEnv()
+		postgresdb.InitDB()
+		dbtimeout.LoadEnv()
+		db := dbtimeout.WithStatementTimeout(postgresdb.GetDB(), dbtimeout.Import)
 
-	// Initialize the validator for request validation
-	validator.InitValidator()
+		// Import the departments of the legacy application with "app migrate-legacy [flags]"
+		if os.Args[1] == "migrate-legacy" {
+			os.Exit(legacy.Run(db, os.Args[2:], os.Stdout))
+		}
 
-	// Set up Gin server with middleware and routes
-	r := routes.SetupRouter()
+		// Rebuild the state of an entity from its audit records with "app audit replay [flags]"
+		if os.Args[1] == "audit" {
+			os.Exit(audit.Run(db, os.Args[2:], os.Stdout))
+		}
 
-	// Set up trusted proxies for Gin
-	// This is used to trust the X-Forwarded-For header for client IP detection
-	r.SetTrustedProxies(nil)
+		// Fill the database with an anonymized demo dataset with "app seed --demo [flags]", the roles are created first
+		role.LoadEnv()
+		if err := role.Validate(); err != nil {
+			logger.Error(err.Error())
+			os.Exit(2)
+		}
+		role.InitRoles(db)
+		os.Exit(seed.Run(db, os.Args[2:], os.Stdout))
+	}
 
-	if Port == "" {
-		Port = "8080" // Default port if not specified in .env
+	// Initialize the application and create its servers using the configuration from the .env file
+	srv, err := app.New(app.ConfigFromEnv())
+	if err != nil {
+		logger.Error(fmt.Sprintf("Refusing to start: %v", err))
+		os.Exit(1)
 	}
 
-	// Log the server start information
-	logger.Info("Starting server on : ", log.Fields{
-		"port":    Port,
-		"env":     Environment,
-		"ssl":     IsSSL,
-		"version": APIVersion,
-	})
+	// Drain and shut the servers down gracefully on SIGINT/SIGTERM or on a drain request
+	shutdownDone := server.ShutdownOnSignal(srv.Shutdown)
 
-	// Start the server with or without SSL based on the environment variable
-	if IsSSL == "TRUE" {
-		//Generated using sh generate-certificate.sh
-		err := r.RunTLS(":"+Port, SSLCert, SSLKeys)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to start server with SSL: %v", err))
-		}
-	} else {
-		err := r.Run(":" + Port)
-		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to start server: %v", err))
-		}
+	if err := srv.Start(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to start server: %v", err))
+		return
 	}
+
+	// Wait for the active requests to complete before exiting
+	<-shutdownDone
+	logger.Info("Server stopped")
 }
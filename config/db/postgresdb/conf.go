@@ -1,14 +1,23 @@
 package postgresdb
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
 	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
 	"github.com/yoanesber/Go-Department-CRUD/internal/role"
 	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger/gormlog"
 	"gorm.io/driver/postgres"        // Import the PostgreSQL driver for GORM
 	"gorm.io/gorm"                   // Import GORM for ORM functionalities
 	gormLogger "gorm.io/gorm/logger" // Import GORM logger for logging SQL queries
@@ -28,6 +37,7 @@ var (
 	DBSeed     string
 	DBSeedFile string
 	DBLog      string
+	DBSlowMs   string
 )
 
 // LoadEnv loads environment variables from the .env file
@@ -45,10 +55,14 @@ func LoadEnv() {
 	DBSeed = os.Getenv("DB_SEED")
 	DBSeedFile = os.Getenv("DB_SEED_FILE")
 	DBLog = os.Getenv("DB_LOG")
+	DBSlowMs = os.Getenv("DB_SLOW_QUERY_MS")
 }
 
 // InitDB initializes the GORM database connection
 func InitDB() {
+	// Register the database in the health registry, the API cannot serve any request without it
+	health.Register("postgres", health.Critical, Ping)
+
 	// Create the connection string
 	dsn := fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=%s",
@@ -73,10 +87,16 @@ func InitDB() {
 		logLevel = gormLogger.Warn
 	}
 
+	// The statements are logged with the application logs, tied to the request that issued them
+	sqlLogger := gormlog.New(logLevel)
+	if ms, err := strconv.Atoi(DBSlowMs); err == nil && ms >= 0 {
+		sqlLogger.SlowThreshold = time.Duration(ms) * time.Millisecond
+	}
+
 	// Open the connection using GORM and PostgreSQL driver
 	var err error
 	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: gormLogger.Default.LogMode(logLevel),
+		Logger: sqlLogger,
 	})
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to connect to PostgreSQL: %v", err))
@@ -89,13 +109,13 @@ func InitDB() {
 	if DBMigrate == "TRUE" {
 		err := db.Transaction(func(tx *gorm.DB) error {
 			// Drop and recreate tables if they exist
-			err = tx.Migrator().DropTable(&refreshtoken.RefreshToken{}, &role.UserRole{}, &role.Role{}, &user.User{}, &department.Department{})
+			err = tx.Migrator().DropTable(&refreshtoken.RefreshToken{}, &role.UserRole{}, &role.Role{}, &user.User{}, &user.AuditEntry{}, &user.APIKey{}, &user.RoleRequest{}, &user.ExternalIdentity{}, &user.LoginAttempt{}, &department.Department{}, &department.DepartmentVersion{}, &webhook.Delivery{}, &webhook.Webhook{}, &oauthclient.Client{}, &outbox.OutboxMessage{})
 			if err != nil {
 				return fmt.Errorf("failed to drop tables: %v", err)
 			}
 
 			// Migrate the database schema
-			err = tx.AutoMigrate(&role.Role{}, &user.User{}, &refreshtoken.RefreshToken{}, &department.Department{})
+			err = tx.AutoMigrate(&role.Role{}, &user.User{}, &user.AuditEntry{}, &user.APIKey{}, &user.RoleRequest{}, &user.ExternalIdentity{}, &user.LoginAttempt{}, &refreshtoken.RefreshToken{}, &department.Department{}, &department.DepartmentVersion{}, &webhook.Webhook{}, &webhook.Delivery{}, &oauthclient.Client{}, &outbox.OutboxMessage{})
 			if err != nil {
 				return fmt.Errorf("failed to migrate database: %v", err)
 			}
@@ -130,6 +150,27 @@ func InitDB() {
 	}
 }
 
+// Ping checks the database connection.
+func Ping(ctx context.Context) error {
+	if db == nil {
+		return errors.New("database connection is not initialized")
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+// SetDB uses an existing GORM database instance instead of connecting with the DB_* variables,
+// e.g. when the API is embedded in another program. The database is neither migrated nor seeded.
+func SetDB(gormDB *gorm.DB) {
+	health.Register("postgres", health.Critical, Ping)
+	db = gormDB
+}
+
 // GetDB returns the GORM database instance
 func GetDB() *gorm.DB {
 	return db
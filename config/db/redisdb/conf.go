@@ -2,10 +2,12 @@ package redisdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
 
 	"github.com/go-redis/redis/v8" // Redis client for Go
@@ -32,6 +34,9 @@ func LoadEnv() {
 // InitRedis initializes the Redis client using environment variables
 // It constructs the connection string and calls ConnectRedis to establish the connection
 func InitRedis() {
+	// Register Redis in the health registry, it holds the refresh tokens and the token version
+	health.Register("redis", health.Critical, Ping)
+
 	// Initialize the Redis client
 	redisDb, _ := strconv.Atoi(RedisDB)
 	RedisClient = redis.NewClient(&redis.Options{
@@ -60,6 +65,22 @@ func InitRedis() {
 	logger.Info("Connected to Redis")
 }
 
+// Ping checks the Redis connection.
+func Ping(ctx context.Context) error {
+	if RedisClient == nil {
+		return errors.New("redis client is not initialized")
+	}
+
+	return RedisClient.Ping(ctx).Err()
+}
+
+// SetRedisClient uses an existing Redis client instead of connecting with the REDIS_* variables,
+// e.g. when the API is embedded in another program.
+func SetRedisClient(client *redis.Client) {
+	health.Register("redis", health.Critical, Ping)
+	RedisClient = client
+}
+
 // GetRedisClient returns the Redis client instance
 func GetRedisClient() *redis.Client {
 	return RedisClient
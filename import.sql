@@ -5,10 +5,14 @@ INSERT INTO users (username,"password",email,firstname,lastname,is_enabled,is_ac
 
 
 -- Description: SQL script to import initial role data into the database.
-INSERT INTO roles ("name") VALUES
-	 ('ROLE_USER'),
-	 ('ROLE_MODERATOR'),
-	 ('ROLE_ADMIN');
+-- The roles already created by the role bootstrap of the application are skipped.
+INSERT INTO roles ("name")
+SELECT r."name" FROM (VALUES
+	 (1,'ROLE_USER'),
+	 (2,'ROLE_MODERATOR'),
+	 (3,'ROLE_ADMIN')) AS r(pos,"name")
+WHERE NOT EXISTS (SELECT 1 FROM roles WHERE roles."name" = r."name")
+ORDER BY r.pos;
 
 -- Description: SQL script to import initial user-role mapping data into the database.
 INSERT INTO user_roles (user_id,role_id) VALUES
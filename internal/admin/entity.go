@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
+)
+
+// TokenVersionResponse represents the response payload for the global token version.
+type TokenVersionResponse struct {
+	TokenVersion int64 `json:"tokenVersion"`
+}
+
+// CacheStatsResponse represents the statistics of the registered caches.
+type CacheStatsResponse struct {
+	Caches []cache.Stats `json:"caches"`
+}
+
+// CacheInvalidateRequest represents the request payload for invalidating cache entries.
+// Without a cache name, the entries are removed from all the caches; without a prefix, all their entries are removed.
+type CacheInvalidateRequest struct {
+	Cache  string `json:"cache" validate:"omitempty,max=50"`
+	Prefix string `json:"prefix" validate:"omitempty,max=200"`
+}
+
+// CacheInvalidateResponse represents the number of cache entries removed.
+type CacheInvalidateResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+// EmployeeCountReconcileResponse represents the departments whose employee count was repaired.
+type EmployeeCountReconcileResponse struct {
+	Repaired []department.EmployeeCountDrift `json:"repaired"`
+}
+
+// MaintenanceRequest represents the request payload for enabling the read-only maintenance mode.
+// Without a message, the refused requests get the default maintenance message.
+type MaintenanceRequest struct {
+	Message string `json:"message" validate:"omitempty,max=200"`
+}
+
+// Drain states reported by the drain endpoint
+const (
+	DrainStatusDraining = "DRAINING"
+	DrainStatusDrained  = "DRAINED"
+)
+
+// DrainResponse represents the state of the drain.
+type DrainResponse struct {
+	Status string `json:"status"`
+}
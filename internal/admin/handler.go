@@ -0,0 +1,261 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/profiling"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// This struct defines the AdminHandler which handles HTTP requests related to operational controls.
+// It contains a service field of type AdminService which is used to perform the admin operations.
+type AdminHandler struct {
+	Service AdminService
+}
+
+// NewAdminHandler creates a new instance of AdminHandler.
+// It initializes the AdminHandler struct with the provided AdminService.
+func NewAdminHandler(adminService AdminService) *AdminHandler {
+	return &AdminHandler{Service: adminService}
+}
+
+// GetTokenVersion returns the current global token version.
+// @Summary      Get token version
+// @Description  Get the current global token version
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/token-version [get]
+func (h *AdminHandler) GetTokenVersion(c *gin.Context) {
+	version, err := h.Service.GetTokenVersion(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve token version", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Token version retrieved successfully", version)
+}
+
+// BumpTokenVersion increments the global token version, invalidating every issued token.
+// @Summary      Bump token version
+// @Description  Invalidate all issued tokens by incrementing the global token version
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful bump
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/token-version/bump [post]
+func (h *AdminHandler) BumpTokenVersion(c *gin.Context) {
+	version, err := h.Service.BumpTokenVersion(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to bump token version", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Token version bumped successfully, all users must log in again", version)
+}
+
+// GetCacheStats returns the statistics of the registered caches.
+// @Summary      Get cache statistics
+// @Description  Get the hit/miss ratio, key count and memory estimate of each cache
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/cache/stats [get]
+func (h *AdminHandler) GetCacheStats(c *gin.Context) {
+	stats, err := h.Service.GetCacheStats(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve cache statistics", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Cache statistics retrieved successfully", stats)
+}
+
+// InvalidateCache removes the cache entries whose key starts with the given prefix.
+// @Summary      Invalidate cache entries
+// @Description  Remove the entries of a cache, or of all caches, whose key starts with the given prefix
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CacheInvalidateRequest  true  "Cache and key prefix"
+// @Success      200  {object}  HttpResponse for successful invalidation
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for cache not found
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/cache/invalidate [post]
+func (h *AdminHandler) InvalidateCache(c *gin.Context) {
+	var req CacheInvalidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	response, err := h.Service.InvalidateCache(c.Request.Context(), req)
+	if util.JSONAppError(c, "Failed to invalidate cache", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to invalidate cache", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Cache invalidated successfully", response)
+}
+
+// ReconcileEmployeeCounts recounts the employees of the departments and repairs the drifted counts.
+// @Summary      Reconcile employee counts
+// @Description  Repair the departments whose employee count does not match their users
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful reconciliation
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/employee-counts/reconcile [post]
+func (h *AdminHandler) ReconcileEmployeeCounts(c *gin.Context) {
+	response, err := h.Service.ReconcileEmployeeCounts(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to reconcile employee counts", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Employee counts reconciled successfully", response)
+}
+
+// GetMaintenance returns the state of the read-only maintenance mode.
+// @Summary      Get maintenance mode
+// @Description  Get whether the mutating requests are refused for maintenance
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/maintenance [get]
+func (h *AdminHandler) GetMaintenance(c *gin.Context) {
+	state, err := h.Service.GetMaintenance(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve maintenance mode", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Maintenance mode retrieved successfully", state)
+}
+
+// EnableMaintenance enables the read-only maintenance mode, e.g. before a database failover.
+// @Summary      Enable maintenance mode
+// @Description  Refuse the mutating requests with 503 on every instance, the reads keep working
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        request  body      MaintenanceRequest  false  "Message of the refused requests"
+// @Success      200  {object}  HttpResponse for successful enabling
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/maintenance/enable [post]
+func (h *AdminHandler) EnableMaintenance(c *gin.Context) {
+	var req MaintenanceRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	state, err := h.Service.EnableMaintenance(c.Request.Context(), req)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to enable maintenance mode", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Maintenance mode enabled, the mutating requests are refused", state)
+}
+
+// DisableMaintenance disables the read-only maintenance mode.
+// @Summary      Disable maintenance mode
+// @Description  Accept the mutating requests again on every instance
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful disabling
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/maintenance/disable [post]
+func (h *AdminHandler) DisableMaintenance(c *gin.Context) {
+	state, err := h.Service.DisableMaintenance(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to disable maintenance mode", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Maintenance mode disabled", state)
+}
+
+// profileWriteMargin is the time given to write the response of a CPU profile once it is captured.
+const profileWriteMargin = 10 * time.Second
+
+// CaptureProfile captures a CPU or heap profile of the running application to the profile directory.
+// The CPU profiles are the input of the profile-guided optimization (PGO) builds.
+// @Summary      Capture a profile
+// @Description  Capture a timed CPU profile or a heap snapshot to the profile directory
+// @Tags         admin
+// @Produce      json
+// @Param        kind     query     string  false  "Profile kind (cpu or heap, default cpu)"
+// @Param        seconds  query     int     false  "Duration of a CPU profile in seconds (default 30, max 300)"
+// @Success      201  {object}  HttpResponse for successful capture
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for a CPU profile already in progress
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /admin/profile [post]
+func (h *AdminHandler) CaptureProfile(c *gin.Context) {
+	kind := c.DefaultQuery("kind", profiling.KindCPU)
+	seconds, err := profiling.ParseSeconds(c.Query("seconds"))
+	if util.JSONAppError(c, "Invalid profile duration", err) {
+		return
+	}
+
+	// Give the response the time of the capture beyond the write timeout of the server
+	if kind == profiling.KindCPU {
+		_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(time.Duration(seconds)*time.Second + profileWriteMargin))
+	}
+
+	profile, err := h.Service.CaptureProfile(c.Request.Context(), kind, seconds)
+	if util.JSONAppError(c, "Failed to capture profile", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to capture profile", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusCreated, "Profile captured successfully", profile)
+}
+
+// Drain starts draining the application: the readiness probe fails, then the servers wait for the
+// in-flight requests and the background jobs before the process exits.
+// With "wait=true" the response is only sent once the drain is complete, so a preStop hook can block on it.
+// @Summary      Drain the application
+// @Description  Mark the application as not ready, wait for in-flight requests and background jobs, then exit
+// @Tags         admin
+// @Produce      json
+// @Param        wait  query     bool  false  "Wait for the end of the drain before responding"
+// @Success      200  {object}  HttpResponse for a completed drain
+// @Success      202  {object}  HttpResponse for a started drain
+// @Router       /admin/drain [post]
+func (h *AdminHandler) Drain(c *gin.Context) {
+	drain.Start()
+
+	if c.Query("wait") != "true" {
+		util.JSONSuccess(c, http.StatusAccepted, "Drain started", DrainResponse{Status: DrainStatusDraining})
+		return
+	}
+
+	select {
+	case <-drain.Drained():
+		util.JSONSuccess(c, http.StatusOK, "Drain completed", DrainResponse{Status: DrainStatusDrained})
+	case <-c.Request.Context().Done():
+		// The caller gave up, the drain goes on
+	}
+}
@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/integrity"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+)
+
+// RegisterRoutes registers the admin routes under the given group of the admin listener.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Initialize the admin service and handler
+	service := NewAdminService()
+	handler := NewAdminHandler(service)
+
+	// Expose the drain endpoint used by the deployment tooling (e.g. a preStop hook)
+	// It is not protected by JWT since the hook has no token; the admin listener is bound to the loopback interface
+	rg.POST("/admin/drain", handler.Drain)
+
+	// Set up the admin routes
+	// These routes are still protected by JWT and restricted to admin users (defense in depth)
+	// Their responses are signed when response signing is enabled
+	adminGroup := rg.Group("/admin", authorization.JwtValidation(), authorization.RoleBasedAccessControl("ROLE_ADMIN"),
+		deps.Chain.Skippable(chain.Buffering, integrity.ResponseSignature()))
+	{
+		// Define the routes for the global token version (emergency invalidation switch)
+		adminGroup.GET("/token-version", handler.GetTokenVersion)
+		adminGroup.POST("/token-version/bump", handler.BumpTokenVersion)
+
+		// Define the routes for the cache inspection and invalidation
+		adminGroup.GET("/cache/stats", handler.GetCacheStats)
+		adminGroup.POST("/cache/invalidate", handler.InvalidateCache)
+
+		// Define the route capturing the CPU/heap profiles used by the PGO builds
+		adminGroup.POST("/profile", handler.CaptureProfile)
+
+		// Define the route repairing the employee counts of the departments
+		adminGroup.POST("/employee-counts/reconcile", deps.StatementTimeout(dbtimeout.Import, dbtimeout.Import), handler.ReconcileEmployeeCounts)
+
+		// Read-only maintenance mode, e.g. during a database failover
+		adminGroup.GET("/maintenance", handler.GetMaintenance)
+		adminGroup.POST("/maintenance/enable", handler.EnableMaintenance)
+		adminGroup.POST("/maintenance/disable", handler.DisableMaintenance)
+	}
+}
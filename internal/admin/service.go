@@ -0,0 +1,234 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/profiling"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
+)
+
+// Interface for admin service
+// This interface defines the methods that the admin service should implement
+type AdminService interface {
+	GetTokenVersion(ctx context.Context) (TokenVersionResponse, error)
+	BumpTokenVersion(ctx context.Context) (TokenVersionResponse, error)
+	GetCacheStats(ctx context.Context) (CacheStatsResponse, error)
+	InvalidateCache(ctx context.Context, req CacheInvalidateRequest) (CacheInvalidateResponse, error)
+	CaptureProfile(ctx context.Context, kind string, seconds int) (profiling.Profile, error)
+	ReconcileEmployeeCounts(ctx context.Context) (EmployeeCountReconcileResponse, error)
+	GetMaintenance(ctx context.Context) (maintenance.State, error)
+	EnableMaintenance(ctx context.Context, req MaintenanceRequest) (maintenance.State, error)
+	DisableMaintenance(ctx context.Context) (maintenance.State, error)
+}
+
+// ErrCacheNotFound is returned when invalidating a cache that is not registered.
+var ErrCacheNotFound = apperror.New("CacheNotFound", http.StatusNotFound, "cache with the given name not found")
+
+// This struct defines the AdminService
+// It implements the AdminService interface and provides methods for operational controls
+type adminService struct{}
+
+// NewAdminService creates a new instance of AdminService.
+// It initializes the adminService struct and returns it.
+func NewAdminService() AdminService {
+	return &adminService{}
+}
+
+// GetTokenVersion returns the current global token version.
+func (s *adminService) GetTokenVersion(ctx context.Context) (TokenVersionResponse, error) {
+	return TokenVersionResponse{TokenVersion: tokenversion.Current()}, nil
+}
+
+// BumpTokenVersion increments the global token version.
+// Every token issued before the bump is rejected by the JWT middleware, forcing all users to log in again.
+func (s *adminService) BumpTokenVersion(ctx context.Context) (TokenVersionResponse, error) {
+	// Get the Redis client from the context
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return TokenVersionResponse{}, errors.New("redis client is nil")
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return TokenVersionResponse{}, errors.New("missing user context")
+	}
+
+	// Bump the token version and broadcast it to all instances
+	version, err := tokenversion.Bump(ctx, redisClient)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to bump token version: %v", err))
+		return TokenVersionResponse{}, err
+	}
+
+	logger.Warn(fmt.Sprintf("Global token version bumped to %d by %s", version, meta.UserName))
+
+	return TokenVersionResponse{TokenVersion: version}, nil
+}
+
+// GetCacheStats returns the statistics of the registered caches.
+func (s *adminService) GetCacheStats(ctx context.Context) (CacheStatsResponse, error) {
+	// Get the Redis client from the context
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return CacheStatsResponse{}, errors.New("redis client is nil")
+	}
+
+	response := CacheStatsResponse{Caches: []cache.Stats{}}
+	for _, c := range cache.All() {
+		stats, err := c.Stats(ctx, redisClient)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to get cache %s stats: %v", c.Name(), err))
+			return CacheStatsResponse{}, err
+		}
+		response.Caches = append(response.Caches, stats)
+	}
+
+	return response, nil
+}
+
+// InvalidateCache removes the entries of a cache (or of all caches) whose key starts with the given prefix.
+func (s *adminService) InvalidateCache(ctx context.Context, req CacheInvalidateRequest) (CacheInvalidateResponse, error) {
+	// Get the Redis client from the context
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return CacheInvalidateResponse{}, errors.New("redis client is nil")
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return CacheInvalidateResponse{}, errors.New("missing user context")
+	}
+
+	caches := cache.All()
+	if req.Cache != "" {
+		c, ok := cache.Get(req.Cache)
+		if !ok {
+			return CacheInvalidateResponse{}, ErrCacheNotFound
+		}
+		caches = []*cache.Cache{c}
+	}
+
+	var response CacheInvalidateResponse
+	for _, c := range caches {
+		removed, err := c.InvalidatePrefix(ctx, redisClient, req.Prefix)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to invalidate cache %s: %v", c.Name(), err))
+			return CacheInvalidateResponse{}, err
+		}
+		response.Removed += removed
+	}
+
+	logger.Warn(fmt.Sprintf("Cache invalidated by %s (cache %q, prefix %q): %d entries removed", meta.UserName, req.Cache, req.Prefix, response.Removed))
+
+	return response, nil
+}
+
+// ReconcileEmployeeCounts repairs the employee counts of the departments at once, without waiting for the reconciliation job.
+func (s *adminService) ReconcileEmployeeCounts(ctx context.Context) (EmployeeCountReconcileResponse, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return EmployeeCountReconcileResponse{}, errors.New("database connection is nil")
+	}
+
+	repaired, err := department.ReconcileEmployeeCounts(ctx, db)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to reconcile employee counts: %v", err))
+		return EmployeeCountReconcileResponse{}, err
+	}
+
+	return EmployeeCountReconcileResponse{Repaired: repaired}, nil
+}
+
+// GetMaintenance returns the state of the read-only maintenance mode.
+func (s *adminService) GetMaintenance(ctx context.Context) (maintenance.State, error) {
+	return maintenance.Current(), nil
+}
+
+// EnableMaintenance enables the read-only maintenance mode on every instance.
+// The mutating requests are refused with the given message until the mode is disabled.
+func (s *adminService) EnableMaintenance(ctx context.Context, req MaintenanceRequest) (maintenance.State, error) {
+	// Get the Redis client from the context
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return maintenance.State{}, errors.New("redis client is nil")
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return maintenance.State{}, errors.New("missing user context")
+	}
+
+	state, err := maintenance.Enable(ctx, redisClient, req.Message, meta.UserName)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to enable maintenance mode: %v", err))
+		return maintenance.State{}, err
+	}
+
+	logger.Warn(fmt.Sprintf("Maintenance mode enabled by %s: %q", meta.UserName, state.RefusalMessage()))
+
+	return state, nil
+}
+
+// DisableMaintenance disables the read-only maintenance mode on every instance.
+func (s *adminService) DisableMaintenance(ctx context.Context) (maintenance.State, error) {
+	// Get the Redis client from the context
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return maintenance.State{}, errors.New("redis client is nil")
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return maintenance.State{}, errors.New("missing user context")
+	}
+
+	state, err := maintenance.Disable(ctx, redisClient)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to disable maintenance mode: %v", err))
+		return maintenance.State{}, err
+	}
+
+	logger.Warn(fmt.Sprintf("Maintenance mode disabled by %s", meta.UserName))
+
+	return state, nil
+}
+
+// CaptureProfile captures a CPU or heap profile to the profile directory, e.g. to collect the profiles of a PGO build.
+func (s *adminService) CaptureProfile(ctx context.Context, kind string, seconds int) (profiling.Profile, error) {
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return profiling.Profile{}, errors.New("missing user context")
+	}
+
+	profile, err := profiling.Capture(ctx, kind, seconds)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to capture %s profile: %v", kind, err))
+		return profiling.Profile{}, err
+	}
+
+	logger.Info(fmt.Sprintf("Profile %s captured by %s (%d bytes)", profile.File, meta.UserName, profile.Bytes))
+
+	return profile, nil
+}
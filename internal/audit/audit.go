@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"gorm.io/gorm"
+)
+
+// Package audit rebuilds the state of the entities from their audit records, to recover from an accidental
+// bulk delete when the backups are stale. The audit records of the departments are the domain events kept
+// in the outbox, which carry the department as it was after each change.
+// "app audit replay --entity department --from 2024-01-01" folds the events into a staging table and prints
+// a report comparing it with the live table. The live table is never changed.
+
+// Entities are the entities whose state can be replayed, mapped to the prefix of their event types.
+var Entities = map[string]string{
+	"department": "department.",
+}
+
+// StagingSuffix ends the names of the staging tables. The staging table is dropped and recreated by
+// every replay, so the suffix keeps a mistyped name from dropping a live table.
+const StagingSuffix = "_replay"
+
+// batchSize is the number of rows inserted per statement.
+const batchSize = 500
+
+// tablePattern accepts a table name optionally qualified by its schema, since it is not a bound parameter.
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// snapshotlessEvents are the department events whose data is not the department after the change:
+// the access denials carry the rejected write and the drifts the department before the manual change.
+var snapshotlessEvents = map[string]bool{
+	event.DepartmentAccessDenied: true,
+	event.DepartmentDrifted:      true,
+}
+
+// Config holds the replay configuration.
+// The events from From (included) to To (excluded, when set) are replayed.
+type Config struct {
+	Entity string
+	From   time.Time
+	To     *time.Time
+	Table  string
+}
+
+// ParseConfig parses the replay command-line flags.
+// The times are given as RFC 3339 or as a date, which means the start of that day (UTC).
+func ParseConfig(args []string) (Config, error) {
+	cfg := Config{}
+	var from, to string
+	fs := flag.NewFlagSet("audit replay", flag.ContinueOnError)
+	fs.StringVar(&cfg.Entity, "entity", "", "entity to replay: "+strings.Join(entityNames(), ", ")+" (required)")
+	fs.StringVar(&from, "from", "", "replay the audit records from this time, RFC 3339 or YYYY-MM-DD (required)")
+	fs.StringVar(&to, "to", "", "replay the audit records before this time, e.g. the time of the accidental delete")
+	fs.StringVar(&cfg.Table, "table", "", "staging table, <entity>"+StagingSuffix+" by default")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if _, ok := Entities[cfg.Entity]; !ok {
+		return Config{}, fmt.Errorf("invalid entity %q, expected one of %s", cfg.Entity, strings.Join(entityNames(), ", "))
+	}
+
+	if from == "" {
+		return Config{}, errors.New("--from is required")
+	}
+	t, err := parseTime(from)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid --from: %v", err)
+	}
+	cfg.From = t
+
+	if to != "" {
+		t, err := parseTime(to)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid --to: %v", err)
+		}
+		if !cfg.From.Before(t) {
+			return Config{}, errors.New("--from must be before --to")
+		}
+		cfg.To = &t
+	}
+
+	if cfg.Table == "" {
+		cfg.Table = cfg.Entity + StagingSuffix
+	}
+	if !tablePattern.MatchString(cfg.Table) || !strings.HasSuffix(cfg.Table, StagingSuffix) {
+		return Config{}, fmt.Errorf("invalid table name %s, it must be an identifier ending with %s", cfg.Table, StagingSuffix)
+	}
+
+	return cfg, nil
+}
+
+// Run runs the audit subcommand with the given command-line arguments and returns the exit code:
+// 0 when the replayed state matches the live table, 1 when the live table differs from it or records
+// could not be replayed, and 2 when the replay could not run.
+func Run(db *gorm.DB, args []string, out io.Writer) int {
+	if len(args) == 0 || args[0] != "replay" {
+		fmt.Fprintln(out, "audit: expected the replay subcommand, e.g. audit replay --entity department --from 2024-01-01")
+		return 2
+	}
+
+	cfg, err := ParseConfig(args[1:])
+	if err != nil {
+		fmt.Fprintf(out, "audit replay: %v\n", err)
+		return 2
+	}
+
+	if db == nil {
+		fmt.Fprintln(out, "audit replay: database connection is not initialized")
+		return 2
+	}
+
+	report, err := Replay(db, cfg)
+	if err != nil {
+		fmt.Fprintf(out, "audit replay: %v\n", err)
+		return 2
+	}
+
+	report.Print(out)
+	if !report.OK() {
+		return 1
+	}
+
+	return 0
+}
+
+// ReplayedDepartment is a department as rebuilt from its audit records, with the last record applied to it.
+type ReplayedDepartment struct {
+	department.Department
+	LastEventID   string    `gorm:"column:last_event_id"`
+	LastEventType string    `gorm:"column:last_event_type"`
+	LastEventAt   time.Time `gorm:"column:last_event_at"`
+}
+
+// Replay rebuilds the departments from their audit records into the staging table, in one transaction,
+// and compares them with the live table. The staging table is dropped and recreated with the columns of
+// the department table and the last record applied to each row.
+func Replay(db *gorm.DB, cfg Config) (Report, error) {
+	query := db.Model(&outbox.OutboxMessage{}).
+		Where("event_type LIKE ? AND occurred_at >= ?", Entities[cfg.Entity]+"%", cfg.From)
+	if cfg.To != nil {
+		query = query.Where("occurred_at < ?", *cfg.To)
+	}
+
+	var messages []outbox.OutboxMessage
+	if err := query.Order("occurred_at, id").Find(&messages).Error; err != nil {
+		return Report{}, fmt.Errorf("failed to read the audit records: %v", err)
+	}
+
+	replayed, undecodable := ReplayDepartments(messages)
+	report := Report{Entity: cfg.Entity, Table: cfg.Table, From: cfg.From, To: cfg.To, Read: len(messages), Undecodable: undecodable}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"DROP TABLE IF EXISTS " + cfg.Table,
+			"CREATE TABLE " + cfg.Table + " (LIKE " + (department.Department{}).TableName() + " INCLUDING DEFAULTS)",
+			"ALTER TABLE " + cfg.Table + " ADD COLUMN last_event_id varchar(36), ADD COLUMN last_event_type varchar(100), ADD COLUMN last_event_at timestamptz",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create %s: %v", cfg.Table, err)
+			}
+		}
+
+		if len(replayed) > 0 {
+			if err := tx.Table(cfg.Table).CreateInBatches(&replayed, batchSize).Error; err != nil {
+				return fmt.Errorf("failed to write %s: %v", cfg.Table, err)
+			}
+		}
+
+		// Compare with the live departments, the soft-deleted ones included
+		ids := make([]string, 0, len(replayed))
+		for _, r := range replayed {
+			ids = append(ids, r.ID)
+		}
+		var live []department.Department
+		if len(ids) > 0 {
+			if err := tx.Unscoped().Where("id IN ?", ids).Find(&live).Error; err != nil {
+				return fmt.Errorf("failed to read the live departments: %v", err)
+			}
+		}
+		report.Compare(replayed, live)
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// ReplayDepartments folds the audit records of the departments, in their order, into the last state of
+// each department, sorted by ID. A deleted department is kept with its deletion time.
+// The records whose data cannot be read are returned as issues and skipped.
+func ReplayDepartments(messages []outbox.OutboxMessage) ([]ReplayedDepartment, []Issue) {
+	states := make(map[string]ReplayedDepartment)
+	var undecodable []Issue
+	for _, m := range messages {
+		if snapshotlessEvents[m.EventType] {
+			continue
+		}
+
+		var d department.Department
+		if err := json.Unmarshal([]byte(m.Payload), &d); err != nil || d.ID == "" {
+			reason := "the data is not a department"
+			if err != nil {
+				reason = err.Error()
+			}
+			undecodable = append(undecodable, Issue{ID: m.EventID, Reason: m.EventType + ": " + reason})
+			continue
+		}
+
+		// The deletion events carry the department as it was before the delete
+		if m.EventType == event.DepartmentDeleted && d.DeletedAt == nil {
+			d.DeletedAt = &gorm.DeletedAt{Time: m.OccurredAt, Valid: true}
+		}
+
+		states[d.ID] = ReplayedDepartment{Department: d, LastEventID: m.EventID, LastEventType: m.EventType, LastEventAt: m.OccurredAt}
+	}
+
+	replayed := make([]ReplayedDepartment, 0, len(states))
+	for _, r := range states {
+		replayed = append(replayed, r)
+	}
+	sort.Slice(replayed, func(i, j int) bool { return replayed[i].ID < replayed[j].ID })
+
+	return replayed, undecodable
+}
+
+// parseTime parses an RFC 3339 time or a date, which means the start of that day (UTC).
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	return t, nil
+}
+
+// entityNames returns the names of the replayable entities, sorted.
+func entityNames() []string {
+	names := make([]string, 0, len(Entities))
+	for name := range Entities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+)
+
+// Issue is a department or an audit record reported by the replay, with the reason.
+type Issue struct {
+	ID     string
+	Reason string
+}
+
+// Report is the result of a replay, comparing the replayed state with the live table.
+// Missing lists the departments existing in the replayed state but deleted or absent in the live table,
+// the candidates for a restore. Different lists the departments whose fields differ.
+type Report struct {
+	Entity      string
+	Table       string
+	From        time.Time
+	To          *time.Time
+	Read        int
+	Replayed    int
+	Deleted     int
+	Unchanged   int
+	Missing     []Issue
+	Different   []Issue
+	Undecodable []Issue
+}
+
+// OK checks if the live table matches the replayed state and every audit record was replayed.
+func (r Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Different) == 0 && len(r.Undecodable) == 0
+}
+
+// Compare compares the replayed departments with the live ones and fills the report.
+func (r *Report) Compare(replayed []ReplayedDepartment, live []department.Department) {
+	byID := make(map[string]department.Department, len(live))
+	for _, d := range live {
+		byID[d.ID] = d
+	}
+
+	r.Replayed = len(replayed)
+	for _, rd := range replayed {
+		expected := rd.Department
+		if isDeleted(expected) {
+			r.Deleted++
+		}
+
+		current, ok := byID[expected.ID]
+		switch {
+		case !ok && isDeleted(expected):
+			r.Unchanged++
+		case !ok:
+			r.Missing = append(r.Missing, Issue{ID: expected.ID, Reason: "not in the live table, last " + describeEvent(rd)})
+		case !isDeleted(expected) && isDeleted(current):
+			r.Missing = append(r.Missing, Issue{ID: expected.ID, Reason: fmt.Sprintf("deleted at %s, last %s", current.DeletedAt.Time.Format(time.RFC3339), describeEvent(rd))})
+		default:
+			if diff := compare(expected, current); diff != "" {
+				r.Different = append(r.Different, Issue{ID: expected.ID, Reason: diff + ", last " + describeEvent(rd)})
+			} else {
+				r.Unchanged++
+			}
+		}
+	}
+}
+
+// Print writes the replay report.
+func (r Report) Print(out io.Writer) {
+	period := "from " + r.From.Format(time.RFC3339)
+	if r.To != nil {
+		period += " to " + r.To.Format(time.RFC3339)
+	}
+
+	fmt.Fprintf(out, "Audit records of %s read %s: %d\n", r.Entity, period, r.Read)
+	fmt.Fprintf(out, "Replayed into %s: %d (%d deleted)\n", r.Table, r.Replayed, r.Deleted)
+	fmt.Fprintf(out, "Unchanged:   %d\n", r.Unchanged)
+	fmt.Fprintf(out, "Missing:     %d\n", len(r.Missing))
+	fmt.Fprintf(out, "Different:   %d\n", len(r.Different))
+	fmt.Fprintf(out, "Undecodable: %d\n", len(r.Undecodable))
+
+	printIssues(out, "Missing", r.Missing)
+	printIssues(out, "Different", r.Different)
+	printIssues(out, "Undecodable", r.Undecodable)
+}
+
+// compare returns the fields of the live department that differ from the replayed one.
+// The employee count and the bookkeeping dates are not compared, the transfers of the users do not
+// produce department records.
+func compare(expected department.Department, current department.Department) string {
+	var diffs []string
+	if expected.DeptName != current.DeptName {
+		diffs = append(diffs, "deptName")
+	}
+	if expected.Active != current.Active {
+		diffs = append(diffs, "active")
+	}
+	if expected.Status != current.Status {
+		diffs = append(diffs, "status")
+	}
+	if !slices.Equal(expected.Tags, current.Tags) {
+		diffs = append(diffs, "tags")
+	}
+	if (len(expected.Metadata) > 0 || len(current.Metadata) > 0) && !reflect.DeepEqual(expected.Metadata, current.Metadata) {
+		diffs = append(diffs, "metadata")
+	}
+	if !reflect.DeepEqual(expected.ManagedBy, current.ManagedBy) {
+		diffs = append(diffs, "managedBy")
+	}
+	if isDeleted(expected) != isDeleted(current) {
+		diffs = append(diffs, "deletedAt")
+	}
+
+	if len(diffs) == 0 {
+		return ""
+	}
+	return "different " + strings.Join(diffs, ", ")
+}
+
+// isDeleted checks if the department is soft-deleted.
+func isDeleted(d department.Department) bool {
+	return d.DeletedAt != nil && d.DeletedAt.Valid
+}
+
+// describeEvent describes the last audit record applied to a replayed department.
+func describeEvent(rd ReplayedDepartment) string {
+	return fmt.Sprintf("%s at %s", rd.LastEventType, rd.LastEventAt.Format(time.RFC3339))
+}
+
+// printIssues writes one line per issue.
+func printIssues(out io.Writer, label string, issues []Issue) {
+	for _, issue := range issues {
+		fmt.Fprintf(out, "%s %q: %s\n", label, issue.ID, issue.Reason)
+	}
+}
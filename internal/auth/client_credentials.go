@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
+)
+
+// ClientCredentialsGrant is the grant type of the token requests of the clients (RFC 6749 4.4).
+const ClientCredentialsGrant = "client_credentials"
+
+// IssueClientToken issues an access token to a client authenticated with its ID and secret,
+// so the back-end integrations no longer log in as a dummy user.
+// The token carries the requested scopes, which must all be allowed for the client, instead of the roles of a user.
+// It has no session and no refresh token, the client requests a new token once it expires.
+func (s *authService) IssueClientToken(ctx context.Context, req ClientCredentialsRequest) (ClientTokenResponse, error) {
+	// Load environment variables
+	LoadEnv()
+
+	if req.GrantType != ClientCredentialsGrant {
+		return ClientTokenResponse{}, ErrUnsupportedGrantType
+	}
+
+	client, err := s.clientService().Authenticate(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return ClientTokenResponse{}, err
+	}
+
+	// Grant all the scopes of the client unless a subset is requested
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !client.Scopes.Contains(scope) {
+			return ClientTokenResponse{}, ErrInvalidScope
+		}
+	}
+
+	// Generate the access token of the client, with the TTL of the access tokens of the users
+	now := s.clock.Now().Unix()
+	exp := GetJWTExpiration(now)
+	if s.tokenTTL > 0 {
+		exp = now + int64(s.tokenTTL/time.Second)
+	}
+	tokenStr, err := signJWTToken(NewClientClaims(client, scopes, now, exp))
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to generate JWT token for client %s: %v", client.ID, err))
+		return ClientTokenResponse{}, err
+	}
+
+	return ClientTokenResponse{
+		AccessToken: tokenStr,
+		TokenType:   TokenType,
+		ExpiresIn:   exp - now,
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// NewClientClaims creates the claims of an access token for the client, issued at and expiring at the given Unix times.
+// The client_id claim marks the token of a client, its scopes are granted as roles in the scope claim,
+// separated by spaces (RFC 8693).
+func NewClientClaims(client oauthclient.Client, scopes []string, iat int64, exp int64) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":          client.ID,
+		"aud":          JWTAudience,
+		"iss":          JWTIssuer,
+		"iat":          iat,
+		"exp":          exp,
+		"jti":          uuid.NewString(),
+		"client_id":    client.ID,
+		"scope":        strings.Join(scopes, " "),
+		"tokenversion": tokenversion.Current(),
+	}
+}
+
+// clientService returns the client service of the client credentials grant, the default one unless set with WithClientService.
+func (s *authService) clientService() oauthclient.ClientService {
+	if s.clients != nil {
+		return s.clients
+	}
+
+	return oauthclient.NewClientService(oauthclient.NewClientRepository())
+}
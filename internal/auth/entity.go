@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
 	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -10,15 +13,106 @@ var v *validator.Validate
 // LoginRequest represents the request payload for user login.
 type LoginRequest struct {
 	UserName string `json:"username" validate:"required,min=3,max=20"`
-	Password string `json:"password" validate:"required,min=8,max=20"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	// ClientID is the ID of the device logging in, its new logins replace its previous session, optional
+	ClientID string `json:"clientId,omitempty" validate:"omitempty,max=64,printascii"`
+	// RememberMe keeps the session for longer (JWT_REMEMBER_ME_REFRESH_TOKEN_EXPIRATION_HOUR), optional
+	RememberMe bool `json:"rememberMe,omitempty"`
+	// CaptchaToken is the CAPTCHA answer, required when CAPTCHA_ENDPOINTS lists the login
+	CaptchaToken string `json:"captchaToken,omitempty" validate:"max=4096"`
+	// Client is the device and the address the request comes from, set by the handler
+	Client refreshtoken.Client `json:"-"`
 }
 
 // LoginResponse represents the response payload for user login.
+// The tokens are left out of the body when they are delivered in cookies (see pkg/tokencookie).
 type LoginResponse struct {
+	AccessToken    string `json:"accessToken,omitempty"`
+	RefreshToken   string `json:"refreshToken,omitempty"`
+	ExpirationDate string `json:"expirationDate"`
+	TokenType      string `json:"tokenType"`
+	// RefreshExpiresAt is the expiry of the refresh token, the one of its cookie
+	RefreshExpiresAt time.Time `json:"-"`
+}
+
+// ReauthRequest represents the request payload of a re-authentication, the password of the user of the access token.
+type ReauthRequest struct {
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// CSRFTokenResponse represents the response payload of the CSRF token issuance, the token to send back
+// in the X-CSRF-Token header with the state-changing requests authenticated with the cookies.
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrfToken"`
+}
+
+// ImpersonationResponse represents the response payload of an impersonation.
+// The token cannot be refreshed, a new impersonation is needed once it expires.
+type ImpersonationResponse struct {
 	AccessToken    string `json:"accessToken"`
-	RefreshToken   string `json:"refreshToken"`
 	ExpirationDate string `json:"expirationDate"`
 	TokenType      string `json:"tokenType"`
+	ImpersonatedBy int64  `json:"impersonatedBy"`
+}
+
+// Impersonation is the data of the user.impersonated event recorded in the audit trail.
+type Impersonation struct {
+	UserID         int64     `json:"userId"`
+	UserName       string    `json:"userName"`
+	ImpersonatedBy int64     `json:"impersonatedBy"`
+	AdminUserName  string    `json:"adminUserName"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// ForgotPasswordRequest represents the request payload for a password reset link.
+type ForgotPasswordRequest struct {
+	Email        string `json:"email" validate:"required,email,max=100"`
+	CaptchaToken string `json:"captchaToken,omitempty" validate:"max=4096"`
+	// RemoteIP is the address of the client, given to the CAPTCHA provider, set by the handler
+	RemoteIP string `json:"-"`
+}
+
+// ResetPasswordRequest represents the request payload for setting a new password with a reset token.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required,max=100"`
+	NewPassword string `json:"newPassword" validate:"required,max=72,password,notcommon"`
+}
+
+// RegistrationRequest represents the request payload of a self-registration.
+// The password is checked against the password policy with the user name and e-mail, like the one of a created user.
+type RegistrationRequest struct {
+	UserName     string  `json:"userName" validate:"required,min=3,max=20"`
+	Email        string  `json:"email" validate:"required,email,max=100"`
+	Password     string  `json:"password" validate:"required,max=72,password,notcommon,notidentity=UserName Email"`
+	FirstName    string  `json:"firstName" validate:"required,max=20"`
+	LastName     *string `json:"lastName,omitempty" validate:"omitempty,max=20"`
+	CaptchaToken string  `json:"captchaToken,omitempty" validate:"max=4096"`
+	// RemoteIP is the address of the client, given to the CAPTCHA provider, set by the handler
+	RemoteIP string `json:"-"`
+}
+
+// VerifyRegistrationRequest represents the request payload confirming a self-registration with the token e-mailed to it.
+type VerifyRegistrationRequest struct {
+	Token string `json:"token" validate:"required,max=100"`
+}
+
+// ClientCredentialsRequest represents the form of a token request with the client credentials grant (RFC 6749 4.4).
+// The credentials are taken from the form or from the Basic authorization header.
+type ClientCredentialsRequest struct {
+	GrantType    string `form:"grant_type"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+	// Scope is the space-separated list of the requested scopes, all the scopes of the client when empty
+	Scope string `form:"scope"`
+}
+
+// ClientTokenResponse represents the access token issued to a client (RFC 6749 5.1).
+// It is served as is, without the response envelope, as the OAuth2 clients expect.
+type ClientTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
 }
 
 // Validate validates the LoginRequest struct using the validator package.
@@ -31,3 +125,53 @@ func (a *LoginRequest) Validate() error {
 	}
 	return nil
 }
+
+// Validate validates the ReauthRequest struct using the validator package.
+func (a *ReauthRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(a); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the ForgotPasswordRequest struct using the validator package.
+func (a *ForgotPasswordRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(a); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the ResetPasswordRequest struct using the validator package.
+func (a *ResetPasswordRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(a); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the RegistrationRequest struct using the validator package.
+func (a *RegistrationRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(a); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate validates the VerifyRegistrationRequest struct using the validator package.
+func (a *VerifyRegistrationRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(a); err != nil {
+		return err
+	}
+	return nil
+}
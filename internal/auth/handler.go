@@ -2,10 +2,21 @@ package auth
 
 import (
 	"errors"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
 	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -43,6 +54,9 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// Record the device and the address of the new session
+	loginReq.Client = refreshtoken.Client{ClientID: loginReq.ClientID, Device: c.Request.UserAgent(), IPAddress: c.ClientIP()}
+
 	// Call the service to authenticate the user and get the token
 	loginResp, err := h.Service.Login(c.Request.Context(), loginReq)
 
@@ -54,10 +68,27 @@ func (h *AuthHandler) Login(c *gin.Context) {
 			return
 		}
 
+		// A locked username is told when to try again
+		var throttled *loginthrottle.ThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		}
+
+		// The other errors are not detailed, so the response does not reveal the usernames
+		if (errors.Is(err, captcha.ErrInvalidCaptcha) || throttled != nil) && util.JSONAppError(c, "Failed to login", err) {
+			return
+		}
+
 		util.JSONError(c, http.StatusUnauthorized, "Failed to login", err.Error())
 		return
 	}
 
+	// Deliver the tokens in their cookies instead of the body, if configured
+	if tokencookie.Enabled() {
+		setTokenCookies(c, loginResp.AccessToken, loginResp.ExpirationDate, loginResp.RefreshToken, loginResp.RefreshExpiresAt)
+		loginResp.AccessToken, loginResp.RefreshToken = "", ""
+	}
+
 	util.JSONSuccess(c, http.StatusOK, "Login successful", loginResp)
 }
 
@@ -76,11 +107,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	// Bind the request body to the RefreshTokenRequest struct
 	// This struct contains the refresh token field
+	// The requests relying on the refresh token cookie may have no body
 	var refreshTokenReq refreshtoken.RefreshTokenRequest
-	if err := c.ShouldBindJSON(&refreshTokenReq); err != nil {
+	if err := c.ShouldBindJSON(&refreshTokenReq); err != nil && !(tokencookie.Enabled() && errors.Is(err, io.EOF)) {
 		util.JSONError(c, http.StatusBadRequest, "Invalid request", err.Error())
 		return
 	}
+	if refreshTokenReq.RefreshToken == "" && tokencookie.Enabled() {
+		refreshTokenReq.RefreshToken = tokencookie.RefreshToken(c.Request)
+	}
+
+	// Record the address the session is used from
+	refreshTokenReq.Client = refreshtoken.Client{Device: c.Request.UserAgent(), IPAddress: c.ClientIP()}
 
 	// Call the service to refresh the token
 	refreshTokenResp, err := h.Service.RefreshToken(c.Request.Context(), refreshTokenReq)
@@ -97,5 +135,420 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	// Deliver the tokens in their cookies instead of the body, if configured
+	if tokencookie.Enabled() {
+		setTokenCookies(c, refreshTokenResp.AccessToken, refreshTokenResp.ExpirationDate, refreshTokenResp.RefreshToken, refreshTokenResp.RefreshExpiresAt)
+		refreshTokenResp.AccessToken, refreshTokenResp.RefreshToken = "", ""
+	}
+
 	util.JSONSuccess(c, http.StatusOK, "Token refreshed successfully", refreshTokenResp)
 }
+
+// ForgotPassword handles password reset link requests.
+// It always answers 202 for a valid request, so the response does not reveal the registered e-mails.
+// @Summary      Forgot password
+// @Description  E-mail a single-use password reset token to the user
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ForgotPasswordRequest  true  "Forgot password request"
+// @Success      202  {object}  model.HttpResponse for accepted request
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	// Bind the request body to the ForgotPasswordRequest struct
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+	req.RemoteIP = c.ClientIP()
+
+	if err := h.Service.ForgotPassword(c.Request.Context(), req); err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to request a password reset", util.FormatValidationErrors(err))
+			return
+		}
+		if util.JSONAppError(c, "Failed to request a password reset", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to request a password reset", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusAccepted, "If the e-mail is registered, a password reset link has been sent", nil)
+}
+
+// ResetPassword handles password reset requests.
+// It sets the new password of the user the reset token was issued to.
+// @Summary      Reset password
+// @Description  Set a new password with a password reset token, without being logged in
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ResetPasswordRequest  true  "Reset password request"
+// @Success      200  {object}  model.HttpResponse for successful reset
+// @Failure      400  {object}  model.HttpResponse for bad request or invalid token
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	// Bind the request body to the ResetPasswordRequest struct
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := h.Service.ResetPassword(c.Request.Context(), req); err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to reset password", util.FormatValidationErrors(err))
+			return
+		}
+		if util.JSONAppError(c, "Failed to reset password", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to reset password", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Password reset successfully", nil)
+}
+
+// Register handles the self-registration requests.
+// It e-mails a verification link to the address, the user is only created once the link is opened.
+// @Summary      Self-registration
+// @Description  Sign up as a user with the ROLE_USER role, enabled with SELF_REGISTRATION_ENABLED
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      RegistrationRequest  true  "Registration request"
+// @Success      202  {object}  model.HttpResponse for accepted registration
+// @Failure      400  {object}  model.HttpResponse for bad request or invalid CAPTCHA
+// @Failure      409  {object}  model.HttpResponse for taken username
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /auth/register [post]
+func (h *AuthHandler) Register(c *gin.Context) {
+	// Bind the request body to the RegistrationRequest struct
+	var req RegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+	req.RemoteIP = c.ClientIP()
+
+	if err := h.Service.Register(c.Request.Context(), req); err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to register", util.FormatValidationErrors(err))
+			return
+		}
+		if util.JSONAppError(c, "Failed to register", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to register", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusAccepted, "If the e-mail is free, a verification link has been sent", nil)
+}
+
+// VerifyRegistration handles the verification of the self-registrations.
+// It creates the user of the registration the verification token was issued to.
+// @Summary      Verify a self-registration
+// @Description  Create the user of a self-registration with the token e-mailed to it
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      VerifyRegistrationRequest  true  "Verify registration request"
+// @Success      201  {object}  model.HttpResponse for created user
+// @Failure      400  {object}  model.HttpResponse for bad request or invalid token
+// @Failure      409  {object}  model.HttpResponse for taken username or e-mail
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /auth/register/verify [post]
+func (h *AuthHandler) VerifyRegistration(c *gin.Context) {
+	// Bind the request body to the VerifyRegistrationRequest struct
+	var req VerifyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	createdUser, err := h.Service.VerifyRegistration(c.Request.Context(), req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to verify registration", util.FormatValidationErrors(err))
+			return
+		}
+		if util.JSONAppError(c, "Failed to verify registration", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to verify registration", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusCreated, "Registration verified successfully", createdUser)
+}
+
+// Impersonate handles the impersonation requests of the admins.
+// It issues a short-lived access token for the user, recorded in the audit trail.
+// @Summary      Impersonate a user
+// @Description  Issue a short-lived access token for the user with the impersonated_by claim
+// @Tags         auth
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  model.HttpResponse for successful impersonation
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      403  {object}  model.HttpResponse for nested impersonation
+// @Failure      404  {object}  model.HttpResponse for user not found
+// @Failure      409  {object}  model.HttpResponse for self or disabled user impersonation
+// @Router       /users/{id}/impersonate [post]
+func (h *AuthHandler) Impersonate(c *gin.Context) {
+	// Parse the ID of the user to impersonate
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	resp, err := h.Service.Impersonate(c.Request.Context(), id)
+	if err != nil {
+		if util.JSONAppError(c, "Failed to impersonate user", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to impersonate user", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "User impersonated successfully", resp)
+}
+
+// Reauthenticate handles the re-authentication requests of the users, for the endpoints requiring a recent authentication.
+// It checks the password of the user of the access token and returns a new access token of the session.
+// @Summary      Re-authenticate
+// @Description  Enter the password again to get an access token with a recent authentication time
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ReauthRequest  true  "Re-authentication request"
+// @Success      200  {object}  model.HttpResponse for successful re-authentication
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      401  {object}  model.HttpResponse for an invalid password
+// @Failure      403  {object}  model.HttpResponse for a token without login session
+// @Failure      429  {object}  model.HttpResponse for a throttled username
+// @Router       /auth/reauth [post]
+func (h *AuthHandler) Reauthenticate(c *gin.Context) {
+	// Bind the request body to the ReauthRequest struct
+	var req ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	resp, err := h.Service.Reauthenticate(c.Request.Context(), req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to re-authenticate", util.FormatValidationErrors(err))
+			return
+		}
+
+		// A locked username is told when to try again
+		var throttled *loginthrottle.ThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		}
+		if util.JSONAppError(c, "Failed to re-authenticate", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusUnauthorized, "Failed to re-authenticate", err.Error())
+		return
+	}
+
+	// Deliver the access token in its cookie instead of the body, if configured
+	// The refresh token of the session is unchanged, its cookie is kept
+	if tokencookie.Enabled() {
+		accessExpiresAt, _ := time.Parse(time.RFC3339, resp.ExpirationDate)
+		tokencookie.SetAccessToken(c.Writer, resp.AccessToken, accessExpiresAt)
+		resp.AccessToken = ""
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Re-authenticated successfully", resp)
+}
+
+// oauthErrors maps the typed errors of the token requests to the error codes of RFC 6749 5.2.
+var oauthErrors = map[error]string{
+	ErrUnsupportedGrantType:      "unsupported_grant_type",
+	ErrInvalidScope:              "invalid_scope",
+	oauthclient.ErrInvalidClient: "invalid_client",
+}
+
+// Token handles the token requests of the clients with the client credentials grant.
+// The request is form-encoded and the response is served without the response envelope, as the OAuth2 clients expect,
+// with the errors of RFC 6749 5.2. The client authenticates with the Basic authorization header or in the form.
+// @Summary      Client credentials token
+// @Description  Issue an access token carrying the scopes of a client, with grant_type=client_credentials
+// @Tags         auth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Success      200  {object}  ClientTokenResponse
+// @Failure      400  {object}  model.HttpResponse for an invalid request, grant type or scope
+// @Failure      401  {object}  model.HttpResponse for an invalid client
+// @Router       /auth/token [post]
+func (h *AuthHandler) Token(c *gin.Context) {
+	// The token responses are credentials, they must not be kept by the caches
+	c.Header("Cache-Control", "no-store")
+
+	var req ClientCredentialsRequest
+	if err := c.ShouldBindWith(&req, binding.Form); err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// The credentials of the Basic scheme are form-encoded (RFC 6749 2.3.1), and only one scheme may be used
+	id, secret, basic := c.Request.BasicAuth()
+	if basic {
+		if req.ClientID != "" || req.ClientSecret != "" {
+			oauthError(c, http.StatusBadRequest, "invalid_request", "the client credentials are given both in the header and in the form")
+			return
+		}
+		req.ClientID, _ = url.QueryUnescape(id)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	resp, err := h.Service.IssueClientToken(c.Request.Context(), req)
+	if err != nil {
+		appErr, ok := apperror.As(err)
+		code, known := oauthErrors[appErr]
+		if !ok || !known {
+			oauthError(c, http.StatusInternalServerError, "server_error", "The token could not be issued")
+			return
+		}
+
+		// The clients authenticated with the Basic scheme are challenged again
+		if appErr == oauthclient.ErrInvalidClient && basic {
+			c.Header("WWW-Authenticate", `Basic realm="token"`)
+		}
+		oauthError(c, appErr.Status, code, appErr.Message)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// oauthError writes an error response of RFC 6749 5.2.
+func oauthError(c *gin.Context, status int, code string, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
+
+// OIDCLogin starts a login with an OpenID Connect provider (Google or Microsoft).
+// It redirects the user to the provider, which redirects them back to the callback once authenticated.
+// @Summary      OIDC login
+// @Description  Redirect to the login page of the identity provider
+// @Tags         auth
+// @Param        provider  path  string  true  "Identity provider (google or microsoft)"
+// @Success      302
+// @Failure      404  {object}  model.HttpResponse for an unknown provider
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /auth/oidc/{provider} [get]
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	location, err := h.Service.OIDCAuthorizationURL(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if util.JSONAppError(c, "Failed to start the login", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to start the login", err.Error())
+		return
+	}
+
+	c.Redirect(http.StatusFound, location)
+}
+
+// OIDCCallback handles the redirection of an OpenID Connect provider at the end of a login.
+// The user of the external identity gets the access token and the refresh token of a password login.
+// @Summary      OIDC callback
+// @Description  Complete the login with the identity provider
+// @Tags         auth
+// @Produce      json
+// @Param        provider  path   string  true   "Identity provider (google or microsoft)"
+// @Param        code      query  string  true   "Authorization code"
+// @Param        state     query  string  true   "State of the login"
+// @Success      200  {object}  model.HttpResponse for successful login
+// @Failure      400  {object}  model.HttpResponse for an invalid state
+// @Failure      401  {object}  model.HttpResponse for a login refused by the provider
+// @Failure      403  {object}  model.HttpResponse for an identity linked to no user
+// @Router       /auth/oidc/{provider}/callback [get]
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	// The provider redirects with an error when the user cancels the login or the request is refused
+	if providerErr := c.Query("error"); providerErr != "" {
+		util.JSONError(c, ErrOIDCLoginFailed.Status, "Failed to login", providerErr+" "+c.Query("error_description"))
+		return
+	}
+
+	// Record the device and the address of the new session
+	req := OIDCCallbackRequest{
+		Provider: c.Param("provider"),
+		Code:     c.Query("code"),
+		State:    c.Query("state"),
+		Client:   refreshtoken.Client{Device: c.Request.UserAgent(), IPAddress: c.ClientIP()},
+	}
+
+	loginResp, err := h.Service.OIDCCallback(c.Request.Context(), req)
+	if err != nil {
+		if util.JSONAppError(c, "Failed to login", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusUnauthorized, "Failed to login", err.Error())
+		return
+	}
+
+	// Deliver the tokens in their cookies instead of the body, if configured
+	if tokencookie.Enabled() {
+		setTokenCookies(c, loginResp.AccessToken, loginResp.ExpirationDate, loginResp.RefreshToken, loginResp.RefreshExpiresAt)
+		loginResp.AccessToken, loginResp.RefreshToken = "", ""
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Login successful", loginResp)
+}
+
+// CSRFToken issues the CSRF token of the cookie authentication.
+// It sets the CSRF token cookie, keeping the token of the request cookie, and returns the token.
+// @Summary      Get a CSRF token
+// @Description  Get the token to send in the X-CSRF-Token header with the state-changing requests authenticated with the cookies
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  model.HttpResponse for successful issuance
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /auth/csrf-token [get]
+func (h *AuthHandler) CSRFToken(c *gin.Context) {
+	token, err := tokencookie.SetCSRFToken(c.Writer, c.Request)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to issue a CSRF token", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	util.JSONSuccess(c, http.StatusOK, "CSRF token issued", CSRFTokenResponse{CSRFToken: token})
+}
+
+// setTokenCookies sets the cookies of the tokens of a session, the access token cookie expires with the access token.
+func setTokenCookies(c *gin.Context, accessToken string, expirationDate string, refreshToken string, refreshExpiresAt time.Time) {
+	accessExpiresAt, _ := time.Parse(time.RFC3339, expirationDate)
+	tokencookie.Set(c.Writer, accessToken, accessExpiresAt, refreshToken, refreshExpiresAt)
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// JWKSPath is the path of the JSON Web Key Set, the well-known location of RFC 8615.
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWK is a public key of a JSON Web Key Set, as defined by RFC 7517.
+// The RSA keys have a modulus and an exponent, the EC (RFC 7518) and OKP (RFC 8037) keys a curve and coordinates.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the set of the public keys validating the access tokens.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwkAlgorithms are the signing methods of the key types.
+var jwkAlgorithms = map[string]string{
+	"RSA": jwt.SigningMethodRS256.Alg(),
+	"EC":  jwt.SigningMethodES256.Alg(),
+	"OKP": jwt.SigningMethodEdDSA.Alg(),
+}
+
+// NewJWK returns the JWK of a public key verifying the RS256, ES256 or EdDSA signatures.
+// Its key ID is the RFC 7638 thumbprint of the key, so it changes with the key.
+func NewJWK(key crypto.PublicKey) JWK {
+	members, _ := util.PublicKeyMembers(key)
+	return JWK{
+		Kty: members["kty"],
+		Use: "sig",
+		Alg: jwkAlgorithms[members["kty"]],
+		Kid: util.PublicKeyID(key),
+		N:   members["n"],
+		E:   members["e"],
+		Crv: members["crv"],
+		X:   members["x"],
+		Y:   members["y"],
+	}
+}
+
+// GetJWKS returns the key set validating the access tokens: the signing key first, then the previous keys
+// still validating the tokens they signed during a key rotation.
+// The HS256 secret is symmetric and never published, so the set is empty unless the tokens are signed
+// with RS256, ES256 or EdDSA.
+func GetJWKS() (JWKSet, error) {
+	LoadEnv()
+
+	set := JWKSet{Keys: []JWK{}}
+	if !isKeyPairMethod(SigningMethod) {
+		return set, nil
+	}
+
+	publicKeys, err := util.LoadPublicKeys(SigningMethod)
+	if err != nil {
+		return JWKSet{}, err
+	}
+	for _, key := range publicKeys {
+		set.Keys = append(set.Keys, NewJWK(key))
+	}
+
+	return set, nil
+}
+
+// JWKSHandler serves the JSON Web Key Set, so the clients and the other services validate the access tokens
+// without sharing the key file. The set is served as is, without the response envelope, as the JWKS clients expect.
+// @Summary      Get the JSON Web Key Set
+// @Description  Get the public keys validating the access tokens, empty when they are signed with HS256
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  JWKSet
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /.well-known/jwks.json [get]
+func JWKSHandler(c *gin.Context) {
+	set, err := GetJWKS()
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to load the public key of the JWKS: %v", err))
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve the key set", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/authmetrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/scheduler"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+)
+
+// failureReasons are the reasons of the untyped errors refusing the logins and the refreshes.
+var failureReasons = map[string]string{
+	"user not found":                         "UserNotFound",
+	"user with the given username not found": "UserNotFound",
+	"invalid password":                       "InvalidPassword",
+	"user is not enabled":                    "UserDisabled",
+	"user account is expired":                "AccountExpired",
+	"user account is locked":                 "AccountLocked",
+	"user credentials are expired":           "CredentialsExpired",
+	"user account is deleted":                "UserDeleted",
+	"refresh token not found":                "RefreshTokenNotFound",
+	"refresh token is expired":               "RefreshTokenExpired",
+}
+
+// failureReason returns the reason of a refused login or refresh counted in the metrics, empty when it succeeded.
+// The typed errors are counted by their code, the other errors by a reason of failureReasons, or as Error.
+func failureReason(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		return "InvalidRequest"
+	}
+	if e, ok := apperror.As(err); ok {
+		return e.Code
+	}
+	if reason, ok := failureReasons[err.Error()]; ok {
+		return reason
+	}
+
+	return "Error"
+}
+
+// InitMetricsJob schedules the job counting the active sessions and logging the summary of the authentication
+// events every AUTH_METRICS_INTERVAL_MINUTES.
+func InitMetricsJob(db *gorm.DB) {
+	if db == nil {
+		logger.Error("Failed to start the authentication metrics: database connection is nil")
+		return
+	}
+
+	service := refreshtoken.NewRefreshTokenService(refreshtoken.NewRefreshTokenRepository())
+
+	scheduler.Schedule(scheduler.Job{
+		Name:     "auth-metrics",
+		Interval: authmetrics.SummaryInterval,
+		Run: func(ctx context.Context) error {
+			summary := authmetrics.TakeSummary()
+
+			// The summary is logged even when the sessions cannot be counted
+			sessions, err := service.CountActiveSessions(dbcontext.InjectDB(ctx, db))
+			if err == nil {
+				authmetrics.SetActiveSessions(sessions)
+			}
+
+			logger.Info(formatSummary(summary, sessions, err == nil))
+			return err
+		},
+	})
+}
+
+// formatSummary formats the summary of the authentication events logged by the metrics job.
+func formatSummary(s authmetrics.Summary, sessions int64, counted bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Authentication in the last %s: %d logins, %d failed", authmetrics.SummaryInterval, s.Logins, s.FailedLogins)
+
+	if len(s.FailureReasons) > 0 {
+		reasons := make([]string, 0, len(s.FailureReasons))
+		for reason := range s.FailureReasons {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+
+		for i, reason := range reasons {
+			reasons[i] = fmt.Sprintf("%s %d", reason, s.FailureReasons[reason])
+		}
+		fmt.Fprintf(&b, " (%s)", strings.Join(reasons, ", "))
+	}
+
+	fmt.Fprintf(&b, ", %d token refreshes, %d failed, %d revocations", s.Refreshes, s.FailedRefreshes, s.Revocations)
+	if counted {
+		fmt.Fprintf(&b, ", %d active sessions", sessions)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/oidc"
+)
+
+// The logins with a provider are stored in Redis under the SHA-256 of their state, until the provider
+// redirects the user back to the callback. A login not completed within the TTL has to be started again.
+const (
+	oidcStateKeyPrefix = "oidc_state:"
+	oidcStateTTL       = 10 * time.Minute
+)
+
+// Typed errors returned by the OIDC logins
+var (
+	ErrOIDCProviderNotFound = apperror.New("OIDCProviderNotFound", http.StatusNotFound, "the identity provider is unknown or not configured")
+	ErrInvalidOIDCState     = apperror.New("InvalidOIDCState", http.StatusBadRequest, "the login state is invalid, expired or already used")
+	ErrOIDCLoginFailed      = apperror.New("OIDCLoginFailed", http.StatusUnauthorized, "the identity provider did not authenticate the user")
+)
+
+// OIDCCallbackRequest is the redirection of a provider back to the API at the end of a login.
+type OIDCCallbackRequest struct {
+	Provider string
+	Code     string
+	State    string
+	// Client is the device and the address the request comes from, set by the handler
+	Client refreshtoken.Client
+}
+
+// pendingOIDCLogin is a login waiting for the callback of its provider, as stored in Redis.
+type pendingOIDCLogin struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// OIDCAuthorizationURL starts a login with the provider and returns the URL the user is redirected to.
+// The state, the nonce and the code verifier of the login are kept until the callback.
+func (s *authService) OIDCAuthorizationURL(ctx context.Context, providerName string) (string, error) {
+	provider, ok := oidc.Lookup(providerName)
+	if !ok {
+		return "", ErrOIDCProviderNotFound
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return "", errors.New("redis client is nil")
+	}
+
+	meta, err := provider.Discover(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		return "", err
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = oidc.RandomString(); err != nil {
+			return "", err
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	pending, err := json.Marshal(pendingOIDCLogin{Provider: provider.Name, Nonce: nonce, Verifier: verifier})
+	if err != nil {
+		return "", err
+	}
+	if err := redisClient.Set(ctx, oidcStateKeyPrefix+hashToken(state), pending, oidcStateTTL).Err(); err != nil {
+		logger.Error(fmt.Sprintf("failed to store OIDC login: %v", err))
+		return "", err
+	}
+
+	return provider.AuthCodeURL(meta, state, nonce, verifier), nil
+}
+
+// OIDCCallback completes a login with a provider: the code is exchanged for the ID token, whose identity is
+// mapped to a local user, and the user gets a session like with a password login.
+// The state is single-use, it is removed as it is read, before the code is exchanged.
+// Every callback is recorded in the login audit, successful or not.
+func (s *authService) OIDCCallback(ctx context.Context, req OIDCCallbackRequest) (LoginResponse, error) {
+	attempt := user.NewLoginAttempt(ctx, user.LoginMethodOIDC, "", req.Client.IPAddress, req.Client.Device)
+	loginResp, err := s.oidcCallback(ctx, req, &attempt)
+	s.recordLoginAttempt(ctx, attempt, err)
+
+	return loginResp, err
+}
+
+// oidcCallback completes a login with a provider. The attempt is named after the external identity once its
+// ID token is verified, then after the local user.
+func (s *authService) oidcCallback(ctx context.Context, req OIDCCallbackRequest, attempt *user.LoginAttempt) (LoginResponse, error) {
+	// Load environment variables
+	LoadEnv()
+
+	provider, ok := oidc.Lookup(req.Provider)
+	if !ok {
+		return LoginResponse{}, ErrOIDCProviderNotFound
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return LoginResponse{}, errors.New("redis client is nil")
+	}
+
+	if req.State == "" || req.Code == "" {
+		return LoginResponse{}, ErrInvalidOIDCState
+	}
+	data, err := redisClient.GetDel(ctx, oidcStateKeyPrefix+hashToken(req.State)).Result()
+	if errors.Is(err, redis.Nil) {
+		return LoginResponse{}, ErrInvalidOIDCState
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to read OIDC login: %v", err))
+		return LoginResponse{}, err
+	}
+
+	var pending pendingOIDCLogin
+	if err := json.Unmarshal([]byte(data), &pending); err != nil || pending.Provider != provider.Name {
+		return LoginResponse{}, ErrInvalidOIDCState
+	}
+
+	// Exchange the code and verify the ID token, the failures of the provider are not detailed to the user
+	meta, err := provider.Discover(ctx)
+	if err != nil {
+		logger.Error(err.Error())
+		return LoginResponse{}, err
+	}
+	rawIDToken, err := provider.Exchange(ctx, meta, req.Code, pending.Verifier)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("failed to exchange the %s code: %v", provider.Name, err))
+		return LoginResponse{}, ErrOIDCLoginFailed
+	}
+	claims, err := provider.VerifyIDToken(ctx, meta, rawIDToken, pending.Nonce)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("refused %s ID token: %v", provider.Name, err))
+		return LoginResponse{}, ErrOIDCLoginFailed
+	}
+
+	// Map the external identity to the local user
+	attempt.UserName = provider.Name + ":" + claims.Subject
+	existingUser, err := s.userService().ResolveExternalIdentity(ctx, user.ExternalLogin{
+		Provider:  provider.Name,
+		Subject:   claims.Subject,
+		Email:     provider.VerifiedEmail(claims),
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+	}, oidc.AutoProvisionEnabled())
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	attempt.UserID, attempt.UserName = &existingUser.ID, existingUser.UserName
+
+	// Check some conditions for the user, as for a password login
+	if err := checkAccount(existingUser); err != nil {
+		return LoginResponse{}, err
+	}
+
+	return s.startSession(ctx, existingUser, req.Client, false)
+}
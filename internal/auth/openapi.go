@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Operations documents the auth handlers in the OpenAPI spec, keyed by handler method name.
+// The errors listed here are the typed errors returned by the service for each operation.
+var Operations = map[string]openapi.Operation{
+	"Login":        {Summary: "Log in", RequestSchema: "login", Errors: []*apperror.Error{captcha.ErrInvalidCaptcha, loginthrottle.ErrLoginThrottled}},
+	"RefreshToken": {Summary: "Refresh the access token", RequestSchema: "refresh-token"},
+	"JWKSHandler":  {Summary: "Get the JSON Web Key Set validating the access tokens"},
+	"CSRFToken":    {Summary: "Get the CSRF token of the cookie authentication"},
+	"ForgotPassword": {
+		Summary:       "Request a password reset e-mail",
+		RequestSchema: "forgot-password",
+		SuccessStatus: http.StatusAccepted,
+		Errors:        []*apperror.Error{captcha.ErrInvalidCaptcha},
+	},
+	"ResetPassword": {
+		Summary:       "Reset the password with a reset token",
+		RequestSchema: "reset-password",
+		Errors:        []*apperror.Error{ErrInvalidResetToken},
+	},
+	"Register": {
+		Summary:       "Sign up and receive an e-mail verification link",
+		RequestSchema: "registration",
+		SuccessStatus: http.StatusAccepted,
+		Errors:        []*apperror.Error{captcha.ErrInvalidCaptcha, user.ErrUserNameTaken},
+	},
+	"VerifyRegistration": {
+		Summary:       "Create the user of a self-registration with its verification token",
+		RequestSchema: "registration-verification",
+		SuccessStatus: http.StatusCreated,
+		Errors:        []*apperror.Error{ErrInvalidRegistrationToken, user.ErrUserNameTaken, user.ErrEmailTaken, user.ErrUserQuotaExceeded},
+	},
+	"Token": {
+		Summary: "Issue an access token to a client with the client credentials grant",
+		Errors:  []*apperror.Error{ErrUnsupportedGrantType, oauthclient.ErrInvalidClient, ErrInvalidScope},
+	},
+	"OIDCLogin": {
+		Summary:       "Start a login with an identity provider",
+		SuccessStatus: http.StatusFound,
+		Errors:        []*apperror.Error{ErrOIDCProviderNotFound},
+	},
+	"OIDCCallback": {
+		Summary: "Complete a login with an identity provider",
+		Errors:  []*apperror.Error{ErrOIDCProviderNotFound, ErrInvalidOIDCState, ErrOIDCLoginFailed, user.ErrIdentityUnverified, user.ErrIdentityNotLinked},
+	},
+	"Reauthenticate": {
+		Summary:       "Enter the password again for the endpoints requiring a recent authentication",
+		RequestSchema: "reauth",
+		Errors:        []*apperror.Error{ErrReauthNotAllowed, ErrReauthFailed, loginthrottle.ErrLoginThrottled},
+	},
+	"Impersonate": {
+		Summary: "Issue a short-lived access token to act as the user",
+		Errors:  []*apperror.Error{ErrImpersonationNested, user.ErrUserNotFound, ErrImpersonateSelf, ErrImpersonationUserDisabled},
+	},
+}
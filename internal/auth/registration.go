@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+)
+
+// Pending registrations are stored in Redis under the SHA-256 of their verification token, with the hash of the
+// password, so the user is only created once its e-mail is verified and the unverified sign-ups leave no account.
+const registrationKeyPrefix = "registration:"
+
+// pendingRegistration is a self-registration waiting for the verification of its e-mail, as stored in Redis.
+type pendingRegistration struct {
+	UserName     string  `json:"userName"`
+	Email        string  `json:"email"`
+	PasswordHash string  `json:"passwordHash"`
+	FirstName    string  `json:"firstName"`
+	LastName     *string `json:"lastName,omitempty"`
+}
+
+// RegistrationEnabled reports whether the self-registration is enabled with SELF_REGISTRATION_ENABLED.
+func RegistrationEnabled() bool {
+	return strings.EqualFold(SelfRegistrationEnabled, "TRUE")
+}
+
+// Register starts the self-registration of a user: the request is checked (password policy, CAPTCHA, free
+// username) and a single-use verification token is e-mailed to the address, the user is created once it is verified.
+// A registered e-mail succeeds as well, so the response does not reveal the registered e-mails: its owner is
+// told about the attempt instead.
+func (s *authService) Register(ctx context.Context, req RegistrationRequest) error {
+	// Load environment variables
+	LoadEnv()
+
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// Refuse the automated sign-ups before anything is looked up
+	if err := captcha.CheckEndpoint(ctx, captcha.Register, req.CaptchaToken, req.RemoteIP); err != nil {
+		return err
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return errors.New("redis client is nil")
+	}
+
+	// The usernames are shown to the other users, a taken one is reported, unlike a registered e-mail
+	userService := s.userService()
+	if _, err := userService.GetUserByUserName(ctx, req.UserName); err == nil {
+		return user.ErrUserNameTaken
+	}
+	if existingUser, err := userService.GetUserByEmail(ctx, req.Email); err == nil {
+		sendMail(registrationAttemptMessage(existingUser), "registration attempt notice", existingUser.ID)
+		return nil
+	}
+
+	// Store the hash of the password, never the password itself
+	hash, err := user.HashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+	pending, err := json.Marshal(pendingRegistration{
+		UserName:     req.UserName,
+		Email:        req.Email,
+		PasswordHash: hash,
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Generate the token, only its hash is stored
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := redisClient.Set(ctx, registrationKeyPrefix+hashToken(token), pending, RegistrationTTL).Err(); err != nil {
+		logger.Error(fmt.Sprintf("failed to store registration: %v", err))
+		return err
+	}
+
+	// Send the e-mail in the background, so the response time does not reveal the registered e-mails
+	sendMail(verifyRegistrationMessage(req, token), "registration e-mail", 0)
+
+	return nil
+}
+
+// VerifyRegistration creates the user of a pending self-registration with the token e-mailed to it.
+// The token is only removed once the user is created, so a failed creation can be retried with it.
+func (s *authService) VerifyRegistration(ctx context.Context, req VerifyRegistrationRequest) (user.User, error) {
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return user.User{}, err
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return user.User{}, errors.New("redis client is nil")
+	}
+
+	tokenKey := registrationKeyPrefix + hashToken(req.Token)
+	data, err := redisClient.Get(ctx, tokenKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return user.User{}, ErrInvalidRegistrationToken
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to read registration: %v", err))
+		return user.User{}, err
+	}
+
+	var pending pendingRegistration
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return user.User{}, ErrInvalidRegistrationToken
+	}
+
+	// The username and the e-mail are checked again, they may have been taken since the registration
+	createdUser, err := s.userService().RegisterUser(ctx, user.User{
+		UserName:  pending.UserName,
+		Email:     pending.Email,
+		Password:  pending.PasswordHash,
+		FirstName: pending.FirstName,
+		LastName:  pending.LastName,
+	})
+	if err != nil {
+		return user.User{}, err
+	}
+
+	redisClient.Del(ctx, tokenKey)
+
+	return createdUser, nil
+}
+
+// userService returns the user service of the self-registrations, the default one unless set with WithUserService.
+func (s *authService) userService() user.UserService {
+	if s.users != nil {
+		return s.users
+	}
+
+	return user.NewUserService(user.NewUserRepository())
+}
+
+// verifyRegistrationMessage builds the e-mail verifying the address of a self-registration.
+// The token is added to REGISTRATION_VERIFY_URL when set, otherwise it is given as is.
+func verifyRegistrationMessage(req RegistrationRequest, token string) mailer.Message {
+	instructions := "Use the following token to verify your e-mail address: " + token
+	if link, err := url.Parse(RegistrationURL); RegistrationURL != "" && err == nil {
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		instructions = "Open the following link to verify your e-mail address: " + link.String()
+	}
+
+	return mailer.Message{
+		To:      req.Email,
+		Subject: "Verify your e-mail address",
+		Body: fmt.Sprintf("Hello %s,\n\n%s\n\nYour account %s is created once your e-mail address is verified. "+
+			"The link expires in %d minutes. If you did not sign up, you can ignore this e-mail.\n", req.FirstName, instructions, req.UserName, int(RegistrationTTL.Minutes())),
+	}
+}
+
+// registrationAttemptMessage builds the notice sent to a registered e-mail used for another sign-up.
+func registrationAttemptMessage(u user.User) mailer.Message {
+	return mailer.Message{
+		To:      u.Email,
+		Subject: "Sign-up attempt with your e-mail address",
+		Body: fmt.Sprintf("Hello %s,\n\nSomeone tried to sign up with your e-mail address, which already belongs to your account %s. "+
+			"If it was you, log in or reset your password instead. Otherwise, you can ignore this e-mail.\n", u.FirstName, u.UserName),
+	}
+}
+
+// sendMail sends an e-mail in the background, a failure is only logged.
+func sendMail(message mailer.Message, description string, userID int64) {
+	go func() {
+		mailCtx, cancel := context.WithTimeout(context.Background(), passwordResetMailTimeout)
+		defer cancel()
+
+		if err := mailer.Send(mailCtx, message); err != nil {
+			logger.Error(fmt.Sprintf("failed to send %s (user %d): %v", description, userID, err))
+		}
+	}()
+}
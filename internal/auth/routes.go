@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/availability"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the authentication routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Publish the public keys validating the access tokens, outside of the rate limit of the /auth group
+	rg.GET(JWKSPath, JWKSHandler)
+
+	// The back-end integrations get their tokens with the client credentials grant, they request a token
+	// whenever the previous one expires, so the endpoint has its own limits instead of the ones of the logins.
+	// - Allows a burst of up to 10 requests at once.
+	// - Allows 1 request per second continuously after the burst.
+	// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+	rg.POST("/auth/token",
+		ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 10*time.Minute),
+		deps.StatementTimeout(dbtimeout.Read, dbtimeout.Write),
+		NewAuthHandler(NewAuthService()).Token,
+	)
+
+	// The browser applications authenticated with the cookies get their CSRF token when they start,
+	// so the endpoint has its own limits as well.
+	// - Allows a burst of up to 10 requests at once.
+	// - Allows 1 request per second continuously after the burst.
+	// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+	if tokencookie.Enabled() {
+		rg.GET("/auth/csrf-token",
+			ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 10*time.Minute),
+			NewAuthHandler(NewAuthService()).CSRFToken,
+		)
+	}
+
+	// The logins with an identity provider are a redirection followed by the callback, so they have their own
+	// limits as well, the ones of the /auth group would refuse the callback.
+	// - Allows a burst of up to 10 requests at once.
+	// - Allows 1 request per second continuously after the burst.
+	// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+	oidcGroup := rg.Group("/auth/oidc")
+	{
+		oidcGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 10*time.Minute))
+		oidcGroup.Use(deps.StatementTimeout(dbtimeout.Read, dbtimeout.Write))
+
+		handler := NewAuthHandler(NewAuthService())
+		oidcGroup.GET("/:provider", handler.OIDCLogin)
+		oidcGroup.GET("/:provider/callback", handler.OIDCCallback)
+	}
+
+	// Set up the authentication routes
+	// These routes handle user login and authentication
+	authGroup := rg.Group("/auth")
+	{
+		// Apply rate limiting middleware to the /auth group (e.g., login, register endpoints).
+		// Configuration:
+		// - Allows a burst of 1 request (no burst, basically one request at a time).
+		// - After each request, only 1 new request is allowed every 30 seconds (refill rate).
+		// - Each client IP has its own limiter instance which expires after 5 minutes of inactivity.
+		authGroup.Use(ratelimiter.RateLimiter(rate.Every(30*time.Second), 1, 5*time.Minute))
+
+		// Bound the database statements of the authentication requests
+		authGroup.Use(deps.StatementTimeout(dbtimeout.Read, dbtimeout.Write))
+
+		// Routes for authentication
+		// These routes handle user login and the password reset
+		service := NewAuthService()
+		handler := NewAuthHandler(service)
+
+		// Define the routes for authentication
+		// These routes handle user login
+		authGroup.POST("/login", deps.Validate("login"), handler.Login)
+
+		// The refresh token may come in its cookie instead of the body (see pkg/tokencookie),
+		// so the body is not matched against the schema when the tokens are delivered in cookies
+		if tokencookie.Enabled() {
+			authGroup.POST("/refresh-token", handler.RefreshToken)
+		} else {
+			authGroup.POST("/refresh-token", deps.Validate("refresh-token"), handler.RefreshToken)
+		}
+
+		// The users enter their password again for the endpoints requiring a recent authentication
+		// (see authorization.RequireRecentAuth), with the access token of their session
+		authGroup.POST("/reauth", authorization.JwtValidation(), deps.Validate("reauth"), handler.Reauthenticate)
+
+		// The password reset is refused in maintenance mode, unlike the login and the token refresh,
+		// which stay available so the clients can keep reading
+		// Its tokens are stored in Redis, so it is left out when the password-reset module is disabled
+		if module.Enabled(module.PasswordReset) {
+			authGroup.POST("/forgot-password", availability.ReadOnlyMode(), deps.Validate("forgot-password"), handler.ForgotPassword)
+			authGroup.POST("/reset-password", availability.ReadOnlyMode(), deps.Validate("reset-password"), handler.ResetPassword)
+		}
+
+		// The self-registration is only exposed when SELF_REGISTRATION_ENABLED is set, the users are created by
+		// the admins otherwise. It creates users, so it is refused in maintenance mode as well
+		if RegistrationEnabled() {
+			authGroup.POST("/register", availability.ReadOnlyMode(), deps.Validate("registration"), handler.Register)
+			authGroup.POST("/register/verify", availability.ReadOnlyMode(), deps.Validate("registration-verification"), handler.VerifyRegistration)
+		}
+	}
+}
+
+// RegisterImpersonationRoutes registers the impersonation route under the API group, next to the user management routes.
+// It lives in the auth module since it issues access tokens, which the user module cannot do.
+func RegisterImpersonationRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	userGroup := rg.Group("/users")
+	{
+		// Rate limiter middleware for the impersonations, with the limits of the user management endpoints.
+		// - Allows a burst of up to 10 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		// - Limiter TTL is 15 minutes to clean up inactive IP limiters.
+		userGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 15*time.Minute))
+
+		service := NewAuthService()
+		handler := NewAuthHandler(service)
+
+		// An impersonation issues a token of another user, it is restricted to the admins
+		// and requires a fresh login from the remembered sessions
+		userGroup.POST("/:id/impersonate", authorization.RoleBasedAccessControl("ROLE_ADMIN"),
+			authorization.RequireFreshLogin(authorization.FreshLoginMaxAge()), handler.Impersonate)
+	}
+}
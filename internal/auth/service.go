@@ -2,21 +2,42 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
 	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
 	"github.com/yoanesber/Go-Department-CRUD/internal/role"
 	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/authmetrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/revocation"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util/redisutil"
-	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/go-playground/validator.v9"
 	"gorm.io/gorm"
 )
 
@@ -28,6 +49,37 @@ var (
 	JWTIssuer         string
 	JWTExpirationHour string
 	AccessTokenTTL    time.Duration
+	PasswordResetURL  string
+	PasswordResetTTL  time.Duration
+	ImpersonationTTL  time.Duration
+
+	SelfRegistrationEnabled string
+	RegistrationURL         string
+	RegistrationTTL         time.Duration
+)
+
+// Password reset tokens are stored in Redis under the SHA-256 of the token, so the keys do not reveal
+// usable tokens. The user key points to the last token of a user, which is revoked by a new request.
+const (
+	passwordResetKeyPrefix     = "password_reset:"
+	passwordResetUserKeyPrefix = "password_reset_user:"
+	defaultPasswordResetTTL    = 30 * time.Minute
+	passwordResetMailTimeout   = 30 * time.Second
+	defaultImpersonationTTL    = 15 * time.Minute
+	defaultRegistrationTTL     = 24 * time.Hour
+)
+
+// Typed errors returned by the auth service
+var (
+	ErrInvalidResetToken         = apperror.New("InvalidResetToken", http.StatusBadRequest, "the password reset token is invalid, expired or already used")
+	ErrImpersonateSelf           = apperror.New("ImpersonateSelf", http.StatusConflict, "users cannot impersonate themselves")
+	ErrImpersonationNested       = apperror.New("ImpersonationNested", http.StatusForbidden, "an impersonation token cannot be used to impersonate another user")
+	ErrImpersonationUserDisabled = apperror.New("ImpersonationUserDisabled", http.StatusConflict, "disabled or deleted users cannot be impersonated")
+	ErrInvalidRegistrationToken  = apperror.New("InvalidRegistrationToken", http.StatusBadRequest, "the registration token is invalid, expired or already used")
+	ErrUnsupportedGrantType      = apperror.New("UnsupportedGrantType", http.StatusBadRequest, "only the client_credentials grant type is supported")
+	ErrInvalidScope              = apperror.New("InvalidScope", http.StatusBadRequest, "the requested scope is not allowed for the client")
+	ErrReauthNotAllowed          = apperror.New("ReauthNotAllowed", http.StatusForbidden, "only the access tokens of a login session can be re-authenticated")
+	ErrReauthFailed              = apperror.New("ReauthFailed", http.StatusUnauthorized, "the password is invalid")
 )
 
 // LoadEnv loads environment variables
@@ -42,6 +94,27 @@ func LoadEnv() {
 	// Load access and refresh token TTL from environment variables
 	access, _ := strconv.Atoi(os.Getenv("ACCESS_TOKEN_TTL_MINUTES"))
 	AccessTokenTTL = time.Duration(access) * time.Minute
+
+	// Load the password reset link and the validity of the reset tokens
+	PasswordResetURL = os.Getenv("PASSWORD_RESET_URL")
+	PasswordResetTTL = defaultPasswordResetTTL
+	if minutes, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_TTL_MINUTES")); err == nil && minutes > 0 {
+		PasswordResetTTL = time.Duration(minutes) * time.Minute
+	}
+
+	// Load the validity of the impersonation tokens, kept short since they act on behalf of another user
+	ImpersonationTTL = defaultImpersonationTTL
+	if minutes, err := strconv.Atoi(os.Getenv("IMPERSONATION_TTL_MINUTES")); err == nil && minutes > 0 {
+		ImpersonationTTL = time.Duration(minutes) * time.Minute
+	}
+
+	// Load the self-registration switch, the verification link and the validity of the registration tokens
+	SelfRegistrationEnabled = os.Getenv("SELF_REGISTRATION_ENABLED")
+	RegistrationURL = os.Getenv("REGISTRATION_VERIFY_URL")
+	RegistrationTTL = defaultRegistrationTTL
+	if minutes, err := strconv.Atoi(os.Getenv("REGISTRATION_TTL_MINUTES")); err == nil && minutes > 0 {
+		RegistrationTTL = time.Duration(minutes) * time.Minute
+	}
 }
 
 // Interface for auth service
@@ -49,21 +122,93 @@ func LoadEnv() {
 type AuthService interface {
 	Login(ctx context.Context, loginReq LoginRequest) (LoginResponse, error)
 	RefreshToken(ctx context.Context, refreshTokenReq refreshtoken.RefreshTokenRequest) (refreshtoken.RefreshTokenResponse, error)
+	ForgotPassword(ctx context.Context, req ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req ResetPasswordRequest) error
+	Impersonate(ctx context.Context, userID int64) (ImpersonationResponse, error)
+	Register(ctx context.Context, req RegistrationRequest) error
+	VerifyRegistration(ctx context.Context, req VerifyRegistrationRequest) (user.User, error)
+	IssueClientToken(ctx context.Context, req ClientCredentialsRequest) (ClientTokenResponse, error)
+	OIDCAuthorizationURL(ctx context.Context, provider string) (string, error)
+	OIDCCallback(ctx context.Context, req OIDCCallbackRequest) (LoginResponse, error)
+	Reauthenticate(ctx context.Context, req ReauthRequest) (LoginResponse, error)
 }
 
-// This struct defines the AuthService that contains a user repository and a role repository
+// This struct defines the AuthService that contains the clock, the lifetime of the access tokens,
+// the bus the audit events are written to, the user service of the self-registrations
+// and the client service of the client credentials grant
 // It implements the AuthService interface and provides methods for authentication-related operations
-type authService struct{}
+type authService struct {
+	clock    clock.Clock
+	tokenTTL time.Duration
+	events   outbox.Bus
+	users    user.UserService
+	clients  oauthclient.ClientService
+}
+
+// Option configures an auth service.
+type Option func(*authService)
+
+// WithClock sets the clock used to issue the tokens and compute their expiration.
+// It is passed on to the refresh token service.
+func WithClock(c clock.Clock) Option {
+	return func(s *authService) {
+		s.clock = c
+	}
+}
+
+// WithTokenTTL sets the validity of the access tokens, instead of JWT_EXPIRATION_HOUR.
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *authService) {
+		s.tokenTTL = ttl
+	}
+}
+
+// WithEventBus sets the bus the audit events (e.g. user.impersonated) are written to.
+func WithEventBus(bus outbox.Bus) Option {
+	return func(s *authService) {
+		s.events = bus
+	}
+}
+
+// WithUserService sets the user service the self-registrations are checked and created with.
+func WithUserService(users user.UserService) Option {
+	return func(s *authService) {
+		s.users = users
+	}
+}
 
-// NewAuthService creates a new instance of AuthService with the given user and role repositories.
-// It initializes the authService struct and returns it.
-func NewAuthService() AuthService {
-	return &authService{}
+// WithClientService sets the client service the clients requesting a token are authenticated with.
+func WithClientService(clients oauthclient.ClientService) Option {
+	return func(s *authService) {
+		s.clients = clients
+	}
+}
+
+// NewAuthService creates a new instance of AuthService.
+// It initializes the authService struct, applies the options and returns it.
+func NewAuthService(opts ...Option) AuthService {
+	s := &authService{clock: clock.System, events: outbox.DefaultBus}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // Login authenticates a user with the given username and password.
 // It retrieves the token for the user if the authentication is successful.
+// Every attempt is recorded in the login audit, successful or not.
 func (s *authService) Login(ctx context.Context, loginReq LoginRequest) (LoginResponse, error) {
+	attempt := user.NewLoginAttempt(ctx, user.LoginMethodPassword, loginReq.UserName, loginReq.Client.IPAddress, loginReq.Client.Device)
+	loginResp, err := s.login(ctx, loginReq, &attempt)
+	s.recordLoginAttempt(ctx, attempt, err)
+
+	return loginResp, err
+}
+
+// login authenticates a user with the given username and password, the user is set in the attempt once found.
+// The usernames failing too often are locked for a while, whatever the address of the attempts (see pkg/loginthrottle).
+func (s *authService) login(ctx context.Context, loginReq LoginRequest, attempt *user.LoginAttempt) (LoginResponse, error) {
 	// Load environment variables
 	LoadEnv()
 
@@ -79,121 +224,330 @@ func (s *authService) Login(ctx context.Context, loginReq LoginRequest) (LoginRe
 		return LoginResponse{}, err
 	}
 
-	var tokenStr string
-	var refreshTokenStr string
-	var expirationDateStr string
+	// Refuse the automated logins before the user is looked up
+	if err := captcha.CheckEndpoint(ctx, captcha.Login, loginReq.CaptchaToken, loginReq.Client.IPAddress); err != nil {
+		return LoginResponse{}, err
+	}
+
+	// Refuse the attempts on a username locked after too many failed logins
+	// The throttle connects Redis (see pkg/app), a Redis failure does not block the logins
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient != nil && loginthrottle.Enabled() {
+		wait, err := loginthrottle.Check(ctx, redisClient, loginReq.UserName)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("login throttle is unavailable, allowing the login: %v", err))
+		}
+		if wait > 0 {
+			return LoginResponse{}, &loginthrottle.ThrottledError{RetryAfter: wait}
+		}
+	}
+
+	var loginResp LoginResponse
+	var userID int64
+	var passwordHash string
+	var rehash bool
+	var credentialsRefused bool
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Check if the user exists
 		userRepo := user.NewUserRepository()
 		userService := user.NewUserService(userRepo)
 		existingUser, err := userService.GetUserByUserName(ctx, loginReq.UserName)
 		if err != nil {
+			credentialsRefused = errors.Is(err, user.ErrUserNameNotFound)
 			return err
 		}
+		attempt.UserID = &existingUser.ID
 
 		// Check some conditions for the user
-		if existingUser.Equals(&user.User{}) {
-			return errors.New("user not found")
-		}
-		if !*existingUser.IsEnabled {
-			return errors.New("user is not enabled")
-		}
-		if !*existingUser.IsAccountNonExpired {
-			return errors.New("user account is expired")
-		}
-		if !*existingUser.IsAccountNonLocked {
-			return errors.New("user account is locked")
-		}
-		if !*existingUser.IsCredentialsNonExpired {
-			return errors.New("user credentials are expired")
-		}
-		if *existingUser.IsDeleted {
-			return errors.New("user account is deleted")
+		if err := checkAccount(existingUser); err != nil {
+			return err
 		}
 
 		// Compare the provided password with the stored hashed password
-		if err := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(loginReq.Password)); err != nil {
+		rehash, err = user.VerifyPassword(existingUser.Password, loginReq.Password)
+		if err != nil {
+			credentialsRefused = true
 			return errors.New("invalid password")
 		}
+		userID, passwordHash = existingUser.ID, existingUser.Password
 
-		// Generate an access token for the user
-		tokenStr, err = GenerateJWTToken(existingUser)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to generate JWT token: %v", err))
-			return err
-		}
+		// Start a new session for the user on the client, the other sessions of the user are kept
+		loginResp, err = s.startSession(ctx, existingUser, loginReq.Client, loginReq.RememberMe)
+		return err
+	})
 
-		// Parse the JWT token
-		jwtToken, err := ParseJWTToken(tokenStr)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to parse JWT token: %v", err))
-			return err
+	if err != nil {
+		if credentialsRefused && redisClient != nil && loginthrottle.Enabled() {
+			s.throttleFailedLogin(ctx, redisClient, loginReq.UserName)
 		}
+		return LoginResponse{}, err
+	}
 
-		// Get the expiration date from the token
-		expirationDateStr, err = GetExpirationDateFromToken(jwtToken)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to get expiration date from token: %v", err))
-			return err
+	// Clear the failed logins of the username
+	if redisClient != nil && loginthrottle.Enabled() {
+		if err := loginthrottle.Reset(ctx, redisClient, loginReq.UserName); err != nil {
+			logger.Warn(fmt.Sprintf("failed to clear the failed logins of %s: %v", loginReq.UserName, err))
 		}
+	}
 
-		// Generate a refresh token for the user
-		refreshTokenRepo := refreshtoken.NewRefreshTokenRepository()
-		refreshTokenService := refreshtoken.NewRefreshTokenService(refreshTokenRepo)
-		jwtRefreshToken, err := refreshTokenService.CreateRefreshToken(ctx, existingUser.ID)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to create refresh token: %v", err))
-			return err
-		}
-		if jwtRefreshToken.Equals(&refreshtoken.RefreshToken{}) {
-			return errors.New("failed to create refresh token")
-		}
+	// Migrate the password hashed with an outdated algorithm or cost, now that the plain-text password is known
+	if rehash {
+		upgradePasswordHash(ctx, db, userID, passwordHash, loginReq.Password)
+	}
 
-		refreshTokenStr = jwtRefreshToken.Token
+	return loginResp, nil
+}
 
-		// Update the last login time for the user
-		_, err = userService.UpdateLastLogin(ctx, existingUser.ID, time.Now())
+// Reauthenticate checks the password of the user of the access token again, for the endpoints requiring a recent
+// authentication (see authorization.RequireRecentAuth). The session of the token records the new authentication time,
+// and a new access token carrying it is returned, the refresh token of the session is unchanged.
+// Only the access tokens of a login session can be re-authenticated, the impersonations, the clients and the
+// API keys have no password to enter. The wrong passwords are throttled like the failed logins.
+func (s *authService) Reauthenticate(ctx context.Context, req ReauthRequest) (LoginResponse, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return LoginResponse{}, errors.New("database connection is nil")
+	}
+
+	// Validate the re-authentication request
+	if err := req.Validate(); err != nil {
+		return LoginResponse{}, err
+	}
+
+	// Extract the user metadata of the access token from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return LoginResponse{}, errors.New("missing user context")
+	}
+	if meta.SessionID == "" || meta.ImpersonatedBy != 0 || meta.Automation {
+		return LoginResponse{}, ErrReauthNotAllowed
+	}
+
+	// Refuse the attempts on a username locked after too many wrong passwords
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient != nil && loginthrottle.Enabled() {
+		wait, err := loginthrottle.Check(ctx, redisClient, meta.UserName)
 		if err != nil {
-			logger.Error(fmt.Sprintf("failed to update last login time: %v", err))
-			return err
+			logger.Warn(fmt.Sprintf("login throttle is unavailable, allowing the re-authentication: %v", err))
+		}
+		if wait > 0 {
+			return LoginResponse{}, &loginthrottle.ThrottledError{RetryAfter: wait}
 		}
+	}
 
-		// Store the access token details in Redis
-		redisClient := dbcontext.GetRedisClient(ctx)
-		if redisClient == nil {
-			logger.Error("redis client is nil")
-			return errors.New("redis client is nil")
-		}
-		redisKey := fmt.Sprintf("access_token:%s", existingUser.UserName)
-		err = redisutil.SetJSON(ctx, redisClient, redisKey, LoginResponse{
-			AccessToken:    tokenStr,
-			RefreshToken:   refreshTokenStr,
-			ExpirationDate: expirationDateStr,
-			TokenType:      TokenType,
-		}, AccessTokenTTL)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to set access token in Redis: %v", err))
-			return err
+	// Check the password of the user, who may have been disabled since the login
+	userService := user.NewUserService(user.NewUserRepository())
+	existingUser, err := userService.GetUserByID(ctx, meta.UserID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if err := checkAccount(existingUser); err != nil {
+		return LoginResponse{}, err
+	}
+	if _, err := user.VerifyPassword(existingUser.Password, req.Password); err != nil {
+		if redisClient != nil && loginthrottle.Enabled() {
+			s.throttleFailedLogin(ctx, redisClient, meta.UserName)
 		}
+		return LoginResponse{}, ErrReauthFailed
+	}
 
-		return nil
-	})
+	// Record the authentication in the session
+	refreshTokenService := refreshtoken.NewRefreshTokenService(refreshtoken.NewRefreshTokenRepository(), refreshtoken.WithClock(s.clock))
+	session, err := refreshTokenService.Reauthenticate(ctx, existingUser.ID, meta.SessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return LoginResponse{}, errors.New("session not found")
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to record the re-authentication: %v", err))
+		return LoginResponse{}, err
+	}
 
+	// Generate an access token of the session carrying the new authentication time
+	tokenStr, err := s.generateJWTToken(existingUser, session)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to generate JWT token: %v", err))
+		return LoginResponse{}, err
+	}
+	jwtToken, err := ParseJWTToken(tokenStr, jwt.WithTimeFunc(s.clock.Now))
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to parse JWT token: %v", err))
+		return LoginResponse{}, err
+	}
+	expirationDateStr, err := GetExpirationDateFromToken(jwtToken)
 	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get expiration date from token: %v", err))
 		return LoginResponse{}, err
 	}
 
+	// Clear the failed logins of the username
+	if redisClient != nil && loginthrottle.Enabled() {
+		if err := loginthrottle.Reset(ctx, redisClient, meta.UserName); err != nil {
+			logger.Warn(fmt.Sprintf("failed to clear the failed logins of %s: %v", meta.UserName, err))
+		}
+	}
+
 	return LoginResponse{
 		AccessToken:    tokenStr,
-		RefreshToken:   refreshTokenStr,
 		ExpirationDate: expirationDateStr,
 		TokenType:      TokenType,
 	}, nil
 }
 
+// throttleFailedLogin records a failed login on the username, which is locked once it failed too often.
+// The login has failed already, so a failure of Redis is only logged.
+func (s *authService) throttleFailedLogin(ctx context.Context, redisClient *redis.Client, userName string) {
+	delay, err := loginthrottle.RecordFailure(ctx, redisClient, userName, s.clock.Now())
+	if err != nil {
+		logger.Warn(fmt.Sprintf("failed to record the failed login of %s: %v", userName, err))
+		return
+	}
+	if delay > 0 {
+		logger.Warn(fmt.Sprintf("username %s is locked for %s after too many failed logins", userName, delay))
+	}
+}
+
+// upgradePasswordHash replaces the password hash of a user with a hash of the configured algorithm and cost.
+// The login has succeeded already, so a failure is only logged and the migration is retried on the next login.
+func upgradePasswordHash(ctx context.Context, db *gorm.DB, userID int64, oldHash string, password string) {
+	newHash, err := user.HashPassword(password)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("failed to rehash the password of user %d: %v", userID, err))
+		return
+	}
+
+	upgraded, err := user.NewUserRepository().UpgradePasswordHash(ctx, db, userID, oldHash, newHash)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("failed to upgrade the password hash of user %d: %v", userID, err))
+		return
+	}
+	if upgraded {
+		logger.Info(fmt.Sprintf("password hash of user %d upgraded", userID))
+	}
+}
+
+// recordLoginAttempt records the outcome of a login attempt in the login audit and counts it in the metrics.
+// The login is not refused when the attempt cannot be recorded, the failure is only logged by the user service.
+func (s *authService) recordLoginAttempt(ctx context.Context, attempt user.LoginAttempt, err error) {
+	authmetrics.ObserveLogin(attempt.Method, failureReason(err))
+
+	attempt.Success = err == nil
+	if err != nil {
+		// The validation errors list every field, the reason only tells that the request was invalid
+		reason := err.Error()
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			reason = "invalid request"
+		}
+		attempt.Fail(reason)
+	}
+
+	_ = s.userService().RecordLoginAttempt(ctx, attempt)
+}
+
+// checkAccount refuses the users whose account does not allow them to log in.
+func checkAccount(existingUser user.User) error {
+	if existingUser.Equals(&user.User{}) {
+		return errors.New("user not found")
+	}
+	if !*existingUser.IsEnabled {
+		return errors.New("user is not enabled")
+	}
+	if !*existingUser.IsAccountNonExpired {
+		return errors.New("user account is expired")
+	}
+	if !*existingUser.IsAccountNonLocked {
+		return errors.New("user account is locked")
+	}
+	if !*existingUser.IsCredentialsNonExpired {
+		return errors.New("user credentials are expired")
+	}
+	if *existingUser.IsDeleted {
+		return errors.New("user account is deleted")
+	}
+
+	return nil
+}
+
+// startSession starts a new session of the user on the client: it creates the refresh token of the session,
+// generates its access token, records the login and caches the token details.
+// A remembered session gets a longer-lived refresh token, its access tokens keep the usual lifetime.
+func (s *authService) startSession(ctx context.Context, existingUser user.User, client refreshtoken.Client, rememberMe bool) (LoginResponse, error) {
+	refreshTokenRepo := refreshtoken.NewRefreshTokenRepository()
+	refreshTokenService := refreshtoken.NewRefreshTokenService(refreshTokenRepo, refreshtoken.WithClock(s.clock))
+	jwtRefreshToken, err := refreshTokenService.CreateRefreshToken(ctx, existingUser.ID, client, rememberMe)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to create refresh token: %v", err))
+		return LoginResponse{}, err
+	}
+	if jwtRefreshToken.Equals(&refreshtoken.RefreshToken{}) {
+		return LoginResponse{}, errors.New("failed to create refresh token")
+	}
+
+	// Generate an access token for the session
+	tokenStr, err := s.generateJWTToken(existingUser, jwtRefreshToken)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to generate JWT token: %v", err))
+		return LoginResponse{}, err
+	}
+
+	// Parse the JWT token
+	jwtToken, err := ParseJWTToken(tokenStr, jwt.WithTimeFunc(s.clock.Now))
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to parse JWT token: %v", err))
+		return LoginResponse{}, err
+	}
+
+	// Get the expiration date from the token
+	expirationDateStr, err := GetExpirationDateFromToken(jwtToken)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get expiration date from token: %v", err))
+		return LoginResponse{}, err
+	}
+
+	// Update the last login time for the user
+	userService := user.NewUserService(user.NewUserRepository())
+	_, err = userService.UpdateLastLogin(ctx, existingUser.ID, s.clock.Now())
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to update last login time: %v", err))
+		return LoginResponse{}, err
+	}
+
+	loginResp := LoginResponse{
+		AccessToken:      tokenStr,
+		RefreshToken:     jwtRefreshToken.Token,
+		ExpirationDate:   expirationDateStr,
+		TokenType:        TokenType,
+		RefreshExpiresAt: jwtRefreshToken.ExpiryDate,
+	}
+
+	// Store the access token details in Redis
+	// A deployment running without Redis (see pkg/module) does not cache them
+	if redisClient := dbcontext.GetRedisClient(ctx); redisClient != nil {
+		redisKey := revocation.AccessTokenKey(existingUser.UserName)
+		err = redisutil.SetJSON(ctx, redisClient, redisKey, loginResp, AccessTokenTTL)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to set access token in Redis: %v", err))
+			return LoginResponse{}, err
+		}
+	}
+
+	return loginResp, nil
+}
+
 // RefreshToken refreshes the access token using the provided refresh token.
 // It retrieves the new access token and refresh token for the user.
+// Every refresh is counted in the metrics, successful or not.
 func (s *authService) RefreshToken(ctx context.Context, refreshTokenReq refreshtoken.RefreshTokenRequest) (refreshtoken.RefreshTokenResponse, error) {
+	resp, err := s.refreshToken(ctx, refreshTokenReq)
+	authmetrics.ObserveRefresh(failureReason(err))
+
+	return resp, err
+}
+
+// refreshToken rotates the refresh token of the session and generates its new access token.
+func (s *authService) refreshToken(ctx context.Context, refreshTokenReq refreshtoken.RefreshTokenRequest) (refreshtoken.RefreshTokenResponse, error) {
 	// Load environment variables
 	LoadEnv()
 
@@ -212,10 +566,11 @@ func (s *authService) RefreshToken(ctx context.Context, refreshTokenReq refresht
 	var accessTokenStr string
 	var refreshTokenStr string
 	var expirationDateStr string
+	var refreshExpiresAt time.Time
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Check if the refresh token exists
 		refreshTokenRepo := refreshtoken.NewRefreshTokenRepository()
-		refreshTokenService := refreshtoken.NewRefreshTokenService(refreshTokenRepo)
+		refreshTokenService := refreshtoken.NewRefreshTokenService(refreshTokenRepo, refreshtoken.WithClock(s.clock))
 		existingRefreshToken, err := refreshTokenService.GetRefreshTokenByToken(ctx, refreshTokenReq.RefreshToken)
 		if err != nil {
 			logger.Error(fmt.Sprintf("failed to get refresh token: %v", err))
@@ -242,16 +597,32 @@ func (s *authService) RefreshToken(ctx context.Context, refreshTokenReq refresht
 		if userDetails.Equals(&user.User{}) {
 			return errors.New("user not found")
 		}
+		if userDetails.IsEnabled == nil || !*userDetails.IsEnabled {
+			return errors.New("user is not enabled")
+		}
+
+		// Rotate the refresh token of the session, a token is only used once
+		jwtRefreshToken, err := refreshTokenService.RotateRefreshToken(ctx, existingRefreshToken, refreshTokenReq.Client)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("refresh token not found")
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to rotate refresh token: %v", err))
+			return err
+		}
+
+		refreshTokenStr = jwtRefreshToken.Token
+		refreshExpiresAt = jwtRefreshToken.ExpiryDate
 
-		// Generate an access token for the user
-		accessTokenStr, err = GenerateJWTToken(userDetails)
+		// Generate an access token for the session
+		accessTokenStr, err = s.generateJWTToken(userDetails, jwtRefreshToken)
 		if err != nil {
 			logger.Error(fmt.Sprintf("failed to generate JWT token: %v", err))
 			return err
 		}
 
 		// Parse the JWT token
-		jwtToken, err := ParseJWTToken(accessTokenStr)
+		jwtToken, err := ParseJWTToken(accessTokenStr, jwt.WithTimeFunc(s.clock.Now))
 		if err != nil {
 			logger.Error(fmt.Sprintf("failed to parse JWT token: %v", err))
 			return err
@@ -264,42 +635,27 @@ func (s *authService) RefreshToken(ctx context.Context, refreshTokenReq refresht
 			return err
 		}
 
-		// Regenerate a refresh token for the user
-		jwtRefreshToken, err := refreshTokenService.CreateRefreshToken(ctx, userDetails.ID)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to create refresh token: %v", err))
-			return err
-		}
-		if jwtRefreshToken.Equals(&refreshtoken.RefreshToken{}) {
-			return errors.New("failed to create refresh token")
-		}
-
-		refreshTokenStr = jwtRefreshToken.Token
-
 		// Update the last login time for the user
-		_, err = userService.UpdateLastLogin(ctx, userDetails.ID, time.Now())
+		_, err = userService.UpdateLastLogin(ctx, userDetails.ID, s.clock.Now())
 		if err != nil {
 			logger.Error(fmt.Sprintf("failed to update last login time: %v", err))
 			return err
 		}
 
 		// Store the access token details in Redis
-		redisClient := dbcontext.GetRedisClient(ctx)
-		if redisClient == nil {
-			logger.Error("redis client is nil")
-			return errors.New("redis client is nil")
-		}
-		redisKey := fmt.Sprintf("access_token:%s", userDetails.UserName)
-		err = redisutil.SetJSON(ctx, redisClient, redisKey, refreshtoken.RefreshTokenResponse{
-			AccessToken:    accessTokenStr,
-			RefreshToken:   refreshTokenStr,
-			ExpirationDate: expirationDateStr,
-			TokenType:      TokenType,
-		}, AccessTokenTTL)
-
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to set access token in Redis: %v", err))
-			return err
+		// A deployment running without Redis (see pkg/module) does not cache them
+		if redisClient := dbcontext.GetRedisClient(ctx); redisClient != nil {
+			redisKey := revocation.AccessTokenKey(userDetails.UserName)
+			err = redisutil.SetJSON(ctx, redisClient, redisKey, refreshtoken.RefreshTokenResponse{
+				AccessToken:    accessTokenStr,
+				RefreshToken:   refreshTokenStr,
+				ExpirationDate: expirationDateStr,
+				TokenType:      TokenType,
+			}, AccessTokenTTL)
+			if err != nil {
+				logger.Error(fmt.Sprintf("failed to set access token in Redis: %v", err))
+				return err
+			}
 		}
 
 		return nil
@@ -310,13 +666,285 @@ func (s *authService) RefreshToken(ctx context.Context, refreshTokenReq refresht
 	}
 
 	return refreshtoken.RefreshTokenResponse{
-		AccessToken:    accessTokenStr,
-		RefreshToken:   refreshTokenStr,
-		ExpirationDate: expirationDateStr,
+		AccessToken:      accessTokenStr,
+		RefreshToken:     refreshTokenStr,
+		ExpirationDate:   expirationDateStr,
+		TokenType:        TokenType,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// ForgotPassword e-mails a single-use password reset token to the user with the given e-mail.
+// It succeeds whether or not the e-mail belongs to an enabled user, so the response does not reveal
+// the registered e-mails. A new request revokes the previous token of the user.
+func (s *authService) ForgotPassword(ctx context.Context, req ForgotPasswordRequest) error {
+	// Load environment variables
+	LoadEnv()
+
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// Refuse the automated requests before anything is looked up
+	if err := captcha.CheckEndpoint(ctx, captcha.ForgotPassword, req.CaptchaToken, req.RemoteIP); err != nil {
+		return err
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return errors.New("redis client is nil")
+	}
+
+	// Get the user by e-mail, the unknown and disabled users are silently ignored
+	userService := user.NewUserService(user.NewUserRepository())
+	existingUser, err := userService.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		return nil
+	}
+	if existingUser.IsEnabled == nil || !*existingUser.IsEnabled {
+		logger.Warn(fmt.Sprintf("password reset requested for disabled user %d", existingUser.ID))
+		return nil
+	}
+
+	// Generate the token, only its hash is stored
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	tokenKey := passwordResetKeyPrefix + hashToken(token)
+	userKey := passwordResetUserKeyPrefix + strconv.FormatInt(existingUser.ID, 10)
+
+	// Revoke the previous token of the user and store the new one
+	if previous, err := redisClient.Get(ctx, userKey).Result(); err == nil {
+		redisClient.Del(ctx, passwordResetKeyPrefix+previous)
+	}
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, tokenKey, existingUser.ID, PasswordResetTTL)
+		pipe.Set(ctx, userKey, hashToken(token), PasswordResetTTL)
+		return nil
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to store password reset token: %v", err))
+		return err
+	}
+
+	// Send the e-mail in the background, so the response time does not reveal the registered e-mails
+	message := resetPasswordMessage(existingUser, token)
+	go func() {
+		mailCtx, cancel := context.WithTimeout(context.Background(), passwordResetMailTimeout)
+		defer cancel()
+
+		if err := mailer.Send(mailCtx, message); err != nil {
+			logger.Error(fmt.Sprintf("failed to send password reset e-mail to user %d: %v", existingUser.ID, err))
+		}
+	}()
+
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token, without being logged in.
+// The token is consumed atomically, so it can only be used once.
+func (s *authService) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return errors.New("redis client is nil")
+	}
+
+	// Look the token up without consuming it, so a password refused by the policy does not burn it
+	tokenKey := passwordResetKeyPrefix + hashToken(req.Token)
+	userIDStr, err := redisClient.Get(ctx, tokenKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to read password reset token: %v", err))
+		return err
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	userService := user.NewUserService(user.NewUserRepository())
+	if err := userService.ValidatePassword(ctx, userID, req.NewPassword); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	// Consume the token, it may have been used concurrently since it was looked up
+	if _, err := redisClient.GetDel(ctx, tokenKey).Result(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrInvalidResetToken
+		}
+		logger.Error(fmt.Sprintf("failed to consume password reset token: %v", err))
+		return err
+	}
+	redisClient.Del(ctx, passwordResetUserKeyPrefix+userIDStr)
+
+	// Set the new password
+	if err := userService.ResetPassword(ctx, userID, req.NewPassword); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Impersonate issues a short-lived access token for the user with the given ID on behalf of the admin
+// of the request, so the support staff can reproduce the issues of a user.
+// The token carries the impersonated_by claim with the ID of the admin and no session, it cannot be refreshed.
+// Every impersonation is recorded as a user.impersonated event.
+func (s *authService) Impersonate(ctx context.Context, userID int64) (ImpersonationResponse, error) {
+	// Load environment variables
+	LoadEnv()
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return ImpersonationResponse{}, errors.New("database connection is nil")
+	}
+
+	// Extract the admin metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return ImpersonationResponse{}, errors.New("missing user context")
+	}
+	if meta.ImpersonatedBy != 0 {
+		return ImpersonationResponse{}, ErrImpersonationNested
+	}
+	if meta.UserID == userID {
+		return ImpersonationResponse{}, ErrImpersonateSelf
+	}
+
+	// Get the user to impersonate, the disabled and deleted users cannot log in and are not impersonated either
+	userService := user.NewUserService(user.NewUserRepository())
+	target, err := userService.GetUserByID(ctx, userID)
+	if err != nil {
+		return ImpersonationResponse{}, err
+	}
+	if target.IsEnabled == nil || !*target.IsEnabled || (target.IsDeleted != nil && *target.IsDeleted) {
+		return ImpersonationResponse{}, ErrImpersonationUserDisabled
+	}
+
+	// Generate the access token of the impersonation
+	now := s.clock.Now()
+	expiresAt := now.Add(ImpersonationTTL)
+	claims := NewJWTClaims(target, now.Unix(), expiresAt.Unix())
+	claims["impersonated_by"] = meta.UserID
+	tokenStr, err := signJWTToken(claims)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to generate JWT token: %v", err))
+		return ImpersonationResponse{}, err
+	}
+
+	// Record the impersonation in the audit trail before handing the token out
+	impersonation := Impersonation{
+		UserID:         target.ID,
+		UserName:       target.UserName,
+		ImpersonatedBy: meta.UserID,
+		AdminUserName:  meta.UserName,
+		ExpiresAt:      expiresAt.UTC(),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		changes := user.AuditChanges{"expiresAt": {After: impersonation.ExpiresAt}}
+		entry := user.NewAuditEntry(ctx, target.ID, user.AuditImpersonated, changes)
+		if err := user.NewUserRepository().AddAuditEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+
+		return s.events.Add(ctx, tx, event.NewEvent(event.UserImpersonated, strconv.FormatInt(target.ID, 10), impersonation))
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to record the impersonation of user %d: %v", target.ID, err))
+		return ImpersonationResponse{}, err
+	}
+	outbox.Notify()
+
+	logger.Warn(fmt.Sprintf("user %s impersonated by %s until %s", target.UserName, meta.UserName, expiresAt.UTC().Format(time.RFC3339)))
+
+	return ImpersonationResponse{
+		AccessToken:    tokenStr,
+		ExpirationDate: expiresAt.Format(time.RFC3339),
 		TokenType:      TokenType,
+		ImpersonatedBy: meta.UserID,
 	}, nil
 }
 
+// generateToken generates a random single-use token (256 bits, URL-safe), e.g. a password reset token.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex-encoded SHA-256 of a single-use token, the form in which it is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// resetPasswordMessage builds the password reset e-mail.
+// The token is added to PASSWORD_RESET_URL when set, otherwise it is given as is.
+func resetPasswordMessage(u user.User, token string) mailer.Message {
+	instructions := "Use the following token to reset your password: " + token
+	if link, err := url.Parse(PasswordResetURL); PasswordResetURL != "" && err == nil {
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		instructions = "Open the following link to reset your password: " + link.String()
+	}
+
+	return mailer.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\n%s\n\nThe link expires in %d minutes and can only be used once. "+
+			"If you did not request a password reset, you can ignore this e-mail.\n", u.FirstName, instructions, int(PasswordResetTTL.Minutes())),
+	}
+}
+
+// generateJWTToken generates an access token for the session of the user, issued at the time of the service clock.
+// The TTL given with WithTokenTTL takes precedence over JWT_EXPIRATION_HOUR.
+// The sid claim carries the session ID, so the token is rejected once its session is revoked.
+// The auth_time claim is the time of the login that started the session, or of its last re-authentication,
+// kept through the refreshes,
+// and the tokens of a remembered session carry the remember_me claim, so the sensitive endpoints can
+// require a fresh login from them (see authorization.RequireFreshLogin).
+func (s *authService) generateJWTToken(user user.User, session refreshtoken.RefreshToken) (string, error) {
+	// Load environment variables
+	LoadEnv()
+
+	now := s.clock.Now().Unix()
+	exp := GetJWTExpiration(now)
+	if s.tokenTTL > 0 {
+		exp = now + int64(s.tokenTTL/time.Second)
+	}
+
+	claims := NewJWTClaims(user, now, exp)
+	claims["sid"] = session.ID
+	claims["auth_time"] = session.AuthenticatedAt().Unix()
+	if session.RememberMe {
+		claims["remember_me"] = true
+	}
+
+	return signJWTToken(claims)
+}
+
 // GenerateJWTToken determines the function to use for generating a JWT token based on the signing method.
 // It checks the signing method from the environment variable and calls the appropriate function.
 func GenerateJWTToken(user user.User) (string, error) {
@@ -326,8 +954,8 @@ func GenerateJWTToken(user user.User) (string, error) {
 	// Check the signing method from the environment variable
 	if SigningMethod == jwt.SigningMethodHS256.Alg() {
 		return GenerateJWTTokenWithHS256(user)
-	} else if SigningMethod == jwt.SigningMethodRS256.Alg() {
-		return GenerateJWTTokenWithRS256(user)
+	} else if isKeyPairMethod(SigningMethod) {
+		return GenerateJWTTokenWithKey(user)
 	}
 
 	return "", errors.New("unsupported signing method")
@@ -343,68 +971,103 @@ func GenerateJWTTokenWithHS256(user user.User) (string, error) {
 	// This is used to set the issued at (iat) and expiration (exp) claims
 	now := time.Now().Unix()
 
-	// Create the claims for the JWT token
-	claims := jwt.MapClaims{
-		"sub":      user.UserName,
-		"aud":      JWTAudience,
-		"iss":      JWTIssuer,
-		"iat":      now,
-		"exp":      GetJWTExpiration(now),
-		"email":    user.Email,
-		"userid":   user.ID,
-		"username": user.UserName,
-		"roles":    ExtractRoleNames(user.Roles),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, NewJWTClaims(user, now, GetJWTExpiration(now)))
 	return token.SignedString([]byte(JWTSecret))
 }
 
-// GenerateJWTTokenWithRS256 generates a JWT token using the RS256 signing method.
+// GenerateJWTTokenWithKey generates a JWT token using the RS256, ES256 or EdDSA signing method.
 // It creates the claims for the token and signs it with the private key loaded from the file.
-func GenerateJWTTokenWithRS256(user user.User) (string, error) {
+func GenerateJWTTokenWithKey(user user.User) (string, error) {
 	// Load environment variables
 	LoadEnv()
 
+	// Set the now time
+	// This is used to set the issued at (iat) and expiration (exp) claims
+	now := time.Now().Unix()
+
+	return signJWTTokenWithKey(NewJWTClaims(user, now, GetJWTExpiration(now)))
+}
+
+// NewJWTClaims creates the claims of an access token for the user, issued at and expiring at the given Unix times.
+// Every token gets a unique ID in the jti claim, so it can be revoked on its own.
+// The permissions claim lists the permissions granted by the roles of the user (see pkg/permission).
+func NewJWTClaims(user user.User, iat int64, exp int64) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub":          user.UserName,
+		"aud":          JWTAudience,
+		"iss":          JWTIssuer,
+		"iat":          iat,
+		"exp":          exp,
+		"jti":          uuid.NewString(),
+		"email":        user.Email,
+		"userid":       user.ID,
+		"username":     user.UserName,
+		"roles":        ExtractRoleNames(user.Roles),
+		"permissions":  permission.For(ExtractRoleNames(user.Roles)),
+		"tokenversion": tokenversion.Current(),
+	}
+
+	// The service accounts only write the departments of their scope, the claim is absent for the other users
+	// The scope is never null in the claim, an empty scope grants no department
+	if user.IsServiceAccount() {
+		claims["departments"] = append([]string{}, user.DepartmentScope...)
+	}
+
+	return claims
+}
+
+// keyPairMethods are the signing methods of the tokens signed with a private key and validated with its public key.
+var keyPairMethods = map[string]jwt.SigningMethod{
+	jwt.SigningMethodRS256.Alg(): jwt.SigningMethodRS256,
+	jwt.SigningMethodES256.Alg(): jwt.SigningMethodES256,
+	jwt.SigningMethodEdDSA.Alg(): jwt.SigningMethodEdDSA,
+}
+
+// isKeyPairMethod checks if the signing method signs with a key pair: RS256, ES256 or EdDSA.
+func isKeyPairMethod(alg string) bool {
+	_, ok := keyPairMethods[alg]
+	return ok
+}
+
+// signJWTToken signs the claims with the signing method from the environment variable.
+func signJWTToken(claims jwt.MapClaims) (string, error) {
+	if SigningMethod == jwt.SigningMethodHS256.Alg() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(JWTSecret))
+	} else if isKeyPairMethod(SigningMethod) {
+		return signJWTTokenWithKey(claims)
+	}
+
+	return "", errors.New("unsupported signing method")
+}
+
+// signJWTTokenWithKey signs the claims with the private key loaded from the file, of the signing method
+// from the environment variable: an RSA key for RS256, a P-256 key for ES256 or an Ed25519 key for EdDSA.
+func signJWTTokenWithKey(claims jwt.MapClaims) (string, error) {
 	// Load the private key from the file
-	privateKey, err := util.LoadPrivateKey()
+	privateKey, err := util.LoadSigningKey(SigningMethod)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to load private key: %v", err))
 		return "", err
 	}
 
-	// Set the now time
-	// This is used to set the issued at (iat) and expiration (exp) claims
-	now := time.Now().Unix()
-
-	// Create the claims for the JWT token
-	claims := jwt.MapClaims{
-		"sub":      user.UserName,
-		"aud":      JWTAudience,
-		"iss":      JWTIssuer,
-		"iat":      now,
-		"exp":      GetJWTExpiration(now),
-		"email":    user.Email,
-		"userid":   user.ID,
-		"username": user.UserName,
-		"roles":    ExtractRoleNames(user.Roles),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	// Name the key in the header, so the clients pick it from the JWKS
+	token := jwt.NewWithClaims(keyPairMethods[SigningMethod], claims)
+	token.Header["kid"] = util.PublicKeyID(privateKey.Public())
 	return token.SignedString(privateKey)
 }
 
 // ParseJWTToken determines the function to use for parsing a JWT token based on the signing method.
 // It checks the signing method from the environment variable and calls the appropriate function.
-func ParseJWTToken(tokenStr string) (*jwt.Token, error) {
+// The parser options are passed on, e.g. jwt.WithTimeFunc to validate the expiration against another clock.
+func ParseJWTToken(tokenStr string, opts ...jwt.ParserOption) (*jwt.Token, error) {
 	// Load environment variables
 	LoadEnv()
 
 	// Check the signing method from the environment variable
 	if SigningMethod == jwt.SigningMethodHS256.Alg() {
-		return ParseJWTTokenWithHS256(tokenStr)
-	} else if SigningMethod == jwt.SigningMethodRS256.Alg() {
-		return ParseJWTTokenWithRS256(tokenStr)
+		return ParseJWTTokenWithHS256(tokenStr, opts...)
+	} else if isKeyPairMethod(SigningMethod) {
+		return ParseJWTTokenWithKey(tokenStr, opts...)
 	}
 
 	return nil, errors.New("unsupported signing method")
@@ -412,7 +1075,7 @@ func ParseJWTToken(tokenStr string) (*jwt.Token, error) {
 
 // ParseJWTTokenWithHS256 parses a JWT token using the HS256 signing method.
 // It validates the token and returns the parsed token object.
-func ParseJWTTokenWithHS256(tokenStr string) (*jwt.Token, error) {
+func ParseJWTTokenWithHS256(tokenStr string, opts ...jwt.ParserOption) (*jwt.Token, error) {
 	// Load environment variables
 	LoadEnv()
 
@@ -422,7 +1085,7 @@ func ParseJWTTokenWithHS256(tokenStr string) (*jwt.Token, error) {
 			return nil, errors.New("unexpected signing method")
 		}
 		return []byte(JWTSecret), nil
-	})
+	}, opts...)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to parse JWT token: %v", err))
 		return nil, err
@@ -430,23 +1093,28 @@ func ParseJWTTokenWithHS256(tokenStr string) (*jwt.Token, error) {
 	return token, nil
 }
 
-// ParseJWTTokenWithRS256 parses a JWT token using the RS256 signing method.
-// It validates the token and returns the parsed token object.
-func ParseJWTTokenWithRS256(tokenStr string) (*jwt.Token, error) {
-	// Load the public key from the file
-	publicKey, err := util.LoadPublicKey()
+// ParseJWTTokenWithKey parses a JWT token using the RS256, ES256 or EdDSA signing method from the environment variable.
+// It validates the token with the public key named by its kid header and returns the parsed token object.
+func ParseJWTTokenWithKey(tokenStr string, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	// Load environment variables
+	LoadEnv()
+
+	// Load the public keys from the files
+	publicKeys, err := util.LoadPublicKeys(SigningMethod)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to load public key: %v", err))
 		return nil, err
 	}
 
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		// Only the signing method of the keys is accepted, e.g. no HS256 token signed with the public key
+		if token.Method.Alg() != SigningMethod {
 			logger.Error(fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]))
 			return nil, errors.New("unexpected signing method")
 		}
-		return publicKey, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		return util.FindPublicKey(publicKeys, kid)
+	}, opts...)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to parse JWT token: %v", err))
 		return nil, err
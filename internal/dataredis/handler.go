@@ -1,12 +1,24 @@
 package dataredis
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 )
 
+// retryAfterSeconds is the delay suggested to the clients before retrying a transient Redis error.
+const retryAfterSeconds = 1
+
+// RetryInfo is the data of the error responses of the Redis reads, telling the clients whether to retry.
+// The timeouts and the failures of Redis are transient and retryable, a missing key is not.
+type RetryInfo struct {
+	Retryable         bool `json:"retryable"`
+	RetryAfterSeconds int  `json:"retryAfterSeconds,omitempty"`
+}
+
 // This struct defines the DataRedisHandler which handles HTTP requests related to Redis data.
 // It contains a service field of type DataRedisService which is used to interact with the Redis data layer.
 type DataRedisHandler struct {
@@ -30,6 +42,8 @@ func NewDataRedisHandler(dataRedisService DataRedisService) *DataRedisHandler {
 // @Failure      400  {object}  HttpResponse for bad request
 // @Failure      404  {object}  HttpResponse for not found
 // @Failure      500  {object}  HttpResponse for internal server error
+// @Failure      502  {object}  HttpResponse for Redis failure
+// @Failure      504  {object}  HttpResponse for Redis timeout
 // @Router       /dataredis/string/{key} [get]
 func (h *DataRedisHandler) GetStringValue(c *gin.Context) {
 	// Parse the key from the URL parameter
@@ -42,7 +56,7 @@ func (h *DataRedisHandler) GetStringValue(c *gin.Context) {
 	// Call the service to get the string value from Redis
 	value, err := h.Service.GetStringValue(c.Request.Context(), key)
 	if err != nil {
-		util.JSONError(c, http.StatusInternalServerError, "Failed to get string value", err.Error())
+		jsonRedisError(c, "Failed to get string value", err)
 		return
 	}
 
@@ -67,6 +81,8 @@ func (h *DataRedisHandler) GetStringValue(c *gin.Context) {
 // @Failure      400  {object}  HttpResponse for bad request
 // @Failure      404  {object}  HttpResponse for not found
 // @Failure      500  {object}  HttpResponse for internal server error
+// @Failure      502  {object}  HttpResponse for Redis failure
+// @Failure      504  {object}  HttpResponse for Redis timeout
 // @Router       /dataredis/json/{key} [get]
 func (h *DataRedisHandler) GetJSONValue(c *gin.Context) {
 	// Parse the key from the URL parameter
@@ -79,7 +95,7 @@ func (h *DataRedisHandler) GetJSONValue(c *gin.Context) {
 	// Call the service to get the JSON value from Redis
 	value, err := h.Service.GetJSONValue(c.Request.Context(), key)
 	if err != nil {
-		util.JSONError(c, http.StatusInternalServerError, "Failed to get JSON value", err.Error())
+		jsonRedisError(c, "Failed to get JSON value", err)
 		return
 	}
 
@@ -92,3 +108,19 @@ func (h *DataRedisHandler) GetJSONValue(c *gin.Context) {
 	// Return the JSON value as JSON
 	util.JSONSuccess(c, http.StatusOK, "JSON value retrieved successfully", value)
 }
+
+// jsonRedisError writes the response of a failed Redis read with its retry-ability.
+// The retryable errors also get a Retry-After header, the untyped errors (e.g. a value that is not JSON) are answered with 500.
+func jsonRedisError(c *gin.Context, message string, err error) {
+	info := RetryInfo{}
+	if errors.Is(err, ErrRedisTimeout) || errors.Is(err, ErrRedisUnavailable) {
+		info = RetryInfo{Retryable: true, RetryAfterSeconds: retryAfterSeconds}
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+
+	if util.JSONAppErrorWithData(c, message, err, info) {
+		return
+	}
+
+	util.JSONError(c, http.StatusInternalServerError, message, err.Error())
+}
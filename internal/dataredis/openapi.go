@@ -0,0 +1,19 @@
+package dataredis
+
+import (
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Operations documents the data redis handlers in the OpenAPI spec, keyed by handler method name.
+// The errors listed here are the typed errors returned by the service for each operation.
+var Operations = map[string]openapi.Operation{
+	"GetStringValue": {
+		Summary: "Get a string value from Redis",
+		Errors:  []*apperror.Error{ErrKeyNotFound, ErrRedisUnavailable, ErrRedisTimeout},
+	},
+	"GetJSONValue": {
+		Summary: "Get a JSON value from Redis",
+		Errors:  []*apperror.Error{ErrKeyNotFound, ErrRedisUnavailable, ErrRedisTimeout},
+	},
+}
@@ -0,0 +1,36 @@
+package dataredis
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the Redis data routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	dataRedisGroup := rg.Group("/dataredis")
+	{
+		// Rate limiter middleware for the /dataredis group.
+		// - Allows a burst of up to 5 requests at once.
+		// - Allows 1 request every 3 seconds continuously after the burst.
+		// - Helps prevent abuse of Redis storage/read operations from a single IP.
+		// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+		dataRedisGroup.Use(ratelimiter.RateLimiter(rate.Every(3*time.Second), 5, 10*time.Minute))
+
+		// Initialize the data redis service
+		// This is where the actual implementation of the service would be used
+		service := NewDataRedisService()
+
+		// Initialize the data redis handler with the service
+		// This handler handles the HTTP requests and responses for data redis-related operations
+		handler := NewDataRedisHandler(service)
+
+		// Define the routes for data redis management
+		dataRedisGroup.GET("/string/:key", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetStringValue)
+		dataRedisGroup.GET("/json/:key", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetJSONValue)
+	}
+}
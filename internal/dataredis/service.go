@@ -4,13 +4,47 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util/redisutil"
 )
 
+// defaultOperationTimeout bounds each Redis operation when DATAREDIS_TIMEOUT_MS is not set.
+const defaultOperationTimeout = 500 * time.Millisecond
+
+var (
+	DataRedisTimeout string
+
+	operationTimeout = defaultOperationTimeout
+)
+
+// Typed errors returned by the data redis service
+// The timeouts and the failures of Redis are transient, the clients can retry them (see RetryInfo)
+var (
+	ErrKeyNotFound      = apperror.New("RedisKeyNotFound", http.StatusNotFound, "key does not exist in Redis")
+	ErrRedisTimeout     = apperror.New("RedisTimeout", http.StatusGatewayTimeout, "Redis did not answer in time")
+	ErrRedisUnavailable = apperror.New("RedisUnavailable", http.StatusBadGateway, "Redis failed to answer the request")
+)
+
+// LoadEnv loads environment variables
+// DATAREDIS_TIMEOUT_MS bounds each Redis operation, the deadline of the request applies when it is earlier.
+func LoadEnv() {
+	DataRedisTimeout = os.Getenv("DATAREDIS_TIMEOUT_MS")
+
+	operationTimeout = defaultOperationTimeout
+	if ms, err := strconv.Atoi(DataRedisTimeout); err == nil && ms > 0 {
+		operationTimeout = time.Duration(ms) * time.Millisecond
+	}
+}
+
 // Interface for the DataRedisService
 // This interface defines the methods that the DataRedisService should implement
 type DataRedisService interface {
@@ -18,13 +52,30 @@ type DataRedisService interface {
 	GetJSONValue(ctx context.Context, key string) (interface{}, error)
 }
 
-// This struct defines the DataRedisService
-type dataRedisService struct{}
+// This struct defines the DataRedisService that contains the timeout of the Redis operations
+type dataRedisService struct {
+	timeout time.Duration
+}
+
+// Option configures a data redis service.
+type Option func(*dataRedisService)
+
+// WithTimeout sets the timeout of each Redis operation, instead of DATAREDIS_TIMEOUT_MS.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *dataRedisService) {
+		s.timeout = timeout
+	}
+}
 
 // NewDataRedisService creates a new instance of DataRedisService
-// It initializes the dataRedisService struct and returns it.
-func NewDataRedisService() DataRedisService {
-	return &dataRedisService{}
+// It initializes the dataRedisService struct, applies the options and returns it.
+func NewDataRedisService(opts ...Option) DataRedisService {
+	s := &dataRedisService{timeout: operationTimeout}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // GetStringValue retrieves a string value from Redis by its key
@@ -33,25 +84,16 @@ func (s *dataRedisService) GetStringValue(ctx context.Context, key string) (stri
 	redisClient := dbcontext.GetRedisClient(ctx)
 	if redisClient == nil {
 		logger.Error("redis client is nil")
-		return "", errors.New("redis client is nil")
+		return "", ErrRedisUnavailable
 	}
 
-	// Retrieve the string value from Redis
-	value, err := redisutil.Get(ctx, redisClient, key)
-	if err == redis.Nil {
-		logger.Error("key does not exist in Redis")
-		return "", errors.New("key does not exist in Redis")
-	}
+	// Retrieve the string value from Redis within the operation timeout
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
+	value, err := redisutil.Get(ctx, redisClient, key)
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to get string value from Redis: %v", err))
-		return "", err
-	}
-
-	// Check if the value is empty
-	if value == "" {
-		logger.Error("value is empty")
-		return "", errors.New("value is empty")
+		return "", classifyError(key, err)
 	}
 
 	return value, nil
@@ -63,20 +105,41 @@ func (s *dataRedisService) GetJSONValue(ctx context.Context, key string) (interf
 	redisClient := dbcontext.GetRedisClient(ctx)
 	if redisClient == nil {
 		logger.Error("redis client is nil")
-		return nil, errors.New("redis client is nil")
+		return nil, ErrRedisUnavailable
 	}
 
-	// Retrieve the JSON value from Redis
-	value, err := redisutil.GetJSON[any](ctx, redisClient, key)
-	if err == redis.Nil {
-		logger.Error("key does not exist in Redis")
-		return "", errors.New("key does not exist in Redis")
-	}
+	// Retrieve the JSON value from Redis within the operation timeout
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
+	value, err := redisutil.GetJSON[any](ctx, redisClient, key)
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to get JSON value from Redis: %v", err))
-		return nil, err
+		return nil, classifyError(key, err)
 	}
 
 	return value, nil
 }
+
+// classifyError maps the error of a Redis operation to a typed error:
+// a missing key, a timeout (of the operation or of the request), or a failure of Redis.
+// The other errors, e.g. a value that is not JSON, are returned as is.
+func classifyError(key string, err error) error {
+	if errors.Is(err, redis.Nil) {
+		return ErrKeyNotFound
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		logger.Warn(fmt.Sprintf("redis operation on key %s timed out: %v", key, err))
+		return ErrRedisTimeout
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) || errors.As(err, &netErr) || errors.Is(err, redis.ErrClosed) {
+		logger.Error(fmt.Sprintf("redis operation on key %s failed: %v", key, err))
+		return ErrRedisUnavailable
+	}
+
+	logger.Error(fmt.Sprintf("failed to get value of key %s from Redis: %v", key, err))
+	return err
+}
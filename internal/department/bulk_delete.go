@@ -0,0 +1,301 @@
+package department
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// A conditional bulk delete runs in two calls: the dry run counts the departments matching the filter and issues
+// a confirm token, which the second call gives back to soft-delete them. The token is single-use, expires after
+// bulkDeleteConfirmTTL and only confirms the same filter for the same admin. The departments are then deleted in
+// batches by a job of the job queue, which reports its progress.
+
+// JobTypeBulkDelete is the type of the jobs deleting the departments matching a filter.
+const JobTypeBulkDelete = "department.bulk-delete"
+
+const (
+	// bulkDeleteConfirmTTL is the validity of the confirm tokens issued by the dry runs
+	bulkDeleteConfirmTTL = 10 * time.Minute
+
+	// bulkDeleteBatchSize is the number of departments deleted in each transaction
+	bulkDeleteBatchSize = 100
+
+	// bulkDeleteSampleSize is the number of department IDs listed by the dry runs
+	bulkDeleteSampleSize = 20
+
+	// bulkDeleteKeyPrefix is the prefix of the Redis keys of the confirm tokens, stored as their SHA-256
+	bulkDeleteKeyPrefix = "bulk-delete:"
+)
+
+var (
+	ErrBulkDeleteUnfiltered  = apperror.New("BulkDeleteUnfiltered", http.StatusBadRequest, "the filter of a bulk delete must select some departments, not all of them")
+	ErrInvalidConfirmToken   = apperror.New("InvalidConfirmToken", http.StatusBadRequest, "the confirm token is missing, invalid, expired or issued for another filter")
+	ErrBulkDeleteChanged     = apperror.New("BulkDeleteChanged", http.StatusConflict, "more departments match the filter than in the dry run, run it again")
+	ErrJobQueueNotConfigured = errors.New("job queue is not initialized")
+)
+
+// pendingBulkDelete is the dry run confirmed by a token, as stored in Redis.
+type pendingBulkDelete struct {
+	Filter  string `json:"filter"`
+	UserID  int64  `json:"userId"`
+	Matched int64  `json:"matched"`
+}
+
+// PreviewBulkDelete counts the departments matching the filter of a bulk delete and issues the token confirming it.
+// Nothing is changed.
+func (s *departmentService) PreviewBulkDelete(ctx context.Context, filter BulkDeleteFilter) (BulkDeletePreview, error) {
+	if filter.IsEmpty() {
+		return BulkDeletePreview{}, ErrBulkDeleteUnfiltered
+	}
+
+	// Get the database connection and the Redis client from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return BulkDeletePreview{}, errors.New("database connection is nil")
+	}
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return BulkDeletePreview{}, errors.New("redis client is nil")
+	}
+
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return BulkDeletePreview{}, errors.New("missing user context")
+	}
+
+	matched, err := s.repo.CountBulkDelete(db, filter)
+	if err != nil {
+		return BulkDeletePreview{}, err
+	}
+	sample, err := s.repo.GetBulkDeleteIDs(db, filter, bulkDeleteSampleSize)
+	if err != nil {
+		return BulkDeletePreview{}, err
+	}
+
+	// Only the hash of the token is stored, with the filter and the admin it confirms
+	token, err := generateConfirmToken()
+	if err != nil {
+		return BulkDeletePreview{}, err
+	}
+	pending, err := json.Marshal(pendingBulkDelete{Filter: filter.String(), UserID: meta.UserID, Matched: matched})
+	if err != nil {
+		return BulkDeletePreview{}, err
+	}
+	if err := redisClient.Set(ctx, bulkDeleteKeyPrefix+hashConfirmToken(token), pending, bulkDeleteConfirmTTL).Err(); err != nil {
+		logger.Error(fmt.Sprintf("failed to store bulk delete confirm token: %v", err))
+		return BulkDeletePreview{}, err
+	}
+
+	return BulkDeletePreview{
+		Filter:       filter.String(),
+		Matched:      matched,
+		Sample:       sample,
+		ConfirmToken: token,
+		ExpiresAt:    s.clock.Now().Add(bulkDeleteConfirmTTL),
+	}, nil
+}
+
+// BulkDelete queues the job soft-deleting the departments matching the filter, confirmed by the token of its dry run.
+// The token is consumed even when it is refused, a new dry run issues another one.
+func (s *departmentService) BulkDelete(ctx context.Context, filter BulkDeleteFilter, confirmToken string) (jobs.Job, error) {
+	if filter.IsEmpty() {
+		return jobs.Job{}, ErrBulkDeleteUnfiltered
+	}
+	if confirmToken == "" {
+		return jobs.Job{}, ErrInvalidConfirmToken
+	}
+
+	// Get the database connection and the Redis client from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return jobs.Job{}, errors.New("database connection is nil")
+	}
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return jobs.Job{}, errors.New("redis client is nil")
+	}
+
+	queue := s.jobs
+	if queue == nil {
+		queue = jobs.Default
+	}
+	if queue == nil {
+		return jobs.Job{}, ErrJobQueueNotConfigured
+	}
+
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return jobs.Job{}, errors.New("missing user context")
+	}
+
+	// Consume the token, it only confirms the filter of its dry run for the same admin
+	data, err := redisClient.GetDel(ctx, bulkDeleteKeyPrefix+hashConfirmToken(confirmToken)).Result()
+	if errors.Is(err, redis.Nil) {
+		return jobs.Job{}, ErrInvalidConfirmToken
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to read bulk delete confirm token: %v", err))
+		return jobs.Job{}, err
+	}
+
+	var pending pendingBulkDelete
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return jobs.Job{}, ErrInvalidConfirmToken
+	}
+	if pending.Filter != filter.String() || pending.UserID != meta.UserID {
+		return jobs.Job{}, ErrInvalidConfirmToken
+	}
+
+	// The departments created since the dry run were not reviewed, they are not deleted blindly
+	matched, err := s.repo.CountBulkDelete(db, filter)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if matched > pending.Matched {
+		return jobs.Job{}, ErrBulkDeleteChanged
+	}
+
+	logger.Warn(fmt.Sprintf("bulk delete of the %d departments matching %s queued by %s", matched, filter, meta.UserName))
+	return queue.Enqueue(ctx, JobTypeBulkDelete, meta.UserID, func(jobCtx context.Context, report func(int64, int64)) (any, error) {
+		return s.runBulkDelete(jobCtx, filter, matched, report)
+	})
+}
+
+// runBulkDelete soft-deletes the departments matching the filter in batches, each in its own transaction,
+// and reports the progress after each batch. An interrupted job keeps the batches already deleted.
+func (s *departmentService) runBulkDelete(ctx context.Context, filter BulkDeleteFilter, matched int64, report func(int64, int64)) (BulkDeleteResult, error) {
+	result := BulkDeleteResult{Filter: filter.String(), Matched: matched, Skipped: []string{}}
+
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		return result, errors.New("database connection is nil")
+	}
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return result, errors.New("missing user context")
+	}
+
+	afterID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		var deleted []Department
+		var skipped []string
+		var batchSize int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			batch, err := s.repo.GetBulkDeleteBatchForUpdate(tx, filter, afterID, bulkDeleteBatchSize)
+			if err != nil {
+				return err
+			}
+			batchSize = len(batch)
+
+			for _, d := range batch {
+				// Service accounts only write the departments of their scope, and the departments managed by an
+				// automation are only changed manually with MANAGED_EDIT_POLICY=FLAG: the others are skipped
+				// rather than failing the job
+				if meta.DepartmentScoped && !meta.InDepartmentScope(d.ID) {
+					skipped = append(skipped, d.ID)
+					continue
+				}
+				if err := s.checkManaged(ctx, tx, d, meta); errors.Is(err, ErrDepartmentManaged) {
+					skipped = append(skipped, d.ID)
+					continue
+				} else if err != nil {
+					return err
+				}
+
+				// The departments with active members are only deleted one by one, with force
+				members, err := s.repo.CountEmployees(tx, d.ID)
+				if err != nil {
+					return err
+				}
+				if members > 0 {
+					skipped = append(skipped, d.ID)
+					continue
+				}
+
+				if err := s.repo.DeleteDepartment(ctx, tx, d, &meta.UserID); err != nil {
+					return err
+				}
+				d.DeletedBy = &meta.UserID
+
+				// Write the domain event to the outbox within the same transaction
+				if err := s.events.Add(ctx, tx, event.NewEvent(event.DepartmentDeleted, d.ID, d)); err != nil {
+					return err
+				}
+				deleted = append(deleted, d)
+			}
+
+			if batchSize > 0 {
+				afterID = batch[batchSize-1].ID
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to bulk delete departments: %v", err))
+			return result, err
+		}
+		if batchSize == 0 {
+			return result, nil
+		}
+
+		result.Deleted += int64(len(deleted))
+		result.Skipped = append(result.Skipped, skipped...)
+
+		// Forward the committed events without waiting for the next outbox poll
+		outbox.Notify()
+
+		// Remove the deleted departments and the public listing from the cache
+		for _, d := range deleted {
+			s.cache.Delete(ctx, strings.ToLower(d.ID))
+		}
+		if len(deleted) > 0 {
+			s.publicCache.Delete(ctx, publicDepartmentsKey)
+		}
+
+		// The departments created since the job was queued may exceed the count, the total follows the progress
+		processed := result.Deleted + int64(len(result.Skipped))
+		report(processed, max(matched, processed))
+	}
+}
+
+// generateConfirmToken generates a random, URL-safe confirm token.
+func generateConfirmToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashConfirmToken returns the hex-encoded SHA-256 of a confirm token, the form in which it is stored.
+func hashConfirmToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,186 @@
+package department
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"gorm.io/gorm"
+)
+
+// The employee count of a department is the number of (not deleted) users assigned to it.
+// It is stored on the department, so the listings return it without joining the users, and it is
+// maintained in the transaction that assigns, transfers, deletes or restores a user. The counter is
+// changed with relative updates under the row lock of the department, so concurrent assignments do
+// not lose increments. The reconciliation job recounts the users and repairs the drifted counters,
+// e.g. after a manual change in the database.
+
+// ErrUnknownDepartment is returned when a user is assigned to a department that does not exist.
+var ErrUnknownDepartment = apperror.New("UnknownDepartment", http.StatusUnprocessableEntity, "department with the given ID does not exist")
+
+// EmployeeCountDrift reports a department whose employee count did not match its users.
+type EmployeeCountDrift struct {
+	DepartmentID string `gorm:"column:department_id" json:"departmentId"`
+	Recorded     int64  `gorm:"column:recorded" json:"recorded"`
+	Actual       int64  `gorm:"column:actual" json:"actual"`
+}
+
+// MoveEmployee updates the employee counts of the department a user leaves and of the department it joins.
+// Either may be nil, e.g. when a user is created or deleted. It must be called with the transaction
+// of the user change, and returns the ID of the joined department as stored on the department.
+// Both departments are locked in ID order, so concurrent transfers cannot deadlock.
+func MoveEmployee(ctx context.Context, tx *gorm.DB, from, to *string) (*string, error) {
+	if from != nil && to != nil && strings.EqualFold(*from, *to) {
+		return from, nil
+	}
+
+	var ids []string
+	for _, id := range []*string{from, to} {
+		if id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	repo := NewDepartmentRepository()
+	departments, err := repo.GetDepartmentsByIDsForUpdate(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// A deleted department has no counter to maintain
+	if leaving := findDepartment(departments, from); leaving != nil {
+		if err := repo.AdjustEmployeeCount(ctx, tx, leaving.ID, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	if to == nil {
+		return nil, nil
+	}
+
+	// The employees can only join the existing departments that are not archived
+	joining := findDepartment(departments, to)
+	if joining == nil {
+		return nil, ErrUnknownDepartment
+	}
+	if joining.IsArchived() {
+		return nil, ErrDepartmentArchived
+	}
+	if err := repo.AdjustEmployeeCount(ctx, tx, joining.ID, 1); err != nil {
+		return nil, err
+	}
+
+	return &joining.ID, nil
+}
+
+// findDepartment finds the department with the given ID, compared case-insensitively.
+func findDepartment(departments []Department, id *string) *Department {
+	if id == nil {
+		return nil
+	}
+
+	for i := range departments {
+		if strings.EqualFold(departments[i].ID, *id) {
+			return &departments[i]
+		}
+	}
+
+	return nil
+}
+
+// ForgetCachedDepartments removes the given departments from the cache, e.g. after their employee count changed.
+func ForgetCachedDepartments(ctx context.Context, ids ...*string) {
+	for _, id := range ids {
+		if id != nil {
+			departmentCache.Delete(ctx, strings.ToLower(*id))
+		}
+	}
+}
+
+// ReconcileEmployeeCounts detects the departments whose employee count does not match their users and repairs them.
+// Each department is recounted under its row lock, so the repair does not race with the assignments.
+// It returns the repaired drifts.
+func ReconcileEmployeeCounts(ctx context.Context, db *gorm.DB) ([]EmployeeCountDrift, error) {
+	if db == nil {
+		return nil, errors.New("database connection is nil")
+	}
+
+	repo := NewDepartmentRepository()
+	candidates, err := repo.GetEmployeeCountDrifts(db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	repaired := []EmployeeCountDrift{}
+	for _, candidate := range candidates {
+		var drift *EmployeeCountDrift
+		err := db.Transaction(func(tx *gorm.DB) error {
+			departments, err := repo.GetDepartmentsByIDsForUpdate(tx, []string{candidate.DepartmentID})
+			if err != nil || len(departments) == 0 {
+				return err
+			}
+
+			actual, err := repo.CountEmployees(tx, departments[0].ID)
+			if err != nil {
+				return err
+			}
+			if actual == departments[0].EmployeeCount {
+				return nil
+			}
+
+			drift = &EmployeeCountDrift{DepartmentID: departments[0].ID, Recorded: departments[0].EmployeeCount, Actual: actual}
+			return repo.AdjustEmployeeCount(ctx, tx, departments[0].ID, actual-departments[0].EmployeeCount)
+		})
+		if err != nil {
+			return repaired, fmt.Errorf("failed to repair the employee count of department %s: %v", candidate.DepartmentID, err)
+		}
+		if drift == nil {
+			continue
+		}
+
+		logger.Warn(fmt.Sprintf("Employee count of department %s was %d instead of %d, repaired", drift.DepartmentID, drift.Recorded, drift.Actual))
+		ForgetCachedDepartments(ctx, &drift.DepartmentID)
+		repaired = append(repaired, *drift)
+	}
+
+	return repaired, nil
+}
+
+// InitReconciler starts the job reconciling the employee counts every EMPLOYEE_COUNT_RECONCILE_INTERVAL_MINUTES.
+// The job is disabled when the interval is 0. Several replicas may run it, the repairs are serialized by the row locks.
+func InitReconciler(db *gorm.DB) {
+	if employeeCountReconcileInterval <= 0 {
+		logger.Info("Employee count reconciliation is disabled")
+		return
+	}
+	if db == nil {
+		logger.Error("Failed to start employee count reconciliation: database connection is nil")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(employeeCountReconcileInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// The repairs are writes, they wait for the end of the maintenance
+			if maintenance.Current().Enabled {
+				continue
+			}
+			if _, err := ReconcileEmployeeCounts(context.Background(), db); err != nil {
+				logger.Error(fmt.Sprintf("failed to reconcile employee counts: %v", err))
+			}
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("Employee count reconciliation started with an interval of %s", employeeCountReconcileInterval))
+}
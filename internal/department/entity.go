@@ -1,6 +1,12 @@
 package department
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
@@ -10,17 +16,211 @@ import (
 
 var v *validator.Validate
 
+// Department statuses
+// An archived department is kept visible but read-only, unlike a soft-deleted department.
+const (
+	StatusActive   = "ACTIVE"
+	StatusArchived = "ARCHIVED"
+)
+
+// Policies for the manual changes of the departments managed by an automation
+// REJECT refuses them, FLAG accepts them and publishes a department.drifted event for the automation.
+const (
+	ManagedEditReject = "REJECT"
+	ManagedEditFlag   = "FLAG"
+)
+
+// Policies for the members of a department deleted with force=true
+// UNASSIGN clears their department, KEEP leaves them assigned to the deleted department until it is restored.
+const (
+	MemberCascadeUnassign = "UNASSIGN"
+	MemberCascadeKeep     = "KEEP"
+)
+
+// Filters for archived departments in listings
+const (
+	ArchivedExclude = "exclude"
+	ArchivedInclude = "include"
+	ArchivedOnly    = "only"
+)
+
 // Department represents the department entity in the database.
 type Department struct {
-	ID        string          `gorm:"column:id;type:varchar(4);primaryKey;not null" json:"id" validate:"required,len=4"`
-	DeptName  string          `gorm:"column:dept_name;type:varchar(40);unique;not null" json:"deptName" validate:"required,max=40"`
-	Active    bool            `gorm:"column:active;type:bool;not null" json:"active"`
-	CreatedBy *int64          `gorm:"column:created_by" json:"createdBy,omitempty"`
-	CreatedAt *time.Time      `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
-	UpdatedBy *int64          `gorm:"column:updated_by" json:"updatedBy,omitempty"`
-	UpdatedAt *time.Time      `gorm:"column:updated_at;type:timestamptz;autoUpdateTime;default:now()" json:"updatedAt,omitempty"`
-	DeletedBy *int64          `gorm:"column:deleted_by" json:"deletedBy,omitempty"`
-	DeletedAt *gorm.DeletedAt `gorm:"column:deleted_at;type:timestamptz;index" json:"deletedAt,omitempty"`
+	ID            string          `gorm:"column:id;type:varchar(4);primaryKey;not null" json:"id" validate:"required,len=4"`
+	DeptName      string          `gorm:"column:dept_name;type:varchar(40);unique;not null" json:"deptName" validate:"required,max=40"`
+	Active        bool            `gorm:"column:active;type:bool;not null" json:"active"`
+	Tags          Tags            `gorm:"column:tags;type:jsonb;not null;default:'[]'" json:"tags" validate:"omitempty,max=20,dive,min=1,max=30,slug"`
+	Metadata      Metadata        `gorm:"column:metadata;type:jsonb;not null;default:'{}'" json:"metadata" validate:"omitempty,max=50,metadata"`
+	Status        string          `gorm:"column:status;type:varchar(20);not null;default:ACTIVE;index" json:"status"`
+	ArchivedBy    *int64          `gorm:"column:archived_by" json:"archivedBy,omitempty"`
+	ArchivedAt    *time.Time      `gorm:"column:archived_at;type:timestamptz" json:"archivedAt,omitempty"`
+	ManagedBy     *string         `gorm:"column:managed_by;type:varchar(50);index" json:"managedBy,omitempty"`
+	EmployeeCount int64           `gorm:"column:employee_count;not null;default:0;check:employee_count >= 0" json:"employeeCount"`
+	ValidFrom     *time.Time      `gorm:"column:valid_from;type:timestamptz" json:"validFrom,omitempty"`
+	ValidTo       *time.Time      `gorm:"column:valid_to;type:timestamptz" json:"validTo,omitempty"`
+	CreatedBy     *int64          `gorm:"column:created_by" json:"createdBy,omitempty"`
+	CreatedAt     *time.Time      `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+	UpdatedBy     *int64          `gorm:"column:updated_by" json:"updatedBy,omitempty"`
+	UpdatedAt     *time.Time      `gorm:"column:updated_at;type:timestamptz;autoUpdateTime;default:now()" json:"updatedAt,omitempty"`
+	DeletedBy     *int64          `gorm:"column:deleted_by" json:"deletedBy,omitempty"`
+	DeletedAt     *gorm.DeletedAt `gorm:"column:deleted_at;type:timestamptz;index" json:"deletedAt,omitempty"`
+}
+
+// PublicDepartment is the trimmed projection of a department served to the anonymous consumers.
+type PublicDepartment struct {
+	ID       string `gorm:"column:id" json:"id"`
+	DeptName string `gorm:"column:dept_name" json:"deptName"`
+	Active   bool   `gorm:"column:active" json:"active"`
+}
+
+// Tags represents the labels used to group departments (e.g. "remote-first", "billable").
+// They are stored as a JSON array in a jsonb column.
+type Tags []string
+
+// Metadata represents the free-form attributes attached to a department (e.g. "costCenter", "region").
+// Different companies attach different attributes, so they are stored as a JSON object in a jsonb column.
+// Values are limited to strings, numbers, booleans and null.
+type Metadata map[string]any
+
+// DepartmentFilter holds the filters of the department listing.
+// A department must have all the given tags and metadata values to match.
+// AsOf selects the departments that existed at the given time, with the name they had then.
+type DepartmentFilter struct {
+	Archived string
+	Tags     []string
+	Metadata map[string]string
+	AsOf     *time.Time
+}
+
+// BulkDeleteFilter selects the departments removed by a conditional bulk delete.
+// A department must match all the given conditions; at least one of them narrows the selection,
+// so a bulk delete never removes every department by mistake.
+type BulkDeleteFilter struct {
+	Active        *bool
+	Tags          []string
+	Archived      string
+	CreatedBefore *time.Time
+}
+
+// IsEmpty reports whether the filter selects every department.
+func (f BulkDeleteFilter) IsEmpty() bool {
+	return f.Active == nil && len(f.Tags) == 0 && f.CreatedBefore == nil && f.Archived != ArchivedOnly
+}
+
+// String returns the canonical form of the filter, the same for the equivalent expressions.
+// The confirm token of a dry run is bound to it.
+func (f BulkDeleteFilter) String() string {
+	var terms []string
+	if f.Active != nil {
+		terms = append(terms, fmt.Sprintf("active:%t", *f.Active))
+	}
+	for _, tag := range f.Tags {
+		terms = append(terms, "tag:"+tag)
+	}
+	terms = append(terms, "archived:"+f.Archived)
+	if f.CreatedBefore != nil {
+		terms = append(terms, "createdBefore:"+f.CreatedBefore.UTC().Format(time.RFC3339Nano))
+	}
+
+	return strings.Join(terms, ",")
+}
+
+// BulkDeletePreview is the outcome of the dry run of a bulk delete: the departments it would remove
+// and the token confirming it.
+type BulkDeletePreview struct {
+	Filter       string    `json:"filter"`
+	Matched      int64     `json:"matched"`
+	Sample       []string  `json:"sample"`
+	ConfirmToken string    `json:"confirmToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// BulkDeleteResult is the result of the job of a bulk delete.
+// The departments outside the scope of the caller, or managed by an automation, are skipped (see checkManaged).
+type BulkDeleteResult struct {
+	Filter  string   `json:"filter"`
+	Matched int64    `json:"matched"`
+	Deleted int64    `json:"deleted"`
+	Skipped []string `json:"skipped"`
+}
+
+// DepartmentVersion represents a closed validity period of a department (type-2 history).
+// A version is recorded when the name of a department changes, with the name it had during the period.
+// The current period is the one of the department itself, starting at its validFrom.
+type DepartmentVersion struct {
+	ID           int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	DepartmentID string    `gorm:"column:department_id;type:varchar(4);not null;index" json:"departmentId"`
+	DeptName     string    `gorm:"column:dept_name;type:varchar(40);not null" json:"deptName"`
+	ValidFrom    time.Time `gorm:"column:valid_from;type:timestamptz;not null" json:"validFrom"`
+	ValidTo      time.Time `gorm:"column:valid_to;type:timestamptz;not null" json:"validTo"`
+	CreatedBy    *int64    `gorm:"column:created_by" json:"createdBy,omitempty"`
+}
+
+// ScopeViolation is the audit entry of a write of a service account rejected outside its department scope.
+type ScopeViolation struct {
+	UserID   int64    `json:"userId"`
+	UserName string   `json:"userName"`
+	Action   string   `json:"action"`
+	Denied   []string `json:"denied"`
+	Scope    []string `json:"scope"`
+}
+
+// TagsRequest represents the request payload for managing the tags of a department.
+type TagsRequest struct {
+	Tags []string `json:"tags" validate:"required,max=20,dive,min=1,max=30,slug"`
+}
+
+// BulkStatusRequest represents the request payload for activating or deactivating several departments at once.
+type BulkStatusRequest struct {
+	IDs    []string `json:"ids" validate:"required,min=1,max=100,dive,len=4"`
+	Active *bool    `json:"active" validate:"required"`
+}
+
+// BulkStatusResponse lists the departments whose status changed and the IDs already in the requested status.
+type BulkStatusResponse struct {
+	Updated   []Department `json:"updated"`
+	Unchanged []string     `json:"unchanged"`
+}
+
+// DepartmentSuggestion is an existing department whose name is close to a requested one.
+type DepartmentSuggestion struct {
+	ID         string  `gorm:"column:id" json:"id"`
+	DeptName   string  `gorm:"column:dept_name" json:"deptName"`
+	Similarity float64 `gorm:"-" json:"similarity"`
+}
+
+// DepartmentConflict describes why a department cannot be created: the existing department with
+// the same ID or name, and the departments with a similar name the client may have meant.
+type DepartmentConflict struct {
+	Conflicting Department             `json:"conflicting"`
+	Suggestions []DepartmentSuggestion `json:"suggestions"`
+}
+
+// DepartmentMembers describes why a department cannot be deleted: the number of its active members,
+// and the links of the endpoint transferring them to another department.
+type DepartmentMembers struct {
+	Members int64             `json:"members"`
+	Links   map[string]string `json:"links,omitempty"`
+}
+
+// DepartmentName represents a name of a department and the period during which it was used.
+// The current name has no end of validity.
+type DepartmentName struct {
+	DeptName  string     `json:"deptName"`
+	ValidFrom *time.Time `json:"validFrom,omitempty"`
+	ValidTo   *time.Time `json:"validTo,omitempty"`
+	Current   bool       `json:"current"`
+}
+
+// TagCount represents a tag and the number of departments labeled with it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// CountResponse represents the number of departments matching a listing filter.
+type CountResponse struct {
+	Count int64 `json:"count"`
 }
 
 // Override the TableName method to specify the table name
@@ -29,6 +229,97 @@ func (Department) TableName() string {
 	return "department"
 }
 
+// TableName specifies the table name of the department versions.
+// A version is only recorded on a rename, so the table holds the name history of the departments.
+func (DepartmentVersion) TableName() string {
+	return "department_name_history"
+}
+
+// Value implements the driver.Valuer interface.
+// It marshals the tags into a JSON array.
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+// It unmarshals the JSON array stored in the database into the tags.
+func (t *Tags) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	case nil:
+		*t = nil
+		return nil
+	default:
+		return errors.New("failed to scan tags")
+	}
+
+	return json.Unmarshal(data, t)
+}
+
+// Value implements the driver.Valuer interface.
+// It marshals the metadata into a JSON object.
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+// It unmarshals the JSON object stored in the database into the metadata.
+func (m *Metadata) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	case nil:
+		*m = nil
+		return nil
+	default:
+		return errors.New("failed to scan metadata")
+	}
+
+	return json.Unmarshal(data, m)
+}
+
+// NormalizeTags lowercases, trims, deduplicates and sorts the tags.
+func NormalizeTags(tags []string) Tags {
+	seen := make(map[string]bool, len(tags))
+	normalized := Tags{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+
+	return normalized
+}
+
 // Equals compares two Department objects for equality.
 func (d *Department) Equals(other *Department) bool {
 	if d == nil && other == nil {
@@ -68,6 +359,43 @@ func (d *Department) EqualsIgnoreID(other *Department) bool {
 	return true
 }
 
+// IsManaged checks if the department is managed by an automation.
+func (d *Department) IsManaged() bool {
+	return d.ManagedBy != nil && *d.ManagedBy != ""
+}
+
+// IsArchived checks if the department is archived.
+func (d *Department) IsArchived() bool {
+	return d.Status == StatusArchived
+}
+
+// IsValidArchivedFilter checks if the given value is a supported archived filter.
+func IsValidArchivedFilter(filter string) bool {
+	return filter == ArchivedExclude || filter == ArchivedInclude || filter == ArchivedOnly
+}
+
+// Validate validates the TagsRequest struct using the validator package.
+func (r *TagsRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate validates the BulkStatusRequest struct using the validator package.
+func (r *BulkStatusRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Validate validates the Department struct using the validator package.
 // It checks if the struct fields meet the validation rules defined in the struct tags.
 func (d *Department) Validate() error {
@@ -0,0 +1,31 @@
+package department
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+)
+
+// exportColumns are the columns of the department export, in their order in the file.
+// None of them is sensitive, so the export is the same for every role.
+var exportColumns = []export.Column[Department]{
+	{Key: "department.id", Value: func(d Department, _ export.Options) string { return d.ID }},
+	{Key: "department.deptName", Value: func(d Department, _ export.Options) string { return d.DeptName }},
+	{Key: "department.active", Value: func(d Department, o export.Options) string { return export.Bool(d.Active, o) }},
+	{Key: "department.status", Value: func(d Department, _ export.Options) string { return d.Status }},
+	{Key: "department.tags", Value: func(d Department, _ export.Options) string { return strings.Join(d.Tags, ",") }},
+	{Key: "department.employeeCount", Value: func(d Department, _ export.Options) string { return strconv.FormatInt(d.EmployeeCount, 10) }},
+	{Key: "department.managedBy", Value: func(d Department, _ export.Options) string { return export.String(d.ManagedBy) }},
+	{Key: "department.validFrom", Value: func(d Department, o export.Options) string { return export.Time(d.ValidFrom, o) }},
+	{Key: "department.validTo", Value: func(d Department, o export.Options) string { return export.Time(d.ValidTo, o) }},
+	{Key: "department.createdAt", Value: func(d Department, o export.Options) string { return export.Time(d.CreatedAt, o) }},
+	{Key: "department.updatedAt", Value: func(d Department, o export.Options) string { return export.Time(d.UpdatedAt, o) }},
+	{Key: "department.archivedAt", Value: func(d Department, o export.Options) string { return export.Time(d.ArchivedAt, o) }},
+}
+
+// WriteDepartmentsCSV writes the departments as CSV with the header translated in the language of the options.
+func WriteDepartmentsCSV(w io.Writer, departments []Department, opts export.Options) error {
+	return export.WriteCSV(w, exportColumns, departments, opts)
+}
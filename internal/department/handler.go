@@ -1,14 +1,84 @@
 package department
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsoncodec"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
 	"gopkg.in/go-playground/validator.v9"
 )
 
+// defaultPublicMaxAge is the time the clients may cache the public listing when PUBLIC_API_MAX_AGE_SECONDS is not set.
+const defaultPublicMaxAge = 300
+
+// defaultEmployeeCountReconcileInterval is the interval of the employee count reconciliation
+// when EMPLOYEE_COUNT_RECONCILE_INTERVAL_MINUTES is not set.
+const defaultEmployeeCountReconcileInterval = 60 * time.Minute
+
+var (
+	PublicAPIEnabled       string
+	PublicAPIMaxAgeSeconds string
+	ManagedEditPolicy      string
+	DeleteMemberCascade    string
+
+	EmployeeCountReconcileIntervalMinutes string
+
+	publicMaxAge                   = defaultPublicMaxAge
+	managedEditPolicy              = ManagedEditReject
+	memberCascade                  = MemberCascadeUnassign
+	employeeCountReconcileInterval = defaultEmployeeCountReconcileInterval
+)
+
+// LoadEnv loads environment variables
+// The public listing is only routed when PUBLIC_API_ENABLED is set to TRUE.
+// The manual changes of the managed departments are rejected unless MANAGED_EDIT_POLICY is set to FLAG.
+// The members of a department deleted with force=true are unassigned unless DEPARTMENT_DELETE_CASCADE is set to KEEP.
+// The employee counts are reconciled every EMPLOYEE_COUNT_RECONCILE_INTERVAL_MINUTES, 0 disables the job.
+func LoadEnv() {
+	PublicAPIEnabled = os.Getenv("PUBLIC_API_ENABLED")
+	PublicAPIMaxAgeSeconds = os.Getenv("PUBLIC_API_MAX_AGE_SECONDS")
+	ManagedEditPolicy = os.Getenv("MANAGED_EDIT_POLICY")
+	DeleteMemberCascade = os.Getenv("DEPARTMENT_DELETE_CASCADE")
+	EmployeeCountReconcileIntervalMinutes = os.Getenv("EMPLOYEE_COUNT_RECONCILE_INTERVAL_MINUTES")
+
+	managedEditPolicy = ManagedEditReject
+	if strings.EqualFold(ManagedEditPolicy, ManagedEditFlag) {
+		managedEditPolicy = ManagedEditFlag
+	}
+
+	memberCascade = MemberCascadeUnassign
+	if strings.EqualFold(DeleteMemberCascade, MemberCascadeKeep) {
+		memberCascade = MemberCascadeKeep
+	}
+
+	publicMaxAge = defaultPublicMaxAge
+	if n, err := strconv.Atoi(PublicAPIMaxAgeSeconds); err == nil && n >= 0 {
+		publicMaxAge = n
+	}
+
+	employeeCountReconcileInterval = defaultEmployeeCountReconcileInterval
+	if n, err := strconv.Atoi(EmployeeCountReconcileIntervalMinutes); err == nil && n >= 0 {
+		employeeCountReconcileInterval = time.Duration(n) * time.Minute
+	}
+}
+
 // This struct defines the DepartmentHandler which handles HTTP requests related to departments.
 // It contains a service field of type DepartmentService which is used to interact with the department data layer.
 type DepartmentHandler struct {
@@ -27,16 +97,164 @@ func NewDepartmentHandler(departmentService DepartmentService) *DepartmentHandle
 // @Tags         departments
 // @Accept       json
 // @Produce      json
+// @Param        archived  query     string  false  "Archived departments: exclude (default), include or only"
+// @Param        tag       query     []string  false  "Only departments with all the given tags (repeatable)"
+// @Param        asOf      query     string  false  "Only departments that existed at the given time (RFC 3339 or YYYY-MM-DD), with their name then"
+// @Param        limit     query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page      query     int     false  "Page number for the offset pagination"
+// @Param        after     query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Param        fields    query     string  false  "Comma-separated fields to return (e.g. id,deptName)"
 // @Success      200  {array}   HttpResponse for successful retrieval
+// @Failure      400  {object}  HttpResponse for bad request
 // @Failure      500  {object}  HttpResponse for internal server error
 // @Router       /departments [get]
 func (h *DepartmentHandler) GetAllDepartments(c *gin.Context) {
-	departments, err := h.Service.GetAllDepartments(c.Request.Context())
+	// Parse the listing filter from the query string
+	filter, err := parseDepartmentFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	// Parse the pagination from the query string
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	// Parse the sparse fieldset from the query string
+	fields, err := util.ParseFields(c, Department{})
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid fields", err.Error())
+		return
+	}
+
+	departments, meta, err := h.Service.GetAllDepartments(c.Request.Context(), filter, page)
+	if util.JSONAppError(c, "Failed to retrieve departments", err) {
+		return
+	}
 	if err != nil {
 		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve departments", err.Error())
 		return
 	}
 
+	// Trim the departments to the requested fields
+	data, err := util.SelectFields(departments, fields)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve departments", err.Error())
+		return
+	}
+
+	// Link the listing to its pages and related collections
+	links := util.Links{
+		"self":  util.SelfLink(c),
+		"count": c.Request.URL.Path + "/count",
+		"tags":  c.Request.URL.Path + "/tags",
+	}
+	if meta != nil {
+		maps.Copy(links, pagination.Links(c, meta))
+		util.JSONSuccessWithLinks(c, http.StatusOK, "All Departments retrieved successfully", data, meta, links)
+		return
+	}
+
+	util.JSONSuccessWithLinks(c, http.StatusOK, "All Departments retrieved successfully", data, nil, links)
+}
+
+// ExportDepartments exports the departments matching the listing filter as a CSV file.
+// The locale selects the language of the header and the default delimiter and date format, which can be overridden.
+// @Summary      Export departments as CSV
+// @Description  Export the departments as a CSV file, localized for spreadsheets
+// @Tags         departments
+// @Produce      text/csv
+// @Param        archived    query  string    false  "Archived departments: exclude (default), include or only"
+// @Param        tag         query  []string  false  "Only departments with all the given tags (repeatable)"
+// @Param        locale      query  string    false  "Locale of the header, booleans and defaults (e.g. de-DE), en by default"
+// @Param        delimiter   query  string    false  "comma, semicolon, tab or pipe (default of the locale)"
+// @Param        encoding    query  string    false  "utf-8 (default) or utf-8-bom for Excel"
+// @Param        dateFormat  query  string    false  "rfc3339, iso, date, eu, de, nl or us (default of the locale), in UTC"
+// @Param        limit       query  int       false  "Page size (1-100), enables the pagination"
+// @Param        page        query  int       false  "Page number for the offset pagination"
+// @Success      200  {file}    file      "CSV file"
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/export [get]
+func (h *DepartmentHandler) ExportDepartments(c *gin.Context) {
+	// Parse the listing filter from the query string
+	filter, err := parseDepartmentFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	// Parse the pagination from the query string, the exports beyond the hard cap are split in pages
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	// Parse the format of the file from the query string
+	opts, err := export.NewOptions(c.Query("locale"), c.Query("delimiter"), c.Query("encoding"), c.Query("dateFormat"))
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid export options", err.Error())
+		return
+	}
+
+	departments, _, err := h.Service.GetAllDepartments(c.Request.Context(), filter, page)
+	if util.JSONAppError(c, "Failed to export departments", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to export departments", err.Error())
+		return
+	}
+
+	// The departments are loaded before the response starts, so a failure is still reported as JSON
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="departments.csv"`)
+	c.Status(http.StatusOK)
+	if err := WriteDepartmentsCSV(c.Writer, departments, opts); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the department export: %v", err))
+	}
+}
+
+// GetPublicDepartments returns the public projection (id, name, active) of the departments that are not archived.
+// It is served without authentication, so the response carries no links to the authenticated API.
+// The clients may cache it for PUBLIC_API_MAX_AGE_SECONDS and revalidate it with its ETag.
+// @Summary      Get the public department directory
+// @Description  Get the ID, name and status of the departments, without authentication
+// @Tags         public
+// @Produce      json
+// @Param        If-None-Match  header  string  false  "ETag of a cached listing"
+// @Success      200  {array}   HttpResponse for successful retrieval
+// @Success      304  "the cached listing is still current"
+// @Failure      429  {object}  HttpResponse for too many requests
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /public/v1/departments [get]
+func (h *DepartmentHandler) GetPublicDepartments(c *gin.Context) {
+	departments, err := h.Service.GetPublicDepartments(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve departments", err.Error())
+		return
+	}
+
+	// Tag the listing with the hash of its content, so the clients revalidate it cheaply
+	body, err := jsoncodec.Marshal(departments)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve departments", err.Error())
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", publicMaxAge))
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	util.JSONSuccess(c, http.StatusOK, "All Departments retrieved successfully", departments)
 }
 
@@ -47,6 +265,7 @@ func (h *DepartmentHandler) GetAllDepartments(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id   path      string  true  "Department ID"
+// @Param        fields query   string  false "Comma-separated fields to return (e.g. id,deptName)"
 // @Success      200  {object}  HttpResponse for successful retrieval
 // @Failure      400  {object}  HttpResponse for bad request
 // @Failure      404  {object}  HttpResponse for not found
@@ -60,8 +279,18 @@ func (h *DepartmentHandler) GetDepartmentByID(c *gin.Context) {
 		return
 	}
 
+	// Parse the sparse fieldset from the query string
+	fields, err := util.ParseFields(c, Department{})
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid fields", err.Error())
+		return
+	}
+
 	// Retrieve the department by ID from the service
 	department, err := h.Service.GetDepartmentByID(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to retrieve department", err) {
+		return
+	}
 	if err != nil {
 		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve department", err.Error())
 		return
@@ -72,9 +301,104 @@ func (h *DepartmentHandler) GetDepartmentByID(c *gin.Context) {
 		return
 	}
 
+	// Trim the department to the requested fields
+	data, err := util.SelectFields(department, fields)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve department", err.Error())
+		return
+	}
+
+	links := departmentLinks(path.Dir(c.Request.URL.Path), department)
+	util.JSONSuccessWithLinks(c, http.StatusOK, "Department retrieved successfully", data, nil, links)
+}
+
+// GetDepartmentByName retrieves a department by its name (case-insensitive) and returns it as JSON.
+// @Summary      Get department by name
+// @Description  Get a department by its name, compared case-insensitively
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        name path      string  true  "Department name"
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for not found
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/by-name/{name} [get]
+func (h *DepartmentHandler) GetDepartmentByName(c *gin.Context) {
+	// Parse the name from the URL parameter
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		util.JSONError(c, http.StatusBadRequest, "Invalid name", "Name cannot be empty")
+		return
+	}
+
+	// Retrieve the department by name from the service
+	department, err := h.Service.GetDepartmentByName(c.Request.Context(), name)
+	if util.JSONAppError(c, "Failed to retrieve department", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve department", err.Error())
+		return
+	}
+
 	util.JSONSuccess(c, http.StatusOK, "Department retrieved successfully", department)
 }
 
+// CountDepartments counts the departments matching the listing filters and returns the count as JSON.
+// @Summary      Count departments
+// @Description  Count the departments with the same filters as the list endpoint
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        archived  query     string  false  "Archived departments: exclude (default), include or only"
+// @Param        tag       query     []string  false  "Only departments with all the given tags (repeatable)"
+// @Param        asOf      query     string  false  "Only departments that existed at the given time (RFC 3339 or YYYY-MM-DD), with their name then"
+// @Success      200  {object}  HttpResponse for successful count
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/count [get]
+func (h *DepartmentHandler) CountDepartments(c *gin.Context) {
+	// Parse the listing filter from the query string
+	filter, err := parseDepartmentFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	count, err := h.Service.CountDepartments(c.Request.Context(), filter)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to count departments", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Departments counted successfully", CountResponse{Count: count})
+}
+
+// DepartmentExists checks if a department exists without returning a body.
+// @Summary      Check department existence
+// @Description  Check if a department exists by its ID; the response has no body
+// @Tags         departments
+// @Param        id   path      string  true  "Department ID"
+// @Success      200  "Department exists"
+// @Failure      404  "Department not found"
+// @Failure      500  "Internal server error"
+// @Router       /departments/{id} [head]
+func (h *DepartmentHandler) DepartmentExists(c *gin.Context) {
+	exists, err := h.Service.DepartmentExists(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 // CreateDepartment creates a new department in the database and returns it as JSON.
 // @Summary      Create a new department
 // @Description  Create a new department in the database
@@ -84,6 +408,8 @@ func (h *DepartmentHandler) GetDepartmentByID(c *gin.Context) {
 // @Param        department  body      Department  true  "Department object"
 // @Success      201  {object}  HttpResponse for successful creation
 // @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for conflict, with the conflicting department and similar names
+// @Failure      422  {object}  HttpResponse for a department beyond the quota, with the maximum and the count
 // @Failure      500  {object}  HttpResponse for internal server error
 // @Router       /departments [post]
 func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
@@ -105,11 +431,30 @@ func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
 			return
 		}
 
+		// A conflict carries the existing department and the similar names
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			util.JSONAppErrorWithData(c, "Failed to create department", conflict, conflict.DepartmentConflict)
+			return
+		}
+
+		// A refusal by the quota carries the maximum and the current count
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			util.JSONAppErrorWithData(c, "Failed to create department", exceeded, exceeded.Exceeded)
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to create department", err) {
+			return
+		}
+
 		util.JSONError(c, http.StatusInternalServerError, "Failed to create department", err.Error())
 		return
 	}
 
-	util.JSONSuccess(c, http.StatusCreated, "Department created successfully", createdDepartment)
+	links := departmentLinks(c.Request.URL.Path, createdDepartment)
+	util.JSONSuccessWithLinks(c, http.StatusCreated, "Department created successfully", createdDepartment, nil, links)
 }
 
 // UpdateDepartment updates an existing department in the database and returns it as JSON.
@@ -151,6 +496,11 @@ func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 			return
 		}
 
+		// Typed errors (e.g. not found, archived) carry their own status
+		if util.JSONAppError(c, "Failed to update department", err) {
+			return
+		}
+
 		util.JSONError(c, http.StatusInternalServerError, "Failed to update department", err.Error())
 		return
 	}
@@ -165,19 +515,42 @@ func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 }
 
 // DeleteDepartment deletes a department by its ID from the database.
+// A department with active members is refused with their count and the link transferring them,
+// unless force=true applies the DEPARTMENT_DELETE_CASCADE policy to them.
 // @Summary      Delete a department
 // @Description  Delete a department by its ID from the database
 // @Tags         departments
 // @Accept       json
 // @Produce      json
-// @Param        id  path      string  true  "Department ID"
+// @Param        id     path      string  true   "Department ID"
+// @Param        force  query     bool    false  "Delete the department even with active members"
 // @Success      200  {object}  HttpResponse for successful deletion
+// @Failure      400  {object}  HttpResponse for bad request
 // @Failure      404  {object}  HttpResponse for not found
+// @Failure      409  {object}  HttpResponse for a department with active members, with their count
 // @Failure      500  {object}  HttpResponse for internal server error
 // @Router       /departments/{id} [delete]
 func (h *DepartmentHandler) DeleteDepartment(c *gin.Context) {
 	id := c.Param("id")
-	f, err := h.Service.DeleteDepartment(c.Request.Context(), id)
+	force, err := strconv.ParseBool(c.DefaultQuery("force", "false"))
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid force", "force must be true or false")
+		return
+	}
+
+	f, err := h.Service.DeleteDepartment(c.Request.Context(), id, force)
+	var members *MembersError
+	if errors.As(err, &members) {
+		// The members are moved with the transfer endpoint of the users, next to the departments
+		base, _, _ := strings.Cut(c.Request.URL.Path, "/departments/")
+		data := members.DepartmentMembers
+		data.Links = util.Links{"transfer": base + "/users/transfer"}
+		util.JSONAppErrorWithData(c, "Failed to delete department", members, data)
+		return
+	}
+	if util.JSONAppError(c, "Failed to delete department", err) {
+		return
+	}
 	if err != nil {
 		util.JSONError(c, http.StatusInternalServerError, "Failed to delete department", err.Error())
 		return
@@ -190,3 +563,529 @@ func (h *DepartmentHandler) DeleteDepartment(c *gin.Context) {
 
 	util.JSONSuccess(c, http.StatusOK, "Department deleted successfully", nil)
 }
+
+// ArchiveDepartment archives a department by its ID and returns it as JSON.
+// @Summary      Archive a department
+// @Description  Archive a department; archived departments are read-only and hidden from listings by default
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Department ID"
+// @Success      200  {object}  HttpResponse for successful archiving
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for already archived department
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/archive [post]
+func (h *DepartmentHandler) ArchiveDepartment(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id := c.Param("id")
+	if id == "" {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID", "ID cannot be empty")
+		return
+	}
+
+	// Archive the department using the service
+	archivedDepartment, err := h.Service.ArchiveDepartment(c.Request.Context(), id)
+	if err != nil {
+		if util.JSONAppError(c, "Failed to archive department", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to archive department", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department archived successfully", archivedDepartment)
+}
+
+// UnarchiveDepartment restores an archived department by its ID and returns it as JSON.
+// @Summary      Unarchive a department
+// @Description  Restore an archived department so it can be updated again
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Department ID"
+// @Success      200  {object}  HttpResponse for successful unarchiving
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for department not archived
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/unarchive [post]
+func (h *DepartmentHandler) UnarchiveDepartment(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id := c.Param("id")
+	if id == "" {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID", "ID cannot be empty")
+		return
+	}
+
+	// Unarchive the department using the service
+	unarchivedDepartment, err := h.Service.UnarchiveDepartment(c.Request.Context(), id)
+	if err != nil {
+		if util.JSONAppError(c, "Failed to unarchive department", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to unarchive department", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department unarchived successfully", unarchivedDepartment)
+}
+
+// ClaimDepartment marks a department as managed by the automation identity of the request and returns it as JSON.
+// @Summary      Claim a department
+// @Description  Mark a department as managed by the calling automation (API key); its manual changes are then rejected or flagged
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id         path      string  true  "Department ID"
+// @Param        X-API-Key  header    string  true  "API key of the automation identity"
+// @Success      200  {object}  HttpResponse for successful claim
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      403  {object}  HttpResponse for a caller that is not an automation
+// @Failure      404  {object}  HttpResponse for department not found
+// @Failure      409  {object}  HttpResponse for department managed by another automation
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/claim [post]
+func (h *DepartmentHandler) ClaimDepartment(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id := c.Param("id")
+	if id == "" {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID", "ID cannot be empty")
+		return
+	}
+
+	// Claim the department using the service
+	claimedDepartment, err := h.Service.ClaimDepartment(c.Request.Context(), id)
+	if err != nil {
+		if util.JSONAppError(c, "Failed to claim department", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to claim department", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department claimed successfully", claimedDepartment)
+}
+
+// ReleaseDepartment gives a managed department back to the manual changes and returns it as JSON.
+// @Summary      Release a department
+// @Description  Stop managing a department, by the managing automation or by an administrator
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Department ID"
+// @Success      200  {object}  HttpResponse for successful release
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for department not found
+// @Failure      409  {object}  HttpResponse for department not managed or managed by another automation
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/claim [delete]
+func (h *DepartmentHandler) ReleaseDepartment(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id := c.Param("id")
+	if id == "" {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID", "ID cannot be empty")
+		return
+	}
+
+	// Release the department using the service
+	releasedDepartment, err := h.Service.ReleaseDepartment(c.Request.Context(), id)
+	if err != nil {
+		if util.JSONAppError(c, "Failed to release department", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to release department", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department released successfully", releasedDepartment)
+}
+
+// GetDepartmentNames retrieves the names a department had and returns them as JSON.
+// @Summary      Get the name history of a department
+// @Description  Get the names of a department, oldest first, with the period during which each was used
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Department ID"
+// @Success      200  {array}   HttpResponse for successful retrieval
+// @Failure      404  {object}  HttpResponse for not found
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/names [get]
+func (h *DepartmentHandler) GetDepartmentNames(c *gin.Context) {
+	// Retrieve the name history of the department from the service
+	names, err := h.Service.GetDepartmentNames(c.Request.Context(), c.Param("id"))
+	if util.JSONAppError(c, "Failed to retrieve department names", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve department names", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department names retrieved successfully", names)
+}
+
+// BulkUpdateStatus activates or deactivates several departments in one transaction and returns the result as JSON.
+// @Summary      Activate or deactivate several departments
+// @Description  Set the active flag of the given departments in one transaction, nothing is changed if one of them is missing or archived
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        request  body      BulkStatusRequest  true  "Department IDs and status"
+// @Success      200  {object}  HttpResponse for successful update
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for not found
+// @Failure      409  {object}  HttpResponse for archived department
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/bulk-status [post]
+func (h *DepartmentHandler) BulkUpdateStatus(c *gin.Context) {
+	// Bind the JSON request body to the BulkStatusRequest struct
+	var req BulkStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Update the status of the departments using the service
+	result, err := h.Service.BulkUpdateStatus(c.Request.Context(), req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to update the status of departments", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to update the status of departments", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to update the status of departments", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department status updated successfully", result)
+}
+
+// BulkDeleteDepartments soft-deletes the departments matching a filter expression, in two calls.
+// With dryRun=true it counts the matching departments and returns a confirm token; given back with confirm,
+// the token queues the job deleting them in batches, whose progress is read at /api/v1/jobs/:id.
+// @Summary      Delete the departments matching a filter
+// @Description  Dry-run then soft-delete the departments matching the filter, in batches run by a background job
+// @Tags         departments
+// @Produce      json
+// @Param        filter         query  string  false  "Filter expression, e.g. active:false,tag:legacy,archived:include"
+// @Param        createdBefore  query  string  false  "Only the departments created before this RFC 3339 time or YYYY-MM-DD date"
+// @Param        dryRun         query  bool    false  "Count the matching departments and issue the confirm token"
+// @Param        confirm        query  string  false  "Confirm token of the dry run"
+// @Success      200  {object}  HttpResponse for the dry run
+// @Success      202  {object}  HttpResponse for the queued job
+// @Failure      400  {object}  HttpResponse for invalid filter or confirm token
+// @Failure      409  {object}  HttpResponse for a filter matching more departments than its dry run
+// @Failure      503  {object}  HttpResponse for full job queue
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments [delete]
+func (h *DepartmentHandler) BulkDeleteDepartments(c *gin.Context) {
+	// Parse the filter expression from the query string
+	filter, err := parseBulkDeleteFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid dryRun", "dryRun must be true or false")
+		return
+	}
+
+	if dryRun {
+		preview, err := h.Service.PreviewBulkDelete(c.Request.Context(), filter)
+		if util.JSONAppError(c, "Failed to preview the bulk delete", err) {
+			return
+		}
+		if err != nil {
+			util.JSONError(c, http.StatusInternalServerError, "Failed to preview the bulk delete", err.Error())
+			return
+		}
+
+		// The token confirms a delete, it must not be kept by the caches
+		c.Header("Cache-Control", "no-store")
+		util.JSONSuccess(c, http.StatusOK, "Dry run of the bulk delete, confirm it with the token", preview)
+		return
+	}
+
+	job, err := h.Service.BulkDelete(c.Request.Context(), filter, c.Query("confirm"))
+	if util.JSONAppError(c, "Failed to delete departments", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to delete departments", err.Error())
+		return
+	}
+
+	// The progress of the job is read next to the departments
+	jobPath := strings.TrimSuffix(c.Request.URL.Path, "/departments") + "/jobs/" + job.ID
+	c.Header("Location", jobPath)
+	util.JSONSuccessWithLinks(c, http.StatusAccepted, "Bulk delete queued", job, nil, util.Links{"job": jobPath})
+}
+
+// GetAllTags retrieves the tags in use and returns them as JSON.
+// @Summary      Get all department tags
+// @Description  Get the tags in use with the number of departments labeled with each of them
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   HttpResponse for successful retrieval
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/tags [get]
+func (h *DepartmentHandler) GetAllTags(c *gin.Context) {
+	tags, err := h.Service.GetAllTags(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve tags", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "All Tags retrieved successfully", tags)
+}
+
+// SetDepartmentTags replaces the tags of a department and returns it as JSON.
+// @Summary      Replace the tags of a department
+// @Description  Replace the tags of a department
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string       true  "Department ID"
+// @Param        tags  body      TagsRequest  true  "Tags"
+// @Success      200  {object}  HttpResponse for successful update
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for archived department
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/tags [put]
+func (h *DepartmentHandler) SetDepartmentTags(c *gin.Context) {
+	h.updateTags(c, h.Service.SetDepartmentTags)
+}
+
+// AddDepartmentTags adds tags to a department and returns it as JSON.
+// @Summary      Add tags to a department
+// @Description  Add tags to a department, the existing tags are kept
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string       true  "Department ID"
+// @Param        tags  body      TagsRequest  true  "Tags"
+// @Success      200  {object}  HttpResponse for successful update
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for archived department
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/tags [post]
+func (h *DepartmentHandler) AddDepartmentTags(c *gin.Context) {
+	h.updateTags(c, h.Service.AddDepartmentTags)
+}
+
+// RemoveDepartmentTag removes a tag from a department and returns it as JSON.
+// @Summary      Remove a tag from a department
+// @Description  Remove a tag from a department
+// @Tags         departments
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Department ID"
+// @Param        tag  path      string  true  "Tag"
+// @Success      200  {object}  HttpResponse for successful update
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      409  {object}  HttpResponse for archived department
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /departments/{id}/tags/{tag} [delete]
+func (h *DepartmentHandler) RemoveDepartmentTag(c *gin.Context) {
+	department, err := h.Service.RemoveDepartmentTag(c.Request.Context(), c.Param("id"), c.Param("tag"))
+	if err != nil {
+		h.handleTagsError(c, err)
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department tags updated successfully", department)
+}
+
+// updateTags binds the tags request and applies it with the given service method.
+func (h *DepartmentHandler) updateTags(c *gin.Context, apply func(ctx context.Context, id string, tags []string) (Department, error)) {
+	// Bind the JSON request body to the TagsRequest struct
+	var req TagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	department, err := apply(c.Request.Context(), c.Param("id"), req.Tags)
+	if err != nil {
+		h.handleTagsError(c, err)
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Department tags updated successfully", department)
+}
+
+// handleTagsError maps the errors of the tag management to HTTP responses.
+func (h *DepartmentHandler) handleTagsError(c *gin.Context, err error) {
+	// Check if the error is a validation error
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		util.JSONErrorMap(c, http.StatusBadRequest, "Failed to update department tags", util.FormatValidationErrors(err))
+		return
+	}
+
+	// Typed errors (e.g. not found, archived) carry their own status
+	if util.JSONAppError(c, "Failed to update department tags", err) {
+		return
+	}
+
+	util.JSONError(c, http.StatusInternalServerError, "Failed to update department tags", err.Error())
+}
+
+// departmentLinks builds the links of a department and of its related sub-resources.
+// The archive link is replaced by the unarchive link once the department is archived.
+func departmentLinks(collection string, department Department) util.Links {
+	self := util.ResourceLink(collection, department.ID)
+	links := util.Links{
+		"self":       self,
+		"collection": collection,
+		"tags":       self + "/tags",
+		"names":      self + "/names",
+	}
+
+	if department.IsArchived() {
+		links["unarchive"] = self + "/unarchive"
+	} else {
+		links["archive"] = self + "/archive"
+	}
+
+	return links
+}
+
+// parseDepartmentFilter parses the listing filter from the query string.
+// Tags can be repeated (?tag=a&tag=b) or comma-separated (?tag=a,b).
+// Metadata values are matched exactly (?metadata.region=emea&metadata.costCenter=cc-12).
+func parseDepartmentFilter(c *gin.Context) (DepartmentFilter, error) {
+	filter := DepartmentFilter{Archived: c.DefaultQuery("archived", ArchivedExclude)}
+	if !IsValidArchivedFilter(filter.Archived) {
+		return DepartmentFilter{}, errors.New("archived must be one of: exclude, include, only")
+	}
+
+	var tags []string
+	for _, value := range c.QueryArray("tag") {
+		tags = append(tags, strings.Split(value, ",")...)
+	}
+	filter.Tags = NormalizeTags(tags)
+
+	// Metadata filters are given as "metadata.<key>=<value>"
+	for param, values := range c.Request.URL.Query() {
+		key, ok := strings.CutPrefix(param, "metadata.")
+		if !ok {
+			continue
+		}
+		if !validate.MetadataKeyPattern.MatchString(key) {
+			return DepartmentFilter{}, fmt.Errorf("invalid metadata key: %s", key)
+		}
+		if len(values) > 1 {
+			return DepartmentFilter{}, fmt.Errorf("metadata.%s must be given once", key)
+		}
+
+		if filter.Metadata == nil {
+			filter.Metadata = map[string]string{}
+		}
+		filter.Metadata[key] = values[0]
+	}
+
+	// The point in time is given as RFC 3339 or as a date, which means the end of that day (UTC)
+	if asOf := c.Query("asOf"); asOf != "" {
+		t, err := parseAsOf(asOf)
+		if err != nil {
+			return DepartmentFilter{}, err
+		}
+		filter.AsOf = &t
+	}
+
+	return filter, nil
+}
+
+// parseBulkDeleteFilter parses the filter of a bulk delete from the query string.
+// The filter expression is a comma-separated list of "<field>:<value>" terms: active:<true|false>,
+// tag:<tag> (repeatable) and archived:<exclude|include|only>; createdBefore is given as its own parameter.
+func parseBulkDeleteFilter(c *gin.Context) (BulkDeleteFilter, error) {
+	filter := BulkDeleteFilter{Archived: ArchivedExclude}
+
+	var tags []string
+	for _, expression := range c.QueryArray("filter") {
+		for _, term := range strings.Split(expression, ",") {
+			if term = strings.TrimSpace(term); term == "" {
+				continue
+			}
+
+			field, value, ok := strings.Cut(term, ":")
+			if !ok || value == "" {
+				return BulkDeleteFilter{}, fmt.Errorf("invalid filter term %q, expected <field>:<value>", term)
+			}
+
+			switch field {
+			case "active":
+				active, err := strconv.ParseBool(value)
+				if err != nil {
+					return BulkDeleteFilter{}, errors.New("active must be true or false")
+				}
+				if filter.Active != nil && *filter.Active != active {
+					return BulkDeleteFilter{}, errors.New("active must be given once")
+				}
+				filter.Active = &active
+			case "tag":
+				tags = append(tags, value)
+			case "archived":
+				if !IsValidArchivedFilter(value) {
+					return BulkDeleteFilter{}, errors.New("archived must be one of: exclude, include, only")
+				}
+				filter.Archived = value
+			default:
+				return BulkDeleteFilter{}, fmt.Errorf("unknown filter field %q, expected one of: active, tag, archived", field)
+			}
+		}
+	}
+	filter.Tags = NormalizeTags(tags)
+	for _, tag := range filter.Tags {
+		if !validate.SlugPattern.MatchString(tag) {
+			return BulkDeleteFilter{}, fmt.Errorf("invalid tag: %s", tag)
+		}
+	}
+
+	// The time is given as RFC 3339 or as a date, which means the start of that day (UTC)
+	if createdBefore := c.Query("createdBefore"); createdBefore != "" {
+		t, err := time.Parse(time.RFC3339, createdBefore)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, createdBefore); err != nil {
+				return BulkDeleteFilter{}, errors.New("createdBefore must be an RFC 3339 time or a YYYY-MM-DD date")
+			}
+		}
+		filter.CreatedBefore = &t
+	}
+
+	if filter.IsEmpty() {
+		return BulkDeleteFilter{}, errors.New("the filter must select some departments: give active, tag, archived:only or createdBefore")
+	}
+
+	return filter, nil
+}
+
+// parseAsOf parses the "asOf" query parameter.
+func parseAsOf(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("asOf must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+
+	return day.Add(24*time.Hour - time.Microsecond), nil
+}
@@ -0,0 +1,92 @@
+package department
+
+import (
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Operations documents the department handlers in the OpenAPI spec, keyed by handler method name.
+// The errors listed here are the typed errors returned by the service for each operation.
+var Operations = map[string]openapi.Operation{
+	"GetAllDepartments": {Summary: "List departments"},
+	"CountDepartments":  {Summary: "Count departments"},
+	"GetAllTags":        {Summary: "List the tags in use"},
+	"ExportDepartments": {Summary: "Export departments as CSV"},
+	"GetPublicDepartments": {
+		Summary: "Get the public department directory",
+	},
+	"GetDepartmentByID": {
+		Summary: "Get department by ID",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound},
+		Example: "department",
+	},
+	"GetDepartmentNames": {
+		Summary: "Get the name history of a department",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound},
+	},
+	"GetDepartmentByName": {
+		Summary: "Get department by name",
+		Errors:  []*apperror.Error{ErrDepartmentNameNotFound},
+		Example: "department",
+	},
+	"CreateDepartment": {
+		Summary:       "Create a new department",
+		RequestSchema: "department",
+		SuccessStatus: http.StatusCreated,
+		Errors:        []*apperror.Error{ErrDepartmentConflict, ErrDepartmentNameConflict, ErrDepartmentOutOfScope, ErrDepartmentQuotaExceeded},
+		Example:       "department",
+	},
+	"UpdateDepartment": {
+		Summary:       "Update a department",
+		RequestSchema: "department-update",
+		Errors:        []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+		Example:       "department-update",
+	},
+	"DeleteDepartment": {
+		Summary: "Delete a department",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentManaged, ErrDepartmentOutOfScope, ErrDepartmentHasMembers},
+	},
+	"ArchiveDepartment": {
+		Summary: "Archive a department",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+	},
+	"UnarchiveDepartment": {
+		Summary: "Unarchive a department",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentNotArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+	},
+	"ClaimDepartment": {
+		Summary: "Claim a department for an automation",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentManaged, ErrClaimRequiresAPIKey, ErrDepartmentOutOfScope},
+	},
+	"ReleaseDepartment": {
+		Summary: "Release a managed department",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentManaged, ErrDepartmentNotManaged, ErrDepartmentOutOfScope},
+	},
+	"SetDepartmentTags": {
+		Summary:       "Replace the tags of a department",
+		RequestSchema: "department-tags",
+		Errors:        []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+	},
+	"AddDepartmentTags": {
+		Summary:       "Add tags to a department",
+		RequestSchema: "department-tags",
+		Errors:        []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+	},
+	"RemoveDepartmentTag": {
+		Summary: "Remove a tag from a department",
+		Errors:  []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+	},
+	"BulkDeleteDepartments": {
+		Summary:       "Delete the departments matching a filter, after a dry run",
+		SuccessStatus: http.StatusAccepted,
+		Errors:        []*apperror.Error{ErrBulkDeleteUnfiltered, ErrInvalidConfirmToken, ErrBulkDeleteChanged, jobs.ErrQueueFull, jobs.ErrQueueClosed},
+	},
+	"BulkUpdateStatus": {
+		Summary:       "Activate or deactivate several departments",
+		RequestSchema: "department-status",
+		Errors:        []*apperror.Error{ErrDepartmentNotFound, ErrDepartmentArchived, ErrDepartmentManaged, ErrDepartmentOutOfScope},
+	},
+}
@@ -2,20 +2,47 @@ package department
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
 	"gorm.io/gorm" // Import GORM for ORM functionalities
+	"gorm.io/gorm/clause"
 )
 
+// ErrDepartmentNameNotFound is returned when no department has the given name.
+var ErrDepartmentNameNotFound = apperror.New("DepartmentNameNotFound", http.StatusNotFound, "department with the given name not found")
+
 // Interface for department repository
 // This interface defines the methods that the department repository should implement
 type DepartmentRepository interface {
-	GetAllDepartments(tx *gorm.DB) ([]Department, error)
+	GetAllDepartments(tx *gorm.DB, filter DepartmentFilter, page pagination.Params) ([]Department, error)
+	CountDepartments(tx *gorm.DB, filter DepartmentFilter) (int64, error)
+	GetPublicDepartments(tx *gorm.DB) ([]PublicDepartment, error)
+	GetAllTags(tx *gorm.DB) ([]TagCount, error)
+	ExistsDepartment(tx *gorm.DB, id string) (bool, error)
 	GetDepartmentByID(tx *gorm.DB, id string) (Department, error)
 	GetDepartmentByName(tx *gorm.DB, name string) (Department, error)
+	GetDepartmentsByIDsForUpdate(tx *gorm.DB, ids []string) ([]Department, error)
+	GetDepartmentNameCandidates(tx *gorm.DB) ([]DepartmentSuggestion, error)
 	CreateDepartment(ctx context.Context, tx *gorm.DB, d Department) (Department, error)
 	UpdateDepartment(ctx context.Context, tx *gorm.DB, d Department) (Department, error)
 	DeleteDepartment(ctx context.Context, tx *gorm.DB, d Department, deletedBy *int64) error
+	CreateDepartmentVersion(ctx context.Context, tx *gorm.DB, v DepartmentVersion) error
+	GetDepartmentVersionsAsOf(tx *gorm.DB, ids []string, asOf time.Time) ([]DepartmentVersion, error)
+	GetDepartmentVersions(tx *gorm.DB, id string) ([]DepartmentVersion, error)
+	AdjustEmployeeCount(ctx context.Context, tx *gorm.DB, id string, delta int64) error
+	CountEmployees(tx *gorm.DB, id string) (int64, error)
+	UnassignEmployees(ctx context.Context, tx *gorm.DB, id string) (int64, error)
+	GetEmployeeCountDrifts(tx *gorm.DB) ([]EmployeeCountDrift, error)
+	CountBulkDelete(tx *gorm.DB, filter BulkDeleteFilter) (int64, error)
+	GetBulkDeleteIDs(tx *gorm.DB, filter BulkDeleteFilter, limit int) ([]string, error)
+	GetBulkDeleteBatchForUpdate(tx *gorm.DB, filter BulkDeleteFilter, afterID string, limit int) ([]Department, error)
 }
 
 // This struct defines the DepartmentRepository that contains methods for interacting with the database
@@ -29,9 +56,53 @@ func NewDepartmentRepository() DepartmentRepository {
 }
 
 // GetAllDepartments retrieves all departments from the database.
-func (r *departmentRepository) GetAllDepartments(tx *gorm.DB) ([]Department, error) {
+// The archived filter excludes the archived departments, includes them or returns only them.
+// When paginated, one extra department is returned to detect the next page.
+func (r *departmentRepository) GetAllDepartments(tx *gorm.DB, filter DepartmentFilter, page pagination.Params) ([]Department, error) {
+	var after any
+	if page.After != "" {
+		after = page.After
+	}
+
+	query, err := filterScope(tx, filter)
+	if err != nil {
+		return nil, err
+	}
+	query = pagination.Apply(query.Order("id ASC"), "id", page, after)
+
 	var departments []Department
-	err := tx.Order("id ASC").Find(&departments).Error
+	err = query.Find(&departments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return departments, nil
+}
+
+// CountDepartments counts the departments matching the filter.
+func (r *departmentRepository) CountDepartments(tx *gorm.DB, filter DepartmentFilter) (int64, error) {
+	query, err := filterScope(tx.Model(&Department{}), filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = query.Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetPublicDepartments retrieves the public projection of the departments that are not archived.
+// Only the projected columns are selected.
+func (r *departmentRepository) GetPublicDepartments(tx *gorm.DB) ([]PublicDepartment, error) {
+	var departments []PublicDepartment
+	err := archivedScope(tx.Model(&Department{}), ArchivedExclude).
+		Select("id, dept_name, active").
+		Order("id ASC").
+		Scan(&departments).Error
 	if err != nil {
 		return nil, err
 	}
@@ -39,13 +110,109 @@ func (r *departmentRepository) GetAllDepartments(tx *gorm.DB) ([]Department, err
 	return departments, nil
 }
 
+// GetAllTags retrieves the tags in use with the number of departments labeled with each of them.
+func (r *departmentRepository) GetAllTags(tx *gorm.DB) ([]TagCount, error) {
+	var tags []TagCount
+	err := tx.Model(&Department{}).
+		Select("tag, count(*) AS count").
+		Joins("CROSS JOIN LATERAL jsonb_array_elements_text(department.tags) AS tag").
+		Group("tag").
+		Order("tag ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ExistsDepartment checks if a department with the given ID exists without loading it.
+func (r *departmentRepository) ExistsDepartment(tx *gorm.DB, id string) (bool, error) {
+	var count int64
+	err := tx.Model(&Department{}).Where("lower(id) = lower(?)", id).Limit(1).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// filterScope applies the listing filter to a query.
+// The tags filter uses the jsonb containment operator, so the department must have all the given tags.
+// The metadata values are compared as text, so "?metadata.headcount=12" matches the number 12.
+func filterScope(tx *gorm.DB, filter DepartmentFilter) (*gorm.DB, error) {
+	if filter.AsOf != nil {
+		tx = asOfScope(tx, *filter.AsOf)
+	}
+
+	query := archivedScope(tx, filter.Archived)
+	if len(filter.Tags) > 0 {
+		tags, err := json.Marshal(filter.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("tags @> ?::jsonb", string(tags))
+	}
+
+	for key, value := range filter.Metadata {
+		query = query.Where("metadata ->> ? = ?", key, value)
+	}
+
+	return query, nil
+}
+
+// bulkDeleteScope applies the filter of a bulk delete to a query.
+func bulkDeleteScope(tx *gorm.DB, filter BulkDeleteFilter) (*gorm.DB, error) {
+	query := archivedScope(tx, filter.Archived)
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+	if len(filter.Tags) > 0 {
+		tags, err := json.Marshal(filter.Tags)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("tags @> ?::jsonb", string(tags))
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+
+	return query, nil
+}
+
+// asOfScope selects the departments that existed at the given time.
+// A department existed during its current validity period, or during one of its closed versions.
+// The deleted departments are included, their period ends when they were deleted. The departments
+// created before the validity periods were recorded start at their creation.
+func asOfScope(tx *gorm.DB, asOf time.Time) *gorm.DB {
+	return tx.Unscoped().Where(
+		"((COALESCE(department.valid_from, department.created_at) <= @asOf AND "+
+			"(COALESCE(department.valid_to, department.deleted_at) IS NULL OR COALESCE(department.valid_to, department.deleted_at) > @asOf)) OR "+
+			"EXISTS (SELECT 1 FROM department_name_history v WHERE v.department_id = department.id AND v.valid_from <= @asOf AND v.valid_to > @asOf))",
+		sql.Named("asOf", asOf),
+	)
+}
+
+// archivedScope applies the archived filter to a query.
+func archivedScope(tx *gorm.DB, archived string) *gorm.DB {
+	switch archived {
+	case ArchivedInclude:
+		return tx
+	case ArchivedOnly:
+		return tx.Where("status = ?", StatusArchived)
+	default:
+		return tx.Where("status <> ?", StatusArchived)
+	}
+}
+
 // It returns a slice of Department structs and an error if any occurs.
 func (r *departmentRepository) GetDepartmentByID(tx *gorm.DB, id string) (Department, error) {
 	var department Department
 	err := tx.First(&department, "lower(id) = lower(?)", id).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return Department{}, errors.New("department with the given ID not found")
+		return Department{}, ErrDepartmentNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -56,12 +223,13 @@ func (r *departmentRepository) GetDepartmentByID(tx *gorm.DB, id string) (Depart
 }
 
 // GetDepartmentByName retrieves a department by its name from the database.
+// The name is compared case-insensitively.
 func (r *departmentRepository) GetDepartmentByName(tx *gorm.DB, name string) (Department, error) {
 	var department Department
 	err := tx.First(&department, "lower(dept_name) = lower(?)", name).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return Department{}, errors.New("department with the given name not found")
+		return Department{}, ErrDepartmentNameNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -71,6 +239,41 @@ func (r *departmentRepository) GetDepartmentByName(tx *gorm.DB, name string) (De
 	return department, nil
 }
 
+// GetDepartmentNameCandidates retrieves the ID and name of the departments, archived ones included,
+// which the name suggestions are ranked from.
+func (r *departmentRepository) GetDepartmentNameCandidates(tx *gorm.DB) ([]DepartmentSuggestion, error) {
+	var candidates []DepartmentSuggestion
+	err := tx.Model(&Department{}).
+		Select("id, dept_name").
+		Order("id ASC").
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// GetDepartmentsByIDsForUpdate retrieves the departments with the given IDs and locks them until the end of the transaction.
+// The IDs are compared case-insensitively and the departments are returned ordered by ID.
+func (r *departmentRepository) GetDepartmentsByIDsForUpdate(tx *gorm.DB, ids []string) ([]Department, error) {
+	lowered := make([]string, len(ids))
+	for i, id := range ids {
+		lowered[i] = strings.ToLower(id)
+	}
+
+	var departments []Department
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("lower(id) IN ?", lowered).
+		Order("id ASC").
+		Find(&departments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return departments, nil
+}
+
 // CreateDepartment inserts a new department into the database and returns the created department.
 func (r *departmentRepository) CreateDepartment(ctx context.Context, tx *gorm.DB, d Department) (Department, error) {
 	// Insert new department
@@ -85,7 +288,8 @@ func (r *departmentRepository) CreateDepartment(ctx context.Context, tx *gorm.DB
 // It takes the department ID and the updated department struct as parameters.
 func (r *departmentRepository) UpdateDepartment(ctx context.Context, tx *gorm.DB, d Department) (Department, error) {
 	// Save the updated department
-	if err := tx.WithContext(ctx).Save(&d).Error; err != nil {
+	// The employee count is only changed with relative updates, a stale value read before is never written back
+	if err := tx.WithContext(ctx).Omit("employee_count").Save(&d).Error; err != nil {
 		return Department{}, err
 	}
 
@@ -99,8 +303,9 @@ func (r *departmentRepository) DeleteDepartment(ctx context.Context, tx *gorm.DB
 	d.DeletedBy = deletedBy
 
 	// Update the deleted_by field in the database
-	// This is done to keep track of who deleted the department
-	if err := tx.WithContext(ctx).Model(&d).Updates(Department{DeletedBy: deletedBy}).Error; err != nil {
+	// This is done to keep track of who deleted the department, whose validity period ends with the deletion
+	now := time.Now()
+	if err := tx.WithContext(ctx).Model(&d).Updates(Department{DeletedBy: deletedBy, ValidTo: &now}).Error; err != nil {
 		return err
 	}
 
@@ -111,3 +316,128 @@ func (r *departmentRepository) DeleteDepartment(ctx context.Context, tx *gorm.DB
 
 	return nil
 }
+
+// CountBulkDelete counts the departments matching the filter of a bulk delete.
+func (r *departmentRepository) CountBulkDelete(tx *gorm.DB, filter BulkDeleteFilter) (int64, error) {
+	query, err := bulkDeleteScope(tx.Model(&Department{}), filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetBulkDeleteIDs retrieves the IDs of the first departments matching the filter of a bulk delete.
+func (r *departmentRepository) GetBulkDeleteIDs(tx *gorm.DB, filter BulkDeleteFilter, limit int) ([]string, error) {
+	query, err := bulkDeleteScope(tx.Model(&Department{}), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	if err := query.Order("id ASC").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetBulkDeleteBatchForUpdate retrieves and locks the next batch of the departments matching the filter of a
+// bulk delete, after the given ID, so concurrent updates wait for the batch to be deleted.
+func (r *departmentRepository) GetBulkDeleteBatchForUpdate(tx *gorm.DB, filter BulkDeleteFilter, afterID string, limit int) ([]Department, error) {
+	query, err := bulkDeleteScope(tx.Clauses(clause.Locking{Strength: "UPDATE"}), filter)
+	if err != nil {
+		return nil, err
+	}
+	if afterID != "" {
+		query = query.Where("id > ?", afterID)
+	}
+
+	var departments []Department
+	if err := query.Order("id ASC").Limit(limit).Find(&departments).Error; err != nil {
+		return nil, err
+	}
+
+	return departments, nil
+}
+
+// CreateDepartmentVersion records a closed validity period of a department.
+func (r *departmentRepository) CreateDepartmentVersion(ctx context.Context, tx *gorm.DB, v DepartmentVersion) error {
+	return tx.WithContext(ctx).Create(&v).Error
+}
+
+// GetDepartmentVersionsAsOf retrieves the closed versions of the given departments that were valid at the given time.
+// The departments without such a version were valid in their current period.
+func (r *departmentRepository) GetDepartmentVersionsAsOf(tx *gorm.DB, ids []string, asOf time.Time) ([]DepartmentVersion, error) {
+	var versions []DepartmentVersion
+	err := tx.Where("department_id IN ? AND valid_from <= ? AND valid_to > ?", ids, asOf, asOf).Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// GetDepartmentVersions retrieves the closed versions of a department, oldest first.
+func (r *departmentRepository) GetDepartmentVersions(tx *gorm.DB, id string) ([]DepartmentVersion, error) {
+	var versions []DepartmentVersion
+	err := tx.Where("lower(department_id) = lower(?)", id).Order("valid_from ASC, id ASC").Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// AdjustEmployeeCount adds the delta to the employee count of a department.
+// The update is relative, so it does not lose the concurrent changes; the count never goes below zero.
+// It does not change updated_at, the count is not an attribute set by the users.
+func (r *departmentRepository) AdjustEmployeeCount(ctx context.Context, tx *gorm.DB, id string, delta int64) error {
+	return tx.WithContext(ctx).Model(&Department{}).
+		Where("id = ?", id).
+		UpdateColumn("employee_count", gorm.Expr("GREATEST(employee_count + ?, 0)", delta)).Error
+}
+
+// CountEmployees counts the users assigned to a department, the deleted users excluded.
+func (r *departmentRepository) CountEmployees(tx *gorm.DB, id string) (int64, error) {
+	var count int64
+	err := tx.Table("users").Where("department_id = ? AND deleted_at IS NULL", id).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// UnassignEmployees clears the department of the users assigned to it, the deleted users excluded,
+// and returns the number of users unassigned. The users are not marked as updated.
+func (r *departmentRepository) UnassignEmployees(ctx context.Context, tx *gorm.DB, id string) (int64, error) {
+	result := tx.WithContext(ctx).Table("users").Where("department_id = ? AND deleted_at IS NULL", id).UpdateColumn("department_id", nil)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// GetEmployeeCountDrifts retrieves the departments whose employee count does not match the number of their users.
+func (r *departmentRepository) GetEmployeeCountDrifts(tx *gorm.DB) ([]EmployeeCountDrift, error) {
+	var drifts []EmployeeCountDrift
+	err := tx.Raw("SELECT d.id AS department_id, d.employee_count AS recorded, COUNT(u.id) AS actual " +
+		"FROM department d LEFT JOIN users u ON u.department_id = d.id AND u.deleted_at IS NULL " +
+		"WHERE d.deleted_at IS NULL " +
+		"GROUP BY d.id, d.employee_count " +
+		"HAVING d.employee_count <> COUNT(u.id) " +
+		"ORDER BY d.id").
+		Scan(&drifts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return drifts, nil
+}
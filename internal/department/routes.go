@@ -0,0 +1,73 @@
+package department
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the department management routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Routes for department management
+	// These routes handle CRUD operations for departments
+	deptGroup := rg.Group("/departments")
+	{
+		// Apply rate limiting middleware to the /departments group.
+		// Configuration:
+		// - Allows up to 2 requests in quick succession (burst size = 2).
+		// - After that, only 1 new request is allowed every 5 seconds (refill rate).
+		// - Each client IP has its own limiter instance that expires after 10 minutes of inactivity.
+		deptGroup.Use(ratelimiter.RateLimiter(rate.Every(5*time.Second), 2, 10*time.Minute))
+
+		// Initialize the department repository and service
+		// This is where the actual implementation of the repository and service would be used
+		repo := NewDepartmentRepository()
+		service := NewDepartmentService(repo)
+
+		// Initialize the department handler with the service
+		// This handler handles the HTTP requests and responses for department-related operations
+		handler := NewDepartmentHandler(service)
+
+		// The deletions require a recent authentication
+		recentAuth := authorization.RequireRecentAuth(authorization.RecentAuthMaxAge())
+
+		// Define the routes for department management
+		// These routes handle CRUD operations for departments
+		deptGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetAllDepartments)
+		deptGroup.GET("/count", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.CountDepartments)
+		deptGroup.GET("/tags", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetAllTags)
+		deptGroup.GET("/export", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.ExportDepartments)
+		deptGroup.GET("/by-name/:name", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetDepartmentByName)
+		deptGroup.GET("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetDepartmentByID)
+		deptGroup.GET("/:id/names", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetDepartmentNames)
+		deptGroup.HEAD("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.DepartmentExists)
+		deptGroup.POST("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("department"), handler.CreateDepartment)
+		deptGroup.PUT("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("department-update"), handler.UpdateDepartment)
+		deptGroup.DELETE("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), recentAuth, handler.DeleteDepartment)
+		deptGroup.POST("/:id/archive", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.ArchiveDepartment)
+		deptGroup.POST("/:id/unarchive", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.UnarchiveDepartment)
+		deptGroup.POST("/:id/claim", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.ClaimDepartment)
+		deptGroup.DELETE("/:id/claim", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.ReleaseDepartment)
+		deptGroup.PUT("/:id/tags", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("department-tags"), handler.SetDepartmentTags)
+		deptGroup.POST("/:id/tags", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("department-tags"), handler.AddDepartmentTags)
+		deptGroup.POST("/bulk-status", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.StatementTimeout(dbtimeout.Import, dbtimeout.Import), deps.Validate("department-status"), handler.BulkUpdateStatus)
+		deptGroup.DELETE("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), recentAuth, deps.StatementTimeout(dbtimeout.Import, dbtimeout.Import), handler.BulkDeleteDepartments)
+		deptGroup.DELETE("/:id/tags/:tag", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.RemoveDepartmentTag)
+	}
+}
+
+// RegisterPublicRoutes registers the public department directory under the given anonymous group.
+func RegisterPublicRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Initialize the department repository, service and handler
+	repo := NewDepartmentRepository()
+	service := NewDepartmentService(repo)
+	handler := NewDepartmentHandler(service)
+
+	// Define the route of the public department directory
+	rg.GET("/departments", handler.GetPublicDepartments)
+}
@@ -4,51 +4,229 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 	"gorm.io/gorm"
 )
 
+// Typed errors returned by the department service
+// Their code and status are surfaced in the responses and documented in the OpenAPI spec.
+var (
+	ErrDepartmentNotFound      = apperror.New("DepartmentNotFound", http.StatusNotFound, "department with the given ID not found")
+	ErrDepartmentConflict      = apperror.New("DepartmentConflict", http.StatusConflict, "department with the same ID already exists")
+	ErrDepartmentNameConflict  = apperror.New("DepartmentNameConflict", http.StatusConflict, "department with the same name already exists")
+	ErrDepartmentArchived      = apperror.New("DepartmentArchived", http.StatusConflict, "department is archived and cannot be modified")
+	ErrDepartmentNotArchived   = apperror.New("DepartmentNotArchived", http.StatusConflict, "department is not archived")
+	ErrDepartmentManaged       = apperror.New("DepartmentManaged", http.StatusConflict, "department is managed by an automation and cannot be changed manually")
+	ErrDepartmentNotManaged    = apperror.New("DepartmentNotManaged", http.StatusConflict, "department is not managed by an automation")
+	ErrClaimRequiresAPIKey     = apperror.New("ClaimRequiresAPIKey", http.StatusForbidden, "only an automation identity authenticated with an API key can claim a department")
+	ErrDepartmentOutOfScope    = apperror.New("DepartmentOutOfScope", http.StatusForbidden, "department is outside the scope granted to the service account")
+	ErrDepartmentQuotaExceeded = apperror.New("DepartmentQuotaExceeded", http.StatusUnprocessableEntity, "the maximum number of departments is reached")
+	ErrDepartmentHasMembers    = apperror.New("DepartmentHasMembers", http.StatusConflict, "department has active members, transfer them first or delete it with force=true")
+)
+
+// Name suggestions returned with a creation conflict
+const (
+	maxNameSuggestions = 5
+	minNameSimilarity  = 0.3
+)
+
+// ConflictError is returned when a new department has the ID or name of an existing one.
+// It wraps ErrDepartmentConflict or ErrDepartmentNameConflict, so it is matched with errors.Is,
+// and carries the conflicting department and the departments with a similar name.
+type ConflictError struct {
+	Err *apperror.Error
+	DepartmentConflict
+}
+
+// Error implements the error interface.
+func (e *ConflictError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the typed error of the conflict.
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// MembersError is returned when a department with active members is deleted without force.
+// It wraps ErrDepartmentHasMembers, so it is matched with errors.Is, and carries the number of members.
+type MembersError struct {
+	Err *apperror.Error
+	DepartmentMembers
+}
+
+// Error implements the error interface.
+func (e *MembersError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the typed error of the refused deletion.
+func (e *MembersError) Unwrap() error {
+	return e.Err
+}
+
+// departmentCache caches the departments read by ID, keyed by lowercase ID.
+// Entries are removed as soon as a department is modified.
+var departmentCache = cache.New("department")
+
+// publicDepartmentCache caches the public projection of the departments under a single key.
+// The entry is removed as soon as a department is created or one of the projected attributes changes.
+var publicDepartmentCache = cache.New("public-department")
+
+// publicDepartmentsKey is the key of the public listing in its cache.
+const publicDepartmentsKey = "all"
+
+// RegisterCacheWarmers reloads the public listing from the database when it expires (see cache.InitExpiryConsumer).
+func RegisterCacheWarmers(db *gorm.DB) {
+	publicDepartmentCache.Warm(publicDepartmentsKey, func(ctx context.Context) (any, error) {
+		return NewDepartmentRepository().GetPublicDepartments(db.WithContext(ctx))
+	})
+}
+
 // Interface for department service
 // This interface defines the methods that the department service should implement
 type DepartmentService interface {
-	GetAllDepartments(ctx context.Context) ([]Department, error)
+	GetAllDepartments(ctx context.Context, filter DepartmentFilter, page pagination.Params) ([]Department, *pagination.Meta, error)
 	GetDepartmentByID(ctx context.Context, id string) (Department, error)
+	GetDepartmentByName(ctx context.Context, name string) (Department, error)
+	CountDepartments(ctx context.Context, filter DepartmentFilter) (int64, error)
+	GetPublicDepartments(ctx context.Context) ([]PublicDepartment, error)
+	DepartmentExists(ctx context.Context, id string) (bool, error)
 	CreateDepartment(ctx context.Context, department Department) (Department, error)
+	ClaimDepartment(ctx context.Context, id string) (Department, error)
+	ReleaseDepartment(ctx context.Context, id string) (Department, error)
 	UpdateDepartment(ctx context.Context, id string, department Department) (Department, error)
-	DeleteDepartment(ctx context.Context, id string) (bool, error)
+	DeleteDepartment(ctx context.Context, id string, force bool) (bool, error)
+	ArchiveDepartment(ctx context.Context, id string) (Department, error)
+	UnarchiveDepartment(ctx context.Context, id string) (Department, error)
+	GetAllTags(ctx context.Context) ([]TagCount, error)
+	SetDepartmentTags(ctx context.Context, id string, tags []string) (Department, error)
+	AddDepartmentTags(ctx context.Context, id string, tags []string) (Department, error)
+	RemoveDepartmentTag(ctx context.Context, id string, tag string) (Department, error)
+	BulkUpdateStatus(ctx context.Context, req BulkStatusRequest) (BulkStatusResponse, error)
+	PreviewBulkDelete(ctx context.Context, filter BulkDeleteFilter) (BulkDeletePreview, error)
+	BulkDelete(ctx context.Context, filter BulkDeleteFilter, confirmToken string) (jobs.Job, error)
+	GetDepartmentNames(ctx context.Context, id string) ([]DepartmentName, error)
 }
 
-// This struct defines the DepartmentService that contains a repository field of type DepartmentRepository
+// This struct defines the DepartmentService that contains a repository field of type DepartmentRepository,
+// the caches, the clock, the bus of the domain events and the queue of the bulk deletes
 type departmentService struct {
-	repo DepartmentRepository
+	repo        DepartmentRepository
+	cache       cache.Store
+	publicCache cache.Store
+	clock       clock.Clock
+	events      outbox.Bus
+	jobs        *jobs.Queue
+}
+
+// Option configures a department service.
+type Option func(*departmentService)
+
+// WithCache sets the caches of the departments read by ID and of the public listing.
+func WithCache(byID cache.Store, public cache.Store) Option {
+	return func(s *departmentService) {
+		s.cache = byID
+		s.publicCache = public
+	}
+}
+
+// WithClock sets the clock used to timestamp the validity periods of the names and the archiving.
+func WithClock(c clock.Clock) Option {
+	return func(s *departmentService) {
+		s.clock = c
+	}
+}
+
+// WithEventBus sets the bus the domain events are written to.
+func WithEventBus(bus outbox.Bus) Option {
+	return func(s *departmentService) {
+		s.events = bus
+	}
 }
 
-// NewDepartmentService creates a new instance of DepartmentService with the given
-// It initializes the departmentService struct and returns it.
-func NewDepartmentService(repo DepartmentRepository) DepartmentService {
-	return &departmentService{repo: repo}
+// WithJobQueue sets the queue running the bulk deletes, instead of the queue of the application.
+func WithJobQueue(q *jobs.Queue) Option {
+	return func(s *departmentService) {
+		s.jobs = q
+	}
+}
+
+// NewDepartmentService creates a new instance of DepartmentService with the given repository.
+// It initializes the departmentService struct, applies the options and returns it.
+func NewDepartmentService(repo DepartmentRepository, opts ...Option) DepartmentService {
+	s := &departmentService{
+		repo:        repo,
+		cache:       departmentCache,
+		publicCache: publicDepartmentCache,
+		clock:       clock.System,
+		events:      outbox.DefaultBus,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // GetAllDepartments retrieves all departments from the database.
-func (s *departmentService) GetAllDepartments(ctx context.Context) ([]Department, error) {
+// The filter controls whether the archived departments are excluded, included or the only ones returned,
+// and which tags the departments must have. The page metadata is nil when the listing is not paginated.
+func (s *departmentService) GetAllDepartments(ctx context.Context, filter DepartmentFilter, page pagination.Params) ([]Department, *pagination.Meta, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
 	if db == nil {
 		logger.Error("database connection is nil")
-		return nil, errors.New("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
 	}
 
 	// Retrieve all departments from the repository
-	departments, err := s.repo.GetAllDepartments(db)
+	departments, err := s.repo.GetAllDepartments(db, filter, page)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to get all departments: %v", err))
-		return nil, err
+		return nil, nil, err
 	}
 
-	return departments, nil
+	// Build the page metadata
+	departments, meta, err := pagination.Paginate(departments, page, func(d Department) string { return d.ID })
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Show the departments as they were at the requested time
+	if filter.AsOf != nil {
+		departments, err = s.applyVersionsAsOf(db, departments, *filter.AsOf)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to get the department versions: %v", err))
+			return nil, nil, err
+		}
+	}
+	if meta != nil && page.IsOffset() {
+		total, err := s.repo.CountDepartments(db, filter)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to count departments: %v", err))
+			return nil, nil, err
+		}
+		meta.TotalItems = &total
+	}
+
+	return departments, meta, nil
 }
 
 // GetDepartmentByID retrieves a department by its ID from the database.
@@ -60,6 +238,12 @@ func (s *departmentService) GetDepartmentByID(ctx context.Context, id string) (D
 		return Department{}, errors.New("database connection is nil")
 	}
 
+	// Serve the department from the cache when possible
+	var department Department
+	if s.cache.Load(ctx, strings.ToLower(id), &department) {
+		return department, nil
+	}
+
 	// Retrieve the department by ID from the repository
 	department, err := s.repo.GetDepartmentByID(db, id)
 	if err != nil {
@@ -67,9 +251,96 @@ func (s *departmentService) GetDepartmentByID(ctx context.Context, id string) (D
 		return Department{}, err
 	}
 
+	s.cache.Store(ctx, strings.ToLower(id), department)
+
 	return department, nil
 }
 
+// GetDepartmentByName retrieves a department by its name (case-insensitive) from the database.
+// It returns ErrDepartmentNameNotFound when no department has the given name.
+func (s *departmentService) GetDepartmentByName(ctx context.Context, name string) (Department, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Department{}, errors.New("database connection is nil")
+	}
+
+	// Retrieve the department by name from the repository
+	department, err := s.repo.GetDepartmentByName(db, name)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get department by name: %v", err))
+		return Department{}, err
+	}
+
+	return department, nil
+}
+
+// CountDepartments counts the departments matching the filter.
+func (s *departmentService) CountDepartments(ctx context.Context, filter DepartmentFilter) (int64, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return 0, errors.New("database connection is nil")
+	}
+
+	// Count the departments in the repository
+	count, err := s.repo.CountDepartments(db, filter)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to count departments: %v", err))
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetPublicDepartments retrieves the public projection of the departments that are not archived.
+// The listing is served from the cache when possible, since the anonymous consumers read it often.
+func (s *departmentService) GetPublicDepartments(ctx context.Context) ([]PublicDepartment, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	var departments []PublicDepartment
+	if s.publicCache.Load(ctx, publicDepartmentsKey, &departments) {
+		return departments, nil
+	}
+
+	// Retrieve the public projection from the repository
+	departments, err := s.repo.GetPublicDepartments(db)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get public departments: %v", err))
+		return nil, err
+	}
+
+	s.publicCache.Store(ctx, publicDepartmentsKey, departments)
+
+	return departments, nil
+}
+
+// DepartmentExists checks if a department with the given ID exists.
+func (s *departmentService) DepartmentExists(ctx context.Context, id string) (bool, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return false, errors.New("database connection is nil")
+	}
+
+	// Check the existence in the repository
+	exists, err := s.repo.ExistsDepartment(db, id)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to check department existence: %v", err))
+		return false, err
+	}
+
+	return exists, nil
+}
+
 // CreateDepartment creates a new department in the database.
 func (s *departmentService) CreateDepartment(ctx context.Context, d Department) (Department, error) {
 	// Get the database connection from the context
@@ -79,23 +350,43 @@ func (s *departmentService) CreateDepartment(ctx context.Context, d Department)
 		return Department{}, errors.New("database connection is nil")
 	}
 
+	// Normalize the tags before the validation
+	d.Tags = NormalizeTags(d.Tags)
+	if d.Metadata == nil {
+		d.Metadata = Metadata{}
+	}
+
 	// Validate the department struct using the validator
 	if err := d.Validate(); err != nil {
 		return Department{}, err
 	}
 
+	// Service accounts only create the departments of their scope
+	if err := s.checkScope(ctx, db, "create", d.ID); err != nil {
+		return Department{}, err
+	}
+
 	var createdDepartment Department
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Check if the ID already exists
 		existingDepartment, err := s.repo.GetDepartmentByID(db, d.ID)
 		if (err == nil) || !(existingDepartment.Equals(&Department{})) {
-			return errors.New("department with the same ID already exists")
+			return s.conflictError(tx, ErrDepartmentConflict, existingDepartment, d.DeptName)
 		}
 
 		// Check if the department name already exists
 		existingDepartment, err = s.repo.GetDepartmentByName(db, d.DeptName)
 		if err == nil || !(existingDepartment.Equals(&Department{})) {
-			return errors.New("department with the same name already exists")
+			return s.conflictError(tx, ErrDepartmentNameConflict, existingDepartment, d.DeptName)
+		}
+
+		// Refuse the department beyond the quota of the deployment, unless an admin overrides it
+		// The archived departments count, the deleted ones do not
+		err = quota.Check(ctx, "departments", quota.Departments(), ErrDepartmentQuotaExceeded, func() (int64, error) {
+			return s.repo.CountDepartments(tx, DepartmentFilter{Archived: ArchivedInclude})
+		})
+		if err != nil {
+			return err
 		}
 
 		// Extract user metadata from the context
@@ -104,15 +395,32 @@ func (s *departmentService) CreateDepartment(ctx context.Context, d Department)
 			return errors.New("missing user context")
 		}
 
-		// Create the department
+		// Create the department, new departments are always active
+		// and valid from now on
+		now := s.clock.Now()
+		d.Status = StatusActive
+		d.ArchivedBy = nil
+		d.ArchivedAt = nil
+		d.ValidFrom = &now
+		d.ValidTo = nil
 		d.CreatedBy = &meta.UserID
 		d.UpdatedBy = d.CreatedBy
+
+		// The employee count is maintained by the user assignments, a new department has no employees
+		d.EmployeeCount = 0
+
+		// A department created by an automation is managed by it, the others are not managed
+		d.ManagedBy = nil
+		if meta.Automation {
+			d.ManagedBy = &meta.UserName
+		}
 		createdDepartment, err = s.repo.CreateDepartment(ctx, tx, d)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentCreated, createdDepartment.ID, createdDepartment))
 	})
 
 	if err != nil {
@@ -120,9 +428,58 @@ func (s *departmentService) CreateDepartment(ctx context.Context, d Department)
 		return Department{}, err
 	}
 
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale public listing from the cache
+	s.publicCache.Delete(ctx, publicDepartmentsKey)
+
 	return createdDepartment, nil
 }
 
+// conflictError returns the conflict with the existing department and the departments whose name is close
+// to the requested one, the most similar first. The conflict is still returned if the suggestions cannot be loaded.
+func (s *departmentService) conflictError(tx *gorm.DB, err *apperror.Error, existing Department, name string) error {
+	conflict := &ConflictError{
+		Err:                err,
+		DepartmentConflict: DepartmentConflict{Conflicting: existing, Suggestions: []DepartmentSuggestion{}},
+	}
+
+	candidates, cerr := s.repo.GetDepartmentNameCandidates(tx)
+	if cerr != nil {
+		logger.Warn(fmt.Sprintf("failed to load the department name suggestions: %v", cerr))
+		return conflict
+	}
+
+	conflict.Suggestions = SuggestDepartmentNames(name, existing.ID, candidates)
+	return conflict
+}
+
+// SuggestDepartmentNames ranks the candidates by the similarity of their name to the given one,
+// excluding the department with the excluded ID, and keeps the closest ones.
+func SuggestDepartmentNames(name string, excludeID string, candidates []DepartmentSuggestion) []DepartmentSuggestion {
+	suggestions := []DepartmentSuggestion{}
+	for _, c := range candidates {
+		if strings.EqualFold(c.ID, excludeID) {
+			continue
+		}
+
+		c.Similarity = util.Similarity(name, c.DeptName)
+		if c.Similarity >= minNameSimilarity {
+			suggestions = append(suggestions, c)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Similarity > suggestions[j].Similarity
+	})
+	if len(suggestions) > maxNameSuggestions {
+		suggestions = suggestions[:maxNameSuggestions]
+	}
+
+	return suggestions
+}
+
 // UpdateDepartment updates an existing department in the database.
 func (s *departmentService) UpdateDepartment(ctx context.Context, id string, d Department) (Department, error) {
 	// Get the database connection from the context
@@ -132,6 +489,11 @@ func (s *departmentService) UpdateDepartment(ctx context.Context, id string, d D
 		return Department{}, errors.New("database connection is nil")
 	}
 
+	// Service accounts only write the departments of their scope
+	if err := s.checkScope(ctx, db, "update", id); err != nil {
+		return Department{}, err
+	}
+
 	// Validate the department struct using the validator
 	if err := d.Validate(); err != nil {
 		return Department{}, err
@@ -147,7 +509,12 @@ func (s *departmentService) UpdateDepartment(ctx context.Context, id string, d D
 
 		// Check if the existing department is empty
 		if (existingDepartment.Equals(&Department{})) {
-			return errors.New("department not found") // Department not found
+			return ErrDepartmentNotFound
+		}
+
+		// Archived departments are read-only
+		if existingDepartment.IsArchived() {
+			return ErrDepartmentArchived
 		}
 
 		// Extract user metadata from the context
@@ -156,16 +523,43 @@ func (s *departmentService) UpdateDepartment(ctx context.Context, id string, d D
 			return errors.New("missing user context")
 		}
 
+		// The departments managed by an automation are not changed manually
+		if err := s.checkManaged(ctx, tx, existingDepartment, meta); err != nil {
+			return err
+		}
+
+		// A new name closes the current validity period and opens a new one (type-2 history)
+		if existingDepartment.DeptName != d.DeptName {
+			now := s.clock.Now()
+			version := DepartmentVersion{
+				DepartmentID: existingDepartment.ID,
+				DeptName:     existingDepartment.DeptName,
+				ValidFrom:    validFrom(existingDepartment, now),
+				ValidTo:      now,
+				CreatedBy:    &meta.UserID,
+			}
+			if err := s.repo.CreateDepartmentVersion(ctx, tx, version); err != nil {
+				return err
+			}
+			existingDepartment.ValidFrom = &now
+		}
+
 		// Save the updated department
 		existingDepartment.DeptName = d.DeptName
 		existingDepartment.Active = d.Active
 		existingDepartment.UpdatedBy = &meta.UserID
+
+		// The metadata is replaced as a whole when given, and kept when omitted
+		if d.Metadata != nil {
+			existingDepartment.Metadata = d.Metadata
+		}
 		updatedDepartment, err = s.repo.UpdateDepartment(ctx, tx, existingDepartment)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentUpdated, updatedDepartment.ID, updatedDepartment))
 	})
 
 	if err != nil {
@@ -173,11 +567,19 @@ func (s *departmentService) UpdateDepartment(ctx context.Context, id string, d D
 		return Department{}, err
 	}
 
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale department and public listing from the cache
+	s.cache.Delete(ctx, strings.ToLower(id))
+	s.publicCache.Delete(ctx, publicDepartmentsKey)
+
 	return updatedDepartment, nil
 }
 
 // DeleteDepartment deletes a department by its ID from the database.
-func (s *departmentService) DeleteDepartment(ctx context.Context, id string) (bool, error) {
+// A department with active members is only deleted with force, their assignment then follows DEPARTMENT_DELETE_CASCADE.
+func (s *departmentService) DeleteDepartment(ctx context.Context, id string, force bool) (bool, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
 	if db == nil {
@@ -185,6 +587,12 @@ func (s *departmentService) DeleteDepartment(ctx context.Context, id string) (bo
 		return false, errors.New("database connection is nil")
 	}
 
+	// Service accounts only write the departments of their scope
+	if err := s.checkScope(ctx, db, "delete", id); err != nil {
+		return false, err
+	}
+
+	var deletedDepartment Department
 	err := db.Transaction(func(tx *gorm.DB) error {
 		// Check if the department exists
 		existingDepartment, err := s.repo.GetDepartmentByID(db, id)
@@ -194,7 +602,7 @@ func (s *departmentService) DeleteDepartment(ctx context.Context, id string) (bo
 
 		// Check if the existing department is empty
 		if (existingDepartment.Equals(&Department{})) {
-			return errors.New("department not found") // Department not found
+			return ErrDepartmentNotFound
 		}
 
 		// Extract user metadata from the context
@@ -203,13 +611,47 @@ func (s *departmentService) DeleteDepartment(ctx context.Context, id string) (bo
 			return errors.New("missing user context")
 		}
 
+		// The departments managed by an automation are not changed manually
+		if err := s.checkManaged(ctx, tx, existingDepartment, meta); err != nil {
+			return err
+		}
+
+		// Lock the department, so no user joins it while its members are counted
+		if _, err := s.repo.GetDepartmentsByIDsForUpdate(tx, []string{existingDepartment.ID}); err != nil {
+			return err
+		}
+		members, err := s.repo.CountEmployees(tx, existingDepartment.ID)
+		if err != nil {
+			return err
+		}
+		if members > 0 && !force {
+			return &MembersError{Err: ErrDepartmentHasMembers, DepartmentMembers: DepartmentMembers{Members: members}}
+		}
+		if members > 0 && memberCascade == MemberCascadeUnassign {
+			unassigned, err := s.repo.UnassignEmployees(ctx, tx, existingDepartment.ID)
+			if err != nil {
+				return err
+			}
+			if err := s.repo.AdjustEmployeeCount(ctx, tx, existingDepartment.ID, -unassigned); err != nil {
+				return err
+			}
+			existingDepartment.EmployeeCount = max(existingDepartment.EmployeeCount-unassigned, 0)
+		}
+		if members > 0 {
+			logger.Warn(fmt.Sprintf("department %s deleted with %d members by %s, members cascade %s", existingDepartment.ID, members, meta.UserName, memberCascade))
+		}
+
 		// Delete the department
 		err = s.repo.DeleteDepartment(ctx, tx, existingDepartment, &meta.UserID)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		deletedDepartment = existingDepartment
+		deletedDepartment.DeletedBy = &meta.UserID
+
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentDeleted, deletedDepartment.ID, deletedDepartment))
 	})
 
 	if err != nil {
@@ -217,5 +659,632 @@ func (s *departmentService) DeleteDepartment(ctx context.Context, id string) (bo
 		return false, err
 	}
 
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale department and public listing from the cache
+	s.cache.Delete(ctx, strings.ToLower(id))
+	s.publicCache.Delete(ctx, publicDepartmentsKey)
+
 	return true, nil
 }
+
+// ArchiveDepartment archives a department by its ID.
+// The department stays readable but can no longer be updated until it is unarchived.
+func (s *departmentService) ArchiveDepartment(ctx context.Context, id string) (Department, error) {
+	return s.setArchived(ctx, id, true)
+}
+
+// UnarchiveDepartment restores an archived department by its ID.
+func (s *departmentService) UnarchiveDepartment(ctx context.Context, id string) (Department, error) {
+	return s.setArchived(ctx, id, false)
+}
+
+// setArchived archives or unarchives a department and writes the corresponding domain event.
+func (s *departmentService) setArchived(ctx context.Context, id string, archive bool) (Department, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Department{}, errors.New("database connection is nil")
+	}
+
+	// Service accounts only write the departments of their scope
+	action := "unarchive"
+	if archive {
+		action = "archive"
+	}
+	if err := s.checkScope(ctx, db, action, id); err != nil {
+		return Department{}, err
+	}
+
+	var updatedDepartment Department
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the department exists
+		existingDepartment, err := s.repo.GetDepartmentByID(db, id)
+		if err != nil {
+			return err
+		}
+
+		// Check if the existing department is empty
+		if (existingDepartment.Equals(&Department{})) {
+			return ErrDepartmentNotFound
+		}
+
+		// Check the current archive state
+		if archive && existingDepartment.IsArchived() {
+			return ErrDepartmentArchived
+		}
+		if !archive && !existingDepartment.IsArchived() {
+			return ErrDepartmentNotArchived
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// The departments managed by an automation are not changed manually
+		if err := s.checkManaged(ctx, tx, existingDepartment, meta); err != nil {
+			return err
+		}
+
+		// Update the archive state
+		eventType := event.DepartmentUnarchived
+		if archive {
+			now := s.clock.Now()
+			existingDepartment.Status = StatusArchived
+			existingDepartment.ArchivedBy = &meta.UserID
+			existingDepartment.ArchivedAt = &now
+			eventType = event.DepartmentArchived
+		} else {
+			existingDepartment.Status = StatusActive
+			existingDepartment.ArchivedBy = nil
+			existingDepartment.ArchivedAt = nil
+		}
+		existingDepartment.UpdatedBy = &meta.UserID
+		updatedDepartment, err = s.repo.UpdateDepartment(ctx, tx, existingDepartment)
+		if err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(eventType, updatedDepartment.ID, updatedDepartment))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to change the archive state of department: %v", err))
+		return Department{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale department and public listing from the cache
+	s.cache.Delete(ctx, strings.ToLower(id))
+	s.publicCache.Delete(ctx, publicDepartmentsKey)
+
+	return updatedDepartment, nil
+}
+
+// ClaimDepartment marks a department as managed by the automation identity of the request,
+// like importing an existing record into the state of the automation. Claiming a department already
+// managed by the same automation changes nothing.
+// The manual changes of a managed department are then rejected or flagged, see MANAGED_EDIT_POLICY.
+func (s *departmentService) ClaimDepartment(ctx context.Context, id string) (Department, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Department{}, errors.New("database connection is nil")
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return Department{}, errors.New("missing user context")
+	}
+
+	// Only the automation identities manage departments
+	if !meta.Automation {
+		return Department{}, ErrClaimRequiresAPIKey
+	}
+
+	// Service accounts only write the departments of their scope
+	if err := s.checkScope(ctx, db, "claim", id); err != nil {
+		return Department{}, err
+	}
+
+	var claimedDepartment Department
+	changed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the department exists
+		existingDepartment, err := s.repo.GetDepartmentByID(db, id)
+		if err != nil {
+			return err
+		}
+
+		// Check if the existing department is empty
+		if (existingDepartment.Equals(&Department{})) {
+			return ErrDepartmentNotFound
+		}
+
+		// A department is managed by a single automation
+		if existingDepartment.IsManaged() {
+			if *existingDepartment.ManagedBy != meta.UserName {
+				return ErrDepartmentManaged
+			}
+			claimedDepartment = existingDepartment
+			return nil
+		}
+
+		// Mark the department as managed by the automation
+		existingDepartment.ManagedBy = &meta.UserName
+		existingDepartment.UpdatedBy = &meta.UserID
+		claimedDepartment, err = s.repo.UpdateDepartment(ctx, tx, existingDepartment)
+		if err != nil {
+			return err
+		}
+		changed = true
+
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentClaimed, claimedDepartment.ID, claimedDepartment))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to claim department: %v", err))
+		return Department{}, err
+	}
+
+	if changed {
+		// Forward the committed event without waiting for the next outbox poll
+		outbox.Notify()
+
+		// Remove the stale department from the cache
+		s.cache.Delete(ctx, strings.ToLower(id))
+	}
+
+	return claimedDepartment, nil
+}
+
+// ReleaseDepartment gives a managed department back to the manual changes.
+// It is done by the managing automation, or by an administrator when the automation is gone.
+func (s *departmentService) ReleaseDepartment(ctx context.Context, id string) (Department, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Department{}, errors.New("database connection is nil")
+	}
+
+	// Service accounts only write the departments of their scope
+	if err := s.checkScope(ctx, db, "release", id); err != nil {
+		return Department{}, err
+	}
+
+	var releasedDepartment Department
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the department exists
+		existingDepartment, err := s.repo.GetDepartmentByID(db, id)
+		if err != nil {
+			return err
+		}
+
+		// Check if the existing department is empty
+		if (existingDepartment.Equals(&Department{})) {
+			return ErrDepartmentNotFound
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Another automation cannot release the department
+		if !existingDepartment.IsManaged() {
+			return ErrDepartmentNotManaged
+		}
+		if meta.Automation && *existingDepartment.ManagedBy != meta.UserName {
+			return ErrDepartmentManaged
+		}
+
+		// Give the department back to the manual changes
+		existingDepartment.ManagedBy = nil
+		existingDepartment.UpdatedBy = &meta.UserID
+		releasedDepartment, err = s.repo.UpdateDepartment(ctx, tx, existingDepartment)
+		if err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentReleased, releasedDepartment.ID, releasedDepartment))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to release department: %v", err))
+		return Department{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale department from the cache
+	s.cache.Delete(ctx, strings.ToLower(id))
+
+	return releasedDepartment, nil
+}
+
+// checkManaged rejects or flags a change of a department managed by an automation.
+// The managing automation changes it freely and the other automations never can. The manual changes
+// are rejected, or accepted with a department.drifted event when MANAGED_EDIT_POLICY is FLAG, so the
+// automation can reconcile its state.
+func (s *departmentService) checkManaged(ctx context.Context, tx *gorm.DB, d Department, meta metacontext.RequestMeta) error {
+	if !d.IsManaged() {
+		return nil
+	}
+
+	if meta.Automation {
+		if *d.ManagedBy == meta.UserName {
+			return nil
+		}
+		return ErrDepartmentManaged
+	}
+
+	if managedEditPolicy != ManagedEditFlag {
+		return ErrDepartmentManaged
+	}
+
+	logger.Warn(fmt.Sprintf("department %s managed by %s changed manually by %s", d.ID, *d.ManagedBy, meta.UserName))
+	return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentDrifted, d.ID, d))
+}
+
+// checkScope rejects the writes of a service account to the departments outside its scope.
+// The rejection is recorded as a department.access_denied event, written outside of the transaction
+// of the write so the audit entry is kept.
+func (s *departmentService) checkScope(ctx context.Context, db *gorm.DB, action string, ids ...string) error {
+	meta, ok := metacontext.RequestMetaFrom(ctx)
+	if !ok || !meta.DepartmentScoped {
+		return nil
+	}
+
+	var denied []string
+	for _, id := range ids {
+		if !meta.InDepartmentScope(id) {
+			denied = append(denied, id)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+
+	logger.Warn(fmt.Sprintf("%s of departments %s denied to %s, outside of its scope", action, strings.Join(denied, ", "), meta.UserName))
+	violation := ScopeViolation{
+		UserID:   meta.UserID,
+		UserName: meta.UserName,
+		Action:   action,
+		Denied:   denied,
+		Scope:    meta.DepartmentScope,
+	}
+	if err := s.events.Add(ctx, db, event.NewEvent(event.DepartmentAccessDenied, denied[0], violation)); err != nil {
+		logger.Error(fmt.Sprintf("failed to record the denied %s of department %s: %v", action, denied[0], err))
+	} else {
+		outbox.Notify()
+	}
+
+	return ErrDepartmentOutOfScope
+}
+
+// GetAllTags retrieves the tags in use with the number of departments labeled with each of them.
+func (s *departmentService) GetAllTags(ctx context.Context) ([]TagCount, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	// Retrieve the tags from the repository
+	tags, err := s.repo.GetAllTags(db)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get all tags: %v", err))
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// SetDepartmentTags replaces the tags of a department.
+func (s *departmentService) SetDepartmentTags(ctx context.Context, id string, tags []string) (Department, error) {
+	return s.updateTags(ctx, id, tags, func(current Tags) Tags {
+		return NormalizeTags(tags)
+	})
+}
+
+// AddDepartmentTags adds tags to a department, the existing tags are kept.
+func (s *departmentService) AddDepartmentTags(ctx context.Context, id string, tags []string) (Department, error) {
+	return s.updateTags(ctx, id, tags, func(current Tags) Tags {
+		return NormalizeTags(append(append([]string{}, current...), tags...))
+	})
+}
+
+// RemoveDepartmentTag removes a tag from a department.
+func (s *departmentService) RemoveDepartmentTag(ctx context.Context, id string, tag string) (Department, error) {
+	return s.updateTags(ctx, id, []string{tag}, func(current Tags) Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		remaining := Tags{}
+		for _, t := range current {
+			if t != tag {
+				remaining = append(remaining, t)
+			}
+		}
+		return remaining
+	})
+}
+
+// updateTags validates the given tags, computes the new tags of a department and saves them.
+func (s *departmentService) updateTags(ctx context.Context, id string, tags []string, apply func(current Tags) Tags) (Department, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Department{}, errors.New("database connection is nil")
+	}
+
+	// Service accounts only write the departments of their scope
+	if err := s.checkScope(ctx, db, "tags", id); err != nil {
+		return Department{}, err
+	}
+
+	// Validate the tags using the validator
+	req := TagsRequest{Tags: NormalizeTags(tags)}
+	if err := req.Validate(); err != nil {
+		return Department{}, err
+	}
+
+	var updatedDepartment Department
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the department exists
+		existingDepartment, err := s.repo.GetDepartmentByID(db, id)
+		if err != nil {
+			return err
+		}
+
+		// Check if the existing department is empty
+		if (existingDepartment.Equals(&Department{})) {
+			return ErrDepartmentNotFound
+		}
+
+		// Archived departments are read-only
+		if existingDepartment.IsArchived() {
+			return ErrDepartmentArchived
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// The departments managed by an automation are not changed manually
+		if err := s.checkManaged(ctx, tx, existingDepartment, meta); err != nil {
+			return err
+		}
+
+		// Validate the resulting tags (e.g. the maximum number of tags)
+		existingDepartment.Tags = apply(existingDepartment.Tags)
+		if err := existingDepartment.Validate(); err != nil {
+			return err
+		}
+
+		// Save the updated tags
+		existingDepartment.UpdatedBy = &meta.UserID
+		updatedDepartment, err = s.repo.UpdateDepartment(ctx, tx, existingDepartment)
+		if err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.events.Add(ctx, tx, event.NewEvent(event.DepartmentUpdated, updatedDepartment.ID, updatedDepartment))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to update department tags: %v", err))
+		return Department{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale department from the cache
+	s.cache.Delete(ctx, strings.ToLower(id))
+
+	return updatedDepartment, nil
+}
+
+// GetDepartmentNames retrieves the names a department had, oldest first, ending with its current name.
+func (s *departmentService) GetDepartmentNames(ctx context.Context, id string) ([]DepartmentName, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	// Check if the department exists
+	department, err := s.repo.GetDepartmentByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retrieve the previous names from the name history
+	versions, err := s.repo.GetDepartmentVersions(db, department.ID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get the name history of department: %v", err))
+		return nil, err
+	}
+
+	names := make([]DepartmentName, 0, len(versions)+1)
+	for _, v := range versions {
+		names = append(names, DepartmentName{DeptName: v.DeptName, ValidFrom: &v.ValidFrom, ValidTo: &v.ValidTo})
+	}
+
+	current := validFrom(department, s.clock.Now())
+	names = append(names, DepartmentName{DeptName: department.DeptName, ValidFrom: &current, Current: true})
+
+	return names, nil
+}
+
+// BulkUpdateStatus activates or deactivates the given departments in one transaction.
+// Nothing is changed if one of the departments does not exist or is archived. The departments already
+// in the requested status are left untouched, and one domain event is written for every changed
+// department, so the audit trail shows who changed which department.
+func (s *departmentService) BulkUpdateStatus(ctx context.Context, req BulkStatusRequest) (BulkStatusResponse, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return BulkStatusResponse{}, errors.New("database connection is nil")
+	}
+
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return BulkStatusResponse{}, err
+	}
+
+	// Ignore the repeated IDs, compared case-insensitively like the department IDs
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		key := strings.ToLower(id)
+		if !seen[key] {
+			seen[key] = true
+			ids = append(ids, id)
+		}
+	}
+
+	// Service accounts only write the departments of their scope, nothing is changed if one is outside of it
+	if err := s.checkScope(ctx, db, "bulk-status", ids...); err != nil {
+		return BulkStatusResponse{}, err
+	}
+
+	response := BulkStatusResponse{Updated: []Department{}, Unchanged: []string{}}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the departments so concurrent updates wait for the bulk change
+		departments, err := s.repo.GetDepartmentsByIDsForUpdate(tx, ids)
+		if err != nil {
+			return err
+		}
+		if len(departments) != len(ids) {
+			return ErrDepartmentNotFound
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		eventType := event.DepartmentDeactivated
+		if *req.Active {
+			eventType = event.DepartmentActivated
+		}
+
+		for _, existingDepartment := range departments {
+			// Archived departments are read-only
+			if existingDepartment.IsArchived() {
+				return ErrDepartmentArchived
+			}
+
+			if existingDepartment.Active == *req.Active {
+				response.Unchanged = append(response.Unchanged, existingDepartment.ID)
+				continue
+			}
+
+			// The departments managed by an automation are not changed manually
+			if err := s.checkManaged(ctx, tx, existingDepartment, meta); err != nil {
+				return err
+			}
+
+			existingDepartment.Active = *req.Active
+			existingDepartment.UpdatedBy = &meta.UserID
+			updatedDepartment, err := s.repo.UpdateDepartment(ctx, tx, existingDepartment)
+			if err != nil {
+				return err
+			}
+
+			// Write the domain event to the outbox within the same transaction
+			if err := s.events.Add(ctx, tx, event.NewEvent(eventType, updatedDepartment.ID, updatedDepartment)); err != nil {
+				return err
+			}
+			response.Updated = append(response.Updated, updatedDepartment)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to update the status of departments: %v", err))
+		return BulkStatusResponse{}, err
+	}
+
+	// Forward the committed events without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the stale departments and public listing from the cache
+	for _, d := range response.Updated {
+		s.cache.Delete(ctx, strings.ToLower(d.ID))
+	}
+	if len(response.Updated) > 0 {
+		s.publicCache.Delete(ctx, publicDepartmentsKey)
+	}
+
+	return response, nil
+}
+
+// applyVersionsAsOf replaces the name and validity period of the departments that were renamed
+// since the given time by the version that was valid then.
+func (s *departmentService) applyVersionsAsOf(db *gorm.DB, departments []Department, asOf time.Time) ([]Department, error) {
+	if len(departments) == 0 {
+		return departments, nil
+	}
+
+	ids := make([]string, len(departments))
+	for i, d := range departments {
+		ids[i] = d.ID
+	}
+
+	versions, err := s.repo.GetDepartmentVersionsAsOf(db, ids, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]DepartmentVersion, len(versions))
+	for _, v := range versions {
+		byID[v.DepartmentID] = v
+	}
+
+	for i, d := range departments {
+		if v, ok := byID[d.ID]; ok {
+			departments[i].DeptName = v.DeptName
+			departments[i].ValidFrom = &v.ValidFrom
+			departments[i].ValidTo = &v.ValidTo
+		}
+	}
+
+	return departments, nil
+}
+
+// validFrom returns the start of the current validity period of a department.
+// The departments created before the validity periods were recorded start at their creation.
+func validFrom(d Department, now time.Time) time.Time {
+	if d.ValidFrom != nil {
+		return *d.ValidFrom
+	}
+	if d.CreatedAt != nil {
+		return *d.CreatedAt
+	}
+
+	return now
+}
@@ -0,0 +1,109 @@
+package eventstream
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsoncodec"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/stream"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// Event names of the stream, besides the domain event types
+const (
+	EventShutdown = "shutdown"
+)
+
+// heartbeatInterval is the interval of the comments sent to keep idle connections open through proxies.
+const heartbeatInterval = 15 * time.Second
+
+// reconnectDelay is the delay advised to clients reconnecting after a shutdown, in milliseconds.
+const reconnectDelay = 3000
+
+// This struct defines the EventStreamHandler which streams the domain events to the clients.
+type EventStreamHandler struct{}
+
+// NewEventStreamHandler creates a new instance of EventStreamHandler.
+func NewEventStreamHandler() *EventStreamHandler {
+	return &EventStreamHandler{}
+}
+
+// StreamEvents streams the domain events as Server-Sent Events.
+// On shutdown, a final "shutdown" event is sent with a reconnection delay and the stream is closed.
+// @Summary      Stream domain events
+// @Description  Stream the domain events (department and user changes) as Server-Sent Events
+// @Tags         events
+// @Produce      text/event-stream
+// @Success      200  {string}  string "Event stream"
+// @Failure      503  {object}  HttpResponse for server shutting down
+// @Router       /events [get]
+func (h *EventStreamHandler) StreamEvents(c *gin.Context) {
+	var userID int64
+	if meta, ok := metacontext.ExtractRequestMeta(c.Request.Context()); ok {
+		userID = meta.UserID
+	}
+
+	conn, err := stream.Register(userID)
+	if err != nil {
+		util.JSONError(c, http.StatusServiceUnavailable, "Failed to open event stream", err.Error())
+		return
+	}
+	defer stream.Unregister(conn)
+
+	// The stream outlives the server write timeout, so the deadline is disabled for this connection
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e := <-conn.Events:
+			if err := writeEvent(c, e.ID, e.Type, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-conn.Done():
+			// Tell the client to reconnect after a delay, to another instance behind the load balancer
+			fmt.Fprintf(c.Writer, "retry: %d\n", reconnectDelay)
+			writeEvent(c, "", EventShutdown, gin.H{"reason": "server is shutting down"})
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event with a JSON payload and flushes it to the client.
+func writeEvent(c *gin.Context, id string, name string, data any) error {
+	payload, err := jsoncodec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(c.Writer, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package eventstream
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the domain events stream under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Routes for the domain events stream (Server-Sent Events)
+	// The stream bypasses the compression and the buffering, so every event is flushed as soon as it is written
+	eventsGroup := rg.Group("/events")
+	{
+		deps.Chain.OptOut(eventsGroup, chain.Streaming...)
+
+		// Rate limiter middleware for the /events group.
+		// - Allows a burst of up to 2 connections at once.
+		// - Allows 1 new connection every 5 seconds, which leaves room for reconnections after a shutdown.
+		// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+		eventsGroup.Use(ratelimiter.RateLimiter(rate.Every(5*time.Second), 2, 10*time.Minute))
+
+		// Initialize the event stream handler
+		handler := NewEventStreamHandler()
+
+		// Define the route streaming the domain events
+		eventsGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.StreamEvents)
+	}
+}
@@ -0,0 +1,85 @@
+package fixture
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Package fixture holds the sample entities shared by the tests and the examples of the OpenAPI spec,
+// so the documented payloads are the ones the tests send through the real handlers and validators.
+
+// SampleTime is the creation and update time of the sample entities, fixed so the spec does not change between builds.
+var SampleTime = time.Date(2025, time.January, 15, 9, 30, 0, 0, time.UTC)
+
+// SamplePassword is a password of the sample user accepted by the password policy.
+const SamplePassword = "P@ssw0rd123"
+
+// SampleDepartment returns the sample department d001.
+func SampleDepartment() department.Department {
+	return SampleDepartments()[0]
+}
+
+// SampleDepartments returns the sample departments d001 and d002.
+func SampleDepartments() []department.Department {
+	createdAt := SampleTime
+	createdBy := int64(1)
+	return []department.Department{
+		{ID: "d001", DeptName: "HR", Active: true, CreatedBy: &createdBy, CreatedAt: &createdAt, UpdatedBy: &createdBy, UpdatedAt: &createdAt},
+		{ID: "d002", DeptName: "IT", Active: true, CreatedBy: &createdBy, CreatedAt: &createdAt, UpdatedBy: &createdBy, UpdatedAt: &createdAt},
+	}
+}
+
+// SampleUser returns the sample user 1, an enabled admin.
+func SampleUser() user.User {
+	enabled := true
+	return user.User{
+		ID:        1,
+		UserName:  "admin",
+		Email:     "admin@example.com",
+		FirstName: "Admin",
+		IsEnabled: &enabled,
+		UserType:  user.UserAccount,
+		Roles:     []role.Role{{ID: 1, Name: "ROLE_ADMIN"}},
+	}
+}
+
+// Examples returns the examples of the OpenAPI spec, keyed by the name the operations refer to.
+// The request examples are keyed like the JSON Schema of their body.
+func Examples() map[string]openapi.Example {
+	d := SampleDepartment()
+	u := SampleUser()
+
+	return map[string]openapi.Example{
+		"department":        {Request: pick(d, "id", "deptName", "active", "tags", "metadata"), Response: d},
+		"department-update": {Request: pick(d, "deptName", "active", "tags", "metadata"), Response: d},
+		"user":              {Request: withPassword(pick(u, "userName", "email", "firstName", "lastName", "userType", "departmentId", "roles")), Response: u},
+	}
+}
+
+// pick returns the JSON encoding of v reduced to the given properties, the null ones left out.
+// The request examples are taken from the sample entities this way, without their server-managed fields.
+func pick(v any, names ...string) map[string]any {
+	var all map[string]any
+	data, _ := json.Marshal(v)
+	_ = json.Unmarshal(data, &all)
+
+	picked := make(map[string]any, len(names))
+	for _, name := range names {
+		if value, ok := all[name]; ok && value != nil {
+			picked[name] = value
+		}
+	}
+
+	return picked
+}
+
+// withPassword adds the sample password to a user payload, the users are encoded without it.
+func withPassword(payload map[string]any) map[string]any {
+	payload["password"] = SamplePassword
+	return payload
+}
@@ -0,0 +1,60 @@
+package health
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// This struct defines the HealthHandler which reports the health of the application.
+// It aggregates the checkers registered by the modules in the health registry.
+type HealthHandler struct {
+	Registry *health.Registry
+}
+
+// NewHealthHandler creates a new instance of HealthHandler.
+// It initializes the HealthHandler struct with the provided health registry.
+func NewHealthHandler(registry *health.Registry) *HealthHandler {
+	return &HealthHandler{Registry: registry}
+}
+
+// Liveness reports that the process is running, without checking its dependencies.
+// @Summary      Liveness probe
+// @Description  Check that the application process is running
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  HttpResponse for a running application
+// @Router       /livez [get]
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	util.JSONSuccess(c, http.StatusOK, "Application is alive", gin.H{"status": health.StatusUp})
+}
+
+// Readiness reports the component-level health of the application.
+// The application is ready when no critical component is down; a failing non-critical
+// component is reported as DEGRADED but still ready to receive traffic.
+// @Summary      Readiness probe
+// @Description  Check the health of the registered components (database, cache, dispatchers)
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  HttpResponse for a ready application
+// @Failure      503  {object}  HttpResponse for an application not ready
+// @Router       /readyz [get]
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.Registry.Check(c.Request.Context())
+	if report.Status == health.StatusDown {
+		c.JSON(http.StatusServiceUnavailable, util.HttpResponse{
+			Message:   "Application is not ready",
+			Error:     "One or more critical components are down",
+			Path:      c.Request.URL.Path,
+			Status:    http.StatusServiceUnavailable,
+			Data:      report,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Application is ready", report)
+}
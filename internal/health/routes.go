@@ -0,0 +1,15 @@
+package health
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+)
+
+// RegisterRoutes registers the health probes used by the orchestrator and the load balancer under the given group.
+// The readiness probe aggregates the checkers registered by the modules in the health registry.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	handler := NewHealthHandler(health.GetRegistry())
+	rg.GET("/livez", handler.Liveness)
+	rg.GET("/readyz", handler.Readiness)
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// This struct defines the JobHandler which reports the progress of the background jobs (see pkg/jobs).
+// Without a queue, it reads the jobs of the queue of the application.
+type JobHandler struct {
+	Queue *jobs.Queue
+}
+
+// NewJobHandler creates a new instance of JobHandler reading the jobs of the given queue.
+func NewJobHandler(queue *jobs.Queue) *JobHandler {
+	return &JobHandler{Queue: queue}
+}
+
+// GetJob retrieves a background job and returns its status and progress as JSON.
+// @Summary      Get a background job
+// @Description  Get the status, the progress and the result of a background job (e.g. a bulk delete)
+// @Tags         jobs
+// @Produce      json
+// @Param        id   path      string  true  "Job ID"
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Failure      404  {object}  HttpResponse for job not found
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /jobs/{id} [get]
+func (h *JobHandler) GetJob(c *gin.Context) {
+	queue := h.Queue
+	if queue == nil {
+		queue = jobs.Default
+	}
+	if queue == nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve job", errors.New("job queue is not initialized").Error())
+		return
+	}
+
+	job, err := queue.Get(c.Request.Context(), c.Param("id"))
+	if util.JSONAppError(c, "Failed to retrieve job", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve job", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Job retrieved successfully", job)
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the background job routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Routes for the background jobs
+	// The jobs are started by the admin operations (e.g. the bulk delete of the departments), they are polled here
+	jobGroup := rg.Group("/jobs")
+	{
+		// Rate limiter middleware for the /jobs group, which is polled.
+		// - Allows a burst of up to 10 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+		jobGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 10*time.Minute))
+
+		// Initialize the job handler with the queue of the application
+		handler := NewJobHandler(nil)
+
+		// Define the route reporting the progress of a job
+		jobGroup.GET("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetJob)
+	}
+}
@@ -0,0 +1,261 @@
+package legacy
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Package legacy imports the departments of the legacy gorp-based application.
+// The legacy repository stored them in the employees.department table, with created_date and
+// updated_date columns instead of the created_at and updated_at columns of the GORM schema.
+// "app migrate-legacy" maps the rows to the department table in one transaction and prints a
+// verification report comparing what was read with what was stored.
+
+// DefaultTable is the table of the legacy repository.
+const DefaultTable = "employees.department"
+
+// tablePattern accepts a table name optionally qualified by its schema, since it is not a bound parameter.
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// LegacyDepartment represents a row of the legacy department table.
+type LegacyDepartment struct {
+	ID          string     `gorm:"column:id"`
+	DeptName    string     `gorm:"column:dept_name"`
+	Active      bool       `gorm:"column:active"`
+	CreatedBy   *int64     `gorm:"column:created_by"`
+	CreatedDate *time.Time `gorm:"column:created_date"`
+	UpdatedBy   *int64     `gorm:"column:updated_by"`
+	UpdatedDate *time.Time `gorm:"column:updated_date"`
+}
+
+// Config holds the migration configuration.
+type Config struct {
+	Table  string
+	DryRun bool
+}
+
+// ParseConfig parses the migration command-line flags.
+func ParseConfig(args []string) (Config, error) {
+	cfg := Config{}
+	fs := flag.NewFlagSet("migrate-legacy", flag.ContinueOnError)
+	fs.StringVar(&cfg.Table, "table", DefaultTable, "legacy department table, optionally qualified by its schema")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "run the migration and the verification, then roll everything back")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if !tablePattern.MatchString(cfg.Table) {
+		return Config{}, fmt.Errorf("invalid table name: %s", cfg.Table)
+	}
+
+	return cfg, nil
+}
+
+// Run runs the migration with the given command-line arguments and returns the exit code:
+// 0 when every row was imported and verified, 1 when rows were rejected, skipped or do not match
+// after the import, and 2 when the migration could not run.
+func Run(db *gorm.DB, args []string, out io.Writer) int {
+	cfg, err := ParseConfig(args)
+	if err != nil {
+		fmt.Fprintf(out, "migrate-legacy: %v\n", err)
+		return 2
+	}
+
+	if db == nil {
+		fmt.Fprintln(out, "migrate-legacy: database connection is not initialized")
+		return 2
+	}
+
+	// The mapped departments are validated with the same rules as the API
+	validate.InitValidator()
+
+	report, err := Migrate(db, cfg)
+	if err != nil {
+		fmt.Fprintf(out, "migrate-legacy: %v\n", err)
+		return 2
+	}
+
+	report.Print(out)
+	if !report.OK() {
+		return 1
+	}
+
+	return 0
+}
+
+// Migrate imports the legacy departments in one transaction.
+// Rows failing the department validation are rejected, and rows whose ID or name already exists
+// are skipped, so the migration can be run again after fixing the rejected rows.
+// The imported departments are read back and compared before the transaction is committed.
+func Migrate(db *gorm.DB, cfg Config) (Report, error) {
+	var rows []LegacyDepartment
+	if err := db.Table(cfg.Table).Order("id").Find(&rows).Error; err != nil {
+		return Report{}, fmt.Errorf("failed to read %s: %v", cfg.Table, err)
+	}
+
+	report := Report{Source: cfg.Table, DryRun: cfg.DryRun, Read: len(rows)}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		imported := make(map[string]department.Department)
+		for _, row := range rows {
+			d := MapDepartment(row)
+			if err := d.Validate(); err != nil {
+				report.Rejected = append(report.Rejected, Issue{ID: row.ID, Reason: describeValidationError(err)})
+				continue
+			}
+
+			// Keep the existing departments, the legacy data must not overwrite newer changes
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&d)
+			if result.Error != nil {
+				return fmt.Errorf("failed to import department %s: %v", d.ID, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				report.Skipped = append(report.Skipped, Issue{ID: d.ID, Reason: "a department with the same ID or name already exists"})
+				continue
+			}
+
+			imported[d.ID] = d
+		}
+
+		report.Imported = len(imported)
+		mismatches, err := verify(tx, imported)
+		if err != nil {
+			return err
+		}
+		report.Mismatches = mismatches
+
+		if cfg.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return Report{}, err
+	}
+
+	return report, nil
+}
+
+// MapDepartment converts a legacy row into a department of the GORM schema.
+// The legacy IDs and names may be padded (char columns), the audit dates are renamed and the
+// legacy rows had no tags, metadata or archive status. The departments are valid since their creation.
+func MapDepartment(row LegacyDepartment) department.Department {
+	d := department.Department{
+		ID:        strings.TrimSpace(row.ID),
+		DeptName:  strings.TrimSpace(row.DeptName),
+		Active:    row.Active,
+		Tags:      department.Tags{},
+		Metadata:  department.Metadata{},
+		Status:    department.StatusActive,
+		ValidFrom: row.CreatedDate,
+		CreatedBy: row.CreatedBy,
+		CreatedAt: row.CreatedDate,
+		UpdatedBy: row.UpdatedBy,
+		UpdatedAt: row.UpdatedDate,
+	}
+
+	// The legacy repository only set updated_date on updates
+	if d.UpdatedAt == nil {
+		d.UpdatedAt = d.CreatedAt
+	}
+
+	return d
+}
+
+// verify reads the imported departments back and compares them with the mapped rows.
+func verify(tx *gorm.DB, imported map[string]department.Department) ([]Issue, error) {
+	if len(imported) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, 0, len(imported))
+	for id := range imported {
+		ids = append(ids, id)
+	}
+
+	var stored []department.Department
+	if err := tx.Where("id IN ?", ids).Order("id").Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to verify the imported departments: %v", err)
+	}
+
+	var mismatches []Issue
+	found := make(map[string]bool, len(stored))
+	for _, s := range stored {
+		found[s.ID] = true
+		if diff := compare(imported[s.ID], s); diff != "" {
+			mismatches = append(mismatches, Issue{ID: s.ID, Reason: diff})
+		}
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			mismatches = append(mismatches, Issue{ID: id, Reason: "not found after the import"})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// compare returns the fields of the stored department that differ from the mapped row.
+func compare(expected department.Department, stored department.Department) string {
+	var diffs []string
+	if expected.DeptName != stored.DeptName {
+		diffs = append(diffs, "deptName")
+	}
+	if expected.Active != stored.Active {
+		diffs = append(diffs, "active")
+	}
+	if !sameTime(expected.CreatedAt, stored.CreatedAt) {
+		diffs = append(diffs, "createdAt")
+	}
+	if !sameTime(expected.UpdatedAt, stored.UpdatedAt) {
+		diffs = append(diffs, "updatedAt")
+	}
+
+	if len(diffs) == 0 {
+		return ""
+	}
+	return "different " + strings.Join(diffs, ", ")
+}
+
+// sameTime compares two optional times at the microsecond precision of PostgreSQL.
+// A missing legacy date is filled by the database default, so it matches any stored time.
+func sameTime(expected *time.Time, stored *time.Time) bool {
+	if expected == nil {
+		return true
+	}
+	if stored == nil {
+		return false
+	}
+
+	return expected.Truncate(time.Microsecond).Equal(stored.Truncate(time.Microsecond))
+}
+
+// describeValidationError lists the fields failing the validation, e.g. "id failed on len".
+func describeValidationError(err error) string {
+	var ve validator.ValidationErrors
+	if !errors.As(err, &ve) {
+		return err.Error()
+	}
+
+	reasons := make([]string, 0, len(ve))
+	for _, fe := range ve {
+		reasons = append(reasons, fmt.Sprintf("%s failed on %s", fe.Field(), fe.Tag()))
+	}
+
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,52 @@
+package legacy
+
+import (
+	"fmt"
+	"io"
+)
+
+// Issue describes a legacy row that was not imported or does not match after the import.
+type Issue struct {
+	ID     string
+	Reason string
+}
+
+// Report summarizes a migration.
+type Report struct {
+	Source     string
+	DryRun     bool
+	Read       int
+	Imported   int
+	Rejected   []Issue
+	Skipped    []Issue
+	Mismatches []Issue
+}
+
+// OK checks if every legacy row was imported and verified.
+func (r Report) OK() bool {
+	return len(r.Rejected) == 0 && len(r.Skipped) == 0 && len(r.Mismatches) == 0
+}
+
+// Print writes the verification report.
+func (r Report) Print(out io.Writer) {
+	fmt.Fprintf(out, "Legacy departments read from %s: %d\n", r.Source, r.Read)
+	fmt.Fprintf(out, "Imported:   %d\n", r.Imported)
+	fmt.Fprintf(out, "Rejected:   %d\n", len(r.Rejected))
+	fmt.Fprintf(out, "Skipped:    %d\n", len(r.Skipped))
+	fmt.Fprintf(out, "Mismatches: %d\n", len(r.Mismatches))
+
+	printIssues(out, "Rejected", r.Rejected)
+	printIssues(out, "Skipped", r.Skipped)
+	printIssues(out, "Mismatch", r.Mismatches)
+
+	if r.DryRun {
+		fmt.Fprintln(out, "Dry run: the changes were rolled back")
+	}
+}
+
+// printIssues writes one line per issue.
+func printIssues(out io.Writer, label string, issues []Issue) {
+	for _, issue := range issues {
+		fmt.Fprintf(out, "%s %q: %s\n", label, issue.ID, issue.Reason)
+	}
+}
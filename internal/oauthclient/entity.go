@@ -0,0 +1,128 @@
+package oauthclient
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var v *validator.Validate
+
+// SecretPrefix starts the client secrets, so a leaked secret is recognized by the secret scanners.
+const SecretPrefix = "dcs_"
+
+// secretBytes is the number of random bytes of a client secret, its SHA-256 digest can be stored without a slow hash.
+const secretBytes = 32
+
+// Scopes represents the list of scopes a client may request.
+// The scopes are the roles granted to the tokens of the client, e.g. ROLE_USER, stored as a JSON array in a jsonb column.
+type Scopes []string
+
+// Client represents an OAuth2 client, a back-end integration getting its access tokens with the client credentials grant.
+// The secret itself is never stored: the table holds its SHA-256 digest.
+// A client is valid until it is revoked.
+type Client struct {
+	ID         string     `gorm:"column:id;type:uuid;primaryKey" json:"id"`
+	Name       string     `gorm:"column:name;type:varchar(50);not null" json:"name"`
+	SecretHash string     `gorm:"column:secret_hash;type:varchar(64);not null" json:"-"`
+	Scopes     Scopes     `gorm:"column:scopes;type:jsonb;not null" json:"scopes"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at;type:timestamptz" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at;type:timestamptz" json:"revokedAt,omitempty"`
+	CreatedBy  *int64     `gorm:"column:created_by" json:"createdBy,omitempty"`
+	CreatedAt  *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+}
+
+// TableName returns the table of the clients.
+func (Client) TableName() string {
+	return "clients"
+}
+
+// IsActive reports whether the client is not revoked.
+func (c *Client) IsActive() bool {
+	return c.RevokedAt == nil
+}
+
+// ClientRequest is the body of a client registration.
+type ClientRequest struct {
+	Name   string   `json:"name" validate:"required,max=50"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=ROLE_USER ROLE_MODERATOR ROLE_AUDITOR ROLE_ADMIN"`
+}
+
+// Validate validates the ClientRequest struct using the validator package.
+func (r *ClientRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IssuedClient is a client as returned once at its registration, with its secret.
+type IssuedClient struct {
+	Client
+	Secret string `json:"secret"`
+}
+
+// Value implements the driver.Valuer interface.
+// It marshals the scopes into a JSON array.
+func (s Scopes) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+// It unmarshals the JSON array stored in the database into the scopes.
+func (s *Scopes) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	case nil:
+		*s = nil
+		return nil
+	default:
+		return errors.New("failed to scan scopes")
+	}
+
+	return json.Unmarshal(data, s)
+}
+
+// Contains checks if the given scope is part of the list.
+func (s Scopes) Contains(scope string) bool {
+	for _, allowed := range s {
+		if allowed == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generateSecret returns a new random client secret and its SHA-256 digest.
+func generateSecret() (string, string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	secret := SecretPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return secret, apikey.HashKey(secret), nil
+}
@@ -0,0 +1,110 @@
+package oauthclient
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// This struct defines the ClientHandler which handles HTTP requests related to the OAuth2 clients.
+// It contains a service field of type ClientService which is used to interact with the client data layer.
+type ClientHandler struct {
+	Service ClientService
+}
+
+// NewClientHandler creates a new instance of ClientHandler.
+// It initializes the ClientHandler struct with the provided ClientService.
+func NewClientHandler(clientService ClientService) *ClientHandler {
+	return &ClientHandler{Service: clientService}
+}
+
+// GetAllClients retrieves the clients, without their secrets.
+// @Summary      Get all clients
+// @Description  Get the OAuth2 clients, revoked ones included, the newest first
+// @Tags         clients
+// @Produce      json
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /clients [get]
+func (h *ClientHandler) GetAllClients(c *gin.Context) {
+	clients, err := h.Service.GetAllClients(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve clients", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "All Clients retrieved successfully", clients)
+}
+
+// CreateClient registers a client for the client credentials grant.
+// The secret is only returned in this response, it cannot be retrieved later.
+// @Summary      Register a client
+// @Description  Register an OAuth2 client getting its access tokens from /auth/token with the client credentials grant
+// @Tags         clients
+// @Accept       json
+// @Produce      json
+// @Param        request  body      ClientRequest  true  "Client request"
+// @Success      201  {object}  model.HttpResponse for successful registration
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /clients [post]
+func (h *ClientHandler) CreateClient(c *gin.Context) {
+	// Bind the JSON request body to the client request struct
+	var req ClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	issued, err := h.Service.CreateClient(c.Request.Context(), req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to register client", util.FormatValidationErrors(err))
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to register client", err.Error())
+		return
+	}
+
+	// The secret is a credential, it must not be kept by the caches
+	c.Header("Cache-Control", "no-store")
+	util.JSONSuccess(c, http.StatusCreated, "Client registered successfully, store the secret now as it cannot be retrieved again", issued)
+}
+
+// RevokeClient revokes a client.
+// @Summary      Revoke a client
+// @Description  Revoke a client, its token requests are refused from now on
+// @Tags         clients
+// @Produce      json
+// @Param        id  path      string  true  "Client ID"
+// @Success      200  {object}  model.HttpResponse for successful revocation
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /clients/{id} [delete]
+func (h *ClientHandler) RevokeClient(c *gin.Context) {
+	// The client IDs are UUIDs, the other values cannot match a client
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid client ID format", err.Error())
+		return
+	}
+
+	revoked, err := h.Service.RevokeClient(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to revoke client", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to revoke client", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Client revoked successfully", revoked)
+}
@@ -0,0 +1,23 @@
+package oauthclient
+
+import (
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Operations documents the client handlers in the OpenAPI spec, keyed by handler method name.
+// The errors listed here are the typed errors returned by the service for each operation.
+var Operations = map[string]openapi.Operation{
+	"GetAllClients": {Summary: "List the OAuth2 clients"},
+	"CreateClient": {
+		Summary:       "Register an OAuth2 client for the client credentials grant",
+		RequestSchema: "client",
+		SuccessStatus: http.StatusCreated,
+	},
+	"RevokeClient": {
+		Summary: "Revoke an OAuth2 client",
+		Errors:  []*apperror.Error{ErrClientNotFound},
+	},
+}
@@ -0,0 +1,77 @@
+package oauthclient
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Interface for client repository
+// This interface defines the methods that the client repository should implement
+type ClientRepository interface {
+	GetAllClients(tx *gorm.DB) ([]Client, error)
+	GetClientByID(tx *gorm.DB, id string) (Client, error)
+	CreateClient(ctx context.Context, tx *gorm.DB, c Client) (Client, error)
+	RevokeClient(ctx context.Context, tx *gorm.DB, c Client, revokedAt time.Time) (Client, error)
+	TouchClient(ctx context.Context, tx *gorm.DB, id string, usedAt time.Time) error
+}
+
+// This struct defines the ClientRepository that contains methods for interacting with the database
+// It implements the ClientRepository interface and provides methods for client-related operations
+type clientRepository struct{}
+
+// NewClientRepository creates a new instance of ClientRepository.
+// It initializes the clientRepository struct and returns it.
+func NewClientRepository() ClientRepository {
+	return &clientRepository{}
+}
+
+// GetAllClients retrieves the clients, revoked ones included, the newest first.
+func (r *clientRepository) GetAllClients(tx *gorm.DB) ([]Client, error) {
+	var clients []Client
+	if err := tx.Order("created_at DESC").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// GetClientByID retrieves a client by its ID.
+func (r *clientRepository) GetClientByID(tx *gorm.DB, id string) (Client, error) {
+	var client Client
+	err := tx.First(&client, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Client{}, ErrClientNotFound
+	}
+	if err != nil {
+		return Client{}, err
+	}
+
+	return client, nil
+}
+
+// CreateClient inserts a new client into the database and returns the created client.
+func (r *clientRepository) CreateClient(ctx context.Context, tx *gorm.DB, c Client) (Client, error) {
+	if err := tx.WithContext(ctx).Create(&c).Error; err != nil {
+		return Client{}, err
+	}
+
+	return c, nil
+}
+
+// RevokeClient marks a client as revoked at the given time.
+func (r *clientRepository) RevokeClient(ctx context.Context, tx *gorm.DB, c Client, revokedAt time.Time) (Client, error) {
+	if err := tx.WithContext(ctx).Model(&c).UpdateColumn("revoked_at", revokedAt).Error; err != nil {
+		return Client{}, err
+	}
+	c.RevokedAt = &revokedAt
+
+	return c, nil
+}
+
+// TouchClient records the last token request of a client.
+func (r *clientRepository) TouchClient(ctx context.Context, tx *gorm.DB, id string, usedAt time.Time) error {
+	return tx.WithContext(ctx).Model(&Client{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt).Error
+}
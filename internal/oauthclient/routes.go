@@ -0,0 +1,35 @@
+package oauthclient
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the client management routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Routes for client management
+	// These routes allow admins to register the back-end integrations using the client credentials grant
+	clientGroup := rg.Group("/clients")
+	{
+		// Rate limiter middleware for the /clients group, accessible only by admin users.
+		// - Allows a burst of up to 5 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+		clientGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 5, 10*time.Minute))
+
+		// Initialize the client repository, service and handler
+		repo := NewClientRepository()
+		service := NewClientService(repo)
+		handler := NewClientHandler(service)
+
+		// Define the routes for client management
+		clientGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetAllClients)
+		clientGroup.POST("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("client"), handler.CreateClient)
+		clientGroup.DELETE("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.RevokeClient)
+	}
+}
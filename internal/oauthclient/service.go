@@ -0,0 +1,167 @@
+package oauthclient
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrClientNotFound = apperror.New("ClientNotFound", http.StatusNotFound, "client with the given ID not found")
+	ErrInvalidClient  = apperror.New("InvalidClient", http.StatusUnauthorized, "the client is unknown, revoked or its secret is wrong")
+)
+
+// Interface for client service
+// This interface defines the methods that the client service should implement
+type ClientService interface {
+	GetAllClients(ctx context.Context) ([]Client, error)
+	CreateClient(ctx context.Context, req ClientRequest) (IssuedClient, error)
+	RevokeClient(ctx context.Context, id string) (Client, error)
+	Authenticate(ctx context.Context, id string, secret string) (Client, error)
+}
+
+// This struct defines the ClientService that contains a repository field of type ClientRepository
+type clientService struct {
+	repo ClientRepository
+}
+
+// NewClientService creates a new instance of ClientService with the given repository.
+// It initializes the clientService struct and returns it.
+func NewClientService(repo ClientRepository) ClientService {
+	return &clientService{repo: repo}
+}
+
+// GetAllClients retrieves the clients, without their secrets.
+func (s *clientService) GetAllClients(ctx context.Context) ([]Client, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	clients, err := s.repo.GetAllClients(db)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get all clients: %v", err))
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// CreateClient registers a client allowed to request the given scopes.
+// The secret is only returned here: the database holds its SHA-256 digest, a lost secret means a new client.
+func (s *clientService) CreateClient(ctx context.Context, req ClientRequest) (IssuedClient, error) {
+	// Validate the request struct using the validator
+	if err := req.Validate(); err != nil {
+		return IssuedClient{}, err
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return IssuedClient{}, errors.New("database connection is nil")
+	}
+
+	secret, hash, err := generateSecret()
+	if err != nil {
+		return IssuedClient{}, err
+	}
+
+	client := Client{
+		ID:         uuid.New().String(),
+		Name:       req.Name,
+		SecretHash: hash,
+		Scopes:     append(Scopes{}, req.Scopes...),
+	}
+	if meta, ok := metacontext.ExtractRequestMeta(ctx); ok {
+		client.CreatedBy = &meta.UserID
+	}
+
+	created, err := s.repo.CreateClient(ctx, db, client)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to create client %s: %v", req.Name, err))
+		return IssuedClient{}, err
+	}
+
+	return IssuedClient{Client: created, Secret: secret}, nil
+}
+
+// RevokeClient revokes a client, its token requests are refused from now on.
+// The tokens it already holds stay valid until they expire. Revoking a revoked client returns it unchanged.
+func (s *clientService) RevokeClient(ctx context.Context, id string) (Client, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Client{}, errors.New("database connection is nil")
+	}
+
+	var revoked Client
+	err := db.Transaction(func(tx *gorm.DB) error {
+		client, err := s.repo.GetClientByID(tx, id)
+		if err != nil {
+			return err
+		}
+		if !client.IsActive() {
+			revoked = client
+			return nil
+		}
+
+		revoked, err = s.repo.RevokeClient(ctx, tx, client, time.Now().UTC())
+		return err
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to revoke client %s: %v", id, err))
+		return Client{}, err
+	}
+
+	return revoked, nil
+}
+
+// Authenticate checks the credentials of a client requesting a token.
+// An unknown or revoked client and a wrong secret all return ErrInvalidClient, so the caller cannot tell them apart.
+// The digests are compared in constant time.
+func (s *clientService) Authenticate(ctx context.Context, id string, secret string) (Client, error) {
+	if _, err := uuid.Parse(id); err != nil || secret == "" {
+		return Client{}, ErrInvalidClient
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Client{}, errors.New("database connection is nil")
+	}
+
+	client, err := s.repo.GetClientByID(db, id)
+	if errors.Is(err, ErrClientNotFound) {
+		return Client{}, ErrInvalidClient
+	}
+	if err != nil {
+		return Client{}, err
+	}
+	if !client.IsActive() || subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(apikey.HashKey(secret))) != 1 {
+		return Client{}, ErrInvalidClient
+	}
+
+	// The last use is informative, a failure does not refuse the token request
+	if err := s.repo.TouchClient(ctx, db, client.ID, time.Now().UTC()); err != nil {
+		logger.Warn(fmt.Sprintf("failed to record the use of client %s: %v", client.ID, err))
+	}
+
+	return client, nil
+}
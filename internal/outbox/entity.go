@@ -0,0 +1,83 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+)
+
+// OutboxMessage represents a domain event waiting to be forwarded to the broker and the webhooks.
+// It is written in the same transaction as the mutation that produced the event,
+// so an event is never lost when the publishing fails after the commit.
+type OutboxMessage struct {
+	ID          int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EventID     string     `gorm:"column:event_id;type:varchar(36);not null;uniqueIndex" json:"eventId"`
+	EventType   string     `gorm:"column:event_type;type:varchar(100);not null" json:"eventType"`
+	Subject     string     `gorm:"column:subject;type:varchar(100);not null" json:"subject"`
+	Payload     string     `gorm:"column:payload;type:jsonb;not null" json:"payload"`
+	OccurredAt  time.Time  `gorm:"column:occurred_at;type:timestamptz;not null" json:"occurredAt"`
+	Attempts    int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	LastError   *string    `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	PublishedAt *time.Time `gorm:"column:published_at;type:timestamptz;index" json:"publishedAt,omitempty"`
+	CreatedAt   *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+
+	// Each sink is tracked on its own, so a retry only forwards the message to the sinks that failed.
+	// PublishedAt is set once every sink has received the message.
+	BrokerPublishedAt *time.Time `gorm:"column:broker_published_at;type:timestamptz" json:"brokerPublishedAt,omitempty"`
+	WebhooksQueuedAt  *time.Time `gorm:"column:webhooks_queued_at;type:timestamptz" json:"webhooksQueuedAt,omitempty"`
+}
+
+// Override the TableName method to specify the table name
+// in the database. This is optional if you want to use the default naming convention.
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
+
+// NewOutboxMessage creates an outbox message from a domain event.
+// The event data is stored as JSON so it can be replayed later.
+func NewOutboxMessage(e event.Event) (OutboxMessage, error) {
+	payload, err := json.Marshal(e.Data)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+
+	return OutboxMessage{
+		EventID:    e.ID,
+		EventType:  e.Type,
+		Subject:    e.Subject,
+		Payload:    string(payload),
+		OccurredAt: e.OccurredAt,
+	}, nil
+}
+
+// ToEvent converts the outbox message back to a domain event.
+// The data is kept as raw JSON, so the event is published exactly as it was stored.
+func (m *OutboxMessage) ToEvent() event.Event {
+	return event.Event{
+		ID:         m.EventID,
+		Type:       m.EventType,
+		Subject:    m.Subject,
+		OccurredAt: m.OccurredAt,
+		Data:       json.RawMessage(m.Payload),
+	}
+}
+
+// Equals compares two OutboxMessage objects for equality.
+func (m *OutboxMessage) Equals(other *OutboxMessage) bool {
+	if m == nil && other == nil {
+		return true
+	}
+
+	if m == nil || other == nil {
+		return false
+	}
+
+	if (m.ID != other.ID) ||
+		(m.EventID != other.EventID) ||
+		(m.EventType != other.EventType) {
+		return false
+	}
+
+	return true
+}
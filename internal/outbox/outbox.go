@@ -0,0 +1,300 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// flushCheckInterval is the interval at which Flush checks if the dispatcher has run.
+const flushCheckInterval = 50 * time.Millisecond
+
+var (
+	OutboxPollIntervalSeconds string
+	OutboxBatchSize           string
+	OutboxMaxAttempts         string
+
+	repo          = NewOutboxRepository()
+	dispatcher    *Dispatcher
+	webhookSink   Sink
+	webhookNotify func()
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	OutboxPollIntervalSeconds = os.Getenv("OUTBOX_POLL_INTERVAL_SECONDS")
+	OutboxBatchSize = os.Getenv("OUTBOX_BATCH_SIZE")
+	OutboxMaxAttempts = os.Getenv("OUTBOX_MAX_ATTEMPTS")
+}
+
+// Add writes a domain event to the outbox.
+// It must be called with the transaction of the mutation that produced the event,
+// so the event is stored if and only if the mutation is committed.
+func Add(ctx context.Context, tx *gorm.DB, e event.Event) error {
+	m, err := NewOutboxMessage(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := repo.CreateMessage(ctx, tx, m); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Bus is the interface through which the services write their domain events.
+// Services take it as an option, so tests can record the events instead of writing them to the outbox.
+type Bus interface {
+	Add(ctx context.Context, tx *gorm.DB, e event.Event) error
+}
+
+// DefaultBus is the bus writing the events to the transactional outbox with Add.
+var DefaultBus Bus = outboxBus{}
+
+// outboxBus writes the events to the transactional outbox.
+type outboxBus struct{}
+
+func (outboxBus) Add(ctx context.Context, tx *gorm.DB, e event.Event) error { return Add(ctx, tx, e) }
+
+// Sink queues an event for a destination with the transaction of the outbox, e.g. the webhook deliveries.
+type Sink func(ctx context.Context, tx *gorm.DB, e event.Event) error
+
+// SetWebhookSink sets the sink queuing the webhook deliveries of the events, and the function notified
+// once they are committed. Without a sink, the messages are published once the broker has received them.
+func SetWebhookSink(sink Sink, notify func()) {
+	webhookSink = sink
+	webhookNotify = notify
+}
+
+// Notify wakes up the dispatcher so the committed events are forwarded without waiting for the next poll.
+// It never blocks the caller.
+func Notify() {
+	if dispatcher == nil {
+		return
+	}
+
+	select {
+	case dispatcher.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Dispatcher forwards the outbox messages to the configured broker and webhooks.
+// Messages are read in batches in the order they were written and marked as published once every sink
+// has received them; a failed message is retried on the next run, for the sinks that failed only, until the
+// maximum number of attempts is reached. The broker delivery is at-least-once: consumers should use
+// the event ID to ignore duplicates. The webhook deliveries are queued once.
+type Dispatcher struct {
+	db           *gorm.DB
+	repo         OutboxRepository
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	wakeup       chan struct{}
+	lastRun      atomic.Int64
+}
+
+// NewDispatcher creates an outbox dispatcher configured from the environment variables, without starting it.
+func NewDispatcher(db *gorm.DB, repo OutboxRepository) *Dispatcher {
+	return &Dispatcher{
+		db:           db,
+		repo:         repo,
+		pollInterval: time.Duration(getEnvInt(OutboxPollIntervalSeconds, 5)) * time.Second,
+		batchSize:    getEnvInt(OutboxBatchSize, 100),
+		maxAttempts:  getEnvInt(OutboxMaxAttempts, 10),
+		wakeup:       make(chan struct{}, 1),
+	}
+}
+
+// InitDispatcher initializes the outbox dispatcher and starts polling the outbox table.
+func InitDispatcher(db *gorm.DB) {
+	if db == nil {
+		logger.Error("Failed to start outbox dispatcher: database connection is nil")
+		return
+	}
+
+	dispatcher = NewDispatcher(db, repo)
+
+	dispatcher.lastRun.Store(time.Now().UnixNano())
+	go dispatcher.run()
+
+	// Report the dispatcher as degraded when it stops polling (e.g. stuck on a broker call)
+	health.Register("outbox-dispatcher", health.NonCritical, CheckHealth)
+
+	// Forward the events of the last requests before the process exits
+	drain.RegisterJob("outbox-dispatcher", Flush)
+
+	logger.Info(fmt.Sprintf("Outbox dispatcher started with a poll interval of %s", dispatcher.pollInterval))
+}
+
+// run dispatches the outbox on every tick or wake-up.
+func (d *Dispatcher) run() {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.wakeup:
+		}
+
+		// Keep dispatching while full batches are found
+		for {
+			n, err := d.DispatchBatch()
+			if err != nil {
+				logger.Error(fmt.Sprintf("failed to dispatch outbox: %v", err))
+				break
+			}
+			if n < d.batchSize {
+				break
+			}
+		}
+
+		d.lastRun.Store(time.Now().UnixNano())
+	}
+}
+
+// CheckHealth reports an error when the dispatcher has not completed a run for three poll intervals.
+func CheckHealth(ctx context.Context) error {
+	if dispatcher == nil {
+		return errors.New("outbox dispatcher is not started")
+	}
+
+	since := time.Since(time.Unix(0, dispatcher.lastRun.Load()))
+	if since > 3*dispatcher.pollInterval {
+		return fmt.Errorf("outbox dispatcher has not run for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
+
+// Flush wakes up the dispatcher and waits for a run started after the call to complete,
+// so the events committed until now are forwarded.
+func Flush(ctx context.Context) error {
+	if dispatcher == nil {
+		return nil
+	}
+
+	since := time.Now().UnixNano()
+	Notify()
+
+	ticker := time.NewTicker(flushCheckInterval)
+	defer ticker.Stop()
+
+	for dispatcher.lastRun.Load() < since {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// DispatchBatch forwards one batch of pending messages and returns the number of messages processed.
+func (d *Dispatcher) DispatchBatch() (int, error) {
+	ctx := context.Background()
+
+	var processed int
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the pending messages so other instances skip them
+		messages, err := d.repo.GetPendingMessages(tx, d.batchSize, d.maxAttempts)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			processed++
+
+			if err := d.forward(ctx, tx, m); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Deliver the queued webhooks now they are committed
+	if processed > 0 && webhookNotify != nil {
+		webhookNotify()
+	}
+
+	return processed, nil
+}
+
+// forward forwards a message to the sinks it has not reached yet and records the attempt.
+// The message is published once the broker has received it and its webhook deliveries are queued.
+func (d *Dispatcher) forward(ctx context.Context, tx *gorm.DB, m OutboxMessage) error {
+	e := m.ToEvent()
+	now := time.Now()
+	var errs []error
+
+	// The webhook deliveries are queued in the transaction of the outbox, so they are created exactly once.
+	// The savepoint keeps the transaction usable when the queuing fails.
+	if m.WebhooksQueuedAt == nil {
+		err := tx.Transaction(func(sp *gorm.DB) error {
+			if webhookSink == nil {
+				return nil
+			}
+			return webhookSink(ctx, sp, e)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhooks: %w", err))
+		} else {
+			m.WebhooksQueuedAt = &now
+		}
+	}
+
+	if m.BrokerPublishedAt == nil {
+		if err := event.Publish(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("broker: %w", err))
+		} else {
+			m.BrokerPublishedAt = &now
+		}
+	}
+
+	// The in-process subscribers (e.g. the event stream) are best effort, they are notified on the first attempt
+	if m.Attempts == 0 {
+		event.NotifySubscribers(e)
+	}
+
+	m.LastError = nil
+	if len(errs) == 0 {
+		m.PublishedAt = &now
+	} else {
+		lastError := errors.Join(errs...).Error()
+		m.LastError = &lastError
+
+		if m.Attempts+1 >= d.maxAttempts {
+			logger.Error(fmt.Sprintf("outbox message %d (event %s) abandoned after %d attempts: %s", m.ID, m.EventID, m.Attempts+1, lastError))
+		}
+	}
+
+	return d.repo.SaveAttempt(ctx, tx, m)
+}
+
+// getEnvInt parses an integer environment value, falling back to the default value when it is missing or invalid.
+func getEnvInt(value string, defaultValue int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return defaultValue
+	}
+
+	return n
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Interface for outbox repository
+// This interface defines the methods that the outbox repository should implement
+type OutboxRepository interface {
+	GetPendingMessages(tx *gorm.DB, limit int, maxAttempts int) ([]OutboxMessage, error)
+	CreateMessage(ctx context.Context, tx *gorm.DB, m OutboxMessage) (OutboxMessage, error)
+	SaveAttempt(ctx context.Context, tx *gorm.DB, m OutboxMessage) error
+}
+
+// This struct defines the OutboxRepository that contains methods for interacting with the database
+// It implements the OutboxRepository interface and provides methods for outbox-related operations
+type outboxRepository struct{}
+
+// NewOutboxRepository creates a new instance of OutboxRepository.
+// It initializes the outboxRepository struct and returns it.
+func NewOutboxRepository() OutboxRepository {
+	return &outboxRepository{}
+}
+
+// GetPendingMessages retrieves the oldest messages not yet published.
+// The rows are locked with SKIP LOCKED so several instances can dispatch the outbox concurrently
+// without forwarding the same message twice; it must be called inside a transaction.
+func (r *outboxRepository) GetPendingMessages(tx *gorm.DB, limit int, maxAttempts int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("published_at IS NULL AND attempts < ?", maxAttempts).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// CreateMessage inserts a new message into the outbox.
+func (r *outboxRepository) CreateMessage(ctx context.Context, tx *gorm.DB, m OutboxMessage) (OutboxMessage, error) {
+	if err := tx.WithContext(ctx).Create(&m).Error; err != nil {
+		return OutboxMessage{}, err
+	}
+
+	return m, nil
+}
+
+// SaveAttempt records a forwarding attempt: the sinks the message reached, whether it is published
+// and the error of the attempt.
+func (r *outboxRepository) SaveAttempt(ctx context.Context, tx *gorm.DB, m OutboxMessage) error {
+	return tx.WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id = ?", m.ID).
+		Updates(map[string]interface{}{
+			"broker_published_at": m.BrokerPublishedAt,
+			"webhooks_queued_at":  m.WebhooksQueuedAt,
+			"published_at":        m.PublishedAt,
+			"attempts":            gorm.Expr("attempts + 1"),
+			"last_error":          m.LastError,
+		}).Error
+}
@@ -10,25 +10,71 @@ import (
 var v *validator.Validate
 
 // RefreshToken represents the refresh token entity in the database.
+// Each refresh token is a session of the user on a device: a user holds one token per login,
+// and refreshing rotates the token of the session while keeping its ID.
+// A client sending its own ID at login holds a single session, its new login replaces the previous one.
+// A remembered session (rememberMe at login) lives longer, its access tokens still expire as usual.
 type RefreshToken struct {
-	Token      string    `gorm:"column:token;type:text;primaryKey;unique;not null" json:"token" validate:"required"`
-	UserID     int64     `gorm:"column:user_id;primaryKey;unique;not null" json:"userId" validate:"required"`
+	ID         string    `gorm:"column:id;type:uuid;primaryKey" json:"id"`
+	Token      string    `gorm:"column:token;type:text;uniqueIndex;not null" json:"token" validate:"required"`
+	UserID     int64     `gorm:"column:user_id;index;index:idx_refresh_token_user_client;not null" json:"userId" validate:"required"`
+	ClientID   string    `gorm:"column:client_id;type:varchar(64);index:idx_refresh_token_user_client;not null;default:''" json:"clientId"`
 	ExpiryDate time.Time `gorm:"column:expiry_date;type:timestamptz;not null" json:"expiryDate" validate:"required"`
+	RememberMe bool      `gorm:"column:remember_me;not null;default:false" json:"rememberMe"`
+	// Device is the user agent of the client, DeviceLabel its short label (e.g. "Chrome on Windows")
+	Device      string    `gorm:"column:device;type:varchar(255);not null;default:''" json:"device"`
+	DeviceLabel string    `gorm:"column:device_label;type:varchar(50);not null;default:''" json:"deviceLabel"`
+	IPAddress   string    `gorm:"column:ip_address;type:varchar(45);not null;default:''" json:"ipAddress"`
+	CreatedAt   time.Time `gorm:"column:created_at;type:timestamptz;not null" json:"createdAt"`
+	LastUsedAt  time.Time `gorm:"column:last_used_at;type:timestamptz;not null" json:"lastUsedAt"`
+	// AuthTime is the last time the user entered their password in the session, at the login or a re-authentication,
+	// nil for the sessions created before it was recorded
+	AuthTime *time.Time `gorm:"column:auth_time;type:timestamptz" json:"authTime,omitempty"`
+}
+
+// Session is a refresh token as listed to its user, without the token itself.
+// Current is set for the session of the access token listing the sessions.
+type Session struct {
+	ID          string    `json:"id"`
+	ClientID    string    `json:"clientId,omitempty"`
+	Device      string    `json:"device"`
+	DeviceLabel string    `json:"deviceLabel"`
+	IPAddress   string    `json:"ipAddress"`
+	RememberMe  bool      `json:"rememberMe"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastUsedAt  time.Time `json:"lastUsedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Current     bool      `json:"current"`
+}
+
+// Client describes the device and the address a refresh token is issued to.
+// ClientID is the ID the client gave itself, e.g. an installation ID, empty for the clients without one.
+// Device is the user agent of the client.
+type Client struct {
+	ClientID  string
+	Device    string
+	IPAddress string
 }
 
 // RefreshTokenRequest represents the request payload for refreshing a token.
 // It contains the refresh token that needs to be validated and used to obtain a new access token.
+// The refresh token comes from its cookie when the tokens are delivered in cookies.
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refreshToken" validate:"required"`
+	// Client is the device and the address the request comes from, set by the handler
+	Client Client `json:"-"`
 }
 
 // RefreshTokenResponse represents the response payload for refreshing a token.
 // It contains the new access token, refresh token, expiration date, and token type.
+// The tokens are left out of the body when they are delivered in cookies (see pkg/tokencookie).
 type RefreshTokenResponse struct {
-	AccessToken    string `json:"accessToken"`
-	RefreshToken   string `json:"refreshToken"`
+	AccessToken    string `json:"accessToken,omitempty"`
+	RefreshToken   string `json:"refreshToken,omitempty"`
 	ExpirationDate string `json:"expirationDate"`
 	TokenType      string `json:"tokenType"`
+	// RefreshExpiresAt is the expiry of the refresh token, the one of its cookie
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
 // TableName override the table name used by RefreshToken to `refresh_token`.
@@ -46,7 +92,8 @@ func (r *RefreshToken) Equals(other *RefreshToken) bool {
 		return false
 	}
 
-	if (r.Token != other.Token) ||
+	if (r.ID != other.ID) ||
+		(r.Token != other.Token) ||
 		(r.UserID != other.UserID) ||
 		(r.ExpiryDate != other.ExpiryDate) {
 		return false
@@ -55,6 +102,31 @@ func (r *RefreshToken) Equals(other *RefreshToken) bool {
 	return true
 }
 
+// AuthenticatedAt returns the last time the user entered their password in the session,
+// the creation of the session when it was not recorded.
+func (r *RefreshToken) AuthenticatedAt() time.Time {
+	if r.AuthTime != nil {
+		return *r.AuthTime
+	}
+
+	return r.CreatedAt
+}
+
+// Session returns the refresh token as a session of its user.
+func (r *RefreshToken) Session() Session {
+	return Session{
+		ID:          r.ID,
+		ClientID:    r.ClientID,
+		Device:      r.Device,
+		DeviceLabel: r.DeviceLabel,
+		IPAddress:   r.IPAddress,
+		RememberMe:  r.RememberMe,
+		CreatedAt:   r.CreatedAt,
+		LastUsedAt:  r.LastUsedAt,
+		ExpiresAt:   r.ExpiryDate,
+	}
+}
+
 // Validate validates the RefreshTokenRequest struct using the validator package.
 // It checks if the struct fields meet the specified validation rules.
 func (a *RefreshTokenRequest) Validate() error {
@@ -2,17 +2,25 @@ package refreshtoken
 
 import (
 	"context"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Interface for refresh token repository
 // This interface defines the methods that the refresh token repository should implement
 type RefreshTokenRepository interface {
-	GetRefreshTokenByUserID(tx *gorm.DB, userID int64) (RefreshToken, error)
+	GetRefreshTokensByUserID(tx *gorm.DB, userID int64, now time.Time) ([]RefreshToken, error)
 	GetRefreshTokenByToken(tx *gorm.DB, token string) (RefreshToken, error)
+	CountActiveRefreshTokens(tx *gorm.DB, now time.Time) (int64, error)
 	CreateRefreshToken(ctx context.Context, tx *gorm.DB, token RefreshToken) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, tx *gorm.DB, oldToken string, token RefreshToken) (RefreshToken, error)
+	UpdateAuthTime(ctx context.Context, tx *gorm.DB, userID int64, id string, authTime time.Time) (RefreshToken, error)
+	RemoveRefreshTokenByID(ctx context.Context, tx *gorm.DB, userID int64, id string) (RefreshToken, error)
 	RemoveRefreshTokenByUserID(ctx context.Context, tx *gorm.DB, userID int64) (bool, error)
+	RemoveRefreshTokenByClientID(ctx context.Context, tx *gorm.DB, userID int64, clientID string) (bool, error)
+	RemoveExpiredRefreshTokens(ctx context.Context, tx *gorm.DB, userID int64, now time.Time) (bool, error)
 }
 
 // This struct defines the RefreshTokenRepository that contains methods for interacting with the database
@@ -25,16 +33,30 @@ func NewRefreshTokenRepository() RefreshTokenRepository {
 	return &refreshTokenRepository{}
 }
 
-// GetRefreshTokenByUserID retrieves a refresh token by its user ID from the database.
-func (r *refreshTokenRepository) GetRefreshTokenByUserID(tx *gorm.DB, userID int64) (RefreshToken, error) {
-	// Select the refresh token with the given user ID from the database
-	var refreshToken RefreshToken
-	err := tx.First(&refreshToken, "user_id = ?", userID).Error
+// GetRefreshTokensByUserID retrieves the refresh tokens of a user not expired at the given time,
+// the most recently used first.
+func (r *refreshTokenRepository) GetRefreshTokensByUserID(tx *gorm.DB, userID int64, now time.Time) ([]RefreshToken, error) {
+	// Select the refresh tokens with the given user ID from the database
+	var refreshTokens []RefreshToken
+	err := tx.Where("user_id = ? AND expiry_date > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&refreshTokens).Error
 	if err != nil {
-		return RefreshToken{}, err
+		return nil, err
 	}
 
-	return refreshToken, nil
+	return refreshTokens, nil
+}
+
+// CountActiveRefreshTokens counts the refresh tokens of all the users not expired at the given time.
+func (r *refreshTokenRepository) CountActiveRefreshTokens(tx *gorm.DB, now time.Time) (int64, error) {
+	var count int64
+	err := tx.Model(&RefreshToken{}).Where("expiry_date > ?", now).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
 }
 
 // GetRefreshTokenByToken retrieves a refresh token by its token string from the database.
@@ -59,12 +81,91 @@ func (r *refreshTokenRepository) CreateRefreshToken(ctx context.Context, tx *gor
 	return token, nil
 }
 
-// RemoveRefreshTokenByUserID removes a refresh token by its user ID from the database.
+// RotateRefreshToken replaces the token string of a session, its expiration date, device, address and last use.
+// The session is only updated while it still holds the old token, so a token refreshed twice concurrently
+// is rotated once and gorm.ErrRecordNotFound is returned to the other request.
+func (r *refreshTokenRepository) RotateRefreshToken(ctx context.Context, tx *gorm.DB, oldToken string, token RefreshToken) (RefreshToken, error) {
+	result := tx.WithContext(ctx).Model(&RefreshToken{}).
+		Where("id = ? AND token = ?", token.ID, oldToken).
+		Updates(map[string]interface{}{
+			"token":        token.Token,
+			"expiry_date":  token.ExpiryDate,
+			"device":       token.Device,
+			"device_label": token.DeviceLabel,
+			"ip_address":   token.IPAddress,
+			"last_used_at": token.LastUsedAt,
+		})
+	if result.Error != nil {
+		return RefreshToken{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return RefreshToken{}, gorm.ErrRecordNotFound
+	}
+
+	return token, nil
+}
+
+// UpdateAuthTime sets the authentication time of a session of a user, not expired at that time, and returns the session.
+// gorm.ErrRecordNotFound is returned when the user has no such session with the ID.
+func (r *refreshTokenRepository) UpdateAuthTime(ctx context.Context, tx *gorm.DB, userID int64, id string, authTime time.Time) (RefreshToken, error) {
+	var refreshTokens []RefreshToken
+	result := tx.WithContext(ctx).Model(&refreshTokens).Clauses(clause.Returning{}).
+		Where("id = ? AND user_id = ? AND expiry_date > ?", id, userID, authTime).
+		Update("auth_time", authTime)
+	if result.Error != nil {
+		return RefreshToken{}, result.Error
+	}
+	if result.RowsAffected == 0 || len(refreshTokens) == 0 {
+		return RefreshToken{}, gorm.ErrRecordNotFound
+	}
+
+	return refreshTokens[0], nil
+}
+
+// RemoveRefreshTokenByID removes a session of a user by its ID from the database and returns it.
+// gorm.ErrRecordNotFound is returned when the user has no session with the ID.
+func (r *refreshTokenRepository) RemoveRefreshTokenByID(ctx context.Context, tx *gorm.DB, userID int64, id string) (RefreshToken, error) {
+	// Delete the refresh token with the given ID and user ID, returning the deleted row
+	var refreshTokens []RefreshToken
+	result := tx.WithContext(ctx).Clauses(clause.Returning{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Delete(&refreshTokens)
+	if result.Error != nil {
+		return RefreshToken{}, result.Error
+	}
+	if result.RowsAffected == 0 || len(refreshTokens) == 0 {
+		return RefreshToken{}, gorm.ErrRecordNotFound
+	}
+
+	return refreshTokens[0], nil
+}
+
+// RemoveRefreshTokenByUserID removes all the refresh tokens of a user from the database.
 func (r *refreshTokenRepository) RemoveRefreshTokenByUserID(ctx context.Context, tx *gorm.DB, userID int64) (bool, error) {
-	// Delete the refresh token with the given user ID from the database
+	// Delete the refresh tokens with the given user ID from the database
 	if err := tx.WithContext(ctx).Where("user_id = ?", userID).Delete(&RefreshToken{}).Error; err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
+
+// RemoveRefreshTokenByClientID removes the session of a user on the client with the given ID from the database.
+func (r *refreshTokenRepository) RemoveRefreshTokenByClientID(ctx context.Context, tx *gorm.DB, userID int64, clientID string) (bool, error) {
+	// Delete the refresh tokens with the given user ID and client ID from the database
+	if err := tx.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&RefreshToken{}).Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RemoveExpiredRefreshTokens removes the refresh tokens of a user expired at the given time.
+func (r *refreshTokenRepository) RemoveExpiredRefreshTokens(ctx context.Context, tx *gorm.DB, userID int64, now time.Time) (bool, error) {
+	// Delete the expired refresh tokens with the given user ID from the database
+	if err := tx.WithContext(ctx).Where("user_id = ? AND expiry_date <= ?", userID, now).Delete(&RefreshToken{}).Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
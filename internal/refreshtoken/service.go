@@ -9,58 +9,124 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/useragent"
 	"gorm.io/gorm"
 )
 
 var (
-	JWTRefreshTokenExpirationHour string
+	JWTRefreshTokenExpirationHour           string
+	JWTRememberMeRefreshTokenExpirationHour string
+)
+
+// The client details are cut to the length of their columns
+const (
+	maxClientIDLength  = 64
+	maxDeviceLength    = 255
+	maxIPAddressLength = 45
 )
 
 // LoadEnv loads the environment variables.
 func LoadEnv() {
 	JWTRefreshTokenExpirationHour = os.Getenv("JWT_REFRESH_TOKEN_EXPIRATION_HOUR")
+	JWTRememberMeRefreshTokenExpirationHour = os.Getenv("JWT_REMEMBER_ME_REFRESH_TOKEN_EXPIRATION_HOUR")
 }
 
 // This struct defines the RefreshTokenService that contains a repository field of type RefreshTokenRepository
 // It implements the RefreshTokenService interface and provides methods for refresh token-related operations
 type RefreshTokenService interface {
-	GetRefreshTokenByUserID(ctx context.Context, userID int64) (RefreshToken, error)
+	GetSessionsByUserID(ctx context.Context, userID int64) ([]RefreshToken, error)
+	CountActiveSessions(ctx context.Context) (int64, error)
 	GetRefreshTokenByToken(ctx context.Context, token string) (RefreshToken, error)
 	VerifyExpirationDate(ctx context.Context, exp time.Time) (bool, error)
-	CreateRefreshToken(ctx context.Context, userID int64) (RefreshToken, error)
+	CreateRefreshToken(ctx context.Context, userID int64, client Client, rememberMe bool) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, token RefreshToken, client Client) (RefreshToken, error)
+	Reauthenticate(ctx context.Context, userID int64, sessionID string) (RefreshToken, error)
 }
 
 // This struct defines the RefreshTokenService that contains a repository field of type RefreshTokenRepository
 // It implements the RefreshTokenService interface and provides methods for refresh token-related operations
 type refreshTokenService struct {
-	repo RefreshTokenRepository
+	repo          RefreshTokenRepository
+	clock         clock.Clock
+	tokenTTL      time.Duration
+	rememberMeTTL time.Duration
+}
+
+// Option configures a refresh token service.
+type Option func(*refreshTokenService)
+
+// WithClock sets the clock used to compute and verify the expiration dates.
+func WithClock(c clock.Clock) Option {
+	return func(s *refreshTokenService) {
+		s.clock = c
+	}
+}
+
+// WithTokenTTL sets the validity of the new refresh tokens,
+// instead of JWT_REFRESH_TOKEN_EXPIRATION_HOUR.
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *refreshTokenService) {
+		s.tokenTTL = ttl
+	}
+}
+
+// WithRememberMeTTL sets the validity of the new refresh tokens of the remembered sessions,
+// instead of JWT_REMEMBER_ME_REFRESH_TOKEN_EXPIRATION_HOUR.
+func WithRememberMeTTL(ttl time.Duration) Option {
+	return func(s *refreshTokenService) {
+		s.rememberMeTTL = ttl
+	}
 }
 
 // NewRefreshTokenService creates a new instance of RefreshTokenService with the given repository.
-// It initializes the refreshTokenService struct and returns it.
-func NewRefreshTokenService(repo RefreshTokenRepository) RefreshTokenService {
-	return &refreshTokenService{repo: repo}
+// It initializes the refreshTokenService struct, applies the options and returns it.
+func NewRefreshTokenService(repo RefreshTokenRepository, opts ...Option) RefreshTokenService {
+	s := &refreshTokenService{repo: repo, clock: clock.System}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-// GetRefreshTokenByUserID retrieves a refresh token by its user ID from the database.
-func (s *refreshTokenService) GetRefreshTokenByUserID(ctx context.Context, userID int64) (RefreshToken, error) {
+// GetSessionsByUserID retrieves the sessions of a user, i.e. its refresh tokens not expired yet.
+func (s *refreshTokenService) GetSessionsByUserID(ctx context.Context, userID int64) ([]RefreshToken, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
 	if db == nil {
 		logger.Error("database connection is nil")
-		return RefreshToken{}, errors.New("database connection is nil")
+		return nil, errors.New("database connection is nil")
 	}
 
-	// Retrieve the token by user ID from the repository
-	token, err := s.repo.GetRefreshTokenByUserID(db, userID)
+	// Retrieve the tokens by user ID from the repository
+	tokens, err := s.repo.GetRefreshTokensByUserID(db, userID, s.clock.Now())
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to get refresh token by user ID: %v", err))
-		return RefreshToken{}, err
+		logger.Error(fmt.Sprintf("failed to get refresh tokens by user ID: %v", err))
+		return nil, err
 	}
 
-	return token, nil
+	return tokens, nil
+}
+
+// CountActiveSessions counts the sessions of all the users, i.e. the refresh tokens not expired yet.
+func (s *refreshTokenService) CountActiveSessions(ctx context.Context) (int64, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return 0, errors.New("database connection is nil")
+	}
+
+	count, err := s.repo.CountActiveRefreshTokens(db.WithContext(ctx), s.clock.Now())
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to count active sessions: %v", err))
+		return 0, err
+	}
+
+	return count, nil
 }
 
 // GetRefreshTokenByToken retrieves a refresh token by its token string from the database.
@@ -82,25 +148,28 @@ func (s *refreshTokenService) GetRefreshTokenByToken(ctx context.Context, token
 	return refreshToken, nil
 }
 
-// VerifyExpirationDate checks if the expiration date is valid and not in the past.
+// VerifyExpirationDate checks if the expiration date is valid and not reached yet.
+// Like the exp claim of the access tokens, a token is expired from its expiration date on.
+// The instants are compared, so the time zone of the expiration date does not matter.
 func (s *refreshTokenService) VerifyExpirationDate(ctx context.Context, exp time.Time) (bool, error) {
 	// Check if the expiration date is valid
 	if exp.IsZero() {
 		return false, errors.New("expiration date is zero")
 	}
 
-	// Check if the expiration date is in the past
-	if time.Now().After(exp) {
+	// Check if the expiration date is reached
+	if !s.clock.Now().Before(exp) {
 		return false, nil
 	}
 
 	return true, nil
 }
 
-// CreateRefreshToken creates a new refresh token for the user in the database.
-// If a refresh token already exists for the user, it will be removed before creating a new one,
-// ensuring that only one refresh token exists for each user at a time.
-func (s *refreshTokenService) CreateRefreshToken(ctx context.Context, userID int64) (RefreshToken, error) {
+// CreateRefreshToken creates a new session for the user on the given client.
+// The other sessions of the user are kept, only its expired refresh tokens are removed.
+// A client with an ID keeps a single session: its previous session, if any, is replaced by the new one.
+// A remembered session gets the longer validity of the remember-me refresh tokens, kept on every rotation.
+func (s *refreshTokenService) CreateRefreshToken(ctx context.Context, userID int64, client Client, rememberMe bool) (RefreshToken, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
 	if db == nil {
@@ -108,36 +177,42 @@ func (s *refreshTokenService) CreateRefreshToken(ctx context.Context, userID int
 		return RefreshToken{}, errors.New("database connection is nil")
 	}
 
+	now := s.clock.Now()
 	var createdRefreshToken RefreshToken
 	err := db.Transaction(func(tx *gorm.DB) error {
-		// Check if the refresh token already exists for the user
-		existingRefreshToken, err := s.repo.GetRefreshTokenByUserID(tx, userID)
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		// Remove the expired sessions of the user, so they do not pile up
+		if _, err := s.repo.RemoveExpiredRefreshTokens(ctx, tx, userID, now); err != nil {
 			return err
 		}
 
-		// If the refresh token already exists, remove it
-		if !existingRefreshToken.Equals(&RefreshToken{}) {
-			if _, err := s.repo.RemoveRefreshTokenByUserID(ctx, tx, userID); err != nil {
+		// A new login on the client ends its previous session, the access tokens of that session expire as usual
+		clientID := truncate(client.ClientID, maxClientIDLength)
+		if clientID != "" {
+			if _, err := s.repo.RemoveRefreshTokenByClientID(ctx, tx, userID, clientID); err != nil {
 				return err
 			}
 		}
 
 		// Create a new refresh token
-		tokenStr := uuid.New().String()
 		refreshToken := RefreshToken{
-			Token:      tokenStr,
-			UserID:     userID,
-			ExpiryDate: GetRefreshTokenExpiration(time.Now()),
+			ID:          uuid.New().String(),
+			Token:       uuid.New().String(),
+			UserID:      userID,
+			ClientID:    clientID,
+			ExpiryDate:  s.expiration(now, rememberMe),
+			RememberMe:  rememberMe,
+			Device:      truncate(client.Device, maxDeviceLength),
+			DeviceLabel: useragent.Label(client.Device),
+			IPAddress:   truncate(client.IPAddress, maxIPAddressLength),
+			CreatedAt:   now,
+			LastUsedAt:  now,
+			AuthTime:    &now,
 		}
 
 		// Create the refresh token in the database
+		var err error
 		createdRefreshToken, err = s.repo.CreateRefreshToken(ctx, tx, refreshToken)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		return err
 	})
 
 	if err != nil {
@@ -148,6 +223,78 @@ func (s *refreshTokenService) CreateRefreshToken(ctx context.Context, userID int
 	return createdRefreshToken, nil
 }
 
+// RotateRefreshToken replaces the token of a session used from the given client.
+// The session keeps its ID, its address and last use are updated and its expiration is extended.
+// Its device is updated as well when the client sends its user agent, e.g. after an update of the browser.
+// A token already rotated by a concurrent request is refused with gorm.ErrRecordNotFound.
+func (s *refreshTokenService) RotateRefreshToken(ctx context.Context, token RefreshToken, client Client) (RefreshToken, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return RefreshToken{}, errors.New("database connection is nil")
+	}
+
+	now := s.clock.Now()
+	oldToken := token.Token
+	token.Token = uuid.New().String()
+	token.ExpiryDate = s.expiration(now, token.RememberMe)
+	token.IPAddress = truncate(client.IPAddress, maxIPAddressLength)
+	token.LastUsedAt = now
+	if client.Device != "" {
+		token.Device = truncate(client.Device, maxDeviceLength)
+		token.DeviceLabel = useragent.Label(client.Device)
+	}
+
+	rotatedRefreshToken, err := s.repo.RotateRefreshToken(ctx, db, oldToken, token)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to rotate refresh token: %v", err))
+		return RefreshToken{}, err
+	}
+
+	return rotatedRefreshToken, nil
+}
+
+// Reauthenticate records that the user entered their password again in a session, at the time of the service clock.
+// The access tokens of the session issued from now on, by the refreshes too, carry the new authentication time.
+// gorm.ErrRecordNotFound is returned when the user has no session with the ID, e.g. a revoked or expired one.
+func (s *refreshTokenService) Reauthenticate(ctx context.Context, userID int64, sessionID string) (RefreshToken, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return RefreshToken{}, errors.New("database connection is nil")
+	}
+
+	return s.repo.UpdateAuthTime(ctx, db, userID, sessionID, s.clock.Now())
+}
+
+// truncate shortens a client detail to the length of its column.
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+
+	return s
+}
+
+// expiration calculates the expiration date of a refresh token created at the given time, remembered or not.
+// The TTLs given with WithTokenTTL and WithRememberMeTTL take precedence over the environment variables.
+func (s *refreshTokenService) expiration(now time.Time, rememberMe bool) time.Time {
+	if rememberMe {
+		if s.rememberMeTTL > 0 {
+			return now.Add(s.rememberMeTTL)
+		}
+		return GetRememberMeRefreshTokenExpiration(now)
+	}
+
+	if s.tokenTTL > 0 {
+		return now.Add(s.tokenTTL)
+	}
+
+	return GetRefreshTokenExpiration(now)
+}
+
 // GetRefreshTokenExpiration calculates the expiration date for the refresh token.
 // It retrieves the expiration hour from an environment variable and adds it to the current time.
 func GetRefreshTokenExpiration(now time.Time) time.Time {
@@ -165,3 +312,17 @@ func GetRefreshTokenExpiration(now time.Time) time.Time {
 
 	return now.Add(time.Hour * time.Duration(expHour))
 }
+
+// GetRememberMeRefreshTokenExpiration calculates the expiration date for the refresh token of a remembered session.
+// It retrieves the expiration hour from an environment variable and adds it to the current time.
+func GetRememberMeRefreshTokenExpiration(now time.Time) time.Time {
+	// Load environment variables
+	LoadEnv()
+
+	expHour, err := strconv.Atoi(JWTRememberMeRefreshTokenExpirationHour)
+	if err != nil || expHour <= 0 {
+		expHour = 30 * 24 // Default to 30 days if the environment variable is not set or invalid
+	}
+
+	return now.Add(time.Hour * time.Duration(expHour))
+}
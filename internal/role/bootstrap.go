@@ -0,0 +1,150 @@
+package role
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// The roles are bootstrapped at startup: the built-in roles, and the custom roles of ROLES_CUSTOM, are created when
+// they are missing, so a fresh database is usable without the seed file. The bootstrap is idempotent and several
+// replicas may run it, the table is locked while the missing roles are created. It also migrates the databases
+// created before the custom roles, whose check constraint only accepts the built-in roles.
+
+// The built-in roles, in the order of the seed file so a bootstrapped database gets the same IDs.
+const (
+	RoleUser      = "ROLE_USER"
+	RoleModerator = "ROLE_MODERATOR"
+	RoleAdmin     = "ROLE_ADMIN"
+)
+
+// BuiltInRoles are the roles the API relies on, e.g. in its access rules.
+var BuiltInRoles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// roleNameMaxLength is the length of the name column of the roles.
+const roleNameMaxLength = 20
+
+var (
+	CustomRoles   []string
+	RoleBootstrap string
+)
+
+// LoadEnv loads environment variables
+// ROLES_CUSTOM is the comma-separated list of the custom roles created besides the built-in roles, e.g. ROLE_AUDITOR.
+// ROLES_BOOTSTRAP=FALSE disables the bootstrap, e.g. when the roles are managed by the migrations of the database.
+func LoadEnv() {
+	CustomRoles = nil
+	for _, name := range strings.Split(os.Getenv("ROLES_CUSTOM"), ",") {
+		if name = strings.ToUpper(strings.TrimSpace(name)); name != "" {
+			CustomRoles = append(CustomRoles, name)
+		}
+	}
+	RoleBootstrap = strings.ToUpper(os.Getenv("ROLES_BOOTSTRAP"))
+}
+
+// Validate checks that the custom roles are valid role names, declared once, so a typo does not create a role.
+func Validate() error {
+	seen := make(map[string]bool, len(BuiltInRoles)+len(CustomRoles))
+	for _, name := range BuiltInRoles {
+		seen[name] = true
+	}
+
+	for _, name := range CustomRoles {
+		if !validate.RoleNamePattern.MatchString(name) || len(name) > roleNameMaxLength {
+			return fmt.Errorf("ROLES_CUSTOM must list role names such as ROLE_AUDITOR of at most %d characters, got %q", roleNameMaxLength, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("ROLES_CUSTOM lists %s more than once or as a custom role", name)
+		}
+		seen[name] = true
+	}
+
+	return nil
+}
+
+// Names returns the names of the built-in and custom roles.
+func Names() []string {
+	return append(append([]string(nil), BuiltInRoles...), CustomRoles...)
+}
+
+// IsKnown reports whether the name is a built-in or custom role, case-insensitively.
+func IsKnown(name string) bool {
+	for _, known := range Names() {
+		if strings.EqualFold(known, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bootstrap creates the built-in and custom roles missing from the database, and returns the created roles.
+// The roles are only added: a role removed from ROLES_CUSTOM is kept with its users.
+func Bootstrap(db *gorm.DB, repo RoleRepository) ([]Role, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database connection is nil")
+	}
+
+	created := []Role{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Accept the custom roles in the databases created with the built-in roles only
+		if err := repo.MigrateNameCheck(tx); err != nil {
+			return fmt.Errorf("failed to migrate the role name check: %v", err)
+		}
+
+		// Serialize the bootstraps of the replicas, the names are not unique in the table
+		if err := repo.LockRoles(tx); err != nil {
+			return err
+		}
+
+		existing, err := repo.GetAllRoles(tx)
+		if err != nil {
+			return err
+		}
+		found := make(map[string]bool, len(existing))
+		for _, r := range existing {
+			found[strings.ToUpper(r.Name)] = true
+		}
+
+		for _, name := range Names() {
+			if found[name] {
+				continue
+			}
+			r, err := repo.CreateRole(tx, Role{Name: name})
+			if err != nil {
+				return fmt.Errorf("failed to create role %s: %v", name, err)
+			}
+			created = append(created, r)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// InitRoles bootstraps the roles at startup, unless ROLES_BOOTSTRAP is FALSE.
+// A failure is logged and does not stop the start, the users cannot be given the missing roles until it is fixed.
+func InitRoles(db *gorm.DB) {
+	if RoleBootstrap == "FALSE" {
+		logger.Info("Role bootstrap is disabled")
+		return
+	}
+
+	created, err := Bootstrap(db, NewRoleRepository())
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to bootstrap the roles: %v", err))
+		return
+	}
+
+	for _, r := range created {
+		logger.Info(fmt.Sprintf("Role %s created with ID %d", r.Name, r.ID))
+	}
+}
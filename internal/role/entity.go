@@ -10,7 +10,7 @@ var v *validator.Validate
 // Role represents the role entity in the database.
 type Role struct {
 	ID   uint   `gorm:"column:id;primaryKey;autoIncrement" json:"roleId"`
-	Name string `gorm:"column:name;type:varchar(20);not null;check:name IN ('ROLE_USER','ROLE_MODERATOR','ROLE_ADMIN')" json:"roleName" validate:"required,max=20,oneof=ROLE_USER ROLE_MODERATOR ROLE_ADMIN"`
+	Name string `gorm:"column:name;type:varchar(20);not null;check:chk_roles_name_format,name ~ '^ROLE_[A-Z][A-Z0-9_]*$'" json:"roleName" validate:"required,max=20,rolename"`
 }
 
 // UserRole represents the many-to-many relationship between users and roles.
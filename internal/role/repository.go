@@ -2,15 +2,27 @@ package role
 
 import (
 	"errors"
+	"net/http"
 
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
 	"gorm.io/gorm"
 )
 
+// ErrRoleNameNotFound is returned when no role has the given name.
+var ErrRoleNameNotFound = errors.New("role with the given name not found")
+
+// ErrRoleNotFound is returned when no role has the given ID.
+var ErrRoleNotFound = apperror.New("RoleNotFound", http.StatusNotFound, "role with the given ID not found")
+
 // Interface for role repository
 // This interface defines the methods that the role repository should implement
 type RoleRepository interface {
 	GetRoleByID(tx *gorm.DB, id uint) (Role, error)
 	GetRoleByName(tx *gorm.DB, name string) (Role, error)
+	GetAllRoles(tx *gorm.DB) ([]Role, error)
+	CreateRole(tx *gorm.DB, role Role) (Role, error)
+	LockRoles(tx *gorm.DB) error
+	MigrateNameCheck(tx *gorm.DB) error
 }
 
 // This struct defines the RoleRepository that contains methods for interacting with the database
@@ -29,7 +41,7 @@ func (r *roleRepository) GetRoleByID(tx *gorm.DB, id uint) (Role, error) {
 	err := tx.First(&role, "id = ?", id).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return Role{}, errors.New("role with the given ID not found")
+		return Role{}, ErrRoleNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -46,7 +58,7 @@ func (r *roleRepository) GetRoleByName(tx *gorm.DB, name string) (Role, error) {
 	err := tx.First(&role, "lower(name) = lower(?)", name).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return Role{}, errors.New("role with the given name not found")
+		return Role{}, ErrRoleNameNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -55,3 +67,46 @@ func (r *roleRepository) GetRoleByName(tx *gorm.DB, name string) (Role, error) {
 
 	return role, nil
 }
+
+// GetAllRoles retrieves all the roles from the database, ordered by ID.
+func (r *roleRepository) GetAllRoles(tx *gorm.DB) ([]Role, error) {
+	var roles []Role
+	if err := tx.Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// CreateRole inserts a new role into the database.
+func (r *roleRepository) CreateRole(tx *gorm.DB, role Role) (Role, error) {
+	if err := tx.Create(&role).Error; err != nil {
+		return Role{}, err
+	}
+
+	return role, nil
+}
+
+// LockRoles locks the roles table until the end of the transaction, the roles can still be read.
+func (r *roleRepository) LockRoles(tx *gorm.DB) error {
+	return tx.Exec("LOCK TABLE roles IN SHARE ROW EXCLUSIVE MODE").Error
+}
+
+// legacyNameCheck is the check constraint of the databases created when only the built-in roles were accepted.
+const legacyNameCheck = "chk_roles_name"
+
+// MigrateNameCheck replaces the check constraint accepting the built-in roles only with the check of the role name format.
+func (r *roleRepository) MigrateNameCheck(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	if migrator.HasConstraint(&Role{}, legacyNameCheck) {
+		if err := migrator.DropConstraint(&Role{}, legacyNameCheck); err != nil {
+			return err
+		}
+	}
+
+	if !migrator.HasConstraint(&Role{}, "chk_roles_name_format") {
+		return migrator.CreateConstraint(&Role{}, "chk_roles_name_format")
+	}
+
+	return nil
+}
@@ -4,11 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
 )
 
+// roleCache caches the role map, the roles keyed by lowercase name, under a single key.
+// The roles are seeded and not written by the API, the entry is refreshed when it expires.
+var roleCache = cache.New("role")
+
+// roleMapKey is the key of the role map in its cache.
+const roleMapKey = "all"
+
 // Interface for role service
 // This interface defines the methods that the role service should implement
 type RoleService interface {
@@ -16,16 +26,54 @@ type RoleService interface {
 	GetRoleByName(ctx context.Context, name string) (Role, error)
 }
 
-// This struct defines the RoleService that contains a repository field of type RoleRepository
+// This struct defines the RoleService that contains a repository field of type RoleRepository and the cache of the role map
 // It implements the RoleService interface and provides methods for role-related operations
 type roleService struct {
-	repo RoleRepository
+	repo  RoleRepository
+	cache cache.Store
+}
+
+// Option configures a role service.
+type Option func(*roleService)
+
+// WithCache sets the cache of the role map.
+func WithCache(c cache.Store) Option {
+	return func(s *roleService) {
+		s.cache = c
+	}
 }
 
 // NewRoleService creates a new instance of RoleService with the given repository.
-// It initializes the roleService struct and returns it.
-func NewRoleService(repo RoleRepository) RoleService {
-	return &roleService{repo: repo}
+// It initializes the roleService struct, applies the options and returns it.
+func NewRoleService(repo RoleRepository, opts ...Option) RoleService {
+	s := &roleService{repo: repo, cache: roleCache}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// RegisterCacheWarmers reloads the role map from the database when it expires (see cache.InitExpiryConsumer).
+func RegisterCacheWarmers(db *gorm.DB) {
+	roleCache.Warm(roleMapKey, func(ctx context.Context) (any, error) {
+		return loadRoleMap(NewRoleRepository(), db.WithContext(ctx))
+	})
+}
+
+// loadRoleMap reads the roles keyed by lowercase name.
+func loadRoleMap(repo RoleRepository, db *gorm.DB) (map[string]Role, error) {
+	roles, err := repo.GetAllRoles(db)
+	if err != nil {
+		return nil, err
+	}
+
+	roleMap := make(map[string]Role, len(roles))
+	for _, r := range roles {
+		roleMap[strings.ToLower(r.Name)] = r
+	}
+
+	return roleMap, nil
 }
 
 // GetRoleByID retrieves a role by its ID from the database.
@@ -47,7 +95,7 @@ func (s *roleService) GetRoleByID(ctx context.Context, id uint) (Role, error) {
 	return role, nil
 }
 
-// GetRoleByName retrieves a role by its name from the database.
+// GetRoleByName retrieves a role by its name, from the cached role map when possible.
 func (s *roleService) GetRoleByName(ctx context.Context, name string) (Role, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
@@ -56,7 +104,22 @@ func (s *roleService) GetRoleByName(ctx context.Context, name string) (Role, err
 		return Role{}, errors.New("database connection is nil")
 	}
 
-	// Retrieve the role by name from the repository
+	// Look the role up in the role map, read into the cache on a miss
+	var roleMap map[string]Role
+	if !s.cache.Load(ctx, roleMapKey, &roleMap) {
+		loaded, err := loadRoleMap(s.repo, db)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to load role map: %v", err))
+		} else {
+			roleMap = loaded
+			s.cache.Store(ctx, roleMapKey, roleMap)
+		}
+	}
+	if role, ok := roleMap[strings.ToLower(name)]; ok {
+		return role, nil
+	}
+
+	// Retrieve the role by name from the repository, e.g. a role added since the map was cached
 	role, err := s.repo.GetRoleByName(db, name)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to get role by name: %v", err))
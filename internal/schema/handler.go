@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// This struct defines the SchemaHandler which serves the JSON Schemas of the request bodies.
+type SchemaHandler struct{}
+
+// NewSchemaHandler creates a new instance of SchemaHandler.
+func NewSchemaHandler() *SchemaHandler {
+	return &SchemaHandler{}
+}
+
+// GetEntities returns the names of the entities with a JSON Schema.
+// @Summary      List JSON Schemas
+// @Description  List the entities whose request body JSON Schema is published
+// @Tags         schemas
+// @Produce      json
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Router       /schemas [get]
+func (h *SchemaHandler) GetEntities(c *gin.Context) {
+	util.JSONSuccess(c, http.StatusOK, "JSON Schemas retrieved successfully", GetEntities())
+}
+
+// GetSchema returns the JSON Schema of an entity so clients can validate payloads before sending them.
+// The schema is returned as is (not wrapped in the standard response) so it can be used directly by validators.
+// @Summary      Get JSON Schema
+// @Description  Get the JSON Schema of the request body of an entity
+// @Tags         schemas
+// @Produce      json
+// @Param        entity  path      string  true  "Entity name"
+// @Success      200  {object}  jsonschema.Schema
+// @Failure      404  {object}  HttpResponse for not found
+// @Router       /schemas/{entity} [get]
+func (h *SchemaHandler) GetSchema(c *gin.Context) {
+	s, ok := GetSchema(c.Param("entity"))
+	if !ok {
+		util.JSONError(c, http.StatusNotFound, "Schema not found", "No JSON Schema found for the given entity")
+		return
+	}
+
+	c.Header("Content-Type", "application/schema+json")
+	c.JSON(http.StatusOK, s)
+}
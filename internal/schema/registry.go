@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"sort"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsonschema"
+)
+
+// schemas holds the JSON Schemas of the request bodies, keyed by entity name.
+// They are generated once from the DTOs so they never drift from the validation rules.
+var schemas = map[string]*jsonschema.Schema{
+	"department":                jsonschema.Generate("Department", department.Department{}),
+	"department-update":         jsonschema.Generate("DepartmentUpdate", department.Department{}).WithOptional("id"),
+	"department-tags":           jsonschema.Generate("DepartmentTags", department.TagsRequest{}),
+	"department-status":         jsonschema.Generate("DepartmentBulkStatus", department.BulkStatusRequest{}),
+	"user":                      jsonschema.Generate("User", user.User{}),
+	"user-patch":                jsonschema.Generate("UserPatch", user.UserPatch{}),
+	"api-key":                   jsonschema.Generate("APIKeyRequest", user.APIKeyRequest{}),
+	"email-change":              jsonschema.Generate("EmailChangeRequest", user.EmailChangeRequest{}),
+	"email-confirmation":        jsonschema.Generate("EmailConfirmationRequest", user.EmailConfirmationRequest{}),
+	"transfer":                  jsonschema.Generate("TransferRequest", user.TransferRequest{}),
+	"role-request":              jsonschema.Generate("RoleRequestCreate", user.RoleRequestCreate{}),
+	"webhook":                   jsonschema.Generate("Webhook", webhook.Webhook{}),
+	"client":                    jsonschema.Generate("ClientRequest", oauthclient.ClientRequest{}),
+	"login":                     jsonschema.Generate("LoginRequest", auth.LoginRequest{}),
+	"refresh-token":             jsonschema.Generate("RefreshTokenRequest", refreshtoken.RefreshTokenRequest{}),
+	"reauth":                    jsonschema.Generate("ReauthRequest", auth.ReauthRequest{}),
+	"forgot-password":           jsonschema.Generate("ForgotPasswordRequest", auth.ForgotPasswordRequest{}),
+	"reset-password":            jsonschema.Generate("ResetPasswordRequest", auth.ResetPasswordRequest{}),
+	"registration":              jsonschema.Generate("RegistrationRequest", auth.RegistrationRequest{}),
+	"registration-verification": jsonschema.Generate("VerifyRegistrationRequest", auth.VerifyRegistrationRequest{}),
+}
+
+// GetSchema returns the JSON Schema of the given entity.
+func GetSchema(entity string) (*jsonschema.Schema, bool) {
+	s, ok := schemas[entity]
+	return s, ok
+}
+
+// MustGetSchema returns the JSON Schema of the given entity and panics if it is not registered.
+// It is used when setting up the routes, so a typo fails at startup.
+func MustGetSchema(entity string) *jsonschema.Schema {
+	s, ok := schemas[entity]
+	if !ok {
+		panic("json schema not registered: " + entity)
+	}
+
+	return s
+}
+
+// GetEntities returns the names of the entities with a JSON Schema.
+func GetEntities() []string {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
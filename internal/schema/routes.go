@@ -0,0 +1,17 @@
+package schema
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+)
+
+// RegisterRoutes registers the routes publishing the JSON Schemas of the request bodies under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Publish the JSON Schemas of the request bodies so clients can validate them before sending
+	schemaGroup := rg.Group("/schemas")
+	{
+		handler := NewSchemaHandler()
+		schemaGroup.GET("", handler.GetEntities)
+		schemaGroup.GET("/:entity", handler.GetSchema)
+	}
+}
@@ -0,0 +1,209 @@
+package seed
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+)
+
+// Size is the volume of a demo dataset.
+type Size struct {
+	Name        string
+	Departments int
+	Users       int
+}
+
+// Sizes are the volumes accepted by --size, by name.
+// The department IDs are made of the IDPrefix and 3 digits, so a dataset has at most 1000 departments.
+var Sizes = map[string]Size{
+	"small":  {Name: "small", Departments: 10, Users: 100},
+	"medium": {Name: "medium", Departments: 100, Users: 2000},
+	"large":  {Name: "large", Departments: 500, Users: 25000},
+}
+
+const (
+	// IDPrefix starts the IDs of the demo departments, which the seed data (d001...) does not use
+	IDPrefix = "x"
+
+	// EmailDomain is the domain of the e-mails of the demo users, reserved for examples (RFC 2606)
+	EmailDomain = "demo.example"
+
+	// historyYears is how far back the demo departments and users were created
+	historyYears = 5
+)
+
+// Department tags and metadata drawn for the demo departments
+var (
+	demoTags      = []string{"remote-first", "billable", "shared-services", "customer-facing", "emea", "apac", "americas", "pilot"}
+	demoCostPools = []string{"OPEX", "CAPEX", "R&D"}
+)
+
+// Dataset is a generated demo dataset, ready to be inserted.
+type Dataset struct {
+	Departments []department.Department
+	Versions    []department.DepartmentVersion
+	Users       []user.User
+	// Moderators are the indexes in Users of the users also given ROLE_MODERATOR, the others only have ROLE_USER
+	Moderators []int
+}
+
+// Generate generates a demo dataset of the given size.
+// The same seed and time always give the same dataset, so a load test can be replayed on the same data.
+// The names come from the faker, the e-mails use EmailDomain, and no value is taken from real records.
+func Generate(size Size, seed uint64, now time.Time) Dataset {
+	f := gofakeit.New(seed)
+	now = now.UTC().Truncate(time.Second)
+	since := now.AddDate(-historyYears, 0, 0)
+
+	ds := Dataset{}
+	names := make(map[string]bool, size.Departments)
+	active := make([]int, 0, size.Departments)
+	for i := 0; i < size.Departments; i++ {
+		id := fmt.Sprintf("%s%03d", IDPrefix, i+1)
+		createdAt := f.DateRange(since, now.AddDate(0, -1, 0)).UTC().Truncate(time.Second)
+
+		// Some departments were renamed, each name is a closed period of their history
+		validFrom := createdAt
+		for renames := f.Number(0, 3); renames > 0; renames-- {
+			renamedAt := f.DateRange(validFrom, now).UTC().Truncate(time.Second)
+			if !renamedAt.After(validFrom) {
+				break
+			}
+			ds.Versions = append(ds.Versions, department.DepartmentVersion{
+				DepartmentID: id,
+				DeptName:     departmentName(f, nil),
+				ValidFrom:    validFrom,
+				ValidTo:      renamedAt,
+			})
+			validFrom = renamedAt
+		}
+
+		d := department.Department{
+			ID:        id,
+			DeptName:  departmentName(f, names),
+			Active:    f.Number(1, 10) > 1,
+			Tags:      department.Tags{},
+			Metadata:  department.Metadata{"costCenter": fmt.Sprintf("CC-%04d", f.Number(1000, 9999)), "location": f.City(), "costPool": f.RandomString(demoCostPools)},
+			Status:    department.StatusActive,
+			ValidFrom: timePtr(validFrom),
+			CreatedAt: timePtr(createdAt),
+			UpdatedAt: timePtr(validFrom),
+		}
+		for _, tag := range demoTags {
+			if f.Number(1, 4) == 1 {
+				d.Tags = append(d.Tags, tag)
+			}
+		}
+
+		// A few departments are archived, they have no employees
+		if f.Number(1, 20) == 1 {
+			archivedAt := f.DateRange(validFrom, now).UTC().Truncate(time.Second)
+			d.Status = department.StatusArchived
+			d.ArchivedAt = &archivedAt
+			d.UpdatedAt = &archivedAt
+		} else {
+			active = append(active, i)
+		}
+
+		ds.Departments = append(ds.Departments, d)
+	}
+
+	for i := 0; i < size.Users; i++ {
+		firstName, lastName := truncate(f.FirstName(), 20), truncate(f.LastName(), 20)
+		createdAt := f.DateRange(since, now).UTC().Truncate(time.Second)
+		lastLogin := f.DateRange(createdAt, now).UTC().Truncate(time.Second)
+		enabled := f.Number(1, 20) > 1
+
+		u := user.User{
+			UserName:                userName(firstName, lastName, i),
+			FirstName:               firstName,
+			LastName:                &lastName,
+			IsEnabled:               &enabled,
+			IsAccountNonExpired:     boolPtr(true),
+			IsAccountNonLocked:      boolPtr(true),
+			IsCredentialsNonExpired: boolPtr(true),
+			IsDeleted:               boolPtr(false),
+			UserType:                user.UserAccount,
+			DepartmentScope:         user.DepartmentScope{},
+			LastLogin:               &lastLogin,
+			CreatedAt:               &createdAt,
+			UpdatedAt:               &createdAt,
+		}
+		u.Email = u.UserName + "@" + EmailDomain
+
+		// Most users are employees of an active department
+		if len(active) > 0 && f.Number(1, 10) > 1 {
+			d := &ds.Departments[active[f.Number(0, len(active)-1)]]
+			u.DepartmentID = &d.ID
+			d.EmployeeCount++
+		}
+
+		if f.Number(1, 20) == 1 {
+			ds.Moderators = append(ds.Moderators, i)
+		}
+
+		ds.Users = append(ds.Users, u)
+	}
+
+	return ds
+}
+
+// departmentName draws a department name such as "Global Operations".
+// When names is given, the name is made unique among them with a number.
+func departmentName(f *gofakeit.Faker, names map[string]bool) string {
+	name := truncate(f.JobDescriptor()+" "+f.JobLevel(), 34)
+	if names == nil {
+		return name
+	}
+
+	unique := name
+	for n := 2; names[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s %d", name, n)
+	}
+	names[strings.ToLower(unique)] = true
+
+	return unique
+}
+
+// userName builds the unique user name of the i-th demo user, e.g. "jsmith.42", at most 20 characters.
+// Only the ASCII letters of the names are kept.
+func userName(firstName, lastName string, i int) string {
+	letters := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				return r
+			}
+			return -1
+		}, s)
+	}
+
+	name := truncate(letters(firstName), 1) + letters(lastName)
+	if name == "" {
+		name = "user"
+	}
+	suffix := fmt.Sprintf(".%d", i+1)
+
+	return strings.ToLower(truncate(name, 20-len(suffix))) + suffix
+}
+
+// truncate shortens s to at most max characters.
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+
+	return s
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
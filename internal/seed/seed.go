@@ -0,0 +1,194 @@
+package seed
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"gorm.io/gorm"
+)
+
+// Package seed fills a database with an anonymized demo dataset for the demos and the load tests.
+// "app seed --demo --size large" generates fake departments with their name history, and fake users who
+// are the employees of the departments, so the demos do not reuse the seed SQL or production-like records.
+// The data is generated from a seed, so the same dataset can be generated again on another database.
+
+// DefaultPassword is the password of the demo users, unless --password is given.
+const DefaultPassword = "Demo-Passw0rd!"
+
+// batchSize is the number of rows inserted per statement.
+const batchSize = 500
+
+// ErrAlreadySeeded is returned when the database already holds a demo dataset.
+var ErrAlreadySeeded = errors.New("the database already holds demo data, remove it before seeding again")
+
+// Config holds the seed configuration.
+type Config struct {
+	Demo     bool
+	Size     Size
+	Seed     uint64
+	Password string
+}
+
+// ParseConfig parses the seed command-line flags.
+func ParseConfig(args []string) (Config, error) {
+	cfg := Config{}
+	var size string
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.BoolVar(&cfg.Demo, "demo", false, "generate an anonymized demo dataset (required)")
+	fs.StringVar(&size, "size", "small", "volume of the dataset: "+strings.Join(sizeNames(), ", "))
+	fs.Uint64Var(&cfg.Seed, "seed", 1, "seed of the generator, the same seed gives the same dataset")
+	fs.StringVar(&cfg.Password, "password", DefaultPassword, "password of the demo users")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	// Only the demo dataset is generated, the flag makes the intent explicit on the command line
+	if !cfg.Demo {
+		return Config{}, errors.New("--demo is required")
+	}
+
+	s, ok := Sizes[strings.ToLower(size)]
+	if !ok {
+		return Config{}, fmt.Errorf("invalid size %q, expected one of %s", size, strings.Join(sizeNames(), ", "))
+	}
+	cfg.Size = s
+
+	if cfg.Password == "" {
+		return Config{}, errors.New("the password of the demo users cannot be empty")
+	}
+
+	return cfg, nil
+}
+
+// Run seeds the database with the given command-line arguments and returns the exit code:
+// 0 when the dataset was inserted, 1 when the database already holds demo data,
+// and 2 when the seed could not run. It refuses to run against a production environment.
+func Run(db *gorm.DB, args []string, out io.Writer) int {
+	cfg, err := ParseConfig(args)
+	if err != nil {
+		fmt.Fprintf(out, "seed: %v\n", err)
+		return 2
+	}
+
+	if os.Getenv("ENV") == "PRODUCTION" {
+		fmt.Fprintln(out, "seed: refusing to generate demo data in the PRODUCTION environment")
+		return 2
+	}
+
+	if db == nil {
+		fmt.Fprintln(out, "seed: database connection is not initialized")
+		return 2
+	}
+
+	start := time.Now()
+	ds := Generate(cfg.Size, cfg.Seed, start)
+	if err := Insert(db, ds, cfg.Password); err != nil {
+		fmt.Fprintf(out, "seed: %v\n", err)
+		if errors.Is(err, ErrAlreadySeeded) {
+			return 1
+		}
+		return 2
+	}
+
+	fmt.Fprintf(out, "Demo dataset %q (seed %d) inserted in %s\n", cfg.Size.Name, cfg.Seed, time.Since(start).Round(time.Millisecond))
+	fmt.Fprintf(out, "Departments: %d (%d name changes)\n", len(ds.Departments), len(ds.Versions))
+	fmt.Fprintf(out, "Users:       %d (%d moderators)\n", len(ds.Users), len(ds.Moderators))
+	fmt.Fprintf(out, "The demo users log in with their user name, e.g. %q, and the demo password\n", ds.Users[0].UserName)
+
+	return 0
+}
+
+// Insert inserts the dataset in one transaction. The users are given ROLE_USER, and ROLE_MODERATOR for the
+// moderators. The password is hashed once and shared by the demo users, so the large datasets are inserted quickly.
+// ErrAlreadySeeded is returned, and nothing is inserted, when a demo department or user already exists.
+func Insert(db *gorm.DB, ds Dataset, password string) error {
+	hash, err := user.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The demo data is recognized by the prefix of its department IDs and the domain of its e-mails
+		var existing int64
+		if err := tx.Model(&department.Department{}).Unscoped().Where("id LIKE ?", IDPrefix+"%").Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			if err := tx.Model(&user.User{}).Unscoped().Where("email LIKE ?", "%@"+EmailDomain).Count(&existing).Error; err != nil {
+				return err
+			}
+		}
+		if existing > 0 {
+			return ErrAlreadySeeded
+		}
+
+		// The roles are created by the role bootstrap or the seed SQL, like for the users created with the API
+		roles := map[string]role.Role{}
+		var found []role.Role
+		if err := tx.Where("name IN ?", []string{"ROLE_USER", "ROLE_MODERATOR"}).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, r := range found {
+			roles[r.Name] = r
+		}
+		if _, ok := roles["ROLE_USER"]; !ok {
+			return errors.New("role ROLE_USER does not exist, enable the role bootstrap (ROLES_BOOTSTRAP) or import the seed SQL first")
+		}
+
+		if err := tx.CreateInBatches(ds.Departments, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to insert the departments: %v", err)
+		}
+		if len(ds.Versions) > 0 {
+			if err := tx.CreateInBatches(ds.Versions, batchSize).Error; err != nil {
+				return fmt.Errorf("failed to insert the department history: %v", err)
+			}
+		}
+
+		// The roles are inserted separately, once the IDs of the users are known
+		users := make([]user.User, len(ds.Users))
+		for i, u := range ds.Users {
+			u.Password = hash
+			u.Roles = nil
+			users[i] = u
+		}
+		if err := tx.Omit("Roles").CreateInBatches(users, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to insert the users: %v", err)
+		}
+
+		userRoles := make([]role.UserRole, 0, len(users)+len(ds.Moderators))
+		for _, u := range users {
+			userRoles = append(userRoles, role.UserRole{UserID: u.ID, RoleID: int(roles["ROLE_USER"].ID)})
+		}
+		if moderator, ok := roles["ROLE_MODERATOR"]; ok {
+			for _, i := range ds.Moderators {
+				userRoles = append(userRoles, role.UserRole{UserID: users[i].ID, RoleID: int(moderator.ID)})
+			}
+		}
+		if err := tx.CreateInBatches(userRoles, batchSize).Error; err != nil {
+			return fmt.Errorf("failed to assign the roles: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// sizeNames returns the names of the sizes, sorted.
+func sizeNames() []string {
+	names := make([]string, 0, len(Sizes))
+	for name := range Sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// APIKeyPrefix starts the API keys issued to the service accounts, so a leaked key is recognized by the secret scanners
+// and the keys of the identities file are told apart without a database lookup.
+const APIKeyPrefix = "dsa_"
+
+// apiKeyBytes is the number of random bytes of an API key, its SHA-256 digest can be stored without a slow hash.
+const apiKeyBytes = 32
+
+// apiKeyVisiblePrefix is the number of characters of a key, after APIKeyPrefix, kept to identify it in the listings.
+const apiKeyVisiblePrefix = 8
+
+// Default and maximum validity of the API keys, when API_KEY_TTL_DAYS and API_KEY_MAX_TTL_DAYS are not set
+const (
+	defaultAPIKeyTTLDays    = 90
+	defaultAPIKeyMaxTTLDays = 365
+)
+
+// APIKey represents an API key issued to a service account.
+// The key itself is never stored: the table holds its SHA-256 digest and the prefix identifying it.
+// A key is valid until it expires or is revoked, and only while its service account is enabled.
+type APIKey struct {
+	ID         string     `gorm:"column:id;type:uuid;primaryKey" json:"id"`
+	UserID     int64      `gorm:"column:user_id;not null;index" json:"userId"`
+	Name       string     `gorm:"column:name;type:varchar(50);not null" json:"name"`
+	Prefix     string     `gorm:"column:prefix;type:varchar(20);not null" json:"prefix"`
+	KeyHash    string     `gorm:"column:key_hash;type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at;type:timestamptz;not null" json:"expiresAt"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at;type:timestamptz" json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at;type:timestamptz" json:"revokedAt,omitempty"`
+	CreatedBy  *int64     `gorm:"column:created_by" json:"createdBy,omitempty"`
+	CreatedAt  *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+}
+
+// TableName returns the table of the API keys.
+func (APIKey) TableName() string {
+	return "user_api_keys"
+}
+
+// IsActive reports whether the key is neither revoked nor expired at the given time.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && now.Before(k.ExpiresAt)
+}
+
+// APIKeyRequest is the body of an API key issuance.
+// The key expires after API_KEY_TTL_DAYS when ExpiresInDays is not set.
+type APIKeyRequest struct {
+	Name          string `json:"name" validate:"required,max=50"`
+	ExpiresInDays int    `json:"expiresInDays,omitempty" validate:"omitempty,min=1"`
+}
+
+// Validate validates the APIKeyRequest struct using the validator package.
+func (r *APIKeyRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IssuedAPIKey is an API key as returned once at its issuance, with the key itself.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// generateAPIKey returns a new random API key and its SHA-256 digest.
+func generateAPIKey() (string, string, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, apikey.HashKey(key), nil
+}
+
+// IsServiceAccountKey reports whether the key has the format of the keys issued to the service accounts.
+func IsServiceAccountKey(key string) bool {
+	return strings.HasPrefix(key, APIKeyPrefix) && len(key) > len(APIKeyPrefix)+apiKeyVisiblePrefix
+}
@@ -0,0 +1,208 @@
+package user
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+)
+
+// Actions recorded in the audit trail of the users
+const (
+	AuditCreated         = "created"
+	AuditUpdated         = "updated"
+	AuditRolesChanged    = "roles_changed"
+	AuditDeleted         = "deleted"
+	AuditRestored        = "restored"
+	AuditEnabled         = "enabled"
+	AuditDisabled        = "disabled"
+	AuditPasswordReset   = "password_reset"
+	AuditSessionsRevoked = "sessions_revoked"
+	AuditImpersonated    = "impersonated"
+	AuditAPIKeyIssued    = "api_key_issued"
+	AuditAPIKeyRevoked   = "api_key_revoked"
+	AuditEmailChanged    = "email_changed"
+	AuditExpired         = "expired"
+	AuditTransferred     = "transferred"
+)
+
+// AuditEntry represents an action on a user recorded in its audit trail.
+// The actor is the authenticated user of the request, it is empty when the action is not authenticated
+// (e.g. a password reset with a reset token). The entries are kept when the user is deleted.
+type AuditEntry struct {
+	ID             int64        `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID         int64        `gorm:"column:user_id;not null;index" json:"userId"`
+	Action         string       `gorm:"column:action;type:varchar(30);not null" json:"action"`
+	ActorID        *int64       `gorm:"column:actor_id" json:"actorId,omitempty"`
+	ActorName      string       `gorm:"column:actor_name;type:varchar(100)" json:"actorName,omitempty"`
+	ImpersonatedBy *int64       `gorm:"column:impersonated_by" json:"impersonatedBy,omitempty"`
+	RequestID      string       `gorm:"column:request_id;type:varchar(36)" json:"requestId,omitempty"`
+	Changes        AuditChanges `gorm:"column:changes;type:jsonb;not null;default:'{}'" json:"changes,omitempty"`
+	CreatedAt      *time.Time   `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+}
+
+// AuditChange holds the values of a field before and after an action, nil when the field was not set.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditChanges maps the JSON name of the changed fields to their change.
+type AuditChanges map[string]AuditChange
+
+// auditIgnoredFields are the fields left out of the audit diffs: the bookkeeping of the changes,
+// which the entry records itself, and the roles, which are audited with their own action.
+var auditIgnoredFields = map[string]bool{
+	"createdBy":        true,
+	"createdAt":        true,
+	"updatedBy":        true,
+	"updatedAt":        true,
+	"deletedBy":        true,
+	"deletedAt":        true,
+	"enabledChangedBy": true,
+	"enabledChangedAt": true,
+	"lastLogin":        true,
+	"roles":            true,
+}
+
+// TableName specifies the table name of the audit entries.
+func (AuditEntry) TableName() string {
+	return "user_audit"
+}
+
+// NewAuditEntry creates an audit entry of the action on the user, with the actor and the request ID of the context.
+func NewAuditEntry(ctx context.Context, userID int64, action string, changes AuditChanges) AuditEntry {
+	entry := AuditEntry{UserID: userID, Action: action, Changes: changes}
+
+	if meta, ok := metacontext.ExtractRequestMeta(ctx); ok {
+		if meta.UserID != 0 {
+			actorID := meta.UserID
+			entry.ActorID = &actorID
+		}
+		if meta.ImpersonatedBy != 0 {
+			impersonatedBy := meta.ImpersonatedBy
+			entry.ImpersonatedBy = &impersonatedBy
+		}
+		entry.ActorName = meta.UserName
+		entry.RequestID = meta.RequestID
+	}
+
+	return entry
+}
+
+// DiffUsers returns the fields changed between two states of a user, by their JSON name.
+// The password hash is never part of the diff, and the roles are compared with DiffRoles.
+func DiffUsers(before, after User) (AuditChanges, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := AuditChanges{}
+	for name, value := range afterFields {
+		if !reflect.DeepEqual(beforeFields[name], value) {
+			changes[name] = AuditChange{Before: beforeFields[name], After: value}
+		}
+	}
+	for name, value := range beforeFields {
+		if _, ok := afterFields[name]; !ok {
+			changes[name] = AuditChange{Before: value, After: nil}
+		}
+	}
+
+	return changes, nil
+}
+
+// DiffRoles returns the change of the roles of a user, compared by name, or nil when they are the same.
+func DiffRoles(before, after User) AuditChanges {
+	beforeNames, afterNames := roleNames(before), roleNames(after)
+	if slices.Equal(beforeNames, afterNames) {
+		return nil
+	}
+
+	change := AuditChange{After: afterNames}
+	if beforeNames != nil {
+		change.Before = beforeNames
+	}
+	return AuditChanges{"roles": change}
+}
+
+// auditFields returns the audited fields of a user as they are encoded in JSON, without the password hash.
+func auditFields(u User) (map[string]any, error) {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name := range fields {
+		if auditIgnoredFields[name] {
+			delete(fields, name)
+		}
+	}
+
+	return fields, nil
+}
+
+// roleNames returns the sorted upper-case names of the roles of a user, nil when it has none.
+func roleNames(u User) []string {
+	if len(u.Roles) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		names = append(names, strings.ToUpper(r.Name))
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Value implements the driver.Valuer interface.
+// It marshals the changes into a JSON object.
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+// It unmarshals the JSON object stored in the database into the changes.
+func (c *AuditChanges) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return errors.New("failed to scan audit changes")
+	}
+
+	return json.Unmarshal(data, c)
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// Staged e-mail changes are stored in Redis under the SHA-256 of their confirmation token, so the keys do not
+// reveal usable tokens. The user key points to the last staged change of a user, which is replaced by a new request.
+const (
+	emailChangeKeyPrefix     = "email_change:"
+	emailChangeUserKeyPrefix = "email_change_user:"
+	defaultEmailChangeTTL    = time.Hour
+	emailChangeMailTimeout   = 30 * time.Second
+)
+
+// EmailChangeRequest is the body of an e-mail change of the authenticated user.
+// The new e-mail is staged until it is confirmed with the token sent to it.
+type EmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email,max=100"`
+}
+
+// Validate validates the EmailChangeRequest struct using the validator package.
+func (r *EmailChangeRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// EmailConfirmationRequest is the body of the confirmation of a staged e-mail change.
+type EmailConfirmationRequest struct {
+	Token string `json:"token" validate:"required,max=100"`
+}
+
+// Validate validates the EmailConfirmationRequest struct using the validator package.
+func (r *EmailConfirmationRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// stagedEmailChange is an e-mail change waiting for its confirmation, as stored in Redis.
+type stagedEmailChange struct {
+	UserID int64  `json:"userId"`
+	Email  string `json:"email"`
+}
+
+// generateEmailChangeToken returns a new random confirmation token (256 bits, URL-safe) and its SHA-256 digest.
+func generateEmailChangeToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashEmailChangeToken(token), nil
+}
+
+// hashEmailChangeToken returns the hex-encoded SHA-256 of a confirmation token.
+func hashEmailChangeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// confirmEmailMessage builds the e-mail sent to the new address of a user to confirm it.
+// The token is added to EMAIL_CHANGE_URL when set, otherwise it is given as is.
+func confirmEmailMessage(u User, email string, token string) mailer.Message {
+	instructions := "Use the following token to confirm your new e-mail address: " + token
+	if link, err := url.Parse(EmailChangeURL); EmailChangeURL != "" && err == nil {
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		instructions = "Open the following link to confirm your new e-mail address: " + link.String()
+	}
+
+	return mailer.Message{
+		To:      email,
+		Subject: "Confirm your new e-mail address",
+		Body: fmt.Sprintf("Hello %s,\n\n%s\n\nThe link expires in %d minutes and can only be used once. "+
+			"If you did not request this change, you can ignore this e-mail.\n", u.FirstName, instructions, int(emailChangeTTL.Minutes())),
+	}
+}
+
+// emailChangedMessage builds the notice sent to the previous address of a user once its e-mail is changed,
+// so a change made from a stolen session does not go unnoticed.
+func emailChangedMessage(u User, previousEmail string) mailer.Message {
+	return mailer.Message{
+		To:      previousEmail,
+		Subject: "Your e-mail address was changed",
+		Body: fmt.Sprintf("Hello %s,\n\nThe e-mail address of your account was changed to %s. "+
+			"If you did not make this change, contact your administrator.\n", u.FirstName, u.Email),
+	}
+}
@@ -1,10 +1,15 @@
 package user
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
 	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsoncodec"
 	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
 	"gopkg.in/go-playground/validator.v9"
 	"gorm.io/gorm"
@@ -14,29 +19,150 @@ var v *validator.Validate
 
 // User represents the user entity in the database.
 type User struct {
-	ID                        int64                      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	UserName                  string                     `gorm:"column:username;type:varchar(20);not null;unique" json:"userName" validate:"required,min=3,max=20"`
-	Password                  string                     `gorm:"column:password;type:varchar(150);not null" json:"password" validate:"required,min=8"`
-	Email                     string                     `gorm:"column:email;type:varchar(100);not null;unique" json:"email" validate:"required,email,max=100"`
-	FirstName                 string                     `gorm:"column:firstname;type:varchar(20);not null" json:"firstName" validate:"required,max=20"`
-	LastName                  *string                    `gorm:"column:lastname;type:varchar(20)" json:"lastName,omitempty" validate:"omitempty,max=20"`
-	IsEnabled                 *bool                      `gorm:"column:is_enabled;not null;default:false" json:"isEnabled,omitempty"`
-	IsAccountNonExpired       *bool                      `gorm:"column:is_account_non_expired;not null;default:false" json:"isAccountNonExpired,omitempty"`
-	IsAccountNonLocked        *bool                      `gorm:"column:is_account_non_locked;not null;default:false" json:"isAccountNonLocked,omitempty"`
-	IsCredentialsNonExpired   *bool                      `gorm:"column:is_credentials_non_expired;not null;default:false" json:"isCredentialsNonExpired,omitempty"`
-	IsDeleted                 *bool                      `gorm:"column:is_deleted;not null;default:false" json:"isDeleted,omitempty"`
-	AccountExpirationDate     *time.Time                 `gorm:"column:account_expiration_date;type:timestamptz" json:"accountExpirationDate,omitempty"`
-	CredentialsExpirationDate *time.Time                 `gorm:"column:credentials_expiration_date;type:timestamptz" json:"credentialsExpirationDate,omitempty"`
-	UserType                  string                     `gorm:"column:user_type;type:varchar(20);not null;check:user_type IN ('SERVICE_ACCOUNT','USER_ACCOUNT')" json:"userType" validate:"required,max=20,oneof=SERVICE_ACCOUNT USER_ACCOUNT"`
-	LastLogin                 *time.Time                 `gorm:"column:last_login" json:"lastLogin,omitempty"`
-	CreatedBy                 *int64                     `gorm:"column:created_by" json:"createdBy,omitempty"`
-	CreatedAt                 *time.Time                 `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
-	UpdatedBy                 *int64                     `gorm:"column:updated_by" json:"updatedBy,omitempty"`
-	UpdatedAt                 *time.Time                 `gorm:"column:updated_at;type:timestamptz;autoUpdateTime;default:now()" json:"updatedAt,omitempty"`
-	DeletedBy                 *int64                     `gorm:"column:deleted_by" json:"deletedBy,omitempty"`
-	DeletedAt                 *gorm.DeletedAt            `gorm:"column:deleted_at;type:timestamptz;index" json:"deletedAt,omitempty"`
-	Roles                     []role.Role                `gorm:"many2many:user_roles;constraint:OnUpdate:RESTRICT,OnDelete:SET NULL" json:"roles,omitempty"`
-	RefreshToken              *refreshtoken.RefreshToken `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"refreshToken,omitempty"`
+	ID                        int64                       `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserName                  string                      `gorm:"column:username;type:varchar(20);not null;unique" json:"userName" validate:"required,min=3,max=20"`
+	Password                  string                      `gorm:"column:password;type:varchar(150);not null" json:"password,omitempty" validate:"required,max=72,password,notcommon,notidentity=UserName Email"`
+	Email                     string                      `gorm:"column:email;type:varchar(100);not null;unique" json:"email" validate:"required,email,max=100"`
+	FirstName                 string                      `gorm:"column:firstname;type:varchar(20);not null" json:"firstName" validate:"required,max=20"`
+	LastName                  *string                     `gorm:"column:lastname;type:varchar(20)" json:"lastName,omitempty" validate:"omitempty,max=20"`
+	IsEnabled                 *bool                       `gorm:"column:is_enabled;not null;default:false" json:"isEnabled,omitempty"`
+	IsAccountNonExpired       *bool                       `gorm:"column:is_account_non_expired;not null;default:false" json:"isAccountNonExpired,omitempty"`
+	IsAccountNonLocked        *bool                       `gorm:"column:is_account_non_locked;not null;default:false" json:"isAccountNonLocked,omitempty"`
+	IsCredentialsNonExpired   *bool                       `gorm:"column:is_credentials_non_expired;not null;default:false" json:"isCredentialsNonExpired,omitempty"`
+	IsDeleted                 *bool                       `gorm:"column:is_deleted;not null;default:false" json:"isDeleted,omitempty"`
+	AccountExpirationDate     *time.Time                  `gorm:"column:account_expiration_date;type:timestamptz" json:"accountExpirationDate,omitempty"`
+	CredentialsExpirationDate *time.Time                  `gorm:"column:credentials_expiration_date;type:timestamptz" json:"credentialsExpirationDate,omitempty"`
+	DepartmentID              *string                     `gorm:"column:department_id;type:varchar(4);index" json:"departmentId,omitempty" validate:"omitempty,len=4"`
+	UserType                  string                      `gorm:"column:user_type;type:varchar(20);not null;check:user_type IN ('SERVICE_ACCOUNT','USER_ACCOUNT')" json:"userType" validate:"required,max=20,oneof=SERVICE_ACCOUNT USER_ACCOUNT"`
+	DepartmentScope           DepartmentScope             `gorm:"column:department_scope;type:jsonb;not null;default:'[]'" json:"departmentScope,omitempty" validate:"omitempty,max=100,dive,len=4"`
+	LastLogin                 *time.Time                  `gorm:"column:last_login" json:"lastLogin,omitempty"`
+	AvatarURL                 *string                     `gorm:"column:avatar_url;type:varchar(500)" json:"avatarUrl,omitempty"`
+	EnabledChangedBy          *int64                      `gorm:"column:enabled_changed_by" json:"enabledChangedBy,omitempty"`
+	EnabledChangedAt          *time.Time                  `gorm:"column:enabled_changed_at;type:timestamptz" json:"enabledChangedAt,omitempty"`
+	CreatedBy                 *int64                      `gorm:"column:created_by" json:"createdBy,omitempty"`
+	CreatedAt                 *time.Time                  `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+	UpdatedBy                 *int64                      `gorm:"column:updated_by" json:"updatedBy,omitempty"`
+	UpdatedAt                 *time.Time                  `gorm:"column:updated_at;type:timestamptz;autoUpdateTime;default:now()" json:"updatedAt,omitempty"`
+	DeletedBy                 *int64                      `gorm:"column:deleted_by" json:"deletedBy,omitempty"`
+	DeletedAt                 *gorm.DeletedAt             `gorm:"column:deleted_at;type:timestamptz;index" json:"deletedAt,omitempty"`
+	Roles                     []role.Role                 `gorm:"many2many:user_roles;constraint:OnUpdate:RESTRICT,OnDelete:SET NULL" json:"roles,omitempty"`
+	RefreshTokens             []refreshtoken.RefreshToken `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+// Types of the users
+const (
+	UserAccount    = "USER_ACCOUNT"
+	ServiceAccount = "SERVICE_ACCOUNT"
+)
+
+// UserTypes are the types of the users.
+var UserTypes = []string{UserAccount, ServiceAccount}
+
+// DepartmentScope represents the IDs of the departments a service account is allowed to write.
+// It is given to the service accounts in the departments claim of their tokens, an empty scope grants no department.
+type DepartmentScope []string
+
+// UserFilter holds the filters of the user listing.
+// Role and RoleID select the users having the role, CreatedFrom is inclusive and CreatedTo exclusive.
+// Deleted lists the soft-deleted users instead of the others.
+type UserFilter struct {
+	Role        string
+	RoleID      uint
+	Deleted     bool
+	Enabled     *bool
+	UserType    string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// UserSort holds the order of the user listing.
+// Field is one of the UserSortFields, the ID breaks the ties.
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// UserSortFields maps the sortable fields of the listing to their column.
+var UserSortFields = map[string]string{
+	"id":        "id",
+	"userName":  "username",
+	"email":     "email",
+	"firstName": "firstname",
+	"lastName":  "lastname",
+	"createdAt": "created_at",
+	"lastLogin": "last_login",
+}
+
+// IsDefault checks if the listing is sorted by ascending ID, the only order the cursor pagination supports.
+func (s UserSort) IsDefault() bool {
+	return (s.Field == "" || s.Field == "id") && !s.Desc
+}
+
+// UserStats holds the aggregate counts of the users for the admin dashboards, the deleted users are left out.
+// ByRole and ByUserType list every known role and user type, a user with several roles is counted in each of them.
+// SignupsByMonth lists the months of the period from the oldest, including the current month.
+type UserStats struct {
+	Total          int64            `json:"total"`
+	Enabled        int64            `json:"enabled"`
+	Disabled       int64            `json:"disabled"`
+	ByRole         map[string]int64 `json:"byRole"`
+	ByUserType     map[string]int64 `json:"byUserType"`
+	SignupsByMonth []MonthlyCount   `json:"signupsByMonth"`
+}
+
+// MonthlyCount represents the number of users created in a month (UTC), e.g. "2025-03".
+type MonthlyCount struct {
+	Month string `json:"month"`
+	Count int64  `json:"count"`
+}
+
+// The number of months of signups returned by the user statistics, by default and at most.
+const (
+	StatsDefaultMonths = 12
+	StatsMaxMonths     = 36
+)
+
+// InvalidRole describes a role that cannot be assigned to a user, and why.
+type InvalidRole struct {
+	Role   string `json:"role"`
+	Reason string `json:"reason"`
+}
+
+// PasswordChange holds a new password of a user, validated with the password policy
+// against the identity of the user.
+type PasswordChange struct {
+	UserName    string `json:"-"`
+	Email       string `json:"-"`
+	NewPassword string `json:"newPassword" validate:"required,max=72,password,notcommon,notidentity=UserName Email"`
+}
+
+// UserPatch holds the fields of a partial update of a user (PATCH /users/:id).
+// A field that is omitted or null is left unchanged, so a partial body never resets the other fields.
+// The roles replace the roles of the user when they are given. isDeleted and lastLogin cannot be patched.
+type UserPatch struct {
+	UserName                  *string          `json:"userName,omitempty" validate:"omitempty,min=3,max=20"`
+	Password                  *string          `json:"password,omitempty" validate:"omitempty,max=72"`
+	Email                     *string          `json:"email,omitempty" validate:"omitempty,email,max=100"`
+	FirstName                 *string          `json:"firstName,omitempty" validate:"omitempty,min=1,max=20"`
+	LastName                  *string          `json:"lastName,omitempty" validate:"omitempty,max=20"`
+	IsEnabled                 *bool            `json:"isEnabled,omitempty"`
+	IsAccountNonExpired       *bool            `json:"isAccountNonExpired,omitempty"`
+	IsAccountNonLocked        *bool            `json:"isAccountNonLocked,omitempty"`
+	IsCredentialsNonExpired   *bool            `json:"isCredentialsNonExpired,omitempty"`
+	AccountExpirationDate     *time.Time       `json:"accountExpirationDate,omitempty"`
+	CredentialsExpirationDate *time.Time       `json:"credentialsExpirationDate,omitempty"`
+	DepartmentID              *string          `json:"departmentId,omitempty" validate:"omitempty,len=4"`
+	UserType                  *string          `json:"userType,omitempty" validate:"omitempty,oneof=SERVICE_ACCOUNT USER_ACCOUNT"`
+	DepartmentScope           *DepartmentScope `json:"departmentScope,omitempty" validate:"omitempty,max=100,dive,len=4"`
+	Roles                     []role.Role      `json:"roles,omitempty"`
+}
+
+// MarshalJSON encodes the user without its password hash, which is write-only.
+func (u User) MarshalJSON() ([]byte, error) {
+	type plainUser User
+	out := plainUser(u)
+	out.Password = ""
+	return jsoncodec.Marshal(out)
 }
 
 // Override the TableName method to specify the table name
@@ -87,3 +213,116 @@ func (u *User) Validate() error {
 	}
 	return nil
 }
+
+// Validate validates the UserPatch struct using the validator package.
+// The password policy is checked by the service, against the identity of the patched user.
+func (p *UserPatch) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(p); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Apply sets the fields given in the patch on the user, except the password, which must be hashed first.
+func (p *UserPatch) Apply(u *User) {
+	if p.UserName != nil {
+		u.UserName = *p.UserName
+	}
+	if p.Email != nil {
+		u.Email = *p.Email
+	}
+	if p.FirstName != nil {
+		u.FirstName = *p.FirstName
+	}
+	if p.LastName != nil {
+		u.LastName = p.LastName
+	}
+	if p.IsEnabled != nil {
+		u.IsEnabled = p.IsEnabled
+	}
+	if p.IsAccountNonExpired != nil {
+		u.IsAccountNonExpired = p.IsAccountNonExpired
+	}
+	if p.IsAccountNonLocked != nil {
+		u.IsAccountNonLocked = p.IsAccountNonLocked
+	}
+	if p.IsCredentialsNonExpired != nil {
+		u.IsCredentialsNonExpired = p.IsCredentialsNonExpired
+	}
+	if p.AccountExpirationDate != nil {
+		u.AccountExpirationDate = p.AccountExpirationDate
+	}
+	if p.CredentialsExpirationDate != nil {
+		u.CredentialsExpirationDate = p.CredentialsExpirationDate
+	}
+	if p.DepartmentID != nil {
+		u.DepartmentID = p.DepartmentID
+	}
+	if p.UserType != nil {
+		u.UserType = *p.UserType
+	}
+	if p.DepartmentScope != nil {
+		u.DepartmentScope = *p.DepartmentScope
+	}
+}
+
+// Validate validates the PasswordChange struct using the validator package.
+func (p *PasswordChange) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(p); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsServiceAccount checks if the user is a service account, whose department writes are restricted to its scope.
+func (u *User) IsServiceAccount() bool {
+	return strings.EqualFold(u.UserType, ServiceAccount)
+}
+
+// RoleNames returns the names of the roles of the user.
+func (u *User) RoleNames() []string {
+	names := make([]string, len(u.Roles))
+	for i, r := range u.Roles {
+		names[i] = r.Name
+	}
+
+	return names
+}
+
+// Value implements the driver.Valuer interface.
+// It marshals the department scope into a JSON array.
+func (s DepartmentScope) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+// It unmarshals the JSON array stored in the database into the department scope.
+func (s *DepartmentScope) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	case nil:
+		*s = nil
+		return nil
+	default:
+		return errors.New("failed to scan department scope")
+	}
+
+	return json.Unmarshal(data, s)
+}
@@ -0,0 +1,169 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/scheduler"
+	"gorm.io/gorm"
+)
+
+// defaultExpirationInterval is the interval of the expiration job when USER_EXPIRATION_INTERVAL_MINUTES is not set.
+const defaultExpirationInterval = 15 * time.Minute
+
+// expirationBatchSize is the number of users read at once by the expiration job.
+const expirationBatchSize = 100
+
+// ExpiredUser is a user expired by the expiration job, with what was expired.
+type ExpiredUser struct {
+	ID          int64  `json:"id"`
+	UserName    string `json:"userName"`
+	Account     bool   `json:"account"`
+	Credentials bool   `json:"credentials"`
+}
+
+// ExpireUsers marks the accounts and the credentials whose expiration date has passed as expired, one user per
+// transaction, so the login refuses them. The sessions of the expired accounts are revoked; an expired password
+// keeps the sessions, only the next login is refused. Each expiration is audited and publishes a user.updated event.
+// A user failing to expire is logged and the others are still expired, it is retried by the next run.
+// Once the context is done, the remaining users are left to the next run.
+func (s *userService) ExpireUsers(ctx context.Context, now time.Time) ([]ExpiredUser, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	var expired []ExpiredUser
+	failed := 0
+	for afterID := int64(0); ; {
+		ids, err := s.repo.GetExpiringUserIDs(db, now, afterID, expirationBatchSize)
+		if err != nil {
+			return expired, fmt.Errorf("failed to read the expiring users: %v", err)
+		}
+
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return expired, ctx.Err()
+			}
+
+			afterID = id
+			e, err := s.expireUser(ctx, db, id, now)
+			if err != nil {
+				logger.Error(fmt.Sprintf("failed to expire user %d: %v", id, err))
+				failed++
+				continue
+			}
+			if e.Account || e.Credentials {
+				expired = append(expired, e)
+			}
+		}
+
+		if len(ids) < expirationBatchSize {
+			break
+		}
+	}
+
+	// Forward the committed events without waiting for the next outbox poll
+	if len(expired) > 0 {
+		outbox.Notify()
+	}
+
+	if failed > 0 {
+		return expired, fmt.Errorf("failed to expire %d users", failed)
+	}
+
+	return expired, nil
+}
+
+// expireUser expires the account and/or the credentials of a user whose expiration date has passed.
+// The user is locked and read again, so a date moved in the meantime is respected.
+func (s *userService) expireUser(ctx context.Context, db *gorm.DB, id int64, now time.Time) (ExpiredUser, error) {
+	var expired ExpiredUser
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := s.repo.LockUser(tx, id); err != nil {
+			return err
+		}
+
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		account := isSet(existingUser.IsAccountNonExpired) && hasPassed(existingUser.AccountExpirationDate, now)
+		credentials := isSet(existingUser.IsCredentialsNonExpired) && hasPassed(existingUser.CredentialsExpirationDate, now)
+		if !account && !credentials {
+			return nil
+		}
+
+		updatedUser, err := s.repo.SetUserExpired(ctx, tx, existingUser, account, credentials)
+		if err != nil {
+			return err
+		}
+
+		// End the sessions of the expired account before the transaction commits
+		if account {
+			if err := revokeSessions(ctx, tx, updatedUser, now); err != nil {
+				return err
+			}
+		}
+
+		// Record the change in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditExpired, existingUser, updatedUser); err != nil {
+			return err
+		}
+
+		expired = ExpiredUser{ID: id, UserName: updatedUser.UserName, Account: account, Credentials: credentials}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserUpdated, updatedUser)
+	})
+
+	if err != nil {
+		return ExpiredUser{}, err
+	}
+
+	return expired, nil
+}
+
+// InitExpirationJob schedules the job expiring the accounts and the credentials every USER_EXPIRATION_INTERVAL_MINUTES.
+// Without Redis the access tokens of the expired accounts stay valid until they expire.
+func InitExpirationJob(db *gorm.DB, redisClient *redis.Client) {
+	if db == nil {
+		logger.Error("Failed to start the user expiration: database connection is nil")
+		return
+	}
+
+	service := NewUserService(NewUserRepository())
+
+	scheduler.Schedule(scheduler.Job{
+		Name:     "user-expiration",
+		Interval: expirationInterval,
+		Writes:   true,
+		Run: func(ctx context.Context) error {
+			ctx = dbcontext.InjectDB(ctx, db)
+			if redisClient != nil {
+				ctx = dbcontext.InjectRedisClient(ctx, redisClient)
+			}
+
+			expired, err := service.ExpireUsers(ctx, time.Now())
+			for _, e := range expired {
+				logger.Info(fmt.Sprintf("User %d (%s) expired: account %t, credentials %t", e.ID, e.UserName, e.Account, e.Credentials))
+			}
+			return err
+		},
+	})
+}
+
+// hasPassed checks if the date is set and not after now.
+func hasPassed(date *time.Time, now time.Time) bool {
+	return date != nil && !date.After(now)
+}
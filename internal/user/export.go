@@ -0,0 +1,36 @@
+package user
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+)
+
+// exportColumns are the columns of the user export, in their order in the file.
+// The email and the last login are sensitive, they are masked for the callers who are not admins.
+var exportColumns = []export.Column[User]{
+	{Key: "user.id", Value: func(u User, _ export.Options) string { return strconv.FormatInt(u.ID, 10) }},
+	{Key: "user.userName", Value: func(u User, _ export.Options) string { return u.UserName }},
+	{Key: "user.email", Sensitive: true, Value: func(u User, _ export.Options) string { return u.Email }},
+	{Key: "user.firstName", Value: func(u User, _ export.Options) string { return u.FirstName }},
+	{Key: "user.lastName", Value: func(u User, _ export.Options) string { return export.String(u.LastName) }},
+	{Key: "user.isEnabled", Value: func(u User, o export.Options) string { return export.Bool(u.IsEnabled != nil && *u.IsEnabled, o) }},
+	{Key: "user.userType", Value: func(u User, _ export.Options) string { return u.UserType }},
+	{Key: "user.departmentId", Value: func(u User, _ export.Options) string { return export.String(u.DepartmentID) }},
+	{Key: "user.roles", Value: func(u User, _ export.Options) string { return strings.Join(u.RoleNames(), ",") }},
+	{Key: "user.lastLogin", Sensitive: true, Value: func(u User, o export.Options) string { return export.Time(u.LastLogin, o) }},
+	{Key: "user.createdAt", Value: func(u User, o export.Options) string { return export.Time(u.CreatedAt, o) }},
+}
+
+// ExportColumns applies the masking policy to the columns of the user export for a caller with the given roles.
+// It returns the columns to export and the keys of the masked ones.
+func ExportColumns(roles []string) ([]export.Column[User], []string) {
+	return export.Mask(export.DefaultMaskPolicy, exportColumns, roles)
+}
+
+// WriteUsersCSV writes the users as CSV in the given columns, with the header translated in the language of the options.
+func WriteUsersCSV(w io.Writer, columns []export.Column[User], users []User, opts export.Options) error {
+	return export.WriteCSV(w, columns, users, opts)
+}
@@ -1,15 +1,33 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
+	"path"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 	"gopkg.in/go-playground/validator.v9"
 )
 
+// avatarFormOverhead is the size allowed for the multipart encoding of an avatar, on top of the image.
+const avatarFormOverhead = 64 << 10 // 64 KB
+
 // This struct defines the UserHandler which handles HTTP requests related to users.
 // It contains a service field of type UserService which is used to interact with the user data layer.
 type UserHandler struct {
@@ -28,17 +46,224 @@ func NewUserHandler(userService UserService) *UserHandler {
 // @Tags         users
 // @Accept       json
 // @Produce      json
+// @Param        limit  query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page   query     int     false  "Page number for the offset pagination"
+// @Param        after  query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Param        fields query     string  false  "Comma-separated fields to return (e.g. id,userName)"
+// @Param        role         query  string  false  "Role of the users (e.g. ROLE_ADMIN)"
+// @Param        enabled      query  bool    false  "Enabled or disabled users"
+// @Param        deleted      query  bool    false  "Only the soft-deleted users"
+// @Param        userType     query  string  false  "USER_ACCOUNT or SERVICE_ACCOUNT"
+// @Param        createdFrom  query  string  false  "Users created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        createdTo    query  string  false  "Users created before, a date includes the whole day (RFC 3339 or YYYY-MM-DD)"
+// @Param        sort         query  string  false  "Sort field (id, userName, email, firstName, lastName, createdAt, lastLogin), prefixed with - for descending"
 // @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
 // @Failure      500  {object}  model.HttpResponse for internal server error
 // @Router       /users [get]
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
-	users, err := h.Service.GetAllUsers(c.Request.Context())
+	h.listUsers(c, h.Service.GetAllUsers)
+}
+
+// GetRoleUsers retrieves the users having a role and returns them as JSON.
+// It accepts the filters, the order and the pagination of the user listing.
+// @Summary      Get the users of a role
+// @Description  Get the users having the role, filtered and paginated like the user listing
+// @Tags         roles
+// @Produce      json
+// @Param        id  path      int  true  "Role ID"
+// @Param        enabled  query  bool  false  "Enabled or disabled users"
+// @Param        deleted  query  bool  false  "Only the soft-deleted users"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for unknown role
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /roles/{id}/users [get]
+func (h *UserHandler) GetRoleUsers(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", "ID must be a positive integer")
+		return
+	}
+
+	h.listUsers(c, func(ctx context.Context, filter UserFilter, sort UserSort, page pagination.Params) ([]User, *pagination.Meta, error) {
+		return h.Service.GetRoleUsers(ctx, uint(id), filter, sort, page)
+	})
+}
+
+// GetUserStats retrieves the aggregate counts of the users and returns them as JSON.
+// @Summary      Get user statistics
+// @Description  Get the totals of the users by role, by user type, enabled and disabled, and the signups per month
+// @Tags         users
+// @Produce      json
+// @Param        months  query     int  false  "Number of months of signups, the current month included (1-36, default 12)"
+// @Success      200  {object}  model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/stats [get]
+func (h *UserHandler) GetUserStats(c *gin.Context) {
+	// Parse the number of months of signups from the query string
+	months, err := strconv.Atoi(c.DefaultQuery("months", strconv.Itoa(StatsDefaultMonths)))
+	if err != nil || months < 1 || months > StatsMaxMonths {
+		util.JSONError(c, http.StatusBadRequest, "Invalid months", fmt.Sprintf("months must be an integer between 1 and %d", StatsMaxMonths))
+		return
+	}
+
+	stats, err := h.Service.GetUserStats(c.Request.Context(), months)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve user statistics", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "User statistics retrieved successfully", stats)
+}
+
+// listUsers writes a page of the users returned by list for the filter, the order and the pagination of the request.
+func (h *UserHandler) listUsers(c *gin.Context, list func(ctx context.Context, filter UserFilter, sort UserSort, page pagination.Params) ([]User, *pagination.Meta, error)) {
+	// Parse the pagination from the query string
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	// Parse the filter and the order from the query string
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	sort, err := parseUserSort(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid sort", err.Error())
+		return
+	}
+
+	// The cursor follows the ID, so the other orders are paginated by page
+	if !sort.IsDefault() && page.IsPaginated() && !page.IsOffset() {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", "the cursor pagination only supports sort=id, use page instead")
+		return
+	}
+
+	// Parse the sparse fieldset from the query string
+	fields, err := util.ParseFields(c, User{})
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid fields", err.Error())
+		return
+	}
+
+	users, meta, err := list(c.Request.Context(), filter, sort, page)
+	if util.JSONAppError(c, "Failed to retrieve users", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve users", err.Error())
+		return
+	}
+
+	// Trim the users to the requested fields
+	data, err := util.SelectFields(users, fields)
 	if err != nil {
 		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve users", err.Error())
 		return
 	}
 
-	util.JSONSuccess(c, http.StatusOK, "All Users retrieved successfully", users)
+	// Link the listing to its pages
+	links := util.Links{"self": util.SelfLink(c)}
+	if meta != nil {
+		maps.Copy(links, pagination.Links(c, meta))
+		util.JSONSuccessWithLinks(c, http.StatusOK, "All Users retrieved successfully", data, meta, links)
+		return
+	}
+
+	util.JSONSuccessWithLinks(c, http.StatusOK, "All Users retrieved successfully", data, nil, links)
+}
+
+// ExportUsers exports the users matching the listing filter as a CSV file.
+// The email and the last login are masked for the callers who are not admins, and the masked exports are audited.
+// @Summary      Export users as CSV
+// @Description  Export the users as a CSV file, localized for spreadsheets, without the sensitive columns for the non-admins
+// @Tags         users
+// @Produce      text/csv
+// @Param        locale      query  string  false  "Locale of the header, booleans and defaults (e.g. de-DE), en by default"
+// @Param        delimiter   query  string  false  "comma, semicolon, tab or pipe (default of the locale)"
+// @Param        encoding    query  string  false  "utf-8 (default) or utf-8-bom for Excel"
+// @Param        dateFormat  query  string  false  "rfc3339, iso, date, eu, de, nl or us (default of the locale), in UTC"
+// @Param        limit       query  int     false  "Page size (1-100), enables the pagination"
+// @Param        page        query  int     false  "Page number for the offset pagination"
+// @Success      200  {file}    file      "CSV file"
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/export [get]
+func (h *UserHandler) ExportUsers(c *gin.Context) {
+	// Parse the pagination from the query string, the exports beyond the hard cap are split in pages
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	// Parse the filter and the order from the query string
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	sort, err := parseUserSort(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid sort", err.Error())
+		return
+	}
+
+	if !sort.IsDefault() && page.IsPaginated() && !page.IsOffset() {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", "the cursor pagination only supports sort=id, use page instead")
+		return
+	}
+
+	// The deleted users are only exported for the admins, like their listing
+	meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+	if filter.Deleted && !slices.Contains(meta.Roles, "ROLE_ADMIN") {
+		util.JSONError(c, http.StatusForbidden, "Forbidden", "only the admins can export the deleted users")
+		return
+	}
+
+	// Parse the format of the file from the query string
+	opts, err := export.NewOptions(c.Query("locale"), c.Query("delimiter"), c.Query("encoding"), c.Query("dateFormat"))
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid export options", err.Error())
+		return
+	}
+
+	users, _, err := h.Service.GetAllUsers(c.Request.Context(), filter, sort, page)
+	if util.JSONAppError(c, "Failed to export users", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to export users", err.Error())
+		return
+	}
+
+	// Mask the sensitive columns for the roles of the caller
+	columns, masked := ExportColumns(meta.Roles)
+
+	// A masked export is only produced once it is recorded
+	if len(masked) > 0 {
+		e := export.NewMaskedExport(c.Request.Context(), "users", masked, len(users), opts)
+		if err := h.Service.RecordMaskedExport(c.Request.Context(), e); err != nil {
+			util.JSONError(c, http.StatusInternalServerError, "Failed to export users", err.Error())
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="users.csv"`)
+	c.Status(http.StatusOK)
+	if err := WriteUsersCSV(c.Writer, columns, users, opts); err != nil {
+		logger.Error(fmt.Sprintf("failed to write the user export: %v", err))
+	}
 }
 
 // GetUserByID retrieves a user by their ID from the database and returns it as JSON.
@@ -48,6 +273,7 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        id   path      int  true  "User ID"
+// @Param        fields query   string  false "Comma-separated fields to return (e.g. id,userName)"
 // @Success      200  {object}  model.HttpResponse for successful retrieval
 // @Failure      400  {object}  model.HttpResponse for bad request
 // @Failure      404  {object}  model.HttpResponse for not found
@@ -62,8 +288,18 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
+	// Parse the sparse fieldset from the query string
+	fields, err := util.ParseFields(c, User{})
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid fields", err.Error())
+		return
+	}
+
 	// Retrieve the user by ID from the service
 	user, err := h.Service.GetUserByID(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to retrieve user", err) {
+		return
+	}
 	if err != nil {
 		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve user", err.Error())
 		return
@@ -74,7 +310,15 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	util.JSONSuccess(c, http.StatusOK, "User retrieved successfully", user)
+	// Trim the user to the requested fields
+	data, err := util.SelectFields(user, fields)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve user", err.Error())
+		return
+	}
+
+	links := userLinks(path.Dir(c.Request.URL.Path), user)
+	util.JSONSuccessWithLinks(c, http.StatusOK, "User retrieved successfully", data, nil, links)
 }
 
 // CreateUser creates a new user in the database and returns it as JSON.
@@ -86,6 +330,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 // @Param        user  body      model.User  true  "User object"
 // @Success      201  {object}  model.HttpResponse for successful creation
 // @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      422  {object}  model.HttpResponse for invalid role, unknown department or a user beyond the quota
 // @Failure      500  {object}  model.HttpResponse for internal server error
 // @Router       /users [post]
 func (h *UserHandler) CreateUser(c *gin.Context) {
@@ -107,9 +352,1202 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 			return
 		}
 
+		// An invalid role carries the failing role
+		var roleErr *RoleError
+		if errors.As(err, &roleErr) {
+			util.JSONAppErrorWithData(c, "Failed to create user", roleErr, roleErr.InvalidRole)
+			return
+		}
+
+		// A refusal by the quota carries the maximum and the current count
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			util.JSONAppErrorWithData(c, "Failed to create user", exceeded, exceeded.Exceeded)
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to create user", err) {
+			return
+		}
+
 		util.JSONError(c, http.StatusInternalServerError, "Failed to create user", err.Error())
 		return
 	}
 
-	util.JSONSuccess(c, http.StatusCreated, "User created successfully", createdUser)
+	links := userLinks(c.Request.URL.Path, createdUser)
+	util.JSONSuccessWithLinks(c, http.StatusCreated, "User created successfully", createdUser, nil, links)
+}
+
+// UpdateUser updates an existing user in the database and returns it as JSON.
+// @Summary      Update user
+// @Description  Update an existing user and replace its roles
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int         true  "User ID"
+// @Param        user  body      model.User  true  "User object"
+// @Success      200  {object}  model.HttpResponse for successful update
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      422  {object}  model.HttpResponse for invalid role or unknown department
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id} [put]
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Bind the JSON request body to the user struct
+	var user User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Update the user in the database
+	updatedUser, err := h.Service.UpdateUser(c.Request.Context(), id, user)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to update user", util.FormatValidationErrors(err))
+			return
+		}
+
+		// An invalid role carries the failing role
+		var roleErr *RoleError
+		if errors.As(err, &roleErr) {
+			util.JSONAppErrorWithData(c, "Failed to update user", roleErr, roleErr.InvalidRole)
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to update user", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to update user", err.Error())
+		return
+	}
+
+	links := userLinks(path.Dir(c.Request.URL.Path), updatedUser)
+	util.JSONSuccessWithLinks(c, http.StatusOK, "User updated successfully", updatedUser, nil, links)
+}
+
+// PatchUser updates the fields of a user given in the request body and returns it as JSON.
+// @Summary      Patch user
+// @Description  Update the fields of a user given in the body, the omitted fields are kept
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int              true  "User ID"
+// @Param        user  body      model.UserPatch  true  "Fields to update"
+// @Success      200  {object}  model.HttpResponse for successful update
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      422  {object}  model.HttpResponse for invalid role or unknown department
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id} [patch]
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Bind the JSON request body to the patch struct
+	var patch UserPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Update the given fields of the user in the database
+	updatedUser, err := h.Service.PatchUser(c.Request.Context(), id, patch)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to update user", util.FormatValidationErrors(err))
+			return
+		}
+
+		// An invalid role carries the failing role
+		var roleErr *RoleError
+		if errors.As(err, &roleErr) {
+			util.JSONAppErrorWithData(c, "Failed to update user", roleErr, roleErr.InvalidRole)
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to update user", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to update user", err.Error())
+		return
+	}
+
+	links := userLinks(path.Dir(c.Request.URL.Path), updatedUser)
+	util.JSONSuccessWithLinks(c, http.StatusOK, "User updated successfully", updatedUser, nil, links)
+}
+
+// DeleteUser soft-deletes a user by its ID.
+// @Summary      Delete user
+// @Description  Soft-delete a user, it can no longer log in or renew its token until it is restored
+// @Tags         users
+// @Produce      json
+// @Param        id  path      int  true  "User ID"
+// @Success      200  {object}  model.HttpResponse for successful deletion
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	err = h.Service.DeleteUser(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to delete user", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to delete user", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "User deleted successfully", nil)
+}
+
+// RestoreUser restores a soft-deleted user by its ID and returns it as JSON.
+// @Summary      Restore user
+// @Description  Restore a soft-deleted user
+// @Tags         users
+// @Produce      json
+// @Param        id  path      int  true  "User ID"
+// @Success      200  {object}  model.HttpResponse for successful restoration
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      409  {object}  model.HttpResponse for a user that is not deleted
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	restoredUser, err := h.Service.RestoreUser(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to restore user", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to restore user", err.Error())
+		return
+	}
+
+	links := userLinks(path.Dir(path.Dir(c.Request.URL.Path)), restoredUser)
+	util.JSONSuccessWithLinks(c, http.StatusOK, "User restored successfully", restoredUser, nil, links)
+}
+
+// EnableUser enables a user by its ID and returns it as JSON.
+// @Summary      Enable user
+// @Description  Enable a user, so it can log in again
+// @Tags         users
+// @Produce      json
+// @Param        id  path      int  true  "User ID"
+// @Success      200  {object}  model.HttpResponse for successful enabling
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/enable [post]
+func (h *UserHandler) EnableUser(c *gin.Context) {
+	h.setUserEnabled(c, true)
+}
+
+// DisableUser disables a user by its ID and returns it as JSON.
+// The sessions of the user are revoked immediately.
+// @Summary      Disable user
+// @Description  Disable a user and revoke its refresh token and access tokens
+// @Tags         users
+// @Produce      json
+// @Param        id  path      int  true  "User ID"
+// @Success      200  {object}  model.HttpResponse for successful disabling
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      409  {object}  model.HttpResponse for disabling one's own account
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/disable [post]
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	h.setUserEnabled(c, false)
+}
+
+// setUserEnabled enables or disables the user of the URL parameter.
+func (h *UserHandler) setUserEnabled(c *gin.Context, enabled bool) {
+	action, serve := "disable", h.Service.DisableUser
+	if enabled {
+		action, serve = "enable", h.Service.EnableUser
+	}
+
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	updatedUser, err := serve(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to "+action+" user", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to "+action+" user", err.Error())
+		return
+	}
+
+	links := userLinks(path.Dir(path.Dir(c.Request.URL.Path)), updatedUser)
+	util.JSONSuccessWithLinks(c, http.StatusOK, "User "+action+"d successfully", updatedUser, nil, links)
+}
+
+// GetMySessions retrieves the sessions of the authenticated user and returns them as JSON.
+// @Summary      Get my sessions
+// @Description  Get the active sessions of the authenticated user, one per login on a device
+// @Tags         users
+// @Produce      json
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/sessions [get]
+func (h *UserHandler) GetMySessions(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	sessions, err := h.Service.GetSessions(c.Request.Context(), meta.UserID)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve sessions", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Sessions retrieved successfully", sessions)
+}
+
+// RevokeMySession revokes a session of the authenticated user by its ID.
+// @Summary      Revoke my session
+// @Description  Revoke a session of the authenticated user, e.g. a lost device
+// @Tags         users
+// @Produce      json
+// @Param        id  path      string  true  "Session ID"
+// @Success      200  {object}  model.HttpResponse for successful revocation
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/sessions/{id} [delete]
+func (h *UserHandler) RevokeMySession(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	err := h.Service.RevokeSession(c.Request.Context(), meta.UserID, c.Param("id"))
+	if util.JSONAppError(c, "Failed to revoke session", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to revoke session", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// RevokeMyToken revokes the access token the request is authenticated with.
+// @Summary      Revoke my access token
+// @Description  Revoke the access token of the request until it expires, the other tokens and sessions stay valid
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  model.HttpResponse for successful revocation
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      422  {object}  model.HttpResponse for a token without ID
+// @Failure      503  {object}  model.HttpResponse for the revocation being unavailable
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/token [delete]
+func (h *UserHandler) RevokeMyToken(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	err := h.Service.RevokeToken(c.Request.Context(), meta.TokenID, meta.TokenExpiresAt)
+	if util.JSONAppError(c, "Failed to revoke token", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to revoke token", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Token revoked successfully", nil)
+}
+
+// RevokeUserSessions revokes all the sessions of a user by its ID.
+// @Summary      Revoke user sessions
+// @Description  Revoke the refresh tokens and the access tokens of a user, which stays enabled
+// @Tags         users
+// @Produce      json
+// @Param        id  path      int  true  "User ID"
+// @Success      200  {object}  model.HttpResponse for successful revocation
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/revoke-sessions [post]
+func (h *UserHandler) RevokeUserSessions(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	err = h.Service.RevokeSessions(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to revoke sessions", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Sessions revoked successfully", nil)
+}
+
+// TransferMembers moves the active members of a department to another one, e.g. before it is deleted.
+// @Summary      Transfer department members
+// @Description  Move the users assigned to a department to another department, each transfer is audited
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      TransferRequest  true  "Transfer request"
+// @Success      200  {object}  model.HttpResponse for successful transfer, with the transferred users
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      409  {object}  model.HttpResponse for an archived target department
+// @Failure      422  {object}  model.HttpResponse for an unknown target department or the same department
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/transfer [post]
+func (h *UserHandler) TransferMembers(c *gin.Context) {
+	// Bind the JSON request body to the transfer request struct
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	transfer, err := h.Service.TransferMembers(c.Request.Context(), req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to transfer members", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to transfer members", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to transfer members", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Members transferred successfully", transfer)
+}
+
+// IssueAPIKey issues an API key to a service account.
+// The key is only returned in this response, it cannot be retrieved later.
+// @Summary      Issue service account API key
+// @Description  Issue an API key a service account authenticates with in the X-API-Key header instead of a JWT
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int            true  "User ID"
+// @Param        request  body      APIKeyRequest  true  "API key request"
+// @Success      201  {object}  model.HttpResponse for successful issuance
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      422  {object}  model.HttpResponse for a user who is not a service account
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/api-keys [post]
+func (h *UserHandler) IssueAPIKey(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Bind the JSON request body to the API key request struct
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	issued, err := h.Service.IssueAPIKey(c.Request.Context(), id, req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to issue API key", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to issue API key", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to issue API key", err.Error())
+		return
+	}
+
+	// The key is a credential, it must not be kept by the caches
+	c.Header("Cache-Control", "no-store")
+	util.JSONSuccess(c, http.StatusCreated, "API key issued successfully, store it now as it cannot be retrieved again", issued)
+}
+
+// GetAPIKeys retrieves the API keys of a user, without the keys themselves.
+// @Summary      Get user API keys
+// @Description  Get the API keys issued to a user, revoked and expired ones included, the newest first
+// @Tags         users
+// @Produce      json
+// @Param        id  path      int  true  "User ID"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/api-keys [get]
+func (h *UserHandler) GetAPIKeys(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	keys, err := h.Service.GetAPIKeys(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to retrieve API keys", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve API keys", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "API keys retrieved successfully", keys)
+}
+
+// RevokeAPIKey revokes an API key of a user.
+// @Summary      Revoke user API key
+// @Description  Revoke an API key, the requests authenticated with it are refused from now on
+// @Tags         users
+// @Produce      json
+// @Param        id     path      int     true  "User ID"
+// @Param        keyId  path      string  true  "API key ID"
+// @Success      200  {object}  model.HttpResponse for successful revocation
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/api-keys/{keyId} [delete]
+func (h *UserHandler) RevokeAPIKey(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// The key IDs are UUIDs, the other values cannot match a key
+	keyID := c.Param("keyId")
+	if _, err := uuid.Parse(keyID); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid API key ID format", err.Error())
+		return
+	}
+
+	revoked, err := h.Service.RevokeAPIKey(c.Request.Context(), id, keyID)
+	if util.JSONAppError(c, "Failed to revoke API key", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to revoke API key", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "API key revoked successfully", revoked)
+}
+
+// GetUserAudit retrieves the audit trail of a user and returns it as JSON.
+// @Summary      Get user audit trail
+// @Description  Get the admin actions recorded on a user, deleted or not, the oldest first
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int     true   "User ID"
+// @Param        limit  query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page   query     int     false  "Page number for the offset pagination"
+// @Param        after  query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/audit [get]
+func (h *UserHandler) GetUserAudit(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Parse the pagination from the query string
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	entries, meta, err := h.Service.GetUserAudit(c.Request.Context(), id, page)
+	if util.JSONAppError(c, "Failed to retrieve audit trail", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve audit trail", err.Error())
+		return
+	}
+
+	// Link the listing to its pages
+	links := util.Links{"self": util.SelfLink(c)}
+	if meta != nil {
+		maps.Copy(links, pagination.Links(c, meta))
+		util.JSONSuccessWithLinks(c, http.StatusOK, "Audit trail retrieved successfully", entries, meta, links)
+		return
+	}
+
+	util.JSONSuccessWithLinks(c, http.StatusOK, "Audit trail retrieved successfully", entries, nil, links)
+}
+
+// GetUserLogins retrieves the login attempts of a user and returns them as JSON.
+// @Summary      Get user logins
+// @Description  Get the login attempts of a user, deleted or not, successful or not, the oldest first
+// @Tags         users
+// @Produce      json
+// @Param        id       path      int     true   "User ID"
+// @Param        success  query     bool    false  "Only the successful (true) or failed (false) attempts"
+// @Param        ip       query     string  false  "IP address of the attempts"
+// @Param        since    query     string  false  "Attempts since the time (RFC 3339) or the date (YYYY-MM-DD)"
+// @Param        limit    query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page     query     int     false  "Page number for the offset pagination"
+// @Param        after    query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/{id}/logins [get]
+func (h *UserHandler) GetUserLogins(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	h.listLoginAttempts(c, id)
+}
+
+// GetLoginAttempts retrieves the login attempts of all the users and returns them as JSON.
+// @Summary      Get login attempts
+// @Description  Get the login attempts of all the usernames, known or not, successful or not, the oldest first
+// @Tags         users
+// @Produce      json
+// @Param        userName  query     string  false  "Username given in the attempts"
+// @Param        success   query     bool    false  "Only the successful (true) or failed (false) attempts"
+// @Param        ip        query     string  false  "IP address of the attempts"
+// @Param        since     query     string  false  "Attempts since the time (RFC 3339) or the date (YYYY-MM-DD)"
+// @Param        limit     query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page      query     int     false  "Page number for the offset pagination"
+// @Param        after     query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/logins [get]
+func (h *UserHandler) GetLoginAttempts(c *gin.Context) {
+	h.listLoginAttempts(c, 0)
+}
+
+// listLoginAttempts writes a page of the login attempts of the user, or of all the users when userID is 0,
+// with the filters and the pagination of the request.
+func (h *UserHandler) listLoginAttempts(c *gin.Context, userID int64) {
+	filter, err := parseLoginAttemptFilter(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", err.Error())
+		return
+	}
+
+	// Parse the pagination from the query string
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	var attempts []LoginAttempt
+	var meta *pagination.Meta
+	if userID != 0 {
+		attempts, meta, err = h.Service.GetUserLogins(c.Request.Context(), userID, filter, page)
+	} else {
+		attempts, meta, err = h.Service.GetLoginAttempts(c.Request.Context(), filter, page)
+	}
+	if util.JSONAppError(c, "Failed to retrieve login attempts", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve login attempts", err.Error())
+		return
+	}
+
+	// Link the listing to its pages
+	links := util.Links{"self": util.SelfLink(c)}
+	if meta != nil {
+		maps.Copy(links, pagination.Links(c, meta))
+		util.JSONSuccessWithLinks(c, http.StatusOK, "Login attempts retrieved successfully", attempts, meta, links)
+		return
+	}
+
+	util.JSONSuccessWithLinks(c, http.StatusOK, "Login attempts retrieved successfully", attempts, nil, links)
+}
+
+// UpdateMyAvatar uploads the avatar of the authenticated user and returns the user as JSON.
+// @Summary      Update my avatar
+// @Description  Upload a PNG, JPEG, GIF or WebP image as the avatar of the authenticated user, in the avatar field of a multipart form
+// @Tags         users
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        avatar  formData  file  true  "Avatar image"
+// @Success      200  {object}  model.HttpResponse for successful upload
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      413  {object}  model.HttpResponse for an image exceeding the maximum size
+// @Failure      415  {object}  model.HttpResponse for an unsupported image type
+// @Failure      503  {object}  model.HttpResponse for uploads not configured
+// @Router       /users/me/avatar [put]
+func (h *UserHandler) UpdateMyAvatar(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	// Bound the request body, the multipart encoding adds its boundaries and headers to the image
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, avatarMaxBytes+avatarFormOverhead)
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			util.JSONAppError(c, "Failed to update avatar", ErrAvatarTooLarge)
+			return
+		}
+		util.JSONError(c, http.StatusBadRequest, "Invalid avatar", err.Error())
+		return
+	}
+	if fileHeader.Size > avatarMaxBytes {
+		util.JSONAppError(c, "Failed to update avatar", ErrAvatarTooLarge)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid avatar", err.Error())
+		return
+	}
+	defer file.Close()
+
+	// Read one byte more than the maximum size, so the service detects an oversized image
+	data, err := io.ReadAll(io.LimitReader(file, avatarMaxBytes+1))
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid avatar", err.Error())
+		return
+	}
+
+	// Detect the type from the content, the name and the header of the part are chosen by the client
+	updatedUser, err := h.Service.UpdateAvatar(c.Request.Context(), meta.UserID, http.DetectContentType(data), data)
+	if util.JSONAppError(c, "Failed to update avatar", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to update avatar", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Avatar updated successfully", updatedUser)
+}
+
+// RequestMyEmailChange stages a new e-mail for the authenticated user and sends a confirmation token to it.
+// @Summary      Change my e-mail
+// @Description  Stage a new e-mail for the authenticated user, which replaces the current one once confirmed with the token sent to it
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      EmailChangeRequest  true  "E-mail change request"
+// @Success      202  {object}  model.HttpResponse for a staged change
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      409  {object}  model.HttpResponse for an e-mail of another user
+// @Failure      422  {object}  model.HttpResponse for the current e-mail
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/email [post]
+func (h *UserHandler) RequestMyEmailChange(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	// Bind the JSON request body to the e-mail change request struct
+	var req EmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	err := h.Service.RequestEmailChange(c.Request.Context(), meta.UserID, req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to change email", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to change email", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to change email", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusAccepted, "A confirmation token was sent to the new email, the email is changed once it is confirmed", nil)
+}
+
+// ConfirmMyEmailChange replaces the e-mail of the authenticated user with its staged e-mail and returns the user as JSON.
+// @Summary      Confirm my e-mail change
+// @Description  Confirm the staged e-mail of the authenticated user with the token sent to it, the previous address is notified
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      EmailConfirmationRequest  true  "E-mail confirmation request"
+// @Success      200  {object}  model.HttpResponse for successful change
+// @Failure      400  {object}  model.HttpResponse for bad request or an invalid token
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      409  {object}  model.HttpResponse for an e-mail taken since the change was staged
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/email/confirm [post]
+func (h *UserHandler) ConfirmMyEmailChange(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	// Bind the JSON request body to the e-mail confirmation request struct
+	var req EmailConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	updatedUser, err := h.Service.ConfirmEmailChange(c.Request.Context(), meta.UserID, req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to confirm email", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to confirm email", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to confirm email", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Email changed successfully", updatedUser)
+}
+
+// RequestMyRole requests an additional role for the authenticated user and returns the request as JSON.
+// @Summary      Request a role
+// @Description  Request an additional role with a justification, the role is granted once an admin approves the request
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        request  body      RoleRequestCreate  true  "Role request"
+// @Success      201  {object}  model.HttpResponse for successful request
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      409  {object}  model.HttpResponse for a role already held or already requested
+// @Failure      422  {object}  model.HttpResponse for an unknown role
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/role-requests [post]
+func (h *UserHandler) RequestMyRole(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	// Bind the JSON request body to the role request struct
+	var req RoleRequestCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	created, err := h.Service.RequestRole(c.Request.Context(), meta.UserID, req)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to request role", util.FormatValidationErrors(err))
+			return
+		}
+
+		// An unknown role carries the failing role
+		var roleErr *RoleError
+		if errors.As(err, &roleErr) {
+			util.JSONAppErrorWithData(c, "Failed to request role", roleErr, roleErr.InvalidRole)
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to request role", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to request role", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusCreated, "Role requested successfully, it is granted once an admin approves it", created)
+}
+
+// GetMyRoleRequests retrieves the role requests of the authenticated user and returns them as JSON.
+// @Summary      Get my role requests
+// @Description  Get the role requests of the authenticated user with their decisions, the oldest first
+// @Tags         users
+// @Produce      json
+// @Param        status  query     string  false  "Status of the requests (PENDING, APPROVED or DENIED)"
+// @Param        limit   query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page    query     int     false  "Page number for the offset pagination"
+// @Param        after   query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      401  {object}  model.HttpResponse for unauthorized
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /users/me/role-requests [get]
+func (h *UserHandler) GetMyRoleRequests(c *gin.Context) {
+	// Extract the authenticated user from the context
+	meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+	if !ok {
+		util.JSONError(c, http.StatusUnauthorized, "Unauthorized", "missing user context")
+		return
+	}
+
+	h.listRoleRequests(c, meta.UserID)
+}
+
+// GetRoleRequests retrieves the role requests of all the users and returns them as JSON.
+// @Summary      Get role requests
+// @Description  Get the role requests of the users, e.g. the pending ones waiting for a decision, the oldest first
+// @Tags         role-requests
+// @Produce      json
+// @Param        status  query     string  false  "Status of the requests (PENDING, APPROVED or DENIED)"
+// @Param        limit   query     int     false  "Page size (1-100), enables the pagination"
+// @Param        page    query     int     false  "Page number for the offset pagination"
+// @Param        after   query     string  false  "Opaque cursor returned as nextCursor for the cursor pagination"
+// @Success      200  {array}   model.HttpResponse for successful retrieval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /role-requests [get]
+func (h *UserHandler) GetRoleRequests(c *gin.Context) {
+	h.listRoleRequests(c, 0)
+}
+
+// listRoleRequests writes a page of the role requests of the user, or of all the users when userID is 0,
+// with the status filter and the pagination of the request.
+func (h *UserHandler) listRoleRequests(c *gin.Context, userID int64) {
+	filter := RoleRequestFilter{UserID: userID, Status: strings.ToUpper(c.Query("status"))}
+	if filter.Status != "" && !slices.Contains(RoleRequestStatuses, filter.Status) {
+		util.JSONError(c, http.StatusBadRequest, "Invalid filter", fmt.Sprintf("status must be one of %s", strings.Join(RoleRequestStatuses, ", ")))
+		return
+	}
+
+	// Parse the pagination from the query string
+	page, err := pagination.ParseParams(c)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	requests, meta, err := h.Service.GetRoleRequests(c.Request.Context(), filter, page)
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve role requests", err.Error())
+		return
+	}
+
+	// Link the listing to its pages
+	links := util.Links{"self": util.SelfLink(c)}
+	if meta != nil {
+		maps.Copy(links, pagination.Links(c, meta))
+		util.JSONSuccessWithLinks(c, http.StatusOK, "Role requests retrieved successfully", requests, meta, links)
+		return
+	}
+
+	util.JSONSuccessWithLinks(c, http.StatusOK, "Role requests retrieved successfully", requests, nil, links)
+}
+
+// ApproveRoleRequest approves a role request by its ID and returns it as JSON.
+// @Summary      Approve role request
+// @Description  Approve a pending role request, the role is assigned to the user and applies from its next token refresh
+// @Tags         role-requests
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                  true   "Role request ID"
+// @Param        request  body      RoleRequestDecision  false  "Decision note"
+// @Success      200  {object}  model.HttpResponse for successful approval
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      403  {object}  model.HttpResponse for a request of the admin
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      409  {object}  model.HttpResponse for a request already decided
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /role-requests/{id}/approve [post]
+func (h *UserHandler) ApproveRoleRequest(c *gin.Context) {
+	h.decideRoleRequest(c, "approve", h.Service.ApproveRoleRequest)
+}
+
+// DenyRoleRequest denies a role request by its ID and returns it as JSON.
+// @Summary      Deny role request
+// @Description  Deny a pending role request, the note tells the user why
+// @Tags         role-requests
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                  true   "Role request ID"
+// @Param        request  body      RoleRequestDecision  false  "Decision note"
+// @Success      200  {object}  model.HttpResponse for successful denial
+// @Failure      400  {object}  model.HttpResponse for bad request
+// @Failure      403  {object}  model.HttpResponse for a request of the admin
+// @Failure      404  {object}  model.HttpResponse for not found
+// @Failure      409  {object}  model.HttpResponse for a request already decided
+// @Failure      500  {object}  model.HttpResponse for internal server error
+// @Router       /role-requests/{id}/deny [post]
+func (h *UserHandler) DenyRoleRequest(c *gin.Context) {
+	h.decideRoleRequest(c, "deny", h.Service.DenyRoleRequest)
+}
+
+// decideRoleRequest writes the role request decided by decide, verb names the decision in the messages.
+// The body is optional, a request without body decides without a note.
+func (h *UserHandler) decideRoleRequest(c *gin.Context, verb string, decide func(ctx context.Context, id int64, decision RoleRequestDecision) (RoleRequest, error)) {
+	// Parse the ID from the URL parameter
+	// and convert it to an int64
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Bind the JSON request body to the decision struct
+	var decision RoleRequestDecision
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	failure := "Failed to " + verb + " role request"
+	decided, err := decide(c.Request.Context(), id, decision)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, failure, util.FormatValidationErrors(err))
+			return
+		}
+
+		// A role deleted since the request carries the failing role
+		var roleErr *RoleError
+		if errors.As(err, &roleErr) {
+			util.JSONAppErrorWithData(c, failure, roleErr, roleErr.InvalidRole)
+			return
+		}
+
+		if util.JSONAppError(c, failure, err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, failure, err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Role request "+strings.ToLower(decided.Status)+" successfully", decided)
+}
+
+// userLinks builds the links of a user.
+func userLinks(collection string, user User) util.Links {
+	return util.Links{
+		"self":       util.ResourceLink(collection, strconv.FormatInt(user.ID, 10)),
+		"collection": collection,
+	}
+}
+
+// parseUserFilter parses the listing filter from the query string.
+// The created dates are given as RFC 3339 or as a date; a createdTo date includes the whole day (UTC).
+func parseUserFilter(c *gin.Context) (UserFilter, error) {
+	filter := UserFilter{
+		Role:     strings.ToUpper(c.Query("role")),
+		UserType: strings.ToUpper(c.Query("userType")),
+	}
+
+	if filter.Role != "" && !role.IsKnown(filter.Role) {
+		return UserFilter{}, errors.New("role must be one of: " + strings.Join(role.Names(), ", "))
+	}
+
+	switch filter.UserType {
+	case "", "USER_ACCOUNT", "SERVICE_ACCOUNT":
+	default:
+		return UserFilter{}, errors.New("userType must be one of: USER_ACCOUNT, SERVICE_ACCOUNT")
+	}
+
+	if value := c.Query("enabled"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return UserFilter{}, errors.New("enabled must be true or false")
+		}
+		filter.Enabled = &enabled
+	}
+
+	if value := c.Query("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			return UserFilter{}, errors.New("deleted must be true or false")
+		}
+		filter.Deleted = deleted
+	}
+
+	if value := c.Query("createdFrom"); value != "" {
+		t, err := parseCreatedAt(value, false)
+		if err != nil {
+			return UserFilter{}, fmt.Errorf("createdFrom %w", err)
+		}
+		filter.CreatedFrom = &t
+	}
+
+	if value := c.Query("createdTo"); value != "" {
+		t, err := parseCreatedAt(value, true)
+		if err != nil {
+			return UserFilter{}, fmt.Errorf("createdTo %w", err)
+		}
+		filter.CreatedTo = &t
+	}
+
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return UserFilter{}, errors.New("createdFrom must be before createdTo")
+	}
+
+	return filter, nil
+}
+
+// parseLoginAttemptFilter parses the login attempt filter from the query string.
+func parseLoginAttemptFilter(c *gin.Context) (LoginAttemptFilter, error) {
+	filter := LoginAttemptFilter{UserName: c.Query("userName"), IPAddress: c.Query("ip")}
+
+	if value := c.Query("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return LoginAttemptFilter{}, errors.New("success must be true or false")
+		}
+		filter.Success = &success
+	}
+
+	if value := c.Query("since"); value != "" {
+		t, err := parseCreatedAt(value, false)
+		if err != nil {
+			return LoginAttemptFilter{}, fmt.Errorf("since %w", err)
+		}
+		filter.Since = &t
+	}
+
+	return filter, nil
+}
+
+// parseCreatedAt parses a created date of the filter.
+// A date means the start of that day (UTC), or the start of the next day for the end of a range.
+func parseCreatedAt(value string, endOfRange bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+
+	if endOfRange {
+		return day.AddDate(0, 0, 1), nil
+	}
+	return day, nil
+}
+
+// parseUserSort parses the listing order from the query string (?sort=createdAt or ?sort=-createdAt).
+func parseUserSort(c *gin.Context) (UserSort, error) {
+	value := c.Query("sort")
+	if value == "" {
+		return UserSort{}, nil
+	}
+
+	field, desc := strings.CutPrefix(value, "-")
+	if _, ok := UserSortFields[field]; !ok {
+		return UserSort{}, fmt.Errorf("sort must be one of: %s, prefixed with - for descending", strings.Join(slices.Sorted(maps.Keys(UserSortFields)), ", "))
+	}
+
+	return UserSort{Field: field, Desc: desc}, nil
 }
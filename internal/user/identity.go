@@ -0,0 +1,183 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// AuditIdentityLinked is the action recorded when an external identity is linked to a user.
+const AuditIdentityLinked = "identity_linked"
+
+var (
+	ErrIdentityNotLinked  = apperror.New("ExternalIdentityNotLinked", http.StatusForbidden, "no user is linked to the external identity and the automatic provisioning is disabled")
+	ErrIdentityUnverified = apperror.New("ExternalEmailNotVerified", http.StatusForbidden, "the provider does not vouch for the e-mail of the external identity")
+)
+
+// ErrIdentityNotFound is returned by the repository for an external identity without link.
+var ErrIdentityNotFound = errors.New("external identity not found")
+
+// ExternalIdentity links the account of a user at an OpenID Connect provider (e.g. Google) to the local user.
+// The account is identified by its subject, which the provider never reassigns, unlike the e-mail.
+type ExternalIdentity struct {
+	ID          int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID      int64      `gorm:"column:user_id;not null;index" json:"userId"`
+	Provider    string     `gorm:"column:provider;type:varchar(20);not null;uniqueIndex:idx_user_identity_subject" json:"provider"`
+	Subject     string     `gorm:"column:subject;type:varchar(255);not null;uniqueIndex:idx_user_identity_subject" json:"subject"`
+	Email       string     `gorm:"column:email;type:varchar(100)" json:"email,omitempty"`
+	LastLoginAt *time.Time `gorm:"column:last_login_at;type:timestamptz" json:"lastLoginAt,omitempty"`
+	CreatedAt   *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+}
+
+// TableName returns the table of the external identities.
+func (ExternalIdentity) TableName() string {
+	return "user_identities"
+}
+
+// ExternalLogin is the identity of a user logging in with an OpenID Connect provider, read from its ID token.
+// The e-mail is only set when the provider vouches for it.
+type ExternalLogin struct {
+	Provider  string
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// ResolveExternalIdentity returns the local user of an external identity.
+// An identity logging in for the first time is linked to the user with its e-mail, or to a new user
+// with the RegisteredRole when autoProvision is set. The new users get a random password,
+// they log in with their provider or set a password with the password reset.
+func (s *userService) ResolveExternalIdentity(ctx context.Context, login ExternalLogin, autoProvision bool) (User, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return User{}, errors.New("database connection is nil")
+	}
+
+	now := time.Now().UTC()
+
+	// The identities already linked log in as their user
+	identity, err := s.repo.GetExternalIdentity(db, login.Provider, login.Subject)
+	if err == nil {
+		if err := s.repo.TouchExternalIdentity(ctx, db, identity.ID, now); err != nil {
+			logger.Warn(fmt.Sprintf("failed to record the login of identity %d: %v", identity.ID, err))
+		}
+		return s.repo.GetUserByID(db, identity.UserID)
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return User{}, err
+	}
+
+	// A new identity is matched by its e-mail, which must be verified by the provider
+	if login.Email == "" {
+		return User{}, ErrIdentityUnverified
+	}
+	linkedUser, err := s.repo.GetUserByEmail(db, login.Email)
+	if errors.Is(err, ErrUserEmailNotFound) {
+		if !autoProvision {
+			return User{}, ErrIdentityNotLinked
+		}
+		linkedUser, err = s.provisionUser(ctx, login)
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	// The service accounts never log in interactively
+	if linkedUser.IsServiceAccount() {
+		return User{}, ErrIdentityNotLinked
+	}
+
+	// Link the identity, so the next logins do not depend on the e-mail
+	err = db.Transaction(func(tx *gorm.DB) error {
+		identity := ExternalIdentity{UserID: linkedUser.ID, Provider: login.Provider, Subject: login.Subject, Email: login.Email, LastLoginAt: &now}
+		if err := s.repo.CreateExternalIdentity(ctx, tx, identity); err != nil {
+			return err
+		}
+
+		changes := AuditChanges{"identity": {Before: nil, After: login.Provider + ":" + login.Subject}}
+		return s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, linkedUser.ID, AuditIdentityLinked, changes))
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to link the %s identity of user %d: %v", login.Provider, linkedUser.ID, err))
+		return User{}, err
+	}
+
+	return linkedUser, nil
+}
+
+// provisionUser creates the user of an external identity, named after its e-mail.
+func (s *userService) provisionUser(ctx context.Context, login ExternalLogin) (User, error) {
+	userName, err := ExternalUserName(login.Email)
+	if err != nil {
+		return User{}, err
+	}
+
+	// The password is random and never given, it is only set with the password reset
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return User{}, err
+	}
+	passwordHash, err := HashPassword(base64.RawURLEncoding.EncodeToString(password))
+	if err != nil {
+		return User{}, err
+	}
+
+	firstName := truncate(login.FirstName, 20)
+	if firstName == "" {
+		firstName = userName
+	}
+	var lastName *string
+	if login.LastName != "" {
+		name := truncate(login.LastName, 20)
+		lastName = &name
+	}
+
+	return s.RegisterUser(ctx, User{UserName: userName, Email: login.Email, Password: passwordHash, FirstName: firstName, LastName: lastName})
+}
+
+// ExternalUserName returns a username for the user of an external identity: the local part of its e-mail,
+// shortened and followed by a random suffix, so two users with the same local part get different names.
+func ExternalUserName(email string) (string, error) {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	var b strings.Builder
+	for _, r := range local {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	base := truncate(b.String(), 15)
+	if base == "" {
+		base = "user"
+	}
+
+	suffix := make([]byte, 2)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	return base + "_" + hex.EncodeToString(suffix), nil
+}
+
+// truncate shortens the string to the given number of runes.
+func truncate(s string, n int) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return string(runes)
+}
@@ -0,0 +1,144 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+)
+
+// Methods of the login attempts
+const (
+	LoginMethodPassword = "password"
+	LoginMethodOIDC     = "oidc"
+)
+
+// LoginAttempt represents a login attempt recorded in the login audit, successful or not.
+// The user is empty when the username is unknown, the attempt is then only identified by the given username.
+// The attempts are kept when the user is deleted.
+type LoginAttempt struct {
+	ID            int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID        *int64     `gorm:"column:user_id;index" json:"userId,omitempty"`
+	UserName      string     `gorm:"column:username;type:varchar(100);not null;index" json:"userName"`
+	Method        string     `gorm:"column:method;type:varchar(20);not null" json:"method"`
+	Success       bool       `gorm:"column:success;not null" json:"success"`
+	FailureReason string     `gorm:"column:failure_reason;type:varchar(255)" json:"failureReason,omitempty"`
+	IPAddress     string     `gorm:"column:ip_address;type:varchar(45)" json:"ipAddress,omitempty"`
+	UserAgent     string     `gorm:"column:user_agent;type:varchar(255)" json:"userAgent,omitempty"`
+	RequestID     string     `gorm:"column:request_id;type:varchar(36)" json:"requestId,omitempty"`
+	CreatedAt     *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now();index" json:"createdAt,omitempty"`
+}
+
+// TableName returns the table of the login attempts.
+func (LoginAttempt) TableName() string {
+	return "login_audit"
+}
+
+// LoginAttemptFilter holds the filters of the login attempt listing, the zero values do not filter.
+type LoginAttemptFilter struct {
+	UserID    int64
+	UserName  string
+	IPAddress string
+	Success   *bool
+	Since     *time.Time
+}
+
+// NewLoginAttempt creates a login attempt of the username from the address and the user agent,
+// with the request ID of the context. The outcome is set once the login is over.
+func NewLoginAttempt(ctx context.Context, method string, userName string, ipAddress string, userAgent string) LoginAttempt {
+	return LoginAttempt{
+		UserName:  truncate(userName, 100),
+		Method:    method,
+		IPAddress: truncate(ipAddress, 45),
+		UserAgent: truncate(userAgent, 255),
+		RequestID: metacontext.RequestIDFrom(ctx),
+	}
+}
+
+// Fail records the failure of the attempt with its reason.
+func (a *LoginAttempt) Fail(reason string) {
+	a.Success = false
+	a.FailureReason = truncate(reason, 255)
+}
+
+// RecordLoginAttempt inserts a login attempt into the login audit.
+func (s *userService) RecordLoginAttempt(ctx context.Context, attempt LoginAttempt) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	if err := s.repo.AddLoginAttempt(ctx, db, attempt); err != nil {
+		logger.Error(fmt.Sprintf("failed to record the login attempt of %s: %v", attempt.UserName, err))
+		return err
+	}
+
+	return nil
+}
+
+// GetUserLogins retrieves the login attempts of a user, deleted or not, the oldest first.
+// The page metadata is nil when the listing is not paginated.
+func (s *userService) GetUserLogins(ctx context.Context, id int64, filter LoginAttemptFilter, page pagination.Params) ([]LoginAttempt, *pagination.Meta, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
+	}
+
+	// Check if the user exists, the login attempts of a deleted user are kept
+	if _, err := s.repo.GetUserByID(db, id); errors.Is(err, ErrUserNotFound) {
+		if _, err := s.repo.GetDeletedUserByID(db, id); err != nil {
+			if errors.Is(err, ErrUserNotDeleted) {
+				return nil, nil, ErrUserNotFound
+			}
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	filter.UserID = id
+	return s.GetLoginAttempts(ctx, filter, page)
+}
+
+// GetLoginAttempts retrieves the login attempts matching the filter, the oldest first.
+// The page metadata is nil when the listing is not paginated.
+func (s *userService) GetLoginAttempts(ctx context.Context, filter LoginAttemptFilter, page pagination.Params) ([]LoginAttempt, *pagination.Meta, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
+	}
+
+	attempts, err := s.repo.GetLoginAttempts(db, filter, page)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get login attempts: %v", err))
+		return nil, nil, err
+	}
+
+	// Build the page metadata
+	attempts, meta, err := pagination.Paginate(attempts, page, func(a LoginAttempt) string { return strconv.FormatInt(a.ID, 10) })
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta != nil && page.IsOffset() {
+		total, err := s.repo.CountLoginAttempts(db, filter)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to count login attempts: %v", err))
+			return nil, nil, err
+		}
+		meta.TotalItems = &total
+	}
+
+	return attempts, meta, nil
+}
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Operations documents the user handlers in the OpenAPI spec, keyed by handler method name.
+// The errors listed here are the typed errors returned by the service for each operation.
+var Operations = map[string]openapi.Operation{
+	"GetAllUsers":  {Summary: "List users"},
+	"GetUserStats": {Summary: "Get the user statistics of the admin dashboards"},
+	"GetUserByID": {
+		Summary: "Get user by ID",
+		Errors:  []*apperror.Error{ErrUserNotFound},
+		Example: "user",
+	},
+	"CreateUser": {
+		Summary:       "Create a new user",
+		RequestSchema: "user",
+		SuccessStatus: http.StatusCreated,
+		Errors:        []*apperror.Error{ErrUserNameTaken, ErrEmailTaken, ErrUserNameDeleted, ErrEmailDeleted, ErrInvalidRole, ErrUserQuotaExceeded, department.ErrUnknownDepartment},
+		Example:       "user",
+	},
+	"UpdateUser": {
+		Summary:       "Update a user",
+		RequestSchema: "user",
+		Errors:        []*apperror.Error{ErrUserNotFound, ErrUserNameTaken, ErrEmailTaken, ErrUserNameDeleted, ErrEmailDeleted, ErrInvalidRole, department.ErrUnknownDepartment},
+		Example:       "user",
+	},
+	"DeleteUser": {
+		Summary: "Delete a user",
+		Errors:  []*apperror.Error{ErrUserNotFound},
+	},
+	"RestoreUser": {
+		Summary: "Restore a deleted user",
+		Errors:  []*apperror.Error{ErrUserNotDeleted, ErrUserNameTaken, ErrEmailTaken},
+		Example: "user",
+	},
+	"EnableUser": {
+		Summary: "Enable a user",
+		Errors:  []*apperror.Error{ErrUserNotFound},
+	},
+	"DisableUser": {
+		Summary: "Disable a user and end its sessions",
+		Errors:  []*apperror.Error{ErrUserNotFound, ErrDisableSelf},
+	},
+	"GetUserLogins": {
+		Summary: "List the login attempts of a user",
+		Errors:  []*apperror.Error{ErrUserNotFound},
+	},
+	"GetLoginAttempts": {Summary: "List the login attempts of all the users"},
+	"RevokeMyToken": {
+		Summary: "Revoke the access token of the request",
+		Errors:  []*apperror.Error{ErrTokenNotRevocable, ErrRevocationOff},
+	},
+	"RequestMyRole": {
+		Summary:       "Request an additional role",
+		RequestSchema: "role-request",
+		SuccessStatus: http.StatusCreated,
+		Errors:        []*apperror.Error{ErrRoleAlreadyHeld, ErrRoleRequestPending, ErrInvalidRole},
+	},
+	"GetMyRoleRequests": {Summary: "List my role requests"},
+	"GetRoleRequests":   {Summary: "List the role requests of the users"},
+	"ApproveRoleRequest": {
+		Summary: "Approve a role request and assign the role",
+		Errors:  []*apperror.Error{ErrRoleRequestNotFound, ErrRoleRequestDecided, ErrRoleRequestSelf, ErrInvalidRole},
+	},
+	"DenyRoleRequest": {
+		Summary: "Deny a role request",
+		Errors:  []*apperror.Error{ErrRoleRequestNotFound, ErrRoleRequestDecided, ErrRoleRequestSelf},
+	},
+}
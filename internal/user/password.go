@@ -0,0 +1,168 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms of the password hashes, selected by PASSWORD_HASH_ALGORITHM
+const (
+	HashBcrypt   = "BCRYPT"
+	HashArgon2id = "ARGON2ID"
+)
+
+// Default parameters of the argon2id hashes, as recommended by RFC 9106 for the memory-constrained environments
+const (
+	defaultArgon2Memory      = 64 * 1024 // KiB
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// Errors returned when checking a password against its hash
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	ErrUnknownHash      = errors.New("password hash has an unknown format")
+)
+
+// PasswordHasher hashes the passwords with an algorithm and checks them against the hashes of the algorithm.
+type PasswordHasher interface {
+	// Hash hashes a plain-text password with the parameters of the hasher.
+	Hash(password string) (string, error)
+
+	// Verify checks a plain-text password against a hash of the algorithm.
+	// It reports whether the hash was produced with other parameters than the ones of the hasher.
+	Verify(hash string, password string) (outdated bool, err error)
+
+	// Handles reports whether the hash was produced by the algorithm of the hasher.
+	Handles(hash string) bool
+}
+
+// BcryptHasher hashes the passwords with bcrypt at the given cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+// Argon2idHasher hashes the passwords with argon2id, encoded in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Hash implements the PasswordHasher interface.
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Verify implements the PasswordHasher interface.
+func (h BcryptHasher) Verify(hash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, ErrPasswordMismatch
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, err
+	}
+
+	return cost != h.Cost, nil
+}
+
+// Handles implements the PasswordHasher interface.
+func (h BcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Hash implements the PasswordHasher interface.
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify implements the PasswordHasher interface.
+// The password is hashed again with the parameters and the salt of the hash, and the keys are compared in constant time.
+func (h Argon2idHasher) Verify(hash string, password string) (bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrUnknownHash
+	}
+
+	var params Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, ErrUnknownHash
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, ErrPasswordMismatch
+	}
+
+	return params != h || len(key) != argon2KeyLength, nil
+}
+
+// Handles implements the PasswordHasher interface.
+func (h Argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// VerifyPassword checks a plain-text password against its stored hash, whatever algorithm produced it.
+// It reports whether the hash must be replaced with a hash of the configured algorithm and parameters,
+// so the passwords are migrated on login without forcing password resets.
+func VerifyPassword(hash string, password string) (rehash bool, err error) {
+	for _, h := range []PasswordHasher{bcryptHasher, argon2Hasher} {
+		if !h.Handles(hash) {
+			continue
+		}
+
+		outdated, err := h.Verify(hash, password)
+		if err != nil {
+			return false, err
+		}
+
+		return outdated || h != passwordHasher, nil
+	}
+
+	return false, ErrUnknownHash
+}
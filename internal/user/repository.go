@@ -3,19 +3,70 @@ package user
 import (
 	"context"
 	"errors"
+	"strconv"
+	"time"
 
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrUserEmailNotFound is returned by the repository for an e-mail without user.
+var ErrUserEmailNotFound = errors.New("user with the given email not found")
+
+// ErrUserNameNotFound is returned by the repository for a username without user.
+var ErrUserNameNotFound = errors.New("user with the given username not found")
+
 // Interface for user repository
 // This interface defines the methods that the user repository should implement
 type UserRepository interface {
-	GetAllUsers(tx *gorm.DB) ([]User, error)
+	GetAllUsers(tx *gorm.DB, filter UserFilter, sort UserSort, page pagination.Params) ([]User, error)
+	CountUsers(tx *gorm.DB, filter UserFilter) (int64, error)
+	CountEnabledUsers(tx *gorm.DB) (total int64, enabled int64, err error)
+	CountUsersByRole(tx *gorm.DB) (map[string]int64, error)
+	CountUsersByType(tx *gorm.DB) (map[string]int64, error)
+	CountSignupsByMonth(tx *gorm.DB, since time.Time) (map[string]int64, error)
 	GetUserByID(tx *gorm.DB, id int64) (User, error)
 	GetUserByUserName(tx *gorm.DB, username string) (User, error)
 	GetUserByEmail(tx *gorm.DB, email string) (User, error)
+	GetUsersByIdentity(tx *gorm.DB, username string, email string) ([]User, error)
 	CreateUser(ctx context.Context, tx *gorm.DB, user User) (User, error)
 	UpdateUser(ctx context.Context, tx *gorm.DB, user User) (User, error)
+	ReplaceUserRoles(ctx context.Context, tx *gorm.DB, user User, roles []role.Role) error
+	GetDeletedUserByID(tx *gorm.DB, id int64) (User, error)
+	DeleteUser(ctx context.Context, tx *gorm.DB, user User, deletedBy *int64) error
+	RestoreUser(ctx context.Context, tx *gorm.DB, user User, restoredBy *int64) (User, error)
+	SetUserEnabled(ctx context.Context, tx *gorm.DB, user User, enabled bool, changedBy *int64, changedAt time.Time) (User, error)
+	SetUserAvatar(ctx context.Context, tx *gorm.DB, user User, avatarURL string, updatedBy *int64) (User, error)
+	SetUserEmail(ctx context.Context, tx *gorm.DB, user User, email string, updatedBy *int64) (User, error)
+	SetUserExpired(ctx context.Context, tx *gorm.DB, user User, account bool, credentials bool) (User, error)
+	GetExpiringUserIDs(tx *gorm.DB, now time.Time, afterID int64, limit int) ([]int64, error)
+	GetDepartmentMemberIDs(tx *gorm.DB, departmentID string, afterID int64, limit int) ([]int64, error)
+	LockUser(tx *gorm.DB, id int64) error
+	UpgradePasswordHash(ctx context.Context, tx *gorm.DB, id int64, oldHash string, newHash string) (bool, error)
+	ClearUserDepartment(ctx context.Context, tx *gorm.DB, user User) error
+	AddAuditEntry(ctx context.Context, tx *gorm.DB, entry AuditEntry) error
+	GetAuditEntries(tx *gorm.DB, userID int64, page pagination.Params) ([]AuditEntry, error)
+	CountAuditEntries(tx *gorm.DB, userID int64) (int64, error)
+	CreateAPIKey(ctx context.Context, tx *gorm.DB, key APIKey) (APIKey, error)
+	GetAPIKeys(tx *gorm.DB, userID int64) ([]APIKey, error)
+	GetAPIKeyByID(tx *gorm.DB, userID int64, id string) (APIKey, error)
+	GetAPIKeyByHash(tx *gorm.DB, hash string) (APIKey, error)
+	RevokeAPIKey(ctx context.Context, tx *gorm.DB, key APIKey, revokedAt time.Time) (APIKey, error)
+	TouchAPIKey(ctx context.Context, tx *gorm.DB, id string, usedAt time.Time, interval time.Duration) error
+	GetExternalIdentity(tx *gorm.DB, provider string, subject string) (ExternalIdentity, error)
+	CreateExternalIdentity(ctx context.Context, tx *gorm.DB, identity ExternalIdentity) error
+	TouchExternalIdentity(ctx context.Context, tx *gorm.DB, id int64, loginAt time.Time) error
+	CreateRoleRequest(ctx context.Context, tx *gorm.DB, req RoleRequest) (RoleRequest, error)
+	GetRoleRequests(tx *gorm.DB, filter RoleRequestFilter, page pagination.Params) ([]RoleRequest, error)
+	CountRoleRequests(tx *gorm.DB, filter RoleRequestFilter) (int64, error)
+	GetRoleRequestForUpdate(tx *gorm.DB, id int64) (RoleRequest, error)
+	HasPendingRoleRequest(tx *gorm.DB, userID int64, roleName string) (bool, error)
+	DecideRoleRequest(ctx context.Context, tx *gorm.DB, req RoleRequest) (RoleRequest, error)
+	AddLoginAttempt(ctx context.Context, tx *gorm.DB, attempt LoginAttempt) error
+	GetLoginAttempts(tx *gorm.DB, filter LoginAttemptFilter, page pagination.Params) ([]LoginAttempt, error)
+	CountLoginAttempts(tx *gorm.DB, filter LoginAttemptFilter) (int64, error)
 	// DeleteUser(id int64) (bool, error)
 }
 
@@ -29,10 +80,23 @@ func NewUserRepository() UserRepository {
 	return &userRepository{}
 }
 
-// GetAllUsers retrieves all users from the database.
-func (r *userRepository) GetAllUsers(tx *gorm.DB) ([]User, error) {
+// GetAllUsers retrieves the users matching the filter from the database.
+// The filter and the order are applied in SQL, so only the requested page is loaded with its roles.
+// When paginated, one extra user is returned to detect the next page.
+func (r *userRepository) GetAllUsers(tx *gorm.DB, filter UserFilter, sort UserSort, page pagination.Params) ([]User, error) {
+	var after any
+	if page.After != "" {
+		id, err := strconv.ParseInt(page.After, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		after = id
+	}
+
+	query := pagination.Apply(orderScope(filterScope(tx.Preload("Roles"), filter), sort), "users.id", page, after)
+
 	var users []User
-	err := tx.Preload("Roles").Order("id ASC").Find(&users).Error
+	err := query.Find(&users).Error
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +104,126 @@ func (r *userRepository) GetAllUsers(tx *gorm.DB) ([]User, error) {
 	return users, nil
 }
 
+// CountUsers counts the users matching the filter.
+func (r *userRepository) CountUsers(tx *gorm.DB, filter UserFilter) (int64, error) {
+	var count int64
+	err := filterScope(tx.Model(&User{}), filter).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// filterScope applies the listing filter to a query.
+// The role filters join the user_roles association on its primary key, a user holds a role once,
+// so the users are not duplicated. The deleted users are only read when they are asked for.
+func filterScope(tx *gorm.DB, filter UserFilter) *gorm.DB {
+	if filter.Deleted {
+		tx = tx.Unscoped().Where("users.deleted_at IS NOT NULL")
+	}
+	if filter.Role != "" {
+		tx = tx.Joins("JOIN user_roles ur ON ur.user_id = users.id").
+			Joins("JOIN roles r ON r.id = ur.role_id AND r.name = ?", filter.Role)
+	}
+	if filter.RoleID != 0 {
+		tx = tx.Joins("JOIN user_roles uri ON uri.user_id = users.id AND uri.role_id = ?", filter.RoleID)
+	}
+	if filter.Enabled != nil {
+		tx = tx.Where("users.is_enabled = ?", *filter.Enabled)
+	}
+	if filter.UserType != "" {
+		tx = tx.Where("users.user_type = ?", filter.UserType)
+	}
+	if filter.CreatedFrom != nil {
+		tx = tx.Where("users.created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		tx = tx.Where("users.created_at < ?", *filter.CreatedTo)
+	}
+
+	return tx
+}
+
+// orderScope applies the listing order to a query, the ID breaking the ties.
+// The nullable columns sort their NULL values last in both directions.
+func orderScope(tx *gorm.DB, sort UserSort) *gorm.DB {
+	direction := "ASC"
+	if sort.Desc {
+		direction = "DESC"
+	}
+
+	column, ok := UserSortFields[sort.Field]
+	if !ok || column == "id" {
+		return tx.Order("users.id " + direction)
+	}
+
+	return tx.Order("users." + column + " " + direction + " NULLS LAST").Order("users.id " + direction)
+}
+
+// groupCount is a row of a grouped count.
+type groupCount struct {
+	Key   string
+	Count int64
+}
+
+// scanGroupCounts runs a grouped count selecting the key and count columns, and returns the counts by key.
+func scanGroupCounts(query *gorm.DB) (map[string]int64, error) {
+	var rows []groupCount
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Key] = row.Count
+	}
+
+	return counts, nil
+}
+
+// CountEnabledUsers counts the users, and the enabled users among them, in one aggregate query.
+func (r *userRepository) CountEnabledUsers(tx *gorm.DB) (int64, int64, error) {
+	var counts struct {
+		Total   int64
+		Enabled int64
+	}
+	err := tx.Model(&User{}).
+		Select("count(*) AS total, count(*) FILTER (WHERE users.is_enabled) AS enabled").
+		Scan(&counts).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return counts.Total, counts.Enabled, nil
+}
+
+// CountUsersByRole counts the users holding each role, a user is counted in each of its roles.
+// The roles without users are not returned.
+func (r *userRepository) CountUsersByRole(tx *gorm.DB) (map[string]int64, error) {
+	return scanGroupCounts(tx.Model(&User{}).
+		Select("r.name AS key, count(*) AS count").
+		Joins("JOIN user_roles ur ON ur.user_id = users.id").
+		Joins("JOIN roles r ON r.id = ur.role_id").
+		Group("r.name"))
+}
+
+// CountUsersByType counts the users of each user type.
+func (r *userRepository) CountUsersByType(tx *gorm.DB) (map[string]int64, error) {
+	return scanGroupCounts(tx.Model(&User{}).
+		Select("users.user_type AS key, count(*) AS count").
+		Group("users.user_type"))
+}
+
+// CountSignupsByMonth counts the users created since the given time by month of creation (UTC), e.g. "2025-03".
+// The months without signups are not returned.
+func (r *userRepository) CountSignupsByMonth(tx *gorm.DB, since time.Time) (map[string]int64, error) {
+	return scanGroupCounts(tx.Model(&User{}).
+		Select("to_char(users.created_at AT TIME ZONE 'UTC', 'YYYY-MM') AS key, count(*) AS count").
+		Where("users.created_at >= ?", since).
+		Group("key"))
+}
+
 // GetUserByID retrieves a user by its ID from the database.
 func (r *userRepository) GetUserByID(tx *gorm.DB, id int64) (User, error) {
 	// Select the user with the given ID from the database
@@ -47,7 +231,7 @@ func (r *userRepository) GetUserByID(tx *gorm.DB, id int64) (User, error) {
 	err := tx.Preload("Roles").First(&user, "id = ?", id).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return User{}, errors.New("user with the given ID not found")
+		return User{}, ErrUserNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -64,7 +248,7 @@ func (r *userRepository) GetUserByUserName(tx *gorm.DB, username string) (User,
 	err := tx.Preload("Roles").First(&user, "lower(username) = lower(?)", username).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return User{}, errors.New("user with the given username not found")
+		return User{}, ErrUserNameNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -81,7 +265,7 @@ func (r *userRepository) GetUserByEmail(tx *gorm.DB, email string) (User, error)
 	err := tx.Preload("Roles").First(&user, "lower(email) = lower(?)", email).Error
 
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return User{}, errors.New("user with the given email not found")
+		return User{}, ErrUserEmailNotFound
 	}
 
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -110,3 +294,460 @@ func (r *userRepository) UpdateUser(ctx context.Context, tx *gorm.DB, user User)
 
 	return user, nil
 }
+
+// ReplaceUserRoles replaces the roles of a user with the given ones.
+func (r *userRepository) ReplaceUserRoles(ctx context.Context, tx *gorm.DB, user User, roles []role.Role) error {
+	return tx.WithContext(ctx).Model(&user).Association("Roles").Replace(roles)
+}
+
+// GetUsersByIdentity retrieves the users, deleted or not, having the username or the email, case-insensitively.
+// An empty username or email is not looked up.
+func (r *userRepository) GetUsersByIdentity(tx *gorm.DB, username string, email string) ([]User, error) {
+	query := tx.Unscoped().Where("false")
+	if username != "" {
+		query = query.Or("lower(username) = lower(?)", username)
+	}
+	if email != "" {
+		query = query.Or("lower(email) = lower(?)", email)
+	}
+
+	var users []User
+	if err := query.Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetDeletedUserByID retrieves a soft-deleted user by its ID from the database.
+func (r *userRepository) GetDeletedUserByID(tx *gorm.DB, id int64) (User, error) {
+	var user User
+	err := tx.Unscoped().Preload("Roles").First(&user, "id = ? AND deleted_at IS NOT NULL", id).Error
+
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return User{}, ErrUserNotDeleted
+	}
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser soft-deletes a user, recording who deleted it.
+func (r *userRepository) DeleteUser(ctx context.Context, tx *gorm.DB, user User, deletedBy *int64) error {
+	// Update the is_deleted and deleted_by fields in the database
+	// This is done to keep track of who deleted the user
+	isDeleted := true
+	if err := tx.WithContext(ctx).Model(&user).Updates(User{IsDeleted: &isDeleted, DeletedBy: deletedBy}).Error; err != nil {
+		return err
+	}
+
+	// Delete the user from the database
+	return tx.WithContext(ctx).Delete(&user).Error
+}
+
+// RestoreUser restores a soft-deleted user and returns it.
+func (r *userRepository) RestoreUser(ctx context.Context, tx *gorm.DB, user User, restoredBy *int64) (User, error) {
+	err := tx.WithContext(ctx).Unscoped().Model(&user).Updates(map[string]any{
+		"is_deleted": false,
+		"deleted_by": nil,
+		"deleted_at": nil,
+		"updated_by": restoredBy,
+	}).Error
+	if err != nil {
+		return User{}, err
+	}
+
+	return r.GetUserByID(tx, user.ID)
+}
+
+// SetUserEnabled enables or disables a user, recording who did it and when, and returns it.
+func (r *userRepository) SetUserEnabled(ctx context.Context, tx *gorm.DB, user User, enabled bool, changedBy *int64, changedAt time.Time) (User, error) {
+	err := tx.WithContext(ctx).Model(&user).Updates(map[string]any{
+		"is_enabled":         enabled,
+		"enabled_changed_by": changedBy,
+		"enabled_changed_at": changedAt,
+		"updated_by":         changedBy,
+	}).Error
+	if err != nil {
+		return User{}, err
+	}
+
+	return r.GetUserByID(tx, user.ID)
+}
+
+// SetUserAvatar sets the avatar URL of a user, recording who changed it, and returns it.
+func (r *userRepository) SetUserAvatar(ctx context.Context, tx *gorm.DB, user User, avatarURL string, updatedBy *int64) (User, error) {
+	err := tx.WithContext(ctx).Model(&user).Updates(map[string]any{
+		"avatar_url": avatarURL,
+		"updated_by": updatedBy,
+	}).Error
+	if err != nil {
+		return User{}, err
+	}
+
+	return r.GetUserByID(tx, user.ID)
+}
+
+// SetUserEmail sets the e-mail of a user, recording who changed it, and returns it.
+func (r *userRepository) SetUserEmail(ctx context.Context, tx *gorm.DB, user User, email string, updatedBy *int64) (User, error) {
+	err := tx.WithContext(ctx).Model(&user).Updates(map[string]any{
+		"email":      email,
+		"updated_by": updatedBy,
+	}).Error
+	if err != nil {
+		return User{}, err
+	}
+
+	return r.GetUserByID(tx, user.ID)
+}
+
+// SetUserExpired marks the account and/or the credentials of a user as expired, and returns it.
+func (r *userRepository) SetUserExpired(ctx context.Context, tx *gorm.DB, user User, account bool, credentials bool) (User, error) {
+	updates := map[string]any{}
+	if account {
+		updates["is_account_non_expired"] = false
+	}
+	if credentials {
+		updates["is_credentials_non_expired"] = false
+	}
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	if err := tx.WithContext(ctx).Model(&user).Updates(updates).Error; err != nil {
+		return User{}, err
+	}
+
+	return r.GetUserByID(tx, user.ID)
+}
+
+// GetExpiringUserIDs retrieves the IDs after afterID of the users that are not deleted and whose account or
+// credentials expiration date has passed while they are not marked as expired yet, in ascending order.
+func (r *userRepository) GetExpiringUserIDs(tx *gorm.DB, now time.Time, afterID int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := tx.Model(&User{}).
+		Where("is_deleted = ? AND id > ?", false, afterID).
+		Where("(is_account_non_expired AND account_expiration_date <= ?) OR (is_credentials_non_expired AND credentials_expiration_date <= ?)", now, now).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+
+	return ids, err
+}
+
+// GetDepartmentMemberIDs retrieves the IDs of the users assigned to a department, the deleted users excluded,
+// from the ID after afterID on, ordered by ID.
+func (r *userRepository) GetDepartmentMemberIDs(tx *gorm.DB, departmentID string, afterID int64, limit int) ([]int64, error) {
+	var ids []int64
+	err := tx.Model(&User{}).
+		Where("lower(department_id) = lower(?) AND id > ?", departmentID, afterID).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+
+	return ids, err
+}
+
+// UpgradePasswordHash replaces the password hash of a user with a hash of the same password,
+// e.g. produced with a stronger algorithm. The hash is only replaced while it is still the old one,
+// so a password changed in the meantime is kept, and the user is not marked as updated.
+// It reports whether the hash was replaced.
+func (r *userRepository) UpgradePasswordHash(ctx context.Context, tx *gorm.DB, id int64, oldHash string, newHash string) (bool, error) {
+	result := tx.WithContext(ctx).Model(&User{}).Where("id = ? AND password = ?", id, oldHash).UpdateColumn("password", newHash)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// ClearUserDepartment removes the department assignment of a user, deleted or not.
+func (r *userRepository) ClearUserDepartment(ctx context.Context, tx *gorm.DB, user User) error {
+	return tx.WithContext(ctx).Unscoped().Model(&user).UpdateColumn("department_id", nil).Error
+}
+
+// LockUser locks a user, deleted or not, until the end of the transaction.
+// The user is read again after the lock, so the transaction sees the changes committed in the meantime.
+func (r *userRepository) LockUser(tx *gorm.DB, id int64) error {
+	var ids []int64
+	return tx.Unscoped().Model(&User{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Pluck("id", &ids).Error
+}
+
+// AddAuditEntry inserts an entry into the audit trail of a user.
+func (r *userRepository) AddAuditEntry(ctx context.Context, tx *gorm.DB, entry AuditEntry) error {
+	return tx.WithContext(ctx).Create(&entry).Error
+}
+
+// GetAuditEntries retrieves the audit trail of a user, deleted or not, the oldest entry first.
+// When paginated, one extra entry is returned to detect the next page.
+func (r *userRepository) GetAuditEntries(tx *gorm.DB, userID int64, page pagination.Params) ([]AuditEntry, error) {
+	var after any
+	if page.After != "" {
+		id, err := strconv.ParseInt(page.After, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		after = id
+	}
+
+	query := pagination.Apply(tx.Where("user_id = ?", userID).Order("id ASC"), "id", page, after)
+
+	var entries []AuditEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// CountAuditEntries counts the entries of the audit trail of a user.
+func (r *userRepository) CountAuditEntries(tx *gorm.DB, userID int64) (int64, error) {
+	var count int64
+	err := tx.Model(&AuditEntry{}).Where("user_id = ?", userID).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CreateAPIKey inserts an API key of a user.
+func (r *userRepository) CreateAPIKey(ctx context.Context, tx *gorm.DB, key APIKey) (APIKey, error) {
+	if err := tx.WithContext(ctx).Create(&key).Error; err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// GetAPIKeys retrieves the API keys of a user, revoked and expired included, the newest first.
+func (r *userRepository) GetAPIKeys(tx *gorm.DB, userID int64) ([]APIKey, error) {
+	var keys []APIKey
+	if err := tx.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByID retrieves an API key of a user by its ID.
+func (r *userRepository) GetAPIKeyByID(tx *gorm.DB, userID int64, id string) (APIKey, error) {
+	var key APIKey
+	err := tx.First(&key, "id = ? AND user_id = ?", id, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the SHA-256 digest of the key.
+func (r *userRepository) GetAPIKeyByHash(tx *gorm.DB, hash string) (APIKey, error) {
+	var key APIKey
+	err := tx.First(&key, "key_hash = ?", hash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey marks an API key as revoked at the given time.
+func (r *userRepository) RevokeAPIKey(ctx context.Context, tx *gorm.DB, key APIKey, revokedAt time.Time) (APIKey, error) {
+	if err := tx.WithContext(ctx).Model(&key).UpdateColumn("revoked_at", revokedAt).Error; err != nil {
+		return APIKey{}, err
+	}
+	key.RevokedAt = &revokedAt
+
+	return key, nil
+}
+
+// TouchAPIKey records the use of an API key.
+// The time is only written once per interval, so the authenticated requests do not all write the key.
+func (r *userRepository) TouchAPIKey(ctx context.Context, tx *gorm.DB, id string, usedAt time.Time, interval time.Duration) error {
+	return tx.WithContext(ctx).Model(&APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, usedAt.Add(-interval)).
+		UpdateColumn("last_used_at", usedAt).Error
+}
+
+// GetExternalIdentity retrieves the external identity with the given provider and subject.
+func (r *userRepository) GetExternalIdentity(tx *gorm.DB, provider string, subject string) (ExternalIdentity, error) {
+	var identity ExternalIdentity
+	err := tx.First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ExternalIdentity{}, ErrIdentityNotFound
+	}
+	if err != nil {
+		return ExternalIdentity{}, err
+	}
+
+	return identity, nil
+}
+
+// CreateExternalIdentity inserts the link of an external identity to a user.
+func (r *userRepository) CreateExternalIdentity(ctx context.Context, tx *gorm.DB, identity ExternalIdentity) error {
+	return tx.WithContext(ctx).Create(&identity).Error
+}
+
+// TouchExternalIdentity records the last login with an external identity.
+func (r *userRepository) TouchExternalIdentity(ctx context.Context, tx *gorm.DB, id int64, loginAt time.Time) error {
+	return tx.WithContext(ctx).Model(&ExternalIdentity{}).Where("id = ?", id).UpdateColumn("last_login_at", loginAt).Error
+}
+
+// CreateRoleRequest inserts a new role request into the database.
+func (r *userRepository) CreateRoleRequest(ctx context.Context, tx *gorm.DB, req RoleRequest) (RoleRequest, error) {
+	if err := tx.WithContext(ctx).Create(&req).Error; err != nil {
+		return RoleRequest{}, err
+	}
+
+	return req, nil
+}
+
+// GetRoleRequests retrieves the role requests matching the filter, the oldest first.
+// When paginated, one extra request is returned to detect the next page.
+func (r *userRepository) GetRoleRequests(tx *gorm.DB, filter RoleRequestFilter, page pagination.Params) ([]RoleRequest, error) {
+	var after any
+	if page.After != "" {
+		id, err := strconv.ParseInt(page.After, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		after = id
+	}
+
+	query := pagination.Apply(roleRequestScope(tx, filter).Order("id ASC"), "id", page, after)
+
+	var requests []RoleRequest
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// CountRoleRequests counts the role requests matching the filter.
+func (r *userRepository) CountRoleRequests(tx *gorm.DB, filter RoleRequestFilter) (int64, error) {
+	var count int64
+	if err := roleRequestScope(tx.Model(&RoleRequest{}), filter).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// roleRequestScope applies the role request filter to a query.
+func roleRequestScope(tx *gorm.DB, filter RoleRequestFilter) *gorm.DB {
+	if filter.UserID != 0 {
+		tx = tx.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		tx = tx.Where("status = ?", filter.Status)
+	}
+
+	return tx
+}
+
+// GetRoleRequestForUpdate retrieves a role request by its ID and locks it until the end of the transaction,
+// so it is decided once.
+func (r *userRepository) GetRoleRequestForUpdate(tx *gorm.DB, id int64) (RoleRequest, error) {
+	var req RoleRequest
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&req, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return RoleRequest{}, ErrRoleRequestNotFound
+	}
+	if err != nil {
+		return RoleRequest{}, err
+	}
+
+	return req, nil
+}
+
+// HasPendingRoleRequest checks if the user has a pending request for the role.
+func (r *userRepository) HasPendingRoleRequest(tx *gorm.DB, userID int64, roleName string) (bool, error) {
+	var count int64
+	err := tx.Model(&RoleRequest{}).
+		Where("user_id = ? AND role_name = ? AND status = ?", userID, roleName, RoleRequestPending).
+		Limit(1).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// DecideRoleRequest records the decision on a role request.
+func (r *userRepository) DecideRoleRequest(ctx context.Context, tx *gorm.DB, req RoleRequest) (RoleRequest, error) {
+	err := tx.WithContext(ctx).Model(&req).Select("status", "decided_by", "decided_at", "decision_note").Updates(&req).Error
+	if err != nil {
+		return RoleRequest{}, err
+	}
+
+	return req, nil
+}
+
+// AddLoginAttempt inserts a login attempt into the login audit.
+func (r *userRepository) AddLoginAttempt(ctx context.Context, tx *gorm.DB, attempt LoginAttempt) error {
+	return tx.WithContext(ctx).Create(&attempt).Error
+}
+
+// GetLoginAttempts retrieves the login attempts matching the filter, the oldest first.
+// When paginated, one extra attempt is returned to detect the next page.
+func (r *userRepository) GetLoginAttempts(tx *gorm.DB, filter LoginAttemptFilter, page pagination.Params) ([]LoginAttempt, error) {
+	var after any
+	if page.After != "" {
+		id, err := strconv.ParseInt(page.After, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		after = id
+	}
+
+	query := pagination.Apply(loginAttemptScope(tx, filter).Order("id ASC"), "id", page, after)
+
+	var attempts []LoginAttempt
+	if err := query.Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// CountLoginAttempts counts the login attempts matching the filter.
+func (r *userRepository) CountLoginAttempts(tx *gorm.DB, filter LoginAttemptFilter) (int64, error) {
+	var count int64
+	if err := loginAttemptScope(tx.Model(&LoginAttempt{}), filter).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// loginAttemptScope applies the login attempt filter to a query.
+func loginAttemptScope(tx *gorm.DB, filter LoginAttemptFilter) *gorm.DB {
+	if filter.UserID != 0 {
+		tx = tx.Where("user_id = ?", filter.UserID)
+	}
+	if filter.UserName != "" {
+		tx = tx.Where("username = ?", filter.UserName)
+	}
+	if filter.IPAddress != "" {
+		tx = tx.Where("ip_address = ?", filter.IPAddress)
+	}
+	if filter.Success != nil {
+		tx = tx.Where("success = ?", *filter.Success)
+	}
+	if filter.Since != nil {
+		tx = tx.Where("created_at >= ?", *filter.Since)
+	}
+
+	return tx
+}
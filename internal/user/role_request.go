@@ -0,0 +1,327 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/revocation"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// Statuses of the role requests
+const (
+	RoleRequestPending  = "PENDING"
+	RoleRequestApproved = "APPROVED"
+	RoleRequestDenied   = "DENIED"
+)
+
+// RoleRequestStatuses lists the statuses of the role requests, in the order of their lifecycle.
+var RoleRequestStatuses = []string{RoleRequestPending, RoleRequestApproved, RoleRequestDenied}
+
+var (
+	ErrRoleRequestNotFound = apperror.New("RoleRequestNotFound", http.StatusNotFound, "role request with the given ID not found")
+	ErrRoleAlreadyHeld     = apperror.New("RoleAlreadyHeld", http.StatusConflict, "the user already has this role")
+	ErrRoleRequestPending  = apperror.New("RoleRequestPending", http.StatusConflict, "a request for this role is already pending")
+	ErrRoleRequestDecided  = apperror.New("RoleRequestDecided", http.StatusConflict, "the role request is already approved or denied")
+	ErrRoleRequestSelf     = apperror.New("RoleRequestSelfDecision", http.StatusForbidden, "admins cannot decide their own role requests")
+)
+
+// RoleRequest represents a request of a user for an additional role, approved or denied by an admin.
+// The role is granted when the request is approved, it takes effect with the next access token of the user.
+// A user has at most one pending request per role.
+type RoleRequest struct {
+	ID            int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID        int64      `gorm:"column:user_id;not null;index" json:"userId"`
+	RoleName      string     `gorm:"column:role_name;type:varchar(20);not null" json:"roleName"`
+	Justification string     `gorm:"column:justification;type:varchar(500);not null" json:"justification"`
+	Status        string     `gorm:"column:status;type:varchar(10);not null;default:'PENDING';index;check:status IN ('PENDING','APPROVED','DENIED')" json:"status"`
+	DecidedBy     *int64     `gorm:"column:decided_by" json:"decidedBy,omitempty"`
+	DecidedAt     *time.Time `gorm:"column:decided_at;type:timestamptz" json:"decidedAt,omitempty"`
+	DecisionNote  *string    `gorm:"column:decision_note;type:varchar(500)" json:"decisionNote,omitempty"`
+	CreatedAt     *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+}
+
+// TableName returns the table of the role requests.
+func (RoleRequest) TableName() string {
+	return "user_role_requests"
+}
+
+// IsPending reports whether the request is waiting for the decision of an admin.
+func (r *RoleRequest) IsPending() bool {
+	return r.Status == RoleRequestPending
+}
+
+// RoleRequestFilter holds the filters of the role request listing, the zero values do not filter.
+type RoleRequestFilter struct {
+	UserID int64
+	Status string
+}
+
+// RoleRequestCreate is the body of a role request (POST /users/me/role-requests).
+// The justification tells the admins why the role is needed.
+type RoleRequestCreate struct {
+	Role          string `json:"role" validate:"required,max=20,rolename"`
+	Justification string `json:"justification" validate:"required,min=10,max=500"`
+}
+
+// Validate validates the RoleRequestCreate struct using the validator package.
+func (r *RoleRequestCreate) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RoleRequestDecision is the body of the approval or the denial of a role request, the note is shown to the user.
+type RoleRequestDecision struct {
+	Note string `json:"note,omitempty" validate:"max=500"`
+}
+
+// Validate validates the RoleRequestDecision struct using the validator package.
+func (d *RoleRequestDecision) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(d); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestRole records the request of a user for an additional role, it waits for the decision of an admin.
+// The role must exist and not be held by the user, and the user has at most one pending request per role.
+func (s *userService) RequestRole(ctx context.Context, userID int64, req RoleRequestCreate) (RoleRequest, error) {
+	// Validate the request struct using the validator
+	if err := req.Validate(); err != nil {
+		return RoleRequest{}, err
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return RoleRequest{}, errors.New("database connection is nil")
+	}
+
+	var created RoleRequest
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so two identical requests sent at once do not both pass the pending check
+		if err := s.repo.LockUser(tx, userID); err != nil {
+			return err
+		}
+
+		existingUser, err := s.repo.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Check if the role is neither held nor requested by the user yet, and exists
+		if hasRole(existingUser, req.Role) {
+			return ErrRoleAlreadyHeld
+		}
+		pending, err := s.repo.HasPendingRoleRequest(tx, userID, req.Role)
+		if err != nil {
+			return err
+		}
+		if pending {
+			return ErrRoleRequestPending
+		}
+		if err := resolveRoles(ctx, []role.Role{{Name: req.Role}}); err != nil {
+			return err
+		}
+
+		created, err = s.repo.CreateRoleRequest(ctx, tx, RoleRequest{
+			UserID:        userID,
+			RoleName:      req.Role,
+			Justification: strings.TrimSpace(req.Justification),
+			Status:        RoleRequestPending,
+		})
+		return err
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to request role %s for user %d: %v", req.Role, userID, err))
+		return RoleRequest{}, err
+	}
+
+	return created, nil
+}
+
+// GetRoleRequests retrieves the role requests matching the filter, the oldest first.
+// The page metadata is nil when the listing is not paginated.
+func (s *userService) GetRoleRequests(ctx context.Context, filter RoleRequestFilter, page pagination.Params) ([]RoleRequest, *pagination.Meta, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
+	}
+
+	requests, err := s.repo.GetRoleRequests(db, filter, page)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get role requests: %v", err))
+		return nil, nil, err
+	}
+
+	// Build the page metadata
+	requests, meta, err := pagination.Paginate(requests, page, func(r RoleRequest) string { return strconv.FormatInt(r.ID, 10) })
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta != nil && page.IsOffset() {
+		total, err := s.repo.CountRoleRequests(db, filter)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to count role requests: %v", err))
+			return nil, nil, err
+		}
+		meta.TotalItems = &total
+	}
+
+	return requests, meta, nil
+}
+
+// ApproveRoleRequest approves a pending role request and assigns the role to the user, like an update of its
+// roles: the change is audited and publishes a user.updated event. The access tokens of the user issued until
+// now are revoked, so the user refreshes its session and the next access token carries the new role.
+func (s *userService) ApproveRoleRequest(ctx context.Context, id int64, decision RoleRequestDecision) (RoleRequest, error) {
+	var approvedUser User
+	decided, err := s.decideRoleRequest(ctx, id, RoleRequestApproved, decision, func(tx *gorm.DB, req RoleRequest) error {
+		// Lock the user, so the role is not lost to a concurrent update of its roles
+		if err := s.repo.LockUser(tx, req.UserID); err != nil {
+			return err
+		}
+
+		existingUser, err := s.repo.GetUserByID(tx, req.UserID)
+		if err != nil {
+			return err
+		}
+
+		// The role may have been assigned since the request, the approval then changes nothing
+		approvedUser = existingUser
+		if hasRole(existingUser, req.RoleName) {
+			return nil
+		}
+
+		roles := append(append([]role.Role(nil), existingUser.Roles...), role.Role{Name: req.RoleName})
+		if err := resolveRoles(ctx, roles); err != nil {
+			return err
+		}
+		if err := s.repo.ReplaceUserRoles(ctx, tx, existingUser, roles); err != nil {
+			return RoleConstraintError(err, roles)
+		}
+		approvedUser.Roles = roles
+
+		// Record the new role in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditUpdated, existingUser, approvedUser); err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserUpdated, approvedUser)
+	})
+	if err != nil {
+		return RoleRequest{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Reject the current access tokens of the user, the refresh reloads its roles from the database.
+	// The role is granted either way: a failure only delays it until the current access token expires.
+	if redisClient := dbcontext.GetRedisClient(ctx); redisClient != nil {
+		if err := revocation.RevokeUser(ctx, redisClient, approvedUser.ID, approvedUser.UserName, time.Now()); err != nil {
+			logger.Warn(fmt.Sprintf("failed to revoke the tokens of user %d after its role request %d: %v", approvedUser.ID, id, err))
+		}
+	}
+
+	return decided, nil
+}
+
+// DenyRoleRequest denies a pending role request, the user keeps its roles and may request the role again.
+func (s *userService) DenyRoleRequest(ctx context.Context, id int64, decision RoleRequestDecision) (RoleRequest, error) {
+	return s.decideRoleRequest(ctx, id, RoleRequestDenied, decision, nil)
+}
+
+// decideRoleRequest records the decision of the admin of the request context on a pending role request.
+// The request is locked, so it is decided once, and apply runs in the same transaction before the decision is saved.
+func (s *userService) decideRoleRequest(ctx context.Context, id int64, status string, decision RoleRequestDecision, apply func(tx *gorm.DB, req RoleRequest) error) (RoleRequest, error) {
+	// Validate the request struct using the validator
+	if err := decision.Validate(); err != nil {
+		return RoleRequest{}, err
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return RoleRequest{}, errors.New("database connection is nil")
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return RoleRequest{}, errors.New("missing user context")
+	}
+
+	var decided RoleRequest
+	err := db.Transaction(func(tx *gorm.DB) error {
+		req, err := s.repo.GetRoleRequestForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+		if !req.IsPending() {
+			return ErrRoleRequestDecided
+		}
+		if req.UserID == meta.UserID {
+			return ErrRoleRequestSelf
+		}
+
+		if apply != nil {
+			if err := apply(tx, req); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		req.Status = status
+		req.DecidedBy = &meta.UserID
+		req.DecidedAt = &now
+		if note := strings.TrimSpace(decision.Note); note != "" {
+			req.DecisionNote = &note
+		}
+		decided, err = s.repo.DecideRoleRequest(ctx, tx, req)
+		return err
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to decide role request %d: %v", id, err))
+		return RoleRequest{}, err
+	}
+
+	return decided, nil
+}
+
+// hasRole reports whether the user has the role, compared case-insensitively.
+func hasRole(u User, name string) bool {
+	for _, r := range u.Roles {
+		if strings.EqualFold(r.Name, name) {
+			return true
+		}
+	}
+	return false
+}
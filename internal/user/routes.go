@@ -0,0 +1,114 @@
+package user
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the user management routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Routes for user management
+	// These routes handle CRUD operations for users
+	userGroup := rg.Group("/users")
+	{
+		// Rate limiter middleware for the /users group, accessible only by admin users except for the export, the sessions, the avatar, the e-mail change and the role requests.
+		// - Allows a burst of up to 10 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		// - Limits each admin IP to prevent spamming the user management endpoints.
+		// - Limiter TTL is 15 minutes to clean up inactive IP limiters.
+		userGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 15*time.Minute))
+
+		// Initialize the user repository and service
+		// This is where the actual implementation of the repository and service would be used
+		repo := NewUserRepository()
+		service := NewUserService(repo)
+
+		// Initialize the user handler with the service
+		// This handler handles the HTTP requests and responses for user-related operations
+		handler := NewUserHandler(service)
+
+		// The changes and the deletions of the users, which can change their roles, require a recent authentication
+		recentAuth := authorization.RequireRecentAuth(authorization.RecentAuthMaxAge())
+
+		// Define the routes for user management
+		// These routes handle CRUD operations for users
+		userGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetAllUsers)
+		userGroup.GET("/export", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.ExportUsers)
+		userGroup.GET("/stats", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetUserStats)
+		userGroup.GET("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetUserByID)
+		userGroup.POST("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("user"), handler.CreateUser)
+		userGroup.PUT("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), recentAuth, deps.Validate("user"), handler.UpdateUser)
+		userGroup.PATCH("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), recentAuth, deps.Validate("user-patch"), handler.PatchUser)
+		userGroup.DELETE("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), recentAuth, handler.DeleteUser)
+		userGroup.POST("/:id/restore", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.RestoreUser)
+		userGroup.POST("/:id/enable", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.EnableUser)
+		userGroup.POST("/:id/disable", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.DisableUser)
+		userGroup.POST("/:id/revoke-sessions", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.RevokeUserSessions)
+		userGroup.POST("/transfer", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("transfer"), handler.TransferMembers)
+		userGroup.GET("/:id/audit", authorization.RequirePermission(permission.AuditRead), handler.GetUserAudit)
+
+		// The login audit, the attempts of a user and the ones of all the usernames, known or not
+		userGroup.GET("/:id/logins", authorization.RequirePermission(permission.AuditRead), handler.GetUserLogins)
+		userGroup.GET("/logins", authorization.RequirePermission(permission.AuditRead), handler.GetLoginAttempts)
+
+		// The sensitive actions require a fresh login from the remembered sessions
+		freshLogin := authorization.RequireFreshLogin(authorization.FreshLoginMaxAge())
+
+		// The API keys of the service accounts, which authenticate with them instead of a password login
+		userGroup.POST("/:id/api-keys", authorization.RoleBasedAccessControl("ROLE_ADMIN"), freshLogin, deps.Validate("api-key"), handler.IssueAPIKey)
+		userGroup.GET("/:id/api-keys", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetAPIKeys)
+		userGroup.DELETE("/:id/api-keys/:keyId", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.RevokeAPIKey)
+
+		// The sessions of the authenticated user, open to every role
+		userGroup.GET("/me/sessions", handler.GetMySessions)
+		userGroup.DELETE("/me/sessions/:id", handler.RevokeMySession)
+
+		// The access token of the request, revoked on its own (e.g. an impersonation token), open to every role
+		userGroup.DELETE("/me/token", handler.RevokeMyToken)
+
+		// The avatar of the authenticated user, open to every role
+		userGroup.PUT("/me/avatar", handler.UpdateMyAvatar)
+
+		// The e-mail change of the authenticated user, applied once confirmed from the new address, open to every role
+		userGroup.POST("/me/email", freshLogin, deps.Validate("email-change"), handler.RequestMyEmailChange)
+		userGroup.POST("/me/email/confirm", deps.Validate("email-confirmation"), handler.ConfirmMyEmailChange)
+
+		// The role requests of the authenticated user, granted once approved by an admin, open to every role
+		userGroup.POST("/me/role-requests", deps.Validate("role-request"), handler.RequestMyRole)
+		userGroup.GET("/me/role-requests", handler.GetMyRoleRequests)
+	}
+
+	// Routes for the users of the roles, listed like the users
+	roleGroup := rg.Group("/roles")
+	{
+		// Rate limiter middleware for the /roles group, accessible only by admin users.
+		// - Allows a burst of up to 10 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		roleGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 15*time.Minute))
+
+		handler := NewUserHandler(NewUserService(NewUserRepository()))
+		roleGroup.GET("/:id/users", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetRoleUsers)
+	}
+
+	// Routes for the decisions on the role requests of the users
+	roleRequestGroup := rg.Group("/role-requests")
+	{
+		// Rate limiter middleware for the /role-requests group, accessible only by admin users.
+		// - Allows a burst of up to 10 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		roleRequestGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 15*time.Minute))
+
+		handler := NewUserHandler(NewUserService(NewUserRepository()))
+		roleRequestGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetRoleRequests)
+		// An approval grants a role, it requires a recent authentication
+		roleRequestGroup.POST("/:id/approve", authorization.RoleBasedAccessControl("ROLE_ADMIN"),
+			authorization.RequireRecentAuth(authorization.RecentAuthMaxAge()), handler.ApproveRoleRequest)
+		roleRequestGroup.POST("/:id/deny", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.DenyRoleRequest)
+	}
+}
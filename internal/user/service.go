@@ -2,59 +2,395 @@ package user
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
 	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/authmetrics"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dberror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/revocation"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/storage"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// defaultAvatarMaxBytes is the maximum size of the avatars when AVATAR_MAX_BYTES is not set.
+const defaultAvatarMaxBytes = 2 << 20 // 2 MB
+
+// AvatarTypes maps the accepted image types of the avatars to the extension of their stored file.
+// The type is detected from the content of the file, not from the name or the header sent by the client.
+var AvatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var (
+	BcryptCost            string
+	AvatarMaxBytes        string
+	PasswordHashAlgorithm string
+	Argon2Memory          string
+	Argon2Iterations      string
+	Argon2Parallelism     string
+	APIKeyTTLDays         string
+	APIKeyMaxTTLDays      string
+	EmailChangeURL        string
+	EmailChangeTTLMinutes string
+
+	UserExpirationIntervalMinutes string
+
+	avatarMaxBytes     = int64(defaultAvatarMaxBytes)
+	apiKeyTTL          = defaultAPIKeyTTLDays * 24 * time.Hour
+	apiKeyMaxTTL       = defaultAPIKeyMaxTTLDays * 24 * time.Hour
+	emailChangeTTL     = defaultEmailChangeTTL
+	expirationInterval = defaultExpirationInterval
+
+	bcryptHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+	argon2Hasher = Argon2idHasher{Memory: defaultArgon2Memory, Iterations: defaultArgon2Iterations, Parallelism: defaultArgon2Parallelism}
+
+	// passwordHasher produces the new password hashes, the other hasher only checks the existing ones
+	passwordHasher PasswordHasher = bcryptHasher
+)
+
+// LoadEnv loads environment variables
+// BCRYPT_COST sets the cost of the password hashes, between bcrypt.MinCost and bcrypt.MaxCost.
+// PASSWORD_HASH_ALGORITHM selects the algorithm of the new password hashes (BCRYPT or ARGON2ID),
+// ARGON2_MEMORY_KB, ARGON2_ITERATIONS and ARGON2_PARALLELISM set the parameters of the argon2id hashes.
+// AVATAR_MAX_BYTES sets the maximum size of the uploaded avatars.
+// API_KEY_TTL_DAYS sets the default validity of the API keys of the service accounts, API_KEY_MAX_TTL_DAYS the longest one.
+// EMAIL_CHANGE_URL is the confirmation link of the e-mail changes and EMAIL_CHANGE_TTL_MINUTES the validity of their tokens.
+// The accounts and credentials are expired every USER_EXPIRATION_INTERVAL_MINUTES, 0 disables the job.
+func LoadEnv() {
+	BcryptCost = os.Getenv("BCRYPT_COST")
+	AvatarMaxBytes = os.Getenv("AVATAR_MAX_BYTES")
+	PasswordHashAlgorithm = os.Getenv("PASSWORD_HASH_ALGORITHM")
+	Argon2Memory = os.Getenv("ARGON2_MEMORY_KB")
+	Argon2Iterations = os.Getenv("ARGON2_ITERATIONS")
+	Argon2Parallelism = os.Getenv("ARGON2_PARALLELISM")
+	APIKeyTTLDays = os.Getenv("API_KEY_TTL_DAYS")
+	APIKeyMaxTTLDays = os.Getenv("API_KEY_MAX_TTL_DAYS")
+	EmailChangeURL = os.Getenv("EMAIL_CHANGE_URL")
+	EmailChangeTTLMinutes = os.Getenv("EMAIL_CHANGE_TTL_MINUTES")
+	UserExpirationIntervalMinutes = os.Getenv("USER_EXPIRATION_INTERVAL_MINUTES")
+
+	avatarMaxBytes = defaultAvatarMaxBytes
+	if n, err := strconv.ParseInt(AvatarMaxBytes, 10, 64); err == nil && n > 0 {
+		avatarMaxBytes = n
+	}
+
+	apiKeyMaxTTL = defaultAPIKeyMaxTTLDays * 24 * time.Hour
+	if n, err := strconv.Atoi(APIKeyMaxTTLDays); err == nil && n > 0 {
+		apiKeyMaxTTL = time.Duration(n) * 24 * time.Hour
+	}
+	apiKeyTTL = min(defaultAPIKeyTTLDays*24*time.Hour, apiKeyMaxTTL)
+	if n, err := strconv.Atoi(APIKeyTTLDays); err == nil && n > 0 {
+		apiKeyTTL = min(time.Duration(n)*24*time.Hour, apiKeyMaxTTL)
+	}
+
+	emailChangeTTL = defaultEmailChangeTTL
+	if n, err := strconv.Atoi(EmailChangeTTLMinutes); err == nil && n > 0 {
+		emailChangeTTL = time.Duration(n) * time.Minute
+	}
+
+	expirationInterval = defaultExpirationInterval
+	if n, err := strconv.Atoi(UserExpirationIntervalMinutes); err == nil && n >= 0 {
+		expirationInterval = time.Duration(n) * time.Minute
+	}
+
+	bcryptHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+	if BcryptCost != "" {
+		cost, err := strconv.Atoi(BcryptCost)
+		if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			logger.Warn(fmt.Sprintf("BCRYPT_COST must be between %d and %d, using %d", bcrypt.MinCost, bcrypt.MaxCost, bcrypt.DefaultCost))
+		} else {
+			bcryptHasher.Cost = cost
+		}
+	}
+
+	argon2Hasher = Argon2idHasher{Memory: defaultArgon2Memory, Iterations: defaultArgon2Iterations, Parallelism: defaultArgon2Parallelism}
+	if n, err := strconv.ParseUint(Argon2Parallelism, 10, 8); err == nil && n > 0 {
+		argon2Hasher.Parallelism = uint8(n)
+	}
+	if n, err := strconv.ParseUint(Argon2Iterations, 10, 32); err == nil && n > 0 {
+		argon2Hasher.Iterations = uint32(n)
+	}
+	if n, err := strconv.ParseUint(Argon2Memory, 10, 32); err == nil && n > 0 {
+		argon2Hasher.Memory = uint32(n)
+	}
+	// argon2 needs at least 8 KiB per lane
+	if argon2Hasher.Memory < 8*uint32(argon2Hasher.Parallelism) {
+		logger.Warn(fmt.Sprintf("ARGON2_MEMORY_KB must be at least 8 times ARGON2_PARALLELISM, using %d", defaultArgon2Memory))
+		argon2Hasher.Memory = max(defaultArgon2Memory, 8*uint32(argon2Hasher.Parallelism))
+	}
+
+	switch strings.ToUpper(PasswordHashAlgorithm) {
+	case "", HashBcrypt:
+		passwordHasher = bcryptHasher
+	case HashArgon2id:
+		passwordHasher = argon2Hasher
+	default:
+		logger.Warn(fmt.Sprintf("unknown PASSWORD_HASH_ALGORITHM %s, using %s", PasswordHashAlgorithm, HashBcrypt))
+		passwordHasher = bcryptHasher
+	}
+}
+
+// HashPassword hashes a plain-text password with the configured algorithm and parameters.
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
 // Interface for user service
 // This interface defines the methods that the user service should implement
 type UserService interface {
-	GetAllUsers(ctx context.Context) ([]User, error)
+	GetAllUsers(ctx context.Context, filter UserFilter, sort UserSort, page pagination.Params) ([]User, *pagination.Meta, error)
+	GetRoleUsers(ctx context.Context, roleID uint, filter UserFilter, sort UserSort, page pagination.Params) ([]User, *pagination.Meta, error)
+	GetUserStats(ctx context.Context, months int) (UserStats, error)
 	GetUserByID(ctx context.Context, id int64) (User, error)
 	GetUserByUserName(ctx context.Context, username string) (User, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	CreateUser(ctx context.Context, user User) (User, error)
 	UpdateUser(ctx context.Context, id int64, user User) (User, error)
+	PatchUser(ctx context.Context, id int64, patch UserPatch) (User, error)
 	UpdateLastLogin(ctx context.Context, id int64, lastLogin time.Time) (bool, error)
-	// DeleteUser(id int64) (bool, error)
+	ValidatePassword(ctx context.Context, id int64, password string) error
+	ResetPassword(ctx context.Context, id int64, password string) error
+	DeleteUser(ctx context.Context, id int64) error
+	RestoreUser(ctx context.Context, id int64) (User, error)
+	EnableUser(ctx context.Context, id int64) (User, error)
+	DisableUser(ctx context.Context, id int64) (User, error)
+	GetSessions(ctx context.Context, userID int64) ([]refreshtoken.Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeSessions(ctx context.Context, id int64) error
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	UpdateAvatar(ctx context.Context, userID int64, contentType string, data []byte) (User, error)
+	GetUserAudit(ctx context.Context, id int64, page pagination.Params) ([]AuditEntry, *pagination.Meta, error)
+	RecordMaskedExport(ctx context.Context, e export.MaskedExport) error
+	IssueAPIKey(ctx context.Context, userID int64, req APIKeyRequest) (IssuedAPIKey, error)
+	GetAPIKeys(ctx context.Context, userID int64) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, id string) (APIKey, error)
+	ResolveAPIKey(ctx context.Context, key string) (apikey.Identity, bool, error)
+	RequestEmailChange(ctx context.Context, userID int64, req EmailChangeRequest) error
+	ConfirmEmailChange(ctx context.Context, userID int64, req EmailConfirmationRequest) (User, error)
+	ExpireUsers(ctx context.Context, now time.Time) ([]ExpiredUser, error)
+	RegisterUser(ctx context.Context, user User) (User, error)
+	ResolveExternalIdentity(ctx context.Context, login ExternalLogin, autoProvision bool) (User, error)
+	TransferMembers(ctx context.Context, req TransferRequest) (Transfer, error)
+	RequestRole(ctx context.Context, userID int64, req RoleRequestCreate) (RoleRequest, error)
+	GetRoleRequests(ctx context.Context, filter RoleRequestFilter, page pagination.Params) ([]RoleRequest, *pagination.Meta, error)
+	ApproveRoleRequest(ctx context.Context, id int64, decision RoleRequestDecision) (RoleRequest, error)
+	DenyRoleRequest(ctx context.Context, id int64, decision RoleRequestDecision) (RoleRequest, error)
+	RecordLoginAttempt(ctx context.Context, attempt LoginAttempt) error
+	GetUserLogins(ctx context.Context, id int64, filter LoginAttemptFilter, page pagination.Params) ([]LoginAttempt, *pagination.Meta, error)
+	GetLoginAttempts(ctx context.Context, filter LoginAttemptFilter, page pagination.Params) ([]LoginAttempt, *pagination.Meta, error)
+}
+
+// Typed errors returned by the user service
+var (
+	ErrUserNotFound      = apperror.New("UserNotFound", http.StatusNotFound, "user with the given ID not found")
+	ErrUserNotDeleted    = apperror.New("UserNotDeleted", http.StatusConflict, "user with the given ID is not deleted")
+	ErrInvalidRole       = apperror.New("InvalidRole", http.StatusUnprocessableEntity, "role cannot be assigned to the user")
+	ErrDisableSelf       = apperror.New("UserDisableSelf", http.StatusConflict, "users cannot disable their own account")
+	ErrSessionNotFound   = apperror.New("SessionNotFound", http.StatusNotFound, "session with the given ID not found")
+	ErrTokenNotRevocable = apperror.New("TokenNotRevocable", http.StatusUnprocessableEntity, "the access token has no ID and cannot be revoked on its own")
+	ErrRevocationOff     = apperror.New("TokenRevocationUnavailable", http.StatusServiceUnavailable, "the access tokens cannot be revoked without Redis")
+	ErrUserQuotaExceeded = apperror.New("UserQuotaExceeded", http.StatusUnprocessableEntity, "the maximum number of users is reached")
+	ErrAvatarTooLarge    = apperror.New("AvatarTooLarge", http.StatusRequestEntityTooLarge, "avatar exceeds the maximum size")
+	ErrAvatarType        = apperror.New("AvatarUnsupportedType", http.StatusUnsupportedMediaType, "avatar must be a PNG, JPEG, GIF or WebP image")
+	ErrAvatarDisabled    = apperror.New("AvatarStorageDisabled", http.StatusServiceUnavailable, "avatar uploads are not configured")
+	ErrNotServiceAccount = apperror.New("NotServiceAccount", http.StatusUnprocessableEntity, "API keys can only be issued to service accounts")
+	ErrAPIKeyNotFound    = apperror.New("APIKeyNotFound", http.StatusNotFound, "API key with the given ID not found")
+	ErrAPIKeyTTLTooLong  = apperror.New("APIKeyTTLTooLong", http.StatusUnprocessableEntity, "API key validity exceeds the maximum")
+	ErrEmailTaken        = apperror.New("EmailTaken", http.StatusConflict, "user with this email already exists")
+	ErrUserNameTaken     = apperror.New("UserNameTaken", http.StatusConflict, "user with this username already exists")
+	ErrEmailDeleted      = apperror.New("EmailTakenByDeletedUser", http.StatusConflict, "a deleted user has this email, restore it instead")
+	ErrUserNameDeleted   = apperror.New("UserNameTakenByDeletedUser", http.StatusConflict, "a deleted user has this username, restore it instead")
+	ErrEmailUnchanged    = apperror.New("EmailUnchanged", http.StatusUnprocessableEntity, "the new email is the current email of the user")
+	ErrInvalidEmailToken = apperror.New("InvalidEmailToken", http.StatusBadRequest, "the email confirmation token is invalid, expired or already used")
+)
+
+// RegisteredRole is the role of the users who signed up by themselves.
+const RegisteredRole = "ROLE_USER"
+
+// apiKeyTouchInterval is the precision of the last use of the API keys, written at most once per interval.
+const apiKeyTouchInterval = time.Minute
+
+// Reasons of the invalid roles
+const (
+	RoleReasonNotFound   = "role does not exist"
+	RoleReasonDuplicated = "role is given more than once"
+	RoleReasonInUse      = "role is assigned to users and cannot be changed or deleted"
+)
+
+// RoleError is returned when a role cannot be assigned to a user.
+// It wraps ErrInvalidRole, so it is matched with errors.Is, and carries the failing role.
+type RoleError struct {
+	Err *apperror.Error
+	InvalidRole
+}
+
+// Error implements the error interface.
+func (e *RoleError) Error() string {
+	return e.Err.Error() + ": " + e.Role + " (" + e.Reason + ")"
+}
+
+// Unwrap returns the typed error of the invalid role.
+func (e *RoleError) Unwrap() error {
+	return e.Err
 }
 
 // This struct defines the UserService that contains a repository field of type UserRepository
 // It implements the UserService interface and provides methods for user-related operations
 type userService struct {
-	repo UserRepository
+	repo   UserRepository
+	events outbox.Bus
+}
+
+// Option configures a user service.
+type Option func(*userService)
+
+// WithEventBus sets the bus the domain events are written to.
+func WithEventBus(bus outbox.Bus) Option {
+	return func(s *userService) {
+		s.events = bus
+	}
 }
 
 // NewUserService creates a new instance of UserService with the given repository.
-// It initializes the userService struct and returns it.
-func NewUserService(repo UserRepository) UserService {
-	return &userService{repo: repo}
+// It initializes the userService struct, applies the options and returns it.
+func NewUserService(repo UserRepository, opts ...Option) UserService {
+	s := &userService{repo: repo, events: outbox.DefaultBus}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-// GetAllUsers retrieves all users from the database.
-func (s *userService) GetAllUsers(ctx context.Context) ([]User, error) {
+// GetAllUsers retrieves the users matching the filter from the database, in the given order.
+// The page metadata is nil when the listing is not paginated.
+func (s *userService) GetAllUsers(ctx context.Context, filter UserFilter, sort UserSort, page pagination.Params) ([]User, *pagination.Meta, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
 	if db == nil {
 		logger.Error("database connection is nil")
-		return nil, errors.New("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
 	}
 
 	// Retrieve all users from the repository
-	users, err := s.repo.GetAllUsers(db)
+	users, err := s.repo.GetAllUsers(db, filter, sort, page)
 	if err != nil {
 		logger.Error(fmt.Sprintf("failed to get all users: %v", err))
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Build the page metadata
+	users, meta, err := pagination.Paginate(users, page, func(u User) string { return strconv.FormatInt(u.ID, 10) })
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta != nil && page.IsOffset() {
+		total, err := s.repo.CountUsers(db, filter)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to count users: %v", err))
+			return nil, nil, err
+		}
+		meta.TotalItems = &total
+	}
+
+	return users, meta, nil
+}
+
+// GetRoleUsers retrieves the users having the role with the given ID, with the other filters of the listing.
+func (s *userService) GetRoleUsers(ctx context.Context, roleID uint, filter UserFilter, sort UserSort, page pagination.Params) ([]User, *pagination.Meta, error) {
+	// Check if the role exists, an unknown role is not an empty listing
+	if _, err := role.NewRoleService(role.NewRoleRepository()).GetRoleByID(ctx, roleID); err != nil {
+		return nil, nil, err
+	}
+
+	filter.RoleID = roleID
+	return s.GetAllUsers(ctx, filter, sort, page)
+}
+
+// GetUserStats computes the aggregate counts of the users, with the signups of the given number of months.
+// The counts are read from one snapshot of the database, so they add up.
+func (s *userService) GetUserStats(ctx context.Context, months int) (UserStats, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return UserStats{}, errors.New("database connection is nil")
+	}
+
+	// The period starts at the beginning of the oldest month, the current month included
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.UTC)
+
+	stats := UserStats{ByRole: map[string]int64{}, ByUserType: map[string]int64{}, SignupsByMonth: []MonthlyCount{}}
+	var signups map[string]int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if stats.Total, stats.Enabled, err = s.repo.CountEnabledUsers(tx); err != nil {
+			return err
+		}
+		stats.Disabled = stats.Total - stats.Enabled
+
+		byRole, err := s.repo.CountUsersByRole(tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range role.Names() {
+			stats.ByRole[name] = 0
+		}
+		maps.Copy(stats.ByRole, byRole)
+
+		byType, err := s.repo.CountUsersByType(tx)
+		if err != nil {
+			return err
+		}
+		for _, userType := range UserTypes {
+			stats.ByUserType[userType] = 0
+		}
+		maps.Copy(stats.ByUserType, byType)
+
+		signups, err = s.repo.CountSignupsByMonth(tx, since)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get user statistics: %v", err))
+		return UserStats{}, err
 	}
 
-	return users, nil
+	// The months without signups are listed with a zero count
+	for month := since; !month.After(now); month = month.AddDate(0, 1, 0) {
+		key := month.Format("2006-01")
+		stats.SignupsByMonth = append(stats.SignupsByMonth, MonthlyCount{Month: key, Count: signups[key]})
+	}
+
+	return stats, nil
 }
 
 // GetUserByID retrieves a user by its ID from the database.
@@ -138,34 +474,36 @@ func (s *userService) CreateUser(ctx context.Context, user User) (User, error) {
 		}
 	}
 
+	// Store the hash of the password, never the password itself
+	// It is computed before the transaction, which is not held open while bcrypt runs.
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return User{}, err
+	}
+	user.Password = hash
+
+	// The avatar is uploaded with PUT /users/me/avatar, it is not set from the request body
+	user.AvatarURL = nil
+
 	var createdUser User
-	err := db.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		// Check if the user's roles are valid
-		rRepo := role.NewRoleRepository()
-		rServ := role.NewRoleService(rRepo)
-		for i := range user.Roles {
-			existingRole, err := rServ.GetRoleByName(ctx, user.Roles[i].Name)
-			if err != nil {
-				return err
-			}
-			if existingRole.Equals(&role.Role{}) {
-				return errors.New("role with the given name not found")
-			}
-
-			// Assign/update the role ID in the user struct
-			user.Roles[i].ID = existingRole.ID
+		if err := resolveRoles(ctx, user.Roles); err != nil {
+			return err
 		}
 
-		// Check if the username already exists
-		existingUser, err := s.repo.GetUserByUserName(db, user.UserName)
-		if (err == nil) || !(existingUser.Equals(&User{})) {
-			return errors.New("user with this username already exists")
+		// Check if the username or the email already exists, the deleted users keep theirs
+		if err := s.checkIdentityAvailable(tx, 0, user.UserName, user.Email, true); err != nil {
+			return err
 		}
 
-		// Check if the email already exists
-		existingUser, err = s.repo.GetUserByEmail(db, user.Email)
-		if (err == nil) || !(existingUser.Equals(&User{})) {
-			return errors.New("user with this email already exists")
+		// Refuse the user beyond the quota of the deployment, unless an admin overrides it
+		// The deleted users do not count
+		err := quota.Check(ctx, "users", quota.Users(), ErrUserQuotaExceeded, func() (int64, error) {
+			return s.repo.CountUsers(tx, UserFilter{})
+		})
+		if err != nil {
+			return err
 		}
 
 		// Extract user metadata from the context
@@ -174,15 +512,27 @@ func (s *userService) CreateUser(ctx context.Context, user User) (User, error) {
 			return errors.New("missing user context")
 		}
 
+		// Count the user as an employee of its department
+		user.DepartmentID, err = department.MoveEmployee(ctx, tx, nil, user.DepartmentID)
+		if err != nil {
+			return err
+		}
+
 		// Create a new user in the database
 		user.CreatedBy = &meta.UserID
 		user.UpdatedBy = user.CreatedBy
 		createdUser, err = s.repo.CreateUser(ctx, tx, user)
 		if err != nil {
+			return RoleConstraintError(err, user.Roles)
+		}
+
+		// Record the creation in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditCreated, User{}, createdUser); err != nil {
 			return err
 		}
 
-		return nil
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserCreated, createdUser)
 	})
 
 	if err != nil {
@@ -190,11 +540,19 @@ func (s *userService) CreateUser(ctx context.Context, user User) (User, error) {
 		return User{}, err
 	}
 
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the department whose employee count changed from the cache
+	department.ForgetCachedDepartments(ctx, createdUser.DepartmentID)
+
 	return createdUser, nil
 }
 
-// UpdateUser updates an existing user in the database.
-func (s *userService) UpdateUser(ctx context.Context, id int64, user User) (User, error) {
+// RegisterUser creates a user who signed up by themselves, an enabled USER_ACCOUNT with the RegisteredRole
+// role and no department. The password of the given user is already hashed: it was checked against the password
+// policy when the registration was requested. The creation is audited without an actor.
+func (s *userService) RegisterUser(ctx context.Context, user User) (User, error) {
 	// Get the database connection from the context
 	db := dbcontext.GetDB(ctx)
 	if db == nil {
@@ -202,52 +560,274 @@ func (s *userService) UpdateUser(ctx context.Context, id int64, user User) (User
 		return User{}, errors.New("database connection is nil")
 	}
 
-	// Validate the user struct using the validator
-	if err := user.Validate(); err != nil {
-		return User{}, err
+	enabled, deleted := true, false
+	registered := User{
+		UserName:                user.UserName,
+		Password:                user.Password,
+		Email:                   user.Email,
+		FirstName:               user.FirstName,
+		LastName:                user.LastName,
+		IsEnabled:               &enabled,
+		IsAccountNonExpired:     &enabled,
+		IsAccountNonLocked:      &enabled,
+		IsCredentialsNonExpired: &enabled,
+		IsDeleted:               &deleted,
+		UserType:                UserAccount,
+		Roles:                   []role.Role{{Name: RegisteredRole}},
 	}
 
-	var updatedUser User
+	var createdUser User
 	err := db.Transaction(func(tx *gorm.DB) error {
-		// Check if the user exists
-		existingUser, err := s.repo.GetUserByID(db, id)
+		if err := resolveRoles(ctx, registered.Roles); err != nil {
+			return err
+		}
+
+		// Check if the username and the email are still free, they may have been taken since the registration was requested
+		if err := s.checkIdentityAvailable(tx, 0, registered.UserName, registered.Email, true); err != nil {
+			return err
+		}
+
+		// Refuse the user beyond the quota of the deployment
+		err := quota.Check(ctx, "users", quota.Users(), ErrUserQuotaExceeded, func() (int64, error) {
+			return s.repo.CountUsers(tx, UserFilter{})
+		})
 		if err != nil {
 			return err
 		}
 
-		// Check if the existing user is empty
-		if (existingUser.Equals(&User{})) {
-			return errors.New("user not found") // User not found
+		createdUser, err = s.repo.CreateUser(ctx, tx, registered)
+		if err != nil {
+			if v, ok := dberror.AsConstraintViolation(err); ok && v.Code == dberror.UniqueViolation {
+				switch v.Key {
+				case "email":
+					return ErrEmailTaken
+				case "username":
+					return ErrUserNameTaken
+				}
+			}
+			return RoleConstraintError(err, registered.Roles)
 		}
 
-		// Extract user metadata from the context
-		meta, ok := metacontext.ExtractRequestMeta(ctx)
-		if !ok {
-			return errors.New("missing user context")
+		// Record the creation in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditCreated, User{}, createdUser); err != nil {
+			return err
 		}
 
-		// Update the user in the database
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserCreated, createdUser)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to register user: %v", err))
+		return User{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	return createdUser, nil
+}
+
+// UpdateUser updates an existing user in the database.
+// Every field is replaced with the one of the given user, an omitted field is reset to its zero value.
+// A change of isEnabled enables or disables the user like EnableUser and DisableUser, an omitted isEnabled
+// disables it. The deletion flag is left as is, the users are deleted and restored with DeleteUser and RestoreUser.
+func (s *userService) UpdateUser(ctx context.Context, id int64, user User) (User, error) {
+	// Validate the user struct using the validator
+	if err := user.Validate(); err != nil {
+		return User{}, err
+	}
+
+	// Validate the user's roles
+	if len(user.Roles) == 0 {
+		return User{}, errors.New("user must have at least one role")
+	}
+	for _, userRole := range user.Roles {
+		if err := userRole.Validate(); err != nil {
+			return User{}, err
+		}
+	}
+
+	// Store the hash of the password, never the password itself
+	// It is computed before the transaction, which is not held open while bcrypt runs.
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return User{}, err
+	}
+	user.Password = hash
+
+	enabled := isSet(user.IsEnabled)
+	return s.updateUser(ctx, id, user.Roles, func(existingUser User) (User, error) {
+		existingUser.DepartmentID = user.DepartmentID
 		existingUser.UserName = user.UserName
 		existingUser.Password = user.Password
 		existingUser.Email = user.Email
 		existingUser.FirstName = user.FirstName
 		existingUser.LastName = user.LastName
-		existingUser.IsEnabled = user.IsEnabled
+		existingUser.IsEnabled = &enabled
 		existingUser.IsAccountNonExpired = user.IsAccountNonExpired
 		existingUser.IsAccountNonLocked = user.IsAccountNonLocked
 		existingUser.IsCredentialsNonExpired = user.IsCredentialsNonExpired
-		existingUser.IsDeleted = user.IsDeleted
 		existingUser.AccountExpirationDate = user.AccountExpirationDate
 		existingUser.CredentialsExpirationDate = user.CredentialsExpirationDate
 		existingUser.UserType = user.UserType
+		existingUser.DepartmentScope = user.DepartmentScope
 		existingUser.LastLogin = user.LastLogin
-		existingUser.UpdatedBy = &meta.UserID
-		existingUser.Roles = user.Roles
-		updatedUser, err = s.repo.UpdateUser(ctx, tx, existingUser)
+		return existingUser, nil
+	})
+}
+
+// PatchUser updates the fields of an existing user given in the patch, the other fields are kept.
+// A new password is checked against the password policy with the user name and e-mail the user has after the patch.
+// A change of isEnabled enables or disables the user like EnableUser and DisableUser.
+func (s *userService) PatchUser(ctx context.Context, id int64, patch UserPatch) (User, error) {
+	// Validate the patch struct using the validator
+	if err := patch.Validate(); err != nil {
+		return User{}, err
+	}
+
+	// The roles replace the roles of the user when they are given
+	if patch.Roles != nil && len(patch.Roles) == 0 {
+		return User{}, errors.New("user must have at least one role")
+	}
+	for _, userRole := range patch.Roles {
+		if err := userRole.Validate(); err != nil {
+			return User{}, err
+		}
+	}
+
+	// Store the hash of the password, never the password itself
+	// It is computed before the transaction, which is not held open while bcrypt runs.
+	var hash string
+	if patch.Password != nil {
+		var err error
+		if hash, err = HashPassword(*patch.Password); err != nil {
+			return User{}, err
+		}
+	}
+
+	return s.updateUser(ctx, id, patch.Roles, func(existingUser User) (User, error) {
+		patch.Apply(&existingUser)
+
+		if patch.Password != nil {
+			// Enforce the password policy against the identity of the patched user
+			change := PasswordChange{UserName: existingUser.UserName, Email: existingUser.Email, NewPassword: *patch.Password}
+			if err := change.Validate(); err != nil {
+				return User{}, err
+			}
+			existingUser.Password = hash
+		}
+
+		return existingUser, nil
+	})
+}
+
+// updateUser updates an existing user with the given change, which returns the user with its new fields.
+// The roles replace the roles of the user, unless they are nil. The user is transferred when the change
+// moves it to another department, and the update is recorded in the audit trail and as a user.updated event.
+func (s *userService) updateUser(ctx context.Context, id int64, roles []role.Role, change func(existingUser User) (User, error)) (User, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return User{}, errors.New("database connection is nil")
+	}
+
+	var updatedUser User
+	var previousDepartmentID *string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so its concurrent transfers are counted once
+		if err := s.repo.LockUser(tx, id); err != nil {
+			return err
+		}
+
+		// Check if the user exists
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// Check if the existing user is empty
+		if (existingUser.Equals(&User{})) {
+			return ErrUserNotFound
+		}
+
+		// Check if the user's roles are valid
+		if roles != nil {
+			if err := resolveRoles(ctx, roles); err != nil {
+				return err
+			}
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Apply the change to a copy of the user, the existing user is kept for the audit trail
+		before := existingUser
+		changedUser, err := change(existingUser)
+		if err != nil {
+			return err
+		}
+
+		// The enabled flag is changed like an enable or a disable once the other fields are updated
+		enabled := changedUser.IsEnabled
+		changedUser.IsEnabled = before.IsEnabled
+		if enabled != nil && !*enabled && meta.UserID == id {
+			return ErrDisableSelf
+		}
+
+		// Check if the username and email are still unique, the deleted users keep theirs
+		if err := s.checkIdentityAvailable(tx, id, changedUser.UserName, changedUser.Email, true); err != nil {
+			return err
+		}
+
+		// Transfer the user, the employee counts of both departments are updated
+		previousDepartmentID = before.DepartmentID
+		changedUser.DepartmentID, err = department.MoveEmployee(ctx, tx, before.DepartmentID, changedUser.DepartmentID)
+		if err != nil {
+			return err
+		}
+
+		// Update the user in the database
+		changedUser.UpdatedBy = &meta.UserID
+		changedUser.Roles = nil
+		updatedUser, err = s.repo.UpdateUser(ctx, tx, changedUser)
 		if err != nil {
 			return err
 		}
 
+		// Replace the roles of the user, or keep them
+		if roles != nil {
+			if err := s.repo.ReplaceUserRoles(ctx, tx, updatedUser, roles); err != nil {
+				return RoleConstraintError(err, roles)
+			}
+			updatedUser.Roles = roles
+		} else {
+			updatedUser.Roles = before.Roles
+		}
+
+		// Record the changes in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditUpdated, before, updatedUser); err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		if err := s.addUserEvent(ctx, tx, event.UserUpdated, updatedUser); err != nil {
+			return err
+		}
+
+		// Enable or disable the user, a disabled user has its sessions ended like with DisableUser
+		if enabled == nil || isSet(enabled) == isSet(before.IsEnabled) {
+			return nil
+		}
+		roles := updatedUser.Roles
+		if updatedUser, err = s.changeUserEnabled(ctx, tx, updatedUser, *enabled, meta.UserID); err != nil {
+			return err
+		}
+		updatedUser.Roles = roles
 		return nil
 	})
 
@@ -256,6 +836,12 @@ func (s *userService) UpdateUser(ctx context.Context, id int64, user User) (User
 		return User{}, err
 	}
 
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the departments whose employee count changed from the cache
+	department.ForgetCachedDepartments(ctx, previousDepartmentID, updatedUser.DepartmentID)
+
 	return updatedUser, nil
 }
 
@@ -301,3 +887,1118 @@ func (s *userService) UpdateLastLogin(ctx context.Context, id int64, lastLogin t
 
 	return isUpdated, nil
 }
+
+// ValidatePassword checks a new password of a user against the password policy, without changing it.
+// It lets the callers refuse a weak password before consuming a single-use credential such as a reset token.
+func (s *userService) ValidatePassword(ctx context.Context, id int64, password string) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	existingUser, err := s.repo.GetUserByID(db, id)
+	if err != nil {
+		return err
+	}
+
+	change := PasswordChange{UserName: existingUser.UserName, Email: existingUser.Email, NewPassword: password}
+	return change.Validate()
+}
+
+// ResetPassword replaces the password of a user, e.g. after a forgotten password.
+// The sessions of the user end like with DisableUser: its refresh tokens are removed and its access tokens issued
+// until then are revoked, so the sessions opened with the old password can neither be used nor renewed.
+func (s *userService) ResetPassword(ctx context.Context, id int64, password string) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the user exists
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// Enforce the password policy against the identity of the user
+		change := PasswordChange{UserName: existingUser.UserName, Email: existingUser.Email, NewPassword: password}
+		if err := change.Validate(); err != nil {
+			return err
+		}
+
+		// Store the hash of the password, never the password itself
+		hash, err := HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		// Save the new password and end the sessions opened with the old one
+		existingUser.Password = hash
+		existingUser.Roles = nil
+		if _, err := s.repo.UpdateUser(ctx, tx, existingUser); err != nil {
+			return err
+		}
+		if err := revokeSessions(ctx, tx, existingUser, time.Now()); err != nil {
+			return err
+		}
+
+		// Record the reset in the audit trail of the user
+		// The reset with a reset token is not authenticated, its actor is the user proving its identity with the token.
+		entry := NewAuditEntry(ctx, id, AuditPasswordReset, nil)
+		if entry.ActorID == nil {
+			entry.ActorID = &existingUser.ID
+			entry.ActorName = existingUser.UserName
+		}
+		return s.repo.AddAuditEntry(ctx, tx, entry)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to reset password: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUser soft-deletes a user by its ID.
+// The refresh tokens of the user are removed, so the user can no longer renew its access tokens.
+func (s *userService) DeleteUser(ctx context.Context, id int64) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	var deletedDepartmentID *string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so its concurrent transfers are counted once
+		if err := s.repo.LockUser(tx, id); err != nil {
+			return err
+		}
+
+		// Check if the user exists
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Delete the user and end its sessions, like for a disabled user
+		if err := s.repo.DeleteUser(ctx, tx, existingUser, &meta.UserID); err != nil {
+			return err
+		}
+		if _, err := department.MoveEmployee(ctx, tx, existingUser.DepartmentID, nil); err != nil {
+			return err
+		}
+		deletedDepartmentID = existingUser.DepartmentID
+		if err := revokeSessions(ctx, tx, existingUser, time.Now()); err != nil {
+			return err
+		}
+
+		before := existingUser
+		isDeleted := true
+		existingUser.IsDeleted = &isDeleted
+		existingUser.DeletedBy = &meta.UserID
+
+		// Record the deletion in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditDeleted, before, existingUser); err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserDeleted, existingUser)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to delete user: %v", err))
+		return err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the department whose employee count changed from the cache
+	department.ForgetCachedDepartments(ctx, deletedDepartmentID)
+
+	return nil
+}
+
+// RestoreUser restores a soft-deleted user by its ID.
+func (s *userService) RestoreUser(ctx context.Context, id int64) (User, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return User{}, errors.New("database connection is nil")
+	}
+
+	var restoredUser User
+	var restoredDepartmentID *string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so its concurrent transfers are counted once
+		if err := s.repo.LockUser(tx, id); err != nil {
+			return err
+		}
+
+		// Check if the user is deleted, a user that is not deleted cannot be restored
+		deletedUser, err := s.repo.GetDeletedUserByID(tx, id)
+		if err != nil {
+			if errors.Is(err, ErrUserNotDeleted) {
+				if _, err := s.repo.GetUserByID(tx, id); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+
+		// The username and the email are unique among the users, deleted or not, but only case-sensitively:
+		// refuse restoring a user whose username or email differs from an active user's only by its case
+		if err := s.checkIdentityAvailable(tx, id, deletedUser.UserName, deletedUser.Email, false); err != nil {
+			return err
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Count the user again as an employee of its department
+		// The assignment is cleared when the department was deleted or archived in the meantime.
+		departmentID, err := department.MoveEmployee(ctx, tx, nil, deletedUser.DepartmentID)
+		if errors.Is(err, department.ErrUnknownDepartment) || errors.Is(err, department.ErrDepartmentArchived) {
+			departmentID, err = nil, s.repo.ClearUserDepartment(ctx, tx, deletedUser)
+		}
+		if err != nil {
+			return err
+		}
+
+		restoredUser, err = s.repo.RestoreUser(ctx, tx, deletedUser, &meta.UserID)
+		if err != nil {
+			return err
+		}
+		restoredDepartmentID = departmentID
+
+		// Record the restoration in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditRestored, deletedUser, restoredUser); err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserRestored, restoredUser)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to restore user: %v", err))
+		return User{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	// Remove the department whose employee count changed from the cache
+	department.ForgetCachedDepartments(ctx, restoredDepartmentID)
+
+	return restoredUser, nil
+}
+
+// EnableUser enables a user by its ID, so it can log in again.
+// The tokens revoked when the user was disabled stay revoked.
+func (s *userService) EnableUser(ctx context.Context, id int64) (User, error) {
+	return s.setUserEnabled(ctx, id, true)
+}
+
+// DisableUser disables a user by its ID.
+// The refresh tokens of the user are removed and its access tokens are revoked, so its sessions end immediately.
+func (s *userService) DisableUser(ctx context.Context, id int64) (User, error) {
+	return s.setUserEnabled(ctx, id, false)
+}
+
+// setUserEnabled enables or disables a user and writes the matching domain event.
+// A user already in the requested state is returned unchanged.
+func (s *userService) setUserEnabled(ctx context.Context, id int64, enabled bool) (User, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return User{}, errors.New("database connection is nil")
+	}
+
+	var updatedUser User
+	changed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so concurrent changes of its state are applied one after the other
+		if err := s.repo.LockUser(tx, id); err != nil {
+			return err
+		}
+
+		// Check if the user exists
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+		if existingUser.IsEnabled != nil && *existingUser.IsEnabled == enabled {
+			if !enabled && meta.UserID == id {
+				return ErrDisableSelf
+			}
+			updatedUser = existingUser
+			return nil
+		}
+
+		updatedUser, err = s.changeUserEnabled(ctx, tx, existingUser, enabled, meta.UserID)
+		changed = err == nil
+		return err
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to change the state of user: %v", err))
+		return User{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	if changed {
+		outbox.Notify()
+	}
+
+	return updatedUser, nil
+}
+
+// changeUserEnabled enables or disables the user within the transaction, recording who changed it.
+// A disabled user has its sessions ended before the transaction commits, an admin cannot disable their own account.
+// The change is recorded in the audit trail and written as a user.enabled or user.disabled event.
+func (s *userService) changeUserEnabled(ctx context.Context, tx *gorm.DB, existingUser User, enabled bool, actorID int64) (User, error) {
+	if !enabled && actorID == existingUser.ID {
+		return User{}, ErrDisableSelf
+	}
+
+	now := time.Now()
+	updatedUser, err := s.repo.SetUserEnabled(ctx, tx, existingUser, enabled, &actorID, now)
+	if err != nil {
+		return User{}, err
+	}
+
+	if enabled {
+		if err := s.auditUserChange(ctx, tx, AuditEnabled, existingUser, updatedUser); err != nil {
+			return User{}, err
+		}
+		return updatedUser, s.addUserEvent(ctx, tx, event.UserEnabled, updatedUser)
+	}
+
+	// End the sessions of the disabled user before the transaction commits
+	if err := revokeSessions(ctx, tx, updatedUser, now); err != nil {
+		return User{}, err
+	}
+
+	// Record the change in the audit trail of the user
+	if err := s.auditUserChange(ctx, tx, AuditDisabled, existingUser, updatedUser); err != nil {
+		return User{}, err
+	}
+
+	// Write the domain event to the outbox within the same transaction
+	return updatedUser, s.addUserEvent(ctx, tx, event.UserDisabled, updatedUser)
+}
+
+// GetSessions retrieves the sessions of a user, the most recently used first.
+// The session of the access token of the request is marked as the current one.
+func (s *userService) GetSessions(ctx context.Context, userID int64) ([]refreshtoken.Session, error) {
+	tokens, err := refreshtoken.NewRefreshTokenService(refreshtoken.NewRefreshTokenRepository()).GetSessionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	sessions := make([]refreshtoken.Session, 0, len(tokens))
+	for i := range tokens {
+		session := tokens[i].Session()
+		session.Current = ok && meta.SessionID != "" && meta.SessionID == session.ID
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes a session of a user by its ID.
+// The refresh token of the session is removed and the access tokens issued for it are revoked.
+func (s *userService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	// The session IDs are UUIDs, any other ID cannot match a session
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		removed, err := refreshtoken.NewRefreshTokenRepository().RemoveRefreshTokenByID(ctx, tx, userID, sessionID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// Without Redis (see pkg/module) the access tokens cannot be revoked and stay valid until they expire
+		if redisClient := dbcontext.GetRedisClient(ctx); redisClient != nil {
+			if err := revocation.RevokeSession(ctx, redisClient, removed.ID, removed.ExpiryDate); err != nil {
+				return fmt.Errorf("failed to revoke the tokens of the session: %w", err)
+			}
+		} else {
+			logger.Warn(fmt.Sprintf("redis is not connected, the access tokens of session %s stay valid until they expire", removed.ID))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to revoke session: %v", err))
+		return err
+	}
+
+	authmetrics.ObserveRevocation(authmetrics.RevokedSession)
+	return nil
+}
+
+// RevokeToken revokes a single access token by its ID, the jti claim, until it expires.
+// The other tokens of the user and its sessions stay valid, e.g. an impersonation token is ended this way.
+func (s *userService) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	// The tokens issued before the jti claim was added cannot be told apart from the other tokens of the user
+	if tokenID == "" {
+		return ErrTokenNotRevocable
+	}
+
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		return ErrRevocationOff
+	}
+
+	if err := revocation.RevokeToken(ctx, redisClient, tokenID, expiresAt); err != nil {
+		logger.Error(fmt.Sprintf("failed to revoke token: %v", err))
+		return err
+	}
+
+	authmetrics.ObserveRevocation(authmetrics.RevokedToken)
+	return nil
+}
+
+// RevokeSessions revokes all the sessions of a user by its ID.
+// The refresh tokens of the user are removed and its access tokens are revoked, the user stays enabled.
+func (s *userService) RevokeSessions(ctx context.Context, id int64) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the user exists
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := revokeSessions(ctx, tx, existingUser, time.Now()); err != nil {
+			return err
+		}
+
+		// Record the revocation in the audit trail of the user
+		return s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, id, AuditSessionsRevoked, nil))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to revoke the sessions of user: %v", err))
+		return err
+	}
+
+	return nil
+}
+
+// RecordMaskedExport records an export produced without its sensitive columns as an export.masked event,
+// so the audit trail tells which masked export was produced and by whom.
+func (s *userService) RecordMaskedExport(ctx context.Context, e export.MaskedExport) error {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+
+	if err := s.events.Add(ctx, db, event.NewEvent(event.ExportMasked, e.Entity, e)); err != nil {
+		logger.Error(fmt.Sprintf("failed to record the masked export of %s: %v", e.Entity, err))
+		return err
+	}
+	outbox.Notify()
+
+	return nil
+}
+
+// IssueAPIKey issues an API key to a service account, so its integrations authenticate without a password login.
+// The key is only returned here: the database holds its SHA-256 digest, a lost key is revoked and issued again.
+func (s *userService) IssueAPIKey(ctx context.Context, userID int64, req APIKeyRequest) (IssuedAPIKey, error) {
+	// Validate the request struct using the validator
+	if err := req.Validate(); err != nil {
+		return IssuedAPIKey{}, err
+	}
+
+	ttl := apiKeyTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	if ttl > apiKeyMaxTTL {
+		return IssuedAPIKey{}, ErrAPIKeyTTLTooLong
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return IssuedAPIKey{}, errors.New("database connection is nil")
+	}
+
+	key, hash, err := generateAPIKey()
+	if err != nil {
+		return IssuedAPIKey{}, err
+	}
+
+	var issued IssuedAPIKey
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only the service accounts get API keys, the other users log in with their password
+		existingUser, err := s.repo.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !existingUser.IsServiceAccount() {
+			return ErrNotServiceAccount
+		}
+
+		apiKey := APIKey{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			Name:      req.Name,
+			Prefix:    key[:len(APIKeyPrefix)+apiKeyVisiblePrefix],
+			KeyHash:   hash,
+			ExpiresAt: time.Now().Add(ttl).UTC(),
+		}
+		if meta, ok := metacontext.ExtractRequestMeta(ctx); ok {
+			apiKey.CreatedBy = &meta.UserID
+		}
+		created, err := s.repo.CreateAPIKey(ctx, tx, apiKey)
+		if err != nil {
+			return err
+		}
+		issued = IssuedAPIKey{APIKey: created, Key: key}
+
+		// Record the issuance in the audit trail of the service account
+		changes := AuditChanges{"apiKey": {Before: nil, After: created.Prefix}}
+		return s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, userID, AuditAPIKeyIssued, changes))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to issue an API key to user %d: %v", userID, err))
+		return IssuedAPIKey{}, err
+	}
+
+	return issued, nil
+}
+
+// GetAPIKeys retrieves the API keys of a user, without the keys themselves.
+func (s *userService) GetAPIKeys(ctx context.Context, userID int64) ([]APIKey, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	// Check if the user exists
+	if _, err := s.repo.GetUserByID(db, userID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetAPIKeys(db, userID)
+}
+
+// RevokeAPIKey revokes an API key of a user, the requests authenticated with it are refused from now on.
+// Revoking a revoked key returns it unchanged.
+func (s *userService) RevokeAPIKey(ctx context.Context, userID int64, id string) (APIKey, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return APIKey{}, errors.New("database connection is nil")
+	}
+
+	var revoked APIKey
+	err := db.Transaction(func(tx *gorm.DB) error {
+		apiKey, err := s.repo.GetAPIKeyByID(tx, userID, id)
+		if err != nil {
+			return err
+		}
+		if apiKey.RevokedAt != nil {
+			revoked = apiKey
+			return nil
+		}
+
+		revoked, err = s.repo.RevokeAPIKey(ctx, tx, apiKey, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		// Record the revocation in the audit trail of the service account
+		changes := AuditChanges{"apiKey": {Before: apiKey.Prefix, After: nil}}
+		return s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, userID, AuditAPIKeyRevoked, changes))
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to revoke API key %s of user %d: %v", id, userID, err))
+		return APIKey{}, err
+	}
+
+	return revoked, nil
+}
+
+// ResolveAPIKey finds the service account of an API key, it is registered as a resolver of the apikey package.
+// The key must be neither revoked nor expired, and its service account enabled, unlocked and not expired,
+// so disabling a service account stops its integrations at once.
+func (s *userService) ResolveAPIKey(ctx context.Context, key string) (apikey.Identity, bool, error) {
+	if !IsServiceAccountKey(key) {
+		return apikey.Identity{}, false, nil
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return apikey.Identity{}, false, errors.New("database connection is nil")
+	}
+
+	apiKey, err := s.repo.GetAPIKeyByHash(db, apikey.HashKey(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return apikey.Identity{}, false, nil
+	}
+	if err != nil {
+		return apikey.Identity{}, false, err
+	}
+
+	now := time.Now()
+	if !apiKey.IsActive(now) {
+		return apikey.Identity{}, false, nil
+	}
+
+	existingUser, err := s.repo.GetUserByID(db, apiKey.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return apikey.Identity{}, false, nil
+	}
+	if err != nil {
+		return apikey.Identity{}, false, err
+	}
+	if !existingUser.IsServiceAccount() || !isSet(existingUser.IsEnabled) || !isSet(existingUser.IsAccountNonLocked) || !isSet(existingUser.IsAccountNonExpired) {
+		return apikey.Identity{}, false, nil
+	}
+
+	// The last use is informative, a failure does not refuse the request
+	if err := s.repo.TouchAPIKey(ctx, db, apiKey.ID, now, apiKeyTouchInterval); err != nil {
+		logger.Warn(fmt.Sprintf("failed to record the use of API key %s: %v", apiKey.ID, err))
+	}
+
+	// The scope is never nil for a service account, an empty scope grants no department
+	return apikey.Identity{
+		Name:        existingUser.UserName,
+		UserID:      existingUser.ID,
+		Email:       existingUser.Email,
+		Roles:       existingUser.RoleNames(),
+		Departments: append([]string{}, existingUser.DepartmentScope...),
+	}, true, nil
+}
+
+// isSet reports whether an optional flag is set and true.
+func isSet(flag *bool) bool {
+	return flag != nil && *flag
+}
+
+// RequestEmailChange stages a new e-mail for a user and sends a confirmation token to it.
+// The e-mail of the user is only replaced once the token is confirmed, a new request replaces the staged one.
+func (s *userService) RequestEmailChange(ctx context.Context, userID int64, req EmailChangeRequest) error {
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// Get the database connection and the redis client from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return errors.New("database connection is nil")
+	}
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return errors.New("redis client is nil")
+	}
+
+	existingUser, err := s.repo.GetUserByID(db, userID)
+	if err != nil {
+		return err
+	}
+
+	// Refuse the current e-mail and the e-mails of the other users, the uniqueness is checked again on confirmation
+	if strings.EqualFold(existingUser.Email, req.Email) {
+		return ErrEmailUnchanged
+	}
+	if err := s.checkIdentityAvailable(db, userID, "", req.Email, true); err != nil {
+		return err
+	}
+
+	// Generate the token, only its hash is stored
+	token, tokenHash, err := generateEmailChangeToken()
+	if err != nil {
+		return err
+	}
+	staged, err := json.Marshal(stagedEmailChange{UserID: userID, Email: req.Email})
+	if err != nil {
+		return err
+	}
+	userKey := emailChangeUserKeyPrefix + strconv.FormatInt(userID, 10)
+
+	// Revoke the previous staged change of the user and store the new one
+	if previous, err := redisClient.Get(ctx, userKey).Result(); err == nil {
+		redisClient.Del(ctx, emailChangeKeyPrefix+previous)
+	}
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, emailChangeKeyPrefix+tokenHash, staged, emailChangeTTL)
+		pipe.Set(ctx, userKey, tokenHash, emailChangeTTL)
+		return nil
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to stage email change: %v", err))
+		return err
+	}
+
+	// Send the token to the new address, proving the user receives its e-mails
+	sendMail(confirmEmailMessage(existingUser, req.Email, token), fmt.Sprintf("email confirmation to user %d", userID))
+
+	return nil
+}
+
+// ConfirmEmailChange replaces the e-mail of a user with the e-mail staged with the token.
+// The token is consumed atomically, so it can only be used once, and only by the user who staged the change.
+// The previous address is notified of the change.
+func (s *userService) ConfirmEmailChange(ctx context.Context, userID int64, req EmailConfirmationRequest) (User, error) {
+	// Validate the request using the validator
+	if err := req.Validate(); err != nil {
+		return User{}, err
+	}
+
+	// Get the database connection and the redis client from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return User{}, errors.New("database connection is nil")
+	}
+	redisClient := dbcontext.GetRedisClient(ctx)
+	if redisClient == nil {
+		logger.Error("redis client is nil")
+		return User{}, errors.New("redis client is nil")
+	}
+
+	// Look the token up without consuming it, so the token of another user is not burnt
+	tokenKey := emailChangeKeyPrefix + hashEmailChangeToken(req.Token)
+	value, err := redisClient.Get(ctx, tokenKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return User{}, ErrInvalidEmailToken
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to read email change token: %v", err))
+		return User{}, err
+	}
+	var staged stagedEmailChange
+	if err := json.Unmarshal([]byte(value), &staged); err != nil || staged.UserID != userID {
+		return User{}, ErrInvalidEmailToken
+	}
+
+	// Consume the token, it may have been used concurrently since it was looked up
+	if _, err := redisClient.GetDel(ctx, tokenKey).Result(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return User{}, ErrInvalidEmailToken
+		}
+		logger.Error(fmt.Sprintf("failed to consume email change token: %v", err))
+		return User{}, err
+	}
+	redisClient.Del(ctx, emailChangeUserKeyPrefix+strconv.FormatInt(userID, 10))
+
+	var before, updatedUser User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so its concurrent changes are applied one after the other
+		if err := s.repo.LockUser(tx, userID); err != nil {
+			return err
+		}
+
+		// Check if the user exists
+		before, err = s.repo.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Check if the e-mail is still unique, another user may have taken it since the change was staged
+		if err := s.checkIdentityAvailable(tx, userID, "", staged.Email, true); err != nil {
+			return err
+		}
+
+		updatedUser, err = s.repo.SetUserEmail(ctx, tx, before, staged.Email, &userID)
+		if err != nil {
+			if v, ok := dberror.AsConstraintViolation(err); ok && v.Code == dberror.UniqueViolation {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		// Record the change in the audit trail of the user
+		changes := AuditChanges{"email": {Before: before.Email, After: updatedUser.Email}}
+		if err := s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, userID, AuditEmailChanged, changes)); err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserUpdated, updatedUser)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to confirm email change: %v", err))
+		return User{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	sendMail(emailChangedMessage(updatedUser, before.Email), fmt.Sprintf("email change notice to user %d", userID))
+
+	return updatedUser, nil
+}
+
+// sendMail sends a message in the background, so the response does not wait for the mail server.
+// The failures are logged with the given description of the message.
+func sendMail(message mailer.Message, description string) {
+	go func() {
+		mailCtx, cancel := context.WithTimeout(context.Background(), emailChangeMailTimeout)
+		defer cancel()
+
+		if err := mailer.Send(mailCtx, message); err != nil {
+			logger.Error(fmt.Sprintf("failed to send %s: %v", description, err))
+		}
+	}()
+}
+
+// UpdateAvatar stores the avatar of a user and sets its URL on the user.
+// The image is stored under a new key, so the caches serving the previous URL never serve a stale image,
+// and the previous image is removed once the user is updated.
+func (s *userService) UpdateAvatar(ctx context.Context, userID int64, contentType string, data []byte) (User, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return User{}, errors.New("database connection is nil")
+	}
+
+	// Check the image, the handler reads at most one byte more than the maximum size
+	if int64(len(data)) > avatarMaxBytes {
+		return User{}, ErrAvatarTooLarge
+	}
+	ext, ok := AvatarTypes[contentType]
+	if !ok {
+		return User{}, ErrAvatarType
+	}
+	if !storage.Enabled() {
+		return User{}, ErrAvatarDisabled
+	}
+
+	// Extract user metadata from the context
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok {
+		return User{}, errors.New("missing user context")
+	}
+
+	// Store the image before the transaction, which is not held open during the upload
+	key := fmt.Sprintf("avatars/%d/%s%s", userID, uuid.NewString(), ext)
+	avatarURL, err := storage.Put(ctx, key, contentType, data)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to store avatar: %v", err))
+		return User{}, err
+	}
+
+	var updatedUser User
+	var previousURL *string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so the previous avatar of concurrent uploads is removed once
+		if err := s.repo.LockUser(tx, userID); err != nil {
+			return err
+		}
+
+		// Check if the user exists
+		existingUser, err := s.repo.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+		previousURL = existingUser.AvatarURL
+
+		updatedUser, err = s.repo.SetUserAvatar(ctx, tx, existingUser, avatarURL, &meta.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserUpdated, updatedUser)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to update avatar: %v", err))
+		removeAvatar(ctx, avatarURL)
+		return User{}, err
+	}
+
+	// Forward the committed event without waiting for the next outbox poll
+	outbox.Notify()
+
+	if previousURL != nil {
+		removeAvatar(ctx, *previousURL)
+	}
+
+	return updatedUser, nil
+}
+
+// GetUserAudit retrieves the audit trail of a user, deleted or not, the oldest entry first.
+// The page metadata is nil when the listing is not paginated.
+func (s *userService) GetUserAudit(ctx context.Context, id int64, page pagination.Params) ([]AuditEntry, *pagination.Meta, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, nil, errors.New("database connection is nil")
+	}
+
+	// Check if the user exists, the trail of a deleted user is kept
+	if _, err := s.repo.GetUserByID(db, id); errors.Is(err, ErrUserNotFound) {
+		if _, err := s.repo.GetDeletedUserByID(db, id); err != nil {
+			if errors.Is(err, ErrUserNotDeleted) {
+				return nil, nil, ErrUserNotFound
+			}
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := s.repo.GetAuditEntries(db, id, page)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get the audit trail of user: %v", err))
+		return nil, nil, err
+	}
+
+	// Build the page metadata
+	entries, meta, err := pagination.Paginate(entries, page, func(e AuditEntry) string { return strconv.FormatInt(e.ID, 10) })
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta != nil && page.IsOffset() {
+		total, err := s.repo.CountAuditEntries(db, id)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to count the audit entries of user: %v", err))
+			return nil, nil, err
+		}
+		meta.TotalItems = &total
+	}
+
+	return entries, meta, nil
+}
+
+// removeAvatar removes the image of an avatar from the storage.
+// A failure only leaves an orphan image, so it is logged and not returned.
+func removeAvatar(ctx context.Context, avatarURL string) {
+	key, ok := storage.KeyOf(avatarURL)
+	if !ok {
+		return
+	}
+
+	if err := storage.Delete(ctx, key); err != nil {
+		logger.Warn(fmt.Sprintf("failed to remove avatar %s: %v", key, err))
+	}
+}
+
+// revokeSessions ends all the sessions of the user: its refresh tokens are removed
+// and its access tokens issued until the given time are revoked. The revocation is counted in the metrics.
+func revokeSessions(ctx context.Context, tx *gorm.DB, u User, now time.Time) error {
+	if _, err := refreshtoken.NewRefreshTokenRepository().RemoveRefreshTokenByUserID(ctx, tx, u.ID); err != nil {
+		return err
+	}
+
+	// Without Redis (see pkg/module) the access tokens cannot be revoked and stay valid until they expire
+	if redisClient := dbcontext.GetRedisClient(ctx); redisClient != nil {
+		if err := revocation.RevokeUser(ctx, redisClient, u.ID, u.UserName, now); err != nil {
+			return fmt.Errorf("failed to revoke the tokens of the user: %w", err)
+		}
+	} else {
+		logger.Warn(fmt.Sprintf("redis is not connected, the access tokens of user %d stay valid until they expire", u.ID))
+	}
+
+	authmetrics.ObserveRevocation(authmetrics.RevokedUser)
+	return nil
+}
+
+// checkIdentityAvailable checks that no other user than the given one has the username or the email, case-insensitively.
+// An empty username or email is not checked. With deleted, the deleted users are checked too: they keep their username
+// and email so they can be restored, and the conflict is reported with a dedicated error suggesting the restoration.
+func (s *userService) checkIdentityAvailable(tx *gorm.DB, id int64, username string, email string, deleted bool) error {
+	others, err := s.repo.GetUsersByIdentity(tx, username, email)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		isDeleted := other.DeletedAt != nil && other.DeletedAt.Valid
+		if other.ID == id || (isDeleted && !deleted) {
+			continue
+		}
+
+		if username != "" && strings.EqualFold(other.UserName, username) {
+			if isDeleted {
+				return ErrUserNameDeleted
+			}
+			return ErrUserNameTaken
+		}
+		if isDeleted {
+			return ErrEmailDeleted
+		}
+		return ErrEmailTaken
+	}
+
+	return nil
+}
+
+// resolveRoles checks that the roles exist and sets their IDs.
+// A missing or duplicated role is reported with a RoleError.
+func resolveRoles(ctx context.Context, roles []role.Role) error {
+	rRepo := role.NewRoleRepository()
+	rServ := role.NewRoleService(rRepo)
+	seen := make(map[string]bool, len(roles))
+	for i := range roles {
+		name := strings.ToUpper(roles[i].Name)
+		if seen[name] {
+			return &RoleError{Err: ErrInvalidRole, InvalidRole: InvalidRole{Role: roles[i].Name, Reason: RoleReasonDuplicated}}
+		}
+		seen[name] = true
+
+		existingRole, err := rServ.GetRoleByName(ctx, roles[i].Name)
+		if errors.Is(err, role.ErrRoleNameNotFound) || (err == nil && existingRole.Equals(&role.Role{})) {
+			return &RoleError{Err: ErrInvalidRole, InvalidRole: InvalidRole{Role: roles[i].Name, Reason: RoleReasonNotFound}}
+		}
+		if err != nil {
+			return err
+		}
+
+		// Assign/update the role ID in the user struct
+		roles[i].ID = existingRole.ID
+	}
+
+	return nil
+}
+
+// addUserEvent writes a user domain event to the event bus of the service.
+// The password hash and the refresh token are never part of the event payload.
+func (s *userService) addUserEvent(ctx context.Context, tx *gorm.DB, eventType string, u User) error {
+	u.Password = ""
+	u.RefreshTokens = nil
+	return s.events.Add(ctx, tx, event.NewEvent(eventType, strconv.FormatInt(u.ID, 10), u))
+}
+
+// auditUserChange records an action on the user in its audit trail, with the fields it changed.
+// A change of the roles is recorded as a separate roles_changed entry, except on creation,
+// and an update changing nothing but the roles records no updated entry.
+func (s *userService) auditUserChange(ctx context.Context, tx *gorm.DB, action string, before, after User) error {
+	changes, err := DiffUsers(before, after)
+	if err != nil {
+		return err
+	}
+
+	roles := DiffRoles(before, after)
+	if action == AuditCreated {
+		maps.Copy(changes, roles)
+		roles = nil
+	}
+
+	if len(changes) > 0 || action != AuditUpdated {
+		if err := s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, after.ID, action, changes)); err != nil {
+			return err
+		}
+	}
+	if roles != nil {
+		return s.repo.AddAuditEntry(ctx, tx, NewAuditEntry(ctx, after.ID, AuditRolesChanged, roles))
+	}
+
+	return nil
+}
+
+// RoleConstraintError translates a violation of the user_roles constraints into a RoleError naming the failing role.
+// The roles are the ones being assigned, they give the names of the role IDs reported by the database.
+// The relation declares ON UPDATE RESTRICT and ON DELETE SET NULL: changing the ID of an assigned role is
+// refused, and deleting it sets a key column of user_roles to NULL, which its primary key refuses.
+// The other errors are returned unchanged.
+func RoleConstraintError(err error, roles []role.Role) error {
+	v, ok := dberror.AsConstraintViolation(err)
+	if !ok || (v.Table != "user_roles" && !strings.HasPrefix(v.Constraint, "fk_user_roles_")) {
+		return err
+	}
+
+	// The NOT NULL violations report no key, the role is only known when a single one is involved
+	roleName := func(id string) string {
+		if id == "" && len(roles) == 1 {
+			return roles[0].Name
+		}
+		for _, r := range roles {
+			if strconv.FormatUint(uint64(r.ID), 10) == id {
+				return r.Name
+			}
+		}
+		return id
+	}
+
+	switch {
+	case v.Code == dberror.ForeignKeyViolation && v.Key == "role_id":
+		// The role was deleted after it was resolved
+		return &RoleError{Err: ErrInvalidRole, InvalidRole: InvalidRole{Role: roleName(v.Value), Reason: RoleReasonNotFound}}
+	case v.Code == dberror.ForeignKeyViolation && v.Key == "user_id":
+		// The user was deleted in the meantime
+		return ErrUserNotFound
+	case v.Code == dberror.ForeignKeyViolation && v.Constraint == "fk_user_roles_role":
+		// ON UPDATE RESTRICT: the ID of an assigned role cannot change
+		return &RoleError{Err: ErrInvalidRole, InvalidRole: InvalidRole{Role: roleName(v.Value), Reason: RoleReasonInUse}}
+	case v.Code == dberror.NotNullViolation && v.Column == "role_id":
+		// ON DELETE SET NULL: an assigned role cannot be deleted
+		return &RoleError{Err: ErrInvalidRole, InvalidRole: InvalidRole{Role: roleName(v.Value), Reason: RoleReasonInUse}}
+	case v.Code == dberror.UniqueViolation:
+		// The value of the primary key is "<user_id>, <role_id>"
+		parts := strings.Split(v.Value, ", ")
+		return &RoleError{Err: ErrInvalidRole, InvalidRole: InvalidRole{Role: roleName(parts[len(parts)-1]), Reason: RoleReasonDuplicated}}
+	}
+
+	return err
+}
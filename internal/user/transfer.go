@@ -0,0 +1,156 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// transferBatchSize is the number of members read at once by a transfer.
+const transferBatchSize = 100
+
+// ErrSameDepartment is returned when the members of a department are transferred to the same department.
+var ErrSameDepartment = apperror.New("SameDepartment", http.StatusUnprocessableEntity, "the members cannot be transferred to their own department")
+
+// TransferRequest is the body of a transfer of the members of a department to another one,
+// e.g. before the department is deleted.
+type TransferRequest struct {
+	FromDepartmentID string `json:"fromDepartmentId" validate:"required,len=4"`
+	ToDepartmentID   string `json:"toDepartmentId" validate:"required,len=4"`
+}
+
+// Validate validates the TransferRequest struct using the validator package.
+func (r *TransferRequest) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Transfer reports the users transferred from a department to another one.
+type Transfer struct {
+	FromDepartmentID string  `json:"fromDepartmentId"`
+	ToDepartmentID   string  `json:"toDepartmentId"`
+	Transferred      []int64 `json:"transferred"`
+}
+
+// TransferMembers moves the active members of a department to another one, one user per transaction, like an
+// update of their department: the employee counts follow, and each transfer is audited and publishes a
+// user.updated event. The members of a deleted department can be transferred too. The transfer stops at the first
+// failure, e.g. an unknown or archived target; the users already transferred stay in the target department.
+func (s *userService) TransferMembers(ctx context.Context, req TransferRequest) (Transfer, error) {
+	// Validate the request struct using the validator
+	if err := req.Validate(); err != nil {
+		return Transfer{}, err
+	}
+	if strings.EqualFold(req.FromDepartmentID, req.ToDepartmentID) {
+		return Transfer{}, ErrSameDepartment
+	}
+
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Transfer{}, errors.New("database connection is nil")
+	}
+
+	transfer := Transfer{FromDepartmentID: req.FromDepartmentID, ToDepartmentID: req.ToDepartmentID, Transferred: []int64{}}
+	defer func() {
+		// Forward the committed events without waiting for the next outbox poll
+		if len(transfer.Transferred) > 0 {
+			outbox.Notify()
+			department.ForgetCachedDepartments(ctx, &req.FromDepartmentID, &req.ToDepartmentID)
+		}
+	}()
+
+	for afterID := int64(0); ; {
+		ids, err := s.repo.GetDepartmentMemberIDs(db, req.FromDepartmentID, afterID, transferBatchSize)
+		if err != nil {
+			return transfer, fmt.Errorf("failed to read the members of the department: %v", err)
+		}
+
+		for _, id := range ids {
+			afterID = id
+			moved, err := s.transferUser(ctx, db, id, req)
+			if err != nil {
+				logger.Error(fmt.Sprintf("failed to transfer user %d: %v", id, err))
+				return transfer, err
+			}
+			if moved {
+				transfer.Transferred = append(transfer.Transferred, id)
+			}
+		}
+
+		if len(ids) < transferBatchSize {
+			return transfer, nil
+		}
+	}
+}
+
+// transferUser moves a member of a department to another one and reports whether it was moved.
+// The user is locked and read again, so a user that left the department in the meantime is not moved.
+func (s *userService) transferUser(ctx context.Context, db *gorm.DB, id int64, req TransferRequest) (bool, error) {
+	moved := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user, so its concurrent transfers are counted once
+		if err := s.repo.LockUser(tx, id); err != nil {
+			return err
+		}
+
+		existingUser, err := s.repo.GetUserByID(tx, id)
+		if err != nil {
+			return err
+		}
+		if existingUser.DepartmentID == nil || !strings.EqualFold(*existingUser.DepartmentID, req.FromDepartmentID) {
+			return nil
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Transfer the user, the employee counts of both departments are updated
+		changedUser := existingUser
+		changedUser.DepartmentID, err = department.MoveEmployee(ctx, tx, existingUser.DepartmentID, &req.ToDepartmentID)
+		if err != nil {
+			return err
+		}
+
+		// Update the user in the database, its roles are kept
+		changedUser.UpdatedBy = &meta.UserID
+		changedUser.Roles = nil
+		updatedUser, err := s.repo.UpdateUser(ctx, tx, changedUser)
+		if err != nil {
+			return err
+		}
+		updatedUser.Roles = existingUser.Roles
+
+		// Record the transfer in the audit trail of the user
+		if err := s.auditUserChange(ctx, tx, AuditTransferred, existingUser, updatedUser); err != nil {
+			return err
+		}
+
+		moved = true
+
+		// Write the domain event to the outbox within the same transaction
+		return s.addUserEvent(ctx, tx, event.UserUpdated, updatedUser)
+	})
+
+	return moved, err
+}
@@ -0,0 +1,354 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Headers sent with every webhook delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// flushCheckInterval is the interval at which Flush checks if the dispatcher has run.
+const flushCheckInterval = 50 * time.Millisecond
+
+var (
+	WebhookWorkers             string
+	WebhookPollIntervalSeconds string
+	WebhookMaxRetries          string
+	WebhookTimeoutSeconds      string
+	WebhookAllowedHosts        string
+
+	dispatcher *Dispatcher
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	WebhookWorkers = os.Getenv("WEBHOOK_WORKERS")
+	WebhookPollIntervalSeconds = os.Getenv("WEBHOOK_POLL_INTERVAL_SECONDS")
+	WebhookMaxRetries = os.Getenv("WEBHOOK_MAX_RETRIES")
+	WebhookTimeoutSeconds = os.Getenv("WEBHOOK_TIMEOUT_SECONDS")
+	WebhookAllowedHosts = os.Getenv("WEBHOOK_ALLOWED_HOSTS")
+}
+
+// Dispatcher delivers the events to the subscribed webhooks.
+// The deliveries are persisted in the webhook_deliveries table and claimed by the dispatcher in batches of
+// one delivery per worker; each delivery is signed with the webhook secret. A failed delivery is scheduled
+// again with an exponential backoff, so the workers never wait for the retries.
+type Dispatcher struct {
+	db           *gorm.DB
+	repo         WebhookRepository
+	client       *http.Client
+	trusted      *http.Client
+	workers      int
+	maxRetries   int
+	pollInterval time.Duration
+	wakeup       chan struct{}
+	lastRun      atomic.Int64
+}
+
+// NewDispatcher creates a webhook dispatcher configured from the environment variables, without starting it.
+// The database connection is used to store and claim the deliveries.
+func NewDispatcher(db *gorm.DB, repo WebhookRepository) *Dispatcher {
+	timeout := time.Duration(getEnvInt(WebhookTimeoutSeconds, 10)) * time.Second
+
+	// The redirects are not followed, a delivery answered with a redirect is retried
+	noRedirect := func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }
+
+	// The deliveries to the hosts of WEBHOOK_ALLOWED_HOSTS may reach the private network
+	guarded := http.DefaultTransport.(*http.Transport).Clone()
+	guarded.DialContext = (&net.Dialer{Timeout: timeout, Control: dialControl}).DialContext
+
+	return &Dispatcher{
+		db:           db,
+		repo:         repo,
+		client:       &http.Client{Timeout: timeout, Transport: guarded, CheckRedirect: noRedirect},
+		trusted:      &http.Client{Timeout: timeout, CheckRedirect: noRedirect},
+		workers:      getEnvInt(WebhookWorkers, 4),
+		maxRetries:   getEnvInt(WebhookMaxRetries, 3),
+		pollInterval: time.Duration(getEnvInt(WebhookPollIntervalSeconds, 5)) * time.Second,
+		wakeup:       make(chan struct{}, 1),
+	}
+}
+
+// InitDispatcher initializes the webhook dispatcher and starts polling the due deliveries.
+func InitDispatcher(db *gorm.DB) {
+	if db == nil {
+		logger.Error("Failed to start webhook dispatcher: database connection is nil")
+		return
+	}
+
+	dispatcher = NewDispatcher(db, NewWebhookRepository())
+	dispatcher.lastRun.Store(time.Now().UnixNano())
+	go dispatcher.run()
+
+	// Queue the deliveries of the domain events with the transaction of the outbox
+	outbox.SetWebhookSink(func(ctx context.Context, tx *gorm.DB, e event.Event) error {
+		return QueueDeliveries(ctx, tx, dispatcher.repo, e)
+	}, Notify)
+
+	// Report the dispatcher as degraded when it stops polling
+	health.Register("webhook-dispatcher", health.NonCritical, CheckHealth)
+
+	// Attempt the due deliveries before the process exits, the others are kept for the next start
+	drain.RegisterJob("webhook-dispatcher", Flush)
+
+	logger.Info(fmt.Sprintf("Webhook dispatcher started with %d workers and a poll interval of %s", dispatcher.workers, dispatcher.pollInterval))
+}
+
+// QueueDeliveries creates a delivery of the event for every active webhook subscribed to its type.
+// Queuing the same event again does not deliver it twice.
+func QueueDeliveries(ctx context.Context, tx *gorm.DB, repo WebhookRepository, e event.Event) error {
+	// Find the webhooks subscribed to the event
+	webhooks, err := repo.GetActiveWebhooksByEvent(tx, e.Type)
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	// Marshal the payload once for all the deliveries
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]Delivery, len(webhooks))
+	for i, w := range webhooks {
+		deliveries[i] = Delivery{WebhookID: w.ID, EventID: e.ID, EventType: e.Type, Payload: string(body), NextAttemptAt: now}
+	}
+
+	return repo.CreateDeliveries(ctx, tx, deliveries)
+}
+
+// Notify wakes up the dispatcher so the queued deliveries are attempted without waiting for the next poll.
+// It never blocks the caller.
+func Notify() {
+	if dispatcher == nil {
+		return
+	}
+
+	dispatcher.notify()
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// CheckHealth reports an error when the dispatcher has not completed a run for three poll intervals.
+func CheckHealth(ctx context.Context) error {
+	if dispatcher == nil {
+		return errors.New("webhook dispatcher is not started")
+	}
+
+	since := time.Since(time.Unix(0, dispatcher.lastRun.Load()))
+	if since > 3*dispatcher.pollInterval {
+		return fmt.Errorf("webhook dispatcher has not run for %s", since.Round(time.Second))
+	}
+
+	return nil
+}
+
+// Flush wakes up the dispatcher and waits for a run started after the call to complete,
+// so the deliveries due until now are attempted. The retries scheduled later are kept in the database.
+func Flush(ctx context.Context) error {
+	if dispatcher == nil {
+		return nil
+	}
+
+	since := time.Now().UnixNano()
+	Notify()
+
+	ticker := time.NewTicker(flushCheckInterval)
+	defer ticker.Stop()
+
+	for dispatcher.lastRun.Load() < since {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// run attempts the due deliveries on every tick or wake-up.
+func (d *Dispatcher) run() {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.wakeup:
+		}
+
+		// Keep dispatching while full batches are found
+		for {
+			n, err := d.DispatchDue(context.Background())
+			if err != nil {
+				logger.Error(fmt.Sprintf("failed to dispatch webhook deliveries: %v", err))
+				break
+			}
+			if n < d.workers {
+				break
+			}
+		}
+
+		d.lastRun.Store(time.Now().UnixNano())
+	}
+}
+
+// DispatchDue claims a batch of due deliveries, one per worker, attempts them concurrently
+// and records their results. It returns the number of deliveries attempted.
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	// A delivery is leased for twice the timeout of its request, then it is due again
+	now := time.Now()
+	leaseUntil := now.Add(2 * d.client.Timeout)
+
+	var deliveries []Delivery
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		claimed, err := d.repo.ClaimDueDeliveries(ctx, tx, d.workers, d.maxRetries+1, now, leaseUntil)
+		if err != nil {
+			return err
+		}
+
+		deliveries = claimed
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, dl := range deliveries {
+		wg.Add(1)
+		go func(dl Delivery) {
+			defer wg.Done()
+			d.attempt(ctx, dl)
+		}(dl)
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// attempt delivers a claimed delivery and records the result.
+// A failed delivery is scheduled again after a backoff of 1s, 2s, 4s... until WEBHOOK_MAX_RETRIES retries.
+func (d *Dispatcher) attempt(ctx context.Context, dl Delivery) {
+	attempt := dl.Attempts + 1
+
+	// The webhook may have been deleted or deactivated since the event was queued
+	err := errors.New("webhook is deleted or inactive")
+	if dl.Webhook.ID != 0 && dl.Webhook.Active {
+		err = d.deliver(dl.Webhook, dl.EventType, dl.EventID, []byte(dl.Payload))
+	}
+
+	if err == nil {
+		if err := d.repo.MarkDelivered(ctx, d.db, dl.ID, time.Now()); err != nil {
+			logger.Error(fmt.Sprintf("failed to mark webhook delivery %d as delivered: %v", dl.ID, err))
+		}
+		return
+	}
+
+	backoff := time.Second << (attempt - 1)
+	if err := d.repo.MarkDeliveryFailed(ctx, d.db, dl.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+		logger.Error(fmt.Sprintf("failed to record the failed webhook delivery %d: %v", dl.ID, err))
+		return
+	}
+
+	if attempt > d.maxRetries {
+		logger.Error(fmt.Sprintf("webhook delivery abandoned after %d attempts (webhook %d, event %s): %v", attempt, dl.WebhookID, dl.EventID, err))
+		return
+	}
+
+	logger.Warn(fmt.Sprintf("webhook delivery failed (webhook %d, event %s, attempt %d): %v", dl.WebhookID, dl.EventID, attempt, err))
+
+	// Wake up the dispatcher when the retry is due, rather than on the next poll
+	time.AfterFunc(backoff, d.notify)
+}
+
+// deliver sends a single signed HTTP POST request to the webhook URL.
+// Any non-2xx response is considered a failure.
+func (d *Dispatcher) deliver(w Webhook, eventType string, eventID string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, eventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(w.Secret, timestamp, body))
+
+	client := d.client
+	if allowedHost(req.URL.Hostname()) {
+		client = d.trusted
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign computes the HMAC-SHA256 signature of a payload.
+// The signed content is "<timestamp>.<body>" so receivers can reject replayed deliveries.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getEnvInt parses an integer environment value, falling back to the default value when it is missing or invalid.
+func getEnvInt(value string, defaultValue int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return defaultValue
+	}
+
+	return n
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gopkg.in/go-playground/validator.v9"
+	"gorm.io/gorm"
+)
+
+var v *validator.Validate
+
+// EventTypes represents the list of event types a webhook is subscribed to.
+// It is stored as a JSON array in a jsonb column.
+type EventTypes []string
+
+// Webhook represents the webhook entity in the database.
+type Webhook struct {
+	ID        int64           `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	URL       string          `gorm:"column:url;type:varchar(2048);not null" json:"url" validate:"required,url,max=2048"`
+	Secret    string          `gorm:"column:secret;type:varchar(100);not null" json:"secret,omitempty" validate:"omitempty,min=16,max=100"`
+	Events    EventTypes      `gorm:"column:events;type:jsonb;not null" json:"events" validate:"required,min=1,dive,oneof=department.created department.updated department.deleted department.archived department.unarchived department.activated department.deactivated"`
+	Active    bool            `gorm:"column:active;type:bool;not null" json:"active"`
+	CreatedBy *int64          `gorm:"column:created_by" json:"createdBy,omitempty"`
+	CreatedAt *time.Time      `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+	UpdatedBy *int64          `gorm:"column:updated_by" json:"updatedBy,omitempty"`
+	UpdatedAt *time.Time      `gorm:"column:updated_at;type:timestamptz;autoUpdateTime;default:now()" json:"updatedAt,omitempty"`
+	DeletedBy *int64          `gorm:"column:deleted_by" json:"deletedBy,omitempty"`
+	DeletedAt *gorm.DeletedAt `gorm:"column:deleted_at;type:timestamptz;index" json:"deletedAt,omitempty"`
+}
+
+// Override the TableName method to specify the table name
+// in the database. This is optional if you want to use the default naming convention.
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// Value implements the driver.Valuer interface.
+// It marshals the event types into a JSON array.
+func (e EventTypes) Value() (driver.Value, error) {
+	if e == nil {
+		return "[]", nil
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface.
+// It unmarshals the JSON array stored in the database into the event types.
+func (e *EventTypes) Scan(value interface{}) error {
+	var data []byte
+	switch val := value.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	case nil:
+		*e = nil
+		return nil
+	default:
+		return errors.New("failed to scan event types")
+	}
+
+	return json.Unmarshal(data, e)
+}
+
+// Contains checks if the given event type is part of the list.
+func (e EventTypes) Contains(eventType string) bool {
+	for _, t := range e {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Equals compares two Webhook objects for equality.
+func (w *Webhook) Equals(other *Webhook) bool {
+	if w == nil && other == nil {
+		return true
+	}
+
+	if w == nil || other == nil {
+		return false
+	}
+
+	if (w.ID != other.ID) ||
+		(w.URL != other.URL) ||
+		(w.Active != other.Active) {
+		return false
+	}
+
+	return true
+}
+
+// Validate validates the Webhook struct using the validator package.
+// It checks if the struct fields meet the validation rules defined in the struct tags.
+func (w *Webhook) Validate() error {
+	v = validate.GetValidator()
+
+	if err := v.Struct(w); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delivery represents the delivery of an event to a webhook.
+// The deliveries are persisted, so the retries are scheduled with NextAttemptAt instead of holding a worker,
+// and a delivery is not lost when the process restarts. An event is delivered once per webhook.
+type Delivery struct {
+	ID            int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	WebhookID     int64      `gorm:"column:webhook_id;not null;uniqueIndex:idx_webhook_deliveries_event" json:"webhookId"`
+	EventID       string     `gorm:"column:event_id;type:varchar(36);not null;uniqueIndex:idx_webhook_deliveries_event" json:"eventId"`
+	EventType     string     `gorm:"column:event_type;type:varchar(100);not null" json:"eventType"`
+	Payload       string     `gorm:"column:payload;type:text;not null" json:"payload"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;type:timestamptz;not null;index" json:"nextAttemptAt"`
+	LastError     *string    `gorm:"column:last_error;type:text" json:"lastError,omitempty"`
+	DeliveredAt   *time.Time `gorm:"column:delivered_at;type:timestamptz" json:"deliveredAt,omitempty"`
+	CreatedAt     *time.Time `gorm:"column:created_at;type:timestamptz;autoCreateTime;default:now()" json:"createdAt,omitempty"`
+	Webhook       Webhook    `gorm:"foreignKey:WebhookID" json:"-"`
+}
+
+// Override the TableName method to specify the table name
+// in the database. This is optional if you want to use the default naming convention.
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// This struct defines the WebhookHandler which handles HTTP requests related to webhooks.
+// It contains a service field of type WebhookService which is used to interact with the webhook data layer.
+type WebhookHandler struct {
+	Service WebhookService
+}
+
+// NewWebhookHandler creates a new instance of WebhookHandler.
+// It initializes the WebhookHandler struct with the provided WebhookService.
+func NewWebhookHandler(webhookService WebhookService) *WebhookHandler {
+	return &WebhookHandler{Service: webhookService}
+}
+
+// GetAllWebhooks retrieves all webhooks from the database and returns them as JSON.
+// @Summary      Get all webhooks
+// @Description  Get all registered webhooks from the database
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   HttpResponse for successful retrieval
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /webhooks [get]
+func (h *WebhookHandler) GetAllWebhooks(c *gin.Context) {
+	webhooks, err := h.Service.GetAllWebhooks(c.Request.Context())
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve webhooks", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "All Webhooks retrieved successfully", webhooks)
+}
+
+// GetWebhookByID retrieves a webhook by its ID from the database and returns it as JSON.
+// @Summary      Get webhook by ID
+// @Description  Get a webhook by its ID from the database
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Webhook ID"
+// @Success      200  {object}  HttpResponse for successful retrieval
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for not found
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhookByID(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Retrieve the webhook by ID from the service
+	webhook, err := h.Service.GetWebhookByID(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to retrieve webhook", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to retrieve webhook", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Webhook retrieved successfully", webhook)
+}
+
+// CreateWebhook registers a new webhook and returns it as JSON.
+// The signing secret is only returned in this response.
+// @Summary      Create a new webhook
+// @Description  Register a new webhook callback URL
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        webhook  body      Webhook  true  "Webhook object"
+// @Success      201  {object}  HttpResponse for successful creation
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      422  {object}  HttpResponse for a URL that is not allowed
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	// Bind the JSON request body to the Webhook struct
+	var webhook Webhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Create the webhook using the service
+	createdWebhook, err := h.Service.CreateWebhook(c.Request.Context(), webhook)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to create webhook", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to create webhook", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to create webhook", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusCreated, "Webhook created successfully", createdWebhook)
+}
+
+// UpdateWebhook updates an existing webhook and returns it as JSON.
+// @Summary      Update an existing webhook
+// @Description  Update an existing webhook in the database
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int      true  "Webhook ID"
+// @Param        webhook  body      Webhook  true  "Webhook object"
+// @Success      200  {object}  HttpResponse for successful update
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for not found
+// @Failure      422  {object}  HttpResponse for a URL that is not allowed
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /webhooks/{id} [put]
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	// Bind the JSON request body to the Webhook struct
+	var webhook Webhook
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Update the webhook using the service
+	updatedWebhook, err := h.Service.UpdateWebhook(c.Request.Context(), id, webhook)
+	if err != nil {
+		// Check if the error is a validation error
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			util.JSONErrorMap(c, http.StatusBadRequest, "Failed to update webhook", util.FormatValidationErrors(err))
+			return
+		}
+
+		if util.JSONAppError(c, "Failed to update webhook", err) {
+			return
+		}
+
+		util.JSONError(c, http.StatusInternalServerError, "Failed to update webhook", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Webhook updated successfully", updatedWebhook)
+}
+
+// DeleteWebhook deletes a webhook by its ID.
+// @Summary      Delete a webhook
+// @Description  Delete a webhook by its ID from the database
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        id  path      int  true  "Webhook ID"
+// @Success      200  {object}  HttpResponse for successful deletion
+// @Failure      400  {object}  HttpResponse for bad request
+// @Failure      404  {object}  HttpResponse for not found
+// @Failure      500  {object}  HttpResponse for internal server error
+// @Router       /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	// Parse the ID from the URL parameter
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		util.JSONError(c, http.StatusBadRequest, "Invalid ID format", err.Error())
+		return
+	}
+
+	_, err = h.Service.DeleteWebhook(c.Request.Context(), id)
+	if util.JSONAppError(c, "Failed to delete webhook", err) {
+		return
+	}
+	if err != nil {
+		util.JSONError(c, http.StatusInternalServerError, "Failed to delete webhook", err.Error())
+		return
+	}
+
+	util.JSONSuccess(c, http.StatusOK, "Webhook deleted successfully", nil)
+}
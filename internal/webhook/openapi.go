@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// Operations documents the webhook handlers in the OpenAPI spec, keyed by handler method name.
+// The errors listed here are the typed errors returned by the service for each operation.
+var Operations = map[string]openapi.Operation{
+	"GetAllWebhooks": {Summary: "List the webhooks"},
+	"GetWebhookByID": {
+		Summary: "Get webhook by ID",
+		Errors:  []*apperror.Error{ErrWebhookNotFound},
+	},
+	"CreateWebhook": {
+		Summary:       "Register a webhook",
+		RequestSchema: "webhook",
+		SuccessStatus: http.StatusCreated,
+		Errors:        []*apperror.Error{ErrWebhookTarget},
+	},
+	"UpdateWebhook": {
+		Summary:       "Update a webhook",
+		RequestSchema: "webhook",
+		Errors:        []*apperror.Error{ErrWebhookNotFound, ErrWebhookTarget},
+	},
+	"DeleteWebhook": {
+		Summary: "Delete a webhook",
+		Errors:  []*apperror.Error{ErrWebhookNotFound},
+	},
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Interface for webhook repository
+// This interface defines the methods that the webhook repository should implement
+type WebhookRepository interface {
+	GetAllWebhooks(tx *gorm.DB) ([]Webhook, error)
+	GetWebhookByID(tx *gorm.DB, id int64) (Webhook, error)
+	GetActiveWebhooksByEvent(tx *gorm.DB, eventType string) ([]Webhook, error)
+	CreateWebhook(ctx context.Context, tx *gorm.DB, w Webhook) (Webhook, error)
+	UpdateWebhook(ctx context.Context, tx *gorm.DB, w Webhook) (Webhook, error)
+	DeleteWebhook(ctx context.Context, tx *gorm.DB, w Webhook, deletedBy *int64) error
+	CreateDeliveries(ctx context.Context, tx *gorm.DB, deliveries []Delivery) error
+	ClaimDueDeliveries(ctx context.Context, tx *gorm.DB, limit int, maxAttempts int, now time.Time, leaseUntil time.Time) ([]Delivery, error)
+	MarkDelivered(ctx context.Context, tx *gorm.DB, id int64, deliveredAt time.Time) error
+	MarkDeliveryFailed(ctx context.Context, tx *gorm.DB, id int64, lastError string, nextAttemptAt time.Time) error
+}
+
+// This struct defines the WebhookRepository that contains methods for interacting with the database
+// It implements the WebhookRepository interface and provides methods for webhook-related operations
+type webhookRepository struct{}
+
+// NewWebhookRepository creates a new instance of WebhookRepository.
+// It initializes the webhookRepository struct and returns it.
+func NewWebhookRepository() WebhookRepository {
+	return &webhookRepository{}
+}
+
+// GetAllWebhooks retrieves all webhooks from the database.
+func (r *webhookRepository) GetAllWebhooks(tx *gorm.DB) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := tx.Order("id ASC").Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookByID retrieves a webhook by its ID from the database.
+func (r *webhookRepository) GetWebhookByID(tx *gorm.DB, id int64) (Webhook, error) {
+	var webhook Webhook
+	err := tx.First(&webhook, "id = ?", id).Error
+
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return Webhook{}, ErrWebhookNotFound
+	}
+
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// GetActiveWebhooksByEvent retrieves the active webhooks subscribed to the given event type.
+func (r *webhookRepository) GetActiveWebhooksByEvent(tx *gorm.DB, eventType string) ([]Webhook, error) {
+	// Build the JSON array used for the jsonb containment check
+	filter, err := EventTypes{eventType}.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []Webhook
+	err = tx.Where("active = ? AND events @> ?::jsonb", true, filter).Order("id ASC").Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// CreateWebhook inserts a new webhook into the database and returns the created webhook.
+func (r *webhookRepository) CreateWebhook(ctx context.Context, tx *gorm.DB, w Webhook) (Webhook, error) {
+	if err := tx.WithContext(ctx).Create(&w).Error; err != nil {
+		return Webhook{}, err
+	}
+
+	return w, nil
+}
+
+// UpdateWebhook updates an existing webhook in the database and returns the updated webhook.
+func (r *webhookRepository) UpdateWebhook(ctx context.Context, tx *gorm.DB, w Webhook) (Webhook, error) {
+	if err := tx.WithContext(ctx).Save(&w).Error; err != nil {
+		return Webhook{}, err
+	}
+
+	return w, nil
+}
+
+// DeleteWebhook soft deletes a webhook from the database.
+func (r *webhookRepository) DeleteWebhook(ctx context.Context, tx *gorm.DB, w Webhook, deletedBy *int64) error {
+	// Update the deleted_by field to keep track of who deleted the webhook
+	if err := tx.WithContext(ctx).Model(&w).Updates(Webhook{DeletedBy: deletedBy}).Error; err != nil {
+		return err
+	}
+
+	// Delete the webhook from the database
+	if err := tx.WithContext(ctx).Delete(&w).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateDeliveries inserts the deliveries of an event.
+// The deliveries already created for the same webhook and event are skipped, so queuing an event twice
+// does not deliver it twice.
+func (r *webhookRepository) CreateDeliveries(ctx context.Context, tx *gorm.DB, deliveries []Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+// ClaimDueDeliveries retrieves the oldest deliveries due for an attempt, with their webhook, and leases them
+// until leaseUntil: the other workers and instances skip them until then, and they are attempted again
+// if the process stops before recording the result. It must be called inside a transaction.
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, tx *gorm.DB, limit int, maxAttempts int, now time.Time, leaseUntil time.Time) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("delivered_at IS NULL AND attempts < ? AND next_attempt_at <= ?", maxAttempts, now).
+		Order("next_attempt_at ASC, id ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+	}
+
+	// Lease the deliveries
+	err = tx.WithContext(ctx).Model(&Delivery{}).
+		Where("id IN ?", ids).
+		Update("next_attempt_at", leaseUntil).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the webhooks, a deleted webhook is left empty
+	if err := tx.WithContext(ctx).Preload("Webhook").Find(&deliveries, ids).Error; err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered marks a delivery as delivered.
+func (r *webhookRepository) MarkDelivered(ctx context.Context, tx *gorm.DB, id int64, deliveredAt time.Time) error {
+	return tx.WithContext(ctx).Model(&Delivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"delivered_at": deliveredAt,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"last_error":   nil,
+		}).Error
+}
+
+// MarkDeliveryFailed records a failed delivery attempt and schedules the next one.
+func (r *webhookRepository) MarkDeliveryFailed(ctx context.Context, tx *gorm.DB, id int64, lastError string, nextAttemptAt time.Time) error {
+	return tx.WithContext(ctx).Model(&Delivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt,
+		}).Error
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"golang.org/x/time/rate"
+)
+
+// RegisterRoutes registers the webhook management routes under the given group.
+func RegisterRoutes(rg *gin.RouterGroup, deps module.Deps) {
+	// Routes for webhook management
+	// These routes allow admins to register callback URLs notified of department changes
+	webhookGroup := rg.Group("/webhooks")
+	{
+		// Rate limiter middleware for the /webhooks group, accessible only by admin users.
+		// - Allows a burst of up to 5 requests at once.
+		// - Allows 1 request per second continuously after the burst.
+		// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
+		webhookGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 5, 10*time.Minute))
+
+		// Initialize the webhook repository, service and handler
+		repo := NewWebhookRepository()
+		service := NewWebhookService(repo)
+		handler := NewWebhookHandler(service)
+
+		// Define the routes for webhook management
+		webhookGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetAllWebhooks)
+		webhookGroup.GET("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetWebhookByID)
+		webhookGroup.POST("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("webhook"), handler.CreateWebhook)
+		webhookGroup.PUT("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), deps.Validate("webhook"), handler.UpdateWebhook)
+		webhookGroup.DELETE("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.DeleteWebhook)
+	}
+}
@@ -0,0 +1,253 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebhookNotFound = apperror.New("WebhookNotFound", http.StatusNotFound, "webhook with the given ID not found")
+	ErrWebhookTarget   = apperror.New("WebhookTargetNotAllowed", http.StatusUnprocessableEntity, "the webhook URL must be an http or https URL of a public host")
+)
+
+// Interface for webhook service
+// This interface defines the methods that the webhook service should implement
+type WebhookService interface {
+	GetAllWebhooks(ctx context.Context) ([]Webhook, error)
+	GetWebhookByID(ctx context.Context, id int64) (Webhook, error)
+	CreateWebhook(ctx context.Context, webhook Webhook) (Webhook, error)
+	UpdateWebhook(ctx context.Context, id int64, webhook Webhook) (Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) (bool, error)
+}
+
+// This struct defines the WebhookService that contains a repository field of type WebhookRepository
+type webhookService struct {
+	repo WebhookRepository
+}
+
+// NewWebhookService creates a new instance of WebhookService with the given repository.
+// It initializes the webhookService struct and returns it.
+func NewWebhookService(repo WebhookRepository) WebhookService {
+	return &webhookService{repo: repo}
+}
+
+// GetAllWebhooks retrieves all webhooks from the database.
+// The signing secrets are never returned once the webhook has been created.
+func (s *webhookService) GetAllWebhooks(ctx context.Context) ([]Webhook, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return nil, errors.New("database connection is nil")
+	}
+
+	// Retrieve all webhooks from the repository
+	webhooks, err := s.repo.GetAllWebhooks(db)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get all webhooks: %v", err))
+		return nil, err
+	}
+
+	// Hide the signing secrets
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookByID retrieves a webhook by its ID from the database.
+func (s *webhookService) GetWebhookByID(ctx context.Context, id int64) (Webhook, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Webhook{}, errors.New("database connection is nil")
+	}
+
+	// Retrieve the webhook by ID from the repository
+	webhook, err := s.repo.GetWebhookByID(db, id)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to get webhook by ID: %v", err))
+		return Webhook{}, err
+	}
+
+	// Hide the signing secret
+	webhook.Secret = ""
+
+	return webhook, nil
+}
+
+// CreateWebhook registers a new webhook in the database.
+// If no secret is provided, a random one is generated and returned once in the response.
+func (s *webhookService) CreateWebhook(ctx context.Context, w Webhook) (Webhook, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Webhook{}, errors.New("database connection is nil")
+	}
+
+	// Validate the webhook struct using the validator
+	if err := w.Validate(); err != nil {
+		return Webhook{}, err
+	}
+
+	// The events must not be delivered to the internal services
+	if err := ValidateTarget(w.URL); err != nil {
+		return Webhook{}, err
+	}
+
+	// Generate the signing secret if it is not provided
+	if w.Secret == "" {
+		secret, err := GenerateSecret()
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to generate webhook secret: %v", err))
+			return Webhook{}, err
+		}
+		w.Secret = secret
+	}
+
+	var createdWebhook Webhook
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Create the webhook
+		w.ID = 0
+		w.CreatedBy = &meta.UserID
+		w.UpdatedBy = w.CreatedBy
+		created, err := s.repo.CreateWebhook(ctx, tx, w)
+		if err != nil {
+			return err
+		}
+
+		createdWebhook = created
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to create webhook: %v", err))
+		return Webhook{}, err
+	}
+
+	return createdWebhook, nil
+}
+
+// UpdateWebhook updates an existing webhook in the database.
+// The signing secret is only rotated when a new one is provided.
+func (s *webhookService) UpdateWebhook(ctx context.Context, id int64, w Webhook) (Webhook, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return Webhook{}, errors.New("database connection is nil")
+	}
+
+	// Validate the webhook struct using the validator
+	if err := w.Validate(); err != nil {
+		return Webhook{}, err
+	}
+
+	// The events must not be delivered to the internal services
+	if err := ValidateTarget(w.URL); err != nil {
+		return Webhook{}, err
+	}
+
+	var updatedWebhook Webhook
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the webhook exists
+		existingWebhook, err := s.repo.GetWebhookByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Save the updated webhook
+		existingWebhook.URL = w.URL
+		existingWebhook.Events = w.Events
+		existingWebhook.Active = w.Active
+		if w.Secret != "" {
+			existingWebhook.Secret = w.Secret
+		}
+		existingWebhook.UpdatedBy = &meta.UserID
+		updatedWebhook, err = s.repo.UpdateWebhook(ctx, tx, existingWebhook)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to update webhook: %v", err))
+		return Webhook{}, err
+	}
+
+	// Hide the signing secret
+	updatedWebhook.Secret = ""
+
+	return updatedWebhook, nil
+}
+
+// DeleteWebhook deletes a webhook by its ID from the database.
+func (s *webhookService) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	// Get the database connection from the context
+	db := dbcontext.GetDB(ctx)
+	if db == nil {
+		logger.Error("database connection is nil")
+		return false, errors.New("database connection is nil")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Check if the webhook exists
+		existingWebhook, err := s.repo.GetWebhookByID(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.ExtractRequestMeta(ctx)
+		if !ok {
+			return errors.New("missing user context")
+		}
+
+		// Delete the webhook
+		return s.repo.DeleteWebhook(ctx, tx, existingWebhook, &meta.UserID)
+	})
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to delete webhook: %v", err))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GenerateSecret generates a random secret used to sign the webhook payloads.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
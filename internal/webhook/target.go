@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ValidateTarget checks the URL of a webhook: it must be an http(s) URL whose host is not an address of the
+// private network, e.g. the loopback (such as the admin listener), the link-local addresses (such as the cloud
+// metadata endpoints) or the private ranges. The hosts of WEBHOOK_ALLOWED_HOSTS are allowed anyway.
+// The host names are resolved when the events are delivered, the dialer refuses them then (see dialControl).
+func ValidateTarget(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrWebhookTarget
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if allowedHost(host) {
+		return nil
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookTarget
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return ErrWebhookTarget
+	}
+
+	return nil
+}
+
+// allowedHost reports whether the host is listed in WEBHOOK_ALLOWED_HOSTS.
+func allowedHost(host string) bool {
+	for _, h := range strings.Split(WebhookAllowedHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" && strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publicIP reports whether the address can be reached by the webhooks.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// dialControl refuses the connections of the deliveries to the addresses of the private network,
+// once the host name of the webhook is resolved, so a name pointing to such an address is refused too.
+func dialControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("webhook target %s is not a public address", host)
+	}
+
+	return nil
+}
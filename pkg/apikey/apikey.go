@@ -0,0 +1,152 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Package apikey authenticates the automation identities (e.g. Terraform or provisioning scripts)
+// with API keys sent in the X-API-Key header.
+// The keys themselves are never stored: the identities file holds the SHA-256 digest of each key.
+// The keys missing from the file are checked by the registered resolvers, e.g. against the keys issued to the service accounts.
+
+// Header is the request header carrying the API key.
+const Header = "X-API-Key"
+
+// Identity represents an automation identity authenticated with an API key.
+// KeySHA256 is the hex-encoded SHA-256 digest of the key (e.g. `printf %s "$KEY" | sha256sum`).
+// Departments is the department scope of the service accounts, nil for the identities writing every department.
+type Identity struct {
+	Name        string   `json:"name"`
+	UserID      int64    `json:"userId"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	KeySHA256   string   `json:"keySha256"`
+	Departments []string `json:"departments,omitempty"`
+}
+
+// Resolver finds the identity of an API key missing from the identities file.
+// It reports false for the keys it does not know, and an error when it cannot check them.
+type Resolver func(ctx context.Context, key string) (Identity, bool, error)
+
+var (
+	APIKeysFile string
+
+	mu         sync.RWMutex
+	identities []Identity
+	resolvers  []Resolver
+)
+
+// LoadEnv loads environment variables
+// The API key authentication is disabled when API_KEYS_FILE is not set.
+func LoadEnv() {
+	APIKeysFile = os.Getenv("API_KEYS_FILE")
+}
+
+// LoadIdentities loads the automation identities from a JSON file.
+// The file contains an array of identities.
+func LoadIdentities(path string) error {
+	if path == "" {
+		return errors.New("API_KEYS_FILE environment variable is not set")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read API keys file: %v", err)
+	}
+
+	var loaded []Identity
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to parse API keys file: %v", err)
+	}
+
+	for _, identity := range loaded {
+		if identity.Name == "" {
+			return errors.New("API keys file contains an identity without a name")
+		}
+		if digest, err := hex.DecodeString(identity.KeySHA256); err != nil || len(digest) != sha256.Size {
+			return fmt.Errorf("keySha256 of identity %s must be a hex-encoded SHA-256 digest", identity.Name)
+		}
+	}
+
+	SetIdentities(loaded)
+	return nil
+}
+
+// SetIdentities replaces the automation identities.
+func SetIdentities(loaded []Identity) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	identities = loaded
+}
+
+// RegisterResolver registers a resolver checking the API keys missing from the identities file.
+func RegisterResolver(r Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resolvers = append(resolvers, r)
+}
+
+// SetResolvers replaces the registered resolvers.
+func SetResolvers(r ...Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resolvers = r
+}
+
+// HashKey returns the hex-encoded SHA-256 digest of an API key, as stored in the identities file.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolve finds the automation identity of the given API key.
+// The digests are compared in constant time.
+func Resolve(key string) (Identity, bool) {
+	if key == "" {
+		return Identity{}, false
+	}
+	digest := []byte(HashKey(key))
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, identity := range identities {
+		if subtle.ConstantTimeCompare(digest, []byte(strings.ToLower(identity.KeySHA256))) == 1 {
+			return identity, true
+		}
+	}
+
+	return Identity{}, false
+}
+
+// Authenticate finds the identity of the given API key in the identities file, then with the registered resolvers.
+func Authenticate(ctx context.Context, key string) (Identity, bool, error) {
+	if identity, ok := Resolve(key); ok || key == "" {
+		return identity, ok, nil
+	}
+
+	mu.RLock()
+	registered := resolvers
+	mu.RUnlock()
+
+	for _, resolve := range registered {
+		identity, ok, err := resolve(ctx, key)
+		if err != nil || ok {
+			return identity, ok, err
+		}
+	}
+
+	return Identity{}, false, nil
+}
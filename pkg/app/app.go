@@ -0,0 +1,459 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+	"github.com/yoanesber/Go-Department-CRUD/config/db/postgresdb"
+	"github.com/yoanesber/Go-Department-CRUD/config/db/redisdb"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/dataredis"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/authmetrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsoncodec"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mtls"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/profiling"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/replica"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/server"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/signing"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/slo"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/storage"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/stream"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+	"gorm.io/gorm"
+)
+
+// Package app runs the API as a library, so other Go programs can embed it, mount it under their own mux
+// (e.g. with http.StripPrefix) or drive it in integration tests. cmd/main.go is a thin wrapper around it.
+// The settings of the packages (JWT, rate limits, modules, ...) are still read from the environment by New.
+
+// Config is the configuration of the servers.
+// DB and Redis are optional: when they are nil, New connects with the DB_* and REDIS_* environment variables.
+type Config struct {
+	Environment string
+	Port        string
+	SSL         bool
+	SSLCert     string
+	SSLKeys     string
+	APIVersion  string
+	AdminHost   string
+	AdminPort   string
+
+	DB    *gorm.DB
+	Redis *redis.Client
+}
+
+// ConfigFromEnv loads the configuration from the environment variables, with the default ports.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Environment: os.Getenv("ENV"),
+		Port:        os.Getenv("PORT"),
+		SSL:         os.Getenv("IS_SSL") == "TRUE",
+		SSLCert:     os.Getenv("SSL_CERT"),
+		SSLKeys:     os.Getenv("SSL_KEYS"),
+		APIVersion:  os.Getenv("API_VERSION"),
+		AdminHost:   os.Getenv("ADMIN_HOST"),
+		AdminPort:   os.Getenv("ADMIN_PORT"),
+	}
+
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+
+	// The admin listener is bound to the loopback interface by default so it is never reachable from the public network
+	if cfg.AdminHost == "" {
+		cfg.AdminHost = "127.0.0.1"
+	}
+	if cfg.AdminPort == "" {
+		cfg.AdminPort = "9090"
+	}
+
+	return cfg
+}
+
+// Server is the API with its public, admin and mTLS servers.
+// The admin and mTLS servers are nil when they are disabled.
+type Server struct {
+	cfg      Config
+	router   *gin.Engine
+	srv      *http.Server
+	adminSrv *http.Server
+	mtlsSrv  *http.Server
+}
+
+// New initializes the application and creates its servers, without listening yet.
+// It returns an error when the configuration is invalid, e.g. an unknown module in MODULES_DISABLED.
+func New(cfg Config) (*Server, error) {
+	logger.InitLoggers()
+
+	// Set the Gin mode based on the environment
+	gin.SetMode(gin.DebugMode)
+	if cfg.Environment == "PRODUCTION" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Refuse to start a replica whose configuration relies on instance-local state
+	replica.LoadEnv()
+	if err := replica.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Load the modules disabled for this deployment, before the jobs and the routes are set up
+	module.LoadEnv()
+	if err := module.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Load the maximum counts of the entities, so a typo does not disable a quota
+	quota.LoadEnv()
+	if err := quota.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Load the custom roles, so a typo does not create a role
+	role.LoadEnv()
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Load the permissions of the roles, if configured, the built-in roles have a default mapping
+	permission.LoadEnv()
+	if permission.PermissionsFile != "" {
+		if err := permission.LoadFile(permission.PermissionsFile); err != nil {
+			return nil, fmt.Errorf("failed to load role permissions: %v", err)
+		}
+	}
+
+	// Use the shared (Redis) rate limiter when configured, before the routes set up their limiters
+	ratelimiter.LoadEnv()
+
+	// Load the page size limits of the listings
+	pagination.LoadEnv()
+
+	// Load the health check configuration before the modules register their checkers
+	health.LoadEnv()
+
+	// Report the application as not ready once a drain starts, the dispatchers register their pending work
+	drain.LoadEnv()
+	drain.Init()
+
+	// Use the given database, or connect to PostgreSQL using the configuration from the .env file
+	if cfg.DB != nil {
+		postgresdb.SetDB(cfg.DB)
+	} else {
+		postgresdb.LoadEnv()
+		postgresdb.InitDB()
+
+		// Create the built-in and custom roles missing from the database, so the users can be created without the seed file
+		role.InitRoles(postgresdb.GetDB())
+	}
+
+	// Load the statement timeouts bounding the database statements of the requests and the jobs
+	dbtimeout.LoadEnv()
+
+	// Initialize the domain event publisher (e.g. Kafka) using the configuration from the .env file
+	event.LoadEnv()
+	event.InitPublisher()
+
+	// Initialize the mailer sending the e-mails (e.g. the password reset links)
+	mailer.LoadEnv()
+	mailer.InitMailer()
+
+	// Start the outbox dispatcher forwarding the committed domain events
+	outbox.LoadEnv()
+	outbox.InitDispatcher(postgresdb.GetDB())
+
+	// Start the webhook dispatcher delivering department events asynchronously
+	if module.Enabled(module.Webhooks) {
+		webhook.LoadEnv()
+		webhook.InitDispatcher(postgresdb.GetDB())
+	}
+
+	// Load the cache configuration (the caches are stored in Redis)
+	cache.LoadEnv()
+
+	// Load the self-registration switch before the Redis check, the pending registrations are stored in Redis
+	auth.LoadEnv()
+
+	// Load the minimum token version before the Redis check, it is enforced through Redis
+	tokenversion.LoadEnv()
+
+	// Load the throttle of the failed logins per username before the Redis check, the failures are counted in Redis
+	loginthrottle.LoadEnv()
+
+	// Use the given Redis client, or connect to Redis using the configuration from the .env file
+	// A minimal deployment whose enabled features do not use Redis runs without it
+	if cfg.Redis != nil || redisRequired() {
+		if cfg.Redis != nil {
+			redisdb.SetRedisClient(cfg.Redis)
+		} else {
+			redisdb.LoadEnv()
+			redisdb.InitRedis()
+		}
+
+		// Initialize the global token version and subscribe to its changes through Redis
+		// The application does not start with an unknown version, it would accept the tokens of a bumped one
+		if err := tokenversion.InitTokenVersion(redisdb.GetRedisClient()); err != nil {
+			return nil, fmt.Errorf("failed to initialize token version: %v", err)
+		}
+
+		// Initialize the read-only maintenance mode and follow its changes through Redis
+		maintenance.InitMaintenance(redisdb.GetRedisClient())
+
+		// Re-warm the critical cache entries (public department listing, role map) when they expire
+		readDB := dbtimeout.WithStatementTimeout(postgresdb.GetDB(), dbtimeout.Read)
+		department.RegisterCacheWarmers(readDB)
+		role.RegisterCacheWarmers(readDB)
+		cache.InitExpiryConsumer(redisdb.GetRedisClient())
+	} else {
+		logger.Info("Running without Redis, none of the enabled features uses it")
+	}
+
+	// Start the queue of the background jobs (e.g. the bulk deletes), storing their progress in Redis when available
+	jobs.LoadEnv()
+	jobs.Init(redisdb.GetRedisClient())
+
+	// Initialize the response signer used by the high-integrity endpoints
+	signing.LoadEnv()
+	signing.InitSigner()
+
+	// Report the JSON encoder selected by the build tags (see pkg/jsoncodec)
+	logger.Info(fmt.Sprintf("Encoding JSON with %s", jsoncodec.Name()))
+
+	// Load the directory of the profiles captured from the admin listener
+	profiling.LoadEnv()
+
+	// Initialize the registry of the streaming connections receiving the domain events
+	stream.Init()
+
+	// Initialize the validator for request validation
+	validator.LoadEnv()
+	validator.InitValidator()
+
+	// Load the automation identities authenticated with an API key, if configured
+	apikey.LoadEnv()
+	if apikey.APIKeysFile != "" {
+		if err := apikey.LoadIdentities(apikey.APIKeysFile); err != nil {
+			return nil, fmt.Errorf("failed to load API keys: %v", err)
+		}
+	}
+
+	// Initialize the CAPTCHA check of the anonymous forms, if configured
+	captcha.LoadEnv()
+	captcha.InitVerifier()
+
+	// Load the delivery of the tokens, in the body or in cookies
+	tokencookie.LoadEnv()
+
+	// Load the latency budgets of the routes, if configured, and register their SLO metrics
+	slo.LoadEnv()
+	slo.Init()
+	if slo.BudgetsFile != "" {
+		if err := slo.LoadBudgets(slo.BudgetsFile); err != nil {
+			return nil, fmt.Errorf("failed to load latency budgets: %v", err)
+		}
+	}
+
+	// Register the middleware timing metrics, and return the times in the Server-Timing header if enabled
+	timing.LoadEnv()
+	timing.Init()
+
+	// Load the public department directory and managed department configuration before the routes are set up
+	department.LoadEnv()
+
+	// Start the job repairing the drifted employee counts of the departments
+	department.InitReconciler(dbtimeout.WithStatementTimeout(postgresdb.GetDB(), dbtimeout.Import))
+
+	// Load the cost of the password hashes, the maximum size of the avatars and the validity of the API keys
+	user.LoadEnv()
+
+	// Start the job expiring the accounts and the credentials whose expiration date has passed
+	user.InitExpirationJob(dbtimeout.WithStatementTimeout(postgresdb.GetDB(), dbtimeout.Import), redisdb.GetRedisClient())
+
+	// Register the authentication metrics, and start the job counting the active sessions and logging their summary
+	authmetrics.LoadEnv()
+	authmetrics.Init()
+	auth.InitMetricsJob(dbtimeout.WithStatementTimeout(postgresdb.GetDB(), dbtimeout.Read))
+
+	// Authenticate the service accounts with the API keys issued to them, after the keys of the identities file
+	apikey.SetResolvers(user.NewUserService(user.NewUserRepository()).ResolveAPIKey)
+
+	// Load the timeout of the Redis reads of the dataredis module
+	dataredis.LoadEnv()
+
+	// Initialize the storage of the uploaded files (e.g. the user avatars) before the routes are set up
+	storage.LoadEnv()
+	storage.InitStorage()
+
+	// Load the listener and HTTP server configuration (network, timeouts, header size)
+	server.LoadEnv()
+
+	s := &Server{cfg: cfg}
+
+	// Set up Gin server with middleware and routes
+	// The trusted proxies are reset so the X-Forwarded-For header is not trusted for client IP detection
+	s.router = routes.SetupRouter()
+	s.router.SetTrustedProxies(nil)
+
+	// The server timeouts apply to both TLS and non-TLS modes
+	// The event streams are notified and closed first, otherwise the shutdown would wait for them until its timeout
+	s.srv = server.NewHTTPServer(s.router)
+	s.srv.RegisterOnShutdown(stream.CloseAll)
+
+	// Create the internal admin listener (metrics, debug and admin endpoints) unless the admin module is disabled
+	if module.Enabled(module.Admin) {
+		adminRouter := routes.SetupAdminRouter()
+		adminRouter.SetTrustedProxies(nil)
+
+		s.adminSrv = server.NewHTTPServer(adminRouter)
+		s.adminSrv.Addr = cfg.AdminHost + ":" + cfg.AdminPort
+	}
+
+	// Create the mTLS listener for internal service callers if enabled
+	// Callers authenticate with a client certificate mapped to a service account instead of a JWT
+	mtls.LoadEnv()
+	if mtls.MTLSEnabled == "TRUE" {
+		if mtls.MTLSPort == "" {
+			mtls.MTLSPort = "8443"
+		}
+
+		tlsConfig, err := mtls.NewServerTLSConfig(mtls.MTLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure mTLS: %v", err)
+		}
+
+		if err := mtls.LoadServiceAccounts(mtls.MTLSServiceAccountsFile); err != nil {
+			return nil, fmt.Errorf("failed to load mTLS service accounts: %v", err)
+		}
+
+		mtlsRouter := routes.SetupMTLSRouter()
+		mtlsRouter.SetTrustedProxies(nil)
+
+		s.mtlsSrv = server.NewHTTPServer(mtlsRouter)
+		s.mtlsSrv.Addr = mtls.MTLSHost + ":" + mtls.MTLSPort
+		s.mtlsSrv.TLSConfig = tlsConfig
+		s.mtlsSrv.RegisterOnShutdown(stream.CloseAll)
+	}
+
+	return s, nil
+}
+
+// Handler returns the handler of the public API, e.g. to mount it under the mux of another program
+// or to serve it with httptest. The admin and mTLS routes are not part of it.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Start starts the admin and mTLS servers in the background and serves the public API until it is shut down.
+// Like http.Server.Serve it blocks, and it returns nil once Shutdown is called.
+func (s *Server) Start() error {
+	if s.adminSrv != nil {
+		logger.Info("Starting admin server on : ", log.Fields{
+			"host": s.cfg.AdminHost,
+			"port": s.cfg.AdminPort,
+		})
+
+		go func() {
+			if err := s.adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(fmt.Sprintf("Failed to start admin server: %v", err))
+			}
+		}()
+	}
+
+	if s.mtlsSrv != nil {
+		logger.Info("Starting mTLS server on : ", log.Fields{
+			"host": mtls.MTLSHost,
+			"port": mtls.MTLSPort,
+		})
+
+		go func() {
+			if err := s.mtlsSrv.ListenAndServeTLS(s.cfg.SSLCert, s.cfg.SSLKeys); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(fmt.Sprintf("Failed to start mTLS server: %v", err))
+			}
+		}()
+	}
+
+	// Create the listener for the public API (TCP port, Unix socket or systemd socket)
+	listener, err := server.Listen(s.cfg.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create listener: %v", err)
+	}
+
+	// Log the server start information
+	logger.Info("Starting server on : ", log.Fields{
+		"address": listener.Addr().String(),
+		"network": listener.Addr().Network(),
+		"env":     s.cfg.Environment,
+		"ssl":     s.cfg.SSL,
+		"version": s.cfg.APIVersion,
+	})
+
+	// Start the server with or without SSL
+	if s.cfg.SSL {
+		//Generated using sh generate-certificate.sh
+		err = s.srv.ServeTLS(listener, s.cfg.SSLCert, s.cfg.SSLKeys)
+	} else {
+		err = s.srv.Serve(listener)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown drains the application and shuts its servers down (see server.Shutdown).
+// It returns the error of the context when its deadline is reached before the end of the drain.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return server.Shutdown(ctx, s.adminSrv, s.srv, s.mtlsSrv)
+}
+
+// redisRequired reports whether one of the enabled features stores its data in Redis.
+// The admin endpoints change the token version and the maintenance mode, which are distributed through Redis,
+// and so is the minimum token version of TOKEN_VERSION. The failed logins are throttled in Redis, unless the
+// throttle is disabled with LOGIN_THROTTLE_MAX_FAILURES=0.
+// The revocation of the tokens is not a reason to connect Redis, every deployment revokes them so a minimal
+// deployment could never run without it: without Redis the access tokens are not cached and the tokens of the
+// disabled users, of the revoked sessions and of the reset passwords stay valid until they expire (fail open).
+func redisRequired() bool {
+	return module.Enabled(module.DataRedis) ||
+		module.Enabled(module.Admin) ||
+		tokenversion.Enabled() ||
+		loginthrottle.Enabled() ||
+		module.Enabled(module.PasswordReset) ||
+		auth.RegistrationEnabled() ||
+		cache.Enabled() ||
+		ratelimiter.RateLimiterBackend == ratelimiter.BackendRedis
+}
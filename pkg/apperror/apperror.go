@@ -0,0 +1,70 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Package apperror provides the typed errors returned by the services.
+// Each error has a stable code and the HTTP status it is surfaced with, and is registered in a catalog
+// from which the OpenAPI spec documents the error responses. The handlers, the spec and the actual
+// responses therefore share a single source of truth.
+
+// Error is a typed application error.
+// Errors are declared once as package-level variables and compared with errors.Is.
+type Error struct {
+	Code    string `json:"code"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+var (
+	mu      sync.RWMutex
+	catalog = map[string]*Error{}
+)
+
+// New declares a typed error and registers it in the catalog.
+// It panics if the code is already registered, which only happens on programming errors.
+func New(code string, status int, message string) *Error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := catalog[code]; ok {
+		panic(fmt.Sprintf("apperror: duplicate error code %s", code))
+	}
+
+	e := &Error{Code: code, Status: status, Message: message}
+	catalog[code] = e
+	return e
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// As returns the typed error in the chain of err, if any.
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+
+	return nil, false
+}
+
+// Catalog returns the registered errors sorted by code.
+func Catalog() []*Error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	errs := make([]*Error, 0, len(catalog))
+	for _, e := range catalog {
+		errs = append(errs, e)
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Code < errs[j].Code })
+
+	return errs
+}
@@ -0,0 +1,146 @@
+package authmetrics
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+)
+
+// Package authmetrics counts the authentication events, so the health of the logins can be watched and alerted on:
+// the logins by method and by failure reason, the token refreshes, the revocations and the active sessions.
+// The counters are exposed in the Prometheus registry, and the numbers since the previous summary are logged
+// periodically (see TakeSummary), for the deployments without a Prometheus server.
+
+// defaultSummaryInterval is the interval of the summaries when AUTH_METRICS_INTERVAL_MINUTES is not set.
+const defaultSummaryInterval = 15 * time.Minute
+
+// The results of the logins and the refreshes
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// The scopes of the revocations
+const (
+	RevokedSession = "session"
+	RevokedUser    = "user"
+	RevokedToken   = "token"
+)
+
+var (
+	SummaryInterval = defaultSummaryInterval
+
+	initOnce sync.Once
+
+	mu      sync.Mutex
+	current Summary
+
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Total number of logins by method, result and failure reason.",
+	}, []string{"method", "result", "reason"})
+	refreshesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_refreshes_total",
+		Help: "Total number of token refreshes by result and failure reason.",
+	}, []string{"result", "reason"})
+	revocationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_revocations_total",
+		Help: "Total number of revocations by scope: a session, every session of a user or a single access token.",
+	}, []string{"scope"})
+	activeSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "auth_active_sessions",
+		Help: "Number of sessions whose refresh token has not expired, as of the last count.",
+	})
+)
+
+// Summary holds the numbers of the authentication events since the previous summary.
+type Summary struct {
+	Logins          int64
+	FailedLogins    int64
+	FailureReasons  map[string]int64
+	Refreshes       int64
+	FailedRefreshes int64
+	Revocations     int64
+}
+
+// LoadEnv loads environment variables
+// AUTH_METRICS_INTERVAL_MINUTES is the interval of the summaries logged and of the count of the active sessions,
+// 0 disables them. The counters are exposed in the Prometheus registry anyway.
+func LoadEnv() {
+	SummaryInterval = defaultSummaryInterval
+	if n, err := strconv.Atoi(os.Getenv("AUTH_METRICS_INTERVAL_MINUTES")); err == nil && n >= 0 {
+		SummaryInterval = time.Duration(n) * time.Minute
+	}
+}
+
+// Init registers the authentication metrics. It is safe to call it several times.
+func Init() {
+	initOnce.Do(func() {
+		metrics.MustRegister(loginsTotal, refreshesTotal, revocationsTotal, activeSessions)
+	})
+}
+
+// ObserveLogin counts a login with the given method, failed for the given reason, or successful when it is empty.
+// The reasons must come from a small set, e.g. the codes of the typed errors, since each one is a time series.
+func ObserveLogin(method string, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current.Logins++
+	if reason == "" {
+		loginsTotal.WithLabelValues(method, ResultSuccess, "").Inc()
+		return
+	}
+
+	loginsTotal.WithLabelValues(method, ResultFailure, reason).Inc()
+	current.FailedLogins++
+	if current.FailureReasons == nil {
+		current.FailureReasons = map[string]int64{}
+	}
+	current.FailureReasons[reason]++
+}
+
+// ObserveRefresh counts a token refresh, failed for the given reason, or successful when it is empty.
+func ObserveRefresh(reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current.Refreshes++
+	if reason == "" {
+		refreshesTotal.WithLabelValues(ResultSuccess, "").Inc()
+		return
+	}
+
+	refreshesTotal.WithLabelValues(ResultFailure, reason).Inc()
+	current.FailedRefreshes++
+}
+
+// ObserveRevocation counts a revocation of the given scope.
+func ObserveRevocation(scope string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	revocationsTotal.WithLabelValues(scope).Inc()
+	current.Revocations++
+}
+
+// SetActiveSessions sets the number of active sessions, counted in the database.
+func SetActiveSessions(n int64) {
+	activeSessions.Set(float64(n))
+}
+
+// TakeSummary returns the numbers since the previous summary and starts a new one.
+// The Prometheus counters are not reset.
+func TakeSummary() Summary {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s := current
+	current = Summary{}
+
+	return s
+}
@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsoncodec"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package cache provides named read-through caches stored in Redis.
+// The Redis client is taken from the request context, like the other Redis users, and the entries
+// are shared by all the instances so an invalidation on one instance applies everywhere.
+// Caching is skipped (always a miss) when no Redis client is available.
+
+// keyPrefix is the prefix of all the cache keys in Redis.
+const keyPrefix = "cache:"
+
+// memorySampleSize is the number of keys measured with MEMORY USAGE to estimate the memory of a cache.
+const memorySampleSize = 50
+
+// globEscaper escapes the glob characters of a key prefix in the SCAN patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// defaultTTL is the time to live of the entries when CACHE_TTL_SECONDS is not set.
+const defaultTTL = 5 * time.Minute
+
+var (
+	CacheEnabled        string
+	CacheTTLSeconds     string
+	CacheRewarmOnExpiry string
+
+	enabled = true
+	ttl     = defaultTTL
+	rewarm  = false
+
+	mu     sync.RWMutex
+	caches = map[string]*Cache{}
+)
+
+// LoadEnv loads environment variables
+// The caches are enabled unless CACHE_ENABLED is set to FALSE.
+// The entries with a warmer are re-warmed when they expire if CACHE_REWARM_ON_EXPIRY is set to TRUE (see InitExpiryConsumer).
+func LoadEnv() {
+	CacheEnabled = os.Getenv("CACHE_ENABLED")
+	CacheTTLSeconds = os.Getenv("CACHE_TTL_SECONDS")
+	CacheRewarmOnExpiry = os.Getenv("CACHE_REWARM_ON_EXPIRY")
+
+	enabled = !strings.EqualFold(CacheEnabled, "FALSE")
+	rewarm = strings.EqualFold(CacheRewarmOnExpiry, "TRUE")
+	ttl = defaultTTL
+	if n, err := strconv.Atoi(CacheTTLSeconds); err == nil && n > 0 {
+		ttl = time.Duration(n) * time.Second
+	}
+}
+
+// Enabled reports whether the caches are enabled, they need Redis.
+func Enabled() bool {
+	return enabled
+}
+
+// Stats represents the statistics of a cache.
+// Hits and misses are counted by this instance since its start, the keys and memory are read from Redis.
+type Stats struct {
+	Name                string  `json:"name"`
+	Hits                int64   `json:"hits"`
+	Misses              int64   `json:"misses"`
+	HitRatio            float64 `json:"hitRatio"`
+	Keys                int64   `json:"keys"`
+	MemoryBytesEstimate int64   `json:"memoryBytesEstimate"`
+}
+
+// Store is the interface of the caches used by the services.
+// It is implemented by Cache; services take it as an option so tests can inject an in-memory fake.
+type Store interface {
+	Load(ctx context.Context, key string, dest any) bool
+	Store(ctx context.Context, key string, value any)
+	Delete(ctx context.Context, key string)
+}
+
+// Cache is a named cache of JSON values.
+type Cache struct {
+	name   string
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// New creates a named cache and registers it for the inspection endpoints.
+// It returns the already registered cache if the name is taken.
+func New(name string) *Cache {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c, ok := caches[name]; ok {
+		return c
+	}
+
+	c := &Cache{name: name}
+	caches[name] = c
+	return c
+}
+
+// Get returns the registered cache with the given name.
+func Get(name string) (*Cache, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := caches[name]
+	return c, ok
+}
+
+// All returns the registered caches sorted by name.
+func All() []*Cache {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	all := make([]*Cache, 0, len(caches))
+	for _, c := range caches {
+		all = append(all, c)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	return all
+}
+
+// Name returns the name of the cache.
+func (c *Cache) Name() string {
+	return c.name
+}
+
+// key returns the Redis key of an entry.
+func (c *Cache) key(key string) string {
+	return keyPrefix + c.name + ":" + key
+}
+
+// client returns the Redis client of the context, or nil when caching is not possible.
+func (c *Cache) client(ctx context.Context) *redis.Client {
+	if !enabled {
+		return nil
+	}
+
+	return dbcontext.GetRedisClient(ctx)
+}
+
+// Load reads an entry into dest and reports whether it was found.
+// Redis errors are logged and reported as a miss, so a cache failure never fails the request.
+func (c *Cache) Load(ctx context.Context, key string, dest any) bool {
+	client := c.client(ctx)
+	if client == nil {
+		return false
+	}
+
+	data, err := client.Get(ctx, c.key(key)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Error(fmt.Sprintf("failed to read cache %s: %v", c.name, err))
+		}
+		c.misses.Add(1)
+		return false
+	}
+
+	if err := jsoncodec.Unmarshal(data, dest); err != nil {
+		logger.Error(fmt.Sprintf("failed to decode cache %s entry %s: %v", c.name, key, err))
+		c.misses.Add(1)
+		return false
+	}
+
+	c.hits.Add(1)
+	return true
+}
+
+// Store writes an entry with the configured time to live.
+func (c *Cache) Store(ctx context.Context, key string, value any) {
+	client := c.client(ctx)
+	if client == nil {
+		return
+	}
+
+	data, err := jsoncodec.Marshal(value)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to encode cache %s entry %s: %v", c.name, key, err))
+		return
+	}
+
+	if err := client.Set(ctx, c.key(key), data, ttl).Err(); err != nil {
+		logger.Error(fmt.Sprintf("failed to write cache %s: %v", c.name, err))
+	}
+}
+
+// Delete removes an entry, e.g. after the cached entity is modified.
+// It is called even when caching is disabled on this instance, since other instances may have cached the entry.
+func (c *Cache) Delete(ctx context.Context, key string) {
+	client := dbcontext.GetRedisClient(ctx)
+	if client == nil {
+		return
+	}
+
+	if err := client.Del(ctx, c.key(key)).Err(); err != nil {
+		logger.Error(fmt.Sprintf("failed to delete cache %s entry %s: %v", c.name, key, err))
+	}
+}
+
+// InvalidatePrefix removes the entries whose key starts with the given prefix, or all entries if it is empty.
+// It returns the number of entries removed.
+func (c *Cache) InvalidatePrefix(ctx context.Context, client *redis.Client, prefix string) (int64, error) {
+	var removed int64
+	err := c.scan(ctx, client, prefix, func(keys []string) error {
+		n, err := client.Del(ctx, keys...).Result()
+		removed += n
+		return err
+	})
+
+	return removed, err
+}
+
+// Stats returns the statistics of the cache.
+// The memory is estimated from the MEMORY USAGE of a sample of keys.
+func (c *Cache) Stats(ctx context.Context, client *redis.Client) (Stats, error) {
+	stats := Stats{
+		Name:   c.name,
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+
+	var sampled, sampledBytes int64
+	err := c.scan(ctx, client, "", func(keys []string) error {
+		stats.Keys += int64(len(keys))
+		for _, key := range keys {
+			if sampled >= memorySampleSize {
+				break
+			}
+			n, err := client.MemoryUsage(ctx, key).Result()
+			if err != nil {
+				continue
+			}
+			sampled++
+			sampledBytes += n
+		}
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	if sampled > 0 {
+		stats.MemoryBytesEstimate = sampledBytes / sampled * stats.Keys
+	}
+
+	return stats, nil
+}
+
+// scan iterates over the keys of the cache starting with the given prefix, in batches.
+func (c *Cache) scan(ctx context.Context, client *redis.Client, prefix string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, globEscaper.Replace(c.key(prefix))+"*", 500).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// The critical entries (e.g. the public department listing and the role map) are re-warmed as soon as they expire,
+// instead of on the next read, so the hot data stays resident in Redis. The expirations are received
+// from the keyspace notifications of Redis, which every instance subscribes to; a short lock in Redis
+// lets a single instance reload each expired entry.
+
+const (
+	// warmLockPrefix is the prefix of the locks taken by the instance re-warming an expired entry.
+	warmLockPrefix = "cache-warm:"
+
+	// warmLockTTL is the time to live of the re-warm locks, the other instances skip the entry meanwhile.
+	warmLockTTL = 30 * time.Second
+
+	// warmTimeout bounds the reload of an expired entry.
+	warmTimeout = 30 * time.Second
+)
+
+// WarmFunc loads the value of a cache entry, e.g. from the database.
+type WarmFunc func(ctx context.Context) (any, error)
+
+// warmer is the function re-warming an entry of a cache.
+type warmer struct {
+	cache *Cache
+	key   string
+	load  WarmFunc
+}
+
+var (
+	warmersMu sync.RWMutex
+	warmers   = map[string]warmer{}
+)
+
+// Warm registers the function reloading the entry when it expires.
+// A registered function replaces the previous one of the entry.
+func (c *Cache) Warm(key string, load WarmFunc) {
+	warmersMu.Lock()
+	defer warmersMu.Unlock()
+
+	warmers[c.key(key)] = warmer{cache: c, key: key, load: load}
+}
+
+// InitExpiryConsumer subscribes to the expirations of the keys and re-warms the entries with a warmer.
+// It is disabled unless CACHE_REWARM_ON_EXPIRY is set to TRUE. The expiry notifications are enabled
+// on the Redis server if needed, a server refusing CONFIG (e.g. a managed one) must enable them itself.
+func InitExpiryConsumer(client *redis.Client) {
+	if !rewarm || !enabled {
+		logger.Info("Cache re-warm on expiry is disabled")
+		return
+	}
+	if client == nil {
+		logger.Error("Failed to start the cache expiry consumer: redis client is nil")
+		return
+	}
+
+	ctx := context.Background()
+	if err := enableExpiryNotifications(ctx, client); err != nil {
+		logger.Warn(fmt.Sprintf("failed to enable the expiry notifications of Redis, set notify-keyspace-events to Ex: %v", err))
+	}
+
+	channel := fmt.Sprintf("__keyevent@%d__:expired", client.Options().DB)
+	pubsub := client.Subscribe(ctx, channel)
+	go func() {
+		defer pubsub.Close()
+
+		for msg := range pubsub.Channel() {
+			HandleExpired(ctx, client, msg.Payload)
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("Cache expiry consumer subscribed to %s", channel))
+}
+
+// HandleExpired re-warms the entry of an expired Redis key, if the entry has a warmer.
+// It reports whether the entry was reloaded by this instance.
+func HandleExpired(ctx context.Context, client *redis.Client, redisKey string) bool {
+	if !strings.HasPrefix(redisKey, keyPrefix) {
+		return false
+	}
+
+	warmersMu.RLock()
+	w, ok := warmers[redisKey]
+	warmersMu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(dbcontext.InjectRedisClient(ctx, client), warmTimeout)
+	defer cancel()
+
+	// The other instances received the same notification, the first one to take the lock reloads the entry
+	acquired, err := client.SetNX(ctx, warmLockPrefix+redisKey, 1, warmLockTTL).Result()
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to lock the re-warm of cache %s entry %s: %v", w.cache.name, w.key, err))
+		return false
+	}
+	if !acquired {
+		return false
+	}
+
+	value, err := w.load(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to re-warm cache %s entry %s: %v", w.cache.name, w.key, err))
+		return false
+	}
+	w.cache.Store(ctx, w.key, value)
+
+	return true
+}
+
+// enableExpiryNotifications adds the expired events to the keyspace notifications of the server,
+// keeping the notifications already enabled.
+func enableExpiryNotifications(ctx context.Context, client *redis.Client) error {
+	config, err := client.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	var flags string
+	if len(config) == 2 {
+		flags, _ = config[1].(string)
+	}
+	if strings.Contains(flags, "E") && (strings.Contains(flags, "x") || strings.Contains(flags, "A")) {
+		return nil
+	}
+
+	return client.ConfigSet(ctx, "notify-keyspace-events", flags+"Ex").Err()
+}
@@ -0,0 +1,218 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package captcha is the hook checking the CAPTCHA answers of the anonymous forms (e.g. the self-registration).
+// With CAPTCHA_VERIFY_URL set, the answers are checked with the siteverify API of the provider, shared by
+// reCAPTCHA, hCaptcha and Turnstile: the secret, the answer and the client IP are posted as a form, and the
+// answer is accepted when the JSON response has "success": true. Without it, no answer is required.
+// Another provider is plugged in with SetVerifier.
+// CAPTCHA_ENDPOINTS selects the forms requiring an answer, only the self-registration by default.
+
+// verifyTimeout bounds the call to the siteverify API.
+const verifyTimeout = 10 * time.Second
+
+// Names of the forms the CAPTCHA can be required on, as listed in CAPTCHA_ENDPOINTS
+const (
+	Login          = "login"
+	Register       = "register"
+	ForgotPassword = "forgot-password"
+)
+
+// defaultEndpoints are the forms requiring an answer when CAPTCHA_ENDPOINTS is not set.
+var defaultEndpoints = []string{Register}
+
+// ErrInvalidCaptcha is returned when the CAPTCHA answer is missing or refused by the provider.
+var ErrInvalidCaptcha = apperror.New("InvalidCaptcha", http.StatusBadRequest, "the CAPTCHA answer is missing or invalid")
+
+// Verifier checks a CAPTCHA answer of a client.
+type Verifier interface {
+	Verify(ctx context.Context, answer string, remoteIP string) (bool, error)
+}
+
+// VerifierFunc adapts a function to the Verifier interface.
+type VerifierFunc func(ctx context.Context, answer string, remoteIP string) (bool, error)
+
+// Verify calls the function.
+func (f VerifierFunc) Verify(ctx context.Context, answer string, remoteIP string) (bool, error) {
+	return f(ctx, answer, remoteIP)
+}
+
+var (
+	VerifyURL string
+	Secret    string
+	Endpoints string
+
+	mu        sync.RWMutex
+	verifier  Verifier
+	endpoints = toSet(defaultEndpoints)
+)
+
+// LoadEnv loads environment variables
+// CAPTCHA_VERIFY_URL is the siteverify endpoint of the provider, e.g. https://www.google.com/recaptcha/api/siteverify,
+// and CAPTCHA_SECRET the secret key of the site. The CAPTCHA is disabled when the URL is empty.
+// CAPTCHA_ENDPOINTS is the comma-separated list of the forms requiring an answer (login, register, forgot-password).
+func LoadEnv() {
+	VerifyURL = os.Getenv("CAPTCHA_VERIFY_URL")
+	Secret = os.Getenv("CAPTCHA_SECRET")
+	Endpoints = os.Getenv("CAPTCHA_ENDPOINTS")
+}
+
+// InitVerifier initializes the siteverify verifier when CAPTCHA_VERIFY_URL is set,
+// and the forms requiring an answer from CAPTCHA_ENDPOINTS.
+func InitVerifier() {
+	if Endpoints != "" {
+		SetEndpoints(strings.Split(Endpoints, ",")...)
+	} else {
+		SetEndpoints(defaultEndpoints...)
+	}
+
+	if VerifyURL == "" {
+		SetVerifier(nil)
+		logger.Info("CAPTCHA verification is disabled")
+		return
+	}
+
+	SetVerifier(&SiteVerifier{URL: VerifyURL, Secret: Secret, Client: &http.Client{Timeout: verifyTimeout}})
+	logger.Info("CAPTCHA verification is enabled")
+}
+
+// SetVerifier replaces the verifier, nil disables the CAPTCHA.
+func SetVerifier(v Verifier) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	verifier = v
+}
+
+// SetEndpoints replaces the forms requiring an answer, the unknown names are ignored.
+func SetEndpoints(names ...string) {
+	set := toSet(names)
+	for name := range set {
+		if name != Login && name != Register && name != ForgotPassword {
+			logger.Warn(fmt.Sprintf("unknown CAPTCHA endpoint %q is ignored", name))
+			delete(set, name)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	endpoints = set
+}
+
+// toSet returns the set of the trimmed, lower-cased names, without the empty ones.
+func toSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			set[name] = true
+		}
+	}
+
+	return set
+}
+
+// Enabled reports whether the CAPTCHA answers are checked.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return verifier != nil
+}
+
+// CheckEndpoint checks the CAPTCHA answer of a client on a form, it always succeeds when the form
+// does not require an answer.
+func CheckEndpoint(ctx context.Context, endpoint string, answer string, remoteIP string) error {
+	mu.RLock()
+	required := endpoints[endpoint]
+	mu.RUnlock()
+
+	if !required {
+		return nil
+	}
+
+	return Check(ctx, answer, remoteIP)
+}
+
+// Check checks the CAPTCHA answer of a client, it always succeeds when the CAPTCHA is disabled.
+// A missing or refused answer is reported with ErrInvalidCaptcha, a failing provider with another error.
+func Check(ctx context.Context, answer string, remoteIP string) error {
+	mu.RLock()
+	v := verifier
+	mu.RUnlock()
+
+	if v == nil {
+		return nil
+	}
+	if answer == "" {
+		return ErrInvalidCaptcha
+	}
+
+	ok, err := v.Verify(ctx, answer, remoteIP)
+	if err != nil {
+		return fmt.Errorf("failed to verify the CAPTCHA: %w", err)
+	}
+	if !ok {
+		return ErrInvalidCaptcha
+	}
+
+	return nil
+}
+
+// SiteVerifier checks the answers with a siteverify API.
+type SiteVerifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// Verify posts the answer to the siteverify API and reports whether it was accepted.
+func (s *SiteVerifier) Verify(ctx context.Context, answer string, remoteIP string) (bool, error) {
+	form := url.Values{"secret": {s.Secret}, "response": {answer}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("siteverify answered %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode the siteverify response: %v", err)
+	}
+
+	return result.Success, nil
+}
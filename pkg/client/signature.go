@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/signing"
+)
+
+// Package client provides helpers for Go clients of the Department API.
+
+// DefaultMaxSignatureAge is the default maximum age of a signed response.
+const DefaultMaxSignatureAge = 5 * time.Minute
+
+// VerifyResponseSignature verifies the detached signature of a response returned by a signed endpoint.
+// It reads the body, checks the X-Signature and X-Signature-Timestamp headers against the request method
+// and path, and returns the verified body. The response body is restored so it can still be decoded.
+// A maxAge of zero uses DefaultMaxSignatureAge.
+func VerifyResponseSignature(resp *http.Response, verifier signing.Verifier, maxAge time.Duration) ([]byte, error) {
+	if resp == nil || resp.Request == nil {
+		return nil, errors.New("response or request is nil")
+	}
+
+	// Read the body and restore it for the caller
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Parse the signature headers
+	algorithm, signature, err := signing.ParseSignature(resp.Header.Get(signing.HeaderSignature))
+	if err != nil {
+		return nil, err
+	}
+	if algorithm != verifier.Algorithm() {
+		return nil, fmt.Errorf("unexpected signature algorithm %s", algorithm)
+	}
+
+	timestamp := resp.Header.Get(signing.HeaderSignatureTimestamp)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("missing or malformed signature timestamp")
+	}
+
+	// Reject stale responses so they cannot be replayed
+	if maxAge <= 0 {
+		maxAge = DefaultMaxSignatureAge
+	}
+	age := time.Since(time.Unix(signedAt, 0))
+	if age > maxAge || age < -maxAge {
+		return nil, errors.New("signature timestamp is outside the allowed window")
+	}
+
+	// Verify the signature
+	data := signing.SigningString(timestamp, resp.Request.Method, resp.Request.URL.Path, body)
+	if !verifier.Verify(data, signature) {
+		return nil, errors.New("invalid response signature")
+	}
+
+	return body, nil
+}
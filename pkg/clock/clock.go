@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Package clock abstracts the reading of the current time.
+// Services that compute expirations take a Clock as an option, so tests can inject a fixed or
+// simulated time instead of depending on the wall clock.
+
+// Clock provides the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the clock reading the wall clock, used by default.
+var System Clock = systemClock{}
+
+// systemClock reads the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Fixed returns a clock that always reads the given time.
+func Fixed(t time.Time) Clock {
+	return fixedClock{t: t}
+}
+
+// fixedClock always reads the same time.
+type fixedClock struct {
+	t time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.t }
+
+// Simulated is a clock that only moves when it is set or advanced, used to test the expiry logic.
+// It is safe for concurrent use.
+type Simulated struct {
+	mu sync.RWMutex
+	t  time.Time
+}
+
+// NewSimulated returns a simulated clock reading the given time.
+func NewSimulated(t time.Time) *Simulated {
+	return &Simulated{t: t}
+}
+
+// Now returns the current time of the simulated clock.
+func (c *Simulated) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.t
+}
+
+// Set moves the simulated clock to the given time, possibly backwards.
+func (c *Simulated) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = t
+}
+
+// Advance moves the simulated clock by the given duration and returns the new time.
+// A negative duration moves it backwards, e.g. to simulate the skew between two instances.
+func (c *Simulated) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = c.t.Add(d)
+	return c.t
+}
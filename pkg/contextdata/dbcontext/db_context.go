@@ -19,12 +19,14 @@ func InjectDB(ctx context.Context, db *gorm.DB) context.Context {
 }
 
 // GetDB extracts *gorm.DB from context
+// The session carries the values of the context, so the SQL logger ties the statements to the request,
+// but not its cancellation, so the statements keep their lifetime.
 func GetDB(ctx context.Context) *gorm.DB {
 	db, ok := ctx.Value(dbKey).(*gorm.DB)
-	if !ok {
+	if !ok || db == nil {
 		return nil
 	}
-	return db
+	return db.WithContext(context.WithoutCancel(ctx))
 }
 
 // InjectRedis injects *redis.Client into context
@@ -3,6 +3,11 @@ package metacontext
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
 )
 
 // This struct defines the RequestMeta struct
@@ -13,6 +18,55 @@ type RequestMeta struct {
 	UserName string
 	Email    string
 	Roles    []string
+	// Permissions are the permissions granted by the roles (see pkg/permission), nil when they were not resolved,
+	// e.g. for a context built without the JWT middleware, in which case they are derived from the roles.
+	Permissions []string
+	// Automation is set for the automation identities authenticated with an API key,
+	// whose UserName is the name of the identity, and for the OAuth2 clients, whose UserName is the client ID.
+	Automation bool
+	// DepartmentScoped is set for the service accounts, which can only write the departments of DepartmentScope.
+	DepartmentScoped bool
+	DepartmentScope  []string
+	// SessionID is the ID of the session the access token was issued for, empty for the other identities.
+	SessionID string
+	// AuthTime is the time of the login that started the session, zero for the other identities and the older tokens.
+	AuthTime time.Time
+	// RememberMe is set for the access tokens of a remembered session, which lives longer than the other sessions.
+	RememberMe bool
+	// TokenID is the ID of the access token, its jti claim, empty for the other identities and the older tokens.
+	TokenID string
+	// TokenExpiresAt is the expiration of the access token, zero for the other identities.
+	TokenExpiresAt time.Time
+	// ImpersonatedBy is the ID of the admin acting as the user with an impersonation token, 0 otherwise.
+	ImpersonatedBy int64
+	// RequestID is the ID of the request, as sent in the X-Request-Id response header.
+	RequestID string
+}
+
+// InDepartmentScope checks if the request can write the department with the given ID.
+// The requests that are not scoped can write every department, the IDs are compared case-insensitively.
+func (m *RequestMeta) InDepartmentScope(id string) bool {
+	if !m.DepartmentScoped {
+		return true
+	}
+
+	for _, allowed := range m.DepartmentScope {
+		if strings.EqualFold(allowed, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasPermission checks if the request is granted the permission.
+func (m *RequestMeta) HasPermission(p string) bool {
+	perms := m.Permissions
+	if perms == nil {
+		perms = permission.For(m.Roles)
+	}
+
+	return slices.Contains(perms, p)
 }
 
 // This struct defines the requestMetaKeyType struct
@@ -23,6 +77,49 @@ type requestMetaKeyType struct{}
 // Define a key for storing RequestMeta in the context
 var requestMetaKey = requestMetaKeyType{}
 
+// metaContext is a context carrying the RequestMeta of the request.
+// The metadata is stored in the context node itself, so injecting it costs a single allocation
+// and extracting it hands out a pointer instead of boxing a copy in an interface.
+type metaContext struct {
+	context.Context
+	meta RequestMeta
+}
+
+// Value returns the RequestMeta for its key and delegates the other keys to the parent context.
+func (c *metaContext) Value(key any) any {
+	if key == requestMetaKey {
+		return &c.meta
+	}
+	return c.Context.Value(key)
+}
+
+// String describes the context for debugging.
+func (c *metaContext) String() string {
+	return fmt.Sprintf("%v.WithRequestMeta(%s)", c.Context, c.meta.UserName)
+}
+
+// requestIDKeyType is the key of the request ID injected before the authentication.
+type requestIDKeyType struct{}
+
+var requestIDKey = requestIDKeyType{}
+
+// InjectRequestID injects the ID of the request into the context, so the work done before the
+// authentication (e.g. a login) can be tied to the request as well.
+func InjectRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFrom returns the ID of the request of the context, from its metadata or as injected
+// with InjectRequestID. It is empty outside of a request.
+func RequestIDFrom(ctx context.Context) string {
+	if meta, ok := RequestMetaFrom(ctx); ok && meta.RequestID != "" {
+		return meta.RequestID
+	}
+
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
 // GetValueFromContext retrieves a value from the context using the provided key.
 // It returns the value and an error if the key does not exist in the context.
 func GetValueFromContext(ctx context.Context, key string) (interface{}, error) {
@@ -36,12 +133,22 @@ func GetValueFromContext(ctx context.Context, key string) (interface{}, error) {
 // InjectRequestMeta injects the RequestMeta into the context.
 // This function is used to add metadata to the context for later retrieval
 func InjectRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
-	return context.WithValue(ctx, requestMetaKey, meta)
+	return &metaContext{Context: ctx, meta: meta}
 }
 
 // ExtractRequestMeta retrieves the RequestMeta from the context.
 // This function is used to access the metadata stored in the context
 func ExtractRequestMeta(ctx context.Context) (RequestMeta, bool) {
-	meta, ok := ctx.Value(requestMetaKey).(RequestMeta)
+	meta, ok := RequestMetaFrom(ctx)
+	if !ok {
+		return RequestMeta{}, false
+	}
+	return *meta, true
+}
+
+// RequestMetaFrom returns the RequestMeta of the context without copying it, for the hot paths
+// (e.g. the middlewares run on every request). The returned metadata must not be modified.
+func RequestMetaFrom(ctx context.Context) (*RequestMeta, bool) {
+	meta, ok := ctx.Value(requestMetaKey).(*RequestMeta)
 	return meta, ok
 }
@@ -0,0 +1,61 @@
+package dberror
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Package dberror extracts the constraint violations reported by PostgreSQL from the GORM errors,
+// so the services can surface them as typed errors instead of raw driver messages.
+
+// SQLSTATE codes of the integrity constraint violations
+const (
+	NotNullViolation    = "23502"
+	ForeignKeyViolation = "23503"
+	UniqueViolation     = "23505"
+	CheckViolation      = "23514"
+)
+
+// keyDetailPattern matches the key reported in the detail of a violation,
+// e.g. `Key (role_id)=(9) is not present in table "roles".`
+var keyDetailPattern = regexp.MustCompile(`^Key \(([^)]*)\)=\((.*)\) `)
+
+// ConstraintViolation describes a violated constraint.
+// Key and Value are the columns and the values of the offending key, as reported in the detail
+// (e.g. "user_id, role_id" and "1, 2"); they are empty for the violations without a key such as NOT NULL.
+type ConstraintViolation struct {
+	Code       string
+	Table      string
+	Column     string
+	Constraint string
+	Key        string
+	Value      string
+}
+
+// AsConstraintViolation returns the constraint violation in the chain of err, if any.
+func AsConstraintViolation(err error) (*ConstraintViolation, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil, false
+	}
+
+	switch pgErr.Code {
+	case NotNullViolation, ForeignKeyViolation, UniqueViolation, CheckViolation:
+	default:
+		return nil, false
+	}
+
+	v := &ConstraintViolation{
+		Code:       pgErr.Code,
+		Table:      pgErr.TableName,
+		Column:     pgErr.ColumnName,
+		Constraint: pgErr.ConstraintName,
+	}
+	if m := keyDetailPattern.FindStringSubmatch(pgErr.Detail); m != nil {
+		v.Key, v.Value = m[1], m[2]
+	}
+
+	return v, true
+}
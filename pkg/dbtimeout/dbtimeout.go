@@ -0,0 +1,178 @@
+package dbtimeout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+)
+
+// Package dbtimeout bounds the database statements of a request, so one pathological query
+// cannot hold a connection indefinitely.
+// The transactions opened on a bounded session start with SET LOCAL statement_timeout, which PostgreSQL
+// enforces on every statement of the transaction and resets at its end, so the pooled connections are
+// returned unchanged. The statements run outside a transaction cannot use SET LOCAL: they are bounded
+// with a context deadline of the same length, and the driver cancels them on the server once it passes.
+
+// Default timeouts, in milliseconds
+const (
+	defaultReadTimeoutMS   = 5000
+	defaultWriteTimeoutMS  = 15000
+	defaultImportTimeoutMS = 120000
+)
+
+var (
+	DBStatementTimeoutReadMS   string
+	DBStatementTimeoutWriteMS  string
+	DBStatementTimeoutImportMS string
+
+	// Read bounds the statements of the GET and HEAD requests
+	Read = defaultReadTimeoutMS * time.Millisecond
+	// Write bounds the statements of the other requests
+	Write = defaultWriteTimeoutMS * time.Millisecond
+	// Import bounds the statements of the bulk operations and the legacy import
+	Import = defaultImportTimeoutMS * time.Millisecond
+)
+
+// LoadEnv loads environment variables
+// A timeout of 0 disables it.
+func LoadEnv() {
+	DBStatementTimeoutReadMS = os.Getenv("DB_STATEMENT_TIMEOUT_READ_MS")
+	DBStatementTimeoutWriteMS = os.Getenv("DB_STATEMENT_TIMEOUT_WRITE_MS")
+	DBStatementTimeoutImportMS = os.Getenv("DB_STATEMENT_TIMEOUT_IMPORT_MS")
+
+	Read = getEnvMillis("DB_STATEMENT_TIMEOUT_READ_MS", DBStatementTimeoutReadMS, defaultReadTimeoutMS)
+	Write = getEnvMillis("DB_STATEMENT_TIMEOUT_WRITE_MS", DBStatementTimeoutWriteMS, defaultWriteTimeoutMS)
+	Import = getEnvMillis("DB_STATEMENT_TIMEOUT_IMPORT_MS", DBStatementTimeoutImportMS, defaultImportTimeoutMS)
+}
+
+// getEnvMillis parses a timeout in milliseconds, or returns the default one when it is not set or invalid.
+func getEnvMillis(name, value string, defaultValue int) time.Duration {
+	if value == "" {
+		return time.Duration(defaultValue) * time.Millisecond
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Warn(fmt.Sprintf("%s must be a number of milliseconds, using %d", name, defaultValue))
+		return time.Duration(defaultValue) * time.Millisecond
+	}
+
+	return time.Duration(n) * time.Millisecond
+}
+
+// WithStatementTimeout returns a session of db whose statements are bounded by the timeout.
+// The timeout replaces the one of a session that is already bounded. It returns db unchanged
+// when the timeout is 0.
+func WithStatementTimeout(db *gorm.DB, timeout time.Duration) *gorm.DB {
+	if db == nil || timeout <= 0 {
+		return db
+	}
+
+	// The context makes the session clone the statement, so the connection pool of db is left unchanged
+	session := db.Session(&gorm.Session{Context: db.Statement.Context})
+
+	pool := session.Statement.ConnPool
+	if bounded, ok := pool.(*timeoutPool); ok {
+		pool = bounded.pool
+	}
+	session.Statement.ConnPool = &timeoutPool{pool: pool, timeout: timeout}
+
+	return session
+}
+
+// StatementTimeout returns the timeout of a session returned by WithStatementTimeout, or 0.
+func StatementTimeout(db *gorm.DB) time.Duration {
+	if db == nil {
+		return 0
+	}
+	if bounded, ok := db.Statement.ConnPool.(*timeoutPool); ok {
+		return bounded.timeout
+	}
+
+	return 0
+}
+
+// timeoutPool wraps a connection pool to bound its statements.
+type timeoutPool struct {
+	pool    gorm.ConnPool
+	timeout time.Duration
+}
+
+// BeginTx opens a transaction whose statements are bounded by the timeout.
+// It implements gorm.ConnPoolBeginner, used by db.Transaction and db.Begin.
+func (p *timeoutPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var tx gorm.ConnPool
+	var err error
+	switch beginner := p.pool.(type) {
+	case gorm.TxBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// SET LOCAL does not take parameters, the timeout is formatted as an integer
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", p.timeout.Milliseconds())); err != nil {
+		if committer, ok := tx.(gorm.TxCommitter); ok {
+			err = errors.Join(err, committer.Rollback())
+		}
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// GetDBConn returns the underlying database, it implements gorm.GetDBConnector.
+func (p *timeoutPool) GetDBConn() (*sql.DB, error) {
+	switch pool := p.pool.(type) {
+	case *sql.DB:
+		return pool, nil
+	case gorm.GetDBConnector:
+		return pool.GetDBConn()
+	}
+
+	return nil, gorm.ErrInvalidDB
+}
+
+// PrepareContext implements gorm.ConnPool, the prepared statements are bounded when they are executed.
+func (p *timeoutPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.pool.PrepareContext(ctx, query)
+}
+
+// ExecContext implements gorm.ConnPool, the statement is bounded with a context deadline.
+func (p *timeoutPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	return p.pool.ExecContext(ctx, query, args...)
+}
+
+// QueryContext implements gorm.ConnPool, the query is bounded with a context deadline.
+func (p *timeoutPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.pool.QueryContext(p.deadline(ctx), query, args...)
+}
+
+// QueryRowContext implements gorm.ConnPool, the query is bounded with a context deadline.
+func (p *timeoutPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.pool.QueryRowContext(p.deadline(ctx), query, args...)
+}
+
+// deadline bounds a query with a context deadline.
+// The rows are read after the call returns and are closed if the context is cancelled,
+// so the context is released when the deadline passes instead of when the call returns.
+func (p *timeoutPool) deadline(ctx context.Context) context.Context {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	time.AfterFunc(p.timeout, cancel)
+	return ctx
+}
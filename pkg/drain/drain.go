@@ -0,0 +1,141 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package drain coordinates the zero-downtime shutdown of the application.
+// Draining marks the application as not ready, so /readyz answers 503 and the load balancer
+// stops routing new requests to it; the servers then wait for the in-flight requests and the
+// background jobs registered here finish their pending work before the process exits.
+// A drain is started by SIGTERM/SIGINT or by the /admin/drain endpoint (e.g. from a preStop hook).
+
+// defaultDelay is the time given to the load balancers to notice the failing readiness probe.
+const defaultDelay = 5 * time.Second
+
+// ErrDraining is reported by the readiness check once the drain has started.
+var ErrDraining = errors.New("application is draining")
+
+var (
+	DrainDelaySeconds string
+	Delay             = defaultDelay
+
+	mu        sync.Mutex
+	started   = make(chan struct{})
+	drained   = make(chan struct{})
+	startOnce sync.Once
+	endOnce   sync.Once
+	jobs      []job
+	initOnce  sync.Once
+)
+
+// Job waits for a background job to finish its pending work.
+// It must return when the context is done.
+type Job func(ctx context.Context) error
+
+// job is a registered background job.
+type job struct {
+	name string
+	wait Job
+}
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	DrainDelaySeconds = os.Getenv("DRAIN_DELAY_SECONDS")
+
+	Delay = defaultDelay
+	if n, err := strconv.Atoi(DrainDelaySeconds); err == nil && n >= 0 {
+		Delay = time.Duration(n) * time.Second
+	}
+}
+
+// Init registers the drain state in the health registry as a critical component.
+// It is safe to call it several times.
+func Init() {
+	initOnce.Do(func() {
+		health.Register("drain", health.Critical, CheckReady)
+	})
+}
+
+// Start starts the drain and returns false if it was already started.
+func Start() bool {
+	first := false
+	startOnce.Do(func() {
+		first = true
+		close(started)
+		logger.Info("Draining the application, the readiness probe now fails")
+	})
+
+	return first
+}
+
+// Started returns a channel closed when the drain starts.
+func Started() <-chan struct{} {
+	return started
+}
+
+// IsDraining checks if the drain has started.
+func IsDraining() bool {
+	select {
+	case <-started:
+		return true
+	default:
+		return false
+	}
+}
+
+// Finish marks the drain as complete, once the servers and the background jobs are done.
+func Finish() {
+	endOnce.Do(func() {
+		close(drained)
+	})
+}
+
+// Drained returns a channel closed when the drain is complete.
+func Drained() <-chan struct{} {
+	return drained
+}
+
+// CheckReady reports an error once the drain has started.
+func CheckReady(ctx context.Context) error {
+	if IsDraining() {
+		return ErrDraining
+	}
+
+	return nil
+}
+
+// RegisterJob registers a background job waited for during the drain.
+// The jobs are waited for one after the other in the registration order, so a job feeding
+// another one (e.g. the outbox feeding the webhooks) must be registered first.
+func RegisterJob(name string, wait Job) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	jobs = append(jobs, job{name: name, wait: wait})
+}
+
+// WaitJobs waits for the registered background jobs until the context is done.
+// A job failing or not finishing in time is logged and the next ones are still waited for.
+func WaitJobs(ctx context.Context) {
+	mu.Lock()
+	registered := append([]job(nil), jobs...)
+	mu.Unlock()
+
+	for _, j := range registered {
+		if err := j.wait(ctx); err != nil {
+			logger.Error(fmt.Sprintf("Background job %s did not finish: %v", j.name, err))
+			continue
+		}
+		logger.Info(fmt.Sprintf("Background job %s finished", j.name))
+	}
+}
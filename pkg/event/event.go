@@ -0,0 +1,169 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package event provides the domain event publishing abstraction.
+// Services write their events to the transactional outbox, which publishes them once committed;
+// the events are sent to the configured broker (e.g. Kafka) and to the in-process subscribers (e.g. the event stream).
+
+// Domain event types
+const (
+	DepartmentCreated      = "department.created"
+	DepartmentUpdated      = "department.updated"
+	DepartmentDeleted      = "department.deleted"
+	DepartmentArchived     = "department.archived"
+	DepartmentUnarchived   = "department.unarchived"
+	DepartmentActivated    = "department.activated"
+	DepartmentDeactivated  = "department.deactivated"
+	DepartmentClaimed      = "department.claimed"
+	DepartmentReleased     = "department.released"
+	DepartmentDrifted      = "department.drifted"
+	DepartmentAccessDenied = "department.access_denied"
+	UserCreated            = "user.created"
+	UserUpdated            = "user.updated"
+	UserDeleted            = "user.deleted"
+	UserRestored           = "user.restored"
+	UserEnabled            = "user.enabled"
+	UserDisabled           = "user.disabled"
+	UserImpersonated       = "user.impersonated"
+	ExportMasked           = "export.masked"
+)
+
+// Event represents a domain event.
+// The subject is the identifier of the entity the event relates to, it is used as the message key
+// so that all events of the same entity keep their order in the broker.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Subject    string    `json:"subject"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+// Publisher is the interface implemented by the event brokers.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+	Close() error
+}
+
+// Subscriber is a function called for every published event within the process.
+type Subscriber func(e Event)
+
+var (
+	EventPublisher string
+	KafkaBrokers   string
+	KafkaTopic     string
+
+	mu          sync.RWMutex
+	publisher   Publisher = noopPublisher{}
+	subscribers []Subscriber
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	EventPublisher = os.Getenv("EVENT_PUBLISHER")
+	KafkaBrokers = os.Getenv("KAFKA_BROKERS")
+	KafkaTopic = os.Getenv("KAFKA_TOPIC")
+}
+
+// InitPublisher initializes the event publisher selected by the EVENT_PUBLISHER environment variable.
+// Publishing is disabled when the variable is empty or set to NONE.
+func InitPublisher() {
+	var p Publisher
+	switch strings.ToUpper(EventPublisher) {
+	case "KAFKA":
+		kp, err := NewKafkaPublisher(strings.Split(KafkaBrokers, ","), KafkaTopic)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize Kafka event publisher: %v", err))
+			return
+		}
+		p = kp
+		logger.Info(fmt.Sprintf("Kafka event publisher initialized on topic %s", KafkaTopic))
+	case "", "NONE":
+		p = noopPublisher{}
+	default:
+		logger.Error(fmt.Sprintf("Unsupported event publisher: %s", EventPublisher))
+		return
+	}
+
+	SetPublisher(p)
+}
+
+// SetPublisher replaces the event publisher.
+func SetPublisher(p Publisher) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	publisher = p
+}
+
+// Subscribe registers an in-process subscriber called for every published event.
+func Subscribe(s Subscriber) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	subscribers = append(subscribers, s)
+}
+
+// NewEvent creates a new event with a unique ID.
+func NewEvent(eventType string, subject string, data any) Event {
+	return Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Subject:    subject,
+		OccurredAt: time.Now(),
+		Data:       data,
+	}
+}
+
+// Publish sends the event to the configured broker.
+// It is called by the outbox dispatcher once the transaction is committed. Broker failures are logged
+// and returned so the event is retried.
+func Publish(ctx context.Context, e Event) error {
+	mu.RLock()
+	p := publisher
+	mu.RUnlock()
+
+	if err := p.Publish(ctx, e); err != nil {
+		logger.Error(fmt.Sprintf("failed to publish event %s (%s): %v", e.ID, e.Type, err))
+		return err
+	}
+
+	return nil
+}
+
+// NotifySubscribers calls the in-process subscribers with the event.
+// It is called by the outbox dispatcher once per event, whatever the broker does.
+func NotifySubscribers(e Event) {
+	mu.RLock()
+	subs := subscribers
+	mu.RUnlock()
+
+	for _, s := range subs {
+		s(e)
+	}
+}
+
+// Close closes the configured publisher.
+func Close() error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return publisher.Close()
+}
+
+// noopPublisher is used when no broker is configured.
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(ctx context.Context, e Event) error { return nil }
+func (noopPublisher) Close() error                               { return nil }
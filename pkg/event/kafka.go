@@ -0,0 +1,66 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes the events as JSON messages to a Kafka topic.
+// The event subject is used as the message key to preserve the ordering per entity.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher creates a new Kafka publisher for the given brokers and topic.
+func NewKafkaPublisher(brokers []string, topic string) (*KafkaPublisher, error) {
+	var addrs []string
+	for _, b := range brokers {
+		if b = strings.TrimSpace(b); b != "" {
+			addrs = append(addrs, b)
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, errors.New("KAFKA_BROKERS environment variable is not set")
+	}
+	if topic == "" {
+		return nil, errors.New("KAFKA_TOPIC environment variable is not set")
+	}
+
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(addrs...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			WriteTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// Publish writes the event to the Kafka topic and waits for the acknowledgement.
+func (p *KafkaPublisher) Publish(ctx context.Context, e Event) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.Subject),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event-type", Value: []byte(e.Type)},
+			{Key: "event-id", Value: []byte(e.ID)},
+		},
+	})
+}
+
+// Close flushes the pending messages and closes the writer.
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
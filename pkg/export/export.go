@@ -0,0 +1,238 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/i18n"
+)
+
+// Package export writes the entities as CSV files localized for spreadsheets.
+// An export is a list of columns, whose header is the translation of their key in the i18n catalog;
+// the sensitive columns are left out of the exports requested by the callers the masking policy does not trust.
+
+// Delimiters maps the accepted values of the delimiter query parameter to the delimiter of the CSV export.
+var Delimiters = map[string]rune{
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+	"pipe":      '|',
+	",":         ',',
+	";":         ';',
+	"|":         '|',
+}
+
+// DateFormats maps the accepted values of the dateFormat query parameter to their layout.
+// The times are exported in UTC.
+var DateFormats = map[string]string{
+	"rfc3339": time.RFC3339,
+	"iso":     "2006-01-02 15:04:05",
+	"date":    "2006-01-02",
+	"eu":      "02/01/2006 15:04",
+	"de":      "02.01.2006 15:04",
+	"nl":      "02-01-2006 15:04",
+	"us":      "01/02/2006 15:04",
+}
+
+// Encodings of the CSV export
+// UTF-8-BOM starts the file with a byte order mark, so Excel detects the encoding instead of assuming the ANSI code page.
+const (
+	EncodingUTF8    = "UTF-8"
+	EncodingUTF8BOM = "UTF-8-BOM"
+)
+
+// Options holds the format of a CSV export.
+// The locale selects the language of the header and of the booleans, and the default delimiter and date format.
+type Options struct {
+	Locale     string
+	Delimiter  rune
+	DateLayout string
+	BOM        bool
+}
+
+// Column is a column of a CSV export, its header is the translation of the key.
+// The sensitive columns are masked by the MaskPolicy.
+type Column[T any] struct {
+	Key       string
+	Sensitive bool
+	Value     func(row T, opts Options) string
+}
+
+// MaskPolicy selects the roles allowed to export the sensitive columns.
+type MaskPolicy struct {
+	UnmaskedRoles []string
+}
+
+// DefaultMaskPolicy shows the sensitive columns to the admins only.
+var DefaultMaskPolicy = MaskPolicy{UnmaskedRoles: []string{"ROLE_ADMIN"}}
+
+// Unmasked reports whether the caller with the given roles can export the sensitive columns.
+func (p MaskPolicy) Unmasked(roles []string) bool {
+	for _, r := range roles {
+		if slices.ContainsFunc(p.UnmaskedRoles, func(allowed string) bool { return strings.EqualFold(allowed, r) }) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Mask applies the policy to the columns of an export requested by a caller with the given roles.
+// It returns the columns to export and the keys of the sensitive columns left out, nil when none is.
+func Mask[T any](policy MaskPolicy, columns []Column[T], roles []string) (visible []Column[T], masked []string) {
+	if policy.Unmasked(roles) {
+		return columns, nil
+	}
+
+	visible = make([]Column[T], 0, len(columns))
+	for _, column := range columns {
+		if column.Sensitive {
+			masked = append(masked, column.Key)
+			continue
+		}
+		visible = append(visible, column)
+	}
+
+	return visible, masked
+}
+
+// MaskedExport records an export produced without its sensitive columns and the caller who requested it.
+// It is the data of the export.masked events.
+type MaskedExport struct {
+	Entity         string    `json:"entity"`
+	MaskedColumns  []string  `json:"maskedColumns"`
+	Rows           int       `json:"rows"`
+	Locale         string    `json:"locale"`
+	UserID         int64     `json:"userId"`
+	UserName       string    `json:"userName"`
+	ImpersonatedBy int64     `json:"impersonatedBy,omitempty"`
+	RequestID      string    `json:"requestId,omitempty"`
+	ProducedAt     time.Time `json:"producedAt"`
+}
+
+// NewMaskedExport describes the masked export of the rows of an entity, requested by the caller of the context.
+func NewMaskedExport(ctx context.Context, entity string, masked []string, rows int, opts Options) MaskedExport {
+	e := MaskedExport{
+		Entity:        entity,
+		MaskedColumns: masked,
+		Rows:          rows,
+		Locale:        opts.Locale,
+		ProducedAt:    time.Now().UTC(),
+	}
+	if meta, ok := metacontext.RequestMetaFrom(ctx); ok {
+		e.UserID = meta.UserID
+		e.UserName = meta.UserName
+		e.ImpersonatedBy = meta.ImpersonatedBy
+		e.RequestID = meta.RequestID
+	}
+
+	return e
+}
+
+// NewOptions builds the options of an export from the values of the query parameters.
+// The empty values take the defaults of the locale from the i18n catalog.
+func NewOptions(locale, delimiter, encoding, dateFormat string) (Options, error) {
+	opts := Options{Locale: i18n.Language(locale)}
+
+	if delimiter == "" {
+		delimiter = i18n.Translate(opts.Locale, "csv.delimiter")
+	}
+	d, ok := Delimiters[strings.ToLower(delimiter)]
+	if !ok {
+		return Options{}, fmt.Errorf("delimiter must be one of: comma, semicolon, tab, pipe")
+	}
+	opts.Delimiter = d
+
+	if dateFormat == "" {
+		dateFormat = i18n.Translate(opts.Locale, "csv.dateFormat")
+	}
+	layout, ok := DateFormats[strings.ToLower(dateFormat)]
+	if !ok {
+		return Options{}, fmt.Errorf("dateFormat must be one of: rfc3339, iso, date, eu, de, nl, us")
+	}
+	opts.DateLayout = layout
+
+	switch strings.ToUpper(strings.ReplaceAll(encoding, "_", "-")) {
+	case "", EncodingUTF8, "UTF8":
+		opts.BOM = false
+	case EncodingUTF8BOM, "UTF8-BOM":
+		opts.BOM = true
+	default:
+		return Options{}, fmt.Errorf("encoding must be one of: utf-8, utf-8-bom")
+	}
+
+	return opts, nil
+}
+
+// WriteCSV writes the rows as CSV with the header translated in the language of the options.
+// The lines end with CRLF as RFC 4180 requires, and the cells are protected against formula injection.
+func WriteCSV[T any](w io.Writer, columns []Column[T], rows []T, opts Options) error {
+	if opts.BOM {
+		if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+			return err
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = opts.Delimiter
+	cw.UseCRLF = true
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = i18n.Translate(opts.Locale, column.Key)
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = Cell(column.Value(row, opts))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Cell prefixes the values a spreadsheet would evaluate as a formula with a quote, so they are shown as text.
+func Cell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+// Bool returns the translation of a boolean in the language of the options.
+func Bool(value bool, opts Options) string {
+	return i18n.Translate(opts.Locale, "boolean."+strconv.FormatBool(value))
+}
+
+// Time formats a time in UTC with the layout of the options, an unset time is empty.
+func Time(t *time.Time, opts Options) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(opts.DateLayout)
+}
+
+// String returns the value of an optional string, empty when it is unset.
+func String(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Package health provides the registry of the health checks aggregated by the readiness endpoint.
+// Every module registers its own checker with a criticality level when it is initialized,
+// so the endpoint never has to know about the components of the application.
+
+// Criticality levels of the components
+// A failing critical component makes the application DOWN (not ready to receive traffic),
+// a failing non-critical component only makes it DEGRADED.
+const (
+	Critical    = "CRITICAL"
+	NonCritical = "NON_CRITICAL"
+)
+
+// Statuses of the components and of the application
+const (
+	StatusUp       = "UP"
+	StatusDegraded = "DEGRADED"
+	StatusDown     = "DOWN"
+)
+
+// defaultCheckTimeout is the time given to each checker when HEALTH_CHECK_TIMEOUT_SECONDS is not set.
+const defaultCheckTimeout = 2 * time.Second
+
+var (
+	HealthCheckTimeoutSeconds string
+
+	defaultRegistry = NewRegistry()
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	HealthCheckTimeoutSeconds = os.Getenv("HEALTH_CHECK_TIMEOUT_SECONDS")
+
+	defaultRegistry.timeout = defaultCheckTimeout
+	if n, err := strconv.Atoi(HealthCheckTimeoutSeconds); err == nil && n > 0 {
+		defaultRegistry.timeout = time.Duration(n) * time.Second
+	}
+}
+
+// Checker checks the health of a component and returns an error when it is unhealthy.
+// It must return when the context is done.
+type Checker func(ctx context.Context) error
+
+// ComponentStatus represents the health of a component.
+type ComponentStatus struct {
+	Status      string `json:"status"`
+	Criticality string `json:"criticality"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int64  `json:"durationMs"`
+}
+
+// Report represents the aggregated health of the application.
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+	CheckedAt  time.Time                  `json:"checkedAt"`
+}
+
+// contributor is a registered checker.
+type contributor struct {
+	criticality string
+	check       Checker
+}
+
+// Registry holds the registered health checks.
+type Registry struct {
+	mu           sync.RWMutex
+	contributors map[string]contributor
+	timeout      time.Duration
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		contributors: map[string]contributor{},
+		timeout:      defaultCheckTimeout,
+	}
+}
+
+// GetRegistry returns the application-wide registry.
+func GetRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register registers a checker in the application-wide registry.
+func Register(name string, criticality string, check Checker) {
+	defaultRegistry.Register(name, criticality, check)
+}
+
+// Register registers a checker under the given component name, replacing any previous one.
+func (r *Registry) Register(name string, criticality string, check Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.contributors[name] = contributor{criticality: criticality, check: check}
+}
+
+// Names returns the names of the registered components.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.contributors))
+	for name := range r.contributors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Check runs all the checkers concurrently, each with the registry timeout, and aggregates their status.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	contributors := make(map[string]contributor, len(r.contributors))
+	for name, c := range r.contributors {
+		contributors[name] = c
+	}
+	timeout := r.timeout
+	r.mu.RUnlock()
+
+	report := Report{
+		Status:     StatusUp,
+		Components: make(map[string]ComponentStatus, len(contributors)),
+		CheckedAt:  time.Now(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range contributors {
+		wg.Add(1)
+		go func(name string, c contributor) {
+			defer wg.Done()
+			status := runCheck(ctx, c, timeout)
+
+			mu.Lock()
+			report.Components[name] = status
+			mu.Unlock()
+		}(name, c)
+	}
+	wg.Wait()
+
+	for _, status := range report.Components {
+		if status.Status == StatusUp {
+			continue
+		}
+		if status.Criticality == Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+// runCheck runs a checker with a timeout.
+// A checker not returning in time is reported as down, its goroutine is left to finish on its own.
+func runCheck(ctx context.Context, c contributor, timeout time.Duration) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() { result <- c.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	status := ComponentStatus{
+		Status:      StatusUp,
+		Criticality: c.criticality,
+		DurationMs:  time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+
+	return status
+}
@@ -0,0 +1,83 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Package i18n holds the message catalog used to localize the exported files.
+// The catalog has one JSON file per language in catalog/, mapping the message keys to their translation.
+// English is the fallback of the languages and keys missing from the catalog.
+
+// DefaultLanguage is the language of the catalog used when no other language matches.
+const DefaultLanguage = "en"
+
+//go:embed catalog/*.json
+var catalogFS embed.FS
+
+// catalog maps the languages to their messages, it is loaded once from the embedded files.
+var catalog = loadCatalog()
+
+// loadCatalog reads the embedded catalog files.
+// The files are part of the binary, so an invalid file is a programming error.
+func loadCatalog() map[string]map[string]string {
+	entries, err := catalogFS.ReadDir("catalog")
+	if err != nil {
+		panic(err)
+	}
+
+	languages := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := catalogFS.ReadFile(path.Join("catalog", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic("invalid i18n catalog " + entry.Name() + ": " + err.Error())
+		}
+		languages[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+
+	return languages
+}
+
+// Language returns the language of the catalog matching the locale, e.g. "de" for "de-AT" or "de_DE",
+// and the default language when none matches.
+func Language(locale string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if _, ok := catalog[lang]; ok {
+		return lang
+	}
+
+	return DefaultLanguage
+}
+
+// Translate returns the message of the key in the language of the locale.
+// It falls back to the message of the default language, then to the key itself.
+func Translate(locale string, key string) string {
+	if message, ok := catalog[Language(locale)][key]; ok {
+		return message
+	}
+	if message, ok := catalog[DefaultLanguage][key]; ok {
+		return message
+	}
+
+	return key
+}
+
+// Languages returns the languages of the catalog, sorted.
+func Languages() []string {
+	languages := make([]string, 0, len(catalog))
+	for lang := range catalog {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	return languages
+}
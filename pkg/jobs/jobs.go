@@ -0,0 +1,400 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package jobs runs the long operations started by the requests (e.g. the bulk delete of the departments) in the
+// background, so the request answers 202 with the job and the client polls its progress at /api/v1/jobs/:id.
+// The jobs wait in a bounded queue for one of the workers, a full queue is refused rather than growing without limit.
+// The state of the jobs is stored in Redis when it is available, so every replica reports the progress of a job.
+// The queue is closed when the application drains: the jobs still queued are failed and the running ones
+// are waited for, then cancelled when the drain times out.
+
+// Status of a job
+const (
+	StatusQueued    = "QUEUED"
+	StatusRunning   = "RUNNING"
+	StatusSucceeded = "SUCCEEDED"
+	StatusFailed    = "FAILED"
+)
+
+const (
+	defaultWorkers   = 1
+	defaultQueueSize = 10
+	defaultRetention = 24 * time.Hour
+
+	// keyPrefix is the prefix of the Redis keys of the jobs
+	keyPrefix = "job:"
+)
+
+var (
+	ErrJobNotFound = apperror.New("JobNotFound", http.StatusNotFound, "job with the given ID not found")
+	ErrQueueFull   = apperror.New("JobQueueFull", http.StatusServiceUnavailable, "too many jobs are waiting, retry later")
+	ErrQueueClosed = apperror.New("JobQueueClosed", http.StatusServiceUnavailable, "the application is shutting down, retry on another instance")
+)
+
+var (
+	Workers   int
+	QueueSize int
+	Retention time.Duration
+
+	// Default is the queue of the application, set by Init
+	Default *Queue
+
+	initOnce sync.Once
+)
+
+// Job is the state of a background job.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Total      int64           `json:"total"`
+	Processed  int64           `json:"processed"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedBy  int64           `json:"createdBy"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// Done reports whether the job is finished, successfully or not.
+func (j Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Task is the work of a job. It reports its progress with report, as the number of items processed out of the
+// total, and returns the result of the job, encoded as JSON. The context is done when the queue is closed.
+type Task func(ctx context.Context, report func(processed int64, total int64)) (any, error)
+
+// Store stores the state of the jobs.
+type Store interface {
+	Save(ctx context.Context, job Job) error
+	Get(ctx context.Context, id string) (Job, error)
+}
+
+// LoadEnv loads environment variables
+// JOB_WORKERS is the number of jobs run at the same time, JOB_QUEUE_SIZE the number of jobs waiting for a worker
+// and JOB_RETENTION_HOURS the time the finished jobs can still be read.
+func LoadEnv() {
+	Workers = defaultWorkers
+	if n, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && n > 0 {
+		Workers = n
+	}
+
+	QueueSize = defaultQueueSize
+	if n, err := strconv.Atoi(os.Getenv("JOB_QUEUE_SIZE")); err == nil && n > 0 {
+		QueueSize = n
+	}
+
+	Retention = defaultRetention
+	if hours, err := strconv.Atoi(os.Getenv("JOB_RETENTION_HOURS")); err == nil && hours > 0 {
+		Retention = time.Duration(hours) * time.Hour
+	}
+}
+
+// Init starts the queue of the application, storing the jobs in Redis when the client is not nil.
+// The queue is closed when the application drains.
+func Init(redisClient *redis.Client) {
+	var store Store = NewMemoryStore(Retention)
+	if redisClient != nil {
+		store = NewRedisStore(redisClient, Retention)
+	}
+
+	Default = NewQueue(store, Workers, QueueSize)
+	initOnce.Do(func() {
+		drain.RegisterJob("jobs", func(ctx context.Context) error {
+			if Default == nil {
+				return nil
+			}
+			return Default.Close(ctx)
+		})
+	})
+
+	logger.Info(fmt.Sprintf("Job queue started with %d workers and room for %d jobs", Workers, QueueSize))
+}
+
+// queued is a job waiting for a worker.
+type queued struct {
+	job  Job
+	ctx  context.Context
+	task Task
+}
+
+// Queue runs the jobs with a fixed number of workers.
+type Queue struct {
+	store Store
+	tasks chan queued
+
+	mu      sync.Mutex
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// NewQueue creates a queue storing the jobs in the store and starts its workers.
+func NewQueue(store Store, workers int, size int) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{store: store, tasks: make(chan queued, size), ctx: ctx, cancel: cancel}
+
+	for range max(workers, 1) {
+		q.workers.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Enqueue queues the task as a job of the given type created by the given user.
+// The task runs with the values of the context (e.g. the database, the caller), but not its cancellation,
+// since the job outlives the request.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, createdBy int64, task Task) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{ID: id, Type: jobType, Status: StatusQueued, CreatedBy: createdBy, CreatedAt: time.Now()}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return Job{}, ErrQueueClosed
+	}
+	if len(q.tasks) == cap(q.tasks) {
+		return Job{}, ErrQueueFull
+	}
+	if err := q.store.Save(ctx, job); err != nil {
+		return Job{}, fmt.Errorf("failed to store job: %w", err)
+	}
+
+	q.tasks <- queued{job: job, ctx: context.WithoutCancel(ctx), task: task}
+	return job, nil
+}
+
+// Get returns the job with the given ID.
+func (q *Queue) Get(ctx context.Context, id string) (Job, error) {
+	return q.store.Get(ctx, id)
+}
+
+// Close stops accepting jobs, fails the queued ones and waits for the running ones until the context is done,
+// then cancels them.
+func (q *Queue) Close(waitCtx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.tasks)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-waitCtx.Done():
+		q.cancel()
+		<-done
+		return waitCtx.Err()
+	}
+}
+
+// work runs the queued jobs until the queue is closed.
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for item := range q.tasks {
+		if q.isClosed() {
+			q.finish(item.ctx, item.job, nil, errors.New("the application shut down before the job started"))
+			continue
+		}
+		q.run(item)
+	}
+}
+
+// run runs a job and stores its progress and its outcome.
+func (q *Queue) run(item queued) {
+	job := item.job
+	now := time.Now()
+	job.Status, job.StartedAt = StatusRunning, &now
+	q.save(item.ctx, job)
+
+	// The job is cancelled when the queue is closed and the drain times out
+	ctx, cancel := context.WithCancel(item.ctx)
+	defer cancel()
+	stop := context.AfterFunc(q.ctx, cancel)
+	defer stop()
+
+	var mu sync.Mutex
+	report := func(processed int64, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		job.Processed, job.Total = processed, total
+		q.save(item.ctx, job)
+	}
+
+	result, err := runTask(ctx, item.task, report)
+
+	mu.Lock()
+	defer mu.Unlock()
+	q.finish(item.ctx, job, result, err)
+}
+
+// runTask runs the task, a panic fails the job instead of the worker.
+func runTask(ctx context.Context, task Task, report func(int64, int64)) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return task(ctx, report)
+}
+
+// finish stores the outcome of a job.
+func (q *Queue) finish(ctx context.Context, job Job, result any, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = StatusSucceeded
+	if err != nil {
+		job.Status, job.Error = StatusFailed, err.Error()
+		logger.Error(fmt.Sprintf("Job %s (%s) failed: %v", job.ID, job.Type, err))
+	}
+
+	if result != nil {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			logger.Error(fmt.Sprintf("failed to encode the result of job %s: %v", job.ID, marshalErr))
+		} else {
+			job.Result = data
+		}
+	}
+
+	q.save(ctx, job)
+}
+
+// save stores the state of a job, a failure is only logged since the job goes on.
+func (q *Queue) save(ctx context.Context, job Job) {
+	if err := q.store.Save(ctx, job); err != nil {
+		logger.Error(fmt.Sprintf("failed to store job %s: %v", job.ID, err))
+	}
+}
+
+func (q *Queue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.closed
+}
+
+// newID generates a random job ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// MemoryStore stores the jobs in memory, they are only known to the replica running them.
+type MemoryStore struct {
+	mu        sync.Mutex
+	jobs      map[string]Job
+	retention time.Duration
+}
+
+// NewMemoryStore creates a store keeping the finished jobs for the retention.
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}, retention: retention}
+}
+
+// Save stores the job and forgets the jobs finished before the retention.
+func (s *MemoryStore) Save(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+	for id, j := range s.jobs {
+		if j.FinishedAt != nil && time.Since(*j.FinishedAt) > s.retention {
+			delete(s.jobs, id)
+		}
+	}
+
+	return nil
+}
+
+// Get returns the job with the given ID.
+func (s *MemoryStore) Get(ctx context.Context, id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+// RedisStore stores the jobs in Redis, they expire after the retention.
+type RedisStore struct {
+	client    *redis.Client
+	retention time.Duration
+}
+
+// NewRedisStore creates a store keeping the jobs in Redis for the retention.
+func NewRedisStore(client *redis.Client, retention time.Duration) *RedisStore {
+	return &RedisStore{client: client, retention: retention}
+}
+
+// Save stores the job.
+func (s *RedisStore) Save(ctx context.Context, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, keyPrefix+job.ID, data, s.retention).Err()
+}
+
+// Get returns the job with the given ID.
+func (s *RedisStore) Get(ctx context.Context, id string) (Job, error) {
+	data, err := s.client.Get(ctx, keyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
@@ -0,0 +1,14 @@
+//go:build go_json
+
+package jsoncodec
+
+import json "github.com/goccy/go-json"
+
+const name = "go-json"
+
+var (
+	// Marshal returns the JSON encoding of v.
+	Marshal = json.Marshal
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v.
+	Unmarshal = json.Unmarshal
+)
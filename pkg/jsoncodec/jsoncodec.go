@@ -0,0 +1,16 @@
+package jsoncodec
+
+// Package jsoncodec selects the JSON encoder of the application at build time.
+// The build tags are the ones of Gin, so the responses rendered by Gin (c.JSON) and the values
+// encoded here (cache entries, streamed events) always use the same encoder:
+//   - no tag: encoding/json
+//   - jsoniter: github.com/json-iterator/go, configured to be compatible with encoding/json
+//   - go_json: github.com/goccy/go-json
+//   - sonic avx: github.com/bytedance/sonic on amd64 CPUs with AVX (Linux, Windows or macOS)
+//
+// e.g. go build -tags=go_json -o main ./cmd/main.go
+
+// Name returns the name of the JSON encoder the application was built with.
+func Name() string {
+	return name
+}
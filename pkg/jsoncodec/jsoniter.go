@@ -0,0 +1,15 @@
+//go:build jsoniter
+
+package jsoncodec
+
+import jsoniter "github.com/json-iterator/go"
+
+const name = "jsoniter"
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+	// Marshal returns the JSON encoding of v.
+	Marshal = json.Marshal
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v.
+	Unmarshal = json.Unmarshal
+)
@@ -0,0 +1,15 @@
+//go:build sonic && avx && (linux || windows || darwin) && amd64
+
+package jsoncodec
+
+import "github.com/bytedance/sonic"
+
+const name = "sonic"
+
+var (
+	json = sonic.ConfigStd
+	// Marshal returns the JSON encoding of v.
+	Marshal = json.Marshal
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v.
+	Unmarshal = json.Unmarshal
+)
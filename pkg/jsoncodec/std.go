@@ -0,0 +1,14 @@
+//go:build !jsoniter && !go_json && !(sonic && avx && (linux || windows || darwin) && amd64)
+
+package jsoncodec
+
+import "encoding/json"
+
+const name = "encoding/json"
+
+var (
+	// Marshal returns the JSON encoding of v.
+	Marshal = json.Marshal
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v.
+	Unmarshal = json.Unmarshal
+)
@@ -0,0 +1,264 @@
+package jsonschema
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// Package jsonschema generates JSON Schemas from the request DTOs and validates payloads against them.
+// The schemas are derived from the "json" and "validate" struct tags, so the published schema,
+// the strict validation and the go-playground validator always agree on the same rules.
+
+// Draft is the JSON Schema dialect of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema represents the subset of JSON Schema used by the API.
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 []string           `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	PatternProperties    map[string]*Schema `json:"patternProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+}
+
+// Types encoded as date-time strings in JSON
+var dateTimeTypes = map[string]bool{
+	"time.Time":      true,
+	"gorm.DeletedAt": true,
+}
+
+// Generate generates the JSON Schema of a DTO.
+// Unknown properties are not allowed, so misspelled fields are reported instead of silently ignored.
+func Generate(title string, v any) *Schema {
+	s := generateType(reflect.TypeOf(v))
+	s.SchemaURI = Draft
+	s.Title = title
+	return s
+}
+
+// generateType generates the schema of a Go type.
+func generateType(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	s := &Schema{}
+	switch {
+	case dateTimeTypes[t.String()] || t == reflect.TypeOf(time.Time{}):
+		s.Type = []string{"string"}
+		s.Format = "date-time"
+	case t.Kind() == reflect.String:
+		s.Type = []string{"string"}
+	case t.Kind() == reflect.Bool:
+		s.Type = []string{"boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s.Type = []string{"integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s.Type = []string{"number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s.Type = []string{"array"}
+		s.Items = generateType(t.Elem())
+	case t.Kind() == reflect.Map:
+		s.Type = []string{"object"}
+	case t.Kind() == reflect.Struct:
+		generateStruct(t, s)
+	}
+
+	if nullable {
+		s.Type = append(s.Type, "null")
+	}
+
+	return s
+}
+
+// generateStruct generates the properties of a struct from its exported fields.
+func generateStruct(t reflect.Type, s *Schema) {
+	additional := false
+	s.Type = []string{"object"}
+	s.Properties = map[string]*Schema{}
+	s.AdditionalProperties = &additional
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := generateType(f.Type)
+		if applyValidateTag(prop, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// applyValidateTag maps the go-playground validator rules to JSON Schema keywords.
+// The rules after "dive" apply to the items of an array. It returns true if the field is required.
+func applyValidateTag(s *Schema, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	required := false
+	omitEmpty := false
+	target := s
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if target == s {
+				required = true
+			}
+			// The validator also rejects empty strings
+			if target.hasType("string") && target.MinLength == nil {
+				one := 1
+				target.MinLength = &one
+			}
+		case "omitempty":
+			omitEmpty = true
+		case "dive":
+			if target.Items != nil {
+				target = target.Items
+			}
+		case "email":
+			target.Format = "email"
+		case "url":
+			target.Format = "uri"
+		case "slug":
+			target.Pattern = validate.SlugPattern.String()
+		case "rolename":
+			target.Pattern = validate.RoleNamePattern.String()
+		case "metadata":
+			// Keys must match the key pattern and values must be scalars
+			additional := false
+			maxLength := validate.MetadataMaxValueLength
+			target.PatternProperties = map[string]*Schema{
+				validate.MetadataKeyPattern.String(): {
+					Type:      []string{"string", "number", "boolean", "null"},
+					MaxLength: &maxLength,
+				},
+			}
+			target.AdditionalProperties = &additional
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				target.Enum = append(target.Enum, enumValue(target, value))
+			}
+		case "len", "min":
+			// An empty value is allowed with omitempty, so only the maximum can be enforced
+			if !omitEmpty || target != s {
+				applyBound(target, name, param)
+			}
+		case "max":
+			applyBound(target, name, param)
+		}
+	}
+
+	return required
+}
+
+// applyBound applies a len, min or max rule according to the type of the schema.
+func applyBound(s *Schema, name string, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	i := int(n)
+
+	switch {
+	case s.hasType("string"):
+		if name == "len" || name == "min" {
+			s.MinLength = &i
+		}
+		if name == "len" || name == "max" {
+			s.MaxLength = &i
+		}
+	case s.hasType("array"):
+		if name == "len" || name == "min" {
+			s.MinItems = &i
+		}
+		if name == "len" || name == "max" {
+			s.MaxItems = &i
+		}
+	case s.hasType("object"):
+		if name == "len" || name == "max" {
+			s.MaxProperties = &i
+		}
+	case s.hasType("integer") || s.hasType("number"):
+		if name == "len" || name == "min" {
+			s.Minimum = &n
+		}
+		if name == "len" || name == "max" {
+			s.Maximum = &n
+		}
+	}
+}
+
+// enumValue converts an enum value to the type of the schema.
+func enumValue(s *Schema, value string) any {
+	if s.hasType("integer") || s.hasType("number") {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+
+	return value
+}
+
+// hasType checks if the schema allows the given type.
+func (s *Schema) hasType(name string) bool {
+	for _, t := range s.Type {
+		if t == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithOptional returns a copy of the schema where the given properties are not required,
+// e.g. the identifier taken from the URL path of an update request.
+func (s *Schema) WithOptional(names ...string) *Schema {
+	c := *s
+	c.Required = nil
+	for _, r := range s.Required {
+		optional := false
+		for _, name := range names {
+			if r == name {
+				optional = true
+				break
+			}
+		}
+		if !optional {
+			c.Required = append(c.Required, r)
+		}
+	}
+
+	return &c
+}
@@ -0,0 +1,207 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError describes a payload value that does not match the schema.
+// The field is the JSON path of the value, e.g. "roles[0].roleName".
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidateJSON validates a raw JSON payload against the schema.
+func ValidateJSON(s *Schema, data []byte) []ValidationError {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []ValidationError{{Field: "", Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	return Validate(s, value)
+}
+
+// Validate validates a decoded JSON value against the schema.
+func Validate(s *Schema, value any) []ValidationError {
+	var errs []ValidationError
+	validateValue(s, value, "", &errs)
+	return errs
+}
+
+// validateValue validates a value and appends the errors found.
+func validateValue(s *Schema, value any, path string, errs *[]ValidationError) {
+	add := func(format string, args ...any) {
+		*errs = append(*errs, ValidationError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !matchesType(s, value) {
+		add("must be of type %v", s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		add("must be one of %v", s.Enum)
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			add("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			add("must be at most %d characters", *s.MaxLength)
+		}
+		if !matchesFormat(s.Format, v) {
+			add("must be a valid %s", s.Format)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				add("must match the pattern %s", s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			add("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			add("must be at most %v", *s.Maximum)
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add("must contain at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("must contain at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				validateValue(s.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]any:
+		if s.MaxProperties != nil && len(v) > *s.MaxProperties {
+			add("must contain at most %d properties", *s.MaxProperties)
+		}
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, ValidationError{Field: joinPath(path, name), Message: "is required"})
+			}
+		}
+
+		// Validate the properties in a stable order
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				prop, ok = matchPatternProperty(s.PatternProperties, name)
+			}
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, ValidationError{Field: joinPath(path, name), Message: "is not allowed"})
+				}
+				continue
+			}
+			validateValue(prop, v[name], joinPath(path, name), errs)
+		}
+	}
+}
+
+// matchPatternProperty returns the schema of the first pattern matching the property name.
+func matchPatternProperty(patterns map[string]*Schema, name string) (*Schema, bool) {
+	for pattern, prop := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(name) {
+			return prop, true
+		}
+	}
+
+	return nil, false
+}
+
+// matchesType checks if the value has one of the types allowed by the schema.
+func matchesType(s *Schema, value any) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+
+	for _, t := range s.Type {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesFormat checks the formats used by the API.
+func matchesFormat(format string, value string) bool {
+	switch format {
+	case "email":
+		_, err := mail.ParseAddress(value)
+		return err == nil
+	case "uri":
+		u, err := url.ParseRequestURI(value)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+// inEnum checks if the value is one of the enum values.
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// joinPath appends a property name to a JSON path.
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,124 @@
+package loadtest
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Package loadtest provides a Go-based load test harness for the API.
+// It logs in, seeds departments, sends requests at a constant rate against the login and
+// department endpoints and checks the latency and error SLOs. It runs against any environment
+// with "app loadtest -target https://host:port".
+
+// Scenarios
+const (
+	ScenarioDepartments = "departments"
+	ScenarioLogin       = "login"
+	ScenarioMixed       = "mixed"
+)
+
+// Config holds the load test configuration.
+type Config struct {
+	Target       string
+	Scenario     string
+	RPS          int
+	Duration     time.Duration
+	Concurrency  int
+	Seed         int
+	Username     string
+	Password     string
+	Insecure     bool
+	MaxP95       time.Duration
+	MaxP99       time.Duration
+	MaxErrorRate float64
+	CountLimited bool
+}
+
+// ParseConfig parses the load test command-line flags.
+// The credentials default to the LOADTEST_USERNAME and LOADTEST_PASSWORD environment variables.
+func ParseConfig(args []string) (Config, error) {
+	cfg := Config{}
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.StringVar(&cfg.Target, "target", "http://localhost:1000", "base URL of the API")
+	fs.StringVar(&cfg.Scenario, "scenario", ScenarioDepartments, "scenario: departments, login or mixed")
+	fs.IntVar(&cfg.RPS, "rps", 10, "requests per second")
+	fs.DurationVar(&cfg.Duration, "duration", 30*time.Second, "duration of the test")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 50, "maximum number of requests in flight")
+	fs.IntVar(&cfg.Seed, "seed", 3, "number of departments created before the test")
+	fs.StringVar(&cfg.Username, "username", os.Getenv("LOADTEST_USERNAME"), "username of an admin user")
+	fs.StringVar(&cfg.Password, "password", os.Getenv("LOADTEST_PASSWORD"), "password of the admin user")
+	fs.BoolVar(&cfg.Insecure, "insecure", false, "skip the TLS certificate verification (self-signed certificates)")
+	fs.DurationVar(&cfg.MaxP95, "slo-p95", 500*time.Millisecond, "maximum p95 latency")
+	fs.DurationVar(&cfg.MaxP99, "slo-p99", time.Second, "maximum p99 latency")
+	fs.Float64Var(&cfg.MaxErrorRate, "slo-error-rate", 0.01, "maximum error rate (0-1)")
+	fs.BoolVar(&cfg.CountLimited, "count-rate-limited", false, "count 429 responses as errors")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Username == "" || cfg.Password == "" {
+		return Config{}, fmt.Errorf("username and password are required")
+	}
+	if cfg.RPS <= 0 || cfg.Concurrency <= 0 || cfg.Duration <= 0 {
+		return Config{}, fmt.Errorf("rps, concurrency and duration must be positive")
+	}
+	if cfg.Scenario != ScenarioDepartments && cfg.Scenario != ScenarioLogin && cfg.Scenario != ScenarioMixed {
+		return Config{}, fmt.Errorf("unsupported scenario: %s", cfg.Scenario)
+	}
+
+	return cfg, nil
+}
+
+// Run runs the load test with the given command-line arguments and returns the exit code:
+// 0 when the SLOs are met, 1 when they are not and 2 when the test could not run.
+func Run(args []string, out io.Writer) int {
+	cfg, err := ParseConfig(args)
+	if err != nil {
+		fmt.Fprintf(out, "loadtest: %v\n", err)
+		return 2
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: cfg.Concurrency,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: cfg.Insecure},
+		},
+	}
+	runner := &Runner{cfg: cfg, client: client}
+
+	// Log in and seed the departments
+	fmt.Fprintf(out, "Logging in to %s as %s\n", cfg.Target, cfg.Username)
+	if err := runner.Login(); err != nil {
+		fmt.Fprintf(out, "loadtest: login failed: %v\n", err)
+		return 2
+	}
+
+	fmt.Fprintf(out, "Seeding %d departments\n", cfg.Seed)
+	if err := runner.Seed(); err != nil {
+		fmt.Fprintf(out, "loadtest: seeding failed: %v\n", err)
+		return 2
+	}
+
+	// Run the test and check the SLOs
+	fmt.Fprintf(out, "Running the %s scenario at %d req/s for %s\n", cfg.Scenario, cfg.RPS, cfg.Duration)
+	report := runner.Attack()
+	report.Print(out)
+
+	violations := report.CheckSLOs(cfg)
+	if len(violations) > 0 {
+		for _, v := range violations {
+			fmt.Fprintf(out, "SLO violated: %s\n", v)
+		}
+		return 1
+	}
+
+	fmt.Fprintln(out, "All SLOs met")
+	return 0
+}
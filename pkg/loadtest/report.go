@@ -0,0 +1,144 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Report collects the results of a load test.
+type Report struct {
+	mu          sync.Mutex
+	start       time.Time
+	elapsed     time.Duration
+	latencies   []time.Duration
+	statusCodes map[int]int
+	errors      map[string]int
+	dropped     int
+}
+
+// NewReport creates an empty report.
+func NewReport() *Report {
+	return &Report{
+		start:       time.Now(),
+		statusCodes: map[int]int{},
+		errors:      map[string]int{},
+	}
+}
+
+// AddResult records a completed request.
+func (r *Report) AddResult(status int, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies = append(r.latencies, latency)
+	r.statusCodes[status]++
+}
+
+// AddError records a request that failed without a response (e.g. timeout, connection refused).
+func (r *Report) AddError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errors[err.Error()]++
+}
+
+// AddDropped records a request not sent because the concurrency limit was reached.
+func (r *Report) AddDropped() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dropped++
+}
+
+// Finish stops the clock of the report.
+func (r *Report) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.elapsed = time.Since(r.start)
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+}
+
+// Total returns the number of requests attempted.
+func (r *Report) Total() int {
+	total := len(r.latencies) + r.dropped
+	for _, n := range r.errors {
+		total += n
+	}
+
+	return total
+}
+
+// Failures returns the number of failed requests: transport errors, dropped requests and 5xx responses.
+// 429 responses are only counted when countLimited is set, since the API rate limiters
+// throttle a single client regardless of the server capacity.
+func (r *Report) Failures(countLimited bool) int {
+	failures := r.dropped
+	for _, n := range r.errors {
+		failures += n
+	}
+	for status, n := range r.statusCodes {
+		if status >= 500 || (countLimited && status == http.StatusTooManyRequests) {
+			failures += n
+		}
+	}
+
+	return failures
+}
+
+// Percentile returns the latency percentile (0-100) of the completed requests.
+func (r *Report) Percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+
+	i := int(float64(len(r.latencies)-1) * p / 100)
+	return r.latencies[i]
+}
+
+// CheckSLOs returns the SLO violations of the report.
+func (r *Report) CheckSLOs(cfg Config) []string {
+	var violations []string
+	if p95 := r.Percentile(95); p95 > cfg.MaxP95 {
+		violations = append(violations, fmt.Sprintf("p95 latency %s > %s", p95, cfg.MaxP95))
+	}
+	if p99 := r.Percentile(99); p99 > cfg.MaxP99 {
+		violations = append(violations, fmt.Sprintf("p99 latency %s > %s", p99, cfg.MaxP99))
+	}
+
+	if total := r.Total(); total > 0 {
+		rate := float64(r.Failures(cfg.CountLimited)) / float64(total)
+		if rate > cfg.MaxErrorRate {
+			violations = append(violations, fmt.Sprintf("error rate %.2f%% > %.2f%%", rate*100, cfg.MaxErrorRate*100))
+		}
+	}
+
+	return violations
+}
+
+// Print writes a summary of the report.
+func (r *Report) Print(out io.Writer) {
+	fmt.Fprintf(out, "Requests:  %d in %s (%.1f req/s)\n", r.Total(), r.elapsed.Round(time.Millisecond), float64(r.Total())/r.elapsed.Seconds())
+	fmt.Fprintf(out, "Latency:   p50 %s, p95 %s, p99 %s, max %s\n",
+		r.Percentile(50), r.Percentile(95), r.Percentile(99), r.Percentile(100))
+
+	codes := make([]int, 0, len(r.statusCodes))
+	for code := range r.statusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(out, "Status %d: %d\n", code, r.statusCodes[code])
+	}
+
+	if r.dropped > 0 {
+		fmt.Fprintf(out, "Dropped:   %d (concurrency limit reached)\n", r.dropped)
+	}
+	for err, n := range r.errors {
+		fmt.Fprintf(out, "Error:     %s (%d)\n", err, n)
+	}
+}
@@ -0,0 +1,222 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner sends the requests of a load test.
+type Runner struct {
+	cfg           Config
+	client        *http.Client
+	token         string
+	tokenType     string
+	departmentIDs []string
+}
+
+// apiResponse is the standard response envelope of the API.
+type apiResponse struct {
+	Message string          `json:"message"`
+	Error   any             `json:"error"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Login logs in and keeps the access token for the next requests.
+func (r *Runner) Login() error {
+	body, _ := json.Marshal(map[string]string{"username": r.cfg.Username, "password": r.cfg.Password})
+
+	resp, err := r.do(http.MethodPost, "/auth/login", body, false)
+	if err != nil {
+		return err
+	}
+
+	var data struct {
+		AccessToken string `json:"accessToken"`
+		TokenType   string `json:"tokenType"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil || data.AccessToken == "" {
+		return errors.New("no access token in the login response")
+	}
+
+	r.token = data.AccessToken
+	r.tokenType = data.TokenType
+	if r.tokenType == "" {
+		r.tokenType = "Bearer"
+	}
+
+	return nil
+}
+
+// Seed creates the departments used by the test.
+// Their IDs are random so the test can run several times against the same environment,
+// an ID already taken (409 Conflict) is simply replaced by another one.
+func (r *Runner) Seed() error {
+	for attempt := 0; len(r.departmentIDs) < r.cfg.Seed; attempt++ {
+		if attempt >= r.cfg.Seed*10 {
+			return errors.New("too many department ID conflicts")
+		}
+
+		id := fmt.Sprintf("L%03d", rand.Intn(1000))
+		body, _ := json.Marshal(map[string]any{
+			"id":       id,
+			"deptName": fmt.Sprintf("Load Test %s", id),
+			"active":   true,
+		})
+
+		_, err := r.do(http.MethodPost, "/api/v1/departments", body, true)
+		if errors.Is(err, errConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		r.departmentIDs = append(r.departmentIDs, id)
+	}
+
+	return nil
+}
+
+// errConflict is returned by do when the resource already exists.
+var errConflict = errors.New("resource already exists")
+
+// do sends a request and decodes the response envelope.
+// Rate-limited requests are retried, as seeding must not fail because of the rate limiters.
+func (r *Runner) do(method string, path string, body []byte, auth bool) (apiResponse, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := r.newRequest(method, path, body, auth)
+		if err != nil {
+			return apiResponse{}, err
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return apiResponse{}, err
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 10 {
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		var apiResp apiResponse
+		json.Unmarshal(data, &apiResp)
+		if resp.StatusCode == http.StatusConflict {
+			return apiResp, errConflict
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return apiResp, fmt.Errorf("%s %s returned %d: %v", method, path, resp.StatusCode, apiResp.Error)
+		}
+
+		return apiResp, nil
+	}
+}
+
+// newRequest creates a request to the target.
+func (r *Runner) newRequest(method string, path string, body []byte, auth bool) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(r.cfg.Target, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth {
+		req.Header.Set("Authorization", r.tokenType+" "+r.token)
+	}
+
+	return req, nil
+}
+
+// nextRequest builds the next request of the scenario.
+func (r *Runner) nextRequest(n int) (*http.Request, error) {
+	scenario := r.cfg.Scenario
+	if scenario == ScenarioMixed {
+		// One login for every ten department requests
+		scenario = ScenarioDepartments
+		if n%10 == 0 {
+			scenario = ScenarioLogin
+		}
+	}
+
+	if scenario == ScenarioLogin {
+		body, _ := json.Marshal(map[string]string{"username": r.cfg.Username, "password": r.cfg.Password})
+		return r.newRequest(http.MethodPost, "/auth/login", body, false)
+	}
+
+	// Alternate between the listing and the seeded departments
+	if len(r.departmentIDs) == 0 || n%2 == 0 {
+		return r.newRequest(http.MethodGet, "/api/v1/departments", nil, true)
+	}
+	return r.newRequest(http.MethodGet, "/api/v1/departments/"+r.departmentIDs[n%len(r.departmentIDs)], nil, true)
+}
+
+// Attack sends the requests at the configured rate for the configured duration.
+// Requests are started on schedule even when the previous ones are still in flight,
+// up to the concurrency limit, so a slow server shows up as latency instead of a lower rate.
+func (r *Runner) Attack() *Report {
+	report := NewReport()
+	interval := time.Second / time.Duration(r.cfg.RPS)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, r.cfg.Concurrency)
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(r.cfg.Duration)
+
+	for n := 0; time.Now().Before(deadline); n++ {
+		<-ticker.C
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			// Too many requests in flight, the request is counted as dropped
+			report.AddDropped()
+			continue
+		}
+
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			req, err := r.nextRequest(n)
+			if err != nil {
+				report.AddError(err)
+				return
+			}
+
+			start := time.Now()
+			resp, err := r.client.Do(req)
+			if err != nil {
+				report.AddError(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			report.AddResult(resp.StatusCode, time.Since(start))
+		}(n)
+	}
+
+	wg.Wait()
+	report.Finish()
+	return report
+}
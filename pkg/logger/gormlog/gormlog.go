@@ -0,0 +1,127 @@
+package gormlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+// Package gormlog adapts the GORM SQL logger to pkg/logger, so the statements are written with the
+// application logs instead of the own output of GORM. Each entry carries the request_id and the user
+// of the context the statement ran with, the same fields as the request log, so a failed statement
+// can be tied to the API call that issued it.
+
+// DefaultSlowThreshold is the duration from which a statement is logged as slow.
+const DefaultSlowThreshold = 200 * time.Millisecond
+
+// Logger is a GORM logger writing the statements to the application logs.
+// The failed statements are logged at the Error level, the slow ones at the Warn level and,
+// at the Info level, every statement. A record not found is not a failure, the repositories expect it.
+type Logger struct {
+	Level         gormLogger.LogLevel
+	SlowThreshold time.Duration
+}
+
+// New creates a GORM logger at the given level, with DefaultSlowThreshold.
+func New(level gormLogger.LogLevel) *Logger {
+	return &Logger{Level: level, SlowThreshold: DefaultSlowThreshold}
+}
+
+// LogMode returns a copy of the logger at the given level.
+func (l *Logger) LogMode(level gormLogger.LogLevel) gormLogger.Interface {
+	copied := *l
+	copied.Level = level
+	return &copied
+}
+
+// Info logs a message of GORM at the Info level.
+func (l *Logger) Info(ctx context.Context, msg string, data ...any) {
+	if l.Level >= gormLogger.Info {
+		logger.Info(fmt.Sprintf(msg, data...), Fields(ctx))
+	}
+}
+
+// Warn logs a message of GORM at the Warn level.
+func (l *Logger) Warn(ctx context.Context, msg string, data ...any) {
+	if l.Level >= gormLogger.Warn {
+		logger.Warn(fmt.Sprintf(msg, data...), Fields(ctx))
+	}
+}
+
+// Error logs a message of GORM at the Error level.
+func (l *Logger) Error(ctx context.Context, msg string, data ...any) {
+	if l.Level >= gormLogger.Error {
+		logger.Error(fmt.Sprintf(msg, data...), Fields(ctx))
+	}
+}
+
+// Trace logs a statement once it has run, with its duration, its affected rows and its caller.
+func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.Level <= gormLogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.SlowThreshold > 0 && elapsed > l.SlowThreshold
+	switch {
+	case failed && l.Level >= gormLogger.Error:
+		fields := statementFields(ctx, elapsed, fc)
+		fields["error"] = err.Error()
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			fields["sqlstate"] = pgErr.Code
+		}
+		logger.Error("database statement failed", fields)
+	case slow && l.Level >= gormLogger.Warn:
+		logger.Warn(fmt.Sprintf("slow database statement (>= %s)", l.SlowThreshold), statementFields(ctx, elapsed, fc))
+	case l.Level >= gormLogger.Info:
+		logger.Info("database statement", statementFields(ctx, elapsed, fc))
+	}
+}
+
+// Fields returns the fields tying a log entry to the request of the context: its request_id and,
+// once authenticated, its user_id and username, and the impersonating admin.
+// It is empty outside of a request.
+func Fields(ctx context.Context) logrus.Fields {
+	fields := logrus.Fields{}
+	if ctx == nil {
+		return fields
+	}
+
+	if id := metacontext.RequestIDFrom(ctx); id != "" {
+		fields["request_id"] = id
+	}
+	if meta, ok := metacontext.RequestMetaFrom(ctx); ok {
+		fields["user_id"] = meta.UserID
+		fields["username"] = meta.UserName
+		if meta.ImpersonatedBy != 0 {
+			fields["impersonated_by"] = meta.ImpersonatedBy
+		}
+	}
+
+	return fields
+}
+
+// statementFields returns the fields of a statement: the request fields of the context, the SQL with
+// its bound values, the affected rows, the duration and the line of the application that issued it.
+func statementFields(ctx context.Context, elapsed time.Duration, fc func() (string, int64)) logrus.Fields {
+	sql, rows := fc()
+
+	fields := Fields(ctx)
+	fields["sql"] = sql
+	fields["rows"] = rows
+	fields["duration"] = elapsed.String()
+	fields["source"] = utils.FileWithLineNum()
+
+	return fields
+}
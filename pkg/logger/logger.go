@@ -30,10 +30,16 @@ var (
 	PANIC_LOG_FILE   = "logs/panic.log"
 	TRACE_LOG_FILE   = "logs/trace.log"
 	DEBUG_LOG_FILE   = "logs/debug.log"
+
+	// LogFiles is set to FALSE to log to the console (stdout) only,
+	// e.g. when the logs are shipped from stdout by the platform.
+	LogFiles string
 )
 
 func InitLoggers() {
 	once.Do(func() {
+		LogFiles = os.Getenv("LOG_FILES")
+
 		// Using TextFormatter for log formatting
 		// This allows for more human-readable logs
 		formatter := &logrus.TextFormatter{
@@ -111,45 +117,53 @@ func InitLoggers() {
 			Compress:   true,
 		}
 
+		// output returns the writer of a logger, the console only when the log files are disabled
+		output := func(file *lumberjack.Logger) io.Writer {
+			if LogFiles == "FALSE" {
+				return os.Stdout
+			}
+			return io.MultiWriter(os.Stdout, file)
+		}
+
 		// Configure each logger with the specified format and output
 		// The loggers will write to both the console (stdout) and the specified log files
 		RequestLogger = logrus.New()
-		RequestLogger.SetOutput(io.MultiWriter(os.Stdout, requestFile))
+		RequestLogger.SetOutput(output(requestFile))
 		RequestLogger.SetFormatter(formatter)
 		RequestLogger.SetLevel(logrus.InfoLevel)
 
 		InfoLogger = logrus.New()
-		InfoLogger.SetOutput(io.MultiWriter(os.Stdout, infoFile))
+		InfoLogger.SetOutput(output(infoFile))
 		InfoLogger.SetFormatter(formatter)
 		InfoLogger.SetLevel(logrus.InfoLevel)
 
 		WarnLogger = logrus.New()
-		WarnLogger.SetOutput(io.MultiWriter(os.Stdout, warnFile))
+		WarnLogger.SetOutput(output(warnFile))
 		WarnLogger.SetFormatter(formatter)
 		WarnLogger.SetLevel(logrus.WarnLevel)
 
 		ErrorLogger = logrus.New()
-		ErrorLogger.SetOutput(io.MultiWriter(os.Stdout, errorFile))
+		ErrorLogger.SetOutput(output(errorFile))
 		ErrorLogger.SetFormatter(formatter)
 		ErrorLogger.SetLevel(logrus.ErrorLevel)
 
 		FatalLogger = logrus.New()
-		FatalLogger.SetOutput(io.MultiWriter(os.Stdout, fatalFile))
+		FatalLogger.SetOutput(output(fatalFile))
 		FatalLogger.SetFormatter(formatter)
 		FatalLogger.SetLevel(logrus.FatalLevel)
 
 		PanicLogger = logrus.New()
-		PanicLogger.SetOutput(io.MultiWriter(os.Stdout, panicFile))
+		PanicLogger.SetOutput(output(panicFile))
 		PanicLogger.SetFormatter(formatter)
 		PanicLogger.SetLevel(logrus.PanicLevel)
 
 		TraceLogger = logrus.New()
-		TraceLogger.SetOutput(io.MultiWriter(os.Stdout, traceFile))
+		TraceLogger.SetOutput(output(traceFile))
 		TraceLogger.SetFormatter(formatter)
 		TraceLogger.SetLevel(logrus.TraceLevel)
 
 		DebugLogger = logrus.New()
-		DebugLogger.SetOutput(io.MultiWriter(os.Stdout, debugFile))
+		DebugLogger.SetOutput(output(debugFile))
 		DebugLogger.SetFormatter(formatter)
 		DebugLogger.SetLevel(logrus.DebugLevel)
 	})
@@ -0,0 +1,160 @@
+package loginthrottle
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+)
+
+// Package loginthrottle slows down the password guessing on a username, wherever the attempts come from.
+// The rate limiter keys on the client IP, which a password spraying spread over many addresses bypasses.
+// The failed logins of each username are counted in Redis over a sliding window (a sorted set of their times),
+// and from MaxFailures failures on the username is locked for BaseDelay, doubled with each further failure
+// up to MaxDelay. A successful login clears the failures of the username.
+// The unknown usernames are throttled like the others, so the throttle does not reveal the registered ones.
+
+const (
+	// failuresKeyPrefix is the prefix of the sorted sets holding the times of the failed logins of the usernames
+	failuresKeyPrefix = "login_failures:"
+
+	// lockKeyPrefix is the prefix of the keys locking the usernames, until the next attempt is allowed
+	lockKeyPrefix = "login_locked:"
+
+	defaultMaxFailures = 5
+	defaultWindow      = time.Hour
+	defaultBaseDelay   = 30 * time.Second
+	defaultMaxDelay    = 15 * time.Minute
+)
+
+// ErrLoginThrottled is returned when a username is locked after too many failed logins.
+var ErrLoginThrottled = apperror.New("LoginThrottled", http.StatusTooManyRequests, "too many failed logins for this username, try again later")
+
+// ThrottledError is ErrLoginThrottled with the time left before the next attempt on the username.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *ThrottledError) Error() string {
+	return ErrLoginThrottled.Error()
+}
+
+// Unwrap returns ErrLoginThrottled, so the error is answered like the other typed errors.
+func (e *ThrottledError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+var (
+	MaxFailures = defaultMaxFailures
+	Window      = defaultWindow
+	BaseDelay   = defaultBaseDelay
+	MaxDelay    = defaultMaxDelay
+)
+
+// LoadEnv loads environment variables
+// LOGIN_THROTTLE_MAX_FAILURES is the number of failures in the window locking a username (5 by default, 0 disables
+// the throttle), LOGIN_THROTTLE_WINDOW_MINUTES the window (60), LOGIN_THROTTLE_BASE_DELAY_SECONDS the first lock (30)
+// and LOGIN_THROTTLE_MAX_DELAY_MINUTES the longest one (15).
+func LoadEnv() {
+	MaxFailures = defaultMaxFailures
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_THROTTLE_MAX_FAILURES")); err == nil && n >= 0 {
+		MaxFailures = n
+	}
+
+	Window = defaultWindow
+	if minutes, err := strconv.Atoi(os.Getenv("LOGIN_THROTTLE_WINDOW_MINUTES")); err == nil && minutes > 0 {
+		Window = time.Duration(minutes) * time.Minute
+	}
+
+	BaseDelay = defaultBaseDelay
+	if seconds, err := strconv.Atoi(os.Getenv("LOGIN_THROTTLE_BASE_DELAY_SECONDS")); err == nil && seconds > 0 {
+		BaseDelay = time.Duration(seconds) * time.Second
+	}
+
+	MaxDelay = defaultMaxDelay
+	if minutes, err := strconv.Atoi(os.Getenv("LOGIN_THROTTLE_MAX_DELAY_MINUTES")); err == nil && minutes > 0 {
+		MaxDelay = time.Duration(minutes) * time.Minute
+	}
+}
+
+// Enabled reports whether the failed logins are throttled.
+func Enabled() bool {
+	return MaxFailures > 0
+}
+
+// Delay returns the lock of a username after the given number of failures in the window:
+// none below MaxFailures, then BaseDelay doubled with each further failure, up to MaxDelay.
+func Delay(failures int) time.Duration {
+	if !Enabled() || failures < MaxFailures {
+		return 0
+	}
+
+	delay := BaseDelay
+	for i := MaxFailures; i < failures && delay < MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxDelay {
+		delay = MaxDelay
+	}
+
+	return delay
+}
+
+// Check returns the time left before the next login attempt on the username, 0 when it is allowed.
+func Check(ctx context.Context, client *redis.Client, userName string) (time.Duration, error) {
+	ttl, err := client.PTTL(ctx, lockKeyPrefix+normalize(userName)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// A missing key answers a negative TTL
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// RecordFailure records a failed login on the username at the given time and locks the username
+// once it failed too often in the window. It returns the lock applied, 0 when the username is not locked.
+func RecordFailure(ctx context.Context, client *redis.Client, userName string, now time.Time) (time.Duration, error) {
+	key := failuresKeyPrefix + normalize(userName)
+
+	// The failures older than the window are dropped as the new one is added
+	var count *redis.IntCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-Window).UnixMicro(), 10))
+		pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.UnixMicro()), Member: now.UnixNano()})
+		count = pipe.ZCard(ctx, key)
+		pipe.PExpire(ctx, key, Window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	delay := Delay(int(count.Val()))
+	if delay > 0 {
+		if err := client.Set(ctx, lockKeyPrefix+normalize(userName), 1, delay).Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	return delay, nil
+}
+
+// Reset clears the failed logins of the username, after a successful login.
+func Reset(ctx context.Context, client *redis.Client, userName string) error {
+	return client.Del(ctx, failuresKeyPrefix+normalize(userName), lockKeyPrefix+normalize(userName)).Err()
+}
+
+// normalize returns the username as keyed in Redis, the variants of its case share their failures.
+func normalize(userName string) string {
+	return strings.ToLower(strings.TrimSpace(userName))
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package mailer provides the e-mail sending abstraction.
+// The mailer is selected by the MAILER environment variable: SMTP sends the messages to an SMTP relay,
+// LOG writes them to the application log (for development), and NONE drops them.
+
+// Message represents an e-mail message in plain text.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the interface implemented by the e-mail senders.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+var (
+	MailerType   string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	MailFrom     string
+
+	mu     sync.RWMutex
+	mailer Mailer = noopMailer{}
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	MailerType = os.Getenv("MAILER")
+	SMTPHost = os.Getenv("SMTP_HOST")
+	SMTPPort = os.Getenv("SMTP_PORT")
+	SMTPUser = os.Getenv("SMTP_USER")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	MailFrom = os.Getenv("MAIL_FROM")
+}
+
+// InitMailer initializes the mailer selected by the MAILER environment variable.
+// Sending is disabled when the variable is empty or set to NONE.
+func InitMailer() {
+	var m Mailer
+	switch strings.ToUpper(MailerType) {
+	case "SMTP":
+		sm, err := NewSMTPMailer(SMTPHost, SMTPPort, SMTPUser, SMTPPassword, MailFrom)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize SMTP mailer: %v", err))
+			return
+		}
+		m = sm
+	case "LOG":
+		m = logMailer{}
+	case "", "NONE":
+		m = noopMailer{}
+	default:
+		logger.Error(fmt.Sprintf("Unknown mailer: %s", MailerType))
+		return
+	}
+
+	SetMailer(m)
+}
+
+// SetMailer replaces the mailer, e.g. with a fake one in the tests.
+func SetMailer(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	mailer = m
+}
+
+// Send sends a message with the configured mailer.
+func Send(ctx context.Context, m Message) error {
+	mu.RLock()
+	current := mailer
+	mu.RUnlock()
+
+	return current.Send(ctx, m)
+}
+
+// noopMailer drops the messages.
+type noopMailer struct{}
+
+// Send implements the Mailer interface.
+func (noopMailer) Send(ctx context.Context, m Message) error {
+	return nil
+}
+
+// logMailer writes the messages to the application log instead of sending them.
+// It is meant for development, the messages may contain secrets such as reset tokens.
+type logMailer struct{}
+
+// Send implements the Mailer interface.
+func (logMailer) Send(ctx context.Context, m Message) error {
+	logger.Info(fmt.Sprintf("mail to %s: %s\n%s", m.To, m.Subject, m.Body))
+	return nil
+}
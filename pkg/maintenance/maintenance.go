@@ -0,0 +1,177 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package maintenance keeps track of the read-only mode used during the maintenance windows
+// (e.g. a database failover). While it is enabled, the mutating requests are refused with 503
+// and the reads keep working. The mode is stored in Redis, so it applies to every instance and
+// survives the restarts; the changes are broadcast with Pub/Sub, and every instance also rereads
+// the flag periodically, so a flag set directly in Redis is picked up as well.
+const (
+	// RedisKey is the Redis key holding the state of the read-only mode, absent when it is disabled
+	RedisKey = "maintenance_mode"
+
+	// RedisChannel is the Redis Pub/Sub channel used to broadcast the changes to every instance
+	RedisChannel = "maintenance_mode:changed"
+
+	// DefaultMessage is the message of the refused requests when the mode was enabled without one
+	DefaultMessage = "The service is in read-only mode for maintenance, please retry later"
+
+	// refreshInterval is the interval at which the flag is reread from Redis
+	refreshInterval = 10 * time.Second
+)
+
+// ErrReadOnly is returned for the mutating requests while the read-only mode is enabled.
+var ErrReadOnly = apperror.New("MaintenanceMode", http.StatusServiceUnavailable, "the service is in read-only mode for maintenance")
+
+// State describes the read-only mode.
+type State struct {
+	Enabled   bool       `json:"enabled"`
+	Message   string     `json:"message,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	EnabledBy string     `json:"enabledBy,omitempty"`
+}
+
+var current atomic.Pointer[State]
+
+// InitMaintenance reads the read-only mode from Redis and follows its changes.
+func InitMaintenance(client *redis.Client) {
+	if client == nil {
+		logger.Error("Failed to initialize maintenance mode: redis client is nil")
+		return
+	}
+
+	refresh(client)
+
+	// Listen for the changes published by the other instances, and reread the flag in case it was set directly
+	go subscribe(client)
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			refresh(client)
+		}
+	}()
+
+	if Current().Enabled {
+		logger.Warn("Maintenance mode is enabled, the mutating requests are refused")
+	}
+}
+
+// refresh reads the read-only mode from Redis.
+// The current state is kept when Redis is unreachable, so an outage does not toggle the mode.
+func refresh(client *redis.Client) {
+	payload, err := client.Get(context.Background(), RedisKey).Result()
+	if errors.Is(err, redis.Nil) {
+		Set(State{})
+		return
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get maintenance mode from Redis: %v", err))
+		return
+	}
+
+	Set(decode(payload))
+}
+
+// subscribe listens on the Redis channel and applies the states published by the other instances.
+func subscribe(client *redis.Client) {
+	pubsub := client.Subscribe(context.Background(), RedisChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		Set(decode(msg.Payload))
+	}
+}
+
+// decode decodes a state stored in Redis. An empty payload disables the mode, and any other
+// value that is not a state (e.g. "1" set by hand) enables it with the default message.
+func decode(payload string) State {
+	if payload == "" {
+		return State{}
+	}
+
+	var state State
+	if err := json.Unmarshal([]byte(payload), &state); err != nil {
+		return State{Enabled: true}
+	}
+
+	return state
+}
+
+// Set applies a state to this instance only. Use Enable and Disable to change the mode of every instance.
+func Set(state State) {
+	previous := current.Swap(&state)
+	if previous != nil && previous.Enabled != state.Enabled {
+		logger.Warn(fmt.Sprintf("Maintenance mode changed: enabled=%t", state.Enabled))
+	}
+}
+
+// Current returns the state of the read-only mode cached in memory.
+func Current() State {
+	if state := current.Load(); state != nil {
+		return *state
+	}
+
+	return State{}
+}
+
+// RefusalMessage returns the message of the refused requests.
+func (s State) RefusalMessage() string {
+	if s.Message != "" {
+		return s.Message
+	}
+
+	return DefaultMessage
+}
+
+// Enable enables the read-only mode on every instance.
+func Enable(ctx context.Context, client *redis.Client, message string, by string) (State, error) {
+	if client == nil {
+		return State{}, errors.New("redis client is nil")
+	}
+
+	now := time.Now()
+	state := State{Enabled: true, Message: message, Since: &now, EnabledBy: by}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return State{}, err
+	}
+
+	if err := client.Set(ctx, RedisKey, payload, 0).Err(); err != nil {
+		return State{}, err
+	}
+
+	// Update the local state right away instead of waiting for the Pub/Sub round trip
+	Set(state)
+
+	return state, client.Publish(ctx, RedisChannel, payload).Err()
+}
+
+// Disable disables the read-only mode on every instance.
+func Disable(ctx context.Context, client *redis.Client) (State, error) {
+	if client == nil {
+		return State{}, errors.New("redis client is nil")
+	}
+
+	if err := client.Del(ctx, RedisKey).Err(); err != nil {
+		return State{}, err
+	}
+
+	Set(State{})
+
+	return State{}, client.Publish(ctx, RedisChannel, "").Err()
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Package metrics provides the application-wide Prometheus registry.
+// Modules register their collectors here and the registry is exposed on the internal admin listener.
+var (
+	once     sync.Once
+	registry *prometheus.Registry
+)
+
+// GetRegistry returns a singleton instance of the Prometheus registry.
+// The Go runtime and process collectors are registered on first use.
+func GetRegistry() *prometheus.Registry {
+	once.Do(func() {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	})
+
+	return registry
+}
+
+// MustRegister registers the given collectors in the application registry.
+// It panics if a collector cannot be registered, which only happens on programming errors.
+func MustRegister(cs ...prometheus.Collector) {
+	GetRegistry().MustRegister(cs...)
+}
+
+// Handler returns the HTTP handler exposing the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(GetRegistry(), promhttp.HandlerOpts{})
+}
@@ -0,0 +1,94 @@
+package authorization
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// APIKeyAuthentication is a middleware function that authenticates the automation identities with their API key.
+// The key is read from the X-API-Key header and mapped to an identity whose roles are set in the context
+// instead of the JWT claims; the context marks the caller as an automation.
+// The keys are looked up in the identities file, then among the keys issued to the service accounts.
+func APIKeyAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Measure the lookup, the refused requests are measured when they are aborted
+		stop := timing.Start(c, "api-key")
+		defer stop()
+
+		identity, ok, err := apikey.Authenticate(c.Request.Context(), c.GetHeader(apikey.Header))
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to check the API key: %v", err))
+			util.JSONError(c, http.StatusInternalServerError, "Failed to authenticate", "The API key could not be checked")
+			c.Abort()
+			return
+		}
+		if !ok {
+			util.JSONError(c, http.StatusUnauthorized, "Invalid API key", "The API key is not mapped to any automation identity")
+			c.Abort()
+			return
+		}
+
+		// Inject the automation identity into the request context
+		// The service accounts only write the departments of their scope, like with their JWT
+		meta := metacontext.RequestMeta{
+			UserID:           identity.UserID,
+			UserName:         identity.Name,
+			Email:            identity.Email,
+			Roles:            identity.Roles,
+			Permissions:      permission.For(identity.Roles),
+			Automation:       true,
+			DepartmentScoped: identity.Departments != nil,
+			DepartmentScope:  identity.Departments,
+			RequestID:        c.Writer.Header().Get("X-Request-Id"),
+		}
+		ctx := metacontext.InjectRequestMeta(c.Request.Context(), meta)
+
+		// Set the new request context with the automation identity
+		c.Request = c.Request.WithContext(ctx)
+
+		stop()
+		c.Next()
+	}
+}
+
+// Authentication is a middleware function that authenticates the requests carrying an X-API-Key header
+// with their API key, and the other requests with their JWT.
+func Authentication() gin.HandlerFunc {
+	jwtValidation := JwtValidation()
+	apiKeyAuthentication := APIKeyAuthentication()
+
+	return func(c *gin.Context) {
+		if c.GetHeader(apikey.Header) != "" {
+			apiKeyAuthentication(c)
+			return
+		}
+
+		jwtValidation(c)
+	}
+}
+
+// OptionalAuthentication authenticates the requests carrying credentials like Authentication does,
+// and lets the requests without an Authorization or X-API-Key header (or access token cookie, see pkg/tokencookie)
+// through anonymously, without request metadata.
+// Invalid credentials are still refused, so a client never silently gets the anonymous view.
+func OptionalAuthentication() gin.HandlerFunc {
+	authentication := Authentication()
+
+	return func(c *gin.Context) {
+		if c.GetHeader(apikey.Header) == "" && c.GetHeader("Authorization") == "" && (!tokencookie.Enabled() || tokencookie.AccessToken(c.Request) == "") {
+			c.Next()
+			return
+		}
+
+		authentication(c)
+	}
+}
@@ -0,0 +1,52 @@
+package authorization
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mtls"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// ClientCertAuthentication is a middleware function that authenticates internal services with their client certificate.
+// The certificate has already been verified by the TLS handshake; it is mapped to a service account
+// whose identity and roles are set in the context instead of the JWT claims.
+func ClientCertAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get the verified client certificate from the TLS connection
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+			util.JSONError(c, http.StatusUnauthorized, "No client certificate provided", "A verified client certificate is required")
+			c.Abort()
+			return
+		}
+		cert := c.Request.TLS.VerifiedChains[0][0]
+
+		// Map the certificate to a service account
+		sa, ok := mtls.ResolveServiceAccount(cert)
+		if !ok {
+			util.JSONError(c, http.StatusForbidden, "Unknown client certificate", "The client certificate is not mapped to any service account")
+			c.Abort()
+			return
+		}
+
+		// Inject the service account information into the request context
+		// The service accounts are automations like the API key identities, they have no password nor session
+		meta := metacontext.RequestMeta{
+			UserID:      sa.UserID,
+			UserName:    sa.Name,
+			Email:       sa.Email,
+			Roles:       sa.Roles,
+			Permissions: permission.For(sa.Roles),
+			Automation:  true,
+			RequestID:   c.Writer.Header().Get("X-Request-Id"),
+		}
+		ctx := metacontext.InjectRequestMeta(c.Request.Context(), meta)
+
+		// Set the new request context with service account information
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package authorization
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// defaultFreshLoginMaxAge is the age of a login still considered fresh when FRESH_LOGIN_MAX_AGE_MINUTES is not set.
+const defaultFreshLoginMaxAge = 15 * time.Minute
+
+// FreshLoginMaxAge returns the age of a login still considered fresh, from FRESH_LOGIN_MAX_AGE_MINUTES.
+func FreshLoginMaxAge() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("FRESH_LOGIN_MAX_AGE_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+
+	return defaultFreshLoginMaxAge
+}
+
+// RequireFreshLogin is a middleware function guarding the sensitive endpoints from the remembered sessions,
+// which live much longer than the others: their access tokens are refused with 401 once the login that
+// started the session is older than maxAge, and the user has to log in again.
+// The tokens of the other sessions and the other identities are not concerned, they are short-lived.
+func RequireFreshLogin(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta, ok := metacontext.RequestMetaFrom(c.Request.Context())
+		if !ok || !meta.RememberMe {
+			c.Next()
+			return
+		}
+
+		if meta.AuthTime.IsZero() || time.Since(meta.AuthTime) > maxAge {
+			util.JSONError(c, http.StatusUnauthorized, "Fresh login required", "This action requires a recent login, please log in again")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
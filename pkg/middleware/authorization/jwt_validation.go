@@ -1,88 +1,267 @@
 package authorization
 
 import (
-	"errors"
+	"crypto"
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/revocation"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 )
 
+// defaultClockSkew is the tolerance of the time claims when JWT_CLOCK_SKEW_SECONDS is not set.
+const defaultClockSkew = 30 * time.Second
+
 var (
-	TokenType string
-	JWTSecret string
+	TokenType    string
+	JWTSecret    string
+	JWTIssuer    string
+	JWTAudiences []string
+	ClockSkew    time.Duration
 )
 
 // LoadEnv loads environment variables
+// JWT_ISSUER is the issuer the tokens must carry in their iss claim, and JWT_ALLOWED_AUDIENCES the comma-separated
+// audiences one of which the tokens must carry in their aud claim, JWT_AUDIENCE (the audience of the issued tokens)
+// when it is empty. The claims are not checked when they are not configured.
+// JWT_CLOCK_SKEW_SECONDS is the tolerance of the exp, nbf and iat claims for the clocks of the servers (30 by default).
 func LoadEnv() {
 	TokenType = os.Getenv("TOKEN_TYPE")
 	JWTSecret = os.Getenv("JWT_SECRET")
+	JWTIssuer = os.Getenv("JWT_ISSUER")
+
+	audiences := os.Getenv("JWT_ALLOWED_AUDIENCES")
+	if audiences == "" {
+		audiences = os.Getenv("JWT_AUDIENCE")
+	}
+	JWTAudiences = nil
+	for _, aud := range strings.Split(audiences, ",") {
+		if aud = strings.TrimSpace(aud); aud != "" {
+			JWTAudiences = append(JWTAudiences, aud)
+		}
+	}
+
+	ClockSkew = defaultClockSkew
+	if seconds, err := strconv.Atoi(os.Getenv("JWT_CLOCK_SKEW_SECONDS")); err == nil && seconds >= 0 {
+		ClockSkew = time.Duration(seconds) * time.Second
+	}
+}
+
+// newParser returns the parser of the access tokens, validating their signature method and their claims.
+// The tokens must expire, must not be issued in the future and must be issued by JWT_ISSUER when it is set,
+// the times allowing for the clock skew. The audience is checked by audienceAllowed.
+func newParser() *jwt.Parser {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg(), jwt.SigningMethodEdDSA.Alg(),
+		}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(ClockSkew),
+	}
+	if JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(JWTIssuer))
+	}
+
+	return jwt.NewParser(opts...)
+}
+
+// audienceAllowed reports whether the aud claim of a token lists one of the allowed audiences.
+// Every token is allowed when no audience is configured, the tokens without the claim are refused otherwise.
+func audienceAllowed(aud jwt.ClaimStrings) bool {
+	if len(JWTAudiences) == 0 {
+		return true
+	}
+
+	for _, a := range aud {
+		if slices.Contains(JWTAudiences, a) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// accessClaims are the claims of the access tokens issued by the auth service.
+// Decoding them into a struct avoids the map and the type assertions of jwt.MapClaims.
+type accessClaims struct {
+	UserID       int64    `json:"userid"`
+	UserName     string   `json:"username"`
+	Email        string   `json:"email"`
+	Roles        []string `json:"roles"`
+	TokenVersion int64    `json:"tokenversion"`
+	// Permissions are the permissions granted by the roles, nil for the tokens issued before the claim
+	Permissions []string `json:"permissions"`
+	// Departments is the department scope of the service accounts, nil when the claim is absent
+	Departments []string `json:"departments"`
+	// SessionID is the ID of the refresh token session the access token was issued for
+	SessionID string `json:"sid"`
+	// AuthTime is the time of the login that started the session, nil for the tokens without session
+	AuthTime *jwt.NumericDate `json:"auth_time"`
+	// RememberMe is set for the tokens of the remembered sessions
+	RememberMe bool `json:"remember_me"`
+	// ImpersonatedBy is the ID of the admin the impersonation token was issued to, 0 for the other tokens
+	ImpersonatedBy int64 `json:"impersonated_by"`
+	// ClientID is the ID of the OAuth2 client the token was issued to, empty for the tokens of the users
+	ClientID string `json:"client_id"`
+	// Scope is the space-separated list of the scopes granted to the client, the roles of its requests
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// claimsPool recycles the claims decoded on every authenticated request.
+var claimsPool = sync.Pool{New: func() any { return new(accessClaims) }}
+
+// releaseClaims clears the claims and returns them to the pool.
+func releaseClaims(claims *accessClaims) {
+	*claims = accessClaims{}
+	claimsPool.Put(claims)
+}
+
+// newKeyFunc returns the function selecting the key validating a token.
+// The public keys are loaded on first use and kept per algorithm (RS256, ES256 or EdDSA),
+// the files are no longer read on every request.
+// The key is picked by the kid header of the token, so the tokens signed by a previous key still validate.
+func newKeyFunc(secret []byte) jwt.Keyfunc {
+	var (
+		mu         sync.Mutex
+		publicKeys = map[string][]crypto.PublicKey{}
+	)
+
+	return func(token *jwt.Token) (interface{}, error) {
+		// For HS256 signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			return secret, nil
+		}
+
+		// For the RS256, ES256 and EdDSA signing methods, the key files must hold keys of the algorithm of the token
+		alg := token.Method.Alg()
+		mu.Lock()
+		defer mu.Unlock()
+		keys, ok := publicKeys[alg]
+		if !ok {
+			// Load the public keys from the environment variables
+			loaded, err := util.LoadPublicKeys(alg)
+			if err != nil {
+				return nil, err
+			}
+			keys = loaded
+			publicKeys[alg] = keys
+		}
+
+		// Return the public key named by the token for validation
+		kid, _ := token.Header["kid"].(string)
+		return util.FindPublicKey(keys, kid)
+	}
 }
 
 // JwtValidation is a middleware function that checks for a valid JWT token in the request header.
 // It extracts the token from the "Authorization" header, validates it, and sets the user information in the context.
+// When the tokens are delivered in cookies (see pkg/tokencookie), the access token cookie is used without the header.
 func JwtValidation() gin.HandlerFunc {
 	// Load environment variables
 	LoadEnv()
 
+	// The parser and the keys are prepared once instead of on every request
+	parser := newParser()
+	keyFunc := newKeyFunc([]byte(JWTSecret))
+
 	return func(c *gin.Context) {
-		// Get the token from the request header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			util.JSONError(c, http.StatusUnauthorized, "No token provided", "Authorization header is missing")
-			c.Abort()
-			return
-		}
+		// Measure the validation, the refused requests are measured when they are aborted
+		stop := timing.Start(c, "jwt")
+		defer stop()
 
-		// Check if the token starts with TokenType
-		tokenPrefix := TokenType + " "
-		if !strings.HasPrefix(authHeader, tokenPrefix) {
-			util.JSONError(c, http.StatusUnauthorized, "Invalid token format", fmt.Sprintf("Token must start with '%s'", tokenPrefix))
-			c.Abort()
-			return
+		// Get the token from the request header, or from its cookie
+		authHeader := c.GetHeader("Authorization")
+		tokenStr := ""
+		if authHeader == "" && tokencookie.Enabled() {
+			tokenStr = tokencookie.AccessToken(c.Request)
 		}
-
-		// Extract the token string
-		tokenStr := strings.TrimPrefix(authHeader, tokenPrefix)
-		if tokenStr == "" {
-			util.JSONError(c, http.StatusUnauthorized, "Invalid token format", "Token string is empty")
+		if authHeader == "" && tokenStr == "" {
+			util.JSONError(c, http.StatusUnauthorized, "No token provided", "Authorization header is missing")
 			c.Abort()
 			return
 		}
 
-		// Parse the token and validate it
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			// For HS256 signing method
-			if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
-				// Validate the token signing method
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.New("unexpected signing method")
-				}
-
-				// Return the secret key for validation
-				return []byte(JWTSecret), nil
+		if authHeader != "" {
+			// Check if the token starts with TokenType
+			tokenPrefix := TokenType + " "
+			if !strings.HasPrefix(authHeader, tokenPrefix) {
+				util.JSONError(c, http.StatusUnauthorized, "Invalid token format", fmt.Sprintf("Token must start with '%s'", tokenPrefix))
+				c.Abort()
+				return
 			}
 
-			// For RS256 signing method
-			// Load the public key from the environment variable
-			publicKey, err := util.LoadPublicKey()
-			if err != nil {
-				return nil, err
-			}
-
-			// Validate the token signing method
-			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-				return nil, errors.New("unexpected signing method")
+			// Extract the token string
+			tokenStr = strings.TrimPrefix(authHeader, tokenPrefix)
+			if tokenStr == "" {
+				util.JSONError(c, http.StatusUnauthorized, "Invalid token format", "Token string is empty")
+				c.Abort()
+				return
 			}
+		}
 
-			// Return the public key for validation
-			return publicKey, nil
-		})
+		// Parse the token into pooled typed claims and validate it
+		// The claims go back to the pool once copied, the strings and roles are not reused
+		claims := claimsPool.Get().(*accessClaims)
+		token, err := parser.ParseWithClaims(tokenStr, claims, keyFunc)
+		// The tokens minted for another application sharing the key are refused
+		if err == nil && !audienceAllowed(claims.Audience) {
+			err = jwt.ErrTokenInvalidAudience
+		}
+		tokenVersion := claims.TokenVersion
+		var issuedAt, expiresAt, authTime time.Time
+		if claims.AuthTime != nil {
+			authTime = claims.AuthTime.Time
+		}
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		if claims.ExpiresAt != nil {
+			expiresAt = claims.ExpiresAt.Time
+		}
+		meta := metacontext.RequestMeta{
+			UserID:           claims.UserID,
+			UserName:         claims.UserName,
+			Email:            claims.Email,
+			Roles:            claims.Roles,
+			Permissions:      claims.Permissions,
+			DepartmentScoped: claims.Departments != nil,
+			DepartmentScope:  claims.Departments,
+			SessionID:        claims.SessionID,
+			AuthTime:         authTime,
+			RememberMe:       claims.RememberMe,
+			TokenID:          claims.ID,
+			TokenExpiresAt:   expiresAt,
+			ImpersonatedBy:   claims.ImpersonatedBy,
+			RequestID:        c.Writer.Header().Get("X-Request-Id"),
+		}
+		// The tokens of the clients carry their scopes as roles, the clients are automations named by their ID
+		if claims.ClientID != "" {
+			meta.UserName = claims.ClientID
+			meta.Roles = strings.Fields(claims.Scope)
+			meta.Automation = true
+		}
+		// The permissions of the tokens without the claim (the clients and the older tokens) follow their roles
+		if meta.Permissions == nil {
+			meta.Permissions = permission.For(meta.Roles)
+		}
+		releaseClaims(claims)
 
 		if err != nil {
 			util.JSONError(c, http.StatusUnauthorized, "Invalid token", err.Error())
@@ -91,29 +270,42 @@ func JwtValidation() gin.HandlerFunc {
 		}
 
 		// Check if the token is valid
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
+		if !token.Valid {
 			util.JSONError(c, http.StatusUnauthorized, "Invalid token", "Token is not valid")
 			c.Abort()
 			return
 		}
 
-		// Get the user ID from the claims
-		// Convert the user ID to int64
-		userID, _ := util.GetInt64Claim(claims, "userid")
+		// Reject tokens issued before the last global token version bump
+		// Tokens without the claim are treated as version 0
+		if tokenVersion < tokenversion.Current() {
+			util.JSONError(c, http.StatusUnauthorized, "Invalid token", "Token has been revoked, please log in again")
+			c.Abort()
+			return
+		}
 
-		// Inject user information into the request context
-		meta := metacontext.RequestMeta{
-			UserID:   userID,
-			UserName: claims["username"].(string),
-			Email:    claims["email"].(string),
-			Roles:    util.GetStringSliceClaim(claims, "roles"),
+		// Reject the tokens of a user whose sessions were revoked after they were issued (e.g. a disabled user),
+		// the tokens of a revoked session and the revoked tokens themselves (the denylist of the jti claims)
+		// A Redis failure is logged and does not block the request, the disabled users cannot renew their tokens anyway
+		if redisClient := dbcontext.GetRedisClient(c.Request.Context()); redisClient != nil {
+			revoked, err := revocation.IsRevoked(c.Request.Context(), redisClient, meta.UserID, meta.SessionID, meta.TokenID, issuedAt)
+			if err != nil {
+				logger.Error(fmt.Sprintf("failed to check the revocation of the tokens of user %d: %v", meta.UserID, err))
+			}
+			if revoked {
+				util.JSONError(c, http.StatusUnauthorized, "Invalid token", "Token has been revoked, please log in again")
+				c.Abort()
+				return
+			}
 		}
+
+		// Inject user information into the request context
 		ctx := metacontext.InjectRequestMeta(c.Request.Context(), meta)
 
 		// Set the new request context with user information
 		c.Request = c.Request.WithContext(ctx)
 
+		stop()
 		c.Next()
 	}
 }
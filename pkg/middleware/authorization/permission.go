@@ -0,0 +1,40 @@
+package authorization
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// RequirePermission is a middleware function that checks if the request is granted all the given permissions,
+// e.g. "audit:read", instead of one of a list of roles (see pkg/permission for the permissions of the roles).
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Measure the check, the denied requests are measured when they are aborted
+		stop := timing.Start(c, "rbac")
+		defer stop()
+
+		// Extract user metadata from the context
+		meta, ok := metacontext.RequestMetaFrom(c.Request.Context())
+		if !ok {
+			util.JSONError(c, http.StatusInternalServerError, "Failed to extract metadata", "Unable to extract user metadata from context")
+			c.Abort()
+			return
+		}
+
+		for _, p := range permissions {
+			if !meta.HasPermission(p) {
+				util.JSONError(c, http.StatusForbidden, "Access denied", fmt.Sprintf("User does not have the %s permission", p))
+				c.Abort()
+				return
+			}
+		}
+
+		stop()
+		c.Next()
+	}
+}
@@ -0,0 +1,35 @@
+package authorization
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// QuotaOverride is a middleware function that lets an admin create entities beyond their quota (see pkg/quota).
+// The override is requested with the X-Quota-Override: true header. It is only granted to the users with
+// ROLE_ADMIN, the automation identities and the other users requesting it are refused with 403,
+// so a script cannot silently bypass the quotas.
+func QuotaOverride() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.EqualFold(c.GetHeader(quota.OverrideHeader), "true") {
+			c.Next()
+			return
+		}
+
+		meta, ok := metacontext.RequestMetaFrom(c.Request.Context())
+		if !ok || meta.Automation || !slices.Contains(meta.Roles, "ROLE_ADMIN") {
+			util.JSONError(c, http.StatusForbidden, "Access denied", "Only the admins can override the quotas")
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(quota.WithOverride(c.Request.Context()))
+		c.Next()
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 )
 
@@ -12,14 +13,19 @@ import (
 // It retrieves the user roles from the context and compares them with the allowed roles.
 func RoleBasedAccessControl(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Measure the check, the denied requests are measured when they are aborted
+		stop := timing.Start(c, "rbac")
+		defer stop()
+
 		// If no allowed roles are provided, allow access
 		if len(allowedRoles) == 0 {
+			stop()
 			c.Next()
 			return
 		}
 
 		// Extract user metadata from the context
-		meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+		meta, ok := metacontext.RequestMetaFrom(c.Request.Context())
 		if !ok {
 			util.JSONError(c, http.StatusInternalServerError, "Failed to extract metadata", "Unable to extract user metadata from context")
 			c.Abort()
@@ -39,6 +45,7 @@ func RoleBasedAccessControl(allowedRoles ...string) gin.HandlerFunc {
 		for _, role := range userRoles {
 			for _, allowed := range allowedRoles {
 				if role == allowed {
+					stop()
 					c.Next()
 					return
 				}
@@ -0,0 +1,60 @@
+package authorization
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// defaultRecentAuthMaxAge is the age of an authentication still considered recent when RECENT_AUTH_MAX_AGE_MINUTES is not set.
+const defaultRecentAuthMaxAge = 10 * time.Minute
+
+// RecentAuthMaxAge returns the age of an authentication still considered recent, from RECENT_AUTH_MAX_AGE_MINUTES.
+func RecentAuthMaxAge() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("RECENT_AUTH_MAX_AGE_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+
+	return defaultRecentAuthMaxAge
+}
+
+// RequireRecentAuth is a middleware function guarding the destructive endpoints with a step-up authentication:
+// the access tokens whose auth_time claim, the last time the user entered their password, is older than maxAge
+// are refused with 401 and a WWW-Authenticate challenge (RFC 9470), and the user re-authenticates with
+// POST /auth/reauth. The tokens without auth_time (e.g. the impersonations) are refused as well, the automation
+// identities (the clients and the API keys) have no password to enter and are not concerned.
+// A request without an authenticated identity is refused with 401.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta, ok := metacontext.RequestMetaFrom(c.Request.Context())
+		if !ok {
+			util.JSONError(c, http.StatusUnauthorized, "Authentication required", "This action requires an authenticated user")
+			c.Abort()
+			return
+		}
+		if meta.Automation {
+			c.Next()
+			return
+		}
+
+		if meta.AuthTime.IsZero() || time.Since(meta.AuthTime) > maxAge {
+			scheme := TokenType
+			if scheme == "" {
+				scheme = "Bearer"
+			}
+			c.Header("WWW-Authenticate", fmt.Sprintf(`%s error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`,
+				scheme, int(maxAge.Seconds())))
+			util.JSONError(c, http.StatusUnauthorized, "Re-authentication required", "This action requires a recent authentication, re-authenticate with POST /auth/reauth")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
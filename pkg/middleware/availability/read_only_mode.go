@@ -0,0 +1,36 @@
+package availability
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// retryAfterSeconds is the delay suggested to the clients whose request was refused
+const retryAfterSeconds = 60
+
+// ReadOnlyMode is a middleware function that refuses the mutating requests while the maintenance mode is enabled.
+// The requests are classified by method: GET, HEAD and OPTIONS are reads and always go through,
+// the other methods are answered with 503, a Retry-After header and the maintenance message.
+func ReadOnlyMode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		state := maintenance.Current()
+		if !state.Enabled {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+		util.JSONAppErrorWithData(c, state.RefusalMessage(), maintenance.ErrReadOnly, state)
+		c.Abort()
+	}
+}
@@ -0,0 +1,151 @@
+package chain
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+)
+
+// Package chain orders the router middlewares and lets the route groups opt out of some of them.
+// The router middlewares run before the middlewares of the groups, so a group cannot remove them itself:
+// the opt-outs are declared on the chain with the group, and looked up with the matched route of the request.
+// The streaming routes (e.g. Server-Sent Events) opt out of the compression and the buffering,
+// which hold the written data back and break the flushing.
+
+// Stage is the position of a middleware in the chain, the lower stages run first (outermost).
+// The middlewares of the same stage run in the order they were added.
+type Stage int
+
+const (
+	// StageContext injects the request-scoped clients (database, Redis)
+	StageContext Stage = 100
+
+	// StageHeaders sets the response headers (security, CORS, request ID)
+	StageHeaders Stage = 200
+
+	// StageLogging logs the requests, outside of the compression so the logged size is the sent one
+	StageLogging Stage = 300
+
+	// StageCompression compresses the response, innermost so the handlers and the buffering
+	// middlewares of the groups work on the uncompressed body
+	StageCompression Stage = 400
+)
+
+// Feature is a behaviour of a middleware that the groups can opt out of.
+type Feature string
+
+const (
+	// Compression is the compression of the responses (e.g. gzip)
+	Compression Feature = "compression"
+
+	// Buffering is the holding of the whole response before it is sent (e.g. response signature)
+	Buffering Feature = "buffering"
+)
+
+// Streaming are the features that the streaming routes must opt out of.
+var Streaming = []Feature{Compression, Buffering}
+
+// Middleware is a middleware with its position in the chain.
+// The feature is empty when the middleware cannot be opted out of.
+type Middleware struct {
+	Name    string
+	Stage   Stage
+	Feature Feature
+	Handler gin.HandlerFunc
+}
+
+// Chain is the ordered list of the router middlewares and the opt-outs of the groups.
+type Chain struct {
+	middlewares []Middleware
+
+	mu      sync.RWMutex
+	optOuts map[string][]Feature
+}
+
+// New creates a chain with the given middlewares.
+func New(middlewares ...Middleware) *Chain {
+	ch := &Chain{optOuts: make(map[string][]Feature)}
+	ch.Add(middlewares...)
+
+	return ch
+}
+
+// Add adds middlewares to the chain.
+func (ch *Chain) Add(middlewares ...Middleware) {
+	ch.middlewares = append(ch.middlewares, middlewares...)
+	sort.SliceStable(ch.middlewares, func(i, j int) bool { return ch.middlewares[i].Stage < ch.middlewares[j].Stage })
+}
+
+// Middlewares returns the middlewares in the order they run.
+func (ch *Chain) Middlewares() []Middleware {
+	return append([]Middleware(nil), ch.middlewares...)
+}
+
+// Handlers returns the handlers of the middlewares in the order they run.
+// The handlers of the middlewares with a feature are skipped on the routes that opted out of it.
+// Each middleware is measured under its name (see pkg/middleware/timing), with the time spent in its response
+// writer for the middlewares with a feature, which hold or transform the written data.
+func (ch *Chain) Handlers() []gin.HandlerFunc {
+	handlers := make([]gin.HandlerFunc, 0, 1+2*len(ch.middlewares))
+	handlers = append(handlers, timing.Track())
+	for _, m := range ch.middlewares {
+		handler := m.Handler
+		if m.Feature != "" {
+			handler = ch.Skippable(m.Feature, m.Handler)
+		}
+		handlers = append(handlers, timing.Measure(m.Name, handler, m.Feature != "")...)
+	}
+
+	return handlers
+}
+
+// Apply adds the handlers of the chain to the router.
+// It must be called before the routes are registered, like gin.Engine.Use.
+func (ch *Chain) Apply(r *gin.Engine) {
+	r.Use(ch.Handlers()...)
+}
+
+// OptOut makes the routes of the group skip the middlewares with the given features.
+func (ch *Chain) OptOut(rg *gin.RouterGroup, features ...Feature) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	prefix := strings.TrimSuffix(rg.BasePath(), "/")
+	ch.optOuts[prefix] = append(ch.optOuts[prefix], features...)
+}
+
+// OptedOut reports whether the route with the given path opted out of the feature.
+// The path is the route pattern, as returned by gin.Context.FullPath.
+func (ch *Chain) OptedOut(path string, feature Feature) bool {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	for prefix, features := range ch.optOuts {
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		for _, f := range features {
+			if f == feature {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Skippable wraps a middleware with the given feature, so that it is skipped on the routes that opted out of it.
+// It is used for the middlewares of the groups, e.g. the response signature.
+func (ch *Chain) Skippable(feature Feature, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ch.OptedOut(c.FullPath(), feature) {
+			c.Next()
+			return
+		}
+
+		handler(c)
+	}
+}
@@ -0,0 +1,33 @@
+package context
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+)
+
+// StatementTimeout is a middleware function that bounds the database statements of the request.
+// The GET and HEAD requests get the read timeout and the other requests the write timeout.
+// It replaces the database connection injected by PostgresDBContext with a bounded session, so a route
+// can override the timeout of its group (e.g. a longer one for the bulk operations).
+func StatementTimeout(read, write time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := dbcontext.GetDB(c.Request.Context())
+		if db == nil {
+			c.Next()
+			return
+		}
+
+		timeout := write
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			timeout = read
+		}
+
+		ctx := dbcontext.InjectDB(c.Request.Context(), dbtimeout.WithStatementTimeout(db, timeout))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package headers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// CSRFProtection is a middleware function that protects the cookie authentication from the other sites.
+// When the tokens are delivered in cookies (see pkg/tokencookie), the state-changing requests carrying a token
+// cookie must send back the CSRF token of their cookie in the X-CSRF-Token header, or they are refused with 403.
+// The requests authenticated with a header (Authorization or X-API-Key) cannot be forged by the other sites,
+// they are not checked, nor are the safe methods (GET, HEAD and OPTIONS).
+func CSRFProtection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokencookie.Enabled() || !tokencookie.HasTokens(c.Request) {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		if c.GetHeader("Authorization") != "" || c.GetHeader(apikey.Header) != "" {
+			c.Next()
+			return
+		}
+
+		if !tokencookie.ValidCSRFToken(c.Request) {
+			util.JSONError(c, http.StatusForbidden, "Invalid CSRF token", "The "+tokencookie.CSRFHeader+" header must match the CSRF token cookie")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -10,7 +10,7 @@ func RequestCorsHeader() gin.HandlerFunc {
 		header.Set("Access-Control-Allow-Origin", "http://localhost")
 		header.Set("Access-Control-Max-Age", "86400")
 		header.Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, UPDATE")
-		header.Set("Access-Control-Allow-Headers", "X-Requested-With, Content-Type, Origin, Authorization, Accept, Client-Security-Token, Accept-Encoding, x-access-token")
+		header.Set("Access-Control-Allow-Headers", "X-Requested-With, Content-Type, Origin, Authorization, Accept, Client-Security-Token, Accept-Encoding, x-access-token, X-Quota-Override, X-CSRF-Token")
 		header.Set("Access-Control-Expose-Headers", "Content-Length")
 		header.Set("Access-Control-Allow-Credentials", "true")
 
@@ -3,14 +3,17 @@ package headers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
 )
 
 // RequestIDHeader is a middleware function that generates a unique request ID for each incoming request.
-// It sets the request ID in the response header "X-Request-Id".
+// It sets the request ID in the response header "X-Request-Id" and in the request context,
+// where the logs of the request read it before the authentication.
 func RequestIDHeader() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := uuid.New()
 		c.Writer.Header().Set("X-Request-Id", id.String())
+		c.Request = c.Request.WithContext(metacontext.InjectRequestID(c.Request.Context(), id.String()))
 
 		c.Next()
 	}
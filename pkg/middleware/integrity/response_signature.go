@@ -0,0 +1,91 @@
+package integrity
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/signing"
+)
+
+// bufferedWriter holds the response body and status until the signature is computed.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// ResponseSignature is a middleware function that adds a detached signature to the response.
+// The response is buffered, signed with the configured key and sent with the X-Signature,
+// X-Signature-Key-Id and X-Signature-Timestamp headers. It does nothing when response signing is disabled.
+// The signature covers the uncompressed body, so the middleware must run inside the gzip middleware.
+func ResponseSignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		signer := signing.GetSigner()
+		if signer == nil {
+			c.Next()
+			return
+		}
+
+		// Buffer the response written by the handlers
+		original := c.Writer
+		w := &bufferedWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = w
+
+		c.Next()
+
+		c.Writer = original
+
+		// Sign the response
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		body := w.body.Bytes()
+		signature, err := signer.Sign(signing.SigningString(timestamp, c.Request.Method, c.Request.URL.Path, body))
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to sign response: %v", err))
+		} else {
+			original.Header().Set(signing.HeaderSignature, signing.FormatSignature(signer.Algorithm(), signature))
+			original.Header().Set(signing.HeaderSignatureTimestamp, timestamp)
+			if signer.KeyID() != "" {
+				original.Header().Set(signing.HeaderSignatureKeyID, signer.KeyID())
+			}
+		}
+
+		// Send the buffered response
+		original.WriteHeader(w.status)
+		if len(body) > 0 {
+			original.Write(body)
+		} else {
+			original.WriteHeaderNow()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/slo"
+)
+
+// budgetWriter checks the latency budget when the response headers are sent, the last moment they can be tagged.
+type budgetWriter struct {
+	gin.ResponseWriter
+	check func()
+}
+
+func (w *budgetWriter) WriteHeaderNow() {
+	w.check()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *budgetWriter) Write(data []byte) (int, error) {
+	w.check()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *budgetWriter) WriteString(s string) (int, error) {
+	w.check()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *budgetWriter) Flush() {
+	w.check()
+	w.ResponseWriter.Flush()
+}
+
+// LatencyBudget is a middleware function that checks the successful responses against the latency budget of their
+// route (see pkg/slo). The latency is the time until the response headers are sent, so a response over its budget
+// is tagged with the X-Latency-Budget-Exceeded header; it is also logged as a warning with the link to its trace
+// and counted in the SLO metrics. The error responses are not part of the happy path and are not checked.
+func LatencyBudget() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		budget, ok := slo.Budget(route)
+		if !ok || c.FullPath() == "" {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		var latency time.Duration
+		checked, exceeded := false, false
+		original := c.Writer
+		check := func() {
+			if checked {
+				return
+			}
+			checked = true
+
+			latency = time.Since(start)
+			exceeded = latency > budget && original.Status() < http.StatusBadRequest
+			if exceeded && !original.Written() {
+				original.Header().Set(slo.HeaderExceeded, budget.String())
+			}
+		}
+		c.Writer = &budgetWriter{ResponseWriter: original, check: check}
+
+		c.Next()
+
+		c.Writer = original
+
+		// The responses without a body are sent by Gin once the handlers return
+		check()
+		if original.Status() >= http.StatusBadRequest {
+			return
+		}
+
+		slo.Observe(route, exceeded)
+		if !exceeded {
+			return
+		}
+
+		fields := logrus.Fields{
+			"route":      route,
+			"path":       c.Request.URL.Path,
+			"status":     original.Status(),
+			"latency":    latency.String(),
+			"budget":     budget.String(),
+			"request_id": c.Writer.Header().Get("X-Request-Id"),
+		}
+		if link := slo.TraceLink(c.Writer.Header().Get("X-Request-Id")); link != "" {
+			fields["trace"] = link
+		}
+
+		logger.Warn(fmt.Sprintf("Response of %s exceeded its latency budget of %s", route, budget), fields)
+	}
+}
@@ -19,7 +19,7 @@ func RequestLogger() gin.HandlerFunc {
 		c.Next()
 
 		// Extract user metadata from the context
-		meta, ok := metacontext.ExtractRequestMeta(c.Request.Context())
+		meta, ok := metacontext.RequestMetaFrom(c.Request.Context())
 		if !ok {
 			// If metadata extraction fails, log an error and return
 			logger.RequestLogger.Error("Failed to extract metadata from context")
@@ -39,7 +39,7 @@ func RequestLogger() gin.HandlerFunc {
 		// Then log the request details
 		// This is done after the request is processed to capture the response status and duration
 		duration := time.Since(start)
-		logger.RequestLogger.WithFields(logrus.Fields{
+		fields := logrus.Fields{
 			"content_length": c.Request.ContentLength,
 			"content_type":   c.ContentType(),
 			"duration":       duration.String(),
@@ -53,6 +53,13 @@ func RequestLogger() gin.HandlerFunc {
 			"user_agent":     c.Request.UserAgent(),
 			"username":       username,
 			"roles":          userRoles,
-		}).Info("Incoming request")
+		}
+
+		// The requests made with an impersonation token are attributed to the admin as well
+		if meta.ImpersonatedBy != 0 {
+			fields["impersonated_by"] = meta.ImpersonatedBy
+		}
+
+		logger.RequestLogger.WithFields(fields).Info("Incoming request")
 	}
 }
@@ -3,29 +3,52 @@ package ratelimiter
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 	"golang.org/x/time/rate"
 )
 
+// Backends of the rate limiter
+const (
+	BackendMemory = "MEMORY"
+	BackendRedis  = "REDIS"
+)
+
+// RateLimiterBackend selects where the visitors are counted: MEMORY (default) keeps them in the
+// instance, so the limits apply per replica; REDIS shares them between all the replicas.
+var RateLimiterBackend = BackendMemory
+
 var visitors = make(map[string]*rate.Limiter)
 var lastSeen = make(map[string]time.Time)
 
 var mu sync.Mutex
 
+// LoadEnv loads environment variables
+func LoadEnv() {
+	RateLimiterBackend = strings.ToUpper(os.Getenv("RATE_LIMITER_BACKEND"))
+	if RateLimiterBackend != BackendRedis {
+		RateLimiterBackend = BackendMemory
+	}
+}
+
+// visitorKey returns the key identifying the visitor of the requested route.
+func visitorKey(c *gin.Context) string {
+	return fmt.Sprintf("%s:%s:%s", c.ClientIP(), c.Request.Method, c.Request.URL.Path)
+}
+
 // getVisitor retrieves the visitor from the map or creates a new one if it doesn't exist.
 // It updates the last seen time and returns the rate limiter for that visitor.
 func getVisitor(c *gin.Context, r rate.Limit, b int) *rate.Limiter {
 	now := time.Now()
 
 	// Set key to the visitor
-	ip := c.ClientIP()
-	method := c.Request.Method
-	path := c.Request.URL.Path
-	key := fmt.Sprintf("%s:%s:%s", ip, method, path)
+	key := visitorKey(c)
 
 	// Check if the visitor exists in the map
 	// If it doesn't exist, create a new rate limiter and add it to the map
@@ -64,10 +87,19 @@ func startVisitorCleanup(expireAfter time.Duration) {
 }
 
 // RateLimiter middleware using sync.Map and expiration
+// With the REDIS backend the visitors are counted in Redis and expire on their own.
 func RateLimiter(r rate.Limit, burst int, expireAfter time.Duration) gin.HandlerFunc {
+	if RateLimiterBackend == BackendRedis {
+		return redisRateLimiter(r, burst)
+	}
+
 	startVisitorCleanup(expireAfter)
 
 	return func(c *gin.Context) {
+		// Measure the check, the rejected requests are measured when they are aborted
+		stop := timing.Start(c, "rate-limiter")
+		defer stop()
+
 		limiter := getVisitor(c, r, burst)
 
 		// fmt.Printf(">>>>> Visitors values: %v\n", visitors)
@@ -78,11 +110,17 @@ func RateLimiter(r rate.Limit, burst int, expireAfter time.Duration) gin.Handler
 		// fmt.Printf(">>>>> Remaining tokens: %v\n", limiter.Burst()-int(limiter.Tokens()))
 
 		if !limiter.Allow() {
-			util.JSONError(c, http.StatusTooManyRequests, "Rate limit exceeded", "You have exceeded the rate limit. Please try again later.")
-			c.Abort()
+			rejectVisitor(c)
 			return
 		}
 
+		stop()
 		c.Next()
 	}
 }
+
+// rejectVisitor aborts the request of a visitor exceeding the rate limit.
+func rejectVisitor(c *gin.Context) {
+	util.JSONError(c, http.StatusTooManyRequests, "Rate limit exceeded", "You have exceeded the rate limit. Please try again later.")
+	c.Abort()
+}
@@ -0,0 +1,79 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+	"golang.org/x/time/rate"
+)
+
+// redisKeyPrefix namespaces the rate limiter keys in Redis.
+const redisKeyPrefix = "ratelimit:"
+
+// allowScript implements the generic cell rate algorithm (GCRA), which behaves like the token bucket
+// of the in-memory limiter: a burst of requests is allowed, then one request per emission interval.
+// The key stores the theoretical arrival time in microseconds and expires once the bucket is full again.
+// The Redis clock is used so that all the replicas agree on the current time.
+var allowScript = redis.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then tat = now end
+local newTat = tat + interval
+if now < newTat - interval * burst then return 0 end
+redis.call('SET', KEYS[1], string.format('%.0f', newTat), 'PX', math.ceil((newTat - now) / 1000))
+return 1
+`)
+
+// redisRateLimiter counts the visitors in the Redis client of the request context.
+// The requests are allowed when Redis is unavailable, the limiter must not take the API down.
+func redisRateLimiter(r rate.Limit, burst int) gin.HandlerFunc {
+	interval := time.Duration(float64(time.Second) / float64(r))
+
+	return func(c *gin.Context) {
+		// Measure the check, the round trip to Redis included
+		stop := timing.Start(c, "rate-limiter")
+		defer stop()
+
+		allowed, err := allowRedis(c, interval, burst)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("rate limiter is unavailable, allowing the request: %v", err))
+			stop()
+			c.Next()
+			return
+		}
+
+		if !allowed {
+			rejectVisitor(c)
+			return
+		}
+
+		stop()
+		c.Next()
+	}
+}
+
+// allowRedis takes a token of the visitor from Redis.
+func allowRedis(c *gin.Context, interval time.Duration, burst int) (bool, error) {
+	ctx := c.Request.Context()
+	client := dbcontext.GetRedisClient(ctx)
+	if client == nil {
+		return false, errors.New("redis client is nil")
+	}
+
+	n, err := allowScript.Run(ctx, client, []string{redisKeyPrefix + visitorKey(c)}, interval.Microseconds(), burst).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
@@ -0,0 +1,288 @@
+package timing
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+)
+
+// Package timing measures the time taken by each middleware, to find where the latency of the requests goes.
+// The time of a middleware is its own: the time of the next handlers is left out. The router middlewares are
+// measured by the chain, which adds the time spent in the response writers they install (e.g. the compression of
+// gzip). The middlewares of the groups (authentication, RBAC, rate limiter) measure their work before the next
+// handlers with Start. The times are observed in the http_middleware_duration_seconds metric, and returned in the
+// Server-Timing header in debug mode when SERVER_TIMING is TRUE.
+
+// HeaderServerTiming returns the times of the middlewares, e.g. "jwt;dur=0.412, rbac;dur=0.004" in milliseconds.
+const HeaderServerTiming = "Server-Timing"
+
+// recorderKey is the key of the recorder of the request in the Gin context.
+const recorderKey = "timing.recorder"
+
+var (
+	ServerTiming string
+
+	initOnce sync.Once
+
+	middlewareDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_middleware_duration_seconds",
+		Help:    "Time taken by each middleware, without the time of the next handlers.",
+		Buckets: []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5},
+	}, []string{"middleware"})
+)
+
+// LoadEnv loads environment variables
+// SERVER_TIMING=TRUE returns the times of the middlewares in the Server-Timing header, in debug mode only:
+// the header tells the clients how the API is built and must not reach production.
+func LoadEnv() {
+	ServerTiming = strings.ToUpper(os.Getenv("SERVER_TIMING"))
+}
+
+// Init registers the middleware timing metrics. It is safe to call it several times.
+func Init() {
+	initOnce.Do(func() {
+		metrics.MustRegister(middlewareDuration)
+	})
+}
+
+// step is the time taken by a middleware.
+type step struct {
+	name string
+	took time.Duration
+}
+
+// frame is a router middleware being measured.
+type frame struct {
+	name       string
+	start      time.Time
+	handedOver time.Time
+	downstream time.Duration
+
+	// writes is the time spent in the writer installed by the middleware, below the time spent in the writer it wraps
+	writes time.Duration
+	below  time.Duration
+}
+
+// recorder holds the times of the middlewares of a request.
+type recorder struct {
+	steps []step
+	open  []*frame
+}
+
+func (rec *recorder) add(name string, took time.Duration) {
+	rec.steps = append(rec.steps, step{name: name, took: max(took, 0)})
+}
+
+// serverTiming formats the times recorded so far. The router middlewares still running report their time
+// until they handed over to the next handlers.
+func (rec *recorder) serverTiming() string {
+	var b strings.Builder
+	format := func(name string, took time.Duration) {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(took)/float64(time.Millisecond), 'f', 3, 64))
+	}
+
+	for _, f := range rec.open {
+		if !f.handedOver.IsZero() {
+			format(f.name, f.handedOver.Sub(f.start))
+		}
+	}
+	for _, s := range rec.steps {
+		format(s.name, s.took)
+	}
+
+	return b.String()
+}
+
+func recorderFrom(c *gin.Context) *recorder {
+	value, ok := c.Get(recorderKey)
+	if !ok {
+		return nil
+	}
+	rec, _ := value.(*recorder)
+	return rec
+}
+
+// headerEnabled reports whether the times are returned in the Server-Timing header.
+func headerEnabled() bool {
+	return ServerTiming == "TRUE" && gin.IsDebugging()
+}
+
+// timedWriter adds the time spent writing the response to a total.
+type timedWriter struct {
+	gin.ResponseWriter
+	spent *time.Duration
+}
+
+func (w *timedWriter) WriteHeaderNow() {
+	start := time.Now()
+	w.ResponseWriter.WriteHeaderNow()
+	*w.spent += time.Since(start)
+}
+
+func (w *timedWriter) Write(data []byte) (int, error) {
+	start := time.Now()
+	n, err := w.ResponseWriter.Write(data)
+	*w.spent += time.Since(start)
+	return n, err
+}
+
+func (w *timedWriter) WriteString(s string) (int, error) {
+	start := time.Now()
+	n, err := w.ResponseWriter.WriteString(s)
+	*w.spent += time.Since(start)
+	return n, err
+}
+
+func (w *timedWriter) Flush() {
+	start := time.Now()
+	w.ResponseWriter.Flush()
+	*w.spent += time.Since(start)
+}
+
+// headerWriter sets the Server-Timing header when the response headers are sent, the last moment it can be set.
+type headerWriter struct {
+	gin.ResponseWriter
+	set func()
+}
+
+func (w *headerWriter) WriteHeaderNow() {
+	w.set()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *headerWriter) Write(data []byte) (int, error) {
+	w.set()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *headerWriter) WriteString(s string) (int, error) {
+	w.set()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *headerWriter) Flush() {
+	w.set()
+	w.ResponseWriter.Flush()
+}
+
+// Track is a middleware function that records the times of the middlewares of the request, it must run first.
+// The times are observed in the metrics once the request is handled. The Server-Timing header is set when
+// the response headers are sent, so it holds the times recorded until then.
+func Track() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rec := &recorder{}
+		c.Set(recorderKey, rec)
+
+		if headerEnabled() {
+			original := c.Writer
+			sent := false
+			set := func() {
+				if sent {
+					return
+				}
+				sent = true
+				if !original.Written() {
+					original.Header().Set(HeaderServerTiming, rec.serverTiming())
+				}
+			}
+			c.Writer = &headerWriter{ResponseWriter: original, set: set}
+
+			c.Next()
+
+			// The responses without a body are sent by Gin once the handlers return
+			c.Writer = original
+			set()
+		} else {
+			c.Next()
+		}
+
+		for _, s := range rec.steps {
+			middlewareDuration.WithLabelValues(s.name).Observe(s.took.Seconds())
+		}
+	}
+}
+
+// Start starts measuring the named middleware and returns the function recording its time, which the middleware
+// calls before the next handlers. Only the first call records the time, so the function can also be deferred for
+// the requests the middleware aborts. Nothing is recorded when the request is not tracked.
+func Start(c *gin.Context, name string) func() {
+	rec := recorderFrom(c)
+	if rec == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	stopped := false
+	return func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		rec.add(name, time.Since(start))
+	}
+}
+
+// Measure measures a router middleware, which cannot call Start itself (e.g. gzip). It returns the middleware wrapped,
+// followed by the handler marking the handover to the next handlers: it must run right after the middleware, so the
+// time of the next handlers is left out. With writes, the time spent in the response writer installed by the
+// middleware is added, without the time spent in the writer it wraps.
+func Measure(name string, handler gin.HandlerFunc, writes bool) []gin.HandlerFunc {
+	measured := func(c *gin.Context) {
+		rec := recorderFrom(c)
+		if rec == nil {
+			handler(c)
+			return
+		}
+
+		f := &frame{name: name, start: time.Now()}
+		rec.open = append(rec.open, f)
+		original := c.Writer
+		if writes {
+			c.Writer = &timedWriter{ResponseWriter: original, spent: &f.below}
+		}
+
+		handler(c)
+
+		c.Writer = original
+		rec.open = rec.open[:len(rec.open)-1]
+		rec.add(name, time.Since(f.start)-f.downstream+f.writes-f.below)
+	}
+
+	handover := func(c *gin.Context) {
+		// The middleware may have aborted or returned without calling the next handlers, its frame is then closed
+		rec := recorderFrom(c)
+		if rec == nil || len(rec.open) == 0 {
+			c.Next()
+			return
+		}
+		f := rec.open[len(rec.open)-1]
+		if f.name != name || !f.handedOver.IsZero() {
+			c.Next()
+			return
+		}
+
+		f.handedOver = time.Now()
+		original := c.Writer
+		if writes {
+			c.Writer = &timedWriter{ResponseWriter: original, spent: &f.writes}
+		}
+
+		c.Next()
+
+		c.Writer = original
+		f.downstream = time.Since(f.handedOver)
+	}
+
+	return []gin.HandlerFunc{measured, handover}
+}
@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsonschema"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// JSON Schema validation modes
+// REPORT only logs the violations, which allows a soft launch before ENFORCE rejects the requests.
+const (
+	ModeOff     = "OFF"
+	ModeReport  = "REPORT"
+	ModeEnforce = "ENFORCE"
+)
+
+var JSONSchemaValidationMode string
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	JSONSchemaValidationMode = strings.ToUpper(os.Getenv("JSON_SCHEMA_VALIDATION"))
+}
+
+// JSONSchemaValidation is a middleware function that validates the JSON request body against a JSON Schema.
+// It is opt-in through the JSON_SCHEMA_VALIDATION environment variable and does nothing when it is OFF.
+// The request body is restored so the handlers can still bind it.
+func JSONSchemaValidation(schema *jsonschema.Schema) gin.HandlerFunc {
+	// Load environment variables
+	LoadEnv()
+
+	return func(c *gin.Context) {
+		if JSONSchemaValidationMode != ModeReport && JSONSchemaValidationMode != ModeEnforce {
+			c.Next()
+			return
+		}
+
+		// Read the request body and restore it for the handlers
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			util.JSONError(c, http.StatusBadRequest, "Invalid request body", err.Error())
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Validate the payload against the schema
+		errs := jsonschema.ValidateJSON(schema, body)
+		if len(errs) == 0 {
+			c.Next()
+			return
+		}
+
+		if JSONSchemaValidationMode == ModeReport {
+			logger.Warn(fmt.Sprintf("request body of %s %s does not match the %s schema: %v", c.Request.Method, c.Request.URL.Path, schema.Title, errs))
+			c.Next()
+			return
+		}
+
+		// Format the errors like the validator errors
+		details := make([]map[string]string, 0, len(errs))
+		for _, e := range errs {
+			details = append(details, map[string]string{
+				"field":   e.Field,
+				"message": e.Message,
+			})
+		}
+
+		util.JSONErrorMap(c, http.StatusBadRequest, "Request body does not match the schema", details)
+		c.Abort()
+	}
+}
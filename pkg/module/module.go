@@ -0,0 +1,119 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+)
+
+// Package module defines how the modules register their routes.
+// Every module exposes a RegisterRoutes function creating its route groups under the group it is given,
+// with its own middlewares (rate limits, roles, validation), so the routers only list the modules.
+// The optional modules can be disabled with MODULES_DISABLED, e.g. for a minimal deployment: a disabled module
+// registers no routes, runs no jobs and does not need its dependencies.
+
+// Names of the optional modules, listed in MODULES_DISABLED to disable them
+const (
+	// DataRedis is the Redis data API (/api/v1/dataredis)
+	DataRedis = "dataredis"
+
+	// Webhooks is the webhook management API (/api/v1/webhooks) and the webhook dispatcher
+	Webhooks = "webhooks"
+
+	// Admin is the internal admin listener (admin endpoints, metrics and profiling)
+	Admin = "admin"
+
+	// PublicAPI is the anonymous read-only API (/public/v1), which is also opt-in with PUBLIC_API_ENABLED
+	PublicAPI = "public-api"
+
+	// PasswordReset is the password reset by e-mail (/auth/forgot-password and /auth/reset-password)
+	PasswordReset = "password-reset"
+)
+
+// Optional are the names of the modules that can be disabled.
+var Optional = []string{DataRedis, Webhooks, Admin, PublicAPI, PasswordReset}
+
+var (
+	ModulesDisabled string
+
+	disabled = map[string]bool{}
+)
+
+// LoadEnv loads environment variables
+// MODULES_DISABLED is the comma-separated list of the optional modules to disable, e.g. "dataredis,webhooks".
+func LoadEnv() {
+	ModulesDisabled = os.Getenv("MODULES_DISABLED")
+
+	disabled = map[string]bool{}
+	for _, name := range strings.Split(ModulesDisabled, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			disabled[name] = true
+		}
+	}
+}
+
+// Validate checks that MODULES_DISABLED only names optional modules, so a typo does not leave a module enabled.
+func Validate() error {
+	for name := range disabled {
+		if !isOptional(name) {
+			return fmt.Errorf("unknown module %q in MODULES_DISABLED, the optional modules are %s", name, strings.Join(Optional, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Enabled reports whether the module with the given name is enabled.
+// The modules without a name cannot be disabled.
+func Enabled(name string) bool {
+	return name == "" || !disabled[name]
+}
+
+// isOptional reports whether the module with the given name can be disabled.
+func isOptional(name string) bool {
+	for _, optional := range Optional {
+		if name == optional {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Deps are the dependencies given by the routers to the modules when they register their routes.
+type Deps struct {
+	// Chain is the middleware chain of the router, the streaming groups opt out of its compression and buffering
+	Chain *chain.Chain
+
+	// Validate returns the middleware validating the request body against the named JSON Schema
+	// The schemas are registered by the schema module, which depends on the entities of the other modules.
+	Validate func(schema string) gin.HandlerFunc
+
+	// StatementTimeout returns the middleware bounding the database statements of the requests,
+	// with the read timeout for GET and HEAD and the write timeout for the other methods
+	// It is injected since the database configuration depends on the entities of the modules.
+	StatementTimeout func(read, write time.Duration) gin.HandlerFunc
+}
+
+// RegisterFunc registers the routes of a module under the given group.
+type RegisterFunc func(rg *gin.RouterGroup, deps Deps)
+
+// Module is a module registering its routes.
+// The name is one of the optional modules, or empty for the modules that are always enabled.
+type Module struct {
+	Name     string
+	Register RegisterFunc
+}
+
+// Register registers the routes of the enabled modules under the given group.
+func Register(rg *gin.RouterGroup, deps Deps, modules ...Module) {
+	for _, m := range modules {
+		if Enabled(m.Name) {
+			m.Register(rg, deps)
+		}
+	}
+}
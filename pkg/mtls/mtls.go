@@ -0,0 +1,144 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Package mtls provides mutual TLS authentication for internal service callers.
+// Client certificates are verified against a dedicated CA bundle and mapped
+// to a service account identity through their subject common name or SANs.
+
+// ServiceAccount represents the identity of an internal service authenticated with a client certificate.
+// A certificate matches the service account when its subject common name is listed in CommonNames
+// or when one of its DNS, URI (e.g. SPIFFE ID) or email SANs is listed in SANs.
+type ServiceAccount struct {
+	Name        string   `json:"name"`
+	UserID      int64    `json:"userId"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	CommonNames []string `json:"commonNames"`
+	SANs        []string `json:"sans"`
+}
+
+var (
+	MTLSEnabled             string
+	MTLSHost                string
+	MTLSPort                string
+	MTLSClientCA            string
+	MTLSServiceAccountsFile string
+
+	mu              sync.RWMutex
+	serviceAccounts []ServiceAccount
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	MTLSEnabled = os.Getenv("MTLS_ENABLED")
+	MTLSHost = os.Getenv("MTLS_HOST")
+	MTLSPort = os.Getenv("MTLS_PORT")
+	MTLSClientCA = os.Getenv("MTLS_CLIENT_CA")
+	MTLSServiceAccountsFile = os.Getenv("MTLS_SERVICE_ACCOUNTS_FILE")
+}
+
+// NewServerTLSConfig creates the TLS configuration of the mTLS listener.
+// Client certificates are required and verified against the CA bundle at the given path.
+func NewServerTLSConfig(clientCAFile string) (*tls.Config, error) {
+	if clientCAFile == "" {
+		return nil, errors.New("MTLS_CLIENT_CA environment variable is not set")
+	}
+
+	caData, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, errors.New("client CA bundle does not contain any valid certificate")
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+// LoadServiceAccounts loads the service accounts from a JSON file.
+// The file contains an array of service accounts.
+func LoadServiceAccounts(path string) error {
+	if path == "" {
+		return errors.New("MTLS_SERVICE_ACCOUNTS_FILE environment variable is not set")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read service accounts file: %v", err)
+	}
+
+	var accounts []ServiceAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return fmt.Errorf("failed to parse service accounts file: %v", err)
+	}
+
+	SetServiceAccounts(accounts)
+	return nil
+}
+
+// SetServiceAccounts replaces the service accounts.
+func SetServiceAccounts(accounts []ServiceAccount) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	serviceAccounts = accounts
+}
+
+// ResolveServiceAccount finds the service account matching the given client certificate.
+func ResolveServiceAccount(cert *x509.Certificate) (ServiceAccount, bool) {
+	if cert == nil {
+		return ServiceAccount{}, false
+	}
+
+	// Collect the identities presented by the certificate
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, sa := range serviceAccounts {
+		if cert.Subject.CommonName != "" && containsFold(sa.CommonNames, cert.Subject.CommonName) {
+			return sa, true
+		}
+
+		for _, san := range sans {
+			if containsFold(sa.SANs, san) {
+				return sa, true
+			}
+		}
+	}
+
+	return ServiceAccount{}, false
+}
+
+// containsFold checks if the list contains the value, ignoring the case.
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
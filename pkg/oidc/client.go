@@ -0,0 +1,283 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidIDToken is returned for an ID token failing the verification.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// metadataTTL is the time the discovery documents and the key sets are kept before they are fetched again.
+const metadataTTL = time.Hour
+
+// Metadata are the endpoints of a provider, read from its discovery document.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of an ID token used to map the external identity to a local user.
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Nonce         string `json:"nonce"`
+	// TenantID is the Microsoft tenant of the account, part of the issuer of the multi-tenant endpoints
+	TenantID string `json:"tid"`
+	jwt.RegisteredClaims
+}
+
+// jsonWebKey is a key of the JWKS of a provider, RSA or EC on P-256.
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// cached is a discovery document or a key set with the time it was fetched.
+type cached struct {
+	value     any
+	fetchedAt time.Time
+}
+
+var (
+	httpClient = &http.Client{Timeout: httpTimeout}
+
+	cacheMu sync.Mutex
+	cache   = map[string]cached{}
+)
+
+// Discover returns the endpoints of the provider, from its discovery document.
+// The document is kept for an hour.
+func (p Provider) Discover(ctx context.Context) (Metadata, error) {
+	documentURL := strings.TrimRight(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if meta, ok := fromCache(documentURL).(Metadata); ok {
+		return meta, nil
+	}
+
+	var meta Metadata
+	if err := getJSON(ctx, documentURL, &meta); err != nil {
+		return Metadata{}, fmt.Errorf("failed to read the discovery document of %s: %w", p.Name, err)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return Metadata{}, fmt.Errorf("incomplete discovery document of %s", p.Name)
+	}
+	toCache(documentURL, meta)
+
+	return meta, nil
+}
+
+// Exchange exchanges the authorization code for the ID token, with the code verifier of the login.
+func (p Provider) Exchange(ctx context.Context, meta Metadata, code string, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURI()},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response of %s: %w", p.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("token request refused by %s: %s %s", p.Name, body.Error, body.ErrorDescription)
+	}
+
+	return body.IDToken, nil
+}
+
+// VerifyIDToken verifies the ID token of a login: its signature with the keys of the provider,
+// its issuer, its audience (the client ID), its expiration and the nonce of the login.
+func (p Provider) VerifyIDToken(ctx context.Context, meta Metadata, rawIDToken string, nonce string) (Claims, error) {
+	var claims Claims
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	_, err := parser.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, meta, kid)
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// The issuer of the Microsoft multi-tenant endpoints is a template of the tenant of the account
+	issuer := strings.ReplaceAll(meta.Issuer, "{tenantid}", claims.TenantID)
+	if claims.Issuer != issuer {
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidIDToken, claims.Issuer)
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// VerifiedEmail returns the e-mail of the ID token when the provider vouches for it, empty otherwise.
+func (p Provider) VerifiedEmail(claims Claims) string {
+	if claims.EmailVerified != nil {
+		if *claims.EmailVerified {
+			return claims.Email
+		}
+		return ""
+	}
+	if p.TrustEmail {
+		return claims.Email
+	}
+
+	return ""
+}
+
+// publicKey returns the key of the provider with the given ID.
+// An unknown key is looked up in a fresh key set, the provider may have rotated its keys.
+func (p Provider) publicKey(ctx context.Context, meta Metadata, kid string) (crypto.PublicKey, error) {
+	keys, ok := fromCache(meta.JWKSURI).(map[string]crypto.PublicKey)
+	if ok {
+		if key, found := keys[kid]; found {
+			return key, nil
+		}
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to read the keys of %s: %w", p.Name, err)
+	}
+	keys = map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		// The keys of the other types are not used to sign the ID tokens
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	toCache(meta.JWKSURI, keys)
+
+	key, found := keys[kid]
+	if !found {
+		return nil, fmt.Errorf("unknown key ID: %s", kid)
+	}
+	return key, nil
+}
+
+// publicKey converts the JWK into an RSA or ECDSA public key.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+// getJSON reads the JSON document at the given URL.
+func getJSON(ctx context.Context, documentURL string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, documentURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// fromCache returns the cached value of the URL, nil when it is missing or stale.
+func fromCache(key string) any {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	entry, ok := cache[key]
+	if !ok || time.Since(entry.fetchedAt) > metadataTTL {
+		return nil
+	}
+	return entry.value
+}
+
+// toCache keeps the value fetched from the URL.
+func toCache(key string, value any) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	cache[key] = cached{value: value, fetchedAt: time.Now()}
+}
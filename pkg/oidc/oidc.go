@@ -0,0 +1,147 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Package oidc implements the client side of the OpenID Connect authorization code flow (with PKCE),
+// used for the social logins with Google and Microsoft.
+// The endpoints of a provider are read from its discovery document, and the ID tokens are verified
+// with the keys of its JWKS: signature, issuer, audience, expiration and nonce.
+
+// Names of the supported providers, as used in the routes
+const (
+	Google    = "google"
+	Microsoft = "microsoft"
+)
+
+// httpTimeout bounds each call to a provider.
+const httpTimeout = 10 * time.Second
+
+// Provider is an OpenID Connect provider the users log in with.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// TrustEmail accepts the e-mail of the ID tokens without the email_verified claim,
+	// for the providers not sending it (Microsoft) when the accounts are managed by a single tenant.
+	TrustEmail bool
+}
+
+var (
+	RedirectBaseURL       string
+	AutoProvision         string
+	GoogleClientID        string
+	GoogleClientSecret    string
+	GoogleIssuer          string
+	MicrosoftClientID     string
+	MicrosoftClientSecret string
+	MicrosoftTenant       string
+	MicrosoftIssuer       string
+)
+
+// LoadEnv loads environment variables
+// A provider is enabled when its client ID is set. OIDC_REDIRECT_BASE_URL is the public URL of the API,
+// the callback of a provider is <base>/auth/oidc/<provider>/callback and must be registered with the provider.
+// The issuers default to the public ones, MICROSOFT_TENANT defaults to "common" (any Microsoft account).
+func LoadEnv() {
+	RedirectBaseURL = strings.TrimRight(os.Getenv("OIDC_REDIRECT_BASE_URL"), "/")
+	AutoProvision = os.Getenv("OIDC_AUTO_PROVISION")
+	GoogleClientID = os.Getenv("OIDC_GOOGLE_CLIENT_ID")
+	GoogleClientSecret = os.Getenv("OIDC_GOOGLE_CLIENT_SECRET")
+	GoogleIssuer = os.Getenv("OIDC_GOOGLE_ISSUER")
+	MicrosoftClientID = os.Getenv("OIDC_MICROSOFT_CLIENT_ID")
+	MicrosoftClientSecret = os.Getenv("OIDC_MICROSOFT_CLIENT_SECRET")
+	MicrosoftTenant = os.Getenv("OIDC_MICROSOFT_TENANT")
+	MicrosoftIssuer = os.Getenv("OIDC_MICROSOFT_ISSUER")
+
+	if GoogleIssuer == "" {
+		GoogleIssuer = "https://accounts.google.com"
+	}
+	if MicrosoftTenant == "" {
+		MicrosoftTenant = "common"
+	}
+	if MicrosoftIssuer == "" {
+		MicrosoftIssuer = "https://login.microsoftonline.com/" + MicrosoftTenant + "/v2.0"
+	}
+}
+
+// Lookup returns the enabled provider with the given name.
+func Lookup(name string) (Provider, bool) {
+	// Load environment variables
+	LoadEnv()
+
+	switch name {
+	case Google:
+		if GoogleClientID != "" {
+			return Provider{Name: Google, Issuer: GoogleIssuer, ClientID: GoogleClientID, ClientSecret: GoogleClientSecret}, true
+		}
+	case Microsoft:
+		if MicrosoftClientID != "" {
+			// The multi-tenant endpoints accept any account, whose e-mail is set by its own tenant
+			multiTenant := MicrosoftTenant == "common" || MicrosoftTenant == "organizations" || MicrosoftTenant == "consumers"
+			return Provider{Name: Microsoft, Issuer: MicrosoftIssuer, ClientID: MicrosoftClientID, ClientSecret: MicrosoftClientSecret, TrustEmail: !multiTenant}, true
+		}
+	}
+
+	return Provider{}, false
+}
+
+// AutoProvisionEnabled reports whether the users logging in with a provider for the first time are created,
+// when no local user has their e-mail.
+func AutoProvisionEnabled() bool {
+	// Load environment variables
+	LoadEnv()
+
+	return AutoProvision == "TRUE"
+}
+
+// RedirectURI returns the callback URL of the provider, registered with the provider.
+func (p Provider) RedirectURI() string {
+	return RedirectBaseURL + "/auth/oidc/" + p.Name + "/callback"
+}
+
+// AuthCodeURL returns the URL of the authorization endpoint the user is redirected to.
+// The state protects the callback against the forged requests, the nonce binds the ID token to the login
+// and the code challenge binds the code to the verifier kept by the API (PKCE, RFC 7636).
+func (p Provider) AuthCodeURL(meta Metadata, state string, nonce string, verifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURI()},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// RandomString returns a random URL-safe string of 256 bits, e.g. a state, a nonce or a code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 code challenge of a code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
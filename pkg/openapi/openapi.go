@@ -0,0 +1,270 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+)
+
+// Package openapi generates the OpenAPI spec of the API from the registered routes.
+// The operations declare the request schema and the typed errors (pkg/apperror) they may return,
+// so every documented error response has the same status and code as the actual response.
+// Their examples are encoded from the sample entities of the tests, so they follow the changes of the DTOs.
+
+// Version is the OpenAPI version of the generated spec.
+const Version = "3.1.0"
+
+// Operation documents the handler of a route.
+// Operations are declared by the modules next to their handlers and keyed by the handler method name.
+// Example names the example of its request body and of its success response, if any.
+type Operation struct {
+	Summary       string
+	RequestSchema string
+	SuccessStatus int
+	Errors        []*apperror.Error
+	Example       string
+}
+
+// Example is a sample request body and the data of the success response, encoded as JSON in the spec.
+// Either may be nil, e.g. the operations without request body only use the response.
+type Example struct {
+	Request  any
+	Response any
+}
+
+// Route is a registered route, as returned by gin.Engine.Routes().
+// The handler is the fully qualified name of the handler function.
+type Route struct {
+	Method  string
+	Path    string
+	Handler string
+}
+
+// Spec holds the inputs of the generated spec.
+// The operations are keyed by module (the package name of the handler) and handler method name,
+// and the examples by the name the operations refer to.
+type Spec struct {
+	Title      string
+	Version    string
+	Routes     []Route
+	Schemas    map[string]any
+	Operations map[string]map[string]Operation
+	Examples   map[string]Example
+}
+
+// pathParam matches the gin path parameters (e.g. ":id").
+var pathParam = regexp.MustCompile(`[:*](\w+)`)
+
+// Build generates the OpenAPI document.
+func (s Spec) Build() map[string]any {
+	paths := map[string]map[string]any{}
+	for _, route := range s.Routes {
+		if route.Method == http.MethodHead || route.Method == http.MethodOptions {
+			continue
+		}
+
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(route.Method)] = s.buildOperation(route, path)
+	}
+
+	return map[string]any{
+		"openapi": Version,
+		"info": map[string]any{
+			"title":   s.Title,
+			"version": s.Version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":   s.buildSchemas(),
+			"responses": buildErrorResponses(),
+		},
+	}
+}
+
+// buildOperation documents a route with the operation declared for its handler, if any.
+func (s Spec) buildOperation(route Route, path string) map[string]any {
+	module, name := handlerName(route.Handler)
+	op := s.Operations[module][name]
+
+	operation := map[string]any{
+		"operationId": name,
+		"tags":        []string{module},
+	}
+	if op.Summary != "" {
+		operation["summary"] = op.Summary
+	}
+
+	// Path parameters
+	var params []map[string]any
+	for _, m := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+		params = append(params, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+
+	// Request body
+	example := s.Examples[op.Example]
+	if op.RequestSchema != "" {
+		content := map[string]any{"schema": ref("schemas", op.RequestSchema)}
+		if example.Request != nil {
+			content["example"] = example.Request
+		}
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": content,
+			},
+		}
+	}
+
+	// Success response, its example wraps the sample data in the response envelope
+	status := op.SuccessStatus
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"schema": ref("schemas", "HttpResponse")}
+	if example.Response != nil {
+		success["example"] = map[string]any{"status": status, "data": example.Response}
+	}
+	responses := map[string]any{
+		strconv.Itoa(status): map[string]any{
+			"description": http.StatusText(status),
+			"content": map[string]any{
+				"application/json": success,
+			},
+		},
+		"default": map[string]any{
+			"description": "Unexpected error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": ref("schemas", "ErrorResponse")},
+			},
+		},
+	}
+
+	// Typed error responses, grouped by status since a status has a single response
+	byStatus := map[int][]*apperror.Error{}
+	for _, e := range op.Errors {
+		byStatus[e.Status] = append(byStatus[e.Status], e)
+	}
+	for status, errs := range byStatus {
+		if len(errs) == 1 {
+			responses[strconv.Itoa(status)] = ref("responses", errs[0].Code)
+			continue
+		}
+
+		var codes []string
+		var schemas []any
+		for _, e := range errs {
+			codes = append(codes, e.Code)
+			schemas = append(schemas, ref("schemas", e.Code+"Error"))
+		}
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": strings.Join(codes, ", "),
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": map[string]any{"oneOf": schemas}},
+			},
+		}
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// buildSchemas returns the request schemas, the response envelopes and the schema of each typed error.
+func (s Spec) buildSchemas() map[string]any {
+	schemas := map[string]any{
+		"HttpResponse": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"message":   map[string]any{"type": "string"},
+				"error":     map[string]any{},
+				"path":      map[string]any{"type": "string"},
+				"status":    map[string]any{"type": "integer"},
+				"data":      map[string]any{},
+				"meta":      map[string]any{"type": "object"},
+				"links":     map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+				"timestamp": map[string]any{"type": "string", "format": "date-time"},
+			},
+		},
+		"ErrorResponse": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"message":   map[string]any{"type": "string"},
+				"code":      map[string]any{"type": "string"},
+				"error":     map[string]any{},
+				"path":      map[string]any{"type": "string"},
+				"status":    map[string]any{"type": "integer"},
+				"timestamp": map[string]any{"type": "string", "format": "date-time"},
+			},
+			"required": []string{"message", "status"},
+		},
+	}
+
+	for name, schema := range s.Schemas {
+		schemas[name] = schema
+	}
+
+	for _, e := range apperror.Catalog() {
+		schemas[e.Code+"Error"] = map[string]any{
+			"allOf": []any{
+				ref("schemas", "ErrorResponse"),
+				map[string]any{
+					"properties": map[string]any{
+						"code":   map[string]any{"const": e.Code},
+						"status": map[string]any{"const": e.Status},
+						"error":  map[string]any{"const": e.Message},
+					},
+					"required": []string{"code"},
+				},
+			},
+		}
+	}
+
+	return schemas
+}
+
+// buildErrorResponses returns a response for each typed error of the catalog.
+func buildErrorResponses() map[string]any {
+	responses := map[string]any{}
+	for _, e := range apperror.Catalog() {
+		responses[e.Code] = map[string]any{
+			"description": fmt.Sprintf("%s: %s", e.Code, e.Message),
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": ref("schemas", e.Code+"Error")},
+			},
+		}
+	}
+
+	return responses
+}
+
+// handlerName extracts the module and method name of a handler,
+// e.g. ".../internal/department.(*DepartmentHandler).GetDepartmentByID-fm" gives "department" and "GetDepartmentByID".
+func handlerName(handler string) (string, string) {
+	handler = strings.TrimSuffix(handler, "-fm")
+	if i := strings.LastIndex(handler, "/"); i >= 0 {
+		handler = handler[i+1:]
+	}
+
+	module, _, _ := strings.Cut(handler, ".")
+	name := handler[strings.LastIndex(handler, ".")+1:]
+	return module, name
+}
+
+// ref returns a reference to a component.
+func ref(kind string, name string) map[string]any {
+	return map[string]any{"$ref": "#/components/" + kind + "/" + name}
+}
@@ -0,0 +1,227 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+	"gorm.io/gorm"
+)
+
+// Package pagination provides offset and cursor (keyset) pagination for the listings.
+// Offset pagination uses the "page" and "limit" query parameters.
+// Cursor pagination uses the "after" and "limit" query parameters, where "after" is the opaque
+// cursor returned in the previous page; it filters on the primary key instead of using OFFSET,
+// so deep pages stay as fast as the first one.
+
+// Default page sizes, used when the environment does not set them
+const (
+	defaultDefaultLimit = 20
+	defaultMaxLimit     = 100
+	defaultHardCap      = 1000
+)
+
+// ErrTooManyRows is returned when a listing requested without pagination exceeds the hard cap.
+var ErrTooManyRows = apperror.New("TooManyRows", http.StatusBadRequest, "the listing has too many rows, use the pagination (limit and page or after)")
+
+// DefaultLimit is the page size when only "page" or "after" is given, and MaxLimit the largest "limit" accepted.
+// HardCap is the largest number of rows a listing returns without pagination, so that unpaginated
+// requests cannot load whole tables.
+var (
+	DefaultLimit = defaultDefaultLimit
+	MaxLimit     = defaultMaxLimit
+	HardCap      = defaultHardCap
+)
+
+// LoadEnv loads environment variables
+// The limits are kept consistent: DefaultLimit <= MaxLimit <= HardCap.
+func LoadEnv() {
+	DefaultLimit = getEnvInt("PAGINATION_DEFAULT_LIMIT", defaultDefaultLimit)
+	MaxLimit = getEnvInt("PAGINATION_MAX_LIMIT", defaultMaxLimit)
+	HardCap = getEnvInt("PAGINATION_HARD_CAP", defaultHardCap)
+
+	if MaxLimit > HardCap {
+		logger.Warn(fmt.Sprintf("PAGINATION_MAX_LIMIT (%d) is above PAGINATION_HARD_CAP (%d), using %d", MaxLimit, HardCap, HardCap))
+		MaxLimit = HardCap
+	}
+	if DefaultLimit > MaxLimit {
+		logger.Warn(fmt.Sprintf("PAGINATION_DEFAULT_LIMIT (%d) is above PAGINATION_MAX_LIMIT (%d), using %d", DefaultLimit, MaxLimit, MaxLimit))
+		DefaultLimit = MaxLimit
+	}
+}
+
+// getEnvInt reads a positive number from the environment, or returns the default value.
+func getEnvInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		logger.Warn(fmt.Sprintf("%s must be a positive number, using %d", key, def))
+		return def
+	}
+	return n
+}
+
+// Params holds the pagination requested by the client.
+// A zero Limit means the listing is not paginated.
+type Params struct {
+	Limit int
+	Page  int
+	After string
+}
+
+// Meta describes the returned page.
+// NextCursor is empty on the last page.
+type Meta struct {
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"`
+	TotalItems *int64 `json:"totalItems,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// IsPaginated checks if the listing is paginated.
+func (p Params) IsPaginated() bool {
+	return p.Limit > 0
+}
+
+// IsOffset checks if the offset pagination is used.
+func (p Params) IsOffset() bool {
+	return p.Page > 0
+}
+
+// ParseParams parses the pagination query parameters.
+// "page" selects the offset pagination, otherwise "limit" and "after" select the cursor pagination.
+// Both cannot be combined.
+func ParseParams(c *gin.Context) (Params, error) {
+	limitStr := c.Query("limit")
+	pageStr := c.Query("page")
+	afterStr, hasAfter := c.GetQuery("after")
+
+	if limitStr == "" && pageStr == "" && !hasAfter {
+		return Params{}, nil
+	}
+
+	if pageStr != "" && hasAfter {
+		return Params{}, errors.New("page and after cannot be used together")
+	}
+
+	p := Params{Limit: DefaultLimit}
+	if limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > MaxLimit {
+			return Params{}, errors.New("limit must be between 1 and " + strconv.Itoa(MaxLimit))
+		}
+		p.Limit = limit
+	}
+
+	if pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page <= 0 {
+			return Params{}, errors.New("page must be a positive number")
+		}
+		p.Page = page
+	}
+
+	if afterStr != "" {
+		after, err := DecodeCursor(afterStr)
+		if err != nil {
+			return Params{}, err
+		}
+		p.After = after
+	}
+
+	return p, nil
+}
+
+// EncodeCursor encodes the key of the last item of a page into an opaque cursor.
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// DecodeCursor decodes an opaque cursor into the key of the last item of the previous page.
+func DecodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+
+	return string(key), nil
+}
+
+// Apply applies the pagination to a query ordered by the given key column.
+// One extra row is fetched to know if there is a next page; it is removed by Paginate.
+// Without pagination, the query is limited to the hard cap plus one row, which Paginate rejects.
+// The after value must already have the type of the key column.
+func Apply(query *gorm.DB, keyColumn string, p Params, after any) *gorm.DB {
+	if !p.IsPaginated() {
+		return query.Limit(HardCap + 1)
+	}
+
+	if p.IsOffset() {
+		query = query.Offset((p.Page - 1) * p.Limit)
+	} else if after != nil {
+		query = query.Where(keyColumn+" > ?", after)
+	}
+
+	return query.Limit(p.Limit + 1)
+}
+
+// Paginate trims the extra row fetched by Apply and builds the page metadata.
+// The key function returns the cursor key of an item.
+// It returns ErrTooManyRows when an unpaginated listing exceeds the hard cap.
+func Paginate[T any](items []T, p Params, key func(T) string) ([]T, *Meta, error) {
+	if !p.IsPaginated() {
+		if len(items) > HardCap {
+			return nil, nil, ErrTooManyRows
+		}
+		return items, nil, nil
+	}
+
+	meta := &Meta{Limit: p.Limit, Page: p.Page}
+	if len(items) > p.Limit {
+		items = items[:p.Limit]
+		meta.NextCursor = EncodeCursor(key(items[len(items)-1]))
+	}
+
+	return items, meta, nil
+}
+
+// Links builds the navigation links of a page, keeping the other query parameters of the request.
+// The offset pagination links the next and previous pages; the cursor pagination only moves forward,
+// so it links the next page and the first page instead.
+func Links(c *gin.Context, meta *Meta) util.Links {
+	links := util.Links{}
+	if meta == nil {
+		return links
+	}
+
+	limit := strconv.Itoa(meta.Limit)
+	if meta.Page > 0 {
+		if meta.NextCursor != "" {
+			links["next"] = util.QueryLink(c, map[string]string{"page": strconv.Itoa(meta.Page + 1), "limit": limit})
+		}
+		if meta.Page > 1 {
+			links["prev"] = util.QueryLink(c, map[string]string{"page": strconv.Itoa(meta.Page - 1), "limit": limit})
+		}
+		return links
+	}
+
+	if meta.NextCursor != "" {
+		links["next"] = util.QueryLink(c, map[string]string{"after": meta.NextCursor, "limit": limit})
+	}
+	if c.Query("after") != "" {
+		links["first"] = util.QueryLink(c, map[string]string{"after": "", "limit": limit})
+	}
+
+	return links
+}
@@ -0,0 +1,134 @@
+package permission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// Package permission maps the roles to the fine-grained permissions they grant, e.g. "audit:read".
+// The access tokens carry the permissions of the roles of their user in the permissions claim, so the routes
+// can authorize an action instead of a list of role names, and a custom role (see ROLES_CUSTOM) can be granted
+// some actions of the admins without becoming one. The built-in roles have a default mapping, and
+// ROLE_PERMISSIONS_FILE replaces the permissions of the roles it lists, e.g. {"ROLE_AUDITOR": ["audit:read"]}.
+
+// The permissions, as "<resource>:<action>"
+const (
+	DepartmentsRead     = "departments:read"
+	DepartmentsWrite    = "departments:write"
+	UsersRead           = "users:read"
+	UsersWrite          = "users:write"
+	UsersImpersonate    = "users:impersonate"
+	AuditRead           = "audit:read"
+	APIKeysManage       = "api-keys:manage"
+	RoleRequestsReview  = "role-requests:review"
+	AdministrationWrite = "admin:write"
+)
+
+// All are the known permissions, the ones a role can be granted.
+var All = []string{
+	DepartmentsRead, DepartmentsWrite, UsersRead, UsersWrite, UsersImpersonate,
+	AuditRead, APIKeysManage, RoleRequestsReview, AdministrationWrite,
+}
+
+// defaultGrants are the permissions of the built-in roles, matching their access to the routes.
+var defaultGrants = map[string][]string{
+	"ROLE_USER":      {DepartmentsRead},
+	"ROLE_MODERATOR": {DepartmentsRead},
+	"ROLE_ADMIN":     All,
+}
+
+var (
+	PermissionsFile string
+
+	mu     sync.RWMutex
+	grants = defaultGrants
+)
+
+// LoadEnv loads environment variables
+// ROLE_PERMISSIONS_FILE is the JSON file of the permissions of the roles, the default mapping applies when it is empty.
+func LoadEnv() {
+	PermissionsFile = os.Getenv("ROLE_PERMISSIONS_FILE")
+}
+
+// LoadFile loads the permissions of the roles from a JSON file, an object of the role names to their permissions.
+// The roles listed in the file get its permissions, the other built-in roles keep their default ones.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read role permissions file: %v", err)
+	}
+
+	var m map[string][]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("failed to parse role permissions file: %v", err)
+	}
+
+	return SetGrants(m)
+}
+
+// SetGrants replaces the permissions of the given roles, the other built-in roles get their default ones.
+// The roles must be role names such as ROLE_AUDITOR, and the permissions must be known.
+func SetGrants(m map[string][]string) error {
+	merged := make(map[string][]string, len(defaultGrants)+len(m))
+	for role, perms := range defaultGrants {
+		merged[role] = perms
+	}
+
+	for role, perms := range m {
+		if !validate.RoleNamePattern.MatchString(role) {
+			return fmt.Errorf("invalid role %q, expected a role name such as ROLE_AUDITOR", role)
+		}
+		for _, p := range perms {
+			if !IsKnown(p) {
+				return fmt.Errorf("unknown permission %q of role %s", p, role)
+			}
+		}
+		merged[role] = append([]string{}, perms...)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	grants = merged
+	return nil
+}
+
+// Reset restores the default permissions of the roles.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	grants = defaultGrants
+}
+
+// IsKnown reports whether the permission is a known permission.
+func IsKnown(p string) bool {
+	return slices.Contains(All, p)
+}
+
+// For returns the permissions granted by the roles, sorted and without duplicates.
+// It is never nil, the roles without permissions grant an empty list.
+func For(roles []string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	seen := map[string]bool{}
+	perms := []string{}
+	for _, role := range roles {
+		for _, p := range grants[role] {
+			if !seen[p] {
+				seen[p] = true
+				perms = append(perms, p)
+			}
+		}
+	}
+	sort.Strings(perms)
+
+	return perms
+}
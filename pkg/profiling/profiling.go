@@ -0,0 +1,150 @@
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+)
+
+// Package profiling captures runtime profiles to the profile directory.
+// The CPU profiles collected in production are merged into cmd/default.pgo by "make pgo-profile",
+// and "make build-pgo" builds the application with profile-guided optimization from it.
+// The application has no object storage, so the directory is expected to be a mounted volume.
+
+// Kinds of profiles
+const (
+	KindCPU  = "cpu"
+	KindHeap = "heap"
+)
+
+const (
+	defaultDir        = "profiles"
+	defaultCPUSeconds = 30
+	maxCPUSeconds     = 300
+)
+
+// Typed errors returned by Capture
+var (
+	ErrInvalidProfileKind     = apperror.New("InvalidProfileKind", http.StatusBadRequest, "profile kind must be cpu or heap")
+	ErrInvalidProfileDuration = apperror.New("InvalidProfileDuration", http.StatusBadRequest, fmt.Sprintf("profile duration must be between 1 and %d seconds", maxCPUSeconds))
+	ErrProfileInProgress      = apperror.New("ProfileInProgress", http.StatusConflict, "a CPU profile is already being captured")
+)
+
+var (
+	ProfileDir string
+
+	// cpuBusy is set while a CPU profile is captured, the runtime supports one at a time
+	cpuBusy atomic.Bool
+)
+
+// Profile describes a captured profile file.
+type Profile struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file"`
+	Seconds int    `json:"seconds,omitempty"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	ProfileDir = os.Getenv("PROFILE_DIR")
+}
+
+// dir returns the profile directory.
+func dir() string {
+	if ProfileDir == "" {
+		return defaultDir
+	}
+	return ProfileDir
+}
+
+// ParseSeconds parses the duration of a CPU profile, defaulting to 30 seconds.
+func ParseSeconds(value string) (int, error) {
+	if value == "" {
+		return defaultCPUSeconds, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 1 || seconds > maxCPUSeconds {
+		return 0, ErrInvalidProfileDuration
+	}
+	return seconds, nil
+}
+
+// Capture writes a profile of the given kind to the profile directory.
+// A CPU profile samples the process for the given duration and is discarded if the context is done first;
+// a heap profile is a snapshot taken after a garbage collection.
+func Capture(ctx context.Context, kind string, seconds int) (Profile, error) {
+	if kind != KindCPU && kind != KindHeap {
+		return Profile{}, ErrInvalidProfileKind
+	}
+	if kind == KindCPU && (seconds < 1 || seconds > maxCPUSeconds) {
+		return Profile{}, ErrInvalidProfileDuration
+	}
+	if kind == KindCPU && !cpuBusy.CompareAndSwap(false, true) {
+		return Profile{}, ErrProfileInProgress
+	}
+	if kind == KindCPU {
+		defer cpuBusy.Store(false)
+	}
+
+	if err := os.MkdirAll(dir(), 0o755); err != nil {
+		return Profile{}, err
+	}
+
+	name := filepath.Join(dir(), fmt.Sprintf("%s-%s.pb.gz", kind, time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.Create(name)
+	if err != nil {
+		return Profile{}, err
+	}
+	defer f.Close()
+
+	profile := Profile{Kind: kind, File: name}
+	if kind == KindCPU {
+		profile.Seconds = seconds
+		err = captureCPU(ctx, f, time.Duration(seconds)*time.Second)
+	} else {
+		runtime.GC()
+		err = pprof.Lookup("heap").WriteTo(f, 0)
+	}
+	if err != nil {
+		os.Remove(name)
+		return Profile{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return Profile{}, err
+	}
+	profile.Bytes = info.Size()
+
+	return profile, nil
+}
+
+// captureCPU samples the CPU for the given duration.
+func captureCPU(ctx context.Context, f *os.File, d time.Duration) error {
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	defer pprof.StopCPUProfile()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
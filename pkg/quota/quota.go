@@ -0,0 +1,124 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package quota enforces soft maximum counts of the entities of a deployment, e.g. to stop a runaway import
+// from filling a shared environment. The count is checked when an entity is created: a creation reaching the
+// maximum is refused with a 422, unless an admin overrides the quota for the request (see OverrideHeader).
+// The quotas are soft: concurrent creations are not serialized and may exceed a maximum by a few entities.
+
+// OverrideHeader is the request header with which an admin creates an entity beyond its quota.
+const OverrideHeader = "X-Quota-Override"
+
+var (
+	MaxDepartments string
+	MaxUsers       string
+
+	maxDepartments int64
+	maxUsers       int64
+)
+
+// LoadEnv loads environment variables
+// MAX_DEPARTMENTS and MAX_USERS are the maximum counts of the departments and of the users, unlimited when empty or 0.
+func LoadEnv() {
+	MaxDepartments = os.Getenv("MAX_DEPARTMENTS")
+	MaxUsers = os.Getenv("MAX_USERS")
+
+	maxDepartments, _ = strconv.ParseInt(MaxDepartments, 10, 64)
+	maxUsers, _ = strconv.ParseInt(MaxUsers, 10, 64)
+}
+
+// Validate checks that the maximum counts are empty or non-negative integers, so a typo does not disable a quota.
+func Validate() error {
+	settings := []struct{ name, value string }{{"MAX_DEPARTMENTS", MaxDepartments}, {"MAX_USERS", MaxUsers}}
+	for _, s := range settings {
+		if s.value == "" {
+			continue
+		}
+		if n, err := strconv.ParseInt(s.value, 10, 64); err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer, got %q", s.name, s.value)
+		}
+	}
+
+	return nil
+}
+
+// Departments returns the maximum count of the departments, 0 when unlimited.
+func Departments() int64 {
+	return maxDepartments
+}
+
+// Users returns the maximum count of the users, 0 when unlimited.
+func Users() int64 {
+	return maxUsers
+}
+
+// Exceeded describes a quota reached by a creation.
+type Exceeded struct {
+	Entity string `json:"entity"`
+	Limit  int64  `json:"limit"`
+	Count  int64  `json:"count"`
+}
+
+// ExceededError is the error of a creation refused by its quota.
+// It unwraps to the typed error of the entity, and carries the quota for the response.
+type ExceededError struct {
+	Err      *apperror.Error
+	Exceeded Exceeded
+}
+
+// Error implements the error interface.
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s: %d of %d", e.Err.Message, e.Exceeded.Count, e.Exceeded.Limit)
+}
+
+// Unwrap returns the typed error of the entity.
+func (e *ExceededError) Unwrap() error {
+	return e.Err
+}
+
+// overrideKeyType is the key of the quota override in the context.
+type overrideKeyType struct{}
+
+// WithOverride returns a context whose creations are not limited by the quotas.
+func WithOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overrideKeyType{}, true)
+}
+
+// Overridden reports whether the quotas are overridden in the context.
+func Overridden(ctx context.Context) bool {
+	overridden, _ := ctx.Value(overrideKeyType{}).(bool)
+	return overridden
+}
+
+// Check checks that one more entity can be created within the limit, 0 meaning unlimited.
+// The entities are only counted when there is a limit. A creation reaching the limit returns an ExceededError
+// wrapping err, or is logged and allowed when the quotas are overridden in the context.
+func Check(ctx context.Context, entity string, limit int64, err *apperror.Error, count func() (int64, error)) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	n, countErr := count()
+	if countErr != nil {
+		return countErr
+	}
+	if n < limit {
+		return nil
+	}
+
+	if Overridden(ctx) {
+		logger.Warn(fmt.Sprintf("the quota of the %s is overridden: %d of %d", entity, n, limit))
+		return nil
+	}
+
+	return &ExceededError{Err: err, Exceeded: Exceeded{Entity: entity, Limit: limit, Count: n}}
+}
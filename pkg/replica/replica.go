@@ -0,0 +1,118 @@
+package replica
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package replica validates the configuration of an application running as one of several replicas.
+// With REPLICA_MODE=TRUE the startup refuses the settings keeping state in the instance that break
+// once the requests are balanced between replicas, and warns about the ones that only degrade.
+
+// ErrInstanceLocalState is returned when a fatal finding prevents the startup.
+var ErrInstanceLocalState = errors.New("configuration relies on instance-local state")
+
+var (
+	ReplicaMode string
+)
+
+// Finding is a setting relying on instance-local state.
+// A fatal finding prevents the startup, the others are logged as warnings.
+type Finding struct {
+	Setting string
+	Problem string
+	Advice  string
+	Fatal   bool
+}
+
+// String formats the finding for the logs.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s; %s", f.Setting, f.Problem, f.Advice)
+}
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	ReplicaMode = os.Getenv("REPLICA_MODE")
+}
+
+// Enabled reports whether the application runs as one of several replicas.
+func Enabled() bool {
+	return ReplicaMode == "TRUE"
+}
+
+// Check returns the findings of the configuration read with getenv.
+func Check(getenv func(string) string) []Finding {
+	var findings []Finding
+
+	if getenv("DB_MIGRATE") == "TRUE" {
+		findings = append(findings, Finding{
+			Setting: "DB_MIGRATE",
+			Problem: "every replica drops and recreates the tables on startup",
+			Advice:  "run the migration once (e.g. from a release job) and set DB_MIGRATE=FALSE on the replicas",
+			Fatal:   true,
+		})
+	}
+
+	if getenv("RATE_LIMITER_BACKEND") != "REDIS" {
+		findings = append(findings, Finding{
+			Setting: "RATE_LIMITER_BACKEND",
+			Problem: "the in-memory rate limiter counts the requests per replica, so the limits grow with the replicas",
+			Advice:  "set RATE_LIMITER_BACKEND=REDIS to share the limits between the replicas",
+			Fatal:   true,
+		})
+	}
+
+	if strings.EqualFold(getenv("STORAGE_BACKEND"), "LOCAL") {
+		findings = append(findings, Finding{
+			Setting: "STORAGE_BACKEND",
+			Problem: "the uploaded files (e.g. the avatars) are written to the local disk of the replica that received them",
+			Advice:  "set STORAGE_BACKEND=S3 to store the uploads in a bucket shared by the replicas",
+			Fatal:   true,
+		})
+	}
+
+	if getenv("LOG_FILES") != "FALSE" {
+		findings = append(findings, Finding{
+			Setting: "LOG_FILES",
+			Problem: "the log files are written to the local disk of each replica and are lost with it",
+			Advice:  "ship the logs from stdout and set LOG_FILES=FALSE",
+		})
+	}
+
+	// The subscribers of the event stream are fed by the outbox dispatcher of their own replica
+	findings = append(findings, Finding{
+		Setting: "/api/v1/events",
+		Problem: "the event stream only receives the events dispatched by its own replica",
+		Advice:  "consume KAFKA_TOPIC to receive the events of all the replicas",
+	})
+
+	return findings
+}
+
+// Validate checks the configuration when the replica mode is enabled.
+// The findings are logged and ErrInstanceLocalState is returned if one of them is fatal.
+func Validate() error {
+	if !Enabled() {
+		return nil
+	}
+
+	fatal := 0
+	for _, f := range Check(os.Getenv) {
+		if f.Fatal {
+			fatal++
+			logger.Error(fmt.Sprintf("REPLICA_MODE: %s", f))
+			continue
+		}
+		logger.Warn(fmt.Sprintf("REPLICA_MODE: %s", f))
+	}
+
+	if fatal > 0 {
+		return fmt.Errorf("%w: %d setting(s) must be changed", ErrInstanceLocalState, fatal)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Package revocation revokes the sessions of a user before their tokens expire, e.g. when the user is disabled.
+// The time of the revocation is stored in Redis per user and the JWT middleware rejects the access tokens
+// of the user issued until then. The key is kept, so the revoked tokens stay rejected after the user is enabled again.
+// A single session is revoked with a marker on its ID, the sid claim of its access tokens, kept until the session expires.
+// A single access token is revoked with a marker on its jti claim (the denylist), kept until the token expires.
+
+const (
+	// revokedKeyPrefix is the prefix of the keys holding the revocation time of the users, in Unix seconds
+	revokedKeyPrefix = "user_tokens_revoked_at:"
+
+	// sessionKeyPrefix is the prefix of the keys marking the revoked sessions
+	sessionKeyPrefix = "session_revoked:"
+
+	// tokenKeyPrefix is the prefix of the keys marking the revoked access tokens, by jti
+	tokenKeyPrefix = "token_revoked:"
+
+	// accessTokenKeyPrefix is the prefix of the keys caching the last access token issued to the users
+	accessTokenKeyPrefix = "access_token:"
+)
+
+// AccessTokenKey returns the Redis key caching the last access token issued to the user.
+func AccessTokenKey(userName string) string {
+	return accessTokenKeyPrefix + userName
+}
+
+// RevokeUser revokes the access tokens of the user issued until the given time
+// and removes the cached access token of the user.
+func RevokeUser(ctx context.Context, client *redis.Client, userID int64, userName string, at time.Time) error {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, revokedKeyPrefix+strconv.FormatInt(userID, 10), at.Unix(), 0)
+		pipe.Del(ctx, AccessTokenKey(userName))
+		return nil
+	})
+
+	return err
+}
+
+// RevokeSession revokes the access tokens of the session with the given ID.
+// The marker is kept until the given time, after which the access tokens of the session have expired.
+func RevokeSession(ctx context.Context, client *redis.Client, sessionID string, until time.Time) error {
+	return client.Set(ctx, sessionKeyPrefix+sessionID, 1, markerTTL(until)).Err()
+}
+
+// RevokeToken revokes the access token with the given ID, its jti claim.
+// The marker is kept until the given time, the expiration of the token.
+func RevokeToken(ctx context.Context, client *redis.Client, tokenID string, until time.Time) error {
+	return client.Set(ctx, tokenKeyPrefix+tokenID, 1, markerTTL(until)).Err()
+}
+
+// markerTTL returns the time to live of a marker kept until the given time, at least a second.
+func markerTTL(until time.Time) time.Duration {
+	ttl := time.Until(until)
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	return ttl
+}
+
+// IsRevoked reports whether an access token of the user issued at the given time, for the given session
+// and with the given ID, was revoked.
+// The issue times of the tokens are in seconds, so a token issued in the second of the revocation is revoked too.
+// The tokens without a session ID or a token ID are only checked against the other markers.
+func IsRevoked(ctx context.Context, client *redis.Client, userID int64, sessionID string, tokenID string, issuedAt time.Time) (bool, error) {
+	// The keys of the user, the session and the token are read in a single round trip
+	keys := []string{revokedKeyPrefix + strconv.FormatInt(userID, 10)}
+	if sessionID != "" {
+		keys = append(keys, sessionKeyPrefix+sessionID)
+	}
+	if tokenID != "" {
+		keys = append(keys, tokenKeyPrefix+tokenID)
+	}
+	values, err := client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, marker := range values[1:] {
+		if marker != nil {
+			return true, nil
+		}
+	}
+	if values[0] == nil {
+		return false, nil
+	}
+
+	value, ok := values[0].(string)
+	if !ok {
+		return false, errors.New("unexpected revocation time")
+	}
+	revokedAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	return issuedAt.Unix() <= revokedAt, nil
+}
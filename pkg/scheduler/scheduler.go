@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+)
+
+// Package scheduler runs the periodic background jobs of the application (e.g. the expiration of the accounts).
+// Each job runs in its own goroutine at its interval, and a run never overlaps the previous run of the same job.
+// The jobs writing to the database are skipped while the read-only maintenance mode is enabled.
+// Several replicas run the same jobs, so a job must be safe to run concurrently (e.g. with row locks).
+// The scheduling stops when the application drains, and the drain waits for the runs in progress.
+
+// Job is a periodic background job.
+type Job struct {
+	// Name identifies the job in the logs.
+	Name string
+	// Interval is the time between the start of two runs, 0 disables the job.
+	Interval time.Duration
+	// Writes is set for the jobs writing to the database, skipped during the maintenance.
+	Writes bool
+	// Run runs the job once. The context is done when the application drains.
+	Run func(ctx context.Context) error
+}
+
+var (
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	running  sync.WaitGroup
+	initOnce sync.Once
+)
+
+// Schedule starts running the job at its interval, the first run happening after one interval.
+// A job with an interval of 0 is disabled.
+func Schedule(job Job) {
+	if job.Interval <= 0 {
+		logger.Info(fmt.Sprintf("Job %s is disabled", job.Name))
+		return
+	}
+
+	initOnce.Do(func() {
+		drain.RegisterJob("scheduler", Stop)
+	})
+
+	mu.Lock()
+	if ctx == nil {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	jobCtx := ctx
+	running.Add(1)
+	mu.Unlock()
+
+	go func() {
+		defer running.Done()
+
+		ticker := time.NewTicker(job.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-drain.Started():
+				return
+			case <-ticker.C:
+				RunJob(jobCtx, job)
+			}
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("Job %s scheduled with an interval of %s", job.Name, job.Interval))
+}
+
+// RunJob runs the job once, unless it writes and the maintenance mode is enabled.
+// A failed run is logged, the job runs again at its next interval.
+func RunJob(ctx context.Context, job Job) {
+	if job.Writes && maintenance.Current().Enabled {
+		return
+	}
+
+	if err := job.Run(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Job %s failed: %v", job.Name, err))
+	}
+}
+
+// Stop stops scheduling the jobs and waits for the runs in progress until the context is done.
+// The jobs scheduled afterwards are started again.
+func Stop(waitCtx context.Context) error {
+	mu.Lock()
+	if cancel != nil {
+		cancel()
+	}
+	ctx, cancel = nil, nil
+	mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-waitCtx.Done():
+		return waitCtx.Err()
+	}
+}
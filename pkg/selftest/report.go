@@ -0,0 +1,63 @@
+package selftest
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Statuses of the steps
+const (
+	StatusPassed  = "PASS"
+	StatusFailed  = "FAIL"
+	StatusSkipped = "SKIP"
+)
+
+// Step is the result of a check or a cleanup step.
+type Step struct {
+	Name     string
+	Status   string
+	Duration time.Duration
+	Detail   string
+}
+
+// Report collects the results of a self-test, in the order of the steps.
+type Report struct {
+	Steps []Step
+}
+
+// NewReport creates an empty report.
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Add records the result of a step.
+func (r *Report) Add(s Step) {
+	r.Steps = append(r.Steps, s)
+}
+
+// Failed reports whether a step failed, a failed cleanup fails the self-test too as it leaves data behind.
+func (r *Report) Failed() bool {
+	for _, s := range r.Steps {
+		if s.Status == StatusFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Print writes a line per step, with the reason of the failures.
+func (r *Report) Print(out io.Writer) {
+	for _, s := range r.Steps {
+		if s.Status == StatusSkipped {
+			fmt.Fprintf(out, "%s  %s\n", s.Status, s.Name)
+			continue
+		}
+
+		fmt.Fprintf(out, "%s  %s (%s)\n", s.Status, s.Name, s.Duration.Round(time.Millisecond))
+		if s.Detail != "" {
+			fmt.Fprintf(out, "      %s\n", s.Detail)
+		}
+	}
+}
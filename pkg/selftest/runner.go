@@ -0,0 +1,259 @@
+package selftest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Runner runs the checks of a self-test, in order.
+// A failed check skips the next ones, the cleanup steps always run.
+type Runner struct {
+	cfg    Config
+	client *http.Client
+	report *Report
+
+	adminToken   string
+	userToken    string
+	userID       int64
+	departmentID string
+	deptDeleted  bool
+}
+
+// NewRunner creates a runner sending its requests to the target of the configuration with the given client.
+func NewRunner(cfg Config, client *http.Client) *Runner {
+	return &Runner{cfg: cfg, client: client}
+}
+
+// apiResponse is the standard response envelope of the API.
+type apiResponse struct {
+	Message string          `json:"message"`
+	Error   any             `json:"error"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// errConflict is returned by do when the resource already exists.
+var errConflict = errors.New("resource already exists")
+
+// Run runs the checks and the cleanup, and returns their report.
+func (r *Runner) Run() *Report {
+	r.report = NewReport()
+	suffix := randomHex(4)
+	userName := "selftest_" + suffix
+	password := "St!" + randomHex(8) + "Qz9"
+
+	r.step("readiness", func() error {
+		_, err := r.do(http.MethodGet, "/readyz", nil, "")
+		return err
+	})
+	r.step("admin login", func() (err error) {
+		r.adminToken, err = r.login(r.cfg.Username, r.cfg.Password)
+		return err
+	})
+	r.step("create throwaway user", func() error {
+		body, _ := json.Marshal(map[string]any{
+			"userName":  userName,
+			"password":  password,
+			"email":     userName + "@" + r.cfg.EmailDomain,
+			"firstName": "Self-test",
+			"userType":  "USER_ACCOUNT",
+			"roles":     []map[string]string{{"roleName": "ROLE_ADMIN"}},
+		})
+		resp, err := r.do(http.MethodPost, "/api/v1/users", body, r.adminToken)
+		if err != nil {
+			return err
+		}
+
+		var created struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.Unmarshal(resp.Data, &created); err != nil || created.ID == 0 {
+			return errors.New("no user ID in the response")
+		}
+		r.userID = created.ID
+		return nil
+	})
+	r.step("throwaway user login", func() (err error) {
+		r.userToken, err = r.login(userName, password)
+		return err
+	})
+	r.step("create department", r.createDepartment)
+	r.step("read department", func() error {
+		return r.expectDepartment(http.MethodGet, nil, "Self-test "+r.departmentID)
+	})
+	r.step("update department", func() error {
+		name := "Self-test " + r.departmentID + " updated"
+		body, _ := json.Marshal(map[string]any{"deptName": name, "active": false})
+		return r.expectDepartment(http.MethodPut, body, name)
+	})
+	r.step("delete department", func() error {
+		if _, err := r.do(http.MethodDelete, "/api/v1/departments/"+r.departmentID, nil, r.userToken); err != nil {
+			return err
+		}
+		r.deptDeleted = true
+		return nil
+	})
+
+	// The temporary data is removed with the admin token, even when the throwaway user could not log in
+	if r.departmentID != "" && !r.deptDeleted {
+		r.cleanup("remove department", func() error {
+			_, err := r.do(http.MethodDelete, "/api/v1/departments/"+r.departmentID, nil, r.adminToken)
+			return err
+		})
+	}
+	if r.userID != 0 {
+		r.cleanup("remove throwaway user", func() error {
+			_, err := r.do(http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", r.userID), nil, r.adminToken)
+			return err
+		})
+	}
+
+	return r.report
+}
+
+// step runs a check, or records it as skipped after a failure.
+func (r *Runner) step(name string, check func() error) {
+	if r.report.Failed() {
+		r.report.Add(Step{Name: name, Status: StatusSkipped})
+		return
+	}
+
+	r.run(name, check)
+}
+
+// cleanup runs a cleanup step, whatever the result of the checks.
+func (r *Runner) cleanup(name string, fn func() error) {
+	r.run("cleanup: "+name, fn)
+}
+
+// run runs a step and records its result.
+func (r *Runner) run(name string, fn func() error) {
+	start := time.Now()
+	err := fn()
+	s := Step{Name: name, Status: StatusPassed, Duration: time.Since(start)}
+	if err != nil {
+		s.Status = StatusFailed
+		s.Detail = err.Error()
+	}
+	r.report.Add(s)
+}
+
+// login logs in with the given credentials and returns the authorization header value of the access token.
+func (r *Runner) login(username string, password string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+
+	resp, err := r.do(http.MethodPost, "/auth/login", body, "")
+	if err != nil {
+		return "", err
+	}
+
+	var data struct {
+		AccessToken string `json:"accessToken"`
+		TokenType   string `json:"tokenType"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil || data.AccessToken == "" {
+		return "", errors.New("no access token in the login response")
+	}
+	if data.TokenType == "" {
+		data.TokenType = "Bearer"
+	}
+
+	return data.TokenType + " " + data.AccessToken, nil
+}
+
+// createDepartment creates the temporary department as the throwaway user.
+// Its ID is random so the self-test can run while another one is in progress,
+// an ID already taken (409 Conflict) is simply replaced by another one.
+func (r *Runner) createDepartment() error {
+	for attempt := 0; attempt < 10; attempt++ {
+		n, _ := rand.Int(rand.Reader, big.NewInt(1000))
+		id := fmt.Sprintf("S%03d", n.Int64())
+		body, _ := json.Marshal(map[string]any{"id": id, "deptName": "Self-test " + id, "active": true})
+
+		_, err := r.do(http.MethodPost, "/api/v1/departments", body, r.userToken)
+		if errors.Is(err, errConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		r.departmentID = id
+		return nil
+	}
+
+	return errors.New("too many department ID conflicts")
+}
+
+// expectDepartment sends a request on the temporary department and checks the name of the department returned.
+func (r *Runner) expectDepartment(method string, body []byte, name string) error {
+	resp, err := r.do(method, "/api/v1/departments/"+r.departmentID, body, r.userToken)
+	if err != nil {
+		return err
+	}
+
+	var dept struct {
+		DeptName string `json:"deptName"`
+	}
+	if err := json.Unmarshal(resp.Data, &dept); err != nil {
+		return errors.New("no department in the response")
+	}
+	if dept.DeptName != name {
+		return fmt.Errorf("department name is %q, expected %q", dept.DeptName, name)
+	}
+
+	return nil
+}
+
+// do sends a request with the given authorization, if any, and decodes the response envelope.
+func (r *Runner) do(method string, path string, body []byte, authorization string) (apiResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(r.cfg.Target, "/")+path, reader)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return apiResponse{}, err
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var apiResp apiResponse
+	json.Unmarshal(data, &apiResp)
+	if resp.StatusCode == http.StatusConflict {
+		return apiResp, errConflict
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiResp, fmt.Errorf("%s %s returned %d: %v", method, path, resp.StatusCode, apiResp.Error)
+	}
+
+	return apiResp, nil
+}
+
+// randomHex returns n random bytes encoded in hexadecimal.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
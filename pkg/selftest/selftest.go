@@ -0,0 +1,81 @@
+package selftest
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Package selftest provides the post-deploy smoke test of the API.
+// It checks the readiness of a running instance, creates a throwaway admin user with the operator
+// credentials, logs in as that user, creates, reads, updates and deletes a temporary department,
+// then removes the throwaway user. It runs against any environment with "app selftest -target https://host:port".
+
+// Config holds the self-test configuration.
+type Config struct {
+	Target      string
+	Username    string
+	Password    string
+	EmailDomain string
+	Insecure    bool
+	Timeout     time.Duration
+}
+
+// ParseConfig parses the self-test command-line flags.
+// The credentials default to the SELFTEST_USERNAME and SELFTEST_PASSWORD environment variables.
+func ParseConfig(args []string) (Config, error) {
+	cfg := Config{}
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	fs.StringVar(&cfg.Target, "target", "http://localhost:1000", "base URL of the API")
+	fs.StringVar(&cfg.Username, "username", os.Getenv("SELFTEST_USERNAME"), "username of an admin user, who creates the throwaway user")
+	fs.StringVar(&cfg.Password, "password", os.Getenv("SELFTEST_PASSWORD"), "password of the admin user")
+	fs.StringVar(&cfg.EmailDomain, "email-domain", "example.com", "domain of the e-mail address of the throwaway user")
+	fs.BoolVar(&cfg.Insecure, "insecure", false, "skip the TLS certificate verification (self-signed certificates)")
+	fs.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "timeout of each request")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Username == "" || cfg.Password == "" {
+		return Config{}, fmt.Errorf("username and password are required")
+	}
+	if cfg.Timeout <= 0 {
+		return Config{}, fmt.Errorf("timeout must be positive")
+	}
+
+	return cfg, nil
+}
+
+// Run runs the self-test with the given command-line arguments and returns the exit code:
+// 0 when every check passed, 1 when a check failed and 2 when the self-test could not run.
+func Run(args []string, out io.Writer) int {
+	cfg, err := ParseConfig(args)
+	if err != nil {
+		fmt.Fprintf(out, "selftest: %v\n", err)
+		return 2
+	}
+
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.Insecure},
+		},
+	}
+
+	fmt.Fprintf(out, "Running the self-test against %s\n", cfg.Target)
+	report := NewRunner(cfg, client).Run()
+	report.Print(out)
+
+	if report.Failed() {
+		fmt.Fprintln(out, "Self-test failed")
+		return 1
+	}
+
+	fmt.Fprintln(out, "Self-test passed")
+	return 0
+}
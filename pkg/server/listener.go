@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Package server provides the network listeners used to serve the API.
+// The API can listen on a TCP port, on a Unix domain socket (e.g. behind a local reverse proxy),
+// or on a socket inherited from systemd (socket activation).
+const (
+	NetworkTCP     = "TCP"
+	NetworkUnix    = "UNIX"
+	NetworkSystemd = "SYSTEMD"
+
+	// systemdListenFDsStart is the first file descriptor passed by systemd (SD_LISTEN_FDS_START)
+	systemdListenFDsStart = 3
+)
+
+// Listen creates the listener selected by the LISTEN_NETWORK environment variable.
+// The port is only used for TCP, which is the default network.
+func Listen(port string) (net.Listener, error) {
+	switch strings.ToUpper(ListenNetwork) {
+	case NetworkUnix:
+		return ListenUnix(UnixSocketPath, UnixSocketMode)
+	case NetworkSystemd:
+		listeners, err := SystemdListeners()
+		if err != nil {
+			return nil, err
+		}
+		return listeners[0], nil
+	case "", NetworkTCP:
+		return net.Listen("tcp", ":"+port)
+	default:
+		return nil, fmt.Errorf("unsupported listen network: %s", ListenNetwork)
+	}
+}
+
+// ListenUnix creates a Unix domain socket listener at the given path.
+// A stale socket file left by a previous run is removed first, and the file mode
+// (octal, default 0660) controls which local users, such as the reverse proxy, can connect.
+func ListenUnix(path string, mode string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("UNIX_SOCKET_PATH environment variable is not set")
+	}
+
+	// Parse the socket file mode
+	perm := os.FileMode(0660)
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UNIX_SOCKET_MODE: %v", err)
+		}
+		perm = os.FileMode(m)
+	}
+
+	// Remove the stale socket file if it exists
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// SystemdListeners returns the listeners inherited from systemd socket activation.
+// It follows the sd_listen_fds protocol: LISTEN_PID must match the current process
+// and LISTEN_FDS tells how many file descriptors are passed, starting at 3.
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_PID does not match)")
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_FDS is not set)")
+	}
+
+	// The variables must not be inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, nfds)
+	for fd := systemdListenFDsStart; fd < systemdListenFDsStart+nfds; fd++ {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("systemd-fd-%d", fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to use systemd socket %d: %v", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
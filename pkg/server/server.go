@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Default values used when the timeouts are not configured.
+// Without them the net/http server waits forever, which exposes the API to slowloris attacks.
+const (
+	defaultReadTimeout       = 30 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20 // 1 MB
+	defaultShutdownTimeout   = 30 * time.Second
+	adminShutdownTimeout     = 5 * time.Second
+)
+
+var (
+	ListenNetwork     string
+	UnixSocketPath    string
+	UnixSocketMode    string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+)
+
+// LoadEnv loads environment variables
+// Timeouts are expressed in seconds, the maximum header size in bytes.
+func LoadEnv() {
+	ListenNetwork = os.Getenv("LISTEN_NETWORK")
+	UnixSocketPath = os.Getenv("UNIX_SOCKET_PATH")
+	UnixSocketMode = os.Getenv("UNIX_SOCKET_MODE")
+
+	ReadTimeout = getEnvSeconds("SERVER_READ_TIMEOUT_SECONDS", defaultReadTimeout)
+	ReadHeaderTimeout = getEnvSeconds("SERVER_READ_HEADER_TIMEOUT_SECONDS", defaultReadHeaderTimeout)
+	WriteTimeout = getEnvSeconds("SERVER_WRITE_TIMEOUT_SECONDS", defaultWriteTimeout)
+	IdleTimeout = getEnvSeconds("SERVER_IDLE_TIMEOUT_SECONDS", defaultIdleTimeout)
+	ShutdownTimeout = getEnvSeconds("SERVER_SHUTDOWN_TIMEOUT_SECONDS", defaultShutdownTimeout)
+
+	MaxHeaderBytes = defaultMaxHeaderBytes
+	if n, err := strconv.Atoi(os.Getenv("SERVER_MAX_HEADER_BYTES")); err == nil && n > 0 {
+		MaxHeaderBytes = n
+	}
+}
+
+// NewHTTPServer creates an HTTP server for the given handler with the configured timeouts.
+// The same server is used for both TLS and non-TLS modes.
+func NewHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       ReadTimeout,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       IdleTimeout,
+		MaxHeaderBytes:    MaxHeaderBytes,
+	}
+}
+
+// ShutdownOnSignal drains the application and shuts it down on SIGINT, SIGTERM or when a
+// drain is requested through pkg/drain (e.g. by the /admin/drain endpoint):
+//  1. the application is marked as draining, so the readiness probe fails;
+//  2. it waits for the drain delay, so the load balancers stop routing new requests;
+//  3. it calls the shutdown function (see Shutdown) with the ShutdownTimeout deadline.
+//
+// The returned channel is closed once the shutdown function returns.
+func ShutdownOnSignal(shutdownFunc func(ctx context.Context) error) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-ctx.Done():
+			drain.Start()
+		case <-drain.Started():
+		}
+		stop()
+
+		logger.Info(fmt.Sprintf("Waiting %s for the load balancers before shutting down", drain.Delay))
+		time.Sleep(drain.Delay)
+
+		logger.Info(fmt.Sprintf("Shutting down the servers (timeout %s)", ShutdownTimeout))
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+
+		if err := shutdownFunc(shutdownCtx); err != nil {
+			logger.Error(fmt.Sprintf("Failed to shut down gracefully: %v", err))
+		}
+	}()
+
+	return done
+}
+
+// Shutdown drains the application and shuts the servers down, nil servers are ignored:
+//  1. the application is marked as draining, if it is not already;
+//  2. the servers stop accepting connections and wait for the active requests, the functions
+//     registered with RegisterOnShutdown (e.g. closing the event streams) are called first;
+//  3. it waits for the background jobs registered in pkg/drain.
+//
+// Steps 2 and 3 share the deadline of the context, whose error is returned when it is reached.
+// The admin server is shut down last, so a drain request waiting for the end of the drain still gets its response.
+func Shutdown(ctx context.Context, adminSrv *http.Server, servers ...*http.Server) error {
+	drain.Start()
+
+	shutdown(ctx, servers...)
+	drain.WaitJobs(ctx)
+	drain.Finish()
+
+	// The admin server gets its own deadline, the drain may have used all of the deadline of the context
+	adminCtx, cancelAdmin := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancelAdmin()
+	shutdown(adminCtx, adminSrv)
+
+	return ctx.Err()
+}
+
+// shutdown shuts the servers down concurrently and waits for them.
+func shutdown(ctx context.Context, servers ...*http.Server) {
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		if srv == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				logger.Error(fmt.Sprintf("Failed to shut down server %s: %v", srv.Addr, err))
+			}
+		}(srv)
+	}
+	wg.Wait()
+}
+
+// getEnvSeconds parses a duration in seconds from an environment variable,
+// falling back to the default value when it is missing or invalid.
+func getEnvSeconds(key string, defaultValue time.Duration) time.Duration {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return defaultValue
+	}
+
+	return time.Duration(n) * time.Second
+}
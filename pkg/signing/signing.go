@@ -0,0 +1,260 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package signing provides detached signatures for high-integrity responses.
+// The signature covers the request method and path, a timestamp and the SHA-256 digest of the body,
+// so a client can detect a tampered, replayed or swapped response even behind TLS-terminating proxies.
+
+// Headers carrying the detached signature
+const (
+	HeaderSignature          = "X-Signature"
+	HeaderSignatureKeyID     = "X-Signature-Key-Id"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHMACSHA256 = "hmac-sha256"
+	AlgorithmEd25519    = "ed25519"
+)
+
+// Signer signs the signing string of a response.
+type Signer interface {
+	Algorithm() string
+	KeyID() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier verifies the signature of a response.
+type Verifier interface {
+	Algorithm() string
+	Verify(data []byte, signature []byte) bool
+}
+
+var (
+	ResponseSigning               string
+	ResponseSigningKeyID          string
+	ResponseSigningSecret         string
+	ResponseSigningPrivateKeyPath string
+
+	mu     sync.RWMutex
+	signer Signer
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	ResponseSigning = os.Getenv("RESPONSE_SIGNING")
+	ResponseSigningKeyID = os.Getenv("RESPONSE_SIGNING_KEY_ID")
+	ResponseSigningSecret = os.Getenv("RESPONSE_SIGNING_SECRET")
+	ResponseSigningPrivateKeyPath = os.Getenv("RESPONSE_SIGNING_PRIVATE_KEY_PATH")
+}
+
+// InitSigner initializes the response signer selected by the RESPONSE_SIGNING environment variable.
+// Response signing is disabled when the variable is empty or set to NONE.
+func InitSigner() {
+	var s Signer
+	switch strings.ToUpper(ResponseSigning) {
+	case "HMAC":
+		if ResponseSigningSecret == "" {
+			logger.Error("Failed to initialize response signer: RESPONSE_SIGNING_SECRET environment variable is not set")
+			return
+		}
+		s = NewHMACSigner(ResponseSigningKeyID, []byte(ResponseSigningSecret))
+	case "ED25519":
+		key, err := LoadEd25519PrivateKey(ResponseSigningPrivateKeyPath)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize response signer: %v", err))
+			return
+		}
+		s = NewEd25519Signer(ResponseSigningKeyID, key)
+	case "", "NONE":
+		s = nil
+	default:
+		logger.Error(fmt.Sprintf("Unsupported response signing algorithm: %s", ResponseSigning))
+		return
+	}
+
+	SetSigner(s)
+	if s != nil {
+		logger.Info(fmt.Sprintf("Response signing enabled with %s", s.Algorithm()))
+	}
+}
+
+// SetSigner replaces the response signer, nil disables response signing.
+func SetSigner(s Signer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	signer = s
+}
+
+// GetSigner returns the response signer, or nil when response signing is disabled.
+func GetSigner() Signer {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return signer
+}
+
+// SigningString builds the content covered by the signature:
+// "<timestamp>\n<METHOD> <path>\n<hex sha256 of the body>".
+func SigningString(timestamp string, method string, path string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	return []byte(timestamp + "\n" + strings.ToUpper(method) + " " + path + "\n" + hex.EncodeToString(digest[:]))
+}
+
+// FormatSignature formats the value of the X-Signature header: "<algorithm>=<base64 signature>".
+func FormatSignature(algorithm string, signature []byte) string {
+	return algorithm + "=" + base64.StdEncoding.EncodeToString(signature)
+}
+
+// ParseSignature parses the value of the X-Signature header.
+func ParseSignature(value string) (string, []byte, error) {
+	algorithm, encoded, ok := strings.Cut(value, "=")
+	if !ok || algorithm == "" || encoded == "" {
+		return "", nil, errors.New("malformed signature header")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed signature: %v", err)
+	}
+
+	return algorithm, signature, nil
+}
+
+// hmacKey signs and verifies with a shared secret (HMAC-SHA256).
+type hmacKey struct {
+	keyID  string
+	secret []byte
+}
+
+// NewHMACSigner creates a signer using HMAC-SHA256 with the given shared secret.
+func NewHMACSigner(keyID string, secret []byte) Signer {
+	return &hmacKey{keyID: keyID, secret: secret}
+}
+
+// NewHMACVerifier creates a verifier using HMAC-SHA256 with the given shared secret.
+func NewHMACVerifier(secret []byte) Verifier {
+	return &hmacKey{secret: secret}
+}
+
+func (k *hmacKey) Algorithm() string { return AlgorithmHMACSHA256 }
+func (k *hmacKey) KeyID() string     { return k.keyID }
+
+func (k *hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k *hmacKey) Verify(data []byte, signature []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+// ed25519Signer signs with an Ed25519 private key.
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a signer using the given Ed25519 private key.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{keyID: keyID, key: key}
+}
+
+func (s *ed25519Signer) Algorithm() string { return AlgorithmEd25519 }
+func (s *ed25519Signer) KeyID() string     { return s.keyID }
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+// ed25519Verifier verifies with an Ed25519 public key.
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier creates a verifier using the given Ed25519 public key.
+func NewEd25519Verifier(key ed25519.PublicKey) Verifier {
+	return &ed25519Verifier{key: key}
+}
+
+func (v *ed25519Verifier) Algorithm() string { return AlgorithmEd25519 }
+
+func (v *ed25519Verifier) Verify(data []byte, signature []byte) bool {
+	return ed25519.Verify(v.key, data, signature)
+}
+
+// LoadEd25519PrivateKey loads a PKCS#8 PEM encoded Ed25519 private key
+// (e.g. generated with "openssl genpkey -algorithm ed25519").
+func LoadEd25519PrivateKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		return nil, errors.New("RESPONSE_SIGNING_PRIVATE_KEY_PATH environment variable is not set")
+	}
+
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, errors.New("failed to decode the private key PEM")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an Ed25519 key")
+	}
+
+	return edKey, nil
+}
+
+// LoadEd25519PublicKey loads a PKIX PEM encoded Ed25519 public key
+// (e.g. extracted with "openssl pkey -pubout").
+func LoadEd25519PublicKey(path string) (ed25519.PublicKey, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, errors.New("failed to decode the public key PEM")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+
+	return edKey, nil
+}
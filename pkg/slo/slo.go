@@ -0,0 +1,159 @@
+package slo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+)
+
+// Package slo holds the latency budgets of the routes, the service level objective of their happy path.
+// The budgets are defined in the JSON file of SLO_BUDGETS_FILE by route, e.g. "GET /api/v1/departments/:id": "100ms",
+// with a default budget for the other routes. The responses of the routes over their budget are counted in the
+// SLO metrics, so the burn of the objective can be alerted on before the users complain.
+
+// HeaderExceeded tags the responses sent after the latency budget of their route, with the budget as value.
+const HeaderExceeded = "X-Latency-Budget-Exceeded"
+
+// RequestIDPlaceholder is replaced by the request ID in the trace link of SLO_TRACE_URL.
+const RequestIDPlaceholder = "{requestId}"
+
+var (
+	BudgetsFile string
+	TraceURL    string
+
+	mu            sync.RWMutex
+	budgets       map[string]time.Duration
+	defaultBudget time.Duration
+
+	initOnce sync.Once
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slo_requests_total",
+		Help: "Total number of successful responses of the routes with a latency budget.",
+	}, []string{"route"})
+	exceededTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slo_budget_exceeded_total",
+		Help: "Total number of successful responses sent after the latency budget of their route.",
+	}, []string{"route"})
+)
+
+// Budgets is the content of the budgets file.
+type Budgets struct {
+	// Default is the budget of the routes not listed, empty for no budget
+	Default string `json:"default"`
+	// Routes maps the routes, as "<METHOD> <path template>", to their budget, e.g. "100ms"
+	Routes map[string]string `json:"routes"`
+}
+
+// LoadEnv loads environment variables
+// SLO_BUDGETS_FILE is the JSON file of the latency budgets, the budgets are disabled when it is empty.
+// SLO_TRACE_URL is the link logged with the slow responses, where {requestId} is replaced by the request ID.
+func LoadEnv() {
+	BudgetsFile = os.Getenv("SLO_BUDGETS_FILE")
+	TraceURL = os.Getenv("SLO_TRACE_URL")
+}
+
+// Init registers the SLO metrics. It is safe to call it several times.
+func Init() {
+	initOnce.Do(func() {
+		metrics.MustRegister(requestsTotal, exceededTotal)
+	})
+}
+
+// LoadBudgets loads the latency budgets from a JSON file.
+func LoadBudgets(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read latency budgets file: %v", err)
+	}
+
+	var b Budgets
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("failed to parse latency budgets file: %v", err)
+	}
+
+	return SetBudgets(b)
+}
+
+// SetBudgets replaces the latency budgets.
+// The routes must be given as "<METHOD> <path template>" and the budgets as positive durations.
+func SetBudgets(b Budgets) error {
+	parsed := make(map[string]time.Duration, len(b.Routes))
+	for route, value := range b.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method == "" || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid route %q, expected e.g. \"GET /api/v1/departments/:id\"", route)
+		}
+
+		budget, err := parseBudget(value)
+		if err != nil {
+			return fmt.Errorf("invalid budget of route %s: %v", route, err)
+		}
+		parsed[route] = budget
+	}
+
+	var def time.Duration
+	if b.Default != "" {
+		budget, err := parseBudget(b.Default)
+		if err != nil {
+			return fmt.Errorf("invalid default budget: %v", err)
+		}
+		def = budget
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	budgets, defaultBudget = parsed, def
+	return nil
+}
+
+// Budget returns the latency budget of the route, as "<METHOD> <path template>", and false when it has none.
+func Budget(route string) (time.Duration, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if budget, ok := budgets[route]; ok {
+		return budget, true
+	}
+
+	return defaultBudget, defaultBudget > 0
+}
+
+// Observe counts a successful response of the route in the SLO metrics.
+func Observe(route string, exceeded bool) {
+	requestsTotal.WithLabelValues(route).Inc()
+	if exceeded {
+		exceededTotal.WithLabelValues(route).Inc()
+	}
+}
+
+// TraceLink returns the link of SLO_TRACE_URL to the request, empty when it is not set.
+func TraceLink(requestID string) string {
+	if TraceURL == "" || requestID == "" {
+		return ""
+	}
+
+	return strings.ReplaceAll(TraceURL, RequestIDPlaceholder, url.PathEscape(requestID))
+}
+
+// parseBudget parses a budget, e.g. "100ms", which must be positive.
+func parseBudget(value string) (time.Duration, error) {
+	budget, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if budget <= 0 {
+		return 0, errors.New("must be positive")
+	}
+
+	return budget, nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultLocalDir is the directory of the local storage when STORAGE_LOCAL_DIR is not set.
+const defaultLocalDir = "uploads"
+
+// LocalStorage stores the objects as files in a directory, served by the API under LocalPath.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStorage creates a local storage in the given directory, which is created if needed.
+// The public URLs start with the base URL, LocalPath when it is empty.
+func NewLocalStorage(dir string, baseURL string) (*LocalStorage, error) {
+	if dir == "" {
+		dir = defaultLocalDir
+	}
+	if baseURL == "" {
+		baseURL = LocalPath
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/") + "/"}, nil
+}
+
+// Put implements the Storage interface.
+// The file is written next to its final path and renamed, so a reader never sees a partial file.
+func (s *LocalStorage) Put(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return s.URL(key), nil
+}
+
+// Delete implements the Storage interface.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// URL implements the Storage interface.
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + key
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Timeout bounds each request to the bucket.
+const s3Timeout = 30 * time.Second
+
+// S3Storage stores the objects in an S3-compatible bucket (AWS S3, MinIO, ...).
+// The requests are signed with AWS Signature Version 4 and address the bucket with a path-style URL,
+// which every S3-compatible service supports.
+type S3Storage struct {
+	endpoint        string
+	region          string
+	bucket          string
+	accessKeyID     string
+	secretAccessKey string
+	baseURL         string
+	client          *http.Client
+}
+
+// NewS3Storage creates an S3 storage for the bucket.
+// The endpoint defaults to the AWS endpoint of the region, the public URLs to the URL of the bucket.
+func NewS3Storage(endpoint, region, bucket, accessKeyID, secretAccessKey, baseURL string) (*S3Storage, error) {
+	if region == "" || bucket == "" {
+		return nil, errors.New("S3_REGION and S3_BUCKET environment variables must be set")
+	}
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY environment variables must be set")
+	}
+
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %v", err)
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	if baseURL == "" {
+		baseURL = endpoint + "/" + bucket
+	}
+
+	return &S3Storage{
+		endpoint:        endpoint,
+		region:          region,
+		bucket:          bucket,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		baseURL:         strings.TrimSuffix(baseURL, "/") + "/",
+		client:          &http.Client{Timeout: s3Timeout},
+	}, nil
+}
+
+// Put implements the Storage interface.
+func (s *S3Storage) Put(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+
+	if err := s.do(ctx, http.MethodPut, key, contentType, data); err != nil {
+		return "", err
+	}
+
+	return s.URL(key), nil
+}
+
+// Delete implements the Storage interface.
+// S3 answers 204 whether the object existed or not.
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	return s.do(ctx, http.MethodDelete, key, "", nil)
+}
+
+// URL implements the Storage interface.
+func (s *S3Storage) URL(key string) string {
+	return s.baseURL + key
+}
+
+// do sends a signed request for the object and checks its status.
+func (s *S3Storage) do(ctx context.Context, method string, key string, contentType string, data []byte) error {
+	path := "/" + encodePath(s.bucket) + "/" + encodePath(key)
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, path, data, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 %s %s failed with status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to the request.
+// The path is the escaped path of the request, which is signed as is.
+func (s *S3Storage) sign(req *http.Request, path string, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// The signed headers are the host and the headers set on the request, lowercased and sorted
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		"", // no query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// encodePath escapes a slash-separated path as required by Signature Version 4:
+// every byte except the unreserved characters and the slashes is percent-encoded.
+func encodePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// sha256Hex returns the hex-encoded SHA-256 hash of the data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
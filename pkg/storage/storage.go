@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package storage provides the object storage abstraction of the uploaded files (e.g. the user avatars).
+// The storage is selected by the STORAGE_BACKEND environment variable: LOCAL writes the objects to a directory
+// served by the API under LocalPath, S3 uploads them to an S3-compatible bucket, and NONE disables the uploads.
+
+// LocalPath is the path the objects of the local storage are served under.
+const LocalPath = "/files"
+
+// ErrDisabled is returned when no storage is configured.
+var ErrDisabled = errors.New("storage is not configured")
+
+// Storage is the interface implemented by the object storages.
+// The keys are slash-separated paths, e.g. "avatars/1/<uuid>.png".
+type Storage interface {
+	// Put stores the object and returns its public URL.
+	Put(ctx context.Context, key string, contentType string, data []byte) (string, error)
+
+	// Delete removes the object, a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL of the object.
+	URL(key string) string
+}
+
+var (
+	StorageBackend    string
+	StorageLocalDir   string
+	StoragePublicURL  string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+
+	mu      sync.RWMutex
+	storage Storage
+)
+
+// LoadEnv loads environment variables
+// STORAGE_PUBLIC_URL is the base URL of the stored objects, e.g. a CDN in front of the bucket.
+func LoadEnv() {
+	StorageBackend = os.Getenv("STORAGE_BACKEND")
+	StorageLocalDir = os.Getenv("STORAGE_LOCAL_DIR")
+	StoragePublicURL = os.Getenv("STORAGE_PUBLIC_URL")
+	S3Endpoint = os.Getenv("S3_ENDPOINT")
+	S3Region = os.Getenv("S3_REGION")
+	S3Bucket = os.Getenv("S3_BUCKET")
+	S3AccessKeyID = os.Getenv("S3_ACCESS_KEY_ID")
+	S3SecretAccessKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+}
+
+// InitStorage initializes the storage selected by the STORAGE_BACKEND environment variable.
+// The uploads are disabled when the variable is empty or set to NONE.
+func InitStorage() {
+	var s Storage
+	switch strings.ToUpper(StorageBackend) {
+	case "LOCAL":
+		ls, err := NewLocalStorage(StorageLocalDir, StoragePublicURL)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize local storage: %v", err))
+			return
+		}
+		s = ls
+		logger.Info(fmt.Sprintf("Local storage initialized in %s", ls.dir))
+	case "S3":
+		ss, err := NewS3Storage(S3Endpoint, S3Region, S3Bucket, S3AccessKeyID, S3SecretAccessKey, StoragePublicURL)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialize S3 storage: %v", err))
+			return
+		}
+		s = ss
+		logger.Info(fmt.Sprintf("S3 storage initialized on bucket %s", S3Bucket))
+	case "", "NONE":
+		s = nil
+	default:
+		logger.Error(fmt.Sprintf("Unknown storage backend: %s", StorageBackend))
+		return
+	}
+
+	SetStorage(s)
+}
+
+// SetStorage replaces the storage, e.g. with a temporary directory in the tests.
+// A nil storage disables the uploads.
+func SetStorage(s Storage) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	storage = s
+}
+
+// Enabled reports whether a storage is configured.
+func Enabled() bool {
+	return current() != nil
+}
+
+// Put stores an object with the configured storage and returns its public URL.
+func Put(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	s := current()
+	if s == nil {
+		return "", ErrDisabled
+	}
+
+	return s.Put(ctx, key, contentType, data)
+}
+
+// Delete removes an object from the configured storage.
+func Delete(ctx context.Context, key string) error {
+	s := current()
+	if s == nil {
+		return ErrDisabled
+	}
+
+	return s.Delete(ctx, key)
+}
+
+// KeyOf returns the key of the object at the given public URL,
+// or false when the URL does not belong to the configured storage.
+func KeyOf(url string) (string, bool) {
+	s := current()
+	if s == nil {
+		return "", false
+	}
+
+	key, ok := strings.CutPrefix(url, s.URL(""))
+	return key, ok && key != ""
+}
+
+// LocalDir returns the directory of the local storage, or an empty string when another storage is configured.
+func LocalDir() string {
+	if ls, ok := current().(*LocalStorage); ok {
+		return ls.dir
+	}
+
+	return ""
+}
+
+// current returns the configured storage, nil when the uploads are disabled.
+func current() Storage {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return storage
+}
+
+// validKey checks that the key is a relative slash-separated path without dot segments,
+// so it cannot escape the directory or the bucket.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid storage key: %q", key)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid storage key: %q", key)
+		}
+	}
+
+	return nil
+}
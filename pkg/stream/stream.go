@@ -0,0 +1,141 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+)
+
+// Package stream keeps the registry of the long-running streaming connections (Server-Sent Events).
+// The domain events are broadcast to every open connection, and the connections are notified
+// and closed cleanly on shutdown so the HTTP server does not wait for them until its timeout.
+
+// bufferSize is the number of events buffered per connection.
+// Events are dropped for a client too slow to keep up, so it never blocks the other connections.
+const bufferSize = 64
+
+// ErrShuttingDown is returned when a connection is opened while the server is shutting down.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+var (
+	mu       sync.Mutex
+	conns    = map[string]*Conn{}
+	closing  bool
+	initOnce sync.Once
+
+	activeStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_active_connections",
+		Help: "Number of open streaming connections.",
+	})
+	streamsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "stream_connections_total",
+		Help: "Total number of streaming connections opened.",
+	})
+	droppedEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "stream_events_dropped_total",
+		Help: "Total number of events dropped for slow streaming clients.",
+	})
+)
+
+// Conn represents an open streaming connection.
+type Conn struct {
+	ID     string
+	UserID int64
+	Events chan event.Event
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Init registers the stream metrics and subscribes the registry to the domain events.
+// It is safe to call it several times.
+func Init() {
+	initOnce.Do(func() {
+		metrics.MustRegister(activeStreams, streamsTotal, droppedEvents)
+		event.Subscribe(Broadcast)
+	})
+}
+
+// Register opens a new connection for the given user.
+// It returns ErrShuttingDown once the shutdown has started, so clients reconnect to another instance.
+func Register(userID int64) (*Conn, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if closing {
+		return nil, ErrShuttingDown
+	}
+
+	conn := &Conn{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Events: make(chan event.Event, bufferSize),
+		done:   make(chan struct{}),
+	}
+	conns[conn.ID] = conn
+
+	activeStreams.Inc()
+	streamsTotal.Inc()
+
+	return conn, nil
+}
+
+// Unregister removes a connection from the registry when its handler returns.
+func Unregister(conn *Conn) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := conns[conn.ID]; ok {
+		delete(conns, conn.ID)
+		activeStreams.Dec()
+	}
+}
+
+// Done returns a channel closed when the connection must be closed by the server.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// close signals the connection handler to send the final event and return.
+func (c *Conn) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// Broadcast sends an event to every open connection without blocking.
+func Broadcast(e event.Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, conn := range conns {
+		select {
+		case conn.Events <- e:
+		default:
+			droppedEvents.Inc()
+		}
+	}
+}
+
+// Count returns the number of open connections.
+func Count() int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return len(conns)
+}
+
+// CloseAll stops accepting new connections and signals the open ones to close.
+// It is registered with http.Server.RegisterOnShutdown: the handlers send a final event and return,
+// which lets the server shutdown complete instead of waiting for the streams until its timeout.
+func CloseAll() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	closing = true
+	for _, conn := range conns {
+		conn.close()
+	}
+}
@@ -0,0 +1,170 @@
+package tokencookie
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Package tokencookie delivers the tokens of the logins in cookies instead of the response body, for the browser
+// applications which should not keep them where JavaScript can read them. With TOKEN_DELIVERY=COOKIE the login,
+// the OIDC login and the token refresh set the access token and the refresh token in httpOnly cookies, the
+// access token cookie is accepted in place of the Authorization header, and the refresh token cookie in place
+// of the refreshToken of the body. The refresh token cookie is only sent to the authentication routes.
+// The browsers send the cookies with the requests of the other sites too, so the state-changing requests
+// authenticated with the cookies must also carry a CSRF token: the double-submit of a random token, set in
+// a cookie readable by the application and sent back in the X-CSRF-Token header, which the other sites can
+// neither read nor set.
+
+// The delivery modes of the tokens
+const (
+	DeliveryBody   = "BODY"
+	DeliveryCookie = "COOKIE"
+)
+
+// The names of the cookies
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+)
+
+// The CSRF token cookie, readable by the application, and the header sending it back
+const (
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// RefreshTokenPath is the path the refresh token cookie is sent to, the one of the authentication routes.
+const RefreshTokenPath = "/auth"
+
+// csrfTokenLength is the length of the CSRF tokens, 256 bits encoded in URL-safe base64
+const csrfTokenLength = 43
+
+var (
+	Delivery string
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+)
+
+// LoadEnv loads environment variables
+// TOKEN_DELIVERY is BODY (the default) or COOKIE, TOKEN_COOKIE_SECURE sends the cookies over HTTPS only (TRUE by
+// default), TOKEN_COOKIE_SAMESITE is STRICT (the default), LAX or NONE, and TOKEN_COOKIE_DOMAIN the domain of the
+// cookies (the host of the API when empty).
+func LoadEnv() {
+	Delivery = DeliveryBody
+	if strings.ToUpper(os.Getenv("TOKEN_DELIVERY")) == DeliveryCookie {
+		Delivery = DeliveryCookie
+	}
+
+	Secure = strings.ToUpper(os.Getenv("TOKEN_COOKIE_SECURE")) != "FALSE"
+
+	switch strings.ToUpper(os.Getenv("TOKEN_COOKIE_SAMESITE")) {
+	case "LAX":
+		SameSite = http.SameSiteLaxMode
+	case "NONE":
+		// The browsers refuse the cross-site cookies which are not secure
+		SameSite = http.SameSiteNoneMode
+		Secure = true
+	default:
+		SameSite = http.SameSiteStrictMode
+	}
+
+	Domain = os.Getenv("TOKEN_COOKIE_DOMAIN")
+}
+
+// Enabled reports whether the tokens are delivered in cookies.
+func Enabled() bool {
+	return Delivery == DeliveryCookie
+}
+
+// Set sets the cookies of the access token and the refresh token, expiring with their tokens.
+func Set(w http.ResponseWriter, accessToken string, accessExpiresAt time.Time, refreshToken string, refreshExpiresAt time.Time) {
+	SetAccessToken(w, accessToken, accessExpiresAt)
+	http.SetCookie(w, newCookie(RefreshTokenCookie, refreshToken, RefreshTokenPath, refreshExpiresAt))
+}
+
+// SetAccessToken sets the cookie of the access token alone, expiring with the token.
+func SetAccessToken(w http.ResponseWriter, accessToken string, expiresAt time.Time) {
+	http.SetCookie(w, newCookie(AccessTokenCookie, accessToken, "/", expiresAt))
+}
+
+// AccessToken returns the access token of the request cookie, empty when there is none.
+func AccessToken(r *http.Request) string {
+	return value(r, AccessTokenCookie)
+}
+
+// RefreshToken returns the refresh token of the request cookie, empty when there is none.
+func RefreshToken(r *http.Request) string {
+	return value(r, RefreshTokenCookie)
+}
+
+// HasTokens reports whether the request carries a token cookie, the access token or the refresh token.
+func HasTokens(r *http.Request) bool {
+	return AccessToken(r) != "" || RefreshToken(r) != ""
+}
+
+// SetCSRFToken sets the CSRF token cookie and returns its token. The token of the request cookie is kept,
+// so the other tabs of the application keep a valid token, and a new one is generated otherwise.
+// The cookie lasts for the browser session.
+func SetCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	token := value(r, CSRFCookie)
+	if len(token) != csrfTokenLength {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		token = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	cookie := newCookie(CSRFCookie, token, "/", time.Time{})
+	cookie.HttpOnly = false
+	http.SetCookie(w, cookie)
+
+	return token, nil
+}
+
+// ValidCSRFToken reports whether the request sends back the token of its CSRF token cookie in the X-CSRF-Token header.
+func ValidCSRFToken(r *http.Request) bool {
+	token := value(r, CSRFCookie)
+	header := r.Header.Get(CSRFHeader)
+	if token == "" || header == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(header)) == 1
+}
+
+// newCookie creates a token cookie, which JavaScript cannot read.
+// A zero expiry makes a session cookie, dropped when the browser closes.
+func newCookie(name string, token string, path string, expiresAt time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    token,
+		Path:     path,
+		Domain:   Domain,
+		Secure:   Secure,
+		HttpOnly: true,
+		SameSite: SameSite,
+	}
+	if !expiresAt.IsZero() {
+		cookie.Expires = expiresAt
+		cookie.MaxAge = max(int(time.Until(expiresAt).Seconds()), 1)
+	}
+
+	return cookie
+}
+
+// value returns the value of the named cookie of the request, empty when there is none.
+func value(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
@@ -0,0 +1,165 @@
+package tokenversion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+)
+
+// Package tokenversion keeps track of the global token version.
+// Every issued JWT carries the version that was current at the time it was signed,
+// and tokens carrying an older version are rejected by the JWT middleware.
+// Bumping the version therefore forces every user to re-authenticate.
+const (
+	// RedisKey is the Redis key holding the current global token version
+	RedisKey = "token_version"
+
+	// RedisChannel is the Redis Pub/Sub channel used to broadcast version changes to every instance
+	RedisChannel = "token_version:changed"
+
+	// readAttempts is the number of times the version is read from Redis at startup before giving up
+	readAttempts = 3
+
+	// readRetryDelay is the delay before the first retry of the read, doubled before each further retry
+	readRetryDelay = 200 * time.Millisecond
+)
+
+var (
+	TokenVersion string
+	current      atomic.Int64
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	TokenVersion = os.Getenv("TOKEN_VERSION")
+}
+
+// Enabled reports whether a minimum token version is configured with TOKEN_VERSION, which is enforced through Redis.
+func Enabled() bool {
+	minVersion, _ := strconv.ParseInt(TokenVersion, 10, 64)
+	return minVersion > 0
+}
+
+// InitTokenVersion initializes the token version from Redis and subscribes to version changes.
+// If the TOKEN_VERSION environment variable is higher than the version stored in Redis,
+// the stored version is raised to it, which allows operators to invalidate all tokens at deploy time.
+// The read is retried, and an error is returned when the version cannot be read or raised, so the
+// application does not start accepting the tokens of a version that was bumped.
+func InitTokenVersion(client *redis.Client) error {
+	if client == nil {
+		return errors.New("redis client is nil")
+	}
+
+	ctx := context.Background()
+
+	// Read the current version from Redis (missing key means version 0)
+	stored, err := read(ctx, client)
+	if err != nil {
+		return fmt.Errorf("failed to get token version from Redis: %w", err)
+	}
+
+	// Raise the stored version to the configured minimum version if needed
+	minVersion, _ := strconv.ParseInt(TokenVersion, 10, 64)
+	if minVersion > stored {
+		if err := client.Set(ctx, RedisKey, minVersion, 0).Err(); err != nil {
+			return fmt.Errorf("failed to set token version in Redis: %w", err)
+		}
+		if err := client.Publish(ctx, RedisChannel, minVersion).Err(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to publish token version to the other instances: %v", err))
+		}
+		stored = minVersion
+	}
+
+	setIfHigher(stored)
+
+	// Listen for version changes published by other instances
+	go subscribe(client)
+
+	logger.Info(fmt.Sprintf("Token version initialized: %d", Current()))
+	return nil
+}
+
+// read reads the version stored in Redis, 0 when it is missing, retrying up to readAttempts times.
+func read(ctx context.Context, client *redis.Client) (int64, error) {
+	delay := readRetryDelay
+	for attempt := 1; ; attempt++ {
+		stored, err := client.Get(ctx, RedisKey).Int64()
+		if err == nil || errors.Is(err, redis.Nil) {
+			return stored, nil
+		}
+		if attempt == readAttempts {
+			return 0, err
+		}
+
+		logger.Warn(fmt.Sprintf("Failed to get token version from Redis (attempt %d of %d), retrying: %v", attempt, readAttempts, err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// subscribe listens on the Redis channel and updates the in-memory version
+// whenever another instance bumps the global token version.
+func subscribe(client *redis.Client) {
+	pubsub := client.Subscribe(context.Background(), RedisChannel)
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		version, err := strconv.ParseInt(msg.Payload, 10, 64)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Invalid token version received: %v", err))
+			continue
+		}
+
+		setIfHigher(version)
+	}
+}
+
+// setIfHigher stores the given version in memory only if it is higher than the current one.
+// The version never goes backwards, so out-of-order messages are harmless.
+func setIfHigher(version int64) {
+	for {
+		old := current.Load()
+		if version <= old || current.CompareAndSwap(old, version) {
+			return
+		}
+	}
+}
+
+// Reset sets the version cached in memory back to 0, e.g. between the tests.
+func Reset() {
+	current.Store(0)
+}
+
+// Current returns the current global token version cached in memory.
+func Current() int64 {
+	return current.Load()
+}
+
+// Bump increments the global token version in Redis and broadcasts the new version to all instances.
+// All tokens issued before the bump become invalid immediately.
+func Bump(ctx context.Context, client *redis.Client) (int64, error) {
+	if client == nil {
+		return 0, errors.New("redis client is nil")
+	}
+
+	version, err := client.Incr(ctx, RedisKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// Update the local cache right away instead of waiting for the Pub/Sub round trip
+	setIfHigher(version)
+
+	if err := client.Publish(ctx, RedisChannel, version).Err(); err != nil {
+		return version, err
+	}
+
+	return version, nil
+}
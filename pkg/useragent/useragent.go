@@ -0,0 +1,105 @@
+package useragent
+
+import (
+	"strings"
+)
+
+// Package useragent turns the User-Agent header of a client into a short label shown to the users,
+// e.g. "Chrome on Windows" in their session listing. It only recognizes the common browsers, operating
+// systems and HTTP tools, the other clients are labelled with the product of their user agent.
+
+// Unknown is the label of an empty user agent.
+const Unknown = "Unknown device"
+
+// maxLabelLength bounds the label of the unrecognized clients, named after their product.
+const maxLabelLength = 50
+
+// match is a token of the user agent and the name it stands for.
+type match struct {
+	token string
+	name  string
+}
+
+// browsers are checked in order: the user agents of most browsers also name the ones they derive from,
+// e.g. Edge names Chrome and Safari, and Chrome names Safari.
+var browsers = []match{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+}
+
+// systems are checked in order: the mobile systems name the desktop ones, e.g. Android names Linux
+// and iOS names "like Mac OS X".
+var systems = []match{
+	{"iphone", "iPhone"},
+	{"ipad", "iPad"},
+	{"android", "Android"},
+	{"windows", "Windows"},
+	{"cros ", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+// tools are the HTTP clients without operating system in their user agent.
+var tools = []match{
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"postmanruntime/", "Postman"},
+	{"insomnia/", "Insomnia"},
+	{"go-http-client/", "Go HTTP client"},
+	{"python-requests/", "Python requests"},
+	{"okhttp/", "OkHttp"},
+	{"axios/", "axios"},
+}
+
+// Label returns the label of the client with the given user agent: the browser and the operating system
+// when both are recognized (e.g. "Firefox on Linux"), the HTTP tool (e.g. "curl"), or the product of the
+// user agent otherwise (e.g. "App/2.1").
+func Label(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return Unknown
+	}
+	lower := strings.ToLower(userAgent)
+
+	if name, ok := find(lower, tools); ok {
+		return name
+	}
+
+	browser, hasBrowser := find(lower, browsers)
+	system, hasSystem := find(lower, systems)
+	switch {
+	case hasBrowser && hasSystem:
+		return browser + " on " + system
+	case hasBrowser:
+		return browser
+	case hasSystem:
+		return system
+	}
+
+	// The product is the first token of the user agent, e.g. "App/2.1" of "App/2.1 (build 7)"
+	product, _, _ := strings.Cut(userAgent, " ")
+	if len(product) > maxLabelLength {
+		product = product[:maxLabelLength]
+	}
+	return product
+}
+
+// find returns the name of the first match found in the user agent.
+func find(lowerUserAgent string, matches []match) (string, bool) {
+	for _, m := range matches {
+		if strings.Contains(lowerUserAgent, m.token) {
+			return m.name, true
+		}
+	}
+
+	return "", false
+}
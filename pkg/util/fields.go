@@ -0,0 +1,114 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseFields parses the sparse fieldset from the "fields" query parameter (e.g. ?fields=id,deptName).
+// The names are checked against the JSON field names of the given type, so a misspelled field
+// is reported instead of silently returning empty objects. It returns nil when no fieldset is requested.
+func ParseFields(c *gin.Context, v any) ([]string, error) {
+	param := strings.TrimSpace(c.Query("fields"))
+	if param == "" {
+		return nil, nil
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	var fields []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown field: %s", name)
+		}
+		fields = append(fields, name)
+	}
+
+	return fields, nil
+}
+
+// SelectFields trims the JSON serialization of an object, or of a list of objects, to the given fields.
+// The data is returned unchanged when no fields are given. Numbers are kept as they are serialized,
+// so large identifiers do not lose precision.
+func SelectFields(data any, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	switch value := decoded.(type) {
+	case map[string]any:
+		return pickFields(value, fields), nil
+	case []any:
+		for i, item := range value {
+			if obj, ok := item.(map[string]any); ok {
+				value[i] = pickFields(obj, fields)
+			}
+		}
+		return value, nil
+	default:
+		return decoded, nil
+	}
+}
+
+// pickFields keeps the given fields of a JSON object.
+// Fields omitted from the serialization (omitempty) stay omitted.
+func pickFields(obj map[string]any, fields []string) map[string]any {
+	picked := make(map[string]any, len(fields))
+	for _, name := range fields {
+		if value, ok := obj[name]; ok {
+			picked[name] = value
+		}
+	}
+
+	return picked
+}
+
+// jsonFieldNames returns the JSON names of the exported fields of a struct type.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	names := map[string]bool{}
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+
+	return names
+}
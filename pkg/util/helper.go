@@ -1,25 +1,13 @@
 package util
 
 import (
-	"crypto/rsa"
 	"fmt"
-	"os"
 
 	"github.com/golang-jwt/jwt/v5"
+	validate "github.com/yoanesber/Go-Department-CRUD/pkg/validator"
 	"gopkg.in/go-playground/validator.v9"
 )
 
-var (
-	JWTPublicKeyPath  string
-	JWTPrivateKeyPath string
-)
-
-// LoadEnv loads environment variables
-func LoadEnv() {
-	JWTPublicKeyPath = os.Getenv("JWT_PUBLIC_KEY_PATH")
-	JWTPrivateKeyPath = os.Getenv("JWT_PRIVATE_KEY_PATH")
-}
-
 // FormatValidationErrors formats validation errors into a slice of maps.
 // Each map contains the field name and the corresponding error message.
 func FormatValidationErrors(err error) []map[string]string {
@@ -38,6 +26,12 @@ func FormatValidationErrors(err error) []map[string]string {
 				message = fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
 			case "max":
 				message = fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+			case "password":
+				message = fmt.Sprintf("%s must contain %s", fe.Field(), validate.Policy.Describe())
+			case "notcommon":
+				message = fmt.Sprintf("%s is too common", fe.Field())
+			case "notidentity":
+				message = fmt.Sprintf("%s must not match the user name or the email", fe.Field())
 			default:
 				message = fmt.Sprintf("%s is not valid", fe.Field())
 			}
@@ -51,32 +45,6 @@ func FormatValidationErrors(err error) []map[string]string {
 	return errors
 }
 
-// LoadPublicKey loads the public key from the specified path in the environment variable.
-// It returns the parsed RSA public key or an error if the file cannot be read or parsed.
-func LoadPublicKey() (*rsa.PublicKey, error) {
-	// Load environment variables
-	LoadEnv()
-
-	keyData, err := os.ReadFile(JWTPublicKeyPath)
-	if err != nil {
-		return nil, err
-	}
-	return jwt.ParseRSAPublicKeyFromPEM(keyData)
-}
-
-// LoadPrivateKey loads the private key from the specified path in the environment variable.
-// It returns the parsed RSA private key or an error if the file cannot be read or parsed.
-func LoadPrivateKey() (*rsa.PrivateKey, error) {
-	// Load environment variables
-	LoadEnv()
-
-	keyData, err := os.ReadFile(JWTPrivateKeyPath)
-	if err != nil {
-		return nil, err
-	}
-	return jwt.ParseRSAPrivateKeyFromPEM(keyData)
-}
-
 // GetInt64Claim retrieves an int64 claim from the JWT claims.
 // It checks if the claim exists and is of type float64, then converts it to int64.
 func GetInt64Claim(claims jwt.MapClaims, key string) (int64, error) {
@@ -0,0 +1,255 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	JWTPublicKeyPath          string
+	JWTPrivateKeyPath         string
+	JWTPreviousPublicKeyPaths string
+)
+
+// LoadEnv loads environment variables
+func LoadEnv() {
+	JWTPublicKeyPath = os.Getenv("JWT_PUBLIC_KEY_PATH")
+	JWTPrivateKeyPath = os.Getenv("JWT_PRIVATE_KEY_PATH")
+	JWTPreviousPublicKeyPaths = os.Getenv("JWT_PREVIOUS_PUBLIC_KEY_PATHS")
+}
+
+// ErrUnsupportedKeyAlgorithm is returned for a signing method without a key pair, e.g. HS256.
+var ErrUnsupportedKeyAlgorithm = errors.New("unsupported key algorithm")
+
+// LoadPublicKey loads the public key from the specified path in the environment variable.
+// It returns the parsed RSA public key or an error if the file cannot be read or parsed.
+func LoadPublicKey() (*rsa.PublicKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	keyData, err := os.ReadFile(JWTPublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(keyData)
+}
+
+// LoadPrivateKey loads the private key from the specified path in the environment variable.
+// It returns the parsed RSA private key or an error if the file cannot be read or parsed.
+func LoadPrivateKey() (*rsa.PrivateKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	keyData, err := os.ReadFile(JWTPrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(keyData)
+}
+
+// LoadECPublicKey loads the ECDSA public key from the specified path in the environment variable.
+// ES256 signs with the P-256 curve, the keys on the other curves are refused.
+func LoadECPublicKey() (*ecdsa.PublicKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	keyData, err := os.ReadFile(JWTPublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseECPublicKey(keyData)
+}
+
+// LoadECPrivateKey loads the ECDSA private key from the specified path in the environment variable.
+// ES256 signs with the P-256 curve, the keys on the other curves are refused.
+func LoadECPrivateKey() (*ecdsa.PrivateKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	keyData, err := os.ReadFile(JWTPrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyData)
+	if err != nil {
+		return nil, err
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("ES256 requires a P-256 key")
+	}
+	return key, nil
+}
+
+// LoadEdPublicKey loads the Ed25519 public key from the specified path in the environment variable.
+func LoadEdPublicKey() (ed25519.PublicKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	keyData, err := os.ReadFile(JWTPublicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseEdPublicKey(keyData)
+}
+
+// LoadEdPrivateKey loads the Ed25519 private key from the specified path in the environment variable.
+func LoadEdPrivateKey() (ed25519.PrivateKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	keyData, err := os.ReadFile(JWTPrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwt.ParseEdPrivateKeyFromPEM(keyData)
+	if err != nil {
+		return nil, err
+	}
+	return key.(ed25519.PrivateKey), nil
+}
+
+// LoadSigningKey loads the private key signing the tokens with the given algorithm: RS256, ES256 or EdDSA.
+func LoadSigningKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return LoadPrivateKey()
+	case jwt.SigningMethodES256.Alg():
+		return LoadECPrivateKey()
+	case jwt.SigningMethodEdDSA.Alg():
+		return LoadEdPrivateKey()
+	}
+
+	return nil, ErrUnsupportedKeyAlgorithm
+}
+
+// LoadPublicKeys loads the public keys validating the tokens signed with the given algorithm:
+// the public key of the signing key followed by the previous public keys, listed in JWT_PREVIOUS_PUBLIC_KEY_PATHS
+// and separated by commas. The previous keys still validate the tokens they signed during a key rotation,
+// until these tokens expire.
+func LoadPublicKeys(alg string) ([]crypto.PublicKey, error) {
+	// Load environment variables
+	LoadEnv()
+
+	paths := []string{JWTPublicKeyPath}
+	for _, path := range strings.Split(JWTPreviousPublicKeyPaths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	keys := make([]crypto.PublicKey, 0, len(paths))
+	for _, path := range paths {
+		keyData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parsePublicKey(alg, keyData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// parsePublicKey parses the PEM of a public key validating the tokens signed with the given algorithm.
+func parsePublicKey(alg string, keyData []byte) (crypto.PublicKey, error) {
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.ParseRSAPublicKeyFromPEM(keyData)
+	case jwt.SigningMethodES256.Alg():
+		return parseECPublicKey(keyData)
+	case jwt.SigningMethodEdDSA.Alg():
+		return parseEdPublicKey(keyData)
+	}
+
+	return nil, ErrUnsupportedKeyAlgorithm
+}
+
+// parseECPublicKey parses the PEM of an ECDSA public key on the P-256 curve.
+func parseECPublicKey(keyData []byte) (*ecdsa.PublicKey, error) {
+	key, err := jwt.ParseECPublicKeyFromPEM(keyData)
+	if err != nil {
+		return nil, err
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("ES256 requires a P-256 key")
+	}
+	return key, nil
+}
+
+// parseEdPublicKey parses the PEM of an Ed25519 public key.
+func parseEdPublicKey(keyData []byte) (ed25519.PublicKey, error) {
+	key, err := jwt.ParseEdPublicKeyFromPEM(keyData)
+	if err != nil {
+		return nil, err
+	}
+	return key.(ed25519.PublicKey), nil
+}
+
+// PublicKeyMembers returns the required members of the JWK of a public key (RFC 7517 and RFC 8037),
+// the key type and its public parameters, encoded in base64url.
+func PublicKeyMembers(key crypto.PublicKey) (map[string]string, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "n": encode(k.N.Bytes()), "e": encode(big.NewInt(int64(k.E)).Bytes())}, nil
+	case *ecdsa.PublicKey:
+		// The coordinates are padded to the size of the curve
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return map[string]string{"kty": "EC", "crv": k.Curve.Params().Name, "x": encode(k.X.FillBytes(make([]byte, size))), "y": encode(k.Y.FillBytes(make([]byte, size)))}, nil
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": encode(k)}, nil
+	}
+
+	return nil, ErrUnsupportedKeyAlgorithm
+}
+
+// PublicKeyID returns the ID of a public key, its RFC 7638 thumbprint, set as kid in the header of the tokens.
+// It is empty for an unsupported key.
+func PublicKeyID(key crypto.PublicKey) string {
+	members, err := PublicKeyMembers(key)
+	if err != nil {
+		return ""
+	}
+
+	// The thumbprint hashes the required members in lexicographic order, without whitespace,
+	// as encoded by json.Marshal for a map of base64url strings
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// FindPublicKey returns the key with the given ID among the keys loaded by LoadPublicKeys.
+// The tokens without kid, signed before the key IDs were added, are validated with the first key.
+func FindPublicKey(keys []crypto.PublicKey, kid string) (crypto.PublicKey, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no public key")
+	}
+	if kid == "" {
+		return keys[0], nil
+	}
+
+	for _, key := range keys {
+		if PublicKeyID(key) == kid {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key ID: %s", kid)
+}
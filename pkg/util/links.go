@@ -0,0 +1,38 @@
+package util
+
+import (
+	"net/url"
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Links holds the hypermedia links of a response, keyed by their relation (e.g. "self", "next").
+// The links are absolute paths, so they stay valid behind a proxy rewriting the host.
+type Links map[string]string
+
+// SelfLink returns the path and query string of the current request.
+func SelfLink(c *gin.Context) string {
+	return c.Request.URL.RequestURI()
+}
+
+// QueryLink returns the path of the current request with the given query parameters replaced.
+// A parameter with an empty value is removed from the query string.
+func QueryLink(c *gin.Context, params map[string]string) string {
+	query := c.Request.URL.Query()
+	for key, value := range params {
+		if value == "" {
+			query.Del(key)
+			continue
+		}
+		query.Set(key, value)
+	}
+
+	u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+	return u.RequestURI()
+}
+
+// ResourceLink joins a collection path and the escaped resource ID, followed by optional sub-resources.
+func ResourceLink(collection string, id string, sub ...string) string {
+	return path.Join(append([]string{collection, url.PathEscape(id)}, sub...)...)
+}
@@ -49,6 +49,34 @@ func GetJSON[T any](ctx context.Context, client *redis.Client, key string) (*T,
 	return &result, nil
 }
 
+// RefreshTTL sets the time to live of the keys in a single round trip, e.g. to slide the expiry
+// of the keys of the active sessions. The missing keys are skipped, it returns the number of keys refreshed.
+func RefreshTTL(ctx context.Context, client *redis.Client, ttl time.Duration, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	cmds := make([]*redis.BoolCmd, len(keys))
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var refreshed int64
+	for _, cmd := range cmds {
+		if cmd.Val() {
+			refreshed++
+		}
+	}
+
+	return refreshed, nil
+}
+
 // DeleteKey deletes a key from Redis.
 func DeleteKey(ctx context.Context, client *redis.Client, key string) error {
 	return client.Del(ctx, key).Err()
@@ -4,16 +4,20 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apperror"
 )
 
 // ErrorResponse represents the structure of an error response.
 type HttpResponse struct {
-	Message   string    `json:"message"`   // A user-friendly error message
-	Error     any       `json:"error"`     // The actual error message (optional)
-	Path      string    `json:"path"`      // The request path that caused the error (optional)
-	Status    int       `json:"status"`    // HTTP status code (optional)
-	Data      any       `json:"data"`      // Additional data related to the error (optional)
-	Timestamp time.Time `json:"timestamp"` // The timestamp when the error occurred (optional)
+	Message   string    `json:"message"`         // A user-friendly error message
+	Code      string    `json:"code,omitempty"`  // The code of a typed application error (optional)
+	Error     any       `json:"error"`           // The actual error message (optional)
+	Path      string    `json:"path"`            // The request path that caused the error (optional)
+	Status    int       `json:"status"`          // HTTP status code (optional)
+	Data      any       `json:"data"`            // Additional data related to the error (optional)
+	Meta      any       `json:"meta,omitempty"`  // Pagination metadata of a listing (optional)
+	Links     Links     `json:"links,omitempty"` // Hypermedia links to the resource and its related resources (optional)
+	Timestamp time.Time `json:"timestamp"`       // The timestamp when the error occurred (optional)
 }
 
 func JSONSuccess(c *gin.Context, status int, message string, data interface{}) {
@@ -27,6 +31,33 @@ func JSONSuccess(c *gin.Context, status int, message string, data interface{}) {
 	})
 }
 
+// JSONSuccessWithMeta writes a successful response with metadata, such as the pagination of a listing.
+func JSONSuccessWithMeta(c *gin.Context, status int, message string, data interface{}, meta interface{}) {
+	c.JSON(status, HttpResponse{
+		Message:   message,
+		Error:     nil,
+		Path:      c.Request.URL.Path,
+		Status:    status,
+		Data:      data,
+		Meta:      meta,
+		Timestamp: time.Now(),
+	})
+}
+
+// JSONSuccessWithLinks writes a successful response with hypermedia links and optional metadata.
+func JSONSuccessWithLinks(c *gin.Context, status int, message string, data interface{}, meta interface{}, links Links) {
+	c.JSON(status, HttpResponse{
+		Message:   message,
+		Error:     nil,
+		Path:      c.Request.URL.Path,
+		Status:    status,
+		Data:      data,
+		Meta:      meta,
+		Links:     links,
+		Timestamp: time.Now(),
+	})
+}
+
 func JSONError(c *gin.Context, status int, message string, err string) {
 	c.JSON(status, HttpResponse{
 		Message:   message,
@@ -48,3 +79,30 @@ func JSONErrorMap(c *gin.Context, status int, message string, err []map[string]s
 		Timestamp: time.Now(),
 	})
 }
+
+// JSONAppError writes the response of a typed application error (see pkg/apperror) with its status and code.
+// It returns false without writing anything if err is not a typed error, so the caller can fall back
+// to its own error response.
+func JSONAppError(c *gin.Context, message string, err error) bool {
+	return JSONAppErrorWithData(c, message, err, nil)
+}
+
+// JSONAppErrorWithData writes the response of a typed application error with data describing it,
+// e.g. the conflicting resource. It returns false if err is not a typed error.
+func JSONAppErrorWithData(c *gin.Context, message string, err error, data interface{}) bool {
+	appErr, ok := apperror.As(err)
+	if !ok {
+		return false
+	}
+
+	c.JSON(appErr.Status, HttpResponse{
+		Message:   message,
+		Code:      appErr.Code,
+		Error:     appErr.Message,
+		Path:      c.Request.URL.Path,
+		Status:    appErr.Status,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+	return true
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Similarity returns how close two strings are, from 0 (nothing in common) to 1 (equal).
+// The strings are compared case-insensitively, and the score is the best of the trigram similarity,
+// which tolerates reordered words, and the Levenshtein ratio, which tolerates typos in short strings.
+func Similarity(a, b string) float64 {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	if a == b {
+		return 1
+	}
+
+	return max(TrigramSimilarity(a, b), LevenshteinRatio(a, b))
+}
+
+// TrigramSimilarity returns the ratio of the trigrams shared by two strings, like pg_trgm:
+// each word is padded with two spaces before and one after, and the trigrams are compared as sets.
+func TrigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// trigrams returns the set of trigrams of the words of a string.
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+// LevenshteinRatio returns 1 minus the edit distance of two strings relative to the longest one.
+func LevenshteinRatio(a, b string) float64 {
+	n := max(len([]rune(a)), len([]rune(b)))
+	if n == 0 {
+		return 1
+	}
+
+	return 1 - float64(Levenshtein(a, b))/float64(n)
+}
+
+// Levenshtein returns the minimum number of single-character insertions, deletions and substitutions
+// needed to change one string into the other.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// Only the previous row of the distance matrix is kept
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr := make([]int, len(rb)+1)
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+
+	return prev[len(rb)]
+}
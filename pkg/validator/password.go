@@ -0,0 +1,197 @@
+package validator
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// The password policy is enforced with three validations:
+// "password" checks the length and the character classes, "notcommon" refuses the common passwords
+// and "notidentity=UserName Email" refuses a password equal to the given sibling fields (or to the
+// local part of an e-mail), compared case-insensitively.
+
+// bcrypt ignores the bytes after the 72nd, a longer minimum length would not be enforced
+const maxPasswordMinLength = 72
+
+//go:embed common-passwords.txt
+var commonPasswordsFile string
+
+// PasswordPolicy holds the rules of the "password" validation.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+var (
+	PasswordMinLength     string
+	PasswordRequireUpper  string
+	PasswordRequireLower  string
+	PasswordRequireDigit  string
+	PasswordRequireSymbol string
+	PasswordBannedFile    string
+
+	// Policy is the password policy, configured by LoadEnv
+	Policy = PasswordPolicy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true}
+
+	// bannedPasswords holds the lowercase common passwords
+	bannedPasswords = parseBannedPasswords(commonPasswordsFile)
+)
+
+// LoadEnv loads environment variables
+// The character classes are required unless they are set to FALSE, except the symbols which are
+// required when set to TRUE. PASSWORD_BANNED_FILE adds its passwords to the built-in common passwords.
+func LoadEnv() {
+	PasswordMinLength = os.Getenv("PASSWORD_MIN_LENGTH")
+	PasswordRequireUpper = os.Getenv("PASSWORD_REQUIRE_UPPER")
+	PasswordRequireLower = os.Getenv("PASSWORD_REQUIRE_LOWER")
+	PasswordRequireDigit = os.Getenv("PASSWORD_REQUIRE_DIGIT")
+	PasswordRequireSymbol = os.Getenv("PASSWORD_REQUIRE_SYMBOL")
+	PasswordBannedFile = os.Getenv("PASSWORD_BANNED_FILE")
+
+	Policy = PasswordPolicy{
+		MinLength:     8,
+		RequireUpper:  PasswordRequireUpper != "FALSE",
+		RequireLower:  PasswordRequireLower != "FALSE",
+		RequireDigit:  PasswordRequireDigit != "FALSE",
+		RequireSymbol: PasswordRequireSymbol == "TRUE",
+	}
+	if PasswordMinLength != "" {
+		n, err := strconv.Atoi(PasswordMinLength)
+		if err != nil || n < 1 || n > maxPasswordMinLength {
+			logger.Warn(fmt.Sprintf("PASSWORD_MIN_LENGTH must be a number between 1 and %d, using %d", maxPasswordMinLength, Policy.MinLength))
+		} else {
+			Policy.MinLength = n
+		}
+	}
+
+	bannedPasswords = parseBannedPasswords(commonPasswordsFile)
+	if PasswordBannedFile != "" {
+		data, err := os.ReadFile(PasswordBannedFile)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("failed to read PASSWORD_BANNED_FILE, using the built-in common passwords only: %v", err))
+			return
+		}
+		for password := range parseBannedPasswords(string(data)) {
+			bannedPasswords[password] = struct{}{}
+		}
+	}
+}
+
+// parseBannedPasswords parses a list of passwords, one per line; the empty lines and the lines starting with # are ignored.
+func parseBannedPasswords(data string) map[string]struct{} {
+	passwords := map[string]struct{}{}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+
+	return passwords
+}
+
+// Describe returns the rules of the policy, e.g. "at least 8 characters, an uppercase letter and a digit".
+func (p PasswordPolicy) Describe() string {
+	rules := []string{fmt.Sprintf("at least %d characters", p.MinLength)}
+	if p.RequireUpper {
+		rules = append(rules, "an uppercase letter")
+	}
+	if p.RequireLower {
+		rules = append(rules, "a lowercase letter")
+	}
+	if p.RequireDigit {
+		rules = append(rules, "a digit")
+	}
+	if p.RequireSymbol {
+		rules = append(rules, "a symbol")
+	}
+
+	if len(rules) == 1 {
+		return rules[0]
+	}
+	return strings.Join(rules[:len(rules)-1], ", ") + " and " + rules[len(rules)-1]
+}
+
+// Allows reports whether a password satisfies the length and the character classes of the policy.
+func (p PasswordPolicy) Allows(password string) bool {
+	if len([]rune(password)) < p.MinLength {
+		return false
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	return (upper || !p.RequireUpper) &&
+		(lower || !p.RequireLower) &&
+		(digit || !p.RequireDigit) &&
+		(symbol || !p.RequireSymbol)
+}
+
+// IsCommonPassword reports whether a password is one of the banned common passwords.
+func IsCommonPassword(password string) bool {
+	_, ok := bannedPasswords[strings.ToLower(password)]
+	return ok
+}
+
+// validatePassword implements the "password" validation.
+func validatePassword(fl validator.FieldLevel) bool {
+	return Policy.Allows(fl.Field().String())
+}
+
+// validateNotCommon implements the "notcommon" validation.
+func validateNotCommon(fl validator.FieldLevel) bool {
+	return !IsCommonPassword(fl.Field().String())
+}
+
+// validateNotIdentity implements the "notidentity" validation, whose parameter lists the
+// sibling fields the value must differ from. The empty fields are ignored.
+func validateNotIdentity(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	parent := reflect.Indirect(fl.Parent())
+	if parent.Kind() != reflect.Struct {
+		return true
+	}
+
+	for _, name := range strings.Fields(fl.Param()) {
+		field := reflect.Indirect(parent.FieldByName(name))
+		if !field.IsValid() || field.Kind() != reflect.String || field.String() == "" {
+			continue
+		}
+
+		identity := field.String()
+		if strings.EqualFold(password, identity) {
+			return false
+		}
+		if at := strings.LastIndex(identity, "@"); at > 0 && strings.EqualFold(password, identity[:at]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,13 +1,32 @@
 package validator
 
 import (
+	"encoding/json"
 	"reflect"
+	"regexp"
 	"strings"
 	"sync"
 
 	"gopkg.in/go-playground/validator.v9"
 )
 
+// SlugPattern is the pattern enforced by the "slug" validation.
+var SlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// RoleNamePattern is the pattern enforced by the "rolename" validation, e.g. ROLE_AUDITOR.
+var RoleNamePattern = regexp.MustCompile(`^ROLE_[A-Z][A-Z0-9_]*$`)
+
+// Limits enforced by the "metadata" validation on the free-form attributes of an entity.
+// The number of keys is limited with the "max" rule of the field.
+const (
+	MetadataMaxValueLength = 256
+	MetadataMaxBytes       = 8 * 1024
+)
+
+// MetadataKeyPattern is the pattern of the metadata keys.
+// Dots are not allowed because they separate the key in the "metadata.key=value" filters.
+var MetadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 var (
 	once     sync.Once
 	validate *validator.Validate
@@ -27,6 +46,28 @@ func InitValidator() {
 			}
 			return strings.Split(tag, ",")[0]
 		})
+
+		// Register the "slug" validation for identifiers such as tags:
+		// lowercase letters, digits and single hyphens (e.g. "remote-first")
+		validate.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+			return SlugPattern.MatchString(fl.Field().String())
+		})
+
+		// Register the "rolename" validation for the names of the roles:
+		// ROLE_ followed by uppercase letters, digits and underscores (e.g. "ROLE_AUDITOR")
+		validate.RegisterValidation("rolename", func(fl validator.FieldLevel) bool {
+			return RoleNamePattern.MatchString(fl.Field().String())
+		})
+
+		// Register the "metadata" validation for free-form attributes:
+		// keys matching MetadataKeyPattern, scalar values (string, number, boolean or null),
+		// strings of at most MetadataMaxValueLength characters and MetadataMaxBytes once encoded
+		validate.RegisterValidation("metadata", validateMetadata)
+
+		// Register the password policy validations, see password.go
+		validate.RegisterValidation("password", validatePassword)
+		validate.RegisterValidation("notcommon", validateNotCommon)
+		validate.RegisterValidation("notidentity", validateNotIdentity)
 	})
 }
 
@@ -34,3 +75,33 @@ func InitValidator() {
 func GetValidator() *validator.Validate {
 	return validate
 }
+
+// validateMetadata implements the "metadata" validation on a map field.
+func validateMetadata(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	if field.Kind() != reflect.Map {
+		return false
+	}
+
+	iter := field.MapRange()
+	for iter.Next() {
+		key := iter.Key()
+		if key.Kind() != reflect.String || !MetadataKeyPattern.MatchString(key.String()) {
+			return false
+		}
+
+		switch value := iter.Value().Interface().(type) {
+		case nil, bool, float64, float32, int, int64, json.Number:
+		case string:
+			if len([]rune(value)) > MetadataMaxValueLength {
+				return false
+			}
+		default:
+			// Nested objects and arrays are not allowed
+			return false
+		}
+	}
+
+	data, err := json.Marshal(field.Interface())
+	return err == nil && len(data) <= MetadataMaxBytes
+}
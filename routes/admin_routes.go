@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/internal/admin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/context"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/headers"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/logging"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// SetupAdminRouter initializes the router for the internal admin listener.
+// It serves the metrics, debug and admin endpoints, which must never be exposed on the public API port.
+// The listener is expected to be bound to an internal interface and firewalled off from public traffic.
+func SetupAdminRouter() *gin.Engine {
+	// Create a new Gin router instance
+	r := gin.Default()
+
+	// Set up middleware for the router
+	ch := chain.New(
+		chain.Middleware{Name: "postgres-context", Stage: chain.StageContext, Handler: context.PostgresDBContext()},
+		chain.Middleware{Name: "redis-context", Stage: chain.StageContext, Handler: context.RedisContext()},
+		chain.Middleware{Name: "request-id", Stage: chain.StageHeaders, Handler: headers.RequestIDHeader()},
+		chain.Middleware{Name: "request-logger", Stage: chain.StageLogging, Handler: logging.RequestLogger()},
+	)
+	ch.Apply(r)
+
+	// Expose the Prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Expose the runtime profiling endpoints
+	debugGroup := r.Group("/debug/pprof")
+	{
+		debugGroup.GET("/", gin.WrapF(pprof.Index))
+		debugGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		debugGroup.GET("/profile", gin.WrapF(pprof.Profile))
+		debugGroup.GET("/symbol", gin.WrapF(pprof.Symbol))
+		debugGroup.POST("/symbol", gin.WrapF(pprof.Symbol))
+		debugGroup.GET("/trace", gin.WrapF(pprof.Trace))
+		debugGroup.GET("/:name", func(c *gin.Context) {
+			pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+		})
+	}
+
+	// Set up the admin routes
+	admin.RegisterRoutes(&r.RouterGroup, NewDeps(ch))
+
+	// NoRoute handler for undefined routes
+	r.NoRoute(func(c *gin.Context) {
+		util.JSONError(c, http.StatusNotFound, "Not Found", "The requested resource was not found")
+	})
+
+	return r
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/storage"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// APIVersion is a version of the API listed by the API root.
+type APIVersion struct {
+	Version string `json:"version"`
+	Href    string `json:"href"`
+	Status  string `json:"status"`
+}
+
+// APIRoot describes the API to the clients, so they discover its capabilities at runtime instead of hard-coding paths.
+// The features are the flags relevant to the caller, the anonymous callers only see the public ones.
+type APIRoot struct {
+	Versions      []APIVersion    `json:"versions"`
+	Authenticated bool            `json:"authenticated"`
+	Features      map[string]bool `json:"features"`
+}
+
+// apiVersions are the versions of the API served by the router.
+var apiVersions = []APIVersion{
+	{Version: "v1", Href: "/api/v1", Status: "current"},
+}
+
+// apiFeature is a feature flag listed by the API root.
+// It is shown to every caller when it has no roles and is not restricted to the authenticated callers,
+// otherwise to the callers it concerns only.
+type apiFeature struct {
+	Name          string
+	Authenticated bool
+	Roles         []string
+	Enabled       func() bool
+}
+
+// apiFeatures are the feature flags listed by the API root.
+var apiFeatures = []apiFeature{
+	{Name: "read-only", Enabled: func() bool { return maintenance.Current().Enabled }},
+	{Name: "public-api", Enabled: func() bool { return department.PublicAPIEnabled == "TRUE" && module.Enabled(module.PublicAPI) }},
+	{Name: "password-reset", Enabled: func() bool { return module.Enabled(module.PasswordReset) }},
+	{Name: "self-registration", Enabled: auth.RegistrationEnabled},
+	{Name: "avatars", Authenticated: true, Enabled: storage.Enabled},
+	{Name: "dataredis", Roles: []string{"ROLE_ADMIN", "ROLE_USER"}, Enabled: func() bool { return module.Enabled(module.DataRedis) }},
+	{Name: "webhooks", Roles: []string{"ROLE_ADMIN"}, Enabled: func() bool { return module.Enabled(module.Webhooks) }},
+	{Name: "impersonation", Roles: []string{"ROLE_ADMIN"}, Enabled: func() bool { return true }},
+}
+
+// visibleTo reports whether the feature concerns the caller with the given metadata, nil for the anonymous callers.
+func (f apiFeature) visibleTo(meta *metacontext.RequestMeta) bool {
+	if len(f.Roles) == 0 {
+		return !f.Authenticated || meta != nil
+	}
+	if meta == nil {
+		return false
+	}
+
+	for _, r := range meta.Roles {
+		if slices.Contains(f.Roles, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewAPIRoot describes the API to the caller with the given metadata, nil for the anonymous callers.
+func NewAPIRoot(meta *metacontext.RequestMeta) APIRoot {
+	root := APIRoot{
+		Versions:      apiVersions,
+		Authenticated: meta != nil,
+		Features:      map[string]bool{},
+	}
+	for _, f := range apiFeatures {
+		if f.visibleTo(meta) {
+			root.Features[f.Name] = f.Enabled()
+		}
+	}
+
+	return root
+}
+
+// APIRootHandler serves the API root, listing the versions, the feature flags relevant to the caller
+// and the links to the OpenAPI spec, the JWKS and the health probes.
+// The response depends on the credentials, so the caches key it on them.
+func APIRootHandler(c *gin.Context) {
+	meta, _ := metacontext.RequestMetaFrom(c.Request.Context())
+
+	links := util.Links{
+		"self":      c.Request.URL.Path,
+		"openapi":   "/openapi.json",
+		"jwks":      auth.JWKSPath,
+		"liveness":  "/livez",
+		"readiness": "/readyz",
+		"schemas":   "/schemas",
+		"login":     "/auth/login",
+	}
+	for _, v := range apiVersions {
+		links[v.Version] = v.Href
+	}
+
+	c.Header("Vary", "Authorization, X-API-Key")
+	util.JSONSuccessWithLinks(c, http.StatusOK, "API root retrieved successfully", NewAPIRoot(meta), nil, links)
+}
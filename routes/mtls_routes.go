@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/context"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/headers"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/logging"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// SetupMTLSRouter initializes the router for the mTLS listener used by internal service callers.
+// It serves the same API routes as the public router, but callers are authenticated with their
+// client certificate instead of a JWT, so the /auth routes are not exposed.
+func SetupMTLSRouter() *gin.Engine {
+	// Create a new Gin router instance
+	r := gin.Default()
+
+	// Set up middleware for the router
+	ch := chain.New(
+		chain.Middleware{Name: "postgres-context", Stage: chain.StageContext, Handler: context.PostgresDBContext()},
+		chain.Middleware{Name: "redis-context", Stage: chain.StageContext, Handler: context.RedisContext()},
+		chain.Middleware{Name: "security-headers", Stage: chain.StageHeaders, Handler: headers.RequestSecurityHeader()},
+		chain.Middleware{Name: "request-id", Stage: chain.StageHeaders, Handler: headers.RequestIDHeader()},
+		chain.Middleware{Name: "request-logger", Stage: chain.StageLogging, Handler: logging.RequestLogger()},
+		chain.Middleware{Name: "latency-budget", Stage: chain.StageLogging, Handler: logging.LatencyBudget()},
+		chain.Middleware{Name: "gzip", Stage: chain.StageCompression, Feature: chain.Compression, Handler: gzip.Gzip(gzip.DefaultCompression)},
+	)
+	ch.Apply(r)
+
+	// Set up the API version 1 routes authenticated with the client certificate
+	v1 := r.Group("/api/v1", authorization.ClientCertAuthentication())
+	setupAPIRoutes(v1, NewDeps(ch))
+
+	// NoRoute handler for undefined routes
+	r.NoRoute(func(c *gin.Context) {
+		util.JSONError(c, http.StatusNotFound, "Not Found", "The requested resource was not found")
+	})
+
+	return r
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/dataredis"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/fixture"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/schema"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+)
+
+// operations holds the OpenAPI documentation declared by the modules, keyed by module name.
+var operations = map[string]map[string]openapi.Operation{
+	"auth":        auth.Operations,
+	"dataredis":   dataredis.Operations,
+	"department":  department.Operations,
+	"oauthclient": oauthclient.Operations,
+	"user":        user.Operations,
+	"webhook":     webhook.Operations,
+}
+
+// OpenAPIHandler serves the OpenAPI spec generated from the routes registered on the router.
+// The spec is generated on the first request, once all the routes are registered.
+func OpenAPIHandler(r *gin.Engine) gin.HandlerFunc {
+	var once sync.Once
+	var doc map[string]any
+
+	return func(c *gin.Context) {
+		once.Do(func() { doc = BuildOpenAPISpec(r) })
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// BuildOpenAPISpec generates the OpenAPI spec of the routes registered on the router.
+// The request bodies reference the published JSON Schemas and the error responses the typed errors.
+// The examples are the sample entities of the tests (see internal/fixture).
+func BuildOpenAPISpec(r *gin.Engine) map[string]any {
+	var routes []openapi.Route
+	for _, route := range r.Routes() {
+		routes = append(routes, openapi.Route{Method: route.Method, Path: route.Path, Handler: route.Handler})
+	}
+
+	schemas := map[string]any{}
+	for _, entity := range schema.GetEntities() {
+		s, _ := schema.GetSchema(entity)
+		schemas[entity] = s
+	}
+
+	version := os.Getenv("API_VERSION")
+	if version == "" {
+		version = "v1"
+	}
+
+	spec := openapi.Spec{
+		Title:      "Department API",
+		Version:    version,
+		Routes:     routes,
+		Schemas:    schemas,
+		Operations: operations,
+		Examples:   fixture.Examples(),
+	}
+
+	return spec.Build()
+}
@@ -10,16 +10,61 @@ import (
 	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
 	"github.com/yoanesber/Go-Department-CRUD/internal/dataredis"
 	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/eventstream"
+	"github.com/yoanesber/Go-Department-CRUD/internal/health"
+	"github.com/yoanesber/Go-Department-CRUD/internal/job"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/schema"
 	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/availability"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/context"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/headers"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/logging"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/ratelimiter"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/validation"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/storage"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 	"golang.org/x/time/rate"
 )
 
+// rootModules are the modules registering their routes at the root of the public router,
+// e.g. the health probes, the authentication and the published JSON Schemas.
+var rootModules = []module.Module{
+	{Register: health.RegisterRoutes},
+	{Register: auth.RegisterRoutes},
+	{Register: schema.RegisterRoutes},
+}
+
+// apiModules are the modules registering their routes under the API version 1 group.
+// They are served by the public router and by the mTLS router.
+// The named modules are skipped when they are disabled with MODULES_DISABLED.
+var apiModules = []module.Module{
+	{Register: department.RegisterRoutes},
+	{Register: user.RegisterRoutes},
+	{Register: auth.RegisterImpersonationRoutes},
+	{Name: module.Webhooks, Register: webhook.RegisterRoutes},
+	{Register: oauthclient.RegisterRoutes},
+	{Register: eventstream.RegisterRoutes},
+	{Register: job.RegisterRoutes},
+	{Name: module.DataRedis, Register: dataredis.RegisterRoutes},
+}
+
+// NewDeps creates the dependencies given to the modules registering their routes on a router with the given chain.
+func NewDeps(ch *chain.Chain) module.Deps {
+	return module.Deps{
+		Chain: ch,
+		Validate: func(name string) gin.HandlerFunc {
+			return validation.JSONSchemaValidation(schema.MustGetSchema(name))
+		},
+		StatementTimeout: context.StatementTimeout,
+	}
+}
+
 // SetupRouter initializes the router and sets up the routes for the application.
 func SetupRouter() *gin.Engine {
 	// Create a new Gin router instance
@@ -27,113 +72,58 @@ func SetupRouter() *gin.Engine {
 
 	// Set up middleware for the router
 	// Middleware is used to handle cross-cutting concerns such as logging, security, and request ID generation
-	r.Use(context.PostgresDBContext(), context.RedisContext(), headers.RequestSecurityHeader(), headers.RequestCorsHeader(),
-		headers.RequestIDHeader(), logging.RequestLogger(), gzip.Gzip(gzip.DefaultCompression))
-
-	// Set up the authentication routes
-	// These routes handle user login and authentication
-	authGroup := r.Group("/auth")
-	{
-		// Apply rate limiting middleware to the /auth group (e.g., login, register endpoints).
-		// Configuration:
-		// - Allows a burst of 1 request (no burst, basically one request at a time).
-		// - After each request, only 1 new request is allowed every 30 seconds (refill rate).
-		// - Each client IP has its own limiter instance which expires after 5 minutes of inactivity.
-		authGroup.Use(ratelimiter.RateLimiter(rate.Every(30*time.Second), 1, 5*time.Minute))
-
-		// Routes for authentication
-		// These routes handle user login
-		service := auth.NewAuthService()
-		handler := auth.NewAuthHandler(service)
-
-		// Define the routes for authentication
-		// These routes handle user login
-		authGroup.POST("/login", handler.Login)
-		authGroup.POST("/refresh-token", handler.RefreshToken)
+	// The chain orders them by stage and lets the streaming groups opt out of the compression
+	ch := chain.New(
+		chain.Middleware{Name: "postgres-context", Stage: chain.StageContext, Handler: context.PostgresDBContext()},
+		chain.Middleware{Name: "redis-context", Stage: chain.StageContext, Handler: context.RedisContext()},
+		chain.Middleware{Name: "security-headers", Stage: chain.StageHeaders, Handler: headers.RequestSecurityHeader()},
+		chain.Middleware{Name: "cors-headers", Stage: chain.StageHeaders, Handler: headers.RequestCorsHeader()},
+		chain.Middleware{Name: "request-id", Stage: chain.StageHeaders, Handler: headers.RequestIDHeader()},
+		chain.Middleware{Name: "csrf", Stage: chain.StageHeaders, Handler: headers.CSRFProtection()},
+		chain.Middleware{Name: "request-logger", Stage: chain.StageLogging, Handler: logging.RequestLogger()},
+		chain.Middleware{Name: "latency-budget", Stage: chain.StageLogging, Handler: logging.LatencyBudget()},
+		chain.Middleware{Name: "gzip", Stage: chain.StageCompression, Feature: chain.Compression, Handler: gzip.Gzip(gzip.DefaultCompression)},
+	)
+	ch.Apply(r)
+	deps := NewDeps(ch)
+
+	// Set up the routes of the modules served at the root (health probes, authentication, schemas)
+	module.Register(&r.RouterGroup, deps, rootModules...)
+
+	// Serve the files of the local storage (e.g. the user avatars), the other storages serve their own files
+	if dir := storage.LocalDir(); dir != "" {
+		r.Static(storage.LocalPath, dir)
 	}
 
-	// Set up the API version 1 routes
-	v1 := r.Group("/api/v1", authorization.JwtValidation())
-	{
-		// Routes for department management
-		// These routes handle CRUD operations for departments
-		deptGroup := v1.Group("/departments")
-		{
-			// Apply rate limiting middleware to the /departments group.
-			// Configuration:
-			// - Allows up to 2 requests in quick succession (burst size = 2).
-			// - After that, only 1 new request is allowed every 5 seconds (refill rate).
-			// - Each client IP has its own limiter instance that expires after 10 minutes of inactivity.
-			deptGroup.Use(ratelimiter.RateLimiter(rate.Every(5*time.Second), 2, 10*time.Minute))
-
-			// Initialize the department repository and service
-			// This is where the actual implementation of the repository and service would be used
-			repo := department.NewDepartmentRepository()
-			service := department.NewDepartmentService(repo)
-
-			// Initialize the department handler with the service
-			// This handler handles the HTTP requests and responses for department-related operations
-			handler := department.NewDepartmentHandler(service)
-
-			// Define the routes for department management
-			// These routes handle CRUD operations for departments
-			deptGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetAllDepartments)
-			deptGroup.GET("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetDepartmentByID)
-			deptGroup.POST("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.CreateDepartment)
-			deptGroup.PUT("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.UpdateDepartment)
-			deptGroup.DELETE("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.DeleteDepartment)
-		}
-
-		// Routes for user management
-		// These routes handle CRUD operations for users
-		userGroup := v1.Group("/users")
+	// Set up the public read-only routes, served without authentication for the consumers
+	// that cannot hold credentials (e.g. the intranet directory page)
+	if department.PublicAPIEnabled == "TRUE" && module.Enabled(module.PublicAPI) {
+		publicGroup := r.Group("/public/v1")
 		{
-			// Rate limiter middleware for the /users group, accessible only by admin users.
+			// Rate limiter middleware for the /public group, with its own limits since it is anonymous.
 			// - Allows a burst of up to 10 requests at once.
 			// - Allows 1 request per second continuously after the burst.
-			// - Limits each admin IP to prevent spamming the user management endpoints.
-			// - Limiter TTL is 15 minutes to clean up inactive IP limiters.
-			userGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 15*time.Minute))
-
-			// Initialize the user repository and service
-			// This is where the actual implementation of the repository and service would be used
-			repo := user.NewUserRepository()
-			service := user.NewUserService(repo)
-
-			// Initialize the user handler with the service
-			// This handler handles the HTTP requests and responses for user-related operations
-			handler := user.NewUserHandler(service)
-
-			// Define the routes for user management
-			// These routes handle CRUD operations for users
-			userGroup.GET("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetAllUsers)
-			userGroup.GET("/:id", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.GetUserByID)
-			userGroup.POST("", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.CreateUser)
-		}
-
-		dataRedisGroup := v1.Group("/dataredis")
-		{
-			// Rate limiter middleware for the /dataredis group.
-			// - Allows a burst of up to 5 requests at once.
-			// - Allows 1 request every 3 seconds continuously after the burst.
-			// - Helps prevent abuse of Redis storage/read operations from a single IP.
 			// - Limiter TTL is 10 minutes to clean up inactive IP limiters.
-			dataRedisGroup.Use(ratelimiter.RateLimiter(rate.Every(3*time.Second), 5, 10*time.Minute))
-
-			// Initialize the data redis service
-			// This is where the actual implementation of the service would be used
-			service := dataredis.NewDataRedisService()
+			publicGroup.Use(ratelimiter.RateLimiter(rate.Every(1*time.Second), 10, 10*time.Minute))
 
-			// Initialize the data redis handler with the service
-			// This handler handles the HTTP requests and responses for data redis-related operations
-			handler := dataredis.NewDataRedisHandler(service)
+			// Bound the database statements of the anonymous reads
+			publicGroup.Use(context.StatementTimeout(dbtimeout.Read, dbtimeout.Read))
 
-			// Define the routes for data redis management
-			dataRedisGroup.GET("/string/:key", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetStringValue)
-			dataRedisGroup.GET("/json/:key", authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetJSONValue)
+			department.RegisterPublicRoutes(publicGroup, deps)
 		}
 	}
 
+	// Set up the API version 1 routes
+	// The automation identities authenticate with their API key, the other callers with their JWT
+	v1 := r.Group("/api/v1", authorization.Authentication())
+	setupAPIRoutes(v1, deps)
+
+	// Publish the OpenAPI spec generated from the routes, the request schemas and the typed errors
+	r.GET("/openapi.json", OpenAPIHandler(r))
+
+	// Describe the API at its root, the anonymous callers get the public view and the others the features of their roles
+	r.GET("/api", authorization.OptionalAuthentication(), APIRootHandler)
+
 	// NoRoute handler for undefined routes
 	// This handler will be called when no other route matches the request
 	r.NoRoute(func(c *gin.Context) {
@@ -148,3 +138,20 @@ func SetupRouter() *gin.Engine {
 
 	return r
 }
+
+// setupAPIRoutes registers the API version 1 routes of the modules on the given group.
+// The group carries the authentication middleware, so the same routes are served
+// to JWT-authenticated users and to mTLS-authenticated internal services.
+func setupAPIRoutes(v1 *gin.RouterGroup, deps module.Deps) {
+	// Bound the database statements of the API requests, short for the reads and longer for the writes
+	// The bulk operations override the timeout of their group with the import timeout
+	v1.Use(context.StatementTimeout(dbtimeout.Read, dbtimeout.Write))
+
+	// Refuse the mutating requests while the read-only maintenance mode is enabled
+	v1.Use(availability.ReadOnlyMode())
+
+	// Let the admins create entities beyond their quota with the X-Quota-Override header
+	v1.Use(authorization.QuotaOverride())
+
+	module.Register(v1, deps, apiModules...)
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+)
+
+// apiRootBody is the response of the API root.
+type apiRootBody struct {
+	Data  routes.APIRoot    `json:"data"`
+	Links map[string]string `json:"links"`
+}
+
+// getAPIRoot requests the API root with the given Authorization header, empty for an anonymous request.
+func getAPIRoot(t *testing.T, authorizationHeader string) *httptest.ResponseRecorder {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "root-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api", authorization.OptionalAuthentication(), routes.APIRootHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	if authorizationHeader != "" {
+		req.Header.Set("Authorization", authorizationHeader)
+	}
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func TestAPIRootAnonymous(t *testing.T) {
+	resp := getAPIRoot(t, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Vary"), "Authorization")
+
+	var body apiRootBody
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.False(t, body.Data.Authenticated)
+	require.NotEmpty(t, body.Data.Versions)
+	assert.Equal(t, "/api/v1", body.Data.Versions[0].Href)
+
+	// The anonymous callers only see the public features
+	assert.Contains(t, body.Data.Features, "read-only")
+	assert.Contains(t, body.Data.Features, "password-reset")
+	assert.NotContains(t, body.Data.Features, "avatars")
+	assert.NotContains(t, body.Data.Features, "webhooks")
+
+	for name, href := range map[string]string{"openapi": "/openapi.json", "jwks": "/.well-known/jwks.json", "liveness": "/livez", "readiness": "/readyz", "v1": "/api/v1"} {
+		assert.Equal(t, href, body.Links[name], name)
+	}
+
+	// Invalid credentials are refused instead of falling back to the anonymous view
+	assert.Equal(t, http.StatusUnauthorized, getAPIRoot(t, "Bearer not-a-token").Code)
+}
+
+func TestAPIRootAuthenticated(t *testing.T) {
+	now := time.Now().Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.NewJWTClaims(GetSampleUser(), now, now+3600)).SignedString([]byte("root-secret"))
+	require.NoError(t, err)
+
+	resp := getAPIRoot(t, "Bearer "+token)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var body apiRootBody
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.True(t, body.Data.Authenticated)
+	assert.Contains(t, body.Data.Features, "avatars")
+	assert.Contains(t, body.Data.Features, "webhooks")
+	assert.Equal(t, true, body.Data.Features["impersonation"])
+}
+
+func TestNewAPIRootFeaturesOfRoles(t *testing.T) {
+	root := routes.NewAPIRoot(&metacontext.RequestMeta{UserID: 2, Roles: []string{"ROLE_USER"}})
+	assert.True(t, root.Authenticated)
+	assert.Contains(t, root.Features, "dataredis")
+	assert.NotContains(t, root.Features, "webhooks")
+	assert.NotContains(t, root.Features, "impersonation")
+}
+
+func TestJWKS(t *testing.T) {
+	t.Cleanup(auth.LoadEnv)
+
+	// The HS256 secret is never published
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	set, err := auth.GetJWKS()
+	require.NoError(t, err)
+	assert.Empty(t, set.Keys)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	t.Setenv("JWT_PUBLIC_KEY_PATH", writePublicKey(t, key))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET(auth.JWKSPath, auth.JWKSHandler)
+
+	req := httptest.NewRequest(http.MethodGet, auth.JWKSPath, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// The set is served without the response envelope
+	var body auth.JWKSet
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	require.Len(t, body.Keys, 1)
+	jwk := body.Keys[0]
+	assert.Equal(t, "RSA", jwk.Kty)
+	assert.Equal(t, "RS256", jwk.Alg)
+	assert.Equal(t, "AQAB", jwk.E)
+	assert.Equal(t, auth.NewJWK(&key.PublicKey).Kid, jwk.Kid)
+	assert.Len(t, jwk.Kid, 43, "Expected the base64url SHA-256 thumbprint")
+}
+
+// writePublicKey writes the PEM of the public key of an RSA key to a temporary file and returns its path.
+func writePublicKey(t *testing.T, key *rsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	return path
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	t.Cleanup(auth.LoadEnv)
+
+	current, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	previous, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	unknown, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	t.Setenv("JWT_ALGORITHM", "RS256")
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_PUBLIC_KEY_PATH", writePublicKey(t, current))
+	t.Setenv("JWT_PREVIOUS_PUBLIC_KEY_PATHS", " "+writePublicKey(t, previous)+", ")
+
+	// The signing key is published first, then the previous key
+	set, err := auth.GetJWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, auth.NewJWK(&current.PublicKey), set.Keys[0])
+	assert.Equal(t, auth.NewJWK(&previous.PublicKey), set.Keys[1])
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	now := time.Now().Unix()
+	sign := func(key *rsa.PrivateKey, withKid bool) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"userid": 2, "username": "john", "iat": now, "exp": now + 900})
+		if withKid {
+			token.Header["kid"] = auth.NewJWK(&key.PublicKey).Kid
+		}
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	// The tokens of the previous key still validate, the tokens without kid are validated with the signing key
+	for name, tc := range map[string]struct {
+		token    string
+		expected int
+	}{
+		"current key":          {sign(current, true), http.StatusOK},
+		"previous key":         {sign(previous, true), http.StatusOK},
+		"without kid":          {sign(current, false), http.StatusOK},
+		"previous without kid": {sign(previous, false), http.StatusUnauthorized},
+		"unknown key":          {sign(unknown, true), http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, tc.expected, resp.Code, name)
+	}
+
+	// The auth service validates the tokens the same way, e.g. on logout
+	_, err = auth.ParseJWTTokenWithKey(sign(previous, true))
+	assert.NoError(t, err)
+	_, err = auth.ParseJWTTokenWithKey(sign(unknown, true))
+	assert.Error(t, err)
+}
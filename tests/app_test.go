@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/config/db/redisdb"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/app"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/server"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestAppEmbeddedHandler(t *testing.T) {
+	// Run the minimal deployment without Redis, the modules are reloaded from the environment afterwards
+	t.Cleanup(module.LoadEnv)
+	t.Cleanup(cache.LoadEnv)
+	t.Cleanup(loginthrottle.LoadEnv)
+	t.Setenv("MODULES_DISABLED", "dataredis,admin,password-reset")
+	t.Setenv("CACHE_ENABLED", "FALSE")
+	t.Setenv("LOGIN_THROTTLE_MAX_FAILURES", "0")
+
+	// The embedding program gives its own database, it is not connected to until it is used
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 dbname=test sslmode=disable"), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	srv, err := app.New(app.Config{Port: "0", DB: db})
+	require.NoError(t, err)
+
+	// The API is mounted under a prefix of the mux of the embedding program
+	mux := http.NewServeMux()
+	mux.Handle("/departments-api/", http.StripPrefix("/departments-api", srv.Handler()))
+
+	req, _ := http.NewRequest("GET", "/departments-api/livez", nil)
+	resp := httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// The API routes still require an access token
+	req, _ = http.NewRequest("GET", "/departments-api/api/v1/departments", nil)
+	resp = httptest.NewRecorder()
+	mux.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAppRejectsInvalidConfig(t *testing.T) {
+	t.Cleanup(module.LoadEnv)
+	t.Setenv("MODULES_DISABLED", "unknown")
+
+	_, err := app.New(app.Config{})
+	assert.Error(t, err)
+}
+
+func TestAppRequiresRedis(t *testing.T) {
+	t.Cleanup(module.LoadEnv)
+	t.Cleanup(cache.LoadEnv)
+	t.Cleanup(loginthrottle.LoadEnv)
+	t.Cleanup(tokenversion.LoadEnv)
+	client := redisdb.RedisClient
+	t.Cleanup(func() { redisdb.RedisClient = client })
+
+	// Redis is unreachable, the application does not start when an enabled feature uses it
+	t.Setenv("REDIS_HOST", "127.0.0.1")
+	t.Setenv("REDIS_PORT", "1")
+	t.Setenv("MODULES_DISABLED", "dataredis,admin,password-reset")
+	t.Setenv("CACHE_ENABLED", "FALSE")
+
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 dbname=test sslmode=disable"), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		maxFailures string
+		minVersion  string
+		required    bool
+	}{
+		{"minimal deployment", "0", "0", false},
+		{"login throttle", "5", "0", true},
+		{"minimum token version", "0", "3", true},
+	} {
+		t.Setenv("LOGIN_THROTTLE_MAX_FAILURES", tc.maxFailures)
+		t.Setenv("TOKEN_VERSION", tc.minVersion)
+
+		_, err := app.New(app.Config{Port: "0", DB: db})
+		if tc.required {
+			assert.ErrorContains(t, err, "failed to initialize token version", tc.name)
+		} else {
+			assert.NoError(t, err, tc.name)
+		}
+	}
+}
+
+func TestAppListen(t *testing.T) {
+	t.Cleanup(server.LoadEnv)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.txt"), nil, 0600))
+
+	for _, tc := range []struct {
+		name    string
+		network string
+		path    string
+		mode    string
+		addr    string
+		perm    os.FileMode
+		err     bool
+	}{
+		{"tcp by default", "", "", "", "tcp", 0, false},
+		{"unix socket", "unix", filepath.Join(dir, "api.sock"), "", "unix", 0660, false},
+		{"stale unix socket replaced", "UNIX", filepath.Join(dir, "api.sock"), "0600", "unix", 0600, false},
+		{"unix path not a socket", "UNIX", filepath.Join(dir, "config.txt"), "", "", 0, true},
+		{"unix path missing", "UNIX", "", "", "", 0, true},
+		{"invalid unix mode", "UNIX", filepath.Join(dir, "other.sock"), "rw", "", 0, true},
+		{"systemd without sockets", "SYSTEMD", "", "", "", 0, true},
+		{"unknown network", "udp", "", "", "", 0, true},
+	} {
+		t.Setenv("LISTEN_NETWORK", tc.network)
+		t.Setenv("UNIX_SOCKET_PATH", tc.path)
+		t.Setenv("UNIX_SOCKET_MODE", tc.mode)
+		t.Setenv("LISTEN_PID", "")
+		server.LoadEnv()
+
+		l, err := server.Listen("0")
+		if tc.err {
+			assert.Error(t, err, tc.name)
+			continue
+		}
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.addr, l.Addr().Network(), tc.name)
+
+		// The API is served on the listener, the socket file only lets the allowed local users connect
+		if tc.addr == "unix" {
+			info, err := os.Stat(tc.path)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.perm, info.Mode().Perm(), tc.name)
+
+			// The socket file is left when the listener is closed, as after a crash, and the next case replaces it
+			l.(*net.UnixListener).SetUnlinkOnClose(false)
+
+			srv := server.NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+			go srv.Serve(l)
+			client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", tc.path)
+			}}}
+			resp, err := client.Get("http://unix/livez")
+			require.NoError(t, err, tc.name)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode, tc.name)
+			srv.Close()
+			client.CloseIdleConnections()
+			continue
+		}
+		l.Close()
+	}
+}
+
+func TestAppServerTimeouts(t *testing.T) {
+	t.Cleanup(server.LoadEnv)
+
+	for _, tc := range []struct {
+		name           string
+		env            map[string]string
+		readHeader     time.Duration
+		write          time.Duration
+		maxHeaderBytes int
+	}{
+		{"defaults", nil, 10 * time.Second, 60 * time.Second, 1 << 20},
+		{"configured", map[string]string{"SERVER_READ_HEADER_TIMEOUT_SECONDS": "2", "SERVER_WRITE_TIMEOUT_SECONDS": "5", "SERVER_MAX_HEADER_BYTES": "4096"}, 2 * time.Second, 5 * time.Second, 4096},
+		{"invalid values", map[string]string{"SERVER_READ_HEADER_TIMEOUT_SECONDS": "0", "SERVER_WRITE_TIMEOUT_SECONDS": "soon", "SERVER_MAX_HEADER_BYTES": "-1"}, 10 * time.Second, 60 * time.Second, 1 << 20},
+	} {
+		for _, key := range []string{"SERVER_READ_HEADER_TIMEOUT_SECONDS", "SERVER_WRITE_TIMEOUT_SECONDS", "SERVER_MAX_HEADER_BYTES"} {
+			t.Setenv(key, tc.env[key])
+		}
+		server.LoadEnv()
+
+		srv := server.NewHTTPServer(http.NotFoundHandler())
+		assert.Equal(t, tc.readHeader, srv.ReadHeaderTimeout, tc.name)
+		assert.Equal(t, tc.write, srv.WriteTimeout, tc.name)
+		assert.Equal(t, 30*time.Second, srv.ReadTimeout, tc.name)
+		assert.Equal(t, 120*time.Second, srv.IdleTimeout, tc.name)
+		assert.Equal(t, tc.maxHeaderBytes, srv.MaxHeaderBytes, tc.name)
+	}
+
+	// A client sending its headers too slowly is disconnected
+	t.Setenv("SERVER_READ_HEADER_TIMEOUT_SECONDS", "1")
+	server.LoadEnv()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := server.NewHTTPServer(http.NotFoundHandler())
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /livez HTTP/1.1\r\nHost: localhost\r\n"))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1024))
+	for err == nil {
+		_, err = conn.Read(make([]byte, 1024))
+	}
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/audit"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"gorm.io/gorm"
+)
+
+// auditRecord builds the outbox message of a department event at the given time.
+func auditRecord(t *testing.T, eventType string, data any, at time.Time) outbox.OutboxMessage {
+	e := event.NewEvent(eventType, "", data)
+	e.OccurredAt = at
+	m, err := outbox.NewOutboxMessage(e)
+	require.NoError(t, err)
+	return m
+}
+
+func TestParseAuditReplayConfig(t *testing.T) {
+	cfg, err := audit.ParseConfig([]string{"--entity", "department", "--from", "2024-01-01"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), cfg.From)
+	assert.Nil(t, cfg.To)
+	assert.Equal(t, "department_replay", cfg.Table)
+
+	cfg, err = audit.ParseConfig([]string{"--entity", "department", "--from", "2024-01-01", "--to", "2024-03-01T10:00:00Z", "--table", "recovery.department_replay"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), *cfg.To)
+	assert.Equal(t, "recovery.department_replay", cfg.Table)
+
+	for _, args := range [][]string{
+		{"--from", "2024-01-01"},
+		{"--entity", "invoice", "--from", "2024-01-01"},
+		{"--entity", "department"},
+		{"--entity", "department", "--from", "yesterday"},
+		{"--entity", "department", "--from", "2024-03-01", "--to", "2024-01-01"},
+		// The staging table is dropped by the replay, so the live tables are refused
+		{"--entity", "department", "--from", "2024-01-01", "--table", "department"},
+		{"--entity", "department", "--from", "2024-01-01", "--table", "x_replay; DROP TABLE users"},
+	} {
+		_, err := audit.ParseConfig(args)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestAuditRunRequiresReplay(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, 2, audit.Run(nil, []string{"rebuild"}, &out))
+	assert.Equal(t, 2, audit.Run(nil, []string{"replay", "--entity", "department", "--from", "2024-01-01"}, &out))
+	assert.Contains(t, out.String(), "database connection is not initialized")
+}
+
+func TestReplayDepartments(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	sales := department.Department{ID: "d001", DeptName: "Sales", Active: true, Status: department.StatusActive, Tags: department.Tags{}}
+	renamed := sales
+	renamed.DeptName = "Sales EMEA"
+	legal := department.Department{ID: "d002", DeptName: "Legal", Active: true, Status: department.StatusActive}
+
+	messages := []outbox.OutboxMessage{
+		auditRecord(t, event.DepartmentCreated, sales, start),
+		auditRecord(t, event.DepartmentCreated, legal, start.Add(time.Minute)),
+		// The drift carries the department before the manual change, it is not its new state
+		auditRecord(t, event.DepartmentDrifted, sales, start.Add(2*time.Hour)),
+		auditRecord(t, event.DepartmentUpdated, renamed, start.Add(2*time.Hour)),
+		auditRecord(t, event.DepartmentAccessDenied, department.ScopeViolation{}, start.Add(3*time.Hour)),
+		auditRecord(t, event.DepartmentDeleted, legal, start.Add(4*time.Hour)),
+		{EventID: "broken", EventType: event.DepartmentUpdated, Payload: `"not a department"`, OccurredAt: start.Add(5 * time.Hour)},
+	}
+
+	replayed, undecodable := audit.ReplayDepartments(messages)
+	require.Len(t, replayed, 2)
+	assert.Equal(t, "Sales EMEA", replayed[0].DeptName)
+	assert.Equal(t, event.DepartmentUpdated, replayed[0].LastEventType)
+	assert.Nil(t, replayed[0].DeletedAt)
+
+	// The deletion time is the time of the record
+	assert.Equal(t, "d002", replayed[1].ID)
+	require.NotNil(t, replayed[1].DeletedAt)
+	assert.Equal(t, start.Add(4*time.Hour), replayed[1].DeletedAt.Time)
+
+	require.Len(t, undecodable, 1)
+	assert.Equal(t, "broken", undecodable[0].ID)
+}
+
+func TestAuditReplayReport(t *testing.T) {
+	at := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	deletedAt := &gorm.DeletedAt{Time: at, Valid: true}
+	replay := func(d department.Department) audit.ReplayedDepartment {
+		return audit.ReplayedDepartment{Department: d, LastEventType: event.DepartmentUpdated, LastEventAt: at}
+	}
+
+	replayed := []audit.ReplayedDepartment{
+		replay(department.Department{ID: "d001", DeptName: "Sales", Active: true}),
+		replay(department.Department{ID: "d002", DeptName: "Legal", Active: true}),
+		replay(department.Department{ID: "d003", DeptName: "Finance", Active: true}),
+		replay(department.Department{ID: "d004", DeptName: "Support", Active: true, Tags: department.Tags{"remote-first"}}),
+		replay(department.Department{ID: "d005", DeptName: "Closed", DeletedAt: deletedAt}),
+	}
+	live := []department.Department{
+		{ID: "d001", DeptName: "Sales", Active: true},
+		{ID: "d002", DeptName: "Legal", Active: true, DeletedAt: deletedAt},
+		{ID: "d004", DeptName: "Support", Active: false, Tags: department.Tags{}},
+	}
+
+	report := audit.Report{Entity: "department", Table: "department_replay", From: at, Read: 5}
+	report.Compare(replayed, live)
+
+	assert.False(t, report.OK())
+	assert.Equal(t, 5, report.Replayed)
+	assert.Equal(t, 1, report.Deleted)
+	assert.Equal(t, 2, report.Unchanged, "Expected the matching and the deleted departments to be unchanged")
+	require.Len(t, report.Missing, 2)
+	assert.Equal(t, "d002", report.Missing[0].ID)
+	assert.Equal(t, "d003", report.Missing[1].ID)
+	require.Len(t, report.Different, 1)
+	assert.Contains(t, report.Different[0].Reason, "different active, tags")
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), "Replayed into department_replay: 5 (1 deleted)")
+	assert.Contains(t, out.String(), `Missing "d003": not in the live table`)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/authmetrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// metricValue returns the value of the series of the metrics, e.g. `auth_revocations_total{scope="user"}`, 0 when it is not exposed.
+func metricValue(t *testing.T, series string) float64 {
+	scrape := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(scrape.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			require.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
+
+func TestAuthMetricsEnv(t *testing.T) {
+	t.Setenv("AUTH_METRICS_INTERVAL_MINUTES", "")
+	authmetrics.LoadEnv()
+	assert.Equal(t, 15*time.Minute, authmetrics.SummaryInterval)
+
+	t.Setenv("AUTH_METRICS_INTERVAL_MINUTES", "5")
+	authmetrics.LoadEnv()
+	assert.Equal(t, 5*time.Minute, authmetrics.SummaryInterval)
+
+	// 0 disables the summaries
+	t.Setenv("AUTH_METRICS_INTERVAL_MINUTES", "0")
+	authmetrics.LoadEnv()
+	assert.Equal(t, time.Duration(0), authmetrics.SummaryInterval)
+}
+
+func TestAuthMetricsSummary(t *testing.T) {
+	authmetrics.Init()
+	authmetrics.TakeSummary()
+
+	const succeeded = `auth_logins_total{method="oidc",reason="",result="success"}`
+	const throttled = `auth_logins_total{method="password",reason="LoginThrottled",result="failure"}`
+	before := map[string]float64{succeeded: metricValue(t, succeeded), throttled: metricValue(t, throttled)}
+
+	authmetrics.ObserveLogin("oidc", "")
+	authmetrics.ObserveLogin("password", "LoginThrottled")
+	authmetrics.ObserveLogin("password", "LoginThrottled")
+	authmetrics.ObserveLogin("password", "InvalidPassword")
+	authmetrics.ObserveRefresh("")
+	authmetrics.ObserveRefresh("RefreshTokenExpired")
+	authmetrics.ObserveRevocation(authmetrics.RevokedSession)
+	authmetrics.SetActiveSessions(42)
+
+	summary := authmetrics.TakeSummary()
+	assert.Equal(t, int64(4), summary.Logins)
+	assert.Equal(t, int64(3), summary.FailedLogins)
+	assert.Equal(t, map[string]int64{"LoginThrottled": 2, "InvalidPassword": 1}, summary.FailureReasons)
+	assert.Equal(t, int64(2), summary.Refreshes)
+	assert.Equal(t, int64(1), summary.FailedRefreshes)
+	assert.Equal(t, int64(1), summary.Revocations)
+
+	// A new summary starts, the counters of the metrics keep going
+	assert.Equal(t, authmetrics.Summary{}, authmetrics.TakeSummary())
+	assert.Equal(t, before[succeeded]+1, metricValue(t, succeeded))
+	assert.Equal(t, before[throttled]+2, metricValue(t, throttled))
+	assert.Equal(t, float64(42), metricValue(t, "auth_active_sessions"))
+}
+
+func TestAuthFailureMetrics(t *testing.T) {
+	validator.InitValidator()
+	authmetrics.Init()
+	db, _ := openRecordingDB(t)
+	service := auth.NewAuthService()
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	const login = `auth_logins_total{method="password",reason="InvalidRequest",result="failure"}`
+	const refresh = `auth_token_refreshes_total{reason="InvalidRequest",result="failure"}`
+	const unknown = `auth_token_refreshes_total{reason="Error",result="failure"}`
+	before := map[string]float64{login: metricValue(t, login), refresh: metricValue(t, refresh), unknown: metricValue(t, unknown)}
+
+	// The refused requests are counted by reason
+	_, err := service.Login(ctx, auth.LoginRequest{UserName: "jane"})
+	require.Error(t, err)
+	_, err = service.RefreshToken(ctx, refreshtoken.RefreshTokenRequest{})
+	require.Error(t, err)
+
+	// The fake database finds no refresh token and fails the query
+	_, err = service.RefreshToken(ctx, refreshtoken.RefreshTokenRequest{RefreshToken: "unknown-refresh-token"})
+	require.Error(t, err)
+
+	assert.Equal(t, before[login]+1, metricValue(t, login))
+	assert.Equal(t, before[refresh]+1, metricValue(t, refresh))
+	assert.Equal(t, before[unknown]+1, metricValue(t, unknown))
+}
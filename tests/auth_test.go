@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// mockAuthService is a mock implementation of the AuthService interface for testing purposes.
+// The only valid password reset token is "valid-token", and the CAPTCHA answer "robot" is always refused.
+type mockAuthService struct{}
+
+// Login refuses the password "wrong-password" and throttles the username "locked".
+func (m *mockAuthService) Login(ctx context.Context, loginReq auth.LoginRequest) (auth.LoginResponse, error) {
+	if err := loginReq.Validate(); err != nil {
+		return auth.LoginResponse{}, err
+	}
+	if loginReq.CaptchaToken == "robot" {
+		return auth.LoginResponse{}, captcha.ErrInvalidCaptcha
+	}
+	if loginReq.UserName == "locked" {
+		return auth.LoginResponse{}, &loginthrottle.ThrottledError{RetryAfter: 1500 * time.Millisecond}
+	}
+	if loginReq.Password == "wrong-password" {
+		return auth.LoginResponse{}, user.ErrUserNotFound
+	}
+	return auth.LoginResponse{
+		AccessToken:      "access-token",
+		RefreshToken:     "refresh-token",
+		ExpirationDate:   time.Now().Add(time.Hour).Format(time.RFC3339),
+		TokenType:        "Bearer",
+		RefreshExpiresAt: time.Now().Add(24 * time.Hour),
+	}, nil
+}
+
+// RefreshToken only knows the refresh token "refresh-token", rotated to "rotated-refresh-token".
+func (m *mockAuthService) RefreshToken(ctx context.Context, req refreshtoken.RefreshTokenRequest) (refreshtoken.RefreshTokenResponse, error) {
+	if err := req.Validate(); err != nil {
+		return refreshtoken.RefreshTokenResponse{}, err
+	}
+	if req.RefreshToken != "refresh-token" {
+		return refreshtoken.RefreshTokenResponse{}, errors.New("refresh token not found")
+	}
+	return refreshtoken.RefreshTokenResponse{
+		AccessToken:      "refreshed-access-token",
+		RefreshToken:     "rotated-refresh-token",
+		ExpirationDate:   time.Now().Add(time.Hour).Format(time.RFC3339),
+		TokenType:        "Bearer",
+		RefreshExpiresAt: time.Now().Add(24 * time.Hour),
+	}, nil
+}
+
+func (m *mockAuthService) ForgotPassword(ctx context.Context, req auth.ForgotPasswordRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if req.CaptchaToken == "robot" {
+		return captcha.ErrInvalidCaptcha
+	}
+	return nil
+}
+
+func (m *mockAuthService) ResetPassword(ctx context.Context, req auth.ResetPasswordRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if req.Token != "valid-token" {
+		return auth.ErrInvalidResetToken
+	}
+	return nil
+}
+
+// Register refuses the taken username "taken" and the CAPTCHA answer "robot".
+func (m *mockAuthService) Register(ctx context.Context, req auth.RegistrationRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if req.CaptchaToken == "robot" {
+		return captcha.ErrInvalidCaptcha
+	}
+	if req.UserName == "taken" {
+		return user.ErrUserNameTaken
+	}
+	return nil
+}
+
+func (m *mockAuthService) VerifyRegistration(ctx context.Context, req auth.VerifyRegistrationRequest) (user.User, error) {
+	if err := req.Validate(); err != nil {
+		return user.User{}, err
+	}
+	if req.Token != "valid-token" {
+		return user.User{}, auth.ErrInvalidRegistrationToken
+	}
+	return GetSampleUser(), nil
+}
+
+// IssueClientToken only knows the client "client-1" with the secret "secret" and the scope ROLE_USER.
+func (m *mockAuthService) IssueClientToken(ctx context.Context, req auth.ClientCredentialsRequest) (auth.ClientTokenResponse, error) {
+	if req.GrantType != auth.ClientCredentialsGrant {
+		return auth.ClientTokenResponse{}, auth.ErrUnsupportedGrantType
+	}
+	if req.ClientID != "client-1" || req.ClientSecret != "secret" {
+		return auth.ClientTokenResponse{}, oauthclient.ErrInvalidClient
+	}
+	if req.Scope != "" && req.Scope != "ROLE_USER" {
+		return auth.ClientTokenResponse{}, auth.ErrInvalidScope
+	}
+	return auth.ClientTokenResponse{AccessToken: "client-token", TokenType: "Bearer", ExpiresIn: 3600, Scope: "ROLE_USER"}, nil
+}
+
+// OIDCAuthorizationURL only knows the provider "google".
+func (m *mockAuthService) OIDCAuthorizationURL(ctx context.Context, provider string) (string, error) {
+	if provider != "google" {
+		return "", auth.ErrOIDCProviderNotFound
+	}
+	return "https://accounts.example.com/authorize?state=valid-state", nil
+}
+
+// OIDCCallback only accepts the state "valid-state" and refuses the code "unlinked".
+func (m *mockAuthService) OIDCCallback(ctx context.Context, req auth.OIDCCallbackRequest) (auth.LoginResponse, error) {
+	if req.State != "valid-state" {
+		return auth.LoginResponse{}, auth.ErrInvalidOIDCState
+	}
+	if req.Code == "unlinked" {
+		return auth.LoginResponse{}, user.ErrIdentityNotLinked
+	}
+	return auth.LoginResponse{AccessToken: "oidc-token", RefreshToken: "oidc-refresh-token", TokenType: "Bearer"}, nil
+}
+
+// Reauthenticate refuses the password "wrong-password".
+func (m *mockAuthService) Reauthenticate(ctx context.Context, req auth.ReauthRequest) (auth.LoginResponse, error) {
+	if err := req.Validate(); err != nil {
+		return auth.LoginResponse{}, err
+	}
+	if req.Password == "wrong-password" {
+		return auth.LoginResponse{}, auth.ErrReauthFailed
+	}
+	return auth.LoginResponse{
+		AccessToken:    "reauth-token",
+		ExpirationDate: time.Now().Add(time.Hour).Format(time.RFC3339),
+		TokenType:      "Bearer",
+	}, nil
+}
+
+// Impersonate refuses the user 1 as the admin of the tests and does not know the user 404.
+func (m *mockAuthService) Impersonate(ctx context.Context, userID int64) (auth.ImpersonationResponse, error) {
+	switch userID {
+	case 1:
+		return auth.ImpersonationResponse{}, auth.ErrImpersonateSelf
+	case 404:
+		return auth.ImpersonationResponse{}, user.ErrUserNotFound
+	}
+	return auth.ImpersonationResponse{AccessToken: "impersonation-token", TokenType: "Bearer", ImpersonatedBy: 1}, nil
+}
+
+// SetupAuthRouter initializes the Gin router with the auth routes backed by the mock service.
+func SetupAuthRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	validator.InitValidator()
+	handler := auth.NewAuthHandler(&mockAuthService{})
+
+	r := gin.New()
+	authGroup := r.Group("/auth")
+	{
+		authGroup.POST("/login", handler.Login)
+		authGroup.POST("/refresh-token", handler.RefreshToken)
+		authGroup.POST("/forgot-password", handler.ForgotPassword)
+		authGroup.POST("/reset-password", handler.ResetPassword)
+		authGroup.POST("/register", handler.Register)
+		authGroup.POST("/register/verify", handler.VerifyRegistration)
+	}
+
+	return r
+}
+
+func TestPasswordReset(t *testing.T) {
+	r := SetupAuthRouter()
+
+	cases := []struct {
+		path     string
+		body     string
+		expected int
+	}{
+		{"/auth/forgot-password", `{"email":"admin@example.com"}`, http.StatusAccepted},
+		{"/auth/forgot-password", `{"email":"not-an-email"}`, http.StatusBadRequest},
+		{"/auth/reset-password", `{"token":"valid-token","newPassword":"N3wP@ssw0rd"}`, http.StatusOK},
+		{"/auth/reset-password", `{"token":"used-token","newPassword":"N3wP@ssw0rd"}`, http.StatusBadRequest},
+		{"/auth/reset-password", `{"token":"valid-token","newPassword":"short"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, "Unexpected status code for "+tc.path+" "+tc.body)
+	}
+
+	// An invalid token is reported with its typed error code
+	req, _ := http.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewBufferString(`{"token":"used-token","newPassword":"N3wP@ssw0rd"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), `"code":"InvalidResetToken"`)
+}
+
+// fakeMailer records the sent messages.
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, m mailer.Message) error {
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func TestMailerIsPluggable(t *testing.T) {
+	fake := &fakeMailer{}
+	mailer.SetMailer(fake)
+	defer mailer.InitMailer()
+
+	err := mailer.Send(context.Background(), mailer.Message{To: "admin@example.com", Subject: "Reset your password", Body: "token"})
+	assert.NoError(t, err)
+	assert.Len(t, fake.sent, 1)
+	assert.Equal(t, "admin@example.com", fake.sent[0].To)
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/storage"
+)
+
+// avatarRequest builds an avatar upload of the caller with the content in the given form field.
+func avatarRequest(t *testing.T, field string, content []byte) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile(field, "avatar.png")
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/me/avatar", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+}
+
+// samplePNG returns a small PNG image.
+func samplePNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+	return buf.Bytes()
+}
+
+func TestUpdateMyAvatar(t *testing.T) {
+	r := SetupUserRouter()
+
+	// The type is detected from the content, whatever the file name
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, avatarRequest(t, "avatar", samplePNG(t)))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"avatarUrl":"/files/avatars/3/avatar.png"`)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, avatarRequest(t, "avatar", []byte("not an image")))
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	assert.Contains(t, resp.Body.String(), "AvatarUnsupportedType")
+
+	// The images beyond the maximum size (2 MB by default) are refused before reaching the service
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, avatarRequest(t, "avatar", append(samplePNG(t), make([]byte, 3<<20)...)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, avatarRequest(t, "picture", samplePNG(t)))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// The avatar is only uploaded by an authenticated user
+	req := avatarRequest(t, "avatar", samplePNG(t))
+	req = req.WithContext(context.Background())
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.NewLocalStorage(dir, "")
+	require.NoError(t, err)
+	storage.SetStorage(s)
+	t.Cleanup(func() { storage.SetStorage(nil) })
+
+	url, err := storage.Put(context.Background(), "avatars/3/a.png", "image/png", []byte("data"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.LocalPath+"/avatars/3/a.png", url)
+	assert.Equal(t, dir, storage.LocalDir())
+
+	data, err := os.ReadFile(filepath.Join(dir, "avatars", "3", "a.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	key, ok := storage.KeyOf(url)
+	assert.True(t, ok)
+	assert.Equal(t, "avatars/3/a.png", key)
+	_, ok = storage.KeyOf("https://example.com/avatars/3/a.png")
+	assert.False(t, ok)
+
+	// Deleting twice is not an error, the keys cannot escape the directory
+	assert.NoError(t, storage.Delete(context.Background(), key))
+	assert.NoError(t, storage.Delete(context.Background(), key))
+	_, err = s.Put(context.Background(), "../outside.png", "image/png", []byte("data"))
+	assert.Error(t, err)
+}
+
+func TestS3StorageSignsRequests(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s, err := storage.NewS3Storage(srv.URL, "eu-west-1", "bucket", "AKIDEXAMPLE", "secret", "https://cdn.example.com/")
+	require.NoError(t, err)
+
+	url, err := s.Put(context.Background(), "avatars/3/a.png", "image/png", []byte("data"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/avatars/3/a.png", url)
+
+	// The object is addressed with a path-style URL and the request is signed with Signature Version 4
+	require.NotNil(t, received)
+	assert.Equal(t, http.MethodPut, received.Method)
+	assert.Equal(t, "/bucket/avatars/3/a.png", received.URL.Path)
+	assert.Equal(t, "data", string(body))
+	assert.Equal(t, "image/png", received.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(received.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"))
+	assert.Contains(t, received.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=")
+	assert.NotEmpty(t, received.Header.Get("X-Amz-Date"))
+}
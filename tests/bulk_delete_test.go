@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"gorm.io/gorm"
+)
+
+// bulkDeleteRepository is a department repository holding departments in memory.
+// The methods the bulk delete does not use are left unimplemented.
+type bulkDeleteRepository struct {
+	dept.DepartmentRepository
+	departments map[string]dept.Department
+	members     map[string]int64
+}
+
+func (r *bulkDeleteRepository) matching(filter dept.BulkDeleteFilter) []dept.Department {
+	var matched []dept.Department
+	for _, d := range r.departments {
+		if filter.Active != nil && d.Active != *filter.Active {
+			continue
+		}
+		if filter.CreatedBefore != nil && !d.CreatedAt.Before(*filter.CreatedBefore) {
+			continue
+		}
+		if (filter.Archived == dept.ArchivedOnly) != d.IsArchived() && filter.Archived != dept.ArchivedInclude {
+			continue
+		}
+		matched = append(matched, d)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+	return matched
+}
+
+func (r *bulkDeleteRepository) CountBulkDelete(tx *gorm.DB, filter dept.BulkDeleteFilter) (int64, error) {
+	return int64(len(r.matching(filter))), nil
+}
+
+func (r *bulkDeleteRepository) GetBulkDeleteIDs(tx *gorm.DB, filter dept.BulkDeleteFilter, limit int) ([]string, error) {
+	ids := []string{}
+	for _, d := range r.matching(filter) {
+		if len(ids) < limit {
+			ids = append(ids, d.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *bulkDeleteRepository) GetBulkDeleteBatchForUpdate(tx *gorm.DB, filter dept.BulkDeleteFilter, afterID string, limit int) ([]dept.Department, error) {
+	var batch []dept.Department
+	for _, d := range r.matching(filter) {
+		if d.ID > afterID && len(batch) < limit {
+			batch = append(batch, d)
+		}
+	}
+	return batch, nil
+}
+
+func (r *bulkDeleteRepository) DeleteDepartment(ctx context.Context, tx *gorm.DB, d dept.Department, deletedBy *int64) error {
+	delete(r.departments, d.ID)
+	return nil
+}
+
+func (r *bulkDeleteRepository) CountEmployees(tx *gorm.DB, id string) (int64, error) {
+	return r.members[id], nil
+}
+
+// waitJob polls the job until it is finished.
+func waitJob(t *testing.T, queue *jobs.Queue, id string) jobs.Job {
+	var job jobs.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = queue.Get(context.Background(), id)
+		return err == nil && job.Done()
+	}, 2*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestBulkDeleteDepartmentsHandler(t *testing.T) {
+	r := SetupRouter()
+	serve := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("DELETE", "/api/v1/departments?"+query, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The filter must narrow the selection, and only the known fields are accepted
+	for _, query := range []string{
+		"",
+		"filter=archived:include",
+		"filter=active:maybe",
+		"filter=name:HR",
+		"filter=active",
+		"filter=active:false&createdBefore=yesterday",
+		"filter=tag:Not%20A%20Slug",
+		"filter=active:false&dryRun=perhaps",
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(query).Code, query)
+	}
+
+	// The dry run returns the matching departments and the confirm token
+	resp := serve("filter=active:false,tag:legacy&createdBefore=2020-01-01&dryRun=true")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+	var preview struct {
+		Data dept.BulkDeletePreview `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &preview))
+	assert.Equal(t, "active:false,tag:legacy,archived:exclude,createdBefore:2020-01-01T00:00:00Z", preview.Data.Filter)
+	assert.Equal(t, "confirm-token", preview.Data.ConfirmToken)
+
+	// The delete requires the token and queues a job, polled at its location
+	resp = serve("filter=active:false&confirm=wrong-token")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"InvalidConfirmToken"`)
+
+	resp = serve("filter=active:false&confirm=confirm-token")
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.Equal(t, "/api/v1/jobs/job-1", resp.Header().Get("Location"))
+}
+
+func TestBulkDelete(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	old := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	managedBy := "hr-sync"
+	repo := &bulkDeleteRepository{departments: map[string]dept.Department{}, members: map[string]int64{}}
+	for i, id := range []string{"d001", "d002", "d003", "d004"} {
+		repo.departments[id] = dept.Department{ID: id, DeptName: "Dept " + id, Active: i%2 == 0, CreatedAt: &old, Status: dept.StatusActive}
+	}
+	repo.departments["d005"] = dept.Department{ID: "d005", DeptName: "Recent", CreatedAt: &recent, Status: dept.StatusActive}
+	repo.departments["d006"] = dept.Department{ID: "d006", DeptName: "Managed", CreatedAt: &old, Status: dept.StatusActive, ManagedBy: &managedBy}
+
+	queue := jobs.NewQueue(jobs.NewMemoryStore(time.Hour), 1, 5)
+	t.Cleanup(func() { queue.Close(context.Background()) })
+	bus := &recordingBus{}
+	service := dept.NewDepartmentService(repo, dept.WithEventBus(bus), dept.WithJobQueue(queue))
+
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+	adminCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+	otherCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 2, UserName: "other", Roles: []string{"ROLE_ADMIN"}})
+
+	inactive := false
+	cutoff := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := dept.BulkDeleteFilter{Active: &inactive, Archived: dept.ArchivedExclude, CreatedBefore: &cutoff}
+
+	// A filter selecting every department is refused
+	_, err := service.PreviewBulkDelete(adminCtx, dept.BulkDeleteFilter{Archived: dept.ArchivedInclude})
+	assert.ErrorIs(t, err, dept.ErrBulkDeleteUnfiltered)
+
+	// The dry run changes nothing
+	preview, err := service.PreviewBulkDelete(adminCtx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), preview.Matched)
+	assert.Equal(t, []string{"d002", "d004", "d006"}, preview.Sample)
+	assert.Len(t, repo.departments, 6)
+
+	// The token only confirms the same filter for the same admin, and is consumed by the attempt
+	_, err = service.BulkDelete(adminCtx, filter, "")
+	assert.ErrorIs(t, err, dept.ErrInvalidConfirmToken)
+	_, err = service.BulkDelete(otherCtx, filter, preview.ConfirmToken)
+	assert.ErrorIs(t, err, dept.ErrInvalidConfirmToken)
+	_, err = service.BulkDelete(adminCtx, filter, preview.ConfirmToken)
+	assert.ErrorIs(t, err, dept.ErrInvalidConfirmToken)
+
+	preview, err = service.PreviewBulkDelete(adminCtx, filter)
+	require.NoError(t, err)
+	active := true
+	_, err = service.BulkDelete(adminCtx, dept.BulkDeleteFilter{Active: &active, Archived: dept.ArchivedExclude, CreatedBefore: &cutoff}, preview.ConfirmToken)
+	assert.ErrorIs(t, err, dept.ErrInvalidConfirmToken)
+
+	// The departments matching since the dry run were not reviewed
+	preview, err = service.PreviewBulkDelete(adminCtx, filter)
+	require.NoError(t, err)
+	repo.departments["d007"] = dept.Department{ID: "d007", DeptName: "Late", CreatedAt: &old, Status: dept.StatusActive}
+	_, err = service.BulkDelete(adminCtx, filter, preview.ConfirmToken)
+	assert.ErrorIs(t, err, dept.ErrBulkDeleteChanged)
+	delete(repo.departments, "d007")
+
+	// The confirmed delete runs as a job, the managed department is skipped
+	preview, err = service.PreviewBulkDelete(adminCtx, filter)
+	require.NoError(t, err)
+	job, err := service.BulkDelete(adminCtx, filter, preview.ConfirmToken)
+	require.NoError(t, err)
+	assert.Equal(t, dept.JobTypeBulkDelete, job.Type)
+	assert.Equal(t, int64(1), job.CreatedBy)
+
+	job = waitJob(t, queue, job.ID)
+	assert.Equal(t, jobs.StatusSucceeded, job.Status, job.Error)
+	assert.Equal(t, int64(3), job.Processed)
+	assert.Equal(t, int64(3), job.Total)
+
+	var result dept.BulkDeleteResult
+	require.NoError(t, json.Unmarshal(job.Result, &result))
+	assert.Equal(t, int64(2), result.Deleted)
+	assert.Equal(t, []string{"d006"}, result.Skipped)
+
+	remaining := make([]string, 0, len(repo.departments))
+	for id := range repo.departments {
+		remaining = append(remaining, id)
+	}
+	sort.Strings(remaining)
+	assert.Equal(t, "d001,d003,d005,d006", strings.Join(remaining, ","))
+	require.Len(t, bus.events, 2)
+	assert.Equal(t, "d002", bus.events[0].Subject)
+}
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/admin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/cache"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util/redisutil"
+)
+
+// recordingRedis is a fake Redis handler recording the commands.
+// SET NX succeeds once per key, like a lock, and EXPIRE only finds the keys starting with "session:".
+type recordingRedis struct {
+	mu       sync.Mutex
+	commands []string
+	locked   map[string]bool
+}
+
+func (r *recordingRedis) handle(cmd []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands = append(r.commands, strings.Join(cmd, " "))
+	switch strings.ToUpper(cmd[0]) {
+	case "SET":
+		if strings.EqualFold(cmd[len(cmd)-1], "NX") {
+			if r.locked[cmd[1]] {
+				return "$-1\r\n"
+			}
+			r.locked[cmd[1]] = true
+		}
+		return "+OK\r\n"
+	case "EXPIRE":
+		if strings.HasPrefix(cmd[1], "session:") {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (r *recordingRedis) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	commands := r.commands
+	r.commands = nil
+	return commands
+}
+
+func TestCacheRewarmOnExpiry(t *testing.T) {
+	fake := &recordingRedis{locked: map[string]bool{}}
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fake.handle), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	loads := 0
+	c := cache.New("warm-test")
+	c.Warm("all", func(ctx context.Context) (any, error) {
+		loads++
+		return []string{"d001", "d002"}, nil
+	})
+
+	// The expired entry is reloaded and stored again under the lock of the re-warm
+	assert.True(t, cache.HandleExpired(context.Background(), client, "cache:warm-test:all"))
+	assert.Equal(t, 1, loads)
+	assert.Equal(t, []string{
+		"set cache-warm:cache:warm-test:all 1 ex 30 nx",
+		`set cache:warm-test:all ["d001","d002"] ex 300`,
+	}, fake.recorded())
+
+	// Another instance holding the lock reloads it, this one does not
+	assert.False(t, cache.HandleExpired(context.Background(), client, "cache:warm-test:all"))
+	assert.Equal(t, 1, loads)
+	assert.Len(t, fake.recorded(), 1)
+
+	// The keys without a warmer and the keys of the other features are ignored
+	assert.False(t, cache.HandleExpired(context.Background(), client, "cache:warm-test:other"))
+	assert.False(t, cache.HandleExpired(context.Background(), client, "access_token:admin"))
+	assert.Empty(t, fake.recorded())
+}
+
+func TestRefreshTTL(t *testing.T) {
+	fake := &recordingRedis{locked: map[string]bool{}}
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fake.handle), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	// The keys are refreshed in a single round trip, the missing ones are not counted
+	refreshed, err := redisutil.RefreshTTL(context.Background(), client, 30*time.Minute, "session:1", "session:2", "gone:3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), refreshed)
+	assert.Equal(t, []string{"expire session:1 1800", "expire session:2 1800", "expire gone:3 1800"}, fake.recorded())
+
+	refreshed, err = redisutil.RefreshTTL(context.Background(), client, time.Minute)
+	assert.NoError(t, err)
+	assert.Zero(t, refreshed)
+	assert.Empty(t, fake.recorded())
+}
+
+// scannableRedis extends fakeRedisStore with SCAN and MEMORY USAGE, each entry using 100 bytes.
+func scannableRedis() func(cmd []string) string {
+	store := fakeRedisStore()
+	var mu sync.Mutex
+	keys := map[string]bool{}
+
+	return func(cmd []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch strings.ToUpper(cmd[0]) {
+		case "SET":
+			keys[cmd[1]] = true
+		case "DEL":
+			for _, k := range cmd[1:] {
+				delete(keys, k)
+			}
+		case "SCAN":
+			var matched []string
+			for k := range keys {
+				if ok, _ := path.Match(cmd[3], k); ok {
+					matched = append(matched, k)
+				}
+			}
+			resp := fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n", len(matched))
+			for _, k := range matched {
+				resp += fmt.Sprintf("$%d\r\n%s\r\n", len(k), k)
+			}
+			return resp
+		case "MEMORY":
+			return ":100\r\n"
+		}
+		return store(cmd)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	t.Cleanup(cache.LoadEnv)
+
+	for _, tc := range []struct {
+		name     string
+		enabled  string
+		expected cache.Stats
+	}{
+		{"enabled", "", cache.Stats{Name: "stats-enabled", Hits: 1, Misses: 1, HitRatio: 0.5, Keys: 2, MemoryBytesEstimate: 200}},
+		{"disabled", "FALSE", cache.Stats{Name: "stats-disabled"}},
+	} {
+		t.Setenv("CACHE_ENABLED", tc.enabled)
+		cache.LoadEnv()
+
+		client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, scannableRedis()), MaxRetries: -1})
+		t.Cleanup(func() { client.Close() })
+		ctx := dbcontext.InjectRedisClient(context.Background(), client)
+
+		c := cache.New(tc.expected.Name)
+		c.Store(ctx, "d001", map[string]string{"id": "D001"})
+		c.Store(ctx, "d002", map[string]string{"id": "D002"})
+
+		var entry map[string]string
+		assert.Equal(t, tc.enabled == "", c.Load(ctx, "d001", &entry), tc.name)
+		assert.False(t, c.Load(ctx, "d003", &entry), tc.name)
+
+		response, err := admin.NewAdminService().GetCacheStats(ctx)
+		require.NoError(t, err, tc.name)
+		assert.Contains(t, response.Caches, tc.expected, tc.name)
+	}
+
+	// The statistics need Redis
+	_, err := admin.NewAdminService().GetCacheStats(context.Background())
+	assert.Error(t, err)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache.LoadEnv()
+
+	for _, tc := range []struct {
+		name      string
+		req       admin.CacheInvalidateRequest
+		removed   int64
+		remaining []string
+		err       error
+	}{
+		{"prefix of a cache", admin.CacheInvalidateRequest{Cache: "invalidate-a", Prefix: "d"}, 2, []string{"a:x001", "b:d001"}, nil},
+		{"whole cache", admin.CacheInvalidateRequest{Cache: "invalidate-a"}, 3, []string{"b:d001"}, nil},
+		{"prefix of all caches", admin.CacheInvalidateRequest{Prefix: "d"}, 3, []string{"a:x001"}, nil},
+		{"glob characters are literal", admin.CacheInvalidateRequest{Prefix: "*"}, 0, []string{"a:d001", "a:d002", "a:x001", "b:d001"}, nil},
+		{"unknown cache", admin.CacheInvalidateRequest{Cache: "invalidate-missing"}, 0, []string{"a:d001", "a:d002", "a:x001", "b:d001"}, admin.ErrCacheNotFound},
+	} {
+		client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, scannableRedis()), MaxRetries: -1})
+		t.Cleanup(func() { client.Close() })
+		ctx := dbcontext.InjectRedisClient(context.Background(), client)
+		ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserName: "admin"})
+
+		caches := map[string]*cache.Cache{"a": cache.New("invalidate-a"), "b": cache.New("invalidate-b")}
+		for _, entry := range []string{"a:d001", "a:d002", "a:x001", "b:d001"} {
+			name, key, _ := strings.Cut(entry, ":")
+			caches[name].Store(ctx, key, key)
+		}
+
+		response, err := admin.NewAdminService().InvalidateCache(ctx, tc.req)
+		assert.ErrorIs(t, err, tc.err, tc.name)
+		assert.Equal(t, tc.removed, response.Removed, tc.name)
+
+		var remaining []string
+		for _, entry := range []string{"a:d001", "a:d002", "a:x001", "b:d001"} {
+			name, key, _ := strings.Cut(entry, ":")
+			var value string
+			if caches[name].Load(ctx, key, &value) {
+				remaining = append(remaining, entry)
+			}
+		}
+		assert.Equal(t, tc.remaining, remaining, tc.name)
+	}
+}
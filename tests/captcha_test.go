@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+func TestCaptchaEndpoints(t *testing.T) {
+	t.Cleanup(func() {
+		captcha.SetVerifier(nil)
+		captcha.SetEndpoints(captcha.Register)
+	})
+	captcha.SetVerifier(captcha.VerifierFunc(func(ctx context.Context, answer string, remoteIP string) (bool, error) {
+		return answer == "human", nil
+	}))
+	ctx := context.Background()
+
+	// Only the self-registration requires an answer by default
+	assert.ErrorIs(t, captcha.CheckEndpoint(ctx, captcha.Register, "", "203.0.113.7"), captcha.ErrInvalidCaptcha)
+	assert.NoError(t, captcha.CheckEndpoint(ctx, captcha.Login, "", "203.0.113.7"))
+	assert.NoError(t, captcha.CheckEndpoint(ctx, captcha.ForgotPassword, "", "203.0.113.7"))
+
+	// The forms are listed by name, the unknown names are ignored
+	captcha.SetEndpoints(" Login", "forgot-password", "checkout")
+	assert.NoError(t, captcha.CheckEndpoint(ctx, captcha.Register, "", "203.0.113.7"))
+	assert.ErrorIs(t, captcha.CheckEndpoint(ctx, captcha.Login, "robot", "203.0.113.7"), captcha.ErrInvalidCaptcha)
+	assert.NoError(t, captcha.CheckEndpoint(ctx, captcha.Login, "human", "203.0.113.7"))
+	assert.ErrorIs(t, captcha.CheckEndpoint(ctx, captcha.ForgotPassword, "", "203.0.113.7"), captcha.ErrInvalidCaptcha)
+	assert.NoError(t, captcha.CheckEndpoint(ctx, "checkout", "", "203.0.113.7"))
+
+	// The logins and the password reset requests are refused before the user is looked up
+	validator.InitValidator()
+	db, pool := openRecordingDB(t)
+	users := &mockUserService{}
+	service := auth.NewAuthService(auth.WithUserService(users))
+
+	_, err := service.Login(dbcontext.InjectDB(ctx, db), auth.LoginRequest{
+		UserName: "jane", Password: "P@ssw0rd123", Client: refreshtoken.Client{IPAddress: "203.0.113.7"},
+	})
+	assert.ErrorIs(t, err, captcha.ErrInvalidCaptcha)
+	err = service.ForgotPassword(ctx, auth.ForgotPasswordRequest{Email: "jane@example.com"})
+	assert.ErrorIs(t, err, captcha.ErrInvalidCaptcha)
+	assert.Empty(t, pool.statements)
+
+	// The refused login is recorded in the login audit
+	require.Len(t, users.attempts, 1)
+	assert.Equal(t, captcha.ErrInvalidCaptcha.Error(), users.attempts[0].FailureReason)
+}
+
+func TestCaptchaHandlers(t *testing.T) {
+	r := SetupAuthRouter()
+
+	cases := []struct {
+		path     string
+		body     string
+		expected int
+		code     string
+	}{
+		{"/auth/login", `{"username":"jane","password":"P@ssw0rd123","captchaToken":"human"}`, http.StatusOK, ""},
+		{"/auth/login", `{"username":"jane","password":"P@ssw0rd123","captchaToken":"robot"}`, http.StatusBadRequest, "InvalidCaptcha"},
+		{"/auth/forgot-password", `{"email":"jane@example.com","captchaToken":"robot"}`, http.StatusBadRequest, "InvalidCaptcha"},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.path+" "+tc.body)
+		if tc.code != "" {
+			assert.Contains(t, resp.Body.String(), `"code":"`+tc.code+`"`, tc.path)
+		}
+	}
+
+	// The other login failures are not detailed, an unknown user is not told apart from a wrong password
+	req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"username":"ghost","password":"wrong-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "UserNotFound")
+}
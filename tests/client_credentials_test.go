@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/oauthclient"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+// mockClientService is a mock implementation of the ClientService interface for testing purposes.
+// It only knows the client of the tests, with the secret "secret".
+type mockClientService struct {
+	client oauthclient.Client
+}
+
+func (m *mockClientService) GetAllClients(ctx context.Context) ([]oauthclient.Client, error) {
+	return []oauthclient.Client{m.client}, nil
+}
+
+func (m *mockClientService) CreateClient(ctx context.Context, req oauthclient.ClientRequest) (oauthclient.IssuedClient, error) {
+	return oauthclient.IssuedClient{}, req.Validate()
+}
+
+func (m *mockClientService) RevokeClient(ctx context.Context, id string) (oauthclient.Client, error) {
+	return m.client, nil
+}
+
+func (m *mockClientService) Authenticate(ctx context.Context, id string, secret string) (oauthclient.Client, error) {
+	if id != m.client.ID || secret != "secret" {
+		return oauthclient.Client{}, oauthclient.ErrInvalidClient
+	}
+	return m.client, nil
+}
+
+func TestClientTokenHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := auth.NewAuthHandler(&mockAuthService{})
+	r := gin.New()
+	r.POST("/auth/token", handler.Token)
+
+	cases := []struct {
+		name     string
+		form     url.Values
+		basic    []string
+		expected int
+		error    string
+	}{
+		{"form credentials", url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"secret"}}, nil, http.StatusOK, ""},
+		{"basic credentials", url.Values{"grant_type": {"client_credentials"}, "scope": {"ROLE_USER"}}, []string{"client-1", "secret"}, http.StatusOK, ""},
+		{"password grant", url.Values{"grant_type": {"password"}, "client_id": {"client-1"}, "client_secret": {"secret"}}, nil, http.StatusBadRequest, "unsupported_grant_type"},
+		{"wrong secret", url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"wrong"}}, nil, http.StatusUnauthorized, "invalid_client"},
+		{"wrong basic secret", url.Values{"grant_type": {"client_credentials"}}, []string{"client-1", "wrong"}, http.StatusUnauthorized, "invalid_client"},
+		{"scope not allowed", url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}, "client_secret": {"secret"}, "scope": {"ROLE_ADMIN"}}, nil, http.StatusBadRequest, "invalid_scope"},
+		{"two credentials", url.Values{"grant_type": {"client_credentials"}, "client_id": {"client-1"}}, []string{"client-1", "secret"}, http.StatusBadRequest, "invalid_request"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(tc.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.basic != nil {
+			req.SetBasicAuth(tc.basic[0], tc.basic[1])
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"), tc.name)
+
+		// The responses are the ones of RFC 6749, without the response envelope
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body), tc.name)
+		if tc.error == "" {
+			assert.Equal(t, "client-token", body["access_token"], tc.name)
+			assert.Equal(t, float64(3600), body["expires_in"], tc.name)
+			continue
+		}
+		assert.Equal(t, tc.error, body["error"], tc.name)
+		assert.NotEmpty(t, body["error_description"], tc.name)
+	}
+
+	// The clients authenticated with the Basic scheme are challenged on a wrong secret
+	req := httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader("grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("client-1", "wrong")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "Basic")
+}
+
+func TestIssueClientToken(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_ALGORITHM", "HS256")
+	t.Setenv("JWT_SECRET", "client-credentials-secret")
+	t.Setenv("JWT_EXPIRATION_HOUR", "1")
+
+	clients := &mockClientService{client: oauthclient.Client{
+		ID:     "5f0c9a56-3f0e-4b8e-9d1a-1d2f3c4b5a69",
+		Name:   "payroll",
+		Scopes: oauthclient.Scopes{"ROLE_USER", "ROLE_AUDITOR"},
+	}}
+	service := auth.NewAuthService(auth.WithClientService(clients))
+	ctx := context.Background()
+	request := auth.ClientCredentialsRequest{GrantType: auth.ClientCredentialsGrant, ClientID: clients.client.ID, ClientSecret: "secret"}
+
+	// A client requesting no scope gets all its scopes
+	resp, err := service.IssueClientToken(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, "ROLE_USER ROLE_AUDITOR", resp.Scope)
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, int64(3600), resp.ExpiresIn)
+
+	// A subset of the scopes is granted, the other scopes are refused
+	request.Scope = "ROLE_AUDITOR"
+	subset, err := service.IssueClientToken(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, "ROLE_AUDITOR", subset.Scope)
+
+	request.Scope = "ROLE_AUDITOR ROLE_ADMIN"
+	_, err = service.IssueClientToken(ctx, request)
+	assert.ErrorIs(t, err, auth.ErrInvalidScope)
+
+	request.Scope, request.ClientSecret = "", "wrong"
+	_, err = service.IssueClientToken(ctx, request)
+	assert.ErrorIs(t, err, oauthclient.ErrInvalidClient)
+
+	request.GrantType = "password"
+	_, err = service.IssueClientToken(ctx, request)
+	assert.ErrorIs(t, err, auth.ErrUnsupportedGrantType)
+
+	// The scopes of the token are the roles of its requests, the client is an automation named by its ID
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/audit", authorization.JwtValidation(), authorization.RoleBasedAccessControl("ROLE_AUDITOR"), func(c *gin.Context) {
+		meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"userName": meta.UserName, "roles": meta.Roles, "automation": meta.Automation})
+	})
+	r.GET("/admin", authorization.JwtValidation(), authorization.RoleBasedAccessControl("ROLE_ADMIN"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for path, expected := range map[string]int{"/audit": http.StatusOK, "/admin": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+subset.AccessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, expected, w.Code, path)
+		if expected == http.StatusOK {
+			assert.JSONEq(t, `{"userName":"5f0c9a56-3f0e-4b8e-9d1a-1d2f3c4b5a69","roles":["ROLE_AUDITOR"],"automation":true}`, w.Body.String())
+		}
+	}
+}
+
+func TestClientRequestValidation(t *testing.T) {
+	validator.InitValidator()
+
+	valid := oauthclient.ClientRequest{Name: "payroll", Scopes: []string{"ROLE_USER"}}
+	assert.NoError(t, valid.Validate())
+
+	// A client needs a scope, and its scopes are known roles
+	for _, req := range []oauthclient.ClientRequest{
+		{Name: "payroll"},
+		{Name: "payroll", Scopes: []string{"ROLE_ROOT"}},
+		{Scopes: []string{"ROLE_USER"}},
+	} {
+		assert.Error(t, req.Validate(), req)
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/headers"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+)
+
+func TestCSRFTokenIssuance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/auth/csrf-token", auth.NewAuthHandler(&mockAuthService{}).CSRFToken)
+
+	issue := func(cookie string) (string, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/csrf-token", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: tokencookie.CSRFCookie, Value: cookie})
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+
+		var body struct {
+			Data auth.CSRFTokenResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		return body.Data.CSRFToken, findCookie(resp, tokencookie.CSRFCookie)
+	}
+
+	token, cookie := issue("")
+	assert.Len(t, token, 43)
+	require.NotNil(t, cookie)
+	assert.Equal(t, token, cookie.Value)
+	assert.False(t, cookie.HttpOnly, "the application reads the CSRF token cookie")
+	assert.Equal(t, "/", cookie.Path)
+
+	// The token of the cookie is kept, a malformed one is replaced
+	kept, _ := issue(token)
+	assert.Equal(t, token, kept)
+	replaced, _ := issue("short")
+	assert.NotEqual(t, "short", replaced)
+	assert.NotEqual(t, token, replaced)
+}
+
+func TestCSRFProtection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(headers.CSRFProtection())
+	r.Any("/departments", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	const csrfToken = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFG"
+	type request struct {
+		method      string
+		accessToken string
+		csrfCookie  string
+		csrfHeader  string
+		header      string
+	}
+	send := func(rq request) int {
+		req := httptest.NewRequest(rq.method, "/departments", nil)
+		if rq.accessToken != "" {
+			req.AddCookie(&http.Cookie{Name: tokencookie.AccessTokenCookie, Value: rq.accessToken})
+		}
+		if rq.csrfCookie != "" {
+			req.AddCookie(&http.Cookie{Name: tokencookie.CSRFCookie, Value: rq.csrfCookie})
+		}
+		if rq.csrfHeader != "" {
+			req.Header.Set(tokencookie.CSRFHeader, rq.csrfHeader)
+		}
+		if rq.header != "" {
+			req.Header.Set(rq.header, "credentials")
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// The requests are not checked when the tokens are delivered in the body
+	assert.Equal(t, http.StatusNoContent, send(request{method: http.MethodPost, accessToken: "token"}))
+
+	enableTokenCookies(t)
+	cases := []struct {
+		name     string
+		request  request
+		expected int
+	}{
+		{"safe method", request{method: http.MethodGet, accessToken: "token"}, http.StatusNoContent},
+		{"no token cookie", request{method: http.MethodPost}, http.StatusNoContent},
+		{"no CSRF token", request{method: http.MethodPost, accessToken: "token"}, http.StatusForbidden},
+		{"no CSRF header", request{method: http.MethodDelete, accessToken: "token", csrfCookie: csrfToken}, http.StatusForbidden},
+		{"no CSRF cookie", request{method: http.MethodPut, accessToken: "token", csrfHeader: csrfToken}, http.StatusForbidden},
+		{"other CSRF token", request{method: http.MethodPatch, accessToken: "token", csrfCookie: csrfToken, csrfHeader: "other"}, http.StatusForbidden},
+		{"matching CSRF token", request{method: http.MethodPost, accessToken: "token", csrfCookie: csrfToken, csrfHeader: csrfToken}, http.StatusNoContent},
+		{"authorization header", request{method: http.MethodPost, accessToken: "token", header: "Authorization"}, http.StatusNoContent},
+		{"API key", request{method: http.MethodPost, accessToken: "token", header: "X-API-Key"}, http.StatusNoContent},
+	}
+
+	for _, tc := range cases {
+		assert.Equal(t, tc.expected, send(tc.request), tc.name)
+	}
+}
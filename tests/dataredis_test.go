@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/dataredis"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+)
+
+// startFakeRedis starts a server answering each command with the reply of the handler,
+// or never answering when the reply is empty. It returns the address of the server.
+func startFakeRedis(t *testing.T, handler func(cmd []string) string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				// The commands are arrays of bulk strings: *<n>, then $<length> and the value of each argument
+				r := bufio.NewReader(conn)
+				for {
+					header, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "*")))
+					cmd := make([]string, 0, n)
+					for i := 0; i < n; i++ {
+						if _, err := r.ReadString('\n'); err != nil {
+							return
+						}
+						arg, err := r.ReadString('\n')
+						if err != nil {
+							return
+						}
+						cmd = append(cmd, strings.TrimSuffix(arg, "\r\n"))
+					}
+
+					if reply := handler(cmd); reply != "" {
+						conn.Write([]byte(reply))
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// reply returns a fake Redis handler answering every command with the same reply.
+func reply(resp string) func(cmd []string) string {
+	return func(cmd []string) string { return resp }
+}
+
+// setupDataRedisRouter serves the dataredis routes with a Redis client on the given address.
+func setupDataRedisRouter(t *testing.T, addr string) *gin.Engine {
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DialTimeout: time.Second})
+	t.Cleanup(func() { client.Close() })
+
+	gin.SetMode(gin.TestMode)
+	handler := dataredis.NewDataRedisHandler(dataredis.NewDataRedisService(dataredis.WithTimeout(100 * time.Millisecond)))
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(dbcontext.InjectRedisClient(c.Request.Context(), client))
+	})
+	r.GET("/dataredis/string/:key", handler.GetStringValue)
+	r.GET("/dataredis/json/:key", handler.GetJSONValue)
+
+	return r
+}
+
+func TestDataRedisErrors(t *testing.T) {
+	// A closed port refuses the connections
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	refused := ln.Addr().String()
+	ln.Close()
+
+	cases := []struct {
+		name       string
+		addr       string
+		path       string
+		expected   int
+		code       string
+		retryable  bool
+		retryAfter string
+	}{
+		{"value", startFakeRedis(t, reply("$5\r\nhello\r\n")), "/dataredis/string/greeting", http.StatusOK, "", false, ""},
+		{"json", startFakeRedis(t, reply("$10\r\n{\"id\":\"1\"}\r\n")), "/dataredis/json/dept", http.StatusOK, "", false, ""},
+		{"not found", startFakeRedis(t, reply("$-1\r\n")), "/dataredis/string/missing", http.StatusNotFound, "RedisKeyNotFound", false, ""},
+		{"not json", startFakeRedis(t, reply("$5\r\nhello\r\n")), "/dataredis/json/greeting", http.StatusInternalServerError, "", false, ""},
+		{"timeout", startFakeRedis(t, reply("")), "/dataredis/json/slow", http.StatusGatewayTimeout, "RedisTimeout", true, "1"},
+		{"error reply", startFakeRedis(t, reply("-ERR unknown command\r\n")), "/dataredis/string/greeting", http.StatusBadGateway, "RedisUnavailable", true, "1"},
+		{"refused", refused, "/dataredis/string/greeting", http.StatusBadGateway, "RedisUnavailable", true, "1"},
+	}
+
+	for _, tc := range cases {
+		r := setupDataRedisRouter(t, tc.addr)
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		assert.Equal(t, tc.retryAfter, resp.Header().Get("Retry-After"), tc.name)
+		if tc.code != "" {
+			assert.Contains(t, resp.Body.String(), `"code":"`+tc.code+`"`, tc.name)
+			if tc.retryable {
+				assert.Contains(t, resp.Body.String(), `"data":{"retryable":true,"retryAfterSeconds":1}`, tc.name)
+			} else {
+				assert.Contains(t, resp.Body.String(), `"data":{"retryable":false}`, tc.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/i18n"
+)
+
+func TestExportDepartments(t *testing.T) {
+	r := SetupRouter()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/departments/export", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Header().Get("Content-Disposition"), `filename="departments.csv"`)
+
+	lines := strings.Split(strings.TrimSuffix(resp.Body.String(), "\r\n"), "\r\n")
+	require.Len(t, lines, 3, "Expected the header and a line per department")
+	assert.True(t, strings.HasPrefix(lines[0], "ID,Department name,Active,Status"), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "d001,HR,true,"), lines[1])
+}
+
+func TestExportDepartmentsLocalized(t *testing.T) {
+	r := SetupRouter()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/departments/export?locale=de-DE&encoding=utf-8-bom", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	body := resp.Body.String()
+	assert.True(t, strings.HasPrefix(body, "\uFEFFID;Abteilung;Aktiv;Status;"), "Expected the BOM, the German header and the semicolons")
+	assert.Contains(t, body, "d001;HR;ja;")
+
+	for _, query := range []string{"delimiter=colon", "encoding=latin1", "dateFormat=excel"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/departments/export?"+query, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	// The locale gives the defaults, the explicit options override them
+	opts, err := export.NewOptions("fr_FR", "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, export.Options{Locale: "fr", Delimiter: ';', DateLayout: "02/01/2006 15:04"}, opts)
+
+	opts, err = export.NewOptions("de", "tab", "UTF-8-BOM", "iso")
+	require.NoError(t, err)
+	assert.Equal(t, export.Options{Locale: "de", Delimiter: '\t', DateLayout: "2006-01-02 15:04:05", BOM: true}, opts)
+
+	// An unknown locale falls back to English
+	opts, err = export.NewOptions("xx-YY", "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, export.Options{Locale: "en", Delimiter: ',', DateLayout: time.RFC3339}, opts)
+}
+
+func TestWriteDepartmentsCSV(t *testing.T) {
+	validFrom := time.Date(2025, 3, 1, 8, 30, 0, 0, time.FixedZone("CET", 3600))
+	departments := []dept.Department{{
+		ID:            "d001",
+		DeptName:      "=HYPERLINK(\"http://x\")",
+		Active:        false,
+		Status:        dept.StatusActive,
+		Tags:          dept.Tags{"finance", "eu"},
+		EmployeeCount: 12,
+		ValidFrom:     &validFrom,
+	}}
+
+	var buf bytes.Buffer
+	opts, err := export.NewOptions("de", "", "", "")
+	require.NoError(t, err)
+	require.NoError(t, dept.WriteDepartmentsCSV(&buf, departments, opts))
+
+	lines := strings.Split(buf.String(), "\r\n")
+	// The formulas are neutralized, the times are in UTC and the tags keep their separator
+	assert.Equal(t, `d001;"'=HYPERLINK(""http://x"")";nein;ACTIVE;finance,eu;12;;01.03.2025 07:30;;;;`, lines[1])
+}
+
+func TestI18nTranslate(t *testing.T) {
+	assert.Equal(t, "de", i18n.Language("de_AT"))
+	assert.Equal(t, i18n.DefaultLanguage, i18n.Language(""))
+	assert.Equal(t, "Mitarbeiter", i18n.Translate("de-CH", "department.employeeCount"))
+	assert.Equal(t, "Employees", i18n.Translate("pt-BR", "department.employeeCount"))
+	assert.Equal(t, "missing.key", i18n.Translate("de", "missing.key"))
+
+	// Every language translates the keys of the default language
+	for _, lang := range i18n.Languages() {
+		for _, key := range []string{"csv.delimiter", "csv.dateFormat", "boolean.true", "boolean.false", "department.deptName"} {
+			assert.NotEqual(t, key, i18n.Translate(lang, key), lang+" "+key)
+		}
+	}
+}
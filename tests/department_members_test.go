@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"gorm.io/gorm"
+)
+
+// The departments deleted one by one are read and locked through the bulk delete repository,
+// whose members are the users assigned to each department.
+
+func (r *bulkDeleteRepository) GetDepartmentByID(tx *gorm.DB, id string) (dept.Department, error) {
+	d, ok := r.departments[id]
+	if !ok {
+		return dept.Department{}, dept.ErrDepartmentNotFound
+	}
+	return d, nil
+}
+
+func (r *bulkDeleteRepository) GetDepartmentsByIDsForUpdate(tx *gorm.DB, ids []string) ([]dept.Department, error) {
+	var departments []dept.Department
+	for _, id := range ids {
+		if d, ok := r.departments[id]; ok {
+			departments = append(departments, d)
+		}
+	}
+	return departments, nil
+}
+
+func (r *bulkDeleteRepository) UnassignEmployees(ctx context.Context, tx *gorm.DB, id string) (int64, error) {
+	unassigned := r.members[id]
+	delete(r.members, id)
+	return unassigned, nil
+}
+
+func (r *bulkDeleteRepository) AdjustEmployeeCount(ctx context.Context, tx *gorm.DB, id string, delta int64) error {
+	return nil
+}
+
+func TestDeleteDepartmentWithMembersHandler(t *testing.T) {
+	r := SetupRouter()
+	serve := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("DELETE", path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The members are counted, and the response links the endpoint transferring them
+	resp := serve("/api/v1/departments/d099")
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	var body struct {
+		Code string                 `json:"code"`
+		Data dept.DepartmentMembers `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "DepartmentHasMembers", body.Code)
+	assert.Equal(t, int64(3), body.Data.Members)
+	assert.Equal(t, "/api/v1/users/transfer", body.Data.Links["transfer"])
+
+	assert.Equal(t, http.StatusOK, serve("/api/v1/departments/d099?force=true").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/api/v1/departments/d099?force=maybe").Code)
+}
+
+func TestDeleteDepartmentWithMembers(t *testing.T) {
+	t.Cleanup(dept.LoadEnv)
+	db, _ := openRecordingDB(t)
+	ctx := metacontext.InjectRequestMeta(dbcontext.InjectDB(context.Background(), db), metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+	newService := func() (dept.DepartmentService, *bulkDeleteRepository, *recordingBus) {
+		repo := &bulkDeleteRepository{
+			departments: map[string]dept.Department{
+				"d001": {ID: "d001", DeptName: "Staffed", Status: dept.StatusActive, EmployeeCount: 2},
+				"d002": {ID: "d002", DeptName: "Empty", Status: dept.StatusActive},
+			},
+			members: map[string]int64{"d001": 2},
+		}
+		bus := &recordingBus{}
+		return dept.NewDepartmentService(repo, dept.WithEventBus(bus)), repo, bus
+	}
+
+	// A department without members is deleted, one with members is refused with their count
+	service, repo, bus := newService()
+	deleted, err := service.DeleteDepartment(ctx, "d002", false)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	_, err = service.DeleteDepartment(ctx, "d001", false)
+	assert.ErrorIs(t, err, dept.ErrDepartmentHasMembers)
+	var members *dept.MembersError
+	require.ErrorAs(t, err, &members)
+	assert.Equal(t, int64(2), members.Members)
+	assert.Contains(t, repo.departments, "d001")
+	assert.Len(t, bus.events, 1)
+
+	// With force the members are unassigned by default
+	t.Setenv("DEPARTMENT_DELETE_CASCADE", "")
+	dept.LoadEnv()
+	_, err = service.DeleteDepartment(ctx, "d001", true)
+	require.NoError(t, err)
+	assert.NotContains(t, repo.departments, "d001")
+	assert.NotContains(t, repo.members, "d001")
+	require.Len(t, bus.events, 2)
+
+	// The KEEP policy leaves them assigned to the deleted department
+	t.Setenv("DEPARTMENT_DELETE_CASCADE", "keep")
+	dept.LoadEnv()
+	service, repo, _ = newService()
+	_, err = service.DeleteDepartment(ctx, "d001", true)
+	require.NoError(t, err)
+	assert.NotContains(t, repo.departments, "d001")
+	assert.Equal(t, int64(2), repo.members["d001"])
+}
+
+func TestBulkDeleteSkipsDepartmentsWithMembers(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	ctx := metacontext.InjectRequestMeta(dbcontext.InjectDB(context.Background(), db), metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+	old := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	repo := &bulkDeleteRepository{
+		departments: map[string]dept.Department{
+			"d001": {ID: "d001", DeptName: "Staffed", CreatedAt: &old, Status: dept.StatusActive},
+			"d002": {ID: "d002", DeptName: "Empty", CreatedAt: &old, Status: dept.StatusActive},
+		},
+		members: map[string]int64{"d001": 1},
+	}
+	queue := jobs.NewQueue(jobs.NewMemoryStore(time.Hour), 1, 1)
+	t.Cleanup(func() { queue.Close(context.Background()) })
+	service := dept.NewDepartmentService(repo, dept.WithEventBus(&recordingBus{}), dept.WithJobQueue(queue))
+
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	ctx = dbcontext.InjectRedisClient(ctx, client)
+
+	// The bulk delete has no force, the departments with members are skipped
+	inactive := false
+	filter := dept.BulkDeleteFilter{Active: &inactive, Archived: dept.ArchivedExclude}
+	preview, err := service.PreviewBulkDelete(ctx, filter)
+	require.NoError(t, err)
+	job, err := service.BulkDelete(ctx, filter, preview.ConfirmToken)
+	require.NoError(t, err)
+
+	job = waitJob(t, queue, job.ID)
+	require.Equal(t, jobs.StatusSucceeded, job.Status, job.Error)
+	var result dept.BulkDeleteResult
+	require.NoError(t, json.Unmarshal(job.Result, &result))
+	assert.Equal(t, int64(1), result.Deleted)
+	assert.Equal(t, []string{"d001"}, result.Skipped)
+	assert.Contains(t, repo.departments, "d001")
+}
+
+func TestTransferMembers(t *testing.T) {
+	r := SetupUserRouter()
+	serve := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/users/transfer", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve(`{"fromDepartmentId":"d001","toDepartmentId":"d002"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"transferred":[1,2]`)
+
+	resp = serve(`{"fromDepartmentId":"d001","toDepartmentId":"d999"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"UnknownDepartment"`)
+
+	// The request is checked before the members are read
+	service := user.NewUserService(&expirationRepository{})
+	_, err := service.TransferMembers(context.Background(), user.TransferRequest{FromDepartmentID: "d001", ToDepartmentID: "D001"})
+	assert.ErrorIs(t, err, user.ErrSameDepartment)
+	_, err = service.TransferMembers(context.Background(), user.TransferRequest{FromDepartmentID: "d001"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// recordingBus is an event bus keeping the events instead of writing them to the outbox.
+type recordingBus struct {
+	events []event.Event
+}
+
+func (b *recordingBus) Add(ctx context.Context, tx *gorm.DB, e event.Event) error {
+	b.events = append(b.events, e)
+	return nil
+}
+
+func TestServiceAccountDepartmentsClaim(t *testing.T) {
+	now := time.Now().Unix()
+
+	// The service accounts get their scope, never null, the other users get no claim
+	claims := auth.NewJWTClaims(user.User{ID: 7, UserName: "hr-sync", UserType: user.ServiceAccount, DepartmentScope: user.DepartmentScope{"d001"}}, now, now+3600)
+	assert.Equal(t, []string{"d001"}, claims["departments"])
+
+	claims = auth.NewJWTClaims(user.User{ID: 8, UserName: "idle-sync", UserType: user.ServiceAccount}, now, now+3600)
+	assert.Equal(t, []string{}, claims["departments"])
+
+	claims = auth.NewJWTClaims(user.User{ID: 1, UserName: "admin", UserType: user.UserAccount}, now, now+3600)
+	assert.NotContains(t, claims, "departments")
+}
+
+func TestJWTValidationDepartmentScope(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "scope-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/scope", authorization.JwtValidation(), func(c *gin.Context) {
+		meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"scoped": meta.DepartmentScoped, "d001": meta.InDepartmentScope("D001"), "d002": meta.InDepartmentScope("d002")})
+	})
+
+	now := time.Now().Unix()
+	cases := []struct {
+		user     user.User
+		expected string
+	}{
+		{user.User{ID: 7, UserName: "hr-sync", UserType: user.ServiceAccount, DepartmentScope: user.DepartmentScope{"d001"}}, `{"d001":true,"d002":false,"scoped":true}`},
+		{user.User{ID: 8, UserName: "idle-sync", UserType: user.ServiceAccount}, `{"d001":false,"d002":false,"scoped":true}`},
+		{user.User{ID: 1, UserName: "admin", UserType: user.UserAccount}, `{"d001":true,"d002":true,"scoped":false}`},
+	}
+
+	for _, tc := range cases {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.NewJWTClaims(tc.user, now, now+3600)).SignedString([]byte("scope-secret"))
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/scope", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code, tc.user.UserName)
+		assert.JSONEq(t, tc.expected, resp.Body.String(), tc.user.UserName)
+	}
+}
+
+func TestDepartmentScopeRejectsWrites(t *testing.T) {
+	validator.InitValidator()
+	db, pool := openRecordingDB(t)
+	bus := &recordingBus{}
+	service := dept.NewDepartmentService(dept.NewDepartmentRepository(), dept.WithEventBus(bus))
+
+	ctx := dbcontext.InjectDB(context.Background(), db)
+	ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{
+		UserID:           7,
+		UserName:         "hr-sync",
+		DepartmentScoped: true,
+		DepartmentScope:  []string{"d001"},
+	})
+
+	// A department outside of the scope is neither created nor read
+	d := GetSampleDepartment()
+	d.ID = "d002"
+	_, err := service.CreateDepartment(ctx, d)
+	assert.ErrorIs(t, err, dept.ErrDepartmentOutOfScope)
+
+	// A bulk change is refused as a whole, the IDs are compared case-insensitively
+	active := false
+	_, err = service.BulkUpdateStatus(ctx, dept.BulkStatusRequest{IDs: []string{"D001", "d003"}, Active: &active})
+	assert.ErrorIs(t, err, dept.ErrDepartmentOutOfScope)
+	assert.Empty(t, pool.statements)
+
+	// Each rejection is recorded as an audit event naming the denied departments
+	if assert.Len(t, bus.events, 2) {
+		assert.Equal(t, event.DepartmentAccessDenied, bus.events[0].Type)
+		assert.Equal(t, "d002", bus.events[0].Subject)
+		violation := bus.events[1].Data.(dept.ScopeViolation)
+		assert.Equal(t, "bulk-status", violation.Action)
+		assert.Equal(t, []string{"d003"}, violation.Denied)
+		assert.Equal(t, []string{"d001"}, violation.Scope)
+	}
+}
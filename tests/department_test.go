@@ -4,69 +4,61 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/fixture"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
 	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
 )
 
-// SetupSampleDepartment creates a sample department object for testing purposes
-// It returns a Department struct with sample data
+// GetSampleDepartment returns the sample department d001, also used as the example of the OpenAPI spec.
 func GetSampleDepartment() dept.Department {
-	now := time.Now()
-	createdBy := int64(1)
-	updatedBy := int64(1)
-	return dept.Department{
-		ID:        "d001",
-		DeptName:  "HR",
-		Active:    true,
-		CreatedBy: &createdBy,
-		CreatedAt: &now,
-		UpdatedBy: &updatedBy,
-		UpdatedAt: &now,
-	}
-}
-
-// SetupSampleDepartments creates a slice of sample department objects for testing purposes
-// It returns a slice of Department structs with sample data
+	return fixture.SampleDepartment()
+}
+
+// GetSampleDepartments returns the sample departments d001 and d002.
 func GetSampleDepartments() []dept.Department {
-	now := time.Now()
-	createdBy := int64(1)
-	updatedBy := int64(1)
-	return []dept.Department{
-		{
-			ID:        "d001",
-			DeptName:  "HR",
-			Active:    true,
-			CreatedBy: &createdBy,
-			CreatedAt: &now,
-			UpdatedBy: &updatedBy,
-			UpdatedAt: &now,
-		},
-		{
-			ID:        "d002",
-			DeptName:  "IT",
-			Active:    true,
-			CreatedBy: &createdBy,
-			CreatedAt: &now,
-			UpdatedBy: &updatedBy,
-			UpdatedAt: &now,
-		},
-	}
+	return fixture.SampleDepartments()
 }
 
 // MockService is an interface that defines the methods for department management.
 type MockService interface {
-	GetAllDepartments(ctx context.Context) ([]dept.Department, error)
+	GetAllDepartments(ctx context.Context, filter dept.DepartmentFilter, page pagination.Params) ([]dept.Department, *pagination.Meta, error)
 	GetDepartmentByID(ctx context.Context, id string) (dept.Department, error)
+	GetDepartmentByName(ctx context.Context, name string) (dept.Department, error)
+	CountDepartments(ctx context.Context, filter dept.DepartmentFilter) (int64, error)
+	GetPublicDepartments(ctx context.Context) ([]dept.PublicDepartment, error)
+	DepartmentExists(ctx context.Context, id string) (bool, error)
 	CreateDepartment(ctx context.Context, department dept.Department) (dept.Department, error)
+	ClaimDepartment(ctx context.Context, id string) (dept.Department, error)
+	ReleaseDepartment(ctx context.Context, id string) (dept.Department, error)
 	UpdateDepartment(ctx context.Context, id string, department dept.Department) (dept.Department, error)
-	DeleteDepartment(ctx context.Context, id string) (bool, error)
+	DeleteDepartment(ctx context.Context, id string, force bool) (bool, error)
+	ArchiveDepartment(ctx context.Context, id string) (dept.Department, error)
+	UnarchiveDepartment(ctx context.Context, id string) (dept.Department, error)
+	GetAllTags(ctx context.Context) ([]dept.TagCount, error)
+	SetDepartmentTags(ctx context.Context, id string, tags []string) (dept.Department, error)
+	AddDepartmentTags(ctx context.Context, id string, tags []string) (dept.Department, error)
+	RemoveDepartmentTag(ctx context.Context, id string, tag string) (dept.Department, error)
+	BulkUpdateStatus(ctx context.Context, req dept.BulkStatusRequest) (dept.BulkStatusResponse, error)
+	PreviewBulkDelete(ctx context.Context, filter dept.BulkDeleteFilter) (dept.BulkDeletePreview, error)
+	BulkDelete(ctx context.Context, filter dept.BulkDeleteFilter, confirmToken string) (jobs.Job, error)
+	GetDepartmentNames(ctx context.Context, id string) ([]dept.DepartmentName, error)
 }
 
 // MockService is a mock implementation of the DepartmentService interface for testing purposes.
@@ -80,8 +72,8 @@ func newMockService() MockService {
 
 // Mock implementation of the DepartmentService.GetAllDepartments method
 // This method returns a list of departments for testing purposes
-func (m *mockService) GetAllDepartments(ctx context.Context) ([]dept.Department, error) {
-	return GetSampleDepartments(), nil
+func (m *mockService) GetAllDepartments(ctx context.Context, filter dept.DepartmentFilter, page pagination.Params) ([]dept.Department, *pagination.Meta, error) {
+	return pagination.Paginate(GetSampleDepartments(), page, func(d dept.Department) string { return d.ID })
 }
 
 // Mock implementation of the DepartmentService.GetDepartmentByID method
@@ -90,9 +82,53 @@ func (m *mockService) GetDepartmentByID(ctx context.Context, id string) (dept.De
 	return GetSampleDepartment(), nil
 }
 
+// Mock implementation of the DepartmentService.GetDepartmentByName method
+// This method returns the sample department when the name matches case-insensitively
+func (m *mockService) GetDepartmentByName(ctx context.Context, name string) (dept.Department, error) {
+	if !strings.EqualFold(name, GetSampleDepartment().DeptName) {
+		return dept.Department{}, dept.ErrDepartmentNameNotFound
+	}
+	return GetSampleDepartment(), nil
+}
+
+// Mock implementation of the DepartmentService.CountDepartments method
+// This method returns the number of sample departments for testing purposes
+func (m *mockService) CountDepartments(ctx context.Context, filter dept.DepartmentFilter) (int64, error) {
+	return int64(len(GetSampleDepartments())), nil
+}
+
+// Mock implementation of the DepartmentService.DepartmentExists method
+// This method checks the sample departments for testing purposes
+func (m *mockService) DepartmentExists(ctx context.Context, id string) (bool, error) {
+	for _, d := range GetSampleDepartments() {
+		if d.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Mock implementation of the DepartmentService.CreateDepartment method
-// This method creates a new department for testing purposes
+// This method creates a new department for testing purposes, and rejects the name of the second sample department
 func (m *mockService) CreateDepartment(ctx context.Context, department dept.Department) (dept.Department, error) {
+	// Department d999 is beyond the quota of 10 departments, unless the quota is overridden
+	if department.ID == "d999" && !quota.Overridden(ctx) {
+		return dept.Department{}, &quota.ExceededError{
+			Err:      dept.ErrDepartmentQuotaExceeded,
+			Exceeded: quota.Exceeded{Entity: "departments", Limit: 10, Count: 10},
+		}
+	}
+	existing := GetSampleDepartments()[1]
+	if strings.EqualFold(department.DeptName, existing.DeptName) && department.ID != existing.ID {
+		candidates := []dept.DepartmentSuggestion{{ID: "d002", DeptName: "IT"}, {ID: "d003", DeptName: "ITS"}, {ID: "d004", DeptName: "Finance"}}
+		return dept.Department{}, &dept.ConflictError{
+			Err: dept.ErrDepartmentNameConflict,
+			DepartmentConflict: dept.DepartmentConflict{
+				Conflicting: existing,
+				Suggestions: dept.SuggestDepartmentNames(department.DeptName, existing.ID, candidates),
+			},
+		}
+	}
 	return GetSampleDepartment(), nil
 }
 
@@ -104,10 +140,140 @@ func (m *mockService) UpdateDepartment(ctx context.Context, id string, departmen
 
 // Mock implementation of the DepartmentService.DeleteDepartment method
 // This method deletes a department for testing purposes
-func (m *mockService) DeleteDepartment(ctx context.Context, id string) (bool, error) {
+func (m *mockService) DeleteDepartment(ctx context.Context, id string, force bool) (bool, error) {
+	if id == "d099" && !force {
+		return false, &dept.MembersError{Err: dept.ErrDepartmentHasMembers, DepartmentMembers: dept.DepartmentMembers{Members: 3}}
+	}
 	return true, nil
 }
 
+// Mock implementation of the DepartmentService.ArchiveDepartment method
+// This method archives a department for testing purposes
+func (m *mockService) ArchiveDepartment(ctx context.Context, id string) (dept.Department, error) {
+	d := GetSampleDepartment()
+	d.Status = dept.StatusArchived
+	return d, nil
+}
+
+// Mock implementation of the DepartmentService.UnarchiveDepartment method
+// This method unarchives a department for testing purposes
+func (m *mockService) UnarchiveDepartment(ctx context.Context, id string) (dept.Department, error) {
+	d := GetSampleDepartment()
+	d.Status = dept.StatusActive
+	return d, nil
+}
+
+// Mock implementation of the DepartmentService.GetAllTags method
+// This method returns the tags of the sample departments for testing purposes
+func (m *mockService) GetAllTags(ctx context.Context) ([]dept.TagCount, error) {
+	return []dept.TagCount{{Tag: "remote-first", Count: 1}}, nil
+}
+
+// Mock implementation of the DepartmentService.SetDepartmentTags method
+// This method replaces the tags of the sample department for testing purposes
+func (m *mockService) SetDepartmentTags(ctx context.Context, id string, tags []string) (dept.Department, error) {
+	d := GetSampleDepartment()
+	d.Tags = dept.NormalizeTags(tags)
+	return d, nil
+}
+
+// Mock implementation of the DepartmentService.AddDepartmentTags method
+// This method adds tags to the sample department for testing purposes
+func (m *mockService) AddDepartmentTags(ctx context.Context, id string, tags []string) (dept.Department, error) {
+	d := GetSampleDepartment()
+	d.Tags = dept.NormalizeTags(append(d.Tags, tags...))
+	return d, nil
+}
+
+// Mock implementation of the DepartmentService.RemoveDepartmentTag method
+// This method removes a tag from the sample department for testing purposes
+func (m *mockService) RemoveDepartmentTag(ctx context.Context, id string, tag string) (dept.Department, error) {
+	return GetSampleDepartment(), nil
+}
+
+// Mock implementation of the DepartmentService.GetDepartmentNames method
+// This method returns a renamed sample department, and fails for an unknown ID
+func (m *mockService) GetDepartmentNames(ctx context.Context, id string) ([]dept.DepartmentName, error) {
+	if id != GetSampleDepartment().ID {
+		return nil, dept.ErrDepartmentNotFound
+	}
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	renamed := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []dept.DepartmentName{
+		{DeptName: "Advertising", ValidFrom: &created, ValidTo: &renamed},
+		{DeptName: GetSampleDepartment().DeptName, ValidFrom: &renamed, Current: true},
+	}, nil
+}
+
+// Mock implementation of the DepartmentService.BulkUpdateStatus method
+// This method changes the status of the sample departments, and fails if one of the IDs is unknown
+func (m *mockService) BulkUpdateStatus(ctx context.Context, req dept.BulkStatusRequest) (dept.BulkStatusResponse, error) {
+	samples := map[string]dept.Department{}
+	for _, d := range GetSampleDepartments() {
+		samples[d.ID] = d
+	}
+
+	result := dept.BulkStatusResponse{Updated: []dept.Department{}, Unchanged: []string{}}
+	for _, id := range req.IDs {
+		d, ok := samples[id]
+		if !ok {
+			return dept.BulkStatusResponse{}, dept.ErrDepartmentNotFound
+		}
+		if d.Active == *req.Active {
+			result.Unchanged = append(result.Unchanged, id)
+			continue
+		}
+		d.Active = *req.Active
+		result.Updated = append(result.Updated, d)
+	}
+
+	return result, nil
+}
+
+// Mock implementation of the DepartmentService.PreviewBulkDelete method
+// This method matches the sample departments and issues the confirm token "confirm-token"
+func (m *mockService) PreviewBulkDelete(ctx context.Context, filter dept.BulkDeleteFilter) (dept.BulkDeletePreview, error) {
+	return dept.BulkDeletePreview{Filter: filter.String(), Matched: 2, Sample: []string{"d001", "d002"}, ConfirmToken: "confirm-token", ExpiresAt: time.Now().Add(10 * time.Minute)}, nil
+}
+
+// Mock implementation of the DepartmentService.BulkDelete method
+// This method queues a job when confirmed with "confirm-token"
+func (m *mockService) BulkDelete(ctx context.Context, filter dept.BulkDeleteFilter, confirmToken string) (jobs.Job, error) {
+	if confirmToken != "confirm-token" {
+		return jobs.Job{}, dept.ErrInvalidConfirmToken
+	}
+	return jobs.Job{ID: "job-1", Type: dept.JobTypeBulkDelete, Status: jobs.StatusQueued, Total: 2}, nil
+}
+
+// Mock implementation of the DepartmentService.GetPublicDepartments method
+// This method returns the public projection of the sample departments for testing purposes
+func (m *mockService) GetPublicDepartments(ctx context.Context) ([]dept.PublicDepartment, error) {
+	var departments []dept.PublicDepartment
+	for _, d := range GetSampleDepartments() {
+		departments = append(departments, dept.PublicDepartment{ID: d.ID, DeptName: d.DeptName, Active: d.Active})
+	}
+	return departments, nil
+}
+
+// Mock implementation of the DepartmentService.ClaimDepartment method
+// This method marks the sample department as managed by the automation identity of the request
+func (m *mockService) ClaimDepartment(ctx context.Context, id string) (dept.Department, error) {
+	meta, ok := metacontext.ExtractRequestMeta(ctx)
+	if !ok || !meta.Automation {
+		return dept.Department{}, dept.ErrClaimRequiresAPIKey
+	}
+	department := GetSampleDepartment()
+	department.ManagedBy = &meta.UserName
+	return department, nil
+}
+
+// Mock implementation of the DepartmentService.ReleaseDepartment method
+// This method returns the sample department, which is not managed
+func (m *mockService) ReleaseDepartment(ctx context.Context, id string) (dept.Department, error) {
+	return dept.Department{}, dept.ErrDepartmentNotManaged
+}
+
 // SetupRouter initializes the Gin router and sets up the routes for department management
 // It uses the MockService for testing purposes
 func SetupRouter() *gin.Engine {
@@ -132,13 +298,26 @@ func SetupRouter() *gin.Engine {
 		deptGroup := v1.Group("/departments")
 		{
 			deptGroup.GET("", handler.GetAllDepartments)
+			deptGroup.GET("/count", handler.CountDepartments)
+			deptGroup.GET("/export", handler.ExportDepartments)
+			deptGroup.GET("/by-name/:name", handler.GetDepartmentByName)
 			deptGroup.GET("/:id", handler.GetDepartmentByID)
+			deptGroup.HEAD("/:id", handler.DepartmentExists)
 			deptGroup.POST("", handler.CreateDepartment)
 			deptGroup.PUT("/:id", handler.UpdateDepartment)
 			deptGroup.DELETE("/:id", handler.DeleteDepartment)
+			deptGroup.POST("/:id/archive", handler.ArchiveDepartment)
+			deptGroup.POST("/:id/unarchive", handler.UnarchiveDepartment)
+			deptGroup.PUT("/:id/tags", handler.SetDepartmentTags)
+			deptGroup.POST("/bulk-status", handler.BulkUpdateStatus)
+			deptGroup.DELETE("", handler.BulkDeleteDepartments)
+			deptGroup.GET("/:id/names", handler.GetDepartmentNames)
 		}
 	}
 
+	// Public read-only routes, without authentication
+	r.GET("/public/v1/departments", handler.GetPublicDepartments)
+
 	return r
 }
 
@@ -241,6 +420,65 @@ func TestGetDepartmentByID(t *testing.T) {
 	assert.Equal(t, GetSampleDepartment().DeptName, d.DeptName, "Expected department name to match")
 }
 
+func TestGetAllDepartmentsWithFields(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request asking for the ID and name only
+	req, err := http.NewRequest("GET", "/api/v1/departments?fields=id,deptName", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 200 OK
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Unmarshal the response body and check that only the requested fields are returned
+	var httpResponse struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	assert.NotEmpty(t, httpResponse.Data, "Expected departments list to be not empty")
+	for _, d := range httpResponse.Data {
+		assert.Len(t, d, 2, "Expected only the requested fields")
+		assert.Contains(t, d, "id")
+		assert.Contains(t, d, "deptName")
+	}
+
+	// An unknown field is rejected
+	req, _ = http.NewRequest("GET", "/api/v1/departments?fields=id,name", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetDepartmentByName(t *testing.T) {
+	r := SetupRouter()
+
+	// Check an existing name in another case and a missing name
+	for name, expected := range map[string]int{"hr": http.StatusOK, "Finance": http.StatusNotFound} {
+		req, err := http.NewRequest("GET", "/api/v1/departments/by-name/"+name, nil)
+		if err != nil {
+			t.Fatalf("Failed to get department by name: %v", err)
+		}
+
+		// Create a new HTTP response recorder to capture the response
+		// The response recorder is used to simulate an HTTP response for testing purposes
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		// Check if the response status code matches
+		assert.Equal(t, expected, resp.Code, "Unexpected status code for name "+name)
+	}
+}
+
 func TestCreateDepartment(t *testing.T) {
 	r := SetupRouter()
 
@@ -286,6 +524,35 @@ func TestCreateDepartment(t *testing.T) {
 	assert.Equal(t, newDept.DeptName, createdDept.DeptName, "Expected created department name to match")
 }
 
+func TestCreateDepartmentConflict(t *testing.T) {
+	r := SetupRouter()
+
+	// The name of the second sample department is already used
+	jsonData, _ := json.Marshal(dept.Department{ID: "d009", DeptName: "it"})
+	req, _ := http.NewRequest("POST", "/api/v1/departments", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	var body struct {
+		Code string                  `json:"code"`
+		Data dept.DepartmentConflict `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	// The response carries the conflicting department and the similar names, without the conflicting one
+	assert.Equal(t, dept.ErrDepartmentNameConflict.Code, body.Code)
+	assert.Equal(t, "d002", body.Data.Conflicting.ID)
+	if assert.Len(t, body.Data.Suggestions, 1) {
+		assert.Equal(t, "d003", body.Data.Suggestions[0].ID)
+		assert.Greater(t, body.Data.Suggestions[0].Similarity, 0.5)
+	}
+}
+
 func TestUpdateDepartment(t *testing.T) {
 	r := SetupRouter()
 
@@ -353,3 +620,441 @@ func TestDeleteDepartment(t *testing.T) {
 	// This means the request was successful and the server deleted the department
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
+
+func TestArchiveDepartment(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request to the endpoint
+	// The request is a POST request to the "/departments/{id}/archive" endpoint with no body
+	req, err := http.NewRequest("POST", "/api/v1/departments/"+GetSampleDepartment().ID+"/archive", nil)
+	if err != nil {
+		t.Fatalf("Failed to archive department: %v", err)
+	}
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 200 OK
+	// This means the request was successful and the server archived the department
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Convert the response to a Department object
+	archivedDept, err := ConvertHttpResponseToDepartment(t, resp)
+	if err != nil {
+		t.Fatalf("Failed to convert response to Department: %v", err)
+	}
+
+	// Check if the department is archived
+	assert.Equal(t, dept.StatusArchived, archivedDept.Status, "Expected department to be archived")
+}
+
+func TestGetAllDepartmentsInvalidArchivedFilter(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request with an unsupported archived filter
+	req, err := http.NewRequest("GET", "/api/v1/departments?archived=all", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 400 Bad Request
+	// This means the server rejected the unsupported filter
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetAllDepartmentsAsOf(t *testing.T) {
+	r := SetupRouter()
+
+	// The point in time is an RFC 3339 time or a date
+	cases := map[string]int{
+		"2024-01-31":           http.StatusOK,
+		"2024-01-31T10:00:00Z": http.StatusOK,
+		"2024-01-31T10:00:00":  http.StatusBadRequest,
+		"yesterday":            http.StatusBadRequest,
+	}
+
+	for asOf, status := range cases {
+		req, err := http.NewRequest("GET", "/api/v1/departments?asOf="+url.QueryEscape(asOf), nil)
+		if err != nil {
+			t.Fatalf("Failed to get all departments: %v", err)
+		}
+
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, status, resp.Code, "Unexpected status code for asOf=%s", asOf)
+	}
+}
+
+func TestGetAllDepartmentsInvalidMetadataFilter(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request with a metadata filter on an invalid key
+	req, err := http.NewRequest("GET", "/api/v1/departments?metadata.cost%20center=cc-12", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 400 Bad Request
+	// This means the server rejected the invalid metadata key
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetAllDepartmentsWithCursor(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request for the first page of one department
+	req, err := http.NewRequest("GET", "/api/v1/departments?limit=1", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 200 OK
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Unmarshal the response body and check the page metadata
+	var httpResponse struct {
+		Data []dept.Department `json:"data"`
+		Meta pagination.Meta   `json:"meta"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	assert.Len(t, httpResponse.Data, 1, "Expected one department in the page")
+	assert.Equal(t, pagination.EncodeCursor(httpResponse.Data[0].ID), httpResponse.Meta.NextCursor, "Expected the next cursor to point after the last department")
+}
+
+func TestGetAllDepartmentsLinks(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request for the first page of one department, keeping a filter
+	req, err := http.NewRequest("GET", "/api/v1/departments?archived=include&page=1&limit=1", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Unmarshal the response body and check the navigation links
+	var httpResponse util.HttpResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	assert.Equal(t, "/api/v1/departments?archived=include&page=1&limit=1", httpResponse.Links["self"])
+	assert.Equal(t, "/api/v1/departments?archived=include&limit=1&page=2", httpResponse.Links["next"], "Expected the next link to keep the filter")
+	assert.NotContains(t, httpResponse.Links, "prev", "Expected no previous link on the first page")
+	assert.Equal(t, "/api/v1/departments/tags", httpResponse.Links["tags"])
+}
+
+func TestGetDepartmentByIDLinks(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request to the endpoint
+	req, err := http.NewRequest("GET", "/api/v1/departments/"+GetSampleDepartment().ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to get department by ID: %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Unmarshal the response body and check the links to the related sub-resources
+	var httpResponse util.HttpResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	self := "/api/v1/departments/" + GetSampleDepartment().ID
+	assert.Equal(t, self, httpResponse.Links["self"])
+	assert.Equal(t, "/api/v1/departments", httpResponse.Links["collection"])
+	assert.Equal(t, self+"/tags", httpResponse.Links["tags"])
+	assert.Equal(t, self+"/archive", httpResponse.Links["archive"], "Expected an active department to link its archive action")
+}
+
+func TestCountDepartments(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request to the "/departments/count" endpoint
+	req, err := http.NewRequest("GET", "/api/v1/departments/count", nil)
+	if err != nil {
+		t.Fatalf("Failed to count departments: %v", err)
+	}
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 200 OK and the count matches the sample departments
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var httpResponse struct {
+		Data dept.CountResponse `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Equal(t, int64(len(GetSampleDepartments())), httpResponse.Data.Count)
+}
+
+func TestDepartmentExists(t *testing.T) {
+	r := SetupRouter()
+
+	// Check an existing and a missing department with HEAD requests
+	for id, expected := range map[string]int{GetSampleDepartment().ID: http.StatusOK, "d999": http.StatusNotFound} {
+		req, err := http.NewRequest("HEAD", "/api/v1/departments/"+id, nil)
+		if err != nil {
+			t.Fatalf("Failed to check department existence: %v", err)
+		}
+
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		// Check if the status code matches and the response has no body
+		assert.Equal(t, expected, resp.Code)
+		assert.Empty(t, resp.Body.String(), "Expected no response body")
+	}
+}
+
+func TestSetDepartmentTags(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request replacing the tags of the sample department
+	jsonData, _ := json.Marshal(dept.TagsRequest{Tags: []string{"Billable", "remote-first", "billable"}})
+	req, err := http.NewRequest("PUT", "/api/v1/departments/"+GetSampleDepartment().ID+"/tags", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("Failed to set department tags: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Create a new HTTP response recorder to capture the response
+	// The response recorder is used to simulate an HTTP response for testing purposes
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 200 OK
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Check if the tags are normalized (lowercase, deduplicated and sorted)
+	d, err := ConvertHttpResponseToDepartment(t, resp)
+	if err != nil {
+		t.Fatalf("Failed to convert response to Department: %v", err)
+	}
+	assert.Equal(t, dept.Tags{"billable", "remote-first"}, d.Tags)
+}
+
+func TestBulkUpdateStatus(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request deactivating the sample departments
+	active := false
+	jsonData, _ := json.Marshal(dept.BulkStatusRequest{IDs: []string{"d001", "d002"}, Active: &active})
+	req, err := http.NewRequest("POST", "/api/v1/departments/bulk-status", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("Failed to update the status of departments: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Unmarshal the response body and check the deactivated departments
+	var httpResponse struct {
+		Data dept.BulkStatusResponse `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Len(t, httpResponse.Data.Updated, 2, "Expected both departments to be deactivated")
+	for _, d := range httpResponse.Data.Updated {
+		assert.False(t, d.Active)
+	}
+
+	// An unknown department fails the whole request with its typed error
+	jsonData, _ = json.Marshal(dept.BulkStatusRequest{IDs: []string{"d001", "d999"}, Active: &active})
+	req, _ = http.NewRequest("POST", "/api/v1/departments/bulk-status", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"DepartmentNotFound"`)
+}
+
+func TestGetDepartmentNames(t *testing.T) {
+	r := SetupRouter()
+
+	// Create a new HTTP request for the name history of the sample department
+	req, err := http.NewRequest("GET", "/api/v1/departments/"+GetSampleDepartment().ID+"/names", nil)
+	if err != nil {
+		t.Fatalf("Failed to get department names: %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Unmarshal the response body and check the names, oldest first
+	var httpResponse struct {
+		Data []dept.DepartmentName `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if assert.Len(t, httpResponse.Data, 2) {
+		assert.Equal(t, "Advertising", httpResponse.Data[0].DeptName)
+		assert.False(t, httpResponse.Data[0].Current)
+		assert.True(t, httpResponse.Data[1].Current, "Expected the last name to be the current one")
+		assert.Nil(t, httpResponse.Data[1].ValidTo)
+	}
+
+	// An unknown department is not found
+	req, _ = http.NewRequest("GET", "/api/v1/departments/d999/names", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestGetAllDepartmentsHardCap(t *testing.T) {
+	r := SetupRouter()
+
+	// Lower the hard cap below the number of sample departments
+	hardCap := pagination.HardCap
+	pagination.HardCap = 1
+	defer func() { pagination.HardCap = hardCap }()
+
+	// Create a new HTTP request for the whole list, without pagination
+	req, err := http.NewRequest("GET", "/api/v1/departments", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 400 Bad Request
+	// This means the unpaginated listing was refused instead of returning every row
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// A paginated request is still served
+	req, err = http.NewRequest("GET", "/api/v1/departments?limit=1", nil)
+	if err != nil {
+		t.Fatalf("Failed to get all departments: %v", err)
+	}
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestGetPublicDepartments(t *testing.T) {
+	r := SetupRouter()
+
+	req, err := http.NewRequest("GET", "/public/v1/departments", nil)
+	if err != nil {
+		t.Fatalf("Failed to get public departments: %v", err)
+	}
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	// Check if the response status code is 200 OK with the caching headers
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Cache-Control"), "public, max-age=")
+	etag := resp.Header().Get("ETag")
+	assert.NotEmpty(t, etag, "Expected an ETag on the public listing")
+
+	// Only the public projection is returned
+	var httpResponse struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	assert.Len(t, httpResponse.Data, len(GetSampleDepartments()))
+	for _, d := range httpResponse.Data {
+		assert.ElementsMatch(t, []string{"id", "deptName", "active"}, slices.Collect(maps.Keys(d)))
+	}
+
+	// Revalidating with the ETag answers 304 Not Modified without a body
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Body.String())
+}
+
+func TestClaimDepartment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := dept.NewDepartmentHandler(newMockService())
+
+	// The claim route is authenticated with the API key or the JWT, like the API routes
+	r := gin.New()
+	r.POST("/api/v1/departments/:id/claim", authorization.Authentication(), handler.ClaimDepartment)
+	r.DELETE("/api/v1/departments/:id/claim", authorization.APIKeyAuthentication(), handler.ReleaseDepartment)
+
+	apikey.SetIdentities([]apikey.Identity{{Name: "terraform", UserID: 9, Roles: []string{"ROLE_ADMIN"}, KeySHA256: apikey.HashKey("s3cr3t-key")}})
+	defer apikey.SetIdentities(nil)
+
+	cases := []struct {
+		method   string
+		key      string
+		expected int
+	}{
+		{http.MethodPost, "s3cr3t-key", http.StatusOK},
+		{http.MethodPost, "wrong-key", http.StatusUnauthorized},
+		{http.MethodPost, "", http.StatusUnauthorized},
+		{http.MethodDelete, "s3cr3t-key", http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, "/api/v1/departments/d001/claim", nil)
+		if tc.key != "" {
+			req.Header.Set(apikey.Header, tc.key)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, "Unexpected status code for "+tc.method+" with key "+tc.key)
+	}
+
+	// The claimed department is managed by the automation identity of the key
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/departments/d001/claim", nil)
+	req.Header.Set(apikey.Header, "s3cr3t-key")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	department, err := ConvertHttpResponseToDepartment(t, resp)
+	if err != nil {
+		t.Fatalf("Failed to convert response to department: %v", err)
+	}
+	assert.Equal(t, "terraform", *department.ManagedBy)
+}
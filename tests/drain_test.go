@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/admin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/drain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+)
+
+func TestDrainFailsReadiness(t *testing.T) {
+	registry := health.NewRegistry()
+	registry.Register("drain", health.Critical, drain.CheckReady)
+	r := SetupHealthRouter(registry)
+
+	// The application is ready until the drain starts
+	status, _ := getReadiness(t, r)
+	assert.Equal(t, http.StatusOK, status)
+
+	// Start the drain through the admin endpoint without waiting for its end
+	gin.SetMode(gin.TestMode)
+	adminRouter := gin.New()
+	adminRouter.POST("/admin/drain", admin.NewAdminHandler(nil).Drain)
+
+	req, _ := http.NewRequest("POST", "/admin/drain", nil)
+	resp := httptest.NewRecorder()
+	adminRouter.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.False(t, drain.Start(), "Expected the drain to be started only once")
+
+	// The readiness probe now fails so the load balancer stops routing requests
+	status, report := getReadiness(t, r)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, drain.ErrDraining.Error(), report.Components["drain"].Error)
+
+	// The background jobs are waited for in the registration order
+	var order []string
+	drain.RegisterJob("first", func(ctx context.Context) error { order = append(order, "first"); return nil })
+	drain.RegisterJob("second", func(ctx context.Context) error { order = append(order, "second"); return nil })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	drain.WaitJobs(ctx)
+	assert.Equal(t, []string{"first", "second"}, order)
+
+	// A drain request waiting for the end of the drain responds once it is complete
+	drain.Finish()
+	req, _ = http.NewRequest("POST", "/admin/drain?wait=true", nil)
+	resp = httptest.NewRecorder()
+	adminRouter.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), admin.DrainStatusDrained)
+}
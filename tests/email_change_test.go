@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	"gorm.io/gorm"
+)
+
+func TestRequestMyEmailChange(t *testing.T) {
+	r := SetupUserRouter()
+
+	for body, expected := range map[string]int{
+		`{"email":"new@example.com"}`:   http.StatusAccepted,
+		`{"email":"taken@example.com"}`: http.StatusConflict,
+		`{"email":"not-an-email"}`:      http.StatusBadRequest,
+		`{}`:                            http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/email", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, body)
+	}
+}
+
+func TestConfirmMyEmailChange(t *testing.T) {
+	r := SetupUserRouter()
+
+	for token, expected := range map[string]int{sampleEmailToken: http.StatusOK, "unknown": http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/email/confirm", bytes.NewBufferString(`{"token":"`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, token)
+	}
+
+	// The endpoint needs an authenticated user
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/email/confirm", bytes.NewBufferString(`{"token":"`+sampleEmailToken+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+// fakeRedisStore returns a fake Redis handler keeping the strings and the sorted sets in memory,
+// enough for GET, MGET, SET, DEL, GETDEL, ZADD, ZREMRANGEBYSCORE, ZCARD, PEXPIRE, PTTL and the MULTI/EXEC transactions.
+// The times to live are recorded for PTTL, the keys never expire.
+func fakeRedisStore() func(cmd []string) string {
+	var mu sync.Mutex
+	values := map[string]string{}
+	zsets := map[string]map[string]float64{}
+	ttls := map[string]int64{}
+	var queued [][]string
+	inMulti := false
+
+	run := func(cmd []string) string {
+		switch strings.ToUpper(cmd[0]) {
+		case "GET", "GETDEL":
+			v, ok := values[cmd[1]]
+			if !ok {
+				return "$-1\r\n"
+			}
+			if strings.EqualFold(cmd[0], "GETDEL") {
+				delete(values, cmd[1])
+			}
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+		case "MGET":
+			replies := fmt.Sprintf("*%d\r\n", len(cmd)-1)
+			for _, k := range cmd[1:] {
+				if v, ok := values[k]; ok {
+					replies += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+				} else {
+					replies += "$-1\r\n"
+				}
+			}
+			return replies
+		case "SET":
+			values[cmd[1]] = cmd[2]
+			delete(ttls, cmd[1])
+			if len(cmd) == 5 {
+				ttl, _ := strconv.ParseInt(cmd[4], 10, 64)
+				if strings.EqualFold(cmd[3], "EX") {
+					ttl *= 1000
+				}
+				ttls[cmd[1]] = ttl
+			}
+			return "+OK\r\n"
+		case "DEL":
+			n := 0
+			for _, k := range cmd[1:] {
+				_, isString := values[k]
+				_, isSet := zsets[k]
+				if isString || isSet {
+					delete(values, k)
+					delete(zsets, k)
+					delete(ttls, k)
+					n++
+				}
+			}
+			return fmt.Sprintf(":%d\r\n", n)
+		case "ZADD":
+			if zsets[cmd[1]] == nil {
+				zsets[cmd[1]] = map[string]float64{}
+			}
+			n := 0
+			for i := 2; i+1 < len(cmd); i += 2 {
+				if _, ok := zsets[cmd[1]][cmd[i+1]]; !ok {
+					n++
+				}
+				zsets[cmd[1]][cmd[i+1]], _ = strconv.ParseFloat(cmd[i], 64)
+			}
+			return fmt.Sprintf(":%d\r\n", n)
+		case "ZREMRANGEBYSCORE":
+			max, _ := strconv.ParseFloat(cmd[3], 64)
+			n := 0
+			for member, score := range zsets[cmd[1]] {
+				if score <= max {
+					delete(zsets[cmd[1]], member)
+					n++
+				}
+			}
+			return fmt.Sprintf(":%d\r\n", n)
+		case "ZCARD":
+			return fmt.Sprintf(":%d\r\n", len(zsets[cmd[1]]))
+		case "PEXPIRE":
+			ttl, _ := strconv.ParseInt(cmd[2], 10, 64)
+			ttls[cmd[1]] = ttl
+			return ":1\r\n"
+		case "PTTL":
+			_, isString := values[cmd[1]]
+			_, isSet := zsets[cmd[1]]
+			if !isString && !isSet {
+				return ":-2\r\n"
+			}
+			if ttl, ok := ttls[cmd[1]]; ok {
+				return fmt.Sprintf(":%d\r\n", ttl)
+			}
+			return ":-1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	}
+
+	return func(cmd []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.EqualFold(cmd[0], "MULTI"):
+			inMulti, queued = true, nil
+			return "+OK\r\n"
+		case strings.EqualFold(cmd[0], "EXEC"):
+			replies := fmt.Sprintf("*%d\r\n", len(queued))
+			for _, c := range queued {
+				replies += run(c)
+			}
+			inMulti, queued = false, nil
+			return replies
+		case inMulti:
+			queued = append(queued, cmd)
+			return "+QUEUED\r\n"
+		}
+		return run(cmd)
+	}
+}
+
+// channelMailer forwards the sent messages to a channel, the e-mails are sent in the background.
+type channelMailer chan mailer.Message
+
+func (m channelMailer) Send(ctx context.Context, message mailer.Message) error {
+	m <- message
+	return nil
+}
+
+// receiveMail waits for the next message sent with the mailer.
+func receiveMail(t *testing.T, m channelMailer) mailer.Message {
+	select {
+	case message := <-m:
+		return message
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no e-mail sent")
+		return mailer.Message{}
+	}
+}
+
+// emailChangeRepository is a user repository holding users in memory.
+// The methods the e-mail change does not use are left unimplemented.
+type emailChangeRepository struct {
+	user.UserRepository
+	users map[int64]user.User
+	audit []user.AuditEntry
+}
+
+func (r *emailChangeRepository) GetUserByID(tx *gorm.DB, id int64) (user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *emailChangeRepository) GetUsersByIdentity(tx *gorm.DB, username string, email string) ([]user.User, error) {
+	var users []user.User
+	for _, u := range r.users {
+		if strings.EqualFold(u.UserName, username) || strings.EqualFold(u.Email, email) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (r *emailChangeRepository) LockUser(tx *gorm.DB, id int64) error {
+	return nil
+}
+
+func (r *emailChangeRepository) SetUserEmail(ctx context.Context, tx *gorm.DB, u user.User, email string, updatedBy *int64) (user.User, error) {
+	u.Email = email
+	u.UpdatedBy = updatedBy
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *emailChangeRepository) AddAuditEntry(ctx context.Context, tx *gorm.DB, entry user.AuditEntry) error {
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+// emailChangeToken extracts the confirmation token from the e-mail sent to the new address.
+func emailChangeToken(t *testing.T, message mailer.Message) string {
+	_, rest, ok := strings.Cut(message.Body, "confirm your new e-mail address: ")
+	require.True(t, ok, message.Body)
+	return strings.Fields(rest)[0]
+}
+
+func TestEmailChangeConfirmation(t *testing.T) {
+	mail := make(channelMailer, 4)
+	mailer.SetMailer(mail)
+	defer mailer.InitMailer()
+
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	db, _ := openRecordingDB(t)
+
+	repo := &emailChangeRepository{users: map[int64]user.User{
+		3: {ID: 3, UserName: "caller", FirstName: "Caller", Email: "old@example.com"},
+		4: {ID: 4, UserName: "other", FirstName: "Other", Email: "taken@example.com"},
+		5: {ID: 5, UserName: "gone", FirstName: "Gone", Email: "deleted@example.com", DeletedAt: &gorm.DeletedAt{Time: time.Now(), Valid: true}},
+	}}
+	bus := &recordingBus{}
+	service := user.NewUserService(repo, user.WithEventBus(bus))
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+	callerCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 3, UserName: "caller"})
+	otherCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 4, UserName: "other"})
+
+	// The current e-mail and the e-mails of the other users are refused
+	assert.ErrorIs(t, service.RequestEmailChange(callerCtx, 3, user.EmailChangeRequest{Email: "OLD@example.com"}), user.ErrEmailUnchanged)
+	assert.ErrorIs(t, service.RequestEmailChange(callerCtx, 3, user.EmailChangeRequest{Email: "taken@example.com"}), user.ErrEmailTaken)
+	assert.ErrorIs(t, service.RequestEmailChange(callerCtx, 3, user.EmailChangeRequest{Email: "Deleted@example.com"}), user.ErrEmailDeleted)
+
+	// The e-mail is staged and the token is sent to the new address
+	require.NoError(t, service.RequestEmailChange(callerCtx, 3, user.EmailChangeRequest{Email: "new@example.com"}))
+	message := receiveMail(t, mail)
+	assert.Equal(t, "new@example.com", message.To)
+	token := emailChangeToken(t, message)
+	assert.Equal(t, "old@example.com", repo.users[3].Email, "Expected the e-mail to be kept until confirmed")
+
+	// The token of a user cannot be confirmed by another one, and is not burnt by the attempt
+	_, err := service.ConfirmEmailChange(otherCtx, 4, user.EmailConfirmationRequest{Token: token})
+	assert.ErrorIs(t, err, user.ErrInvalidEmailToken)
+
+	updated, err := service.ConfirmEmailChange(callerCtx, 3, user.EmailConfirmationRequest{Token: token})
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", updated.Email)
+	require.Len(t, repo.audit, 1)
+	assert.Equal(t, user.AuditEmailChanged, repo.audit[0].Action)
+	assert.Equal(t, user.AuditChange{Before: "old@example.com", After: "new@example.com"}, repo.audit[0].Changes["email"])
+	assert.Len(t, bus.events, 1)
+
+	// The previous address is notified
+	notice := receiveMail(t, mail)
+	assert.Equal(t, "old@example.com", notice.To)
+
+	// The token is single-use
+	_, err = service.ConfirmEmailChange(callerCtx, 3, user.EmailConfirmationRequest{Token: token})
+	assert.ErrorIs(t, err, user.ErrInvalidEmailToken)
+
+	// The uniqueness is checked again on confirmation, the e-mail may have been taken in the meantime
+	require.NoError(t, service.RequestEmailChange(callerCtx, 3, user.EmailChangeRequest{Email: "later@example.com"}))
+	token = emailChangeToken(t, receiveMail(t, mail))
+	other := repo.users[4]
+	other.Email = "later@example.com"
+	repo.users[4] = other
+
+	_, err = service.ConfirmEmailChange(callerCtx, 3, user.EmailConfirmationRequest{Token: token})
+	assert.ErrorIs(t, err, user.ErrEmailTaken)
+	assert.Equal(t, "new@example.com", repo.users[3].Email)
+}
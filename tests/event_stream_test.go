@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/eventstream"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/stream"
+)
+
+// readEvent reads the lines of the next Server-Sent Event, skipping the comments
+func readEvent(t *testing.T, reader *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+
+		line = strings.TrimRight(line, "\n")
+		if line == "" && len(lines) > 0 {
+			return lines
+		}
+		if line != "" && !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestEventStreamShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/events", eventstream.NewEventStreamHandler().StreamEvents)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// Open the stream and wait for the connection to be registered
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Eventually(t, func() bool { return stream.Count() == 1 }, time.Second, 10*time.Millisecond)
+
+	reader := bufio.NewReader(resp.Body)
+
+	// A domain event is forwarded to the stream
+	stream.Broadcast(event.NewEvent(event.DepartmentCreated, "d001", nil))
+	assert.Contains(t, readEvent(t, reader), "event: "+event.DepartmentCreated)
+
+	// On shutdown, a final event is sent with a reconnection delay and the connection is closed
+	stream.CloseAll()
+	final := readEvent(t, reader)
+	assert.Contains(t, final, "event: "+eventstream.EventShutdown)
+	assert.Contains(t, final, "retry: 3000")
+	assert.Eventually(t, func() bool { return stream.Count() == 0 }, time.Second, 10*time.Millisecond)
+
+	// New connections are refused once the shutdown has started
+	resp2, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp2.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp2.StatusCode)
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+)
+
+func TestRequireFreshLogin(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "fresh-login-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/sensitive", authorization.JwtValidation(), authorization.RequireFreshLogin(15*time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	now := time.Now()
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+	claims := func(authTime time.Time, rememberMe bool) jwt.MapClaims {
+		c := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+		c["sid"] = sampleSessionID
+		c["auth_time"] = authTime.Unix()
+		if rememberMe {
+			c["remember_me"] = true
+		}
+		return c
+	}
+	withoutAuthTime := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+	withoutAuthTime["remember_me"] = true
+
+	cases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected int
+	}{
+		{"session not remembered", claims(now.Add(-48*time.Hour), false), http.StatusNoContent},
+		{"remembered, fresh login", claims(now.Add(-5*time.Minute), true), http.StatusNoContent},
+		{"remembered, old login", claims(now.Add(-48*time.Hour), true), http.StatusUnauthorized},
+		{"remembered, no login time", withoutAuthTime, http.StatusUnauthorized},
+		{"no session", auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix()), http.StatusNoContent},
+	}
+
+	for _, tc := range cases {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte("fresh-login-secret"))
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/sensitive", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		if tc.expected == http.StatusUnauthorized {
+			assert.Contains(t, resp.Body.String(), "Fresh login required", tc.name)
+		}
+	}
+}
+
+func TestFreshLoginMaxAge(t *testing.T) {
+	t.Setenv("FRESH_LOGIN_MAX_AGE_MINUTES", "")
+	assert.Equal(t, 15*time.Minute, authorization.FreshLoginMaxAge())
+
+	t.Setenv("FRESH_LOGIN_MAX_AGE_MINUTES", "5")
+	assert.Equal(t, 5*time.Minute, authorization.FreshLoginMaxAge())
+
+	t.Setenv("FRESH_LOGIN_MAX_AGE_MINUTES", "-1")
+	assert.Equal(t, 15*time.Minute, authorization.FreshLoginMaxAge())
+}
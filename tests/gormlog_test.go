@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/logger/gormlog"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// captureLog redirects the logger of the level to a buffer for the duration of the test.
+func captureLog(t *testing.T, level logrus.Level) *bytes.Buffer {
+	var buf bytes.Buffer
+	l := logger.GetLogger(level)
+	previous := l.Out
+	l.SetOutput(&buf)
+	t.Cleanup(func() { l.SetOutput(previous) })
+
+	return &buf
+}
+
+func TestGormLogFields(t *testing.T) {
+	assert.Empty(t, gormlog.Fields(context.Background()))
+
+	// The request ID is known before the authentication
+	ctx := metacontext.InjectRequestID(context.Background(), "req-1")
+	assert.Equal(t, logrus.Fields{"request_id": "req-1"}, gormlog.Fields(ctx))
+
+	ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 2, UserName: "john", ImpersonatedBy: 1, RequestID: "req-1"})
+	assert.Equal(t, logrus.Fields{"request_id": "req-1", "user_id": int64(2), "username": "john", "impersonated_by": int64(1)}, gormlog.Fields(ctx))
+}
+
+func TestGormLogFailedStatementCarriesRequest(t *testing.T) {
+	buf := captureLog(t, logrus.ErrorLevel)
+
+	db, _ := openRecordingDB(t)
+	db = db.Session(&gorm.Session{Logger: gormlog.New(gormLogger.Error)})
+
+	// The statements run on the database of the request context are tied to the request
+	ctx := metacontext.InjectRequestMeta(context.Background(), metacontext.RequestMeta{UserID: 2, UserName: "john", RequestID: "req-42"})
+	ctx = dbcontext.InjectDB(ctx, db)
+
+	var count int64
+	err := dbcontext.GetDB(ctx).Raw("SELECT count(*) FROM department WHERE active = ?", true).Scan(&count).Error
+	require.Error(t, err)
+
+	line := buf.String()
+	assert.Contains(t, line, "database statement failed")
+	assert.Contains(t, line, "request_id=req-42")
+	assert.Contains(t, line, "user_id=2")
+	assert.Contains(t, line, "SELECT count(*) FROM department WHERE active = true")
+	assert.Contains(t, line, "error=\"not supported\"")
+}
+
+func TestGormLogLevels(t *testing.T) {
+	buf := captureLog(t, logrus.ErrorLevel)
+
+	db, _ := openRecordingDB(t)
+	ctx := metacontext.InjectRequestID(context.Background(), "req-7")
+
+	// A silent logger drops the failures
+	var count int64
+	silent := db.Session(&gorm.Session{Logger: gormlog.New(gormLogger.Silent)})
+	require.Error(t, silent.WithContext(ctx).Raw("SELECT count(*) FROM users").Scan(&count).Error)
+	assert.Empty(t, buf.String())
+
+	// The records not found are expected by the repositories, they are not failures
+	l := gormlog.New(gormLogger.Error)
+	l.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT * FROM users", 0 }, gorm.ErrRecordNotFound)
+	assert.Empty(t, buf.String())
+}
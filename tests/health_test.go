@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	handler "github.com/yoanesber/Go-Department-CRUD/internal/health"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/health"
+)
+
+// SetupHealthRouter initializes a Gin router serving the readiness probe of the given registry
+func SetupHealthRouter(registry *health.Registry) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/readyz", handler.NewHealthHandler(registry).Readiness)
+
+	return r
+}
+
+// getReadiness calls the readiness probe and returns the status code and the report
+func getReadiness(t *testing.T, r *gin.Engine) (int, health.Report) {
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	var httpResponse struct {
+		Data health.Report `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &httpResponse); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+
+	return resp.Code, httpResponse.Data
+}
+
+func TestReadiness(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	// All components are up
+	registry := health.NewRegistry()
+	registry.Register("postgres", health.Critical, up)
+	registry.Register("webhook-dispatcher", health.NonCritical, up)
+	code, report := getReadiness(t, SetupHealthRouter(registry))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusUp, report.Status)
+
+	// A failing non-critical component degrades the application, which stays ready
+	registry.Register("webhook-dispatcher", health.NonCritical, down)
+	code, report = getReadiness(t, SetupHealthRouter(registry))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Equal(t, "connection refused", report.Components["webhook-dispatcher"].Error)
+
+	// A failing critical component makes the application not ready
+	registry.Register("postgres", health.Critical, down)
+	code, report = getReadiness(t, SetupHealthRouter(registry))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, health.StatusDown, report.Components["postgres"].Status)
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+)
+
+func TestImpersonateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := auth.NewAuthHandler(&mockAuthService{})
+
+	// The requests are made by the admin 1, or by a user without the admin role
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		roles := []string{"ROLE_ADMIN"}
+		if c.GetHeader("X-Test-Role") != "" {
+			roles = []string{c.GetHeader("X-Test-Role")}
+		}
+		ctx := metacontext.InjectRequestMeta(c.Request.Context(), metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: roles})
+		c.Request = c.Request.WithContext(ctx)
+	})
+	r.POST("/users/:id/impersonate", authorization.RoleBasedAccessControl("ROLE_ADMIN"), handler.Impersonate)
+
+	cases := []struct {
+		path     string
+		role     string
+		expected int
+		code     string
+	}{
+		{"/users/2/impersonate", "", http.StatusOK, ""},
+		{"/users/2/impersonate", "ROLE_USER", http.StatusForbidden, ""},
+		{"/users/abc/impersonate", "", http.StatusBadRequest, ""},
+		{"/users/1/impersonate", "", http.StatusConflict, "ImpersonateSelf"},
+		{"/users/404/impersonate", "", http.StatusNotFound, "UserNotFound"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		if tc.role != "" {
+			req.Header.Set("X-Test-Role", tc.role)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.path+" "+tc.role)
+		if tc.code != "" {
+			assert.Contains(t, resp.Body.String(), `"code":"`+tc.code+`"`, tc.path)
+		}
+	}
+}
+
+func TestImpersonateRefusedWithoutQuery(t *testing.T) {
+	db, pool := openRecordingDB(t)
+	bus := &recordingBus{}
+	service := auth.NewAuthService(auth.WithEventBus(bus))
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	// An admin cannot impersonate themselves
+	adminCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+	_, err := service.Impersonate(adminCtx, 1)
+	assert.ErrorIs(t, err, auth.ErrImpersonateSelf)
+
+	// An impersonation token cannot be used to impersonate another user
+	nestedCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 2, UserName: "john", Roles: []string{"ROLE_ADMIN"}, ImpersonatedBy: 1})
+	_, err = service.Impersonate(nestedCtx, 3)
+	assert.ErrorIs(t, err, auth.ErrImpersonationNested)
+
+	// The refusals neither query the database nor write to the audit trail
+	assert.Empty(t, pool.statements)
+	assert.Empty(t, bus.events)
+}
+
+func TestJWTValidationImpersonatedBy(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "impersonation-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+		meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"userId": meta.UserID, "impersonatedBy": meta.ImpersonatedBy})
+	})
+
+	now := time.Now().Unix()
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+
+	// The impersonation tokens carry the admin in the impersonated_by claim, the other tokens do not
+	impersonation := auth.NewJWTClaims(u, now, now+900)
+	impersonation["impersonated_by"] = 1
+	for expected, claims := range map[string]jwt.MapClaims{
+		`{"userId":2,"impersonatedBy":1}`: impersonation,
+		`{"userId":2,"impersonatedBy":0}`: auth.NewJWTClaims(u, now, now+3600),
+	} {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("impersonation-secret"))
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, expected, resp.Body.String())
+	}
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/job"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jobs"
+)
+
+func TestJobQueue(t *testing.T) {
+	queue := jobs.NewQueue(jobs.NewMemoryStore(time.Hour), 1, 1)
+	t.Cleanup(func() { queue.Close(context.Background()) })
+
+	// The progress is reported while the job runs, and the result stored once it succeeds
+	release := make(chan struct{})
+	reported := make(chan struct{})
+	running, err := queue.Enqueue(context.Background(), "test.progress", 1, func(ctx context.Context, report func(int64, int64)) (any, error) {
+		report(1, 2)
+		close(reported)
+		<-release
+		report(2, 2)
+		return map[string]int{"done": 2}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusQueued, running.Status)
+
+	<-reported
+	current, err := queue.Get(context.Background(), running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusRunning, current.Status)
+	assert.Equal(t, int64(1), current.Processed)
+	assert.Equal(t, int64(2), current.Total)
+
+	// One job waits for the busy worker, the next one is refused
+	failing, err := queue.Enqueue(context.Background(), "test.failing", 1, func(ctx context.Context, report func(int64, int64)) (any, error) {
+		panic("broken task")
+	})
+	require.NoError(t, err)
+	_, err = queue.Enqueue(context.Background(), "test.refused", 1, func(ctx context.Context, report func(int64, int64)) (any, error) { return nil, nil })
+	assert.ErrorIs(t, err, jobs.ErrQueueFull)
+
+	close(release)
+	done := waitJob(t, queue, running.ID)
+	assert.Equal(t, jobs.StatusSucceeded, done.Status)
+	assert.JSONEq(t, `{"done":2}`, string(done.Result))
+	require.NotNil(t, done.FinishedAt)
+
+	// A panicking task fails its job, not the worker
+	done = waitJob(t, queue, failing.ID)
+	assert.Equal(t, jobs.StatusFailed, done.Status)
+	assert.Contains(t, done.Error, "broken task")
+
+	_, err = queue.Get(context.Background(), "unknown")
+	assert.ErrorIs(t, err, jobs.ErrJobNotFound)
+}
+
+func TestJobQueueClose(t *testing.T) {
+	queue := jobs.NewQueue(jobs.NewMemoryStore(time.Hour), 1, 2)
+
+	// The running job is cancelled once the wait times out, the queued one never starts
+	started := make(chan struct{})
+	running, err := queue.Enqueue(context.Background(), "test.long", 1, func(ctx context.Context, report func(int64, int64)) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+	queued, err := queue.Enqueue(context.Background(), "test.queued", 1, func(ctx context.Context, report func(int64, int64)) (any, error) {
+		return nil, errors.New("must not run")
+	})
+	require.NoError(t, err)
+	<-started
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, queue.Close(waitCtx), context.DeadlineExceeded)
+
+	done, err := queue.Get(context.Background(), running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusFailed, done.Status)
+	done, err = queue.Get(context.Background(), queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, jobs.StatusFailed, done.Status)
+	assert.Contains(t, done.Error, "shut down")
+
+	_, err = queue.Enqueue(context.Background(), "test.closed", 1, func(ctx context.Context, report func(int64, int64)) (any, error) { return nil, nil })
+	assert.ErrorIs(t, err, jobs.ErrQueueClosed)
+}
+
+func TestJobRedisStore(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	// The jobs are shared by the replicas through Redis
+	queue := jobs.NewQueue(jobs.NewRedisStore(client, time.Hour), 1, 1)
+	t.Cleanup(func() { queue.Close(context.Background()) })
+	other := jobs.NewQueue(jobs.NewRedisStore(client, time.Hour), 1, 1)
+	t.Cleanup(func() { other.Close(context.Background()) })
+
+	created, err := queue.Enqueue(context.Background(), "test.shared", 3, func(ctx context.Context, report func(int64, int64)) (any, error) {
+		report(5, 5)
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	done := waitJob(t, other, created.ID)
+	assert.Equal(t, jobs.StatusSucceeded, done.Status)
+	assert.Equal(t, int64(5), done.Processed)
+	assert.Equal(t, int64(3), done.CreatedBy)
+
+	// The job is polled through the jobs endpoint
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/jobs/:id", job.NewJobHandler(other).GetJob)
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+created.ID, nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"status":"SUCCEEDED"`)
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"JobNotFound"`)
+}
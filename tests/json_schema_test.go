@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/schema"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/validation"
+)
+
+// SetupSchemaRouter initializes a Gin router validating the department payloads
+// with the JSON Schema validation mode given as parameter
+func SetupSchemaRouter(t *testing.T, mode string) *gin.Engine {
+	t.Setenv("JSON_SCHEMA_VALIDATION", mode)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/departments", validation.JSONSchemaValidation(schema.MustGetSchema("department")), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	r.GET("/schemas/:entity", schema.NewSchemaHandler().GetSchema)
+
+	return r
+}
+
+func TestJSONSchemaValidationEnforce(t *testing.T) {
+	r := SetupSchemaRouter(t, validation.ModeEnforce)
+
+	// A valid payload is accepted
+	req, _ := http.NewRequest("POST", "/departments", bytes.NewBufferString(`{"id":"d001","deptName":"HR","active":true}`))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	// An unknown field and a wrong type are rejected with detailed errors
+	req, _ = http.NewRequest("POST", "/departments", bytes.NewBufferString(`{"id":"d001","deptName":"HR","active":"yes","name":"HR"}`))
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"field":"active"`)
+	assert.Contains(t, resp.Body.String(), `"field":"name"`)
+}
+
+func TestJSONSchemaValidationMetadata(t *testing.T) {
+	r := SetupSchemaRouter(t, validation.ModeEnforce)
+
+	// Scalar metadata values are accepted
+	req, _ := http.NewRequest("POST", "/departments", bytes.NewBufferString(`{"id":"d001","deptName":"HR","active":true,"metadata":{"costCenter":"cc-12","headcount":12}}`))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	// Nested values and keys with a dot are rejected
+	req, _ = http.NewRequest("POST", "/departments", bytes.NewBufferString(`{"id":"d001","deptName":"HR","active":true,"metadata":{"owner":{"name":"x"},"a.b":"c"}}`))
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"field":"metadata.owner"`)
+	assert.Contains(t, resp.Body.String(), `"field":"metadata.a.b"`)
+}
+
+func TestJSONSchemaValidationReport(t *testing.T) {
+	r := SetupSchemaRouter(t, validation.ModeReport)
+
+	// An invalid payload is only reported, the request is still handled
+	req, _ := http.NewRequest("POST", "/departments", bytes.NewBufferString(`{"id":"d001","deptName":"HR","active":"yes"}`))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+}
+
+func TestGetJSONSchema(t *testing.T) {
+	r := SetupSchemaRouter(t, validation.ModeOff)
+
+	// The schema of a registered entity is published
+	req, _ := http.NewRequest("GET", "/schemas/department", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"deptName"`)
+
+	// An unknown entity is not found
+	req, _ = http.NewRequest("GET", "/schemas/unknown", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
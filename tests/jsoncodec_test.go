@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsoncodec"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// departmentListEnvelope returns the response envelope of a listing of n departments.
+func departmentListEnvelope(n int) util.HttpResponse {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 6000, time.UTC)
+	createdBy := int64(1)
+	total := int64(n)
+
+	departments := make([]dept.Department, n)
+	for i := range departments {
+		departments[i] = dept.Department{
+			ID:        fmt.Sprintf("d%03d", i%1000),
+			DeptName:  fmt.Sprintf("Department <%d> & Co", i),
+			Active:    i%2 == 0,
+			Tags:      dept.Tags{"finance", "emea"},
+			Metadata:  dept.Metadata{"costCenter": "CC-1", "floor": "3"},
+			Status:    dept.StatusActive,
+			ValidFrom: &now,
+			CreatedBy: &createdBy,
+			CreatedAt: &now,
+			UpdatedAt: &now,
+		}
+	}
+
+	return util.HttpResponse{
+		Message:   "All departments retrieved successfully",
+		Path:      "/api/v1/departments",
+		Status:    http.StatusOK,
+		Data:      departments,
+		Meta:      &pagination.Meta{Page: 1, Limit: n, TotalItems: &total},
+		Links:     util.Links{"self": "/api/v1/departments?page=1"},
+		Timestamp: now,
+	}
+}
+
+func TestJSONCodecEnvelopeCompatibility(t *testing.T) {
+	envelope := departmentListEnvelope(3)
+
+	expected, err := json.Marshal(envelope)
+	assert.NoError(t, err)
+
+	// The envelope is encoded as with encoding/json, HTML characters included
+	actual, err := jsoncodec.Marshal(envelope)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(actual), "encoder %s", jsoncodec.Name())
+
+	// The departments decode back to the same values
+	var decoded struct {
+		Data []dept.Department `json:"data"`
+	}
+	assert.NoError(t, jsoncodec.Unmarshal(actual, &decoded))
+	assert.Equal(t, envelope.Data, decoded.Data)
+
+	// The Gin render path produces the same envelope
+	gin.SetMode(gin.TestMode)
+	resp := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(resp)
+	c.Request = httptest.NewRequest(http.MethodGet, envelope.Path, nil)
+	c.JSON(http.StatusOK, envelope)
+	assert.JSONEq(t, string(expected), resp.Body.String())
+}
+
+func BenchmarkJSONCodecDepartmentList(b *testing.B) {
+	envelope := departmentListEnvelope(1000)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := jsoncodec.Marshal(envelope); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGinRenderDepartmentList(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	envelope := departmentListEnvelope(1000)
+	req := httptest.NewRequest(http.MethodGet, envelope.Path, nil)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = req
+		c.JSON(http.StatusOK, envelope)
+	}
+}
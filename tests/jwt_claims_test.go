@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+)
+
+func TestJwtClaimsEnv(t *testing.T) {
+	t.Cleanup(authorization.LoadEnv)
+
+	t.Setenv("JWT_ISSUER", "")
+	t.Setenv("JWT_AUDIENCE", "")
+	t.Setenv("JWT_ALLOWED_AUDIENCES", "")
+	t.Setenv("JWT_CLOCK_SKEW_SECONDS", "")
+	authorization.LoadEnv()
+	assert.Empty(t, authorization.JWTIssuer)
+	assert.Empty(t, authorization.JWTAudiences)
+	assert.Equal(t, 30*time.Second, authorization.ClockSkew)
+
+	// The audience of the issued tokens is allowed by default
+	t.Setenv("JWT_AUDIENCE", "department-api")
+	t.Setenv("JWT_CLOCK_SKEW_SECONDS", "0")
+	authorization.LoadEnv()
+	assert.Equal(t, []string{"department-api"}, authorization.JWTAudiences)
+	assert.Equal(t, time.Duration(0), authorization.ClockSkew)
+
+	t.Setenv("JWT_ALLOWED_AUDIENCES", "department-api, reporting-api,")
+	t.Setenv("JWT_CLOCK_SKEW_SECONDS", "-5")
+	authorization.LoadEnv()
+	assert.Equal(t, []string{"department-api", "reporting-api"}, authorization.JWTAudiences)
+	assert.Equal(t, 30*time.Second, authorization.ClockSkew)
+}
+
+func TestJwtClaimsValidation(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "claims-secret")
+	t.Setenv("JWT_ISSUER", "department-crud")
+	t.Setenv("JWT_AUDIENCE", "department-api")
+	t.Setenv("JWT_ALLOWED_AUDIENCES", "department-api,reporting-api")
+	t.Setenv("JWT_CLOCK_SKEW_SECONDS", "30")
+	t.Cleanup(authorization.LoadEnv)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	now := time.Now()
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":      "department-crud",
+			"aud":      "department-api",
+			"iat":      now.Unix(),
+			"exp":      now.Add(time.Hour).Unix(),
+			"userid":   2,
+			"username": "john",
+			"roles":    []string{"ROLE_USER"},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	cases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected int
+	}{
+		{"valid claims", claims(nil), http.StatusNoContent},
+		{"another allowed audience", claims(func(c jwt.MapClaims) { c["aud"] = []string{"other-api", "reporting-api"} }), http.StatusNoContent},
+		{"audience of another application", claims(func(c jwt.MapClaims) { c["aud"] = "other-api" }), http.StatusUnauthorized},
+		{"no audience", claims(func(c jwt.MapClaims) { delete(c, "aud") }), http.StatusUnauthorized},
+		{"issuer of another application", claims(func(c jwt.MapClaims) { c["iss"] = "other-app" }), http.StatusUnauthorized},
+		{"no issuer", claims(func(c jwt.MapClaims) { delete(c, "iss") }), http.StatusUnauthorized},
+		{"no expiration", claims(func(c jwt.MapClaims) { delete(c, "exp") }), http.StatusUnauthorized},
+		{"expired within the clock skew", claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-10 * time.Second).Unix() }), http.StatusNoContent},
+		{"expired", claims(func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() }), http.StatusUnauthorized},
+		{"issued within the clock skew", claims(func(c jwt.MapClaims) { c["iat"] = now.Add(10 * time.Second).Unix() }), http.StatusNoContent},
+		{"issued in the future", claims(func(c jwt.MapClaims) { c["iat"] = now.Add(time.Minute).Unix() }), http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte("claims-secret"))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		if tc.expected == http.StatusUnauthorized {
+			assert.Contains(t, resp.Body.String(), "Invalid token", tc.name)
+		}
+	}
+}
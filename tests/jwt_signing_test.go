@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// writeKeyPair writes the PKCS #8 private key and the PKIX public key of a key pair to temporary files
+// and points the JWT key variables to them.
+func writeKeyPair(t *testing.T, key crypto.Signer) {
+	dir := t.TempDir()
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	privatePath, publicPath := filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}), 0o600))
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0o600))
+	t.Setenv("JWT_PRIVATE_KEY_PATH", privatePath)
+	t.Setenv("JWT_PUBLIC_KEY_PATH", publicPath)
+}
+
+func TestJWTSigningMethods(t *testing.T) {
+	t.Cleanup(auth.LoadEnv)
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_PREVIOUS_PUBLIC_KEY_PATHS", "")
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for alg, tc := range map[string]struct {
+		key crypto.Signer
+		kty string
+		crv string
+	}{
+		"ES256": {ecKey, "EC", "P-256"},
+		"EdDSA": {edKey, "OKP", "Ed25519"},
+	} {
+		t.Run(alg, func(t *testing.T) {
+			t.Setenv("JWT_ALGORITHM", alg)
+			writeKeyPair(t, tc.key)
+
+			// The token is signed with the key of the algorithm and names it
+			tokenStr, err := auth.GenerateJWTToken(user.User{ID: 2, UserName: "john", UserType: user.UserAccount})
+			require.NoError(t, err)
+			token, err := auth.ParseJWTToken(tokenStr)
+			require.NoError(t, err)
+			assert.Equal(t, alg, token.Header["alg"])
+			assert.Equal(t, util.PublicKeyID(tc.key.Public()), token.Header["kid"])
+
+			// The key is published with its curve
+			set, err := auth.GetJWKS()
+			require.NoError(t, err)
+			require.Len(t, set.Keys, 1)
+			assert.Equal(t, tc.kty, set.Keys[0].Kty)
+			assert.Equal(t, tc.crv, set.Keys[0].Crv)
+			assert.Equal(t, alg, set.Keys[0].Alg)
+			assert.Equal(t, token.Header["kid"], set.Keys[0].Kid)
+			assert.Empty(t, set.Keys[0].N)
+
+			// The middleware validates the token with the same keys
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) { c.Status(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenStr)
+			resp := httptest.NewRecorder()
+			r.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code)
+		})
+	}
+}
+
+func TestJWTSigningKeyMismatch(t *testing.T) {
+	t.Cleanup(auth.LoadEnv)
+
+	// ES256 signs with the P-256 curve only
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	writeKeyPair(t, p384)
+	t.Setenv("JWT_ALGORITHM", "ES256")
+	_, err = auth.GenerateJWTToken(user.User{ID: 2, UserName: "john"})
+	assert.ErrorContains(t, err, "P-256")
+
+	// The key files must hold keys of the configured algorithm
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKeyPair(t, edKey)
+	_, err = auth.GetJWKS()
+	assert.Error(t, err)
+	_, err = util.LoadSigningKey("HS256")
+	assert.ErrorIs(t, err, util.ErrUnsupportedKeyAlgorithm)
+}
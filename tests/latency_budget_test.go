@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loadtest"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/headers"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/logging"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/slo"
+)
+
+func TestSetBudgets(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, slo.SetBudgets(slo.Budgets{})) })
+
+	require.NoError(t, slo.SetBudgets(slo.Budgets{Routes: map[string]string{"GET /api/v1/departments/:id": "100ms"}}))
+	budget, ok := slo.Budget("GET /api/v1/departments/:id")
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, budget)
+
+	// Without a default budget the other routes are not checked
+	_, ok = slo.Budget("GET /api/v1/users")
+	assert.False(t, ok)
+
+	require.NoError(t, slo.SetBudgets(slo.Budgets{Default: "1s"}))
+	budget, ok = slo.Budget("GET /api/v1/users")
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, budget)
+
+	for _, b := range []slo.Budgets{
+		{Routes: map[string]string{"/api/v1/departments": "100ms"}},
+		{Routes: map[string]string{"get /api/v1/departments": "100ms"}},
+		{Routes: map[string]string{"GET /api/v1/departments": "fast"}},
+		{Routes: map[string]string{"GET /api/v1/departments": "0s"}},
+		{Default: "-1s"},
+	} {
+		assert.Error(t, slo.SetBudgets(b), b)
+	}
+}
+
+func TestLatencyBudget(t *testing.T) {
+	slo.Init()
+	require.NoError(t, slo.SetBudgets(slo.Budgets{Routes: map[string]string{
+		"GET /slo/fast/:id":    "1s",
+		"GET /slo/slow/:id":    "10ms",
+		"GET /slo/error":       "10ms",
+		"DELETE /slo/slow/:id": "10ms",
+	}}))
+	previousTraceURL := slo.TraceURL
+	slo.TraceURL = "https://tracing.example.com/trace/{requestId}"
+	t.Cleanup(func() {
+		slo.TraceURL = previousTraceURL
+		require.NoError(t, slo.SetBudgets(slo.Budgets{}))
+	})
+	buf := captureLog(t, logrus.WarnLevel)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(headers.RequestIDHeader(), logging.LatencyBudget())
+	r.GET("/slo/fast/:id", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": c.Param("id")}) })
+	r.GET("/slo/slow/:id", func(c *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+	})
+	r.DELETE("/slo/slow/:id", func(c *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/slo/error", func(c *gin.Context) {
+		time.Sleep(20 * time.Millisecond)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+	})
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(method, path, nil))
+		return resp
+	}
+
+	resp := serve(http.MethodGet, "/slo/fast/1")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get(slo.HeaderExceeded))
+
+	// The budgets are looked up by route template, not by path
+	resp = serve(http.MethodGet, "/slo/slow/1")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "10ms", resp.Header().Get(slo.HeaderExceeded))
+	assert.Contains(t, buf.String(), "route=\"GET /slo/slow/:id\"")
+	assert.Contains(t, buf.String(), "trace=\"https://tracing.example.com/trace/"+resp.Header().Get("X-Request-Id")+"\"")
+
+	// The responses without a body are tagged as well
+	resp = serve(http.MethodDelete, "/slo/slow/1")
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "10ms", resp.Header().Get(slo.HeaderExceeded))
+
+	// The error responses are not part of the happy path
+	resp = serve(http.MethodGet, "/slo/error")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Empty(t, resp.Header().Get(slo.HeaderExceeded))
+
+	// The SLO burn is exposed in the metrics
+	scrape := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scrape.Body.String(), `slo_requests_total{route="GET /slo/fast/:id"} 1`)
+	assert.Contains(t, scrape.Body.String(), `slo_budget_exceeded_total{route="GET /slo/slow/:id"} 1`)
+	assert.NotContains(t, scrape.Body.String(), `route="GET /slo/error"`)
+}
+
+func TestLoadTestConfig(t *testing.T) {
+	t.Setenv("LOADTEST_USERNAME", "")
+	t.Setenv("LOADTEST_PASSWORD", "")
+
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		valid bool
+	}{
+		{"defaults", []string{"-username", "admin", "-password", "P@ssw0rd"}, true},
+		{"mixed scenario", []string{"-username", "admin", "-password", "P@ssw0rd", "-scenario", "mixed", "-rps", "50"}, true},
+		{"no credentials", nil, false},
+		{"no rate", []string{"-username", "admin", "-password", "P@ssw0rd", "-rps", "0"}, false},
+		{"unknown scenario", []string{"-username", "admin", "-password", "P@ssw0rd", "-scenario", "users"}, false},
+		{"unknown flag", []string{"-username", "admin", "-password", "P@ssw0rd", "-users", "10"}, false},
+	} {
+		cfg, err := loadtest.ParseConfig(tc.args)
+		if !tc.valid {
+			assert.Error(t, err, tc.name)
+			continue
+		}
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, 500*time.Millisecond, cfg.MaxP95, tc.name)
+		assert.Equal(t, time.Second, cfg.MaxP99, tc.name)
+		assert.Equal(t, 0.01, cfg.MaxErrorRate, tc.name)
+	}
+}
+
+func TestLoadTestReportSLOs(t *testing.T) {
+	cfg := loadtest.Config{MaxP95: 100 * time.Millisecond, MaxP99: 200 * time.Millisecond, MaxErrorRate: 0.05}
+
+	for _, tc := range []struct {
+		name         string
+		latency      time.Duration
+		status       int
+		slow         int
+		failed       int
+		countLimited bool
+		violations   int
+	}{
+		{"met", 10 * time.Millisecond, http.StatusOK, 0, 0, false, 0},
+		{"slow tail", 10 * time.Millisecond, http.StatusOK, 10, 0, false, 2},
+		{"server errors", 10 * time.Millisecond, http.StatusOK, 0, 10, false, 1},
+		{"rate limited ignored", 10 * time.Millisecond, http.StatusTooManyRequests, 0, 0, false, 0},
+		{"rate limited counted", 10 * time.Millisecond, http.StatusTooManyRequests, 0, 0, true, 1},
+	} {
+		report := loadtest.NewReport()
+		for i := 0; i < 90; i++ {
+			report.AddResult(tc.status, tc.latency)
+		}
+		for i := 0; i < tc.slow; i++ {
+			report.AddResult(http.StatusOK, time.Second)
+		}
+		for i := 0; i < tc.failed; i++ {
+			report.AddResult(http.StatusServiceUnavailable, tc.latency)
+		}
+		report.Finish()
+
+		cfg.CountLimited = tc.countLimited
+		assert.Len(t, report.CheckSLOs(cfg), tc.violations, tc.name)
+	}
+
+	// The dropped requests and the transport errors are failures too
+	report := loadtest.NewReport()
+	report.AddResult(http.StatusOK, time.Millisecond)
+	report.AddDropped()
+	report.AddError(errors.New("connection refused"))
+	report.Finish()
+	assert.Equal(t, 3, report.Total())
+	assert.Equal(t, 2, report.Failures(false))
+}
+
+func TestLoadTestRun(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		login    int
+		listing  int
+		exitCode int
+	}{
+		{"SLOs met", http.StatusOK, http.StatusOK, 0},
+		{"server errors", http.StatusOK, http.StatusInternalServerError, 1},
+		{"login refused", http.StatusUnauthorized, http.StatusOK, 2},
+	} {
+		// The API answers the login, the seeding and the department requests
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.URL.Path == "/auth/login":
+				w.WriteHeader(tc.login)
+				w.Write([]byte(`{"message":"Login successful","data":{"accessToken":"token","tokenType":"Bearer"}}`))
+			case r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"message":"Department created","data":{}}`))
+			case r.Header.Get("Authorization") != "Bearer token":
+				w.WriteHeader(http.StatusUnauthorized)
+			default:
+				w.WriteHeader(tc.listing)
+				w.Write([]byte(`{"data":[]}`))
+			}
+		}))
+
+		var out strings.Builder
+		code := loadtest.Run([]string{"-target", api.URL, "-username", "admin", "-password", "P@ssw0rd", "-rps", "50", "-duration", "200ms"}, &out)
+		api.Close()
+		assert.Equal(t, tc.exitCode, code, tc.name+": "+out.String())
+	}
+}
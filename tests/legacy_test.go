@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/legacy"
+)
+
+func TestMapLegacyDepartment(t *testing.T) {
+	createdBy := int64(1)
+	createdDate := time.Date(2019, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	// Map a padded legacy row that was never updated
+	d := legacy.MapDepartment(legacy.LegacyDepartment{
+		ID:          "d011",
+		DeptName:    "Legal   ",
+		Active:      true,
+		CreatedBy:   &createdBy,
+		CreatedDate: &createdDate,
+	})
+
+	assert.Equal(t, "d011", d.ID)
+	assert.Equal(t, "Legal", d.DeptName, "Expected the padded name to be trimmed")
+	assert.True(t, d.Active)
+	assert.Equal(t, department.StatusActive, d.Status)
+	assert.Equal(t, &createdDate, d.CreatedAt, "Expected created_date to become createdAt")
+	assert.Equal(t, &createdDate, d.UpdatedAt, "Expected updatedAt to default to the creation date")
+	assert.NotNil(t, d.Tags)
+	assert.NotNil(t, d.Metadata)
+}
+
+func TestParseLegacyConfig(t *testing.T) {
+	cfg, err := legacy.ParseConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, legacy.DefaultTable, cfg.Table)
+	assert.False(t, cfg.DryRun)
+
+	// The table name is not a bound parameter, so it must be a plain identifier
+	_, err = legacy.ParseConfig([]string{"-table", "department; DROP TABLE users"})
+	assert.Error(t, err)
+}
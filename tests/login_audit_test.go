@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+func TestGetLoginAttempts(t *testing.T) {
+	r, service := setupUserRouter()
+
+	cases := []struct {
+		path     string
+		expected int
+	}{
+		{"/api/v1/users/logins", http.StatusOK},
+		{"/api/v1/users/logins?success=false&userName=jane&ip=192.0.2.1&since=2024-06-01", http.StatusOK},
+		{"/api/v1/users/logins?success=maybe", http.StatusBadRequest},
+		{"/api/v1/users/logins?since=yesterday", http.StatusBadRequest},
+		{"/api/v1/users/2/logins", http.StatusOK},
+		{"/api/v1/users/9/logins", http.StatusNotFound},
+		{"/api/v1/users/x/logins", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.path)
+	}
+
+	// The filters are passed to the service, the listing of a user is restricted to its attempts
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/logins?success=false&userName=jane&ip=192.0.2.1&since=2024-06-01", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, service.loginFilter.Success)
+	assert.False(t, *service.loginFilter.Success)
+	assert.Equal(t, "jane", service.loginFilter.UserName)
+	assert.Equal(t, "192.0.2.1", service.loginFilter.IPAddress)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), *service.loginFilter.Since)
+	assert.Zero(t, service.loginFilter.UserID)
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/users/2/logins?limit=1", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, int64(2), service.loginFilter.UserID)
+
+	var body struct {
+		Data []user.LoginAttempt `json:"data"`
+		Meta struct {
+			NextCursor string `json:"nextCursor"`
+		} `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, "invalid password", body.Data[0].FailureReason)
+	assert.False(t, body.Data[0].Success)
+	assert.NotEmpty(t, body.Meta.NextCursor)
+}
+
+func TestLoginAttemptRecorded(t *testing.T) {
+	validator.InitValidator()
+
+	// The users cannot be read from the recording database, so the logins fail once the request is valid
+	db, _ := openRecordingDB(t)
+	ctx := metacontext.InjectRequestID(dbcontext.InjectDB(context.Background(), db), "3f1c2d4e-5a6b-4c7d-8e9f-0a1b2c3d4e5f")
+	users := &mockUserService{}
+	service := auth.NewAuthService(auth.WithUserService(users))
+	client := refreshtoken.Client{Device: "curl/8.5.0", IPAddress: "192.0.2.1"}
+
+	_, err := service.Login(ctx, auth.LoginRequest{UserName: "jane", Password: "P@ssw0rd123", Client: client})
+	require.Error(t, err)
+	_, err = service.Login(ctx, auth.LoginRequest{UserName: "jane", Client: client})
+	require.Error(t, err)
+
+	// Every attempt is recorded with its address, its user agent and its request ID
+	require.Len(t, users.attempts, 2)
+	for _, attempt := range users.attempts {
+		assert.Equal(t, "jane", attempt.UserName)
+		assert.Equal(t, user.LoginMethodPassword, attempt.Method)
+		assert.Equal(t, "192.0.2.1", attempt.IPAddress)
+		assert.Equal(t, "curl/8.5.0", attempt.UserAgent)
+		assert.Equal(t, "3f1c2d4e-5a6b-4c7d-8e9f-0a1b2c3d4e5f", attempt.RequestID)
+		assert.False(t, attempt.Success)
+		assert.Nil(t, attempt.UserID)
+		assert.NotEmpty(t, attempt.FailureReason)
+	}
+
+	// The validation errors are not detailed in the audit
+	assert.Equal(t, "invalid request", users.attempts[1].FailureReason)
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/loginthrottle"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+func TestLoginThrottleDelay(t *testing.T) {
+	t.Setenv("LOGIN_THROTTLE_MAX_FAILURES", "")
+	t.Setenv("LOGIN_THROTTLE_BASE_DELAY_SECONDS", "")
+	t.Setenv("LOGIN_THROTTLE_MAX_DELAY_MINUTES", "")
+	loginthrottle.LoadEnv()
+	t.Cleanup(loginthrottle.LoadEnv)
+
+	// The username is locked from the fifth failure, the lock doubles with each further failure up to its maximum
+	assert.Zero(t, loginthrottle.Delay(4))
+	assert.Equal(t, 30*time.Second, loginthrottle.Delay(5))
+	assert.Equal(t, time.Minute, loginthrottle.Delay(6))
+	assert.Equal(t, 8*time.Minute, loginthrottle.Delay(9))
+	assert.Equal(t, 15*time.Minute, loginthrottle.Delay(10))
+	assert.Equal(t, 15*time.Minute, loginthrottle.Delay(1000))
+
+	// The throttle is disabled with no failure allowed
+	t.Setenv("LOGIN_THROTTLE_MAX_FAILURES", "0")
+	loginthrottle.LoadEnv()
+	assert.False(t, loginthrottle.Enabled())
+	assert.Zero(t, loginthrottle.Delay(1000))
+}
+
+func TestLoginThrottle(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	ctx := context.Background()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// The failures below the threshold do not lock the username
+	for i := 0; i < loginthrottle.MaxFailures-1; i++ {
+		delay, err := loginthrottle.RecordFailure(ctx, client, "jane", now.Add(time.Duration(i)*time.Second))
+		require.NoError(t, err)
+		assert.Zero(t, delay)
+	}
+	wait, err := loginthrottle.Check(ctx, client, "jane")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// The next one locks it, whatever the case of the username
+	delay, err := loginthrottle.RecordFailure(ctx, client, "JANE", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, loginthrottle.BaseDelay, delay)
+	wait, err = loginthrottle.Check(ctx, client, "Jane")
+	require.NoError(t, err)
+	assert.Equal(t, loginthrottle.BaseDelay, wait)
+
+	// The failures older than the window are dropped
+	delay, err = loginthrottle.RecordFailure(ctx, client, "jane", now.Add(loginthrottle.Window+30*time.Second))
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	// A successful login clears the failures and the lock
+	require.NoError(t, loginthrottle.Reset(ctx, client, "jane"))
+	wait, err = loginthrottle.Check(ctx, client, "jane")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLoginThrottled(t *testing.T) {
+	validator.InitValidator()
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	db, pool := openRecordingDB(t)
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+
+	for i := 0; i < loginthrottle.MaxFailures; i++ {
+		_, err := loginthrottle.RecordFailure(ctx, client, "jane", time.Now())
+		require.NoError(t, err)
+	}
+
+	// The attempts on a locked username are refused before the user is looked up, from any address
+	users := &mockUserService{}
+	service := auth.NewAuthService(auth.WithUserService(users))
+	_, err := service.Login(ctx, auth.LoginRequest{UserName: "jane", Password: "P@ssw0rd123", Client: refreshtoken.Client{IPAddress: "198.51.100.23"}})
+	var throttled *loginthrottle.ThrottledError
+	require.ErrorAs(t, err, &throttled)
+	assert.ErrorIs(t, err, loginthrottle.ErrLoginThrottled)
+	assert.Equal(t, loginthrottle.BaseDelay, throttled.RetryAfter)
+	assert.Empty(t, pool.statements)
+
+	// The refused attempt is recorded in the login audit
+	require.Len(t, users.attempts, 1)
+	assert.Equal(t, loginthrottle.ErrLoginThrottled.Error(), users.attempts[0].FailureReason)
+
+	// The handler answers 429 and when to try again
+	r := SetupAuthRouter()
+	req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"username":"locked","password":"P@ssw0rd123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("Retry-After"))
+	assert.Contains(t, resp.Body.String(), `"code":"LoginThrottled"`)
+}
+
+func TestLoginThrottleUnknownUserName(t *testing.T) {
+	validator.InitValidator()
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	db, _ := openRecordingDB(t)
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+
+	// The fake database has no user
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+		tx.AddError(gorm.ErrRecordNotFound)
+	}))
+
+	// The logins of an unknown username are refused like the wrong passwords, and counted as failures
+	service := auth.NewAuthService(auth.WithUserService(&mockUserService{}))
+	login := auth.LoginRequest{UserName: "nobody", Password: "P@ssw0rd123", Client: refreshtoken.Client{IPAddress: "198.51.100.23"}}
+	for i := 0; i < loginthrottle.MaxFailures; i++ {
+		_, err := service.Login(ctx, login)
+		require.ErrorIs(t, err, user.ErrUserNameNotFound)
+	}
+
+	// The username is then locked, like an existing one
+	_, err := service.Login(ctx, login)
+	var throttled *loginthrottle.ThrottledError
+	require.ErrorAs(t, err, &throttled)
+	assert.Equal(t, loginthrottle.BaseDelay, throttled.RetryAfter)
+}
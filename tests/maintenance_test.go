@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/admin"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/availability"
+)
+
+// SetupMaintenanceRouter sets up a router whose routes are refused in maintenance mode, and the admin state route.
+func SetupMaintenanceRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	v1 := r.Group("/api/v1", availability.ReadOnlyMode())
+	v1.GET("/departments", ok)
+	v1.POST("/departments", ok)
+	v1.DELETE("/departments/:id", ok)
+
+	r.GET("/admin/maintenance", admin.NewAdminHandler(admin.NewAdminService()).GetMaintenance)
+
+	return r
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	r := SetupMaintenanceRouter()
+	defer maintenance.Set(maintenance.State{})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The mutating requests go through until the mode is enabled
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/v1/departments").Code)
+
+	maintenance.Set(maintenance.State{Enabled: true, Message: "Database failover in progress"})
+
+	// The reads keep working
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/api/v1/departments").Code)
+
+	// The writes are refused with the maintenance message
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		path := "/api/v1/departments"
+		if method == http.MethodDelete {
+			path += "/d001"
+		}
+		resp := serve(method, path)
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "Unexpected status code for "+method)
+		assert.Equal(t, "60", resp.Header().Get("Retry-After"))
+		assert.Contains(t, resp.Body.String(), `"code":"MaintenanceMode"`)
+		assert.Contains(t, resp.Body.String(), "Database failover in progress")
+	}
+
+	// The admin endpoint reports the mode
+	resp := serve(http.MethodGet, "/admin/maintenance")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"enabled":true`)
+
+	// Without a message, the default one is used
+	maintenance.Set(maintenance.State{Enabled: true})
+	assert.Contains(t, serve(http.MethodPost, "/api/v1/departments").Body.String(), maintenance.DefaultMessage)
+
+	maintenance.Set(maintenance.State{})
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/api/v1/departments").Code)
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+)
+
+// recordingMiddleware appends its name to the order when it runs.
+func recordingMiddleware(name string, order *[]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		*order = append(*order, name)
+		c.Next()
+	}
+}
+
+// SetupChainRouter initializes a router with a compression middleware in the chain,
+// a buffering middleware on the API group and a streaming group opting out of both.
+func SetupChainRouter(order *[]string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	ch := chain.New(
+		chain.Middleware{Name: "gzip", Stage: chain.StageCompression, Feature: chain.Compression, Handler: gzip.Gzip(gzip.DefaultCompression)},
+		chain.Middleware{Name: "logger", Stage: chain.StageLogging, Handler: recordingMiddleware("logger", order)},
+		chain.Middleware{Name: "context", Stage: chain.StageContext, Handler: recordingMiddleware("context", order)},
+	)
+	ch.Apply(r)
+
+	buffered := func(c *gin.Context) {
+		c.Header("X-Buffered", "true")
+		c.Next()
+	}
+	api := r.Group("/api", ch.Skippable(chain.Buffering, buffered))
+	api.GET("/departments", func(c *gin.Context) {
+		c.String(http.StatusOK, "departments")
+	})
+
+	events := api.Group("/events")
+	ch.OptOut(events, chain.Streaming...)
+	events.GET("", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+		_, _ = c.Writer.WriteString("data: hello\n\n")
+		c.Writer.Flush()
+	})
+
+	return r
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var order []string
+	r := SetupChainRouter(&order)
+
+	// The middlewares run by stage, whatever the order they were added in
+	req := httptest.NewRequest(http.MethodGet, "/api/departments", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, []string{"context", "logger"}, order)
+
+	names := []string{}
+	ch := chain.New(
+		chain.Middleware{Name: "gzip", Stage: chain.StageCompression},
+		chain.Middleware{Name: "request-id", Stage: chain.StageHeaders},
+		chain.Middleware{Name: "cors", Stage: chain.StageHeaders},
+		chain.Middleware{Name: "postgres", Stage: chain.StageContext},
+	)
+	for _, m := range ch.Middlewares() {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"postgres", "request-id", "cors", "gzip"}, names)
+}
+
+func TestMiddlewareChainStreamingOptOut(t *testing.T) {
+	var order []string
+	r := SetupChainRouter(&order)
+
+	// The regular routes are compressed and buffered
+	req := httptest.NewRequest(http.MethodGet, "/api/departments", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "true", w.Header().Get("X-Buffered"))
+
+	// The streaming routes bypass both and are flushed as they are written
+	req = httptest.NewRequest(http.MethodGet, "/api/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Empty(t, w.Header().Get("X-Buffered"))
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "data: hello\n\n", w.Body.String())
+
+	// The opt-outs only apply to the group and its sub-routes
+	ch := chain.New()
+	ch.OptOut(r.Group("/api/events"), chain.Compression)
+	assert.True(t, ch.OptedOut("/api/events/:id", chain.Compression))
+	assert.False(t, ch.OptedOut("/api/events-archive", chain.Compression))
+	assert.False(t, ch.OptedOut("/api/events", chain.Buffering))
+}
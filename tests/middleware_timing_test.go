@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/metrics"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/chain"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/timing"
+)
+
+// SetupTimingRouter initializes a router whose chain has a slow middleware and gzip, and whose route is guarded by RBAC.
+// The handler is slower than the slow middleware, so a middleware measured with it would stand out.
+func SetupTimingRouter() *gin.Engine {
+	r := gin.New()
+
+	ch := chain.New(
+		chain.Middleware{Name: "slow", Stage: chain.StageContext, Handler: func(c *gin.Context) {
+			time.Sleep(20 * time.Millisecond)
+			ctx := metacontext.InjectRequestMeta(c.Request.Context(), metacontext.RequestMeta{UserID: 1, Roles: []string{"ROLE_ADMIN"}})
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+		}},
+		chain.Middleware{Name: "gzip", Stage: chain.StageCompression, Feature: chain.Compression, Handler: gzip.Gzip(gzip.DefaultCompression)},
+	)
+	ch.Apply(r)
+
+	r.GET("/timing", authorization.RoleBasedAccessControl("ROLE_ADMIN"), func(c *gin.Context) {
+		time.Sleep(60 * time.Millisecond)
+		c.String(http.StatusOK, strings.Repeat("department ", 1000))
+	})
+	r.GET("/timing/denied", authorization.RoleBasedAccessControl("ROLE_AUDITOR"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return r
+}
+
+// middlewareCount returns the number of times the middleware was measured, as exposed in the metrics.
+func middlewareCount(t *testing.T, name string) int {
+	scrape := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	prefix := `http_middleware_duration_seconds_count{middleware="` + name + `"} `
+	for _, line := range strings.Split(scrape.Body.String(), "\n") {
+		if count, ok := strings.CutPrefix(line, prefix); ok {
+			n, err := strconv.Atoi(count)
+			require.NoError(t, err)
+			return n
+		}
+	}
+	return 0
+}
+
+// parseServerTiming returns the durations of the Server-Timing header by name.
+func parseServerTiming(t *testing.T, header string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, entry := range strings.Split(header, ", ") {
+		name, dur, ok := strings.Cut(entry, ";dur=")
+		require.True(t, ok, entry)
+		ms, err := strconv.ParseFloat(dur, 64)
+		require.NoError(t, err, entry)
+		durations[name] = time.Duration(ms * float64(time.Millisecond))
+	}
+	return durations
+}
+
+func TestMiddlewareTiming(t *testing.T) {
+	timing.Init()
+	previous := timing.ServerTiming
+	timing.ServerTiming = "TRUE"
+	gin.SetMode(gin.DebugMode)
+	t.Cleanup(func() {
+		timing.ServerTiming = previous
+		gin.SetMode(gin.TestMode)
+	})
+	r := SetupTimingRouter()
+	slowCount, rbacCount := middlewareCount(t, "slow"), middlewareCount(t, "rbac")
+
+	// Each middleware reports its own time, without the time of the next handlers
+	req := httptest.NewRequest(http.MethodGet, "/timing", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+
+	durations := parseServerTiming(t, resp.Header().Get(timing.HeaderServerTiming))
+	assert.GreaterOrEqual(t, durations["slow"], 20*time.Millisecond)
+	assert.Less(t, durations["slow"], 60*time.Millisecond)
+	assert.Contains(t, durations, "gzip")
+	assert.Less(t, durations["rbac"], 60*time.Millisecond)
+
+	// The requests aborted by a middleware are measured too, after their response headers are sent
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/timing/denied", nil))
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.NotContains(t, parseServerTiming(t, resp.Header().Get(timing.HeaderServerTiming)), "rbac")
+
+	// The times are observed in the metrics once the request is handled
+	assert.Equal(t, slowCount+2, middlewareCount(t, "slow"))
+	assert.Equal(t, rbacCount+2, middlewareCount(t, "rbac"))
+	assert.Positive(t, middlewareCount(t, "gzip"))
+}
+
+func TestMiddlewareTimingHeaderDisabled(t *testing.T) {
+	previous := timing.ServerTiming
+	timing.ServerTiming = "TRUE"
+	gin.SetMode(gin.ReleaseMode)
+	t.Cleanup(func() {
+		timing.ServerTiming = previous
+		gin.SetMode(gin.TestMode)
+	})
+	r := SetupTimingRouter()
+
+	// The header is only returned in debug mode, the metrics are always observed
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/timing/denied", nil))
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Empty(t, resp.Header().Get(timing.HeaderServerTiming))
+
+	// The middlewares of the requests that are not tracked record nothing
+	stop := timing.Start(&gin.Context{}, "rbac")
+	stop()
+}
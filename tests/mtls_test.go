@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mtls"
+)
+
+// clientCertState returns the state of a TLS connection whose client certificate, with the given common name
+// and URI SANs, was verified by the handshake.
+func clientCertState(commonName string, uris ...string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		cert.URIs = append(cert.URIs, parsed)
+	}
+
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestClientCertAuthentication(t *testing.T) {
+	t.Cleanup(func() { mtls.SetServiceAccounts(nil) })
+	mtls.SetServiceAccounts([]mtls.ServiceAccount{
+		{
+			Name: "reporting-service", UserID: 1, Email: "reporting-service@internal", Roles: []string{"ROLE_USER"},
+			CommonNames: []string{"reporting-service"}, SANs: []string{"spiffe://internal/reporting-service"},
+		},
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", authorization.ClientCertAuthentication(), func(c *gin.Context) {
+		meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"user": meta.UserName, "userId": meta.UserID, "roles": meta.Roles, "permissions": meta.Permissions, "automation": meta.Automation})
+	})
+	get := func(state *tls.ConnectionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.TLS = state
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The requests without a verified client certificate are not authenticated
+	resp := get(nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), "No client certificate provided")
+	assert.Equal(t, http.StatusUnauthorized, get(&tls.ConnectionState{}).Code)
+
+	// A certificate mapped to no service account is refused
+	resp = get(clientCertState("unknown-service", "spiffe://internal/unknown-service"))
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Unknown client certificate")
+
+	// The service account is matched by the common name or a SAN, its roles are set in the context
+	expected := `{"user":"reporting-service","userId":1,"roles":["ROLE_USER"],"permissions":["departments:read"],"automation":true}`
+	for name, state := range map[string]*tls.ConnectionState{
+		"common name": clientCertState("reporting-service"),
+		"SAN":         clientCertState("", "spiffe://internal/reporting-service"),
+	} {
+		resp := get(state)
+		require.Equal(t, http.StatusOK, resp.Code, name)
+		assert.JSONEq(t, expected, resp.Body.String(), name)
+	}
+}
@@ -0,0 +1,378 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/oidc"
+	"gorm.io/gorm"
+)
+
+// fakeOIDCProvider is an OpenID Connect provider serving its discovery document, its key set and a token endpoint.
+// The token endpoint only accepts the code "good-code" with the verifier of the expected challenge,
+// and returns an ID token of the subject with the nonce.
+type fakeOIDCProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	subject   string
+}
+
+func startFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &fakeOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "key-1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" || oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken(t, p.claims())})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// claims returns the claims of a valid ID token of the subject, for the client "api-client".
+func (p *fakeOIDCProvider) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            "api-client",
+		"sub":            p.subject,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          p.nonce,
+		"email":          "jane.doe@example.com",
+		"email_verified": true,
+	}
+}
+
+// idToken signs the claims with the key of the provider.
+func (p *fakeOIDCProvider) idToken(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(p.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestOIDCHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := auth.NewAuthHandler(&mockAuthService{})
+	r := gin.New()
+	r.GET("/auth/oidc/:provider", handler.OIDCLogin)
+	r.GET("/auth/oidc/:provider/callback", handler.OIDCCallback)
+
+	// The login redirects to the provider
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/google", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusFound, resp.Code)
+	assert.Equal(t, "https://accounts.example.com/authorize?state=valid-state", resp.Header().Get("Location"))
+
+	cases := []struct {
+		name     string
+		path     string
+		expected int
+		body     string
+	}{
+		{"unknown provider", "/auth/oidc/github", http.StatusNotFound, "OIDCProviderNotFound"},
+		{"successful login", "/auth/oidc/google/callback?code=good-code&state=valid-state", http.StatusOK, "oidc-token"},
+		{"invalid state", "/auth/oidc/google/callback?code=good-code&state=forged", http.StatusBadRequest, "InvalidOIDCState"},
+		{"identity without user", "/auth/oidc/google/callback?code=unlinked&state=valid-state", http.StatusForbidden, "ExternalIdentityNotLinked"},
+		{"login cancelled", "/auth/oidc/google/callback?error=access_denied&state=valid-state", http.StatusUnauthorized, "access_denied"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		assert.Contains(t, resp.Body.String(), tc.body, tc.name)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := startFakeOIDCProvider(t)
+	t.Setenv("OIDC_REDIRECT_BASE_URL", "https://api.example.com/")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "api-client")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "api-secret")
+	t.Setenv("OIDC_GOOGLE_ISSUER", provider.server.URL)
+	t.Setenv("OIDC_MICROSOFT_CLIENT_ID", "")
+	t.Setenv("OIDC_AUTO_PROVISION", "")
+
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	ctx := dbcontext.InjectRedisClient(context.Background(), client)
+	users := &mockUserService{}
+	service := auth.NewAuthService(auth.WithUserService(users))
+
+	// Only the configured providers are known
+	for _, name := range []string{"github", oidc.Microsoft} {
+		_, err := service.OIDCAuthorizationURL(ctx, name)
+		assert.ErrorIs(t, err, auth.ErrOIDCProviderNotFound, name)
+	}
+
+	// login starts a login and plays the provider authenticating the subject
+	login := func(subject string) string {
+		location, err := service.OIDCAuthorizationURL(ctx, oidc.Google)
+		require.NoError(t, err)
+		redirect, err := url.Parse(location)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(location, provider.server.URL+"/authorize?"))
+
+		query := redirect.Query()
+		assert.Equal(t, "code", query.Get("response_type"))
+		assert.Equal(t, "api-client", query.Get("client_id"))
+		assert.Equal(t, "https://api.example.com/auth/oidc/google/callback", query.Get("redirect_uri"))
+		assert.Equal(t, "openid email profile", query.Get("scope"))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+		assert.NotEmpty(t, query.Get("nonce"))
+
+		provider.challenge, provider.nonce, provider.subject = query.Get("code_challenge"), query.Get("nonce"), subject
+		return query.Get("state")
+	}
+
+	// The ID token is verified and its identity mapped to the local users, which do not know this one
+	state := login("unknown-subject")
+	_, err := service.OIDCCallback(ctx, auth.OIDCCallbackRequest{Provider: oidc.Google, Code: "good-code", State: state})
+	assert.ErrorIs(t, err, user.ErrIdentityNotLinked)
+
+	// The state is single-use
+	_, err = service.OIDCCallback(ctx, auth.OIDCCallbackRequest{Provider: oidc.Google, Code: "good-code", State: state})
+	assert.ErrorIs(t, err, auth.ErrInvalidOIDCState)
+
+	// A code refused by the provider and an ID token of another login fail the login
+	state = login("unknown-subject")
+	_, err = service.OIDCCallback(ctx, auth.OIDCCallbackRequest{Provider: oidc.Google, Code: "bad-code", State: state})
+	assert.ErrorIs(t, err, auth.ErrOIDCLoginFailed)
+
+	state = login("unknown-subject")
+	provider.nonce = "nonce-of-another-login"
+	_, err = service.OIDCCallback(ctx, auth.OIDCCallbackRequest{Provider: oidc.Google, Code: "good-code", State: state})
+	assert.ErrorIs(t, err, auth.ErrOIDCLoginFailed)
+	// The callbacks are recorded in the login audit, named after the identity once its ID token is verified
+	require.Len(t, users.attempts, 4)
+	assert.Equal(t, "google:unknown-subject", users.attempts[0].UserName)
+	assert.Equal(t, user.LoginMethodOIDC, users.attempts[0].Method)
+	assert.Equal(t, user.ErrIdentityNotLinked.Message, users.attempts[0].FailureReason)
+	assert.Empty(t, users.attempts[1].UserName)
+	assert.Equal(t, auth.ErrInvalidOIDCState.Message, users.attempts[1].FailureReason)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider := startFakeOIDCProvider(t)
+	provider.nonce, provider.subject = "login-nonce", "subject-1"
+	p := oidc.Provider{Name: oidc.Google, Issuer: provider.server.URL, ClientID: "api-client"}
+	ctx := context.Background()
+	meta, err := p.Discover(ctx)
+	require.NoError(t, err)
+
+	claims, err := p.VerifyIDToken(ctx, meta, provider.idToken(t, provider.claims()), "login-nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "subject-1", claims.Subject)
+	assert.Equal(t, "jane.doe@example.com", p.VerifiedEmail(claims))
+
+	cases := map[string]func(c jwt.MapClaims){
+		"other audience": func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"other issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiration":  func(c jwt.MapClaims) { delete(c, "exp") },
+		"other nonce":    func(c jwt.MapClaims) { c["nonce"] = "other-nonce" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, change := range cases {
+		c := provider.claims()
+		change(c)
+		_, err := p.VerifyIDToken(ctx, meta, provider.idToken(t, c), "login-nonce")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken, name)
+	}
+
+	// A token signed with another key is refused
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, provider.claims())
+	forged.Header["kid"] = "key-1"
+	signed, err := forged.SignedString(other)
+	require.NoError(t, err)
+	_, err = p.VerifyIDToken(ctx, meta, signed, "login-nonce")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+
+	// The issuer of the multi-tenant endpoints is completed with the tenant of the account
+	tenantMeta := meta
+	tenantMeta.Issuer = provider.server.URL + "/{tenantid}/v2.0"
+	c := provider.claims()
+	c["iss"], c["tid"] = provider.server.URL+"/tenant-1/v2.0", "tenant-1"
+	_, err = p.VerifyIDToken(ctx, tenantMeta, provider.idToken(t, c), "login-nonce")
+	assert.NoError(t, err)
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	verified, unverified := true, false
+	google := oidc.Provider{Name: oidc.Google}
+	singleTenant := oidc.Provider{Name: oidc.Microsoft, TrustEmail: true}
+
+	assert.Equal(t, "jane@example.com", google.VerifiedEmail(oidc.Claims{Email: "jane@example.com", EmailVerified: &verified}))
+	assert.Empty(t, google.VerifiedEmail(oidc.Claims{Email: "jane@example.com", EmailVerified: &unverified}))
+	assert.Empty(t, google.VerifiedEmail(oidc.Claims{Email: "jane@example.com"}))
+
+	// The e-mail of the single-tenant accounts is trusted without the claim, never against it
+	assert.Equal(t, "jane@example.com", singleTenant.VerifiedEmail(oidc.Claims{Email: "jane@example.com"}))
+	assert.Empty(t, singleTenant.VerifiedEmail(oidc.Claims{Email: "jane@example.com", EmailVerified: &unverified}))
+
+	// The multi-tenant endpoints accept any account, whose e-mail is not trusted
+	t.Setenv("OIDC_MICROSOFT_CLIENT_ID", "api-client")
+	t.Setenv("OIDC_MICROSOFT_TENANT", "")
+	common, ok := oidc.Lookup(oidc.Microsoft)
+	require.True(t, ok)
+	assert.False(t, common.TrustEmail)
+	assert.Equal(t, "https://login.microsoftonline.com/common/v2.0", common.Issuer)
+
+	t.Setenv("OIDC_MICROSOFT_TENANT", "contoso.onmicrosoft.com")
+	t.Setenv("OIDC_MICROSOFT_ISSUER", "")
+	tenant, ok := oidc.Lookup(oidc.Microsoft)
+	require.True(t, ok)
+	assert.True(t, tenant.TrustEmail)
+}
+
+func TestExternalUserName(t *testing.T) {
+	cases := map[string]string{
+		"Jane.Doe+news@Example.com":          `^jane.doenews_[0-9a-f]{4}$`,
+		"a.very.long.local.part@example.com": `^a.very.long.loc_[0-9a-f]{4}$`,
+		"@example.com":                       `^user_[0-9a-f]{4}$`,
+		"éléonore.dupont@example.com":        `^lonore.dupont_[0-9a-f]{4}$`,
+	}
+	for email, pattern := range cases {
+		name, err := user.ExternalUserName(email)
+		require.NoError(t, err)
+		assert.Regexp(t, pattern, name, email)
+	}
+}
+
+// identityRepository is a user repository with the users and the external identities of the tests.
+type identityRepository struct {
+	user.UserRepository
+	users      map[int64]user.User
+	identities []user.ExternalIdentity
+	touched    []int64
+	audited    []user.AuditEntry
+}
+
+func (r *identityRepository) GetExternalIdentity(tx *gorm.DB, provider string, subject string) (user.ExternalIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return user.ExternalIdentity{}, user.ErrIdentityNotFound
+}
+
+func (r *identityRepository) CreateExternalIdentity(ctx context.Context, tx *gorm.DB, identity user.ExternalIdentity) error {
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *identityRepository) TouchExternalIdentity(ctx context.Context, tx *gorm.DB, id int64, loginAt time.Time) error {
+	r.touched = append(r.touched, id)
+	return nil
+}
+
+func (r *identityRepository) GetUserByID(tx *gorm.DB, id int64) (user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *identityRepository) GetUserByEmail(tx *gorm.DB, email string) (user.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return user.User{}, user.ErrUserEmailNotFound
+}
+
+func (r *identityRepository) AddAuditEntry(ctx context.Context, tx *gorm.DB, entry user.AuditEntry) error {
+	r.audited = append(r.audited, entry)
+	return nil
+}
+
+func TestResolveExternalIdentity(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	repo := &identityRepository{users: map[int64]user.User{
+		1: {ID: 1, UserName: "jane", Email: "jane@example.com", UserType: user.UserAccount},
+		2: {ID: 2, UserName: "payroll", Email: "payroll@example.com", UserType: user.ServiceAccount},
+	}}
+	service := user.NewUserService(repo)
+
+	// A new identity is linked to the user with its e-mail, and its next logins do not need the e-mail
+	linked, err := service.ResolveExternalIdentity(ctx, user.ExternalLogin{Provider: oidc.Google, Subject: "subject-1", Email: "jane@example.com"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), linked.ID)
+	require.Len(t, repo.identities, 1)
+	assert.Equal(t, int64(1), repo.identities[0].UserID)
+	require.Len(t, repo.audited, 1)
+	assert.Equal(t, user.AuditIdentityLinked, repo.audited[0].Action)
+
+	linked, err = service.ResolveExternalIdentity(ctx, user.ExternalLogin{Provider: oidc.Google, Subject: "subject-1"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), linked.ID)
+	assert.Equal(t, []int64{1}, repo.touched)
+
+	// The same subject of another provider is another identity
+	_, err = service.ResolveExternalIdentity(ctx, user.ExternalLogin{Provider: oidc.Microsoft, Subject: "subject-1"}, false)
+	assert.ErrorIs(t, err, user.ErrIdentityUnverified)
+
+	// The unknown e-mails are not provisioned unless enabled, and the service accounts are never linked
+	_, err = service.ResolveExternalIdentity(ctx, user.ExternalLogin{Provider: oidc.Google, Subject: "subject-2", Email: "john@example.com"}, false)
+	assert.ErrorIs(t, err, user.ErrIdentityNotLinked)
+	_, err = service.ResolveExternalIdentity(ctx, user.ExternalLogin{Provider: oidc.Google, Subject: "subject-3", Email: "payroll@example.com"}, true)
+	assert.ErrorIs(t, err, user.ErrIdentityNotLinked)
+	assert.Len(t, repo.identities, 1)
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/fixture"
+	"github.com/yoanesber/Go-Department-CRUD/internal/schema"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsonschema"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/openapi"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+)
+
+func TestOpenAPISpecTypedErrors(t *testing.T) {
+	r := SetupRouter()
+	doc := routes.BuildOpenAPISpec(r)
+
+	// Convert the spec to JSON to inspect it as a client would
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal OpenAPI spec: %v", err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("Failed to unmarshal OpenAPI spec: %v", err)
+	}
+
+	// The conflicts of the department creation are documented under 409
+	conflict := string(spec.Paths["/api/v1/departments"]["post"].Responses["409"])
+	assert.Contains(t, conflict, "DepartmentConflictError")
+	assert.Contains(t, conflict, "DepartmentNameConflictError")
+
+	// The lookup by name documents its not found error, with the same status as the actual response
+	notFound := string(spec.Paths["/api/v1/departments/by-name/{name}"]["get"].Responses["404"])
+	assert.Contains(t, notFound, "#/components/responses/"+dept.ErrDepartmentNameNotFound.Code)
+	assert.Contains(t, spec.Components.Responses, dept.ErrDepartmentNameNotFound.Code)
+
+	req, _ := http.NewRequest("GET", "/api/v1/departments/by-name/Finance", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, dept.ErrDepartmentNameNotFound.Status, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"`+dept.ErrDepartmentNameNotFound.Code+`"`)
+}
+
+func TestOpenAPISpecExamples(t *testing.T) {
+	validator.InitValidator()
+	examples := fixture.Examples()
+
+	// The request examples pass the published JSON Schema and the validator of their DTO
+	for name, example := range examples {
+		if example.Request == nil {
+			continue
+		}
+		body, err := json.Marshal(example.Request)
+		require.NoError(t, err)
+		assert.Empty(t, jsonschema.ValidateJSON(schema.MustGetSchema(name), body), name)
+	}
+
+	var d dept.Department
+	require.NoError(t, json.Unmarshal(mustMarshal(t, examples["department"].Request), &d))
+	assert.NoError(t, d.Validate())
+	d = dept.Department{ID: fixture.SampleDepartment().ID}
+	require.NoError(t, json.Unmarshal(mustMarshal(t, examples["department-update"].Request), &d))
+	assert.NoError(t, d.Validate())
+	var u user.User
+	require.NoError(t, json.Unmarshal(mustMarshal(t, examples["user"].Request), &u))
+	assert.NoError(t, u.Validate())
+
+	// Every example named by an operation exists
+	for module, ops := range map[string]map[string]openapi.Operation{"auth": auth.Operations, "department": dept.Operations, "user": user.Operations} {
+		for name, op := range ops {
+			if op.Example != "" {
+				assert.Contains(t, examples, op.Example, module+"."+name)
+			}
+		}
+	}
+
+	// The spec shows the sample request and the sample data in the response envelope
+	data := mustMarshal(t, routes.BuildOpenAPISpec(SetupRouter()))
+	var spec struct {
+		Paths map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Example map[string]any `json:"example"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Example struct {
+						Status int            `json:"status"`
+						Data   map[string]any `json:"data"`
+					} `json:"example"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(data, &spec))
+
+	create := spec.Paths["/api/v1/departments"]["post"]
+	assert.Equal(t, "d001", create.RequestBody.Content["application/json"].Example["id"])
+	assert.NotContains(t, create.RequestBody.Content["application/json"].Example, "createdAt")
+	created := create.Responses["201"].Content["application/json"].Example
+	assert.Equal(t, http.StatusCreated, created.Status)
+	assert.Equal(t, "HR", created.Data["deptName"])
+
+	get := spec.Paths["/api/v1/departments/{id}"]["get"].Responses["200"].Content["application/json"].Example
+	assert.Equal(t, "d001", get.Data["id"])
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,418 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/outbox"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// fakeOutboxRepository keeps the outbox messages in memory.
+type fakeOutboxRepository struct {
+	outbox.OutboxRepository
+	messages []outbox.OutboxMessage
+}
+
+func (r *fakeOutboxRepository) GetPendingMessages(tx *gorm.DB, limit int, maxAttempts int) ([]outbox.OutboxMessage, error) {
+	var pending []outbox.OutboxMessage
+	for _, m := range r.messages {
+		if len(pending) < limit && m.PublishedAt == nil && m.Attempts < maxAttempts {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func (r *fakeOutboxRepository) SaveAttempt(ctx context.Context, tx *gorm.DB, m outbox.OutboxMessage) error {
+	for i := range r.messages {
+		if r.messages[i].ID == m.ID {
+			attempts := r.messages[i].Attempts + 1
+			r.messages[i] = m
+			r.messages[i].Attempts = attempts
+		}
+	}
+	return nil
+}
+
+// flakyPublisher is a broker refusing the first events, then recording them.
+type flakyPublisher struct {
+	mu        sync.Mutex
+	failures  int
+	calls     int
+	published []event.Event
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, e event.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, e)
+	return nil
+}
+
+func (p *flakyPublisher) Close() error { return nil }
+
+// useOutboxSinks sets the broker and the webhook repository the outbox forwards the events to,
+// and returns the number of times the webhook deliveries were queued.
+func useOutboxSinks(t *testing.T, publisher event.Publisher, webhooks *fakeWebhookRepository, sinkErr *error) *int {
+	t.Setenv("EVENT_PUBLISHER", "")
+	t.Cleanup(func() {
+		event.LoadEnv()
+		event.InitPublisher()
+		outbox.SetWebhookSink(nil, nil)
+	})
+
+	var queued int
+	event.SetPublisher(publisher)
+	outbox.SetWebhookSink(func(ctx context.Context, tx *gorm.DB, e event.Event) error {
+		queued++
+		if sinkErr != nil && *sinkErr != nil {
+			return *sinkErr
+		}
+		return webhook.QueueDeliveries(ctx, tx, webhooks, e)
+	}, nil)
+
+	return &queued
+}
+
+func outboxMessage(t *testing.T, id int64, e event.Event) outbox.OutboxMessage {
+	m, err := outbox.NewOutboxMessage(e)
+	require.NoError(t, err)
+	m.ID = id
+	return m
+}
+
+func TestOutboxCommitThenDispatch(t *testing.T) {
+	db, pool := openRecordingDB(t)
+	repo := &fakeOutboxRepository{}
+	publisher := &flakyPublisher{}
+	webhooks := newFakeWebhookRepository(webhook.Webhook{ID: 1, URL: "https://hooks.example.com", Events: webhook.EventTypes{event.DepartmentCreated}, Active: true})
+	useOutboxSinks(t, publisher, webhooks, nil)
+
+	// The fake database keeps the written messages
+	require.NoError(t, db.Callback().Create().After("gorm:create").Register("test:outbox", func(tx *gorm.DB) {
+		if m, ok := tx.Statement.Dest.(*outbox.OutboxMessage); ok {
+			m.ID = int64(len(repo.messages) + 1)
+			repo.messages = append(repo.messages, *m)
+		}
+	}))
+
+	// The event is written with the transaction of the mutation, and forwarded to no sink before the dispatcher runs
+	e := event.NewEvent(event.DepartmentCreated, "D001", map[string]string{"id": "D001"})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, tx.Exec(`UPDATE "department" SET "dept_name" = 'Finance'`).Error)
+		return outbox.Add(context.Background(), tx.Session(&gorm.Session{DryRun: true}), e)
+	})
+	require.NoError(t, err)
+	assert.Contains(t, pool.statements, `UPDATE "department" SET "dept_name" = 'Finance'`)
+	require.Len(t, repo.messages, 1)
+	assert.Empty(t, publisher.published)
+	assert.Empty(t, webhooks.deliveries)
+
+	// Once committed, the dispatcher forwards it to every sink and marks it published
+	n, err := outbox.NewDispatcher(db, repo).DispatchBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, publisher.published, 1)
+	assert.Equal(t, e.ID, publisher.published[0].ID)
+	require.Len(t, webhooks.deliveries, 1)
+	assert.Equal(t, e.ID, webhooks.deliveries[0].EventID)
+
+	m := repo.messages[0]
+	assert.NotNil(t, m.PublishedAt)
+	assert.NotNil(t, m.BrokerPublishedAt)
+	assert.NotNil(t, m.WebhooksQueuedAt)
+	assert.Equal(t, 1, m.Attempts)
+}
+
+func TestOutboxRetryAfterBrokerFailure(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	e := event.NewEvent(event.DepartmentUpdated, "D001", map[string]string{"id": "D001"})
+	repo := &fakeOutboxRepository{messages: []outbox.OutboxMessage{outboxMessage(t, 1, e)}}
+	publisher := &flakyPublisher{failures: 2}
+	webhooks := newFakeWebhookRepository(webhook.Webhook{ID: 1, URL: "https://hooks.example.com", Events: webhook.EventTypes{event.DepartmentUpdated}, Active: true})
+	queued := useOutboxSinks(t, publisher, webhooks, nil)
+	d := outbox.NewDispatcher(db, repo)
+
+	// The webhook deliveries are queued even though the broker fails, the message stays pending
+	n, err := d.DispatchBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	m := repo.messages[0]
+	assert.Nil(t, m.PublishedAt)
+	assert.Nil(t, m.BrokerPublishedAt)
+	assert.NotNil(t, m.WebhooksQueuedAt)
+	require.NotNil(t, m.LastError)
+	assert.Contains(t, *m.LastError, "broker unavailable")
+	assert.Len(t, webhooks.deliveries, 1)
+
+	// The retries only publish to the broker, the webhook deliveries are not queued again
+	for attempt := 2; attempt <= 3; attempt++ {
+		n, err = d.DispatchBatch()
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+
+	m = repo.messages[0]
+	assert.NotNil(t, m.PublishedAt)
+	assert.NotNil(t, m.BrokerPublishedAt)
+	assert.Nil(t, m.LastError)
+	assert.Equal(t, 3, m.Attempts)
+	assert.Equal(t, 3, publisher.calls)
+	assert.Len(t, publisher.published, 1)
+	assert.Equal(t, 1, *queued)
+	assert.Len(t, webhooks.deliveries, 1)
+
+	// The published message is not forwarded again
+	n, err = d.DispatchBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxRetryAfterWebhookFailure(t *testing.T) {
+	db, pool := openRecordingDB(t)
+	e := event.NewEvent(event.DepartmentDeleted, "D001", nil)
+	repo := &fakeOutboxRepository{messages: []outbox.OutboxMessage{outboxMessage(t, 1, e)}}
+	publisher := &flakyPublisher{}
+	webhooks := newFakeWebhookRepository(webhook.Webhook{ID: 1, URL: "https://hooks.example.com", Events: webhook.EventTypes{event.DepartmentDeleted}, Active: true})
+	sinkErr := errors.New("deadlock detected")
+	queued := useOutboxSinks(t, publisher, webhooks, &sinkErr)
+	d := outbox.NewDispatcher(db, repo)
+
+	// The failed queuing is rolled back to its savepoint, the broker still receives the event
+	n, err := d.DispatchBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, pool.statements, 2)
+	assert.True(t, strings.HasPrefix(pool.statements[0], "SAVEPOINT "))
+	assert.True(t, strings.HasPrefix(pool.statements[1], "ROLLBACK TO SAVEPOINT "))
+
+	m := repo.messages[0]
+	assert.Nil(t, m.PublishedAt)
+	assert.NotNil(t, m.BrokerPublishedAt)
+	assert.Nil(t, m.WebhooksQueuedAt)
+	require.NotNil(t, m.LastError)
+	assert.Contains(t, *m.LastError, "deadlock detected")
+
+	// The retry only queues the webhook deliveries, the broker does not receive the event twice
+	sinkErr = nil
+	n, err = d.DispatchBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	m = repo.messages[0]
+	assert.NotNil(t, m.PublishedAt)
+	assert.NotNil(t, m.WebhooksQueuedAt)
+	assert.Equal(t, 2, *queued)
+	assert.Len(t, publisher.published, 1)
+	assert.Len(t, webhooks.deliveries, 1)
+}
+
+// eventRepository is a department repository holding departments in memory, which also creates and updates them.
+type eventRepository struct {
+	bulkDeleteRepository
+}
+
+func (r *eventRepository) GetDepartmentByID(tx *gorm.DB, id string) (dept.Department, error) {
+	d, ok := r.departments[id]
+	if !ok {
+		return dept.Department{}, dept.ErrDepartmentNotFound
+	}
+	return d, nil
+}
+
+func (r *eventRepository) GetDepartmentByName(tx *gorm.DB, name string) (dept.Department, error) {
+	for _, d := range r.departments {
+		if strings.EqualFold(d.DeptName, name) {
+			return d, nil
+		}
+	}
+	return dept.Department{}, dept.ErrDepartmentNotFound
+}
+
+func (r *eventRepository) CountDepartments(tx *gorm.DB, filter dept.DepartmentFilter) (int64, error) {
+	return int64(len(r.departments)), nil
+}
+
+func (r *eventRepository) GetDepartmentsByIDsForUpdate(tx *gorm.DB, ids []string) ([]dept.Department, error) {
+	return nil, nil
+}
+
+func (r *eventRepository) CreateDepartment(ctx context.Context, tx *gorm.DB, d dept.Department) (dept.Department, error) {
+	r.departments[d.ID] = d
+	return d, nil
+}
+
+func (r *eventRepository) UpdateDepartment(ctx context.Context, tx *gorm.DB, d dept.Department) (dept.Department, error) {
+	r.departments[d.ID] = d
+	return d, nil
+}
+
+func (r *eventRepository) CreateDepartmentVersion(ctx context.Context, tx *gorm.DB, v dept.DepartmentVersion) error {
+	return nil
+}
+
+func TestDepartmentEvents(t *testing.T) {
+	validator.InitValidator()
+	db, _ := openRecordingDB(t)
+	bus := &recordingBus{}
+	repo := &eventRepository{bulkDeleteRepository{departments: map[string]dept.Department{}}}
+	service := dept.NewDepartmentService(repo, dept.WithEventBus(bus))
+	ctx := dbcontext.InjectDB(context.Background(), db)
+	ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+	// Each change of a department writes its domain event, keyed by the department so its events keep their order
+	for _, tc := range []struct {
+		name      string
+		change    func() error
+		eventType string
+	}{
+		{"create", func() error {
+			_, err := service.CreateDepartment(ctx, dept.Department{ID: "D010", DeptName: "Research", Active: true})
+			return err
+		}, event.DepartmentCreated},
+		{"update", func() error {
+			_, err := service.UpdateDepartment(ctx, "D010", dept.Department{ID: "D010", DeptName: "Research and Development", Active: true})
+			return err
+		}, event.DepartmentUpdated},
+		{"delete", func() error {
+			_, err := service.DeleteDepartment(ctx, "D010", false)
+			return err
+		}, event.DepartmentDeleted},
+	} {
+		bus.events = nil
+		require.NoError(t, tc.change(), tc.name)
+		require.Len(t, bus.events, 1, tc.name)
+		assert.Equal(t, tc.eventType, bus.events[0].Type, tc.name)
+		assert.Equal(t, "D010", bus.events[0].Subject, tc.name)
+		assert.NotEmpty(t, bus.events[0].ID, tc.name)
+	}
+
+	// A failed change writes no event
+	bus.events = nil
+	_, err := service.UpdateDepartment(ctx, "D999", dept.Department{ID: "D999", DeptName: "Unknown", Active: true})
+	assert.Error(t, err)
+	assert.Empty(t, bus.events)
+}
+
+// memoryCache is a cache.Store keeping the entries in memory.
+type memoryCache map[string][]byte
+
+func (c memoryCache) Load(ctx context.Context, key string, dest any) bool {
+	data, ok := c[key]
+	return ok && json.Unmarshal(data, dest) == nil
+}
+
+func (c memoryCache) Store(ctx context.Context, key string, value any) {
+	c[key], _ = json.Marshal(value)
+}
+
+func (c memoryCache) Delete(ctx context.Context, key string) {
+	delete(c, key)
+}
+
+func TestDepartmentServiceOptions(t *testing.T) {
+	validator.InitValidator()
+	db, _ := openRecordingDB(t)
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	c := clock.NewSimulated(now)
+	byID := memoryCache{}
+	repo := &eventRepository{bulkDeleteRepository{departments: map[string]dept.Department{}}}
+	service := dept.NewDepartmentService(repo, dept.WithClock(c), dept.WithCache(byID, memoryCache{}), dept.WithEventBus(&recordingBus{}))
+	ctx := dbcontext.InjectDB(context.Background(), db)
+	ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+	_, err := service.CreateDepartment(ctx, dept.Department{ID: "D010", DeptName: "Research", Active: true})
+	require.NoError(t, err)
+	assert.Equal(t, now, *repo.departments["D010"].ValidFrom)
+
+	// The validity period of the name is timestamped by the service clock, only a new name opens a new one
+	for _, tc := range []struct {
+		name      string
+		advance   time.Duration
+		deptName  string
+		validFrom time.Time
+	}{
+		{"renamed", time.Hour, "Research and Development", now.Add(time.Hour)},
+		{"same name", time.Hour, "Research and Development", now.Add(time.Hour)},
+		{"renamed again", 24 * time.Hour, "Research", now.Add(26 * time.Hour)},
+	} {
+		c.Advance(tc.advance)
+		_, err := service.UpdateDepartment(ctx, "D010", dept.Department{ID: "D010", DeptName: tc.deptName, Active: true})
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.validFrom, *repo.departments["D010"].ValidFrom, tc.name)
+	}
+
+	// The department read by ID is served from the injected cache until it is modified
+	for _, tc := range []struct {
+		name     string
+		change   func() error
+		deptName string
+	}{
+		{"cached", func() error { return nil }, "Research"},
+		{"updated", func() error {
+			_, err := service.UpdateDepartment(ctx, "D010", dept.Department{ID: "D010", DeptName: "Laboratory", Active: true})
+			return err
+		}, "Laboratory"},
+	} {
+		require.NoError(t, tc.change(), tc.name)
+		d, err := service.GetDepartmentByID(ctx, "D010")
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.deptName, d.DeptName, tc.name)
+		assert.Contains(t, byID, "d010", tc.name)
+
+		// A change made behind the service is not seen while the entry is cached
+		stale := repo.departments["D010"]
+		stale.DeptName = "Changed Elsewhere"
+		repo.departments["D010"] = stale
+		d, err = service.GetDepartmentByID(ctx, "D010")
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.deptName, d.DeptName, tc.name)
+	}
+
+	_, err = service.DeleteDepartment(ctx, "D010", false)
+	require.NoError(t, err)
+	assert.NotContains(t, byID, "d010")
+}
+
+func TestKafkaPublisherConfig(t *testing.T) {
+	// The publisher needs at least one broker and a topic
+	for _, tc := range []struct {
+		name    string
+		brokers []string
+		topic   string
+		valid   bool
+	}{
+		{"configured", []string{"kafka-1:9092", " kafka-2:9092 "}, "departments", true},
+		{"no broker", []string{"", " "}, "departments", false},
+		{"no topic", []string{"kafka-1:9092"}, "", false},
+	} {
+		p, err := event.NewKafkaPublisher(tc.brokers, tc.topic)
+		if tc.valid {
+			require.NoError(t, err, tc.name)
+			assert.NoError(t, p.Close(), tc.name)
+		} else {
+			assert.Error(t, err, tc.name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+)
+
+// setPasswordHashing configures the password hashes with cheap parameters, restored at the end of the test.
+func setPasswordHashing(t *testing.T, algorithm string, bcryptCost string) {
+	t.Cleanup(user.LoadEnv)
+	t.Setenv("PASSWORD_HASH_ALGORITHM", algorithm)
+	t.Setenv("BCRYPT_COST", bcryptCost)
+	t.Setenv("ARGON2_MEMORY_KB", "64")
+	t.Setenv("ARGON2_ITERATIONS", "1")
+	t.Setenv("ARGON2_PARALLELISM", "1")
+	user.LoadEnv()
+}
+
+func TestHashPasswordArgon2id(t *testing.T) {
+	setPasswordHashing(t, "argon2id", "4")
+
+	hash, err := user.HashPassword("P@ssw0rd123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+
+	// Each hash has its own salt
+	other, err := user.HashPassword("P@ssw0rd123")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	rehash, err := user.VerifyPassword(hash, "P@ssw0rd123")
+	assert.NoError(t, err)
+	assert.False(t, rehash, "Expected a hash of the configured parameters to be kept")
+
+	_, err = user.VerifyPassword(hash, "wrong-password")
+	assert.ErrorIs(t, err, user.ErrPasswordMismatch)
+}
+
+func TestVerifyPasswordMigratesOutdatedHashes(t *testing.T) {
+	// A bcrypt hash checked once argon2id is configured is migrated
+	setPasswordHashing(t, "bcrypt", "4")
+	bcryptHash, err := user.HashPassword("P@ssw0rd123")
+	require.NoError(t, err)
+
+	setPasswordHashing(t, "argon2id", "4")
+	rehash, err := user.VerifyPassword(bcryptHash, "P@ssw0rd123")
+	assert.NoError(t, err)
+	assert.True(t, rehash, "Expected the bcrypt hash to be migrated to argon2id")
+
+	_, err = user.VerifyPassword(bcryptHash, "wrong-password")
+	assert.ErrorIs(t, err, user.ErrPasswordMismatch)
+
+	// A bcrypt hash of a lower cost is migrated when the cost is raised
+	setPasswordHashing(t, "bcrypt", "5")
+	rehash, err = user.VerifyPassword(bcryptHash, "P@ssw0rd123")
+	assert.NoError(t, err)
+	assert.True(t, rehash, "Expected the bcrypt hash to be migrated to the new cost")
+
+	// An argon2id hash of other parameters is migrated too
+	setPasswordHashing(t, "argon2id", "4")
+	argon2Hash, err := user.HashPassword("P@ssw0rd123")
+	require.NoError(t, err)
+
+	t.Setenv("ARGON2_ITERATIONS", "2")
+	user.LoadEnv()
+	rehash, err = user.VerifyPassword(argon2Hash, "P@ssw0rd123")
+	assert.NoError(t, err)
+	assert.True(t, rehash, "Expected the argon2id hash to be migrated to the new parameters")
+}
+
+func TestVerifyPasswordUnknownHash(t *testing.T) {
+	for _, hash := range []string{"", "plain-text", "$argon2id$v=19$m=64,t=1,p=1$not-base64!$abc", "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5"} {
+		_, err := user.VerifyPassword(hash, "P@ssw0rd123")
+		assert.Error(t, err, hash)
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/permission"
+)
+
+func TestPermissionsOfRoles(t *testing.T) {
+	t.Cleanup(permission.Reset)
+
+	assert.Equal(t, []string{permission.DepartmentsRead}, permission.For([]string{"ROLE_USER"}))
+	assert.Equal(t, []string{permission.DepartmentsRead}, permission.For([]string{"ROLE_USER", "ROLE_MODERATOR"}))
+	assert.Len(t, permission.For([]string{"ROLE_ADMIN"}), len(permission.All))
+	assert.Equal(t, []string{}, permission.For(nil))
+	assert.Equal(t, []string{}, permission.For([]string{"ROLE_AUDITOR"}))
+
+	// A custom role is granted some actions of the admins, the built-in roles keep their defaults
+	require.NoError(t, permission.SetGrants(map[string][]string{"ROLE_AUDITOR": {permission.AuditRead}}))
+	assert.Equal(t, []string{permission.AuditRead}, permission.For([]string{"ROLE_AUDITOR"}))
+	assert.Equal(t, []string{permission.AuditRead, permission.DepartmentsRead}, permission.For([]string{"ROLE_AUDITOR", "ROLE_USER"}))
+	assert.Len(t, permission.For([]string{"ROLE_ADMIN"}), len(permission.All))
+
+	assert.Error(t, permission.SetGrants(map[string][]string{"auditor": {permission.AuditRead}}))
+	assert.Error(t, permission.SetGrants(map[string][]string{"ROLE_AUDITOR": {"audit:delete"}}))
+
+	permission.Reset()
+	assert.Equal(t, []string{}, permission.For([]string{"ROLE_AUDITOR"}))
+}
+
+func TestLoadPermissionsFile(t *testing.T) {
+	t.Cleanup(permission.Reset)
+
+	path := filepath.Join(t.TempDir(), "permissions.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ROLE_MODERATOR": ["departments:read", "departments:write"]}`), 0o600))
+	require.NoError(t, permission.LoadFile(path))
+	assert.Equal(t, []string{permission.DepartmentsRead, permission.DepartmentsWrite}, permission.For([]string{"ROLE_MODERATOR"}))
+
+	require.NoError(t, os.WriteFile(path, []byte(`["ROLE_MODERATOR"]`), 0o600))
+	assert.Error(t, permission.LoadFile(path))
+	assert.Error(t, permission.LoadFile(filepath.Join(t.TempDir(), "missing.json")))
+}
+
+func TestPermissionsClaim(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "permissions-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/permissions", authorization.JwtValidation(), func(c *gin.Context) {
+		meta, _ := metacontext.RequestMetaFrom(c.Request.Context())
+		c.JSON(http.StatusOK, meta.Permissions)
+	})
+
+	now := time.Now()
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount, Roles: []role.Role{{Name: "ROLE_USER"}}}
+	claims := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+	assert.Equal(t, []string{permission.DepartmentsRead}, claims["permissions"])
+
+	// The tokens issued before the claim get the permissions of their roles
+	older := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+	delete(older, "permissions")
+
+	// The claim wins over the roles
+	granted := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+	granted["permissions"] = []string{permission.AuditRead}
+
+	cases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected string
+	}{
+		{"permissions claim", claims, `["departments:read"]`},
+		{"no permissions claim", older, `["departments:read"]`},
+		{"granted permissions", granted, `["audit:read"]`},
+	}
+
+	for _, tc := range cases {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte("permissions-secret"))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/permissions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code, tc.name)
+		assert.JSONEq(t, tc.expected, resp.Body.String(), tc.name)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(meta metacontext.RequestMeta) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Request = c.Request.WithContext(metacontext.InjectRequestMeta(c.Request.Context(), meta))
+			c.Next()
+		})
+		r.GET("/audit", authorization.RequirePermission(permission.AuditRead), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		return r
+	}
+
+	cases := []struct {
+		name     string
+		meta     metacontext.RequestMeta
+		expected int
+	}{
+		{"admin role", metacontext.RequestMeta{UserID: 1, Roles: []string{"ROLE_ADMIN"}}, http.StatusNoContent},
+		{"user role", metacontext.RequestMeta{UserID: 2, Roles: []string{"ROLE_USER"}}, http.StatusForbidden},
+		{"granted permission", metacontext.RequestMeta{UserID: 3, Roles: []string{"ROLE_AUDITOR"}, Permissions: []string{permission.AuditRead}}, http.StatusNoContent},
+		{"other permissions", metacontext.RequestMeta{UserID: 4, Roles: []string{"ROLE_ADMIN"}, Permissions: []string{permission.DepartmentsRead}}, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		resp := httptest.NewRecorder()
+		newRouter(tc.meta).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/audit", nil))
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+	}
+
+	// Without request metadata
+	r := gin.New()
+	r.GET("/audit", authorization.RequirePermission(permission.AuditRead), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/audit", nil).WithContext(context.Background()))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/profiling"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	profiling.ProfileDir = t.TempDir()
+	defer func() { profiling.ProfileDir = "" }()
+
+	// A heap snapshot is written to the profile directory
+	profile, err := profiling.Capture(context.Background(), profiling.KindHeap, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, profiling.ProfileDir, filepath.Dir(profile.File))
+		info, err := os.Stat(profile.File)
+		assert.NoError(t, err)
+		assert.Equal(t, info.Size(), profile.Bytes)
+	}
+
+	// A CPU profile interrupted by the caller is discarded
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = profiling.Capture(ctx, profiling.KindCPU, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = profiling.Capture(context.Background(), "block", 0)
+	assert.ErrorIs(t, err, profiling.ErrInvalidProfileKind)
+
+	_, err = profiling.ParseSeconds("301")
+	assert.ErrorIs(t, err, profiling.ErrInvalidProfileDuration)
+}
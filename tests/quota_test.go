@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/quota"
+)
+
+func TestQuotaCheck(t *testing.T) {
+	ctx := context.Background()
+	counted := 0
+	count := func(n int64) func() (int64, error) {
+		return func() (int64, error) {
+			counted++
+			return n, nil
+		}
+	}
+
+	// Without a limit the entities are not counted
+	assert.NoError(t, quota.Check(ctx, "departments", 0, dept.ErrDepartmentQuotaExceeded, count(100)))
+	assert.Equal(t, 0, counted)
+
+	// The creation reaching the limit is refused with the quota
+	assert.NoError(t, quota.Check(ctx, "departments", 10, dept.ErrDepartmentQuotaExceeded, count(9)))
+	err := quota.Check(ctx, "departments", 10, dept.ErrDepartmentQuotaExceeded, count(10))
+	assert.ErrorIs(t, err, dept.ErrDepartmentQuotaExceeded)
+	var exceeded *quota.ExceededError
+	if assert.True(t, errors.As(err, &exceeded)) {
+		assert.Equal(t, quota.Exceeded{Entity: "departments", Limit: 10, Count: 10}, exceeded.Exceeded)
+	}
+
+	// The override lets the creation through, a failed count is returned
+	assert.NoError(t, quota.Check(quota.WithOverride(ctx), "departments", 10, dept.ErrDepartmentQuotaExceeded, count(12)))
+	countErr := errors.New("count failed")
+	assert.ErrorIs(t, quota.Check(ctx, "departments", 10, dept.ErrDepartmentQuotaExceeded, func() (int64, error) { return 0, countErr }), countErr)
+}
+
+func TestQuotaValidate(t *testing.T) {
+	t.Cleanup(quota.LoadEnv)
+
+	t.Setenv("MAX_DEPARTMENTS", "500")
+	t.Setenv("MAX_USERS", "")
+	quota.LoadEnv()
+	assert.NoError(t, quota.Validate())
+	assert.Equal(t, int64(500), quota.Departments())
+	assert.Equal(t, int64(0), quota.Users())
+
+	for _, value := range []string{"-1", "1k"} {
+		t.Setenv("MAX_USERS", value)
+		quota.LoadEnv()
+		assert.Error(t, quota.Validate(), value)
+	}
+}
+
+func TestQuotaOverride(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := dept.NewDepartmentHandler(newMockService())
+
+	cases := []struct {
+		meta     metacontext.RequestMeta
+		override bool
+		expected int
+	}{
+		{metacontext.RequestMeta{UserID: 1, Roles: []string{"ROLE_ADMIN"}}, false, http.StatusUnprocessableEntity},
+		{metacontext.RequestMeta{UserID: 1, Roles: []string{"ROLE_ADMIN"}}, true, http.StatusCreated},
+		{metacontext.RequestMeta{UserID: 2, Roles: []string{"ROLE_USER"}}, true, http.StatusForbidden},
+		{metacontext.RequestMeta{UserID: 7, UserName: "importer", Roles: []string{"ROLE_ADMIN"}, Automation: true}, true, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		r := gin.New()
+		r.POST("/api/v1/departments", func(c *gin.Context) {
+			c.Request = c.Request.WithContext(metacontext.InjectRequestMeta(c.Request.Context(), tc.meta))
+		}, authorization.QuotaOverride(), handler.CreateDepartment)
+
+		body, _ := json.Marshal(dept.Department{ID: "d999", DeptName: "Overflow"})
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/departments", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.override {
+			req.Header.Set(quota.OverrideHeader, "true")
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, "override %v for %v", tc.override, tc.meta.Roles)
+		if tc.expected == http.StatusUnprocessableEntity {
+			assert.Contains(t, resp.Body.String(), `"code":"DepartmentQuotaExceeded"`)
+			assert.Contains(t, resp.Body.String(), `"data":{"entity":"departments","limit":10,"count":10}`)
+		}
+	}
+}
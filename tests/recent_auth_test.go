@@ -0,0 +1,242 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mtls"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+	"gorm.io/gorm"
+)
+
+func TestRequireRecentAuth(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "recent-auth-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/departments/:id", authorization.JwtValidation(), authorization.RequireRecentAuth(10*time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	now := time.Now()
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+	claims := func(authTime time.Time) jwt.MapClaims {
+		c := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+		c["sid"] = sampleSessionID
+		c["auth_time"] = authTime.Unix()
+		return c
+	}
+	automation := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+	automation["client_id"] = "client-1"
+	automation["scope"] = "ROLE_ADMIN"
+
+	cases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected int
+	}{
+		{"recent authentication", claims(now.Add(-5 * time.Minute)), http.StatusNoContent},
+		{"old authentication", claims(now.Add(-time.Hour)), http.StatusUnauthorized},
+		{"no authentication time", auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix()), http.StatusUnauthorized},
+		{"automation", automation, http.StatusNoContent},
+	}
+
+	for _, tc := range cases {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims).SignedString([]byte("recent-auth-secret"))
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodDelete, "/departments/D001", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		if tc.expected == http.StatusUnauthorized {
+			assert.Contains(t, resp.Body.String(), "Re-authentication required", tc.name)
+			assert.Equal(t, `Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=600`,
+				resp.Header().Get("WWW-Authenticate"), tc.name)
+		}
+	}
+
+	// A route guarded without an authenticated identity refuses the requests
+	r.DELETE("/roles/:id", authorization.RequireRecentAuth(10*time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodDelete, "/roles/1", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Authentication required")
+}
+
+func TestRecentAuthMaxAge(t *testing.T) {
+	t.Setenv("RECENT_AUTH_MAX_AGE_MINUTES", "")
+	assert.Equal(t, 10*time.Minute, authorization.RecentAuthMaxAge())
+
+	t.Setenv("RECENT_AUTH_MAX_AGE_MINUTES", "3")
+	assert.Equal(t, 3*time.Minute, authorization.RecentAuthMaxAge())
+
+	t.Setenv("RECENT_AUTH_MAX_AGE_MINUTES", "0")
+	assert.Equal(t, 10*time.Minute, authorization.RecentAuthMaxAge())
+}
+
+func TestReauthenticateHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	validator.InitValidator()
+	r := gin.New()
+	r.POST("/auth/reauth", auth.NewAuthHandler(&mockAuthService{}).Reauthenticate)
+
+	reauth := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/auth/reauth", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := reauth(`{"password":"P@ssw0rd123"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"accessToken":"reauth-token"`)
+	assert.NotContains(t, resp.Body.String(), "refreshToken")
+
+	resp = reauth(`{"password":"wrong-password"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), "ReauthFailed")
+
+	assert.Equal(t, http.StatusBadRequest, reauth(`{"password":"short"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, reauth(`{`).Code)
+
+	// The access token alone is delivered in its cookie, the refresh token cookie is kept
+	enableTokenCookies(t)
+	resp = reauth(`{"password":"P@ssw0rd123"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "reauth-token")
+	access := findCookie(resp, tokencookie.AccessTokenCookie)
+	require.NotNil(t, access)
+	assert.Equal(t, "reauth-token", access.Value)
+	assert.Nil(t, findCookie(resp, tokencookie.RefreshTokenCookie))
+}
+
+func TestReauthenticateRefusedTokens(t *testing.T) {
+	validator.InitValidator()
+	db, _ := openRecordingDB(t)
+	service := auth.NewAuthService()
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	cases := []struct {
+		name string
+		meta metacontext.RequestMeta
+	}{
+		{"no session", metacontext.RequestMeta{UserID: 2, UserName: "john"}},
+		{"impersonation", metacontext.RequestMeta{UserID: 2, UserName: "john", SessionID: sampleSessionID, ImpersonatedBy: 1}},
+		{"automation", metacontext.RequestMeta{UserID: 2, UserName: "john", SessionID: sampleSessionID, Automation: true}},
+	}
+
+	for _, tc := range cases {
+		_, err := service.Reauthenticate(metacontext.InjectRequestMeta(ctx, tc.meta), auth.ReauthRequest{Password: "P@ssw0rd123"})
+		assert.ErrorIs(t, err, auth.ErrReauthNotAllowed, tc.name)
+	}
+}
+
+func TestSessionReauthentication(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := refreshtoken.NewRefreshTokenService(refreshtoken.NewRefreshTokenRepository(), refreshtoken.WithClock(clock.Fixed(now)))
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	// A new session records the authentication of its login
+	created, err := service.CreateRefreshToken(ctx, 3, refreshtoken.Client{}, false)
+	require.NoError(t, err)
+	require.NotNil(t, created.AuthTime)
+	assert.Equal(t, now, created.AuthenticatedAt())
+
+	// The sessions created before the authentication time was recorded fall back to their creation
+	older := refreshtoken.RefreshToken{CreatedAt: now.Add(-time.Hour)}
+	assert.Equal(t, now.Add(-time.Hour), older.AuthenticatedAt())
+
+	// The re-authentication updates the session of the user while it is not expired and returns it,
+	// the fake database runs no query, so the statement is recorded by a callback
+	var statements []string
+	require.NoError(t, db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	}))
+	_, err = service.Reauthenticate(ctx, 3, created.ID)
+	assert.Error(t, err)
+	if assert.Len(t, statements, 1) {
+		assert.Contains(t, statements[0], `UPDATE "refresh_token" SET "auth_time"=$1`)
+		assert.Contains(t, statements[0], `WHERE id = $2 AND user_id = $3 AND expiry_date > $4`)
+		assert.Contains(t, statements[0], `RETURNING *`)
+	}
+}
+
+func TestRecentAuthClientCertificate(t *testing.T) {
+	t.Cleanup(func() { mtls.SetServiceAccounts(nil) })
+	mtls.SetServiceAccounts([]mtls.ServiceAccount{
+		{Name: "cleanup-service", UserID: 1, Email: "cleanup-service@internal", Roles: []string{"ROLE_ADMIN"}, CommonNames: []string{"cleanup-service"}},
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := routes.SetupMTLSRouter()
+
+	// The service accounts have no password to enter again, the sensitive routes do not ask them to
+	for _, path := range []string{"/api/v1/departments/D001", "/api/v1/departments"} {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.TLS = clientCertState("cleanup-service")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.NotEqual(t, http.StatusUnauthorized, resp.Code, path)
+		assert.Empty(t, resp.Header().Get("WWW-Authenticate"), path)
+		assert.NotContains(t, resp.Body.String(), "Re-authentication required", path)
+	}
+}
+
+func TestRecentAuthRoutes(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "recent-auth-secret")
+
+	gin.SetMode(gin.TestMode)
+	r := routes.SetupRouter()
+
+	now := time.Now()
+	claims := auth.NewJWTClaims(user.User{ID: 2, UserName: "john", UserType: user.UserAccount, Roles: []role.Role{{Name: "ROLE_ADMIN"}}}, now.Unix(), now.Add(time.Hour).Unix())
+	claims["sid"] = sampleSessionID
+	claims["auth_time"] = now.Add(-time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("recent-auth-secret"))
+	require.NoError(t, err)
+
+	// The changes and the deletions of the users and the departments ask for a recent authentication
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPut, "/api/v1/users/1"},
+		{http.MethodPatch, "/api/v1/users/1"},
+		{http.MethodDelete, "/api/v1/users/1"},
+		{http.MethodDelete, "/api/v1/departments/D001"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, tc.method+" "+tc.path)
+		assert.Contains(t, resp.Body.String(), "Re-authentication required", tc.method+" "+tc.path)
+	}
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/captcha"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/mailer"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+)
+
+// registrationUsers is a user service holding the registered users in memory.
+type registrationUsers struct {
+	mockUserService
+	users []user.User
+}
+
+func (m *registrationUsers) GetUserByUserName(ctx context.Context, username string) (user.User, error) {
+	for _, u := range m.users {
+		if u.UserName == username {
+			return u, nil
+		}
+	}
+	return user.User{}, user.ErrUserNotFound
+}
+
+func (m *registrationUsers) GetUserByEmail(ctx context.Context, email string) (user.User, error) {
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return user.User{}, user.ErrUserNotFound
+}
+
+func (m *registrationUsers) RegisterUser(ctx context.Context, u user.User) (user.User, error) {
+	if _, err := m.GetUserByUserName(ctx, u.UserName); err == nil {
+		return user.User{}, user.ErrUserNameTaken
+	}
+	u.ID = int64(len(m.users) + 1)
+	m.users = append(m.users, u)
+	return u, nil
+}
+
+var registrationTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// registrationToken extracts the verification token from the link of a registration e-mail.
+func registrationToken(t *testing.T, message mailer.Message) string {
+	match := registrationTokenPattern.FindStringSubmatch(message.Body)
+	require.Len(t, match, 2, message.Body)
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestRegistrationHandlers(t *testing.T) {
+	r := SetupAuthRouter()
+
+	cases := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/auth/register", `{"userName":"newuser","email":"new@example.com","password":"N3w-Passw0rd!","firstName":"New"}`, http.StatusAccepted},
+		{"/auth/register", `{"userName":"newuser","email":"new@example.com","password":"short","firstName":"New"}`, http.StatusBadRequest},
+		{"/auth/register", `{"userName":"newuser","email":"new@example.com","password":"N3w-Passw0rd!","firstName":"New","captchaToken":"robot"}`, http.StatusBadRequest},
+		{"/auth/register", `{"userName":"taken","email":"new@example.com","password":"N3w-Passw0rd!","firstName":"New"}`, http.StatusConflict},
+		{"/auth/register/verify", `{"token":"valid-token"}`, http.StatusCreated},
+		{"/auth/register/verify", `{"token":"unknown-token"}`, http.StatusBadRequest},
+		{"/auth/register/verify", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest("POST", tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, tc.code, resp.Code, tc.path+" "+tc.body)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	mail := make(channelMailer, 4)
+	mailer.SetMailer(mail)
+	defer mailer.InitMailer()
+	t.Setenv("REGISTRATION_VERIFY_URL", "https://app.example.com/verify")
+
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	ctx := dbcontext.InjectRedisClient(context.Background(), client)
+
+	users := &registrationUsers{users: []user.User{{ID: 1, UserName: "existing", FirstName: "Existing", Email: "existing@example.com"}}}
+	service := auth.NewAuthService(auth.WithUserService(users))
+	req := auth.RegistrationRequest{UserName: "newuser", Email: "new@example.com", Password: "N3w-Passw0rd!", FirstName: "New"}
+
+	// A taken username is reported
+	taken := req
+	taken.UserName = "existing"
+	assert.ErrorIs(t, service.Register(ctx, taken), user.ErrUserNameTaken)
+
+	// A registered e-mail succeeds as well, its owner is told about the attempt
+	registered := req
+	registered.Email = "existing@example.com"
+	require.NoError(t, service.Register(ctx, registered))
+	notice := receiveMail(t, mail)
+	assert.Equal(t, "existing@example.com", notice.To)
+	assert.NotContains(t, notice.Body, "token=")
+	assert.Len(t, users.users, 1)
+
+	// The verification link is sent to the address, the user is only created once it is opened
+	require.NoError(t, service.Register(ctx, req))
+	message := receiveMail(t, mail)
+	assert.Equal(t, "new@example.com", message.To)
+	assert.Contains(t, message.Body, "https://app.example.com/verify?token=")
+	token := registrationToken(t, message)
+	assert.Len(t, users.users, 1)
+
+	created, err := service.VerifyRegistration(ctx, auth.VerifyRegistrationRequest{Token: token})
+	require.NoError(t, err)
+	assert.Equal(t, "newuser", created.UserName)
+	assert.Equal(t, "new@example.com", created.Email)
+	assert.NotEqual(t, req.Password, created.Password, "Expected the password to be hashed")
+	_, err = user.VerifyPassword(created.Password, req.Password)
+	assert.NoError(t, err)
+
+	// The token is single-use
+	_, err = service.VerifyRegistration(ctx, auth.VerifyRegistrationRequest{Token: token})
+	assert.ErrorIs(t, err, auth.ErrInvalidRegistrationToken)
+
+	// A failed creation keeps the token, so it can be retried
+	require.NoError(t, service.Register(ctx, auth.RegistrationRequest{UserName: "racer", Email: "racer@example.com", Password: "R4cer-Passw0rd!", FirstName: "Racer"}))
+	token = registrationToken(t, receiveMail(t, mail))
+	users.users = append(users.users, user.User{ID: 9, UserName: "racer", Email: "other@example.com"})
+	_, err = service.VerifyRegistration(ctx, auth.VerifyRegistrationRequest{Token: token})
+	assert.ErrorIs(t, err, user.ErrUserNameTaken)
+	users.users = users.users[:len(users.users)-1]
+	_, err = service.VerifyRegistration(ctx, auth.VerifyRegistrationRequest{Token: token})
+	assert.NoError(t, err)
+}
+
+func TestRegistrationCaptcha(t *testing.T) {
+	var form url.Values
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("response") == "human" {
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	t.Cleanup(provider.Close)
+	t.Cleanup(func() { captcha.SetVerifier(nil) })
+
+	// Without a verifier no answer is required
+	captcha.SetVerifier(nil)
+	assert.NoError(t, captcha.Check(context.Background(), "", "203.0.113.7"))
+
+	captcha.SetVerifier(&captcha.SiteVerifier{URL: provider.URL, Secret: "site-secret", Client: provider.Client()})
+	assert.ErrorIs(t, captcha.Check(context.Background(), "", "203.0.113.7"), captcha.ErrInvalidCaptcha)
+	assert.ErrorIs(t, captcha.Check(context.Background(), "robot", "203.0.113.7"), captcha.ErrInvalidCaptcha)
+	assert.NoError(t, captcha.Check(context.Background(), "human", "203.0.113.7"))
+	assert.Equal(t, "site-secret", form.Get("secret"))
+	assert.Equal(t, "203.0.113.7", form.Get("remoteip"))
+
+	// A failing provider is not mistaken for a refused answer
+	provider.Close()
+	err := captcha.Check(context.Background(), "human", "203.0.113.7")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, captcha.ErrInvalidCaptcha)
+
+	// The registrations are refused before anything is stored
+	service := auth.NewAuthService(auth.WithUserService(&registrationUsers{}))
+	err = service.Register(context.Background(), auth.RegistrationRequest{UserName: "bot", Email: "bot@example.com", Password: "B0t-Passw0rd!", FirstName: "Bot"})
+	assert.ErrorIs(t, err, captcha.ErrInvalidCaptcha)
+}
+
+func TestRoutesSelfRegistration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(auth.LoadEnv)
+
+	registered := func() bool {
+		for _, route := range routes.SetupRouter().Routes() {
+			if route.Method+" "+route.Path == "POST /auth/register" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The self-registration is disabled unless enabled explicitly
+	t.Setenv("SELF_REGISTRATION_ENABLED", "")
+	auth.LoadEnv()
+	assert.False(t, registered())
+
+	t.Setenv("SELF_REGISTRATION_ENABLED", "TRUE")
+	auth.LoadEnv()
+	assert.True(t, registered())
+}
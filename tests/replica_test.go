@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/replica"
+)
+
+// findingsBySetting indexes the findings of the configuration by setting.
+func findingsBySetting(env map[string]string) map[string]replica.Finding {
+	findings := make(map[string]replica.Finding)
+	for _, f := range replica.Check(func(key string) string { return env[key] }) {
+		findings[f.Setting] = f
+	}
+
+	return findings
+}
+
+func TestReplicaCheckInstanceLocalState(t *testing.T) {
+	findings := findingsBySetting(map[string]string{"DB_MIGRATE": "TRUE"})
+
+	// The default configuration keeps the rate limits and the logs in the instance
+	assert.True(t, findings["DB_MIGRATE"].Fatal)
+	assert.True(t, findings["RATE_LIMITER_BACKEND"].Fatal)
+	assert.Contains(t, findings, "LOG_FILES")
+	assert.False(t, findings["LOG_FILES"].Fatal)
+
+	// The local storage keeps the uploads on the disk of one replica
+	findings = findingsBySetting(map[string]string{"STORAGE_BACKEND": "local"})
+	assert.True(t, findings["STORAGE_BACKEND"].Fatal)
+}
+
+func TestReplicaCheckSharedState(t *testing.T) {
+	findings := findingsBySetting(map[string]string{
+		"DB_MIGRATE":           "FALSE",
+		"RATE_LIMITER_BACKEND": "REDIS",
+		"LOG_FILES":            "FALSE",
+	})
+
+	// Only the warning about the event stream remains
+	for setting, f := range findings {
+		assert.False(t, f.Fatal, setting)
+	}
+	assert.NotContains(t, findings, "LOG_FILES")
+	assert.Len(t, findings, 1)
+}
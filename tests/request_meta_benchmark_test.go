@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	dept "github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+)
+
+const benchmarkJWTSecret = "benchmark-secret"
+
+// setupAuthenticatedDepartmentRouter serves GET /api/v1/departments/:id behind the JWT validation
+// and the role check, as the application does, with the mock department service.
+func setupAuthenticatedDepartmentRouter(b *testing.B) (*gin.Engine, string) {
+	b.Setenv("TOKEN_TYPE", "Bearer")
+	b.Setenv("JWT_SECRET", benchmarkJWTSecret)
+
+	gin.SetMode(gin.TestMode)
+	handler := dept.NewDepartmentHandler(newMockService())
+
+	r := gin.New()
+	r.GET("/api/v1/departments/:id", authorization.JwtValidation(), authorization.RoleBasedAccessControl("ROLE_ADMIN", "ROLE_USER"), handler.GetDepartmentByID)
+
+	now := time.Now().Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":          "admin",
+		"aud":          "department-api",
+		"iss":          "department-api",
+		"iat":          now,
+		"exp":          now + 3600,
+		"email":        "admin@example.com",
+		"userid":       1,
+		"username":     "admin",
+		"roles":        []string{"ROLE_ADMIN"},
+		"tokenversion": 0,
+	}).SignedString([]byte(benchmarkJWTSecret))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return r, "Bearer " + token
+}
+
+func BenchmarkAuthenticatedGetDepartment(b *testing.B) {
+	r, authorizationHeader := setupAuthenticatedDepartmentRouter(b)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/departments/d001", nil)
+	req.Header.Set("Authorization", authorizationHeader)
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d: %s", resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func BenchmarkJWTValidationMiddleware(b *testing.B) {
+	_, authorizationHeader := setupAuthenticatedDepartmentRouter(b)
+
+	// Only the JWT validation and the role check, the handler reads the request metadata
+	r := gin.New()
+	r.GET("/ping", authorization.JwtValidation(), authorization.RoleBasedAccessControl("ROLE_ADMIN"), func(c *gin.Context) {
+		if _, ok := metacontext.ExtractRequestMeta(c.Request.Context()); !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("Authorization", authorizationHeader)
+	resp := httptest.NewRecorder()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(resp, req)
+		if resp.Code != http.StatusNoContent {
+			b.Fatalf("unexpected status %d", resp.Code)
+		}
+	}
+}
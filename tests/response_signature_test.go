@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/client"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/integrity"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/signing"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/util"
+)
+
+// SetupSignedRouter initializes a Gin router with a single signed endpoint
+func SetupSignedRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/report", integrity.ResponseSignature(), func(c *gin.Context) {
+		util.JSONSuccess(c, http.StatusOK, "Report generated successfully", map[string]int{"departments": 2})
+	})
+
+	return r
+}
+
+func TestResponseSignatureEd25519(t *testing.T) {
+	// Generate a key pair and enable response signing
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signing.SetSigner(signing.NewEd25519Signer("test", privateKey))
+	defer signing.SetSigner(nil)
+
+	// Serve the signed endpoint
+	srv := httptest.NewServer(SetupSignedRouter())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/report")
+	if err != nil {
+		t.Fatalf("Failed to get report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check if the signature headers are set and the signature is valid
+	assert.Equal(t, "test", resp.Header.Get(signing.HeaderSignatureKeyID))
+	body, err := client.VerifyResponseSignature(resp, signing.NewEd25519Verifier(publicKey), 0)
+	assert.NoError(t, err, "Expected the response signature to be valid")
+	assert.Contains(t, string(body), "Report generated successfully")
+}
+
+func TestResponseSignatureTampered(t *testing.T) {
+	// Enable response signing with a shared secret
+	signing.SetSigner(signing.NewHMACSigner("test", []byte("response-signing-secret")))
+	defer signing.SetSigner(nil)
+
+	// Serve the signed endpoint
+	srv := httptest.NewServer(SetupSignedRouter())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/report")
+	if err != nil {
+		t.Fatalf("Failed to get report: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check if a verifier with another secret rejects the response
+	_, err = client.VerifyResponseSignature(resp, signing.NewHMACVerifier([]byte("another-secret")), 0)
+	assert.Error(t, err, "Expected the response signature to be rejected")
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// bootstrapRoleRepository is a role repository holding roles in memory.
+// The methods the bootstrap does not use are left unimplemented.
+type bootstrapRoleRepository struct {
+	role.RoleRepository
+	roles    []role.Role
+	migrated int
+	locked   int
+	fail     error
+}
+
+func (r *bootstrapRoleRepository) GetAllRoles(tx *gorm.DB) ([]role.Role, error) {
+	return append([]role.Role(nil), r.roles...), nil
+}
+
+func (r *bootstrapRoleRepository) CreateRole(tx *gorm.DB, created role.Role) (role.Role, error) {
+	if r.fail != nil {
+		return role.Role{}, r.fail
+	}
+	created.ID = uint(len(r.roles) + 1)
+	r.roles = append(r.roles, created)
+	return created, nil
+}
+
+func (r *bootstrapRoleRepository) LockRoles(tx *gorm.DB) error {
+	r.locked++
+	return nil
+}
+
+func (r *bootstrapRoleRepository) MigrateNameCheck(tx *gorm.DB) error {
+	r.migrated++
+	return nil
+}
+
+func roleNames(roles []role.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestRoleBootstrap(t *testing.T) {
+	t.Cleanup(role.LoadEnv)
+	t.Setenv("ROLES_CUSTOM", "")
+	role.LoadEnv()
+	db, _ := openRecordingDB(t)
+
+	// A fresh database gets the built-in roles, in the order of the seed file
+	repo := &bootstrapRoleRepository{}
+	created, err := role.Bootstrap(db, repo)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ROLE_USER", "ROLE_MODERATOR", "ROLE_ADMIN"}, roleNames(created))
+	assert.Equal(t, uint(1), created[0].ID)
+	assert.Equal(t, 1, repo.migrated)
+	assert.Equal(t, 1, repo.locked)
+
+	// The bootstrap is idempotent
+	created, err = role.Bootstrap(db, repo)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+	assert.Len(t, repo.roles, 3)
+
+	// Only the missing roles are created, the seeded roles are matched case-insensitively
+	t.Setenv("ROLES_CUSTOM", " role_auditor ,ROLE_HR_2")
+	role.LoadEnv()
+	require.NoError(t, role.Validate())
+	repo = &bootstrapRoleRepository{roles: []role.Role{{ID: 1, Name: "role_user"}, {ID: 2, Name: "ROLE_ADMIN"}}}
+	created, err = role.Bootstrap(db, repo)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ROLE_MODERATOR", "ROLE_AUDITOR", "ROLE_HR_2"}, roleNames(created))
+
+	// A failure is returned and rolls the transaction back
+	_, err = role.Bootstrap(db, &bootstrapRoleRepository{fail: errors.New("insert failed")})
+	assert.ErrorContains(t, err, "failed to create role ROLE_USER")
+
+	_, err = role.Bootstrap(nil, repo)
+	assert.Error(t, err)
+}
+
+func TestRoleCatalogConfig(t *testing.T) {
+	t.Cleanup(role.LoadEnv)
+
+	t.Setenv("ROLES_CUSTOM", "ROLE_AUDITOR")
+	role.LoadEnv()
+	require.NoError(t, role.Validate())
+	assert.Equal(t, []string{"ROLE_USER", "ROLE_MODERATOR", "ROLE_ADMIN", "ROLE_AUDITOR"}, role.Names())
+	assert.True(t, role.IsKnown("role_auditor"))
+	assert.True(t, role.IsKnown("ROLE_ADMIN"))
+	assert.False(t, role.IsKnown("ROLE_ROOT"))
+
+	// The custom roles must be role names, declared once
+	for _, custom := range []string{"AUDITOR", "ROLE_", "ROLE_AUDIT-LOG", "ROLE_A_VERY_LONG_ROLE_NAME", "ROLE_ADMIN", "ROLE_HR,ROLE_HR"} {
+		t.Setenv("ROLES_CUSTOM", custom)
+		role.LoadEnv()
+		assert.Error(t, role.Validate(), custom)
+	}
+
+	// The role names are validated by format, the existence of a role is checked when it is assigned
+	validator.InitValidator()
+	r := role.Role{Name: "ROLE_AUDITOR"}
+	assert.NoError(t, r.Validate())
+	r.Name = "auditor"
+	assert.Error(t, r.Validate())
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// roleRequestRepository is a user repository holding users and role requests in memory.
+// The methods the role requests do not use are left unimplemented.
+type roleRequestRepository struct {
+	emailChangeRepository
+	requests map[int64]user.RoleRequest
+}
+
+func (r *roleRequestRepository) CreateRoleRequest(ctx context.Context, tx *gorm.DB, req user.RoleRequest) (user.RoleRequest, error) {
+	req.ID = int64(len(r.requests) + 1)
+	r.requests[req.ID] = req
+	return req, nil
+}
+
+func (r *roleRequestRepository) HasPendingRoleRequest(tx *gorm.DB, userID int64, roleName string) (bool, error) {
+	for _, req := range r.requests {
+		if req.UserID == userID && req.RoleName == roleName && req.IsPending() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *roleRequestRepository) GetRoleRequestForUpdate(tx *gorm.DB, id int64) (user.RoleRequest, error) {
+	req, ok := r.requests[id]
+	if !ok {
+		return user.RoleRequest{}, user.ErrRoleRequestNotFound
+	}
+	return req, nil
+}
+
+func (r *roleRequestRepository) DecideRoleRequest(ctx context.Context, tx *gorm.DB, req user.RoleRequest) (user.RoleRequest, error) {
+	r.requests[req.ID] = req
+	return req, nil
+}
+
+func TestRequestMyRole(t *testing.T) {
+	r := SetupUserRouter()
+
+	for body, expected := range map[string]int{
+		`{"role":"ROLE_USER","justification":"I review the departments"}`:      http.StatusCreated,
+		`{"role":"ROLE_ADMIN","justification":"I review the departments"}`:     http.StatusConflict,
+		`{"role":"ROLE_MODERATOR","justification":"I review the departments"}`: http.StatusUnprocessableEntity,
+		`{"role":"admin","justification":"I review the departments"}`:          http.StatusBadRequest,
+		`{"role":"ROLE_USER","justification":"please"}`:                        http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/role-requests", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req = req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, body)
+	}
+
+	// The caller lists its own requests, filtered by status
+	for query, expected := range map[string]int{"": 1, "?status=pending": 1, "?status=DENIED": 0} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me/role-requests"+query, nil)
+		req = req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		require.Equal(t, http.StatusOK, resp.Code, query)
+		var body struct {
+			Data []user.RoleRequest `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		assert.Len(t, body.Data, expected, query)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/role-requests?status=WITHDRAWN", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestDecideRoleRequestHandler(t *testing.T) {
+	r := SetupUserRouter()
+
+	for path, expected := range map[string]int{
+		"/1/approve": http.StatusOK,
+		"/1/deny":    http.StatusOK,
+		"/2/approve": http.StatusConflict,
+		"/9/deny":    http.StatusNotFound,
+		"/x/deny":    http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/role-requests"+path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, path)
+	}
+
+	// The note is optional, and limited in length
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/role-requests/1/deny", bytes.NewBufferString(`{"note":"`+string(bytes.Repeat([]byte("x"), 501))+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestRoleRequestWorkflow(t *testing.T) {
+	validator.InitValidator()
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	db, _ := openRecordingDB(t)
+
+	repo := &roleRequestRepository{
+		emailChangeRepository: emailChangeRepository{users: map[int64]user.User{
+			1: {ID: 1, UserName: "admin", Email: "admin@example.com", Roles: []role.Role{{ID: 3, Name: "ROLE_ADMIN"}}},
+			2: {ID: 2, UserName: "jane", Email: "jane@example.com", Roles: []role.Role{{ID: 1, Name: "ROLE_USER"}}},
+		}},
+		requests: map[int64]user.RoleRequest{},
+	}
+	service := user.NewUserService(repo, user.WithEventBus(&recordingBus{}))
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+	userCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 2, UserName: "jane", Roles: []string{"ROLE_USER"}})
+	adminCtx := metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+	// A role the user already has cannot be requested
+	_, err := service.RequestRole(userCtx, 2, user.RoleRequestCreate{Role: "ROLE_USER", Justification: "I need the access"})
+	assert.ErrorIs(t, err, user.ErrRoleAlreadyHeld)
+
+	// A pending request for the role blocks a second one
+	repo.requests[1] = user.RoleRequest{ID: 1, UserID: 2, RoleName: "ROLE_ADMIN", Justification: "I manage the departments", Status: user.RoleRequestPending}
+	_, err = service.RequestRole(userCtx, 2, user.RoleRequestCreate{Role: "ROLE_ADMIN", Justification: "I manage the departments"})
+	assert.ErrorIs(t, err, user.ErrRoleRequestPending)
+
+	// The users do not decide their own requests
+	_, err = service.ApproveRoleRequest(userCtx, 1, user.RoleRequestDecision{})
+	assert.ErrorIs(t, err, user.ErrRoleRequestSelf)
+
+	// A denied request records who decided it and why, and cannot be decided again
+	denied, err := service.DenyRoleRequest(adminCtx, 1, user.RoleRequestDecision{Note: " not this quarter "})
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleRequestDenied, denied.Status)
+	assert.Equal(t, int64(1), *denied.DecidedBy)
+	assert.NotNil(t, denied.DecidedAt)
+	assert.Equal(t, "not this quarter", *denied.DecisionNote)
+
+	_, err = service.ApproveRoleRequest(adminCtx, 1, user.RoleRequestDecision{})
+	assert.ErrorIs(t, err, user.ErrRoleRequestDecided)
+	_, err = service.DenyRoleRequest(adminCtx, 9, user.RoleRequestDecision{})
+	assert.ErrorIs(t, err, user.ErrRoleRequestNotFound)
+
+	// The approval revokes the access tokens of the user, so its next refresh loads the roles again
+	repo.requests[3] = user.RoleRequest{ID: 3, UserID: 2, RoleName: "ROLE_USER", Justification: "granted by hand meanwhile", Status: user.RoleRequestPending}
+	approved, err := service.ApproveRoleRequest(adminCtx, 3, user.RoleRequestDecision{})
+	require.NoError(t, err)
+	assert.Equal(t, user.RoleRequestApproved, approved.Status)
+	assert.Nil(t, approved.DecisionNote)
+	assert.NoError(t, client.Get(ctx, "user_tokens_revoked_at:2").Err())
+
+	_, err = service.RequestRole(context.Background(), 2, user.RoleRequestCreate{Role: "ROLE_ADMIN", Justification: "I manage the departments"})
+	assert.Error(t, err)
+}
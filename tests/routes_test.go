@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/module"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+)
+
+// assertNoRouteCollisions builds a router and checks that no two modules registered the same route.
+// Gin panics when a route is registered twice or conflicts with the wildcard of another one.
+func assertNoRouteCollisions(t *testing.T, setup func() *gin.Engine) {
+	var r *gin.Engine
+	assert.NotPanics(t, func() { r = setup() })
+	if r == nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, route := range r.Routes() {
+		key := route.Method + " " + route.Path
+		assert.False(t, seen[key], "route %s is registered twice", key)
+		seen[key] = true
+	}
+	assert.NotEmpty(t, seen)
+}
+
+func TestRoutesNoCollisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	assertNoRouteCollisions(t, routes.SetupRouter)
+	assertNoRouteCollisions(t, routes.SetupMTLSRouter)
+	assertNoRouteCollisions(t, routes.SetupAdminRouter)
+}
+
+func TestRoutesRegisteredByModules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := routes.SetupRouter()
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	// Every module registers its routes under its own group
+	for _, route := range []string{
+		"GET /livez",
+		"POST /auth/login",
+		"GET /schemas/:entity",
+		"GET /api/v1/departments/:id",
+		"GET /api/v1/departments/export",
+		"DELETE /api/v1/departments",
+		"GET /api/v1/users",
+		"POST /api/v1/users/:id/impersonate",
+		"POST /api/v1/users/transfer",
+		"GET /api/v1/roles/:id/users",
+		"GET /api/v1/users/:id/audit",
+		"GET /api/v1/users/:id/logins",
+		"GET /api/v1/users/logins",
+		"PATCH /api/v1/users/:id",
+		"GET /api/v1/users/export",
+		"GET /api/v1/users/stats",
+		"POST /api/v1/users/:id/api-keys",
+		"DELETE /api/v1/users/:id/api-keys/:keyId",
+		"DELETE /api/v1/users/me/token",
+		"POST /api/v1/users/me/email",
+		"POST /api/v1/users/me/email/confirm",
+		"POST /api/v1/users/me/role-requests",
+		"POST /api/v1/role-requests/:id/approve",
+		"GET /api/v1/webhooks",
+		"POST /api/v1/clients",
+		"DELETE /api/v1/clients/:id",
+		"GET /api/v1/events",
+		"GET /api/v1/jobs/:id",
+		"GET /api/v1/dataredis/json/:key",
+		"GET /openapi.json",
+		"GET /api",
+		"GET /.well-known/jwks.json",
+		"POST /auth/token",
+		"GET /auth/oidc/:provider",
+		"GET /auth/oidc/:provider/callback",
+	} {
+		assert.True(t, registered[route], route)
+	}
+}
+
+func TestRoutesDisabledModules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Reload the configuration once the environment is restored
+	t.Cleanup(module.LoadEnv)
+	t.Setenv("MODULES_DISABLED", " DataRedis, webhooks,password-reset ")
+	module.LoadEnv()
+	assert.NoError(t, module.Validate())
+	assert.False(t, module.Enabled(module.DataRedis))
+	assert.True(t, module.Enabled(module.Admin))
+
+	r := routes.SetupRouter()
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	// The disabled modules register no routes, the other ones are unchanged
+	assert.False(t, registered["GET /api/v1/dataredis/json/:key"])
+	assert.False(t, registered["GET /api/v1/webhooks"])
+	assert.False(t, registered["POST /auth/forgot-password"])
+	assert.True(t, registered["POST /auth/login"])
+	assert.True(t, registered["GET /api/v1/departments/:id"])
+
+	// An unknown module is refused rather than ignored
+	t.Setenv("MODULES_DISABLED", "webhook")
+	module.LoadEnv()
+	assert.Error(t, module.Validate())
+}
+
+func TestRoutesAdminListener(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	public, internal := routes.SetupRouter(), routes.SetupAdminRouter()
+
+	// The metrics, the profiling and the admin endpoints are only served on the internal admin listener
+	for _, tc := range []struct {
+		method   string
+		path     string
+		internal int
+	}{
+		{http.MethodGet, "/metrics", http.StatusOK},
+		{http.MethodGet, "/debug/pprof/", http.StatusOK},
+		{http.MethodGet, "/debug/pprof/goroutine", http.StatusOK},
+		{http.MethodGet, "/admin/token-version", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/cache/stats", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		resp := httptest.NewRecorder()
+		internal.ServeHTTP(resp, req)
+		assert.Equal(t, tc.internal, resp.Code, "internal "+tc.path)
+
+		req = httptest.NewRequest(tc.method, tc.path, nil)
+		resp = httptest.NewRecorder()
+		public.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code, "public "+tc.path)
+	}
+
+	// The Prometheus metrics include the runtime collectors
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	resp := httptest.NewRecorder()
+	internal.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), "go_goroutines")
+}
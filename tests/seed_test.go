@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/seed"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+func TestParseSeedConfig(t *testing.T) {
+	cfg, err := seed.ParseConfig([]string{"--demo", "--size", "large", "--seed", "42"})
+	assert.NoError(t, err)
+	assert.Equal(t, seed.Sizes["large"], cfg.Size)
+	assert.Equal(t, uint64(42), cfg.Seed)
+	assert.Equal(t, seed.DefaultPassword, cfg.Password)
+
+	// Only the demo dataset is generated, in one of the known sizes
+	_, err = seed.ParseConfig([]string{"--size", "small"})
+	assert.Error(t, err)
+	_, err = seed.ParseConfig([]string{"--demo", "--size", "huge"})
+	assert.Error(t, err)
+}
+
+func TestGenerateDemoDataset(t *testing.T) {
+	validator.InitValidator()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	ds := seed.Generate(seed.Sizes["medium"], 7, now)
+
+	assert.Len(t, ds.Departments, 100)
+	assert.Len(t, ds.Users, 2000)
+
+	// The same seed gives the same dataset
+	again := seed.Generate(seed.Sizes["medium"], 7, now)
+	assert.Equal(t, ds.Departments[10].DeptName, again.Departments[10].DeptName)
+	assert.Equal(t, ds.Users[500].UserName, again.Users[500].UserName)
+
+	// The departments are valid, with unique IDs and names, and count their employees
+	ids, names := map[string]bool{}, map[string]bool{}
+	employees := map[string]int64{}
+	for _, u := range ds.Users {
+		if u.DepartmentID != nil {
+			employees[*u.DepartmentID]++
+		}
+	}
+	for _, d := range ds.Departments {
+		assert.NoError(t, d.Validate(), d.ID)
+		assert.True(t, strings.HasPrefix(d.ID, seed.IDPrefix))
+		assert.False(t, ids[d.ID] || names[strings.ToLower(d.DeptName)], "duplicated department %s", d.ID)
+		ids[d.ID], names[strings.ToLower(d.DeptName)] = true, true
+		assert.Equal(t, employees[d.ID], d.EmployeeCount, d.ID)
+		if d.Status == department.StatusArchived {
+			assert.Zero(t, d.EmployeeCount, d.ID)
+		}
+	}
+
+	// The history periods are closed and end when the department got its current name
+	for _, v := range ds.Versions {
+		assert.True(t, v.ValidFrom.Before(v.ValidTo), v.DepartmentID)
+		assert.True(t, ids[v.DepartmentID])
+	}
+	assert.NotEmpty(t, ds.Versions)
+
+	// The users have unique names and anonymized e-mails within the column limits
+	userNames := map[string]bool{}
+	for _, u := range ds.Users {
+		assert.False(t, userNames[u.UserName], "duplicated user %s", u.UserName)
+		userNames[u.UserName] = true
+		assert.LessOrEqual(t, len(u.UserName), 20)
+		assert.LessOrEqual(t, len([]rune(u.FirstName)), 20)
+		assert.True(t, strings.HasSuffix(u.Email, "@"+seed.EmailDomain), u.Email)
+		assert.False(t, u.LastLogin.Before(*u.CreatedAt) || u.LastLogin.After(now), u.UserName)
+	}
+}
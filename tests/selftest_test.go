@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/selftest"
+)
+
+// fakeSelfTestAPI answers the requests of the self-test like the API, keeping the departments in memory.
+// The department creation fails with 500 when failCreate is set.
+type fakeSelfTestAPI struct {
+	mu          sync.Mutex
+	failCreate  bool
+	departments map[string]string
+	requests    []string
+}
+
+func (f *fakeSelfTestAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req.Method+" "+req.URL.Path+" "+req.Header.Get("Authorization"))
+
+	reply := func(status int, data any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{"status": status, "data": data})
+	}
+	var body map[string]any
+	json.NewDecoder(req.Body).Decode(&body)
+
+	switch {
+	case req.URL.Path == "/readyz":
+		reply(http.StatusOK, nil)
+	case req.URL.Path == "/auth/login":
+		// The token is the name of the user, so the test sees who sent each request
+		reply(http.StatusOK, map[string]string{"accessToken": body["username"].(string), "tokenType": "Bearer"})
+	case req.Method == http.MethodPost && req.URL.Path == "/api/v1/users":
+		reply(http.StatusCreated, map[string]any{"id": 42, "userName": body["userName"]})
+	case req.Method == http.MethodDelete && req.URL.Path == "/api/v1/users/42":
+		reply(http.StatusOK, nil)
+	case req.Method == http.MethodPost && req.URL.Path == "/api/v1/departments":
+		if f.failCreate {
+			reply(http.StatusInternalServerError, nil)
+			return
+		}
+		f.departments[body["id"].(string)] = body["deptName"].(string)
+		reply(http.StatusCreated, body)
+	case strings.HasPrefix(req.URL.Path, "/api/v1/departments/"):
+		id := strings.TrimPrefix(req.URL.Path, "/api/v1/departments/")
+		if _, ok := f.departments[id]; !ok {
+			reply(http.StatusNotFound, nil)
+			return
+		}
+		switch req.Method {
+		case http.MethodPut:
+			f.departments[id] = body["deptName"].(string)
+		case http.MethodDelete:
+			delete(f.departments, id)
+			reply(http.StatusOK, nil)
+			return
+		}
+		reply(http.StatusOK, map[string]string{"id": id, "deptName": f.departments[id]})
+	default:
+		reply(http.StatusNotFound, nil)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	api := &fakeSelfTestAPI{departments: map[string]string{}}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	var out bytes.Buffer
+	code := selftest.Run([]string{"-target", server.URL, "-username", "admin", "-password", "secret"}, &out)
+	require.Equal(t, 0, code, out.String())
+	assert.Contains(t, out.String(), "PASS  update department")
+	assert.Contains(t, out.String(), "PASS  cleanup: remove throwaway user")
+	assert.Contains(t, out.String(), "Self-test passed")
+
+	// The department is written by the throwaway user, and removed with the user
+	assert.Empty(t, api.departments)
+	var deptRequests []string
+	for _, r := range api.requests {
+		if strings.Contains(r, "/api/v1/departments") {
+			deptRequests = append(deptRequests, r)
+		}
+	}
+	require.Len(t, deptRequests, 4)
+	for _, r := range deptRequests {
+		assert.Contains(t, r, "Bearer selftest_")
+	}
+	assert.Equal(t, "DELETE /api/v1/users/42 Bearer admin", api.requests[len(api.requests)-1])
+}
+
+func TestSelfTestFailure(t *testing.T) {
+	api := &fakeSelfTestAPI{departments: map[string]string{}, failCreate: true}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	// A failed check skips the next ones, the throwaway user is still removed
+	var out bytes.Buffer
+	code := selftest.Run([]string{"-target", server.URL, "-username", "admin", "-password", "secret"}, &out)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out.String(), "FAIL  create department")
+	assert.Contains(t, out.String(), "returned 500")
+	assert.Contains(t, out.String(), "SKIP  delete department")
+	assert.Contains(t, out.String(), "PASS  cleanup: remove throwaway user")
+	assert.Contains(t, out.String(), "Self-test failed")
+
+	// The self-test does not run without the admin credentials
+	t.Setenv("SELFTEST_USERNAME", "")
+	t.Setenv("SELFTEST_PASSWORD", "")
+	out.Reset()
+	assert.Equal(t, 2, selftest.Run([]string{"-target", server.URL}, &out))
+	assert.Contains(t, out.String(), "username and password are required")
+}
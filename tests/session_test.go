@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"gorm.io/gorm"
+)
+
+// sampleSessionID is the session of the caller of the mock user service.
+const sampleSessionID = "0b5e2a4c-3f1d-4d7e-9a61-2c8f0e7b9d13"
+
+func TestUserSessions(t *testing.T) {
+	r := SetupUserRouter()
+
+	cases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{http.MethodGet, "/api/v1/users/me/sessions", http.StatusOK},
+		{http.MethodDelete, "/api/v1/users/me/sessions/" + sampleSessionID, http.StatusOK},
+		{http.MethodDelete, "/api/v1/users/me/sessions/unknown", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/users/me/token", http.StatusUnprocessableEntity},
+		{http.MethodPost, "/api/v1/users/1/revoke-sessions", http.StatusOK},
+		{http.MethodPost, "/api/v1/users/9/revoke-sessions", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/users/x/revoke-sessions", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req = req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, "Unexpected status code for "+tc.method+" "+tc.path)
+	}
+
+	// The sessions are listed without their refresh token
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/me/sessions", nil)
+	req = req.WithContext(metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller"}))
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), `"device":"curl/8.5.0"`)
+	assert.Contains(t, resp.Body.String(), `"deviceLabel":"curl"`)
+	assert.Contains(t, resp.Body.String(), `"current":true`)
+	assert.NotContains(t, resp.Body.String(), `"token"`)
+
+	// The sessions are only listed to an authenticated user
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/users/me/sessions", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	db, pool := openRecordingDB(t)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := refreshtoken.NewRefreshTokenService(refreshtoken.NewRefreshTokenRepository(),
+		refreshtoken.WithClock(clock.Fixed(now)), refreshtoken.WithTokenTTL(time.Hour), refreshtoken.WithRememberMeTTL(30*24*time.Hour))
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	// A session is created with its device and address, the expired sessions of the user are removed first
+	created, err := service.CreateRefreshToken(ctx, 3, refreshtoken.Client{Device: strings.Repeat("d", 300), IPAddress: "192.0.2.10"}, false)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.Len(t, created.Device, 255)
+	assert.Equal(t, strings.Repeat("d", 50), created.DeviceLabel)
+	assert.Equal(t, now.Add(time.Hour), created.ExpiryDate)
+	assert.False(t, created.RememberMe)
+	if assert.Len(t, pool.statements, 2) {
+		assert.Contains(t, pool.statements[0], `DELETE FROM "refresh_token" WHERE user_id = $1 AND expiry_date <= $2`)
+		assert.Contains(t, pool.statements[1], `INSERT INTO "refresh_token"`)
+	}
+
+	// A client with an ID replaces its previous session, the sessions of the other clients are kept
+	// A remembered session lives longer
+	pool.statements = nil
+	phone, err := service.CreateRefreshToken(ctx, 3, refreshtoken.Client{ClientID: "phone-7f3a", Device: "App/2.1"}, true)
+	assert.NoError(t, err)
+	assert.True(t, phone.Session().RememberMe)
+	assert.Equal(t, now.Add(30*24*time.Hour), phone.ExpiryDate)
+	assert.Equal(t, "phone-7f3a", phone.ClientID)
+	assert.Equal(t, "phone-7f3a", phone.Session().ClientID)
+	assert.Equal(t, "App/2.1", phone.Session().DeviceLabel)
+	if assert.Len(t, pool.statements, 3) {
+		assert.Contains(t, pool.statements[1], `DELETE FROM "refresh_token" WHERE user_id = $1 AND client_id = $2`)
+		assert.Contains(t, pool.statements[2], `INSERT INTO "refresh_token"`)
+	}
+
+	// The rotation keeps the session and only updates it while it holds the used token,
+	// the fake database matches no row, like a token rotated concurrently
+	pool.statements = nil
+	_, err = service.RotateRefreshToken(ctx, created, refreshtoken.Client{IPAddress: "198.51.100.7"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	if assert.Len(t, pool.statements, 1) {
+		assert.Contains(t, pool.statements[0], `UPDATE "refresh_token" SET`)
+		assert.Contains(t, pool.statements[0], `"device_label"=$2`)
+		assert.Contains(t, pool.statements[0], `WHERE id = $7 AND token = $8`)
+	}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/dbtimeout"
+	dbctx "github.com/yoanesber/Go-Department-CRUD/pkg/middleware/context"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordingPool is a fake connection pool recording the executed statements and whether they had a deadline.
+// Its transactions record into the same pool.
+type recordingPool struct {
+	statements []string
+	deadlines  []bool
+	committed  int
+}
+
+func (p *recordingPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *recordingPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	_, ok := ctx.Deadline()
+	p.statements = append(p.statements, query)
+	p.deadlines = append(p.deadlines, ok)
+	return driverResult(0), nil
+}
+
+func (p *recordingPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *recordingPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p *recordingPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &recordingTx{p}, nil
+}
+
+// recordingTx is a transaction of the recording pool.
+type recordingTx struct {
+	*recordingPool
+}
+
+func (t *recordingTx) Commit() error {
+	t.committed++
+	return nil
+}
+
+func (t *recordingTx) Rollback() error {
+	return nil
+}
+
+// driverResult is the result of the fake statements.
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+// openRecordingDB opens a GORM database on the recording pool.
+func openRecordingDB(t *testing.T) (*gorm.DB, *recordingPool) {
+	pool := &recordingPool{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return db, pool
+}
+
+func TestStatementTimeoutTransaction(t *testing.T) {
+	db, pool := openRecordingDB(t)
+	bounded := dbtimeout.WithStatementTimeout(db, 250*time.Millisecond)
+
+	// The transactions start with SET LOCAL statement_timeout
+	err := bounded.Transaction(func(tx *gorm.DB) error {
+		return tx.Exec("UPDATE department SET active = true").Error
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SET LOCAL statement_timeout = 250", "UPDATE department SET active = true"}, pool.statements)
+	assert.Equal(t, 1, pool.committed)
+
+	// The standalone statements are bounded with a context deadline
+	pool.statements, pool.deadlines = nil, nil
+	require.NoError(t, bounded.Exec("DELETE FROM outbox").Error)
+	assert.Equal(t, []string{"DELETE FROM outbox"}, pool.statements)
+	assert.Equal(t, []bool{true}, pool.deadlines)
+
+	// The database the session was created from is left unbounded
+	pool.statements, pool.deadlines = nil, nil
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error { return tx.Exec("SELECT 1").Error }))
+	assert.Equal(t, []string{"SELECT 1"}, pool.statements)
+	assert.Equal(t, time.Duration(0), dbtimeout.StatementTimeout(db))
+
+	// A new timeout replaces the previous one, and 0 leaves the session unchanged
+	assert.Equal(t, 2*time.Second, dbtimeout.StatementTimeout(dbtimeout.WithStatementTimeout(bounded, 2*time.Second)))
+	assert.Same(t, db, dbtimeout.WithStatementTimeout(db, 0))
+}
+
+func TestStatementTimeoutMiddleware(t *testing.T) {
+	db, _ := openRecordingDB(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(dbcontext.InjectDB(c.Request.Context(), db))
+		c.Next()
+	})
+
+	// The group timeouts apply to the reads and the writes, a route overrides them
+	group := r.Group("/api", dbctx.StatementTimeout(time.Second, 5*time.Second))
+	report := func(c *gin.Context) {
+		c.String(http.StatusOK, dbtimeout.StatementTimeout(dbcontext.GetDB(c.Request.Context())).String())
+	}
+	group.GET("/departments", report)
+	group.POST("/departments", report)
+	group.POST("/bulk", dbctx.StatementTimeout(time.Minute, time.Minute), report)
+
+	for _, tc := range []struct{ method, path, expected string }{
+		{http.MethodGet, "/api/departments", "1s"},
+		{http.MethodPost, "/api/departments", "5s"},
+		{http.MethodPost, "/api/bulk", "1m0s"},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Body.String(), tc.method+" "+tc.path)
+	}
+}
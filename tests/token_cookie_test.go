@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokencookie"
+)
+
+// enableTokenCookies delivers the tokens in cookies for the test.
+func enableTokenCookies(t *testing.T) {
+	// Registered before the variables, so the defaults are reloaded once they are restored
+	t.Cleanup(tokencookie.LoadEnv)
+	t.Setenv("TOKEN_DELIVERY", "cookie")
+	t.Setenv("TOKEN_COOKIE_SECURE", "")
+	t.Setenv("TOKEN_COOKIE_SAMESITE", "")
+	t.Setenv("TOKEN_COOKIE_DOMAIN", "")
+	tokencookie.LoadEnv()
+}
+
+// findCookie returns the named cookie of the response, nil when it is not set.
+func findCookie(resp *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range resp.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestTokenCookieEnv(t *testing.T) {
+	t.Cleanup(tokencookie.LoadEnv)
+
+	t.Setenv("TOKEN_DELIVERY", "")
+	t.Setenv("TOKEN_COOKIE_SECURE", "")
+	t.Setenv("TOKEN_COOKIE_SAMESITE", "")
+	tokencookie.LoadEnv()
+	assert.False(t, tokencookie.Enabled())
+	assert.True(t, tokencookie.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, tokencookie.SameSite)
+
+	t.Setenv("TOKEN_DELIVERY", "COOKIE")
+	t.Setenv("TOKEN_COOKIE_SECURE", "FALSE")
+	t.Setenv("TOKEN_COOKIE_SAMESITE", "lax")
+	tokencookie.LoadEnv()
+	assert.True(t, tokencookie.Enabled())
+	assert.False(t, tokencookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, tokencookie.SameSite)
+
+	// The cross-site cookies are always secure
+	t.Setenv("TOKEN_COOKIE_SAMESITE", "NONE")
+	tokencookie.LoadEnv()
+	assert.True(t, tokencookie.Secure)
+	assert.Equal(t, http.SameSiteNoneMode, tokencookie.SameSite)
+}
+
+func TestLoginTokenDelivery(t *testing.T) {
+	r := SetupAuthRouter()
+	login := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"username":"jane","password":"P@ssw0rd123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The tokens are returned in the body by default
+	resp := login()
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"accessToken":"access-token"`)
+	assert.Nil(t, findCookie(resp, tokencookie.AccessTokenCookie))
+
+	enableTokenCookies(t)
+	resp = login()
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "access-token")
+	assert.NotContains(t, resp.Body.String(), "refresh-token")
+	assert.Contains(t, resp.Body.String(), `"expirationDate"`)
+
+	access := findCookie(resp, tokencookie.AccessTokenCookie)
+	require.NotNil(t, access)
+	assert.Equal(t, "access-token", access.Value)
+	assert.Equal(t, "/", access.Path)
+	assert.True(t, access.HttpOnly)
+	assert.True(t, access.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, access.SameSite)
+	assert.InDelta(t, time.Hour.Seconds(), float64(access.MaxAge), 5)
+
+	refresh := findCookie(resp, tokencookie.RefreshTokenCookie)
+	require.NotNil(t, refresh)
+	assert.Equal(t, "refresh-token", refresh.Value)
+	assert.Equal(t, tokencookie.RefreshTokenPath, refresh.Path)
+	assert.True(t, refresh.HttpOnly)
+	assert.InDelta(t, (24 * time.Hour).Seconds(), float64(refresh.MaxAge), 5)
+}
+
+func TestRefreshTokenCookie(t *testing.T) {
+	r := SetupAuthRouter()
+	refresh := func(body string, cookie string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/auth/refresh-token", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: tokencookie.RefreshTokenCookie, Value: cookie})
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The cookie is ignored when the tokens are delivered in the body
+	assert.Equal(t, http.StatusBadRequest, refresh("", "refresh-token").Code)
+	assert.Equal(t, http.StatusBadRequest, refresh(`{}`, "refresh-token").Code)
+	resp := refresh(`{"refreshToken":"refresh-token"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"refreshToken":"rotated-refresh-token"`)
+
+	enableTokenCookies(t)
+	cases := []struct {
+		name     string
+		body     string
+		cookie   string
+		expected int
+	}{
+		{"cookie without body", "", "refresh-token", http.StatusOK},
+		{"cookie with an empty body", `{}`, "refresh-token", http.StatusOK},
+		{"body over cookie", `{"refreshToken":"refresh-token"}`, "unknown", http.StatusOK},
+		{"unknown cookie", "", "unknown", http.StatusUnauthorized},
+		{"no refresh token", "", "", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		resp := refresh(tc.body, tc.cookie)
+		assert.Equal(t, tc.expected, resp.Code, tc.name)
+		if tc.expected == http.StatusOK {
+			assert.NotContains(t, resp.Body.String(), "rotated-refresh-token", tc.name)
+			cookie := findCookie(resp, tokencookie.RefreshTokenCookie)
+			require.NotNil(t, cookie, tc.name)
+			assert.Equal(t, "rotated-refresh-token", cookie.Value, tc.name)
+		}
+	}
+}
+
+func TestJwtValidationCookie(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "cookie-secret")
+
+	now := time.Now()
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())).SignedString([]byte("cookie-secret"))
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	newRouter := func() *gin.Engine {
+		r := gin.New()
+		r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		r.GET("/optional", authorization.OptionalAuthentication(), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		return r
+	}
+	get := func(r *gin.Engine, path string, header string, cookie string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: tokencookie.AccessTokenCookie, Value: cookie})
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// The cookie is ignored when the tokens are delivered in the body
+	r := newRouter()
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/me", "", token))
+	assert.Equal(t, http.StatusNoContent, get(r, "/optional", "", "invalid"))
+
+	enableTokenCookies(t)
+	r = newRouter()
+	assert.Equal(t, http.StatusNoContent, get(r, "/me", "", token))
+	assert.Equal(t, http.StatusNoContent, get(r, "/me", "Bearer "+token, ""))
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/me", "", "invalid"))
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/me", "", ""))
+
+	// The header wins over the cookie
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/me", "Bearer invalid", token))
+
+	// An invalid cookie is refused rather than ignored
+	assert.Equal(t, http.StatusUnauthorized, get(r, "/optional", "", "invalid"))
+	assert.Equal(t, http.StatusNoContent, get(r, "/optional", "", token))
+	assert.Equal(t, http.StatusNoContent, get(r, "/optional", "", ""))
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/clock"
+)
+
+// issueTestToken signs an HS256 access token for a test user, issued at the time of the given clock.
+func issueTestToken(t *testing.T, c clock.Clock) string {
+	t.Setenv("JWT_ALGORITHM", jwt.SigningMethodHS256.Alg())
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_EXPIRATION_HOUR", "1")
+	auth.LoadEnv()
+
+	now := c.Now().Unix()
+	claims := auth.NewJWTClaims(user.User{ID: 1, UserName: "john"}, now, auth.GetJWTExpiration(now))
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(auth.JWTSecret))
+	assert.NoError(t, err)
+
+	return token
+}
+
+func TestRefreshTokenExpiryBoundaries(t *testing.T) {
+	exp := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewSimulated(exp.Add(-time.Nanosecond))
+	service := refreshtoken.NewRefreshTokenService(nil, refreshtoken.WithClock(c))
+
+	// Valid until the last instant before the expiration date
+	ok, err := service.VerifyExpirationDate(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// Expired from the expiration date on
+	c.Advance(time.Nanosecond)
+	ok, err = service.VerifyExpirationDate(context.Background(), exp)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	c.Advance(time.Hour)
+	ok, _ = service.VerifyExpirationDate(context.Background(), exp)
+	assert.False(t, ok)
+
+	// A clock moved backwards, e.g. by the skew of another instance, sees the token valid again
+	c.Set(exp.Add(-time.Second))
+	ok, _ = service.VerifyExpirationDate(context.Background(), exp)
+	assert.True(t, ok)
+}
+
+func TestRefreshTokenExpiryZeroTimes(t *testing.T) {
+	// A zero expiration date is rejected whatever the time
+	service := refreshtoken.NewRefreshTokenService(nil, refreshtoken.WithClock(clock.Fixed(time.Time{})))
+	ok, err := service.VerifyExpirationDate(context.Background(), time.Time{})
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	// A clock at the zero time sees any real expiration date in the future
+	ok, err = service.VerifyExpirationDate(context.Background(), time.Unix(0, 0))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRefreshTokenExpiryAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// The clocks spring forward on 2024-03-10 at 02:00, the day only has 23 hours
+	t.Setenv("JWT_REFRESH_TOKEN_EXPIRATION_HOUR", "24")
+	issuedAt := time.Date(2024, 3, 10, 1, 30, 0, 0, newYork)
+	exp := refreshtoken.GetRefreshTokenExpiration(issuedAt)
+	assert.Equal(t, 24*time.Hour, exp.Sub(issuedAt))
+	assert.Equal(t, 2, exp.Hour())
+
+	// Still valid at the same wall clock time on the next day, only 23 hours later
+	c := clock.NewSimulated(time.Date(2024, 3, 11, 1, 30, 0, 0, newYork))
+	service := refreshtoken.NewRefreshTokenService(nil, refreshtoken.WithClock(c))
+	ok, _ := service.VerifyExpirationDate(context.Background(), exp)
+	assert.True(t, ok)
+
+	// The comparison does not depend on the location of the dates
+	c.Set(exp.UTC())
+	ok, _ = service.VerifyExpirationDate(context.Background(), exp)
+	assert.False(t, ok)
+}
+
+func TestAccessTokenExpiryWithSimulatedClock(t *testing.T) {
+	issuedAt := time.Date(2024, 11, 3, 1, 30, 0, 0, time.UTC)
+	c := clock.NewSimulated(issuedAt)
+	token := issueTestToken(t, c)
+
+	// The token is valid for JWT_EXPIRATION_HOUR from the time of the clock
+	parsed, err := auth.ParseJWTToken(token, jwt.WithTimeFunc(c.Now))
+	assert.NoError(t, err)
+	expirationDate, err := auth.GetExpirationDateFromToken(parsed)
+	assert.NoError(t, err)
+	assert.Equal(t, issuedAt.Add(time.Hour).Format(time.RFC3339), expirationDate)
+
+	c.Advance(time.Hour - time.Second)
+	_, err = auth.ParseJWTToken(token, jwt.WithTimeFunc(c.Now))
+	assert.NoError(t, err)
+
+	// Expired from the exp claim on
+	c.Advance(time.Second)
+	_, err = auth.ParseJWTToken(token, jwt.WithTimeFunc(c.Now))
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	// A verifier whose clock runs ahead rejects it earlier, unless a leeway covers the skew
+	c.Set(issuedAt.Add(time.Hour + 30*time.Second))
+	_, err = auth.ParseJWTToken(token, jwt.WithTimeFunc(c.Now), jwt.WithLeeway(time.Minute))
+	assert.NoError(t, err)
+}
+
+func TestAccessTokenExpiryDefaults(t *testing.T) {
+	now := time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC).Unix()
+
+	// An invalid or non-positive JWT_EXPIRATION_HOUR falls back to 24 hours
+	for _, value := range []string{"", "abc", "0", "-1"} {
+		t.Setenv("JWT_EXPIRATION_HOUR", value)
+		assert.Equal(t, now+int64((24*time.Hour).Seconds()), auth.GetJWTExpiration(now), value)
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/revocation"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+)
+
+func TestJWTClaimsUniqueID(t *testing.T) {
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+	now := time.Now().Unix()
+
+	// Two tokens issued in the same second still have their own ID
+	first, second := auth.NewJWTClaims(u, now, now+900), auth.NewJWTClaims(u, now, now+900)
+	assert.NotEmpty(t, first["jti"])
+	assert.NotEqual(t, first["jti"], second["jti"])
+}
+
+func TestJWTValidationRevokedToken(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "revocation-secret")
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(dbcontext.InjectRedisClient(c.Request.Context(), client))
+	})
+	r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+		meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"tokenId": meta.TokenID})
+	})
+
+	now := time.Now()
+	sign := func(u user.User) (string, string) {
+		claims := auth.NewJWTClaims(u, now.Unix(), now.Add(15*time.Minute).Unix())
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("revocation-secret"))
+		require.NoError(t, err)
+		return token, claims["jti"].(string)
+	}
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	john := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+	revoked, revokedID := sign(john)
+	other, _ := sign(john)
+	assert.Equal(t, http.StatusOK, call(revoked))
+
+	// The revoked token is rejected, the other tokens of the user stay valid
+	require.NoError(t, revocation.RevokeToken(context.Background(), client, revokedID, now.Add(15*time.Minute)))
+	assert.Equal(t, http.StatusUnauthorized, call(revoked))
+	assert.Equal(t, http.StatusOK, call(other))
+
+	// The revocation of the user still rejects all its tokens issued until then
+	jane := user.User{ID: 3, UserName: "jane", UserType: user.UserAccount}
+	token, _ := sign(jane)
+	require.NoError(t, revocation.RevokeUser(context.Background(), client, jane.ID, jane.UserName, now))
+	assert.Equal(t, http.StatusUnauthorized, call(token))
+}
+
+func TestRevokeToken(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	service := user.NewUserService(&emailChangeRepository{})
+	ctx := dbcontext.InjectRedisClient(context.Background(), client)
+	expiresAt := time.Now().Add(15 * time.Minute)
+
+	// The token is added to the denylist by its ID
+	require.NoError(t, service.RevokeToken(ctx, "5d1c7d0e-8a43-4b7e-b0a5-2f4c1e9d6a70", expiresAt))
+	revoked, err := revocation.IsRevoked(ctx, client, 2, "", "5d1c7d0e-8a43-4b7e-b0a5-2f4c1e9d6a70", time.Now())
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// The tokens without an ID and the revocation without Redis are refused
+	assert.ErrorIs(t, service.RevokeToken(ctx, "", expiresAt), user.ErrTokenNotRevocable)
+	assert.ErrorIs(t, service.RevokeToken(context.Background(), "5d1c7d0e-8a43-4b7e-b0a5-2f4c1e9d6a70", expiresAt), user.ErrRevocationOff)
+}
+
+func TestResetPasswordRevokesTokens(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "revocation-secret")
+	validator.InitValidator()
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	db, pool := openRecordingDB(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(dbcontext.InjectRedisClient(c.Request.Context(), client))
+	})
+	r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	john := user.User{ID: 2, UserName: "john", FirstName: "John", Email: "john@example.com", UserType: user.UserAccount}
+	issuedAt := time.Now().Add(-time.Minute)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.NewJWTClaims(john, issuedAt.Unix(), issuedAt.Add(15*time.Minute).Unix())).SignedString([]byte("revocation-secret"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, call(token))
+
+	// The reset removes the refresh tokens of the user and revokes the access tokens issued with the old password
+	repo := &enableRepository{restoreRepository{emailChangeRepository{users: map[int64]user.User{2: john}}}}
+	service := user.NewUserService(repo, user.WithEventBus(&recordingBus{}))
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+	require.NoError(t, service.ResetPassword(ctx, 2, "N3w-P@ssw0rd!"))
+	require.Len(t, pool.statements, 1)
+	assert.Contains(t, pool.statements[0], `DELETE FROM "refresh_token"`)
+	assert.Equal(t, http.StatusUnauthorized, call(token))
+}
+
+func TestRevocationFailsOpen(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "revocation-secret")
+	validator.InitValidator()
+	failing := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, reply("-ERR connection lost\r\n")), MaxRetries: -1})
+	t.Cleanup(func() { failing.Close() })
+
+	john := user.User{ID: 2, UserName: "john", FirstName: "John", Email: "john@example.com", UserType: user.UserAccount}
+	issuedAt := time.Now().Add(-time.Minute)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.NewJWTClaims(john, issuedAt.Unix(), issuedAt.Add(15*time.Minute).Unix())).SignedString([]byte("revocation-secret"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		client *redis.Client
+	}{
+		{"without redis", nil},
+		{"redis failing", failing},
+	} {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			if tc.client != nil {
+				c.Request = c.Request.WithContext(dbcontext.InjectRedisClient(c.Request.Context(), tc.client))
+			}
+		})
+		r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		// The revocation cannot be checked, the access tokens stay valid until they expire
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code, tc.name)
+	}
+
+	// Without Redis, the user is still disabled and its refresh tokens removed, so it cannot renew its access tokens
+	db, pool := openRecordingDB(t)
+	enabled := true
+	john.IsEnabled = &enabled
+	repo := &enableRepository{restoreRepository{emailChangeRepository{users: map[int64]user.User{2: john}}}}
+	service := user.NewUserService(repo, user.WithEventBus(&recordingBus{}))
+	ctx := metacontext.InjectRequestMeta(dbcontext.InjectDB(context.Background(), db), metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+	_, err = service.DisableUser(ctx, 2)
+	require.NoError(t, err)
+	assert.False(t, *repo.users[2].IsEnabled)
+	require.Len(t, pool.statements, 1)
+	assert.Contains(t, pool.statements[0], `DELETE FROM "refresh_token"`)
+}
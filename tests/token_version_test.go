@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/config/db/redisdb"
+	"github.com/yoanesber/Go-Department-CRUD/internal/auth"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/tokenversion"
+	"github.com/yoanesber/Go-Department-CRUD/routes"
+)
+
+// fakeTokenVersionRedis returns a fake Redis client keeping the token version, whose publications are recorded.
+// The other commands are answered by fakeRedisStore.
+func fakeTokenVersionRedis(t *testing.T) (*redis.Client, func() []string) {
+	var mu sync.Mutex
+	var version int64
+	var published []string
+	store := fakeRedisStore()
+
+	handler := func(cmd []string) string {
+		switch strings.ToUpper(cmd[0]) {
+		case "INCR":
+			mu.Lock()
+			defer mu.Unlock()
+			version++
+			return ":" + strconv.FormatInt(version, 10) + "\r\n"
+		case "PUBLISH":
+			mu.Lock()
+			defer mu.Unlock()
+			published = append(published, cmd[1]+" "+cmd[2])
+			return ":0\r\n"
+		}
+		return store(cmd)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, handler), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return published
+	}
+}
+
+func TestTokenVersionBump(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "token-version-secret")
+	t.Cleanup(tokenversion.Reset)
+	tokenversion.Reset()
+	client, published := fakeTokenVersionRedis(t)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(dbcontext.InjectRedisClient(c.Request.Context(), client))
+	})
+	r.GET("/me", authorization.JwtValidation(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	u := user.User{ID: 2, UserName: "john", UserType: user.UserAccount}
+	issue := func() (string, jwt.MapClaims) {
+		now := time.Now()
+		claims := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("token-version-secret"))
+		require.NoError(t, err)
+		return token, claims
+	}
+	call := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	older, claims := issue()
+	assert.Equal(t, int64(0), claims["tokenversion"])
+	assert.Equal(t, http.StatusNoContent, call(older).Code)
+
+	// The bump is applied locally and broadcast to the other instances
+	version, err := tokenversion.Bump(t.Context(), client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Equal(t, int64(1), tokenversion.Current())
+	assert.Equal(t, []string{tokenversion.RedisChannel + " 1"}, published())
+
+	// The tokens issued before the bump are refused
+	resp := call(older)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), "Token has been revoked")
+
+	// A newly issued token carries the current version and is accepted
+	newer, claims := issue()
+	assert.Equal(t, int64(1), claims["tokenversion"])
+	assert.Equal(t, http.StatusNoContent, call(newer).Code)
+}
+
+func TestTokenVersionAdminEndpoint(t *testing.T) {
+	t.Setenv("TOKEN_TYPE", "Bearer")
+	t.Setenv("JWT_SECRET", "token-version-secret")
+	t.Cleanup(tokenversion.Reset)
+	tokenversion.Reset()
+
+	client, published := fakeTokenVersionRedis(t)
+	previous := redisdb.RedisClient
+	redisdb.RedisClient = client
+	t.Cleanup(func() { redisdb.RedisClient = previous })
+
+	gin.SetMode(gin.TestMode)
+	r := routes.SetupAdminRouter()
+
+	sign := func(roles ...string) string {
+		u := user.User{ID: 1, UserName: "admin", UserType: user.UserAccount}
+		now := time.Now()
+		claims := auth.NewJWTClaims(u, now.Unix(), now.Add(time.Hour).Unix())
+		claims["roles"] = roles
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("token-version-secret"))
+		require.NoError(t, err)
+		return token
+	}
+	bump := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/token-version/bump", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Only the admins can bump the version
+	assert.Equal(t, http.StatusUnauthorized, bump("").Code)
+	assert.Equal(t, http.StatusForbidden, bump(sign("ROLE_USER")).Code)
+	assert.Equal(t, int64(0), tokenversion.Current())
+	assert.Empty(t, published())
+
+	resp := bump(sign("ROLE_ADMIN"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"tokenVersion":1`)
+	assert.Equal(t, int64(1), tokenversion.Current())
+}
+
+func TestInitTokenVersion(t *testing.T) {
+	t.Cleanup(tokenversion.Reset)
+	t.Cleanup(tokenversion.LoadEnv)
+
+	for _, tc := range []struct {
+		name       string
+		minVersion string
+		failures   int
+		stored     string
+		expected   int64
+		err        bool
+	}{
+		{"missing version", "", 0, "", 0, false},
+		{"stored version", "", 0, "4", 4, false},
+		{"raised to the minimum version", "7", 0, "4", 7, false},
+		{"read retried", "", 2, "4", 4, false},
+		{"read failing", "7", 3, "4", 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TOKEN_VERSION", tc.minVersion)
+			tokenversion.LoadEnv()
+			tokenversion.Reset()
+
+			// The fake Redis fails the first reads of the version, as while it is loading its dataset
+			var mu sync.Mutex
+			stored, reads := tc.stored, 0
+			client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, func(cmd []string) string {
+				mu.Lock()
+				defer mu.Unlock()
+				switch strings.ToUpper(cmd[0]) {
+				case "GET":
+					if reads++; reads <= tc.failures {
+						return "-LOADING Redis is loading the dataset in memory\r\n"
+					}
+					if stored == "" {
+						return "$-1\r\n"
+					}
+					return "$" + strconv.Itoa(len(stored)) + "\r\n" + stored + "\r\n"
+				case "SET":
+					stored = cmd[2]
+					return "+OK\r\n"
+				case "PUBLISH":
+					return ":0\r\n"
+				case "SUBSCRIBE":
+					return "*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(cmd[1])) + "\r\n" + cmd[1] + "\r\n:1\r\n"
+				}
+				return "-ERR unknown command\r\n"
+			}), MaxRetries: -1})
+			t.Cleanup(func() { client.Close() })
+
+			// The application does not start with an unknown version, nor raises it
+			err := tokenversion.InitTokenVersion(client)
+			if tc.err {
+				assert.Error(t, err)
+				assert.Equal(t, 3, reads)
+				assert.Equal(t, "4", stored)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, tokenversion.Current())
+		})
+	}
+
+	// The minimum version is enforced through Redis, so it requires Redis
+	t.Setenv("TOKEN_VERSION", "0")
+	tokenversion.LoadEnv()
+	assert.False(t, tokenversion.Enabled())
+	t.Setenv("TOKEN_VERSION", "3")
+	tokenversion.LoadEnv()
+	assert.True(t, tokenversion.Enabled())
+	assert.Error(t, tokenversion.InitTokenVersion(nil))
+}
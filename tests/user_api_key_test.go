@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/middleware/authorization"
+	"gorm.io/gorm"
+)
+
+func TestIssueAPIKey(t *testing.T) {
+	r := SetupUserRouter()
+
+	for id, expected := range map[string]int{"5": http.StatusCreated, "1": http.StatusUnprocessableEntity, "9": http.StatusNotFound, "x": http.StatusBadRequest} {
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/users/"+id+"/api-keys", bytes.NewBufferString(`{"name":"hr-sync"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, "Unexpected status code for user "+id)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/users/5/api-keys", bytes.NewBufferString(`{"name":"hr-sync","expiresInDays":30}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+
+	// The key is returned once, its digest never is
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.True(t, strings.HasPrefix(body.Data["key"].(string), user.APIKeyPrefix))
+	assert.NotContains(t, body.Data, "keyHash")
+
+	// A key needs a name
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/users/5/api-keys", bytes.NewBufferString(`{"expiresInDays":30}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestGetAndRevokeAPIKeys(t *testing.T) {
+	r := SetupUserRouter()
+
+	for path, expected := range map[string]int{"/api/v1/users/5/api-keys": http.StatusOK, "/api/v1/users/9/api-keys": http.StatusNotFound} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, expected, resp.Code, path)
+	}
+
+	for keyID, expected := range map[string]int{
+		sampleAPIKeyID:                         http.StatusOK,
+		"0f0c3e2a-8d7b-4c1e-9a6f-2b3d4e5f6a7b": http.StatusNotFound,
+		"not-a-uuid":                           http.StatusBadRequest,
+	} {
+		req, _ := http.NewRequest(http.MethodDelete, "/api/v1/users/5/api-keys/"+keyID, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, expected, resp.Code, keyID)
+	}
+}
+
+func TestAPIKeyAuthenticationResolvers(t *testing.T) {
+	t.Cleanup(func() { apikey.SetResolvers() })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", authorization.APIKeyAuthentication(), func(c *gin.Context) {
+		meta, _ := metacontext.ExtractRequestMeta(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"user": meta.UserName, "automation": meta.Automation, "scoped": meta.DepartmentScoped, "d001": meta.InDepartmentScope("d001")})
+	})
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set(apikey.Header, key)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The keys missing from the identities file are checked by the resolvers, with the scope of the service account
+	apikey.SetResolvers(func(ctx context.Context, key string) (apikey.Identity, bool, error) {
+		if key == "dsa_valid-key" {
+			return apikey.Identity{Name: "hr-sync", UserID: 5, Roles: []string{"ROLE_USER"}, Departments: []string{"d001"}}, true, nil
+		}
+		if key == "dsa_broken" {
+			return apikey.Identity{}, false, errors.New("database is down")
+		}
+		return apikey.Identity{}, false, nil
+	})
+
+	resp := get("dsa_valid-key")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"user":"hr-sync","automation":true,"scoped":true,"d001":true}`, resp.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, get("dsa_unknown").Code)
+	assert.Equal(t, http.StatusInternalServerError, get("dsa_broken").Code)
+}
+
+// apiKeyRepository is a user repository holding a service account and its API keys.
+// The methods the API key resolution does not use are left unimplemented.
+type apiKeyRepository struct {
+	user.UserRepository
+	users   map[int64]user.User
+	keys    map[string]user.APIKey
+	touched []string
+}
+
+func (r *apiKeyRepository) GetAPIKeyByHash(tx *gorm.DB, hash string) (user.APIKey, error) {
+	k, ok := r.keys[hash]
+	if !ok {
+		return user.APIKey{}, user.ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+func (r *apiKeyRepository) GetUserByID(tx *gorm.DB, id int64) (user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *apiKeyRepository) TouchAPIKey(ctx context.Context, tx *gorm.DB, id string, usedAt time.Time, interval time.Duration) error {
+	r.touched = append(r.touched, id)
+	return nil
+}
+
+func TestResolveAPIKey(t *testing.T) {
+	enabled, disabled := true, false
+	serviceAccount := user.User{
+		ID:                  5,
+		UserName:            "hr-sync",
+		UserType:            user.ServiceAccount,
+		IsEnabled:           &enabled,
+		IsAccountNonLocked:  &enabled,
+		IsAccountNonExpired: &enabled,
+		DepartmentScope:     user.DepartmentScope{"d001"},
+		Roles:               []role.Role{{Name: "ROLE_USER"}},
+	}
+	disabledAccount := serviceAccount
+	disabledAccount.ID = 6
+	disabledAccount.IsEnabled = &disabled
+
+	now := time.Now()
+	revokedAt := now.Add(-time.Hour)
+	repo := &apiKeyRepository{
+		users: map[int64]user.User{5: serviceAccount, 6: disabledAccount},
+		keys: map[string]user.APIKey{
+			apikey.HashKey("dsa_valid-key-of-hr-sync"):    {ID: "k1", UserID: 5, ExpiresAt: now.Add(time.Hour)},
+			apikey.HashKey("dsa_expired-key-of-hr-sync"):  {ID: "k2", UserID: 5, ExpiresAt: now.Add(-time.Hour)},
+			apikey.HashKey("dsa_revoked-key-of-hr-sync"):  {ID: "k3", UserID: 5, ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt},
+			apikey.HashKey("dsa_key-of-disabled-account"): {ID: "k4", UserID: 6, ExpiresAt: now.Add(time.Hour)},
+		},
+	}
+	service := user.NewUserService(repo)
+	db, _ := openRecordingDB(t)
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	identity, ok, err := service.ResolveAPIKey(ctx, "dsa_valid-key-of-hr-sync")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, apikey.Identity{Name: "hr-sync", UserID: 5, Roles: []string{"ROLE_USER"}, Departments: []string{"d001"}}, identity)
+	assert.Equal(t, []string{"k1"}, repo.touched)
+
+	// The expired and revoked keys, the keys of the disabled accounts and the other formats are refused
+	for _, key := range []string{"dsa_expired-key-of-hr-sync", "dsa_revoked-key-of-hr-sync", "dsa_key-of-disabled-account", "dsa_unknown-key-000", "terraform-key", "dsa_"} {
+		_, ok, err := service.ResolveAPIKey(ctx, key)
+		assert.NoError(t, err, key)
+		assert.False(t, ok, key)
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+)
+
+func TestDiffUsers(t *testing.T) {
+	before := GetSampleUser()
+	before.Password = "old-hash"
+	after := before
+	after.Password = "new-hash"
+	after.FirstName = "Renamed"
+	disabled := false
+	after.IsEnabled = &disabled
+	lastName := "Doe"
+	after.LastName = &lastName
+
+	changes, err := user.DiffUsers(before, after)
+	require.NoError(t, err)
+
+	// The password hash is never audited, the unset fields are nil
+	assert.Equal(t, user.AuditChanges{
+		"firstName": {Before: "Admin", After: "Renamed"},
+		"isEnabled": {Before: true, After: false},
+		"lastName":  {Before: nil, After: "Doe"},
+	}, changes)
+
+	// The bookkeeping fields are left out
+	updatedBy := int64(3)
+	after = before
+	after.UpdatedBy = &updatedBy
+	changes, err = user.DiffUsers(before, after)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestDiffRoles(t *testing.T) {
+	before := GetSampleUser()
+	after := before
+	after.Roles = []role.Role{{Name: "role_user"}, {Name: "ROLE_ADMIN"}}
+
+	assert.Equal(t, user.AuditChanges{
+		"roles": {Before: []string{"ROLE_ADMIN"}, After: []string{"ROLE_ADMIN", "ROLE_USER"}},
+	}, user.DiffRoles(before, after))
+
+	// The roles are compared by name, whatever their order and case
+	after.Roles = []role.Role{{Name: "role_admin"}}
+	assert.Nil(t, user.DiffRoles(before, after))
+
+	// A new user has no roles before
+	assert.Equal(t, user.AuditChanges{
+		"roles": {Before: nil, After: []string{"ROLE_ADMIN"}},
+	}, user.DiffRoles(user.User{}, before))
+}
+
+func TestNewAuditEntry(t *testing.T) {
+	ctx := metacontext.InjectRequestMeta(context.Background(), metacontext.RequestMeta{
+		UserID:         3,
+		UserName:       "caller",
+		ImpersonatedBy: 7,
+		RequestID:      "9b2f6c1e-2f4d-4a7b-8d0e-1c2b3a4d5e6f",
+	})
+
+	entry := user.NewAuditEntry(ctx, 1, user.AuditDisabled, nil)
+	assert.Equal(t, int64(1), entry.UserID)
+	assert.Equal(t, user.AuditDisabled, entry.Action)
+	require.NotNil(t, entry.ActorID)
+	assert.Equal(t, int64(3), *entry.ActorID)
+	assert.Equal(t, "caller", entry.ActorName)
+	require.NotNil(t, entry.ImpersonatedBy)
+	assert.Equal(t, int64(7), *entry.ImpersonatedBy)
+	assert.Equal(t, "9b2f6c1e-2f4d-4a7b-8d0e-1c2b3a4d5e6f", entry.RequestID)
+
+	// Without an authenticated request there is no actor
+	entry = user.NewAuditEntry(context.Background(), 1, user.AuditPasswordReset, nil)
+	assert.Nil(t, entry.ActorID)
+	assert.Empty(t, entry.RequestID)
+}
+
+func TestAuditChangesValue(t *testing.T) {
+	value, err := user.AuditChanges(nil).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "{}", value)
+
+	changes := user.AuditChanges{"isEnabled": {Before: true, After: false}}
+	value, err = changes.Value()
+	require.NoError(t, err)
+
+	var scanned user.AuditChanges
+	require.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, changes, scanned)
+}
+
+func TestGetUserAudit(t *testing.T) {
+	r := SetupUserRouter()
+
+	// The trail of a deleted user is kept
+	for id, expected := range map[string]int{"1": http.StatusOK, "2": http.StatusOK, "9": http.StatusNotFound, "x": http.StatusBadRequest} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/"+id+"/audit", nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, "Unexpected status code for user "+id)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/1/audit?limit=1", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var body struct {
+		Data []user.AuditEntry `json:"data"`
+		Meta struct {
+			NextCursor string `json:"nextCursor"`
+		} `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, user.AuditCreated, body.Data[0].Action)
+	assert.NotEmpty(t, body.Meta.NextCursor)
+}
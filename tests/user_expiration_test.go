@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/maintenance"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/scheduler"
+	"gorm.io/gorm"
+)
+
+// expirationRepository is a user repository holding the users checked by the expiration job.
+// The methods the expiration does not use are left unimplemented.
+type expirationRepository struct {
+	user.UserRepository
+	users   map[int64]user.User
+	audited []user.AuditEntry
+}
+
+func (r *expirationRepository) GetExpiringUserIDs(tx *gorm.DB, now time.Time, afterID int64, limit int) ([]int64, error) {
+	// Every user is a candidate, the service checks the dates again once the user is locked
+	var ids []int64
+	for id := afterID + 1; id <= int64(len(r.users)) && len(ids) < limit; id++ {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *expirationRepository) LockUser(tx *gorm.DB, id int64) error {
+	return nil
+}
+
+func (r *expirationRepository) GetUserByID(tx *gorm.DB, id int64) (user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *expirationRepository) SetUserExpired(ctx context.Context, tx *gorm.DB, u user.User, account bool, credentials bool) (user.User, error) {
+	expired := false
+	if account {
+		u.IsAccountNonExpired = &expired
+	}
+	if credentials {
+		u.IsCredentialsNonExpired = &expired
+	}
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *expirationRepository) AddAuditEntry(ctx context.Context, tx *gorm.DB, entry user.AuditEntry) error {
+	r.audited = append(r.audited, entry)
+	return nil
+}
+
+func TestExpireUsers(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	active := func(id int64, accountExpiration, credentialsExpiration *time.Time) user.User {
+		nonExpired := true
+		return user.User{ID: id, UserName: "user" + string(rune('0'+id)), IsAccountNonExpired: &nonExpired, IsCredentialsNonExpired: &nonExpired,
+			AccountExpirationDate: accountExpiration, CredentialsExpirationDate: credentialsExpiration}
+	}
+	repo := &expirationRepository{users: map[int64]user.User{
+		1: active(1, &past, nil),
+		2: active(2, nil, &past),
+		3: active(3, &future, &future),
+		4: active(4, nil, nil),
+	}}
+	bus := &recordingBus{}
+	service := user.NewUserService(repo, user.WithEventBus(bus))
+
+	db, pool := openRecordingDB(t)
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	expired, err := service.ExpireUsers(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, []user.ExpiredUser{
+		{ID: 1, UserName: "user1", Account: true},
+		{ID: 2, UserName: "user2", Credentials: true},
+	}, expired)
+	assert.False(t, *repo.users[1].IsAccountNonExpired)
+	assert.True(t, *repo.users[1].IsCredentialsNonExpired)
+	assert.False(t, *repo.users[2].IsCredentialsNonExpired)
+	assert.True(t, *repo.users[3].IsAccountNonExpired)
+
+	// Only the sessions of the expired account are revoked
+	assert.Equal(t, []string{`DELETE FROM "refresh_token" WHERE user_id = $1`}, pool.statements)
+
+	// Each expiration is audited and published
+	require.Len(t, repo.audited, 2)
+	assert.Equal(t, user.AuditExpired, repo.audited[0].Action)
+	assert.Contains(t, repo.audited[0].Changes, "isAccountNonExpired")
+	assert.Contains(t, repo.audited[1].Changes, "isCredentialsNonExpired")
+	require.Len(t, bus.events, 2)
+	assert.Equal(t, event.UserUpdated, bus.events[0].Type)
+
+	// The expired users are not expired again
+	expired, err = service.ExpireUsers(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	assert.Len(t, bus.events, 2)
+}
+
+func TestSchedulerRunJob(t *testing.T) {
+	runs := 0
+	job := scheduler.Job{Name: "test", Interval: time.Minute, Writes: true, Run: func(ctx context.Context) error {
+		runs++
+		return errors.New("failed")
+	}}
+
+	// A failed run is only logged
+	scheduler.RunJob(context.Background(), job)
+	assert.Equal(t, 1, runs)
+
+	// The jobs writing to the database wait for the end of the maintenance
+	maintenance.Set(maintenance.State{Enabled: true})
+	t.Cleanup(func() { maintenance.Set(maintenance.State{}) })
+	scheduler.RunJob(context.Background(), job)
+	assert.Equal(t, 1, runs)
+
+	job.Writes = false
+	scheduler.RunJob(context.Background(), job)
+	assert.Equal(t, 2, runs)
+
+	// The disabled jobs are never started, and the scheduler stops once the runs in progress are done
+	scheduler.Schedule(scheduler.Job{Name: "disabled", Run: func(ctx context.Context) error { runs++; return nil }})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, scheduler.Stop(ctx))
+	assert.Equal(t, 2, runs)
+}
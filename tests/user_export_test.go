@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+)
+
+// exportUsersAs requests the user export as a caller with the given roles.
+func exportUsersAs(t *testing.T, roles ...string) (*httptest.ResponseRecorder, *mockUserService) {
+	r, service := setupUserRouter()
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/export", nil)
+	ctx := metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{
+		UserID:    3,
+		UserName:  "caller",
+		Roles:     roles,
+		RequestID: "9b2f6c1e-2f4d-4a7b-8d0e-1c2b3a4d5e6f",
+	})
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req.WithContext(ctx))
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Disposition"), `filename="users.csv"`)
+	return resp, service
+}
+
+func TestExportUsersAsAdmin(t *testing.T) {
+	resp, service := exportUsersAs(t, "ROLE_ADMIN")
+
+	lines := strings.Split(strings.TrimSuffix(resp.Body.String(), "\r\n"), "\r\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "ID,User name,Email,First name,Last name,Enabled,User type,Department,Roles,Last login,Created at", lines[0])
+	assert.Equal(t, "1,admin,admin@example.com,Admin,,true,USER_ACCOUNT,,ROLE_ADMIN,,", lines[1])
+
+	// The complete exports are not audited
+	assert.Empty(t, service.exports)
+}
+
+func TestExportUsersMasked(t *testing.T) {
+	resp, service := exportUsersAs(t, "ROLE_USER")
+
+	// The sensitive columns are left out
+	body := resp.Body.String()
+	assert.True(t, strings.HasPrefix(body, "ID,User name,First name,Last name,Enabled,User type,Department,Roles,Created at\r\n"), body)
+	assert.NotContains(t, body, "admin@example.com")
+
+	// The masked export is recorded with its caller
+	require.Len(t, service.exports, 1)
+	e := service.exports[0]
+	assert.Equal(t, "users", e.Entity)
+	assert.Equal(t, []string{"user.email", "user.lastLogin"}, e.MaskedColumns)
+	assert.Equal(t, 1, e.Rows)
+	assert.Equal(t, int64(3), e.UserID)
+	assert.Equal(t, "caller", e.UserName)
+	assert.Equal(t, "9b2f6c1e-2f4d-4a7b-8d0e-1c2b3a4d5e6f", e.RequestID)
+}
+
+func TestExportDeletedUsers(t *testing.T) {
+	r, _ := setupUserRouter()
+	export := func(roles ...string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users/export?deleted=true", nil)
+		ctx := metacontext.InjectRequestMeta(req.Context(), metacontext.RequestMeta{UserID: 3, UserName: "caller", Roles: roles})
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req.WithContext(ctx))
+		return resp.Code
+	}
+
+	// The deleted users are only exported for the admins
+	assert.Equal(t, http.StatusForbidden, export("ROLE_USER"))
+	assert.Equal(t, http.StatusOK, export("ROLE_ADMIN"))
+}
+
+func TestMaskPolicy(t *testing.T) {
+	columns := []export.Column[user.User]{
+		{Key: "user.userName", Value: func(u user.User, _ export.Options) string { return u.UserName }},
+		{Key: "user.email", Sensitive: true, Value: func(u user.User, _ export.Options) string { return u.Email }},
+	}
+
+	// The roles are compared case-insensitively
+	visible, masked := export.Mask(export.DefaultMaskPolicy, columns, []string{"role_admin"})
+	assert.Len(t, visible, 2)
+	assert.Nil(t, masked)
+
+	visible, masked = export.Mask(export.DefaultMaskPolicy, columns, nil)
+	require.Len(t, visible, 1)
+	assert.Equal(t, "user.userName", visible[0].Key)
+	assert.Equal(t, []string{"user.email"}, masked)
+
+	// A policy can trust other roles
+	policy := export.MaskPolicy{UnmaskedRoles: []string{"ROLE_AUDITOR"}}
+	assert.True(t, policy.Unmasked([]string{"ROLE_USER", "ROLE_AUDITOR"}))
+	assert.False(t, policy.Unmasked([]string{"ROLE_ADMIN"}))
+}
+
+func TestNewMaskedExport(t *testing.T) {
+	opts, err := export.NewOptions("de", "", "", "")
+	require.NoError(t, err)
+
+	// Without an authenticated request there is no caller
+	e := export.NewMaskedExport(context.Background(), "users", []string{"user.email"}, 4, opts)
+	assert.Equal(t, "de", e.Locale)
+	assert.Equal(t, 4, e.Rows)
+	assert.Zero(t, e.UserID)
+	assert.False(t, e.ProducedAt.IsZero())
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/schema"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/jsonschema"
+)
+
+func TestPatchUser(t *testing.T) {
+	r := SetupUserRouter()
+
+	// Only the given field changes, the omitted isEnabled is kept
+	req, _ := http.NewRequest(http.MethodPatch, "/api/v1/users/1", bytes.NewBufferString(`{"firstName": "Renamed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var body struct {
+		Data user.User `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "Renamed", body.Data.FirstName)
+	assert.Equal(t, "admin@example.com", body.Data.Email)
+	require.NotNil(t, body.Data.IsEnabled)
+	assert.True(t, *body.Data.IsEnabled, "Expected the omitted isEnabled to be kept")
+	assert.Equal(t, []role.Role{{ID: 1, Name: "ROLE_ADMIN"}}, body.Data.Roles)
+
+	for payload, expected := range map[string]int{
+		`{"email": "not-an-email"}`:         http.StatusBadRequest,
+		`{"firstName": ""}`:                 http.StatusBadRequest,
+		`{"departmentScope": ["too-long"]}`: http.StatusBadRequest,
+		`{"userType": "ROBOT"}`:             http.StatusBadRequest,
+		`{"isEnabled": false}`:              http.StatusOK,
+	} {
+		req, _ := http.NewRequest(http.MethodPatch, "/api/v1/users/1", bytes.NewBufferString(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, payload)
+	}
+
+	for id, expected := range map[string]int{"9": http.StatusNotFound, "x": http.StatusBadRequest} {
+		req, _ := http.NewRequest(http.MethodPatch, "/api/v1/users/"+id, bytes.NewBufferString(`{"firstName": "Renamed"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, "Unexpected status code for user "+id)
+	}
+}
+
+func TestUserPatchApply(t *testing.T) {
+	u := GetSampleUser()
+	lastName := "Doe"
+	disabled := false
+	scope := user.DepartmentScope{"d001"}
+	patch := user.UserPatch{LastName: &lastName, IsEnabled: &disabled, DepartmentScope: &scope}
+	patch.Apply(&u)
+
+	expected := GetSampleUser()
+	expected.LastName = &lastName
+	expected.IsEnabled = &disabled
+	expected.DepartmentScope = scope
+	assert.Equal(t, expected, u)
+
+	// An empty patch changes nothing
+	u = GetSampleUser()
+	(&user.UserPatch{}).Apply(&u)
+	assert.Equal(t, GetSampleUser(), u)
+}
+
+func TestUserPatchSchema(t *testing.T) {
+	s, ok := schema.GetSchema("user-patch")
+	require.True(t, ok)
+	assert.Empty(t, s.Required, "Expected every field of the patch to be optional")
+
+	assert.Empty(t, jsonschema.ValidateJSON(s, []byte(`{"firstName": "Renamed", "lastName": null}`)))
+	assert.NotEmpty(t, jsonschema.ValidateJSON(s, []byte(`{"firstname": "Renamed"}`)), "Expected the misspelled field to be reported")
+}
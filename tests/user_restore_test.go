@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// restoreRepository is a user repository holding users in memory, the deleted users included.
+// The methods the deletion and the restoration do not use are left unimplemented.
+type restoreRepository struct {
+	emailChangeRepository
+}
+
+func (r *restoreRepository) GetUserByID(tx *gorm.DB, id int64) (user.User, error) {
+	u, ok := r.users[id]
+	if !ok || u.DeletedAt != nil {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *restoreRepository) GetDeletedUserByID(tx *gorm.DB, id int64) (user.User, error) {
+	u, ok := r.users[id]
+	if !ok || u.DeletedAt == nil {
+		return user.User{}, user.ErrUserNotDeleted
+	}
+	return u, nil
+}
+
+func (r *restoreRepository) DeleteUser(ctx context.Context, tx *gorm.DB, u user.User, deletedBy *int64) error {
+	u.DeletedBy = deletedBy
+	u.DeletedAt = &gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *restoreRepository) RestoreUser(ctx context.Context, tx *gorm.DB, u user.User, restoredBy *int64) (user.User, error) {
+	u.DeletedBy, u.DeletedAt = nil, nil
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func TestDeleteAndRestoreUserIdentity(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	db, _ := openRecordingDB(t)
+
+	repo := &restoreRepository{emailChangeRepository{users: map[int64]user.User{
+		1: {ID: 1, UserName: "admin", FirstName: "Admin", Email: "admin@example.com"},
+		2: {ID: 2, UserName: "leaver", FirstName: "Leaver", Email: "leaver@example.com"},
+	}}}
+	service := user.NewUserService(repo, user.WithEventBus(&recordingBus{}))
+	ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+	ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+	// The deletion ends the sessions of the user, its access tokens issued until then are rejected
+	require.NoError(t, service.DeleteUser(ctx, 2))
+	assert.True(t, repo.users[2].DeletedAt.Valid)
+	assert.NoError(t, client.Get(ctx, "user_tokens_revoked_at:2").Err())
+
+	// The deleted user keeps its username and e-mail, the other users cannot take them
+	err := service.RequestEmailChange(ctx, 1, user.EmailChangeRequest{Email: "LEAVER@example.com"})
+	assert.ErrorIs(t, err, user.ErrEmailDeleted)
+
+	// A user whose username only differs by its case from an active user's cannot be restored
+	repo.users[3] = user.User{ID: 3, UserName: "Leaver", FirstName: "Other", Email: "other@example.com"}
+	_, err = service.RestoreUser(ctx, 2)
+	assert.ErrorIs(t, err, user.ErrUserNameTaken)
+
+	delete(repo.users, 3)
+	restored, err := service.RestoreUser(ctx, 2)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+
+	_, err = service.RestoreUser(ctx, 2)
+	assert.ErrorIs(t, err, user.ErrUserNotDeleted)
+}
+
+// enableRepository is a user repository holding users in memory, which also updates them and their enabled flag.
+type enableRepository struct {
+	restoreRepository
+}
+
+func (r *enableRepository) UpdateUser(ctx context.Context, tx *gorm.DB, u user.User) (user.User, error) {
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *enableRepository) ReplaceUserRoles(ctx context.Context, tx *gorm.DB, u user.User, roles []role.Role) error {
+	u.Roles = roles
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *enableRepository) SetUserEnabled(ctx context.Context, tx *gorm.DB, u user.User, enabled bool, changedBy *int64, changedAt time.Time) (user.User, error) {
+	u.IsEnabled = &enabled
+	u.UpdatedBy = changedBy
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func TestPatchUserEnabled(t *testing.T) {
+	validator.InitValidator()
+	enabled, disabled := true, false
+
+	for _, tc := range []struct {
+		name      string
+		id        int64
+		isEnabled bool
+		err       error
+		audit     []string
+		events    []string
+		revoked   bool
+	}{
+		{"disable", 2, false, nil, []string{user.AuditUpdated, user.AuditDisabled}, []string{event.UserUpdated, event.UserDisabled}, true},
+		{"enable", 3, true, nil, []string{user.AuditUpdated, user.AuditEnabled}, []string{event.UserUpdated, event.UserEnabled}, false},
+		{"unchanged", 2, true, nil, []string{user.AuditUpdated}, []string{event.UserUpdated}, false},
+		{"disable self", 1, false, user.ErrDisableSelf, nil, nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+			t.Cleanup(func() { client.Close() })
+			db, _ := openRecordingDB(t)
+
+			repo := &enableRepository{restoreRepository{emailChangeRepository{users: map[int64]user.User{
+				1: {ID: 1, UserName: "admin", FirstName: "Admin", Email: "admin@example.com", IsEnabled: &enabled},
+				2: {ID: 2, UserName: "active", FirstName: "Active", Email: "active@example.com", IsEnabled: &enabled},
+				3: {ID: 3, UserName: "inactive", FirstName: "Inactive", Email: "inactive@example.com", IsEnabled: &disabled},
+			}}}}
+			bus := &recordingBus{}
+			service := user.NewUserService(repo, user.WithEventBus(bus))
+			ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+			ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+			// The enabled flag is changed like an enable or a disable, along with the other patched fields
+			isEnabled, firstName := tc.isEnabled, "Patched"
+			patched, err := service.PatchUser(ctx, tc.id, user.UserPatch{FirstName: &firstName, IsEnabled: &isEnabled})
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				assert.Empty(t, repo.audit)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "Patched", patched.FirstName)
+			assert.Equal(t, tc.isEnabled, *patched.IsEnabled)
+			assert.Equal(t, tc.isEnabled, *repo.users[tc.id].IsEnabled)
+
+			var actions, types []string
+			for _, entry := range repo.audit {
+				actions = append(actions, entry.Action)
+			}
+			for _, e := range bus.events {
+				types = append(types, e.Type)
+			}
+			assert.Equal(t, tc.audit, actions)
+			assert.Equal(t, tc.events, types)
+
+			// The access tokens of a disabled user are revoked
+			assert.Equal(t, tc.revoked, client.Get(ctx, "user_tokens_revoked_at:2").Err() == nil)
+		})
+	}
+}
+
+func TestUpdateUserEnabled(t *testing.T) {
+	validator.InitValidator()
+	enabled, deleted := true, true
+
+	for _, tc := range []struct {
+		name      string
+		isEnabled *bool
+		events    []string
+		revoked   bool
+	}{
+		{"omitted", nil, []string{event.UserUpdated, event.UserDisabled}, true},
+		{"enabled", &enabled, []string{event.UserUpdated}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := redis.NewClient(&redis.Options{Addr: startFakeRedis(t, fakeRedisStore()), MaxRetries: -1})
+			t.Cleanup(func() { client.Close() })
+			db, _ := openRecordingDB(t)
+
+			// The fake database has the roles the user is given
+			require.NoError(t, db.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+				if r, ok := tx.Statement.Dest.(*role.Role); ok {
+					r.ID, r.Name = 2, "ROLE_USER"
+				}
+			}))
+
+			repo := &enableRepository{restoreRepository{emailChangeRepository{users: map[int64]user.User{
+				1: {ID: 1, UserName: "admin", FirstName: "Admin", Email: "admin@example.com", IsEnabled: &enabled},
+				2: {ID: 2, UserName: "active", FirstName: "Active", Email: "active@example.com", IsEnabled: &enabled},
+			}}}}
+			bus := &recordingBus{}
+			service := user.NewUserService(repo, user.WithEventBus(bus))
+			ctx := dbcontext.InjectRedisClient(dbcontext.InjectDB(context.Background(), db), client)
+			ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+
+			// The enabled flag is changed like an enable or a disable, the deletion flag is ignored
+			updated, err := service.UpdateUser(ctx, 2, user.User{
+				UserName: "active", Password: "N3w-P@ssw0rd!", Email: "active@example.com", FirstName: "Updated",
+				UserType: user.UserAccount, IsEnabled: tc.isEnabled, IsDeleted: &deleted, Roles: []role.Role{{Name: "ROLE_USER"}},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "Updated", updated.FirstName)
+			assert.Equal(t, tc.isEnabled != nil, *repo.users[2].IsEnabled)
+			assert.Nil(t, repo.users[2].IsDeleted)
+
+			var types []string
+			for _, e := range bus.events {
+				types = append(types, e.Type)
+			}
+			assert.Equal(t, tc.events, types)
+
+			// The access tokens of a disabled user are revoked
+			assert.Equal(t, tc.revoked, client.Get(ctx, "user_tokens_revoked_at:2").Err() == nil)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"gorm.io/gorm"
+)
+
+// statsRepository is a user repository returning fixed aggregate counts.
+// The methods the statistics do not use are left unimplemented.
+type statsRepository struct {
+	user.UserRepository
+	signups map[string]int64
+	since   time.Time
+}
+
+func (r *statsRepository) CountEnabledUsers(tx *gorm.DB) (int64, int64, error) {
+	return 7, 5, nil
+}
+
+func (r *statsRepository) CountUsersByRole(tx *gorm.DB) (map[string]int64, error) {
+	return map[string]int64{"ROLE_USER": 6, "ROLE_ADMIN": 2}, nil
+}
+
+func (r *statsRepository) CountUsersByType(tx *gorm.DB) (map[string]int64, error) {
+	return map[string]int64{"USER_ACCOUNT": 7}, nil
+}
+
+func (r *statsRepository) CountSignupsByMonth(tx *gorm.DB, since time.Time) (map[string]int64, error) {
+	r.since = since
+	return r.signups, nil
+}
+
+func TestGetUserStatsHandler(t *testing.T) {
+	r := SetupUserRouter()
+	serve := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/users/stats"+query, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve("")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		Data user.UserStats `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, int64(1), body.Data.Total)
+	assert.Equal(t, int64(1), body.Data.ByRole["ROLE_ADMIN"])
+	assert.Len(t, body.Data.SignupsByMonth, user.StatsDefaultMonths)
+
+	require.NoError(t, json.Unmarshal(serve("?months=3").Body.Bytes(), &body))
+	assert.Len(t, body.Data.SignupsByMonth, 3)
+
+	for _, query := range []string{"?months=0", "?months=37", "?months=twelve"} {
+		assert.Equal(t, http.StatusBadRequest, serve(query).Code, query)
+	}
+}
+
+func TestGetUserStats(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	ctx := dbcontext.InjectDB(context.Background(), db)
+
+	now := time.Now().UTC()
+	current := now.Format("2006-01")
+	previous := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01")
+	repo := &statsRepository{signups: map[string]int64{current: 2, previous: 1}}
+	service := user.NewUserService(repo)
+
+	stats, err := service.GetUserStats(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), stats.Total)
+	assert.Equal(t, int64(5), stats.Enabled)
+	assert.Equal(t, int64(2), stats.Disabled)
+
+	// Every role and user type is listed, with a zero count when it has no users
+	assert.Equal(t, map[string]int64{"ROLE_USER": 6, "ROLE_MODERATOR": 0, "ROLE_ADMIN": 2}, stats.ByRole)
+	assert.Equal(t, map[string]int64{"USER_ACCOUNT": 7, "SERVICE_ACCOUNT": 0}, stats.ByUserType)
+
+	// The months of the period are listed from the oldest, starting on its first day
+	require.Len(t, stats.SignupsByMonth, 3)
+	assert.Equal(t, user.MonthlyCount{Month: previous, Count: 1}, stats.SignupsByMonth[1])
+	assert.Equal(t, user.MonthlyCount{Month: current, Count: 2}, stats.SignupsByMonth[2])
+	assert.Equal(t, int64(0), stats.SignupsByMonth[0].Count)
+	assert.Equal(t, stats.SignupsByMonth[0].Month, repo.since.Format("2006-01"))
+	assert.Equal(t, 1, repo.since.Day())
+
+	_, err = service.GetUserStats(context.Background(), 3)
+	assert.Error(t, err)
+}
@@ -0,0 +1,773 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/yoanesber/Go-Department-CRUD/internal/department"
+	"github.com/yoanesber/Go-Department-CRUD/internal/fixture"
+	"github.com/yoanesber/Go-Department-CRUD/internal/refreshtoken"
+	"github.com/yoanesber/Go-Department-CRUD/internal/role"
+	"github.com/yoanesber/Go-Department-CRUD/internal/user"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/apikey"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/export"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/pagination"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mockUserService is a mock implementation of the UserService interface for testing purposes.
+// User 1 is active and user 2 is deleted, the other users do not exist.
+// User 3 is the caller, it cannot disable itself, and holds the sample session.
+// User 5 is a service account holding the sample API key, the other users cannot get API keys.
+// Department "zzzz" does not exist, the users cannot be assigned to it, and role ROLE_MODERATOR is missing.
+// The listing records the filter and the order it received, and the masked exports are recorded too.
+// Role 9 does not exist, the other roles list the sample user.
+// The statistics count the sample user, with the signups of the requested months.
+// Role request 1 is pending and role request 2 is decided, the callers hold ROLE_ADMIN.
+// The login attempts are recorded, and the listing of the attempts records the filter it received.
+type mockUserService struct {
+	filter      user.UserFilter
+	sort        user.UserSort
+	exports     []export.MaskedExport
+	attempts    []user.LoginAttempt
+	loginFilter user.LoginAttemptFilter
+}
+
+// GetSampleUser returns the active sample user, also used as the example of the OpenAPI spec.
+func GetSampleUser() user.User {
+	return fixture.SampleUser()
+}
+
+func (m *mockUserService) GetAllUsers(ctx context.Context, filter user.UserFilter, sort user.UserSort, page pagination.Params) ([]user.User, *pagination.Meta, error) {
+	m.filter, m.sort = filter, sort
+	return pagination.Paginate([]user.User{GetSampleUser()}, page, func(u user.User) string { return "1" })
+}
+
+func (m *mockUserService) GetRoleUsers(ctx context.Context, roleID uint, filter user.UserFilter, sort user.UserSort, page pagination.Params) ([]user.User, *pagination.Meta, error) {
+	if roleID == 9 {
+		return nil, nil, role.ErrRoleNotFound
+	}
+	filter.RoleID = roleID
+	return m.GetAllUsers(ctx, filter, sort, page)
+}
+
+func (m *mockUserService) GetUserStats(ctx context.Context, months int) (user.UserStats, error) {
+	stats := user.UserStats{
+		Total:          1,
+		Enabled:        1,
+		ByRole:         map[string]int64{"ROLE_USER": 0, "ROLE_MODERATOR": 0, "ROLE_ADMIN": 1},
+		ByUserType:     map[string]int64{"USER_ACCOUNT": 1, "SERVICE_ACCOUNT": 0},
+		SignupsByMonth: make([]user.MonthlyCount, months),
+	}
+	return stats, nil
+}
+
+func (m *mockUserService) GetUserByID(ctx context.Context, id int64) (user.User, error) {
+	if id != 1 {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return GetSampleUser(), nil
+}
+
+func (m *mockUserService) GetUserByUserName(ctx context.Context, username string) (user.User, error) {
+	return GetSampleUser(), nil
+}
+
+func (m *mockUserService) GetUserByEmail(ctx context.Context, email string) (user.User, error) {
+	return GetSampleUser(), nil
+}
+
+func (m *mockUserService) CreateUser(ctx context.Context, u user.User) (user.User, error) {
+	if err := u.Validate(); err != nil {
+		return user.User{}, err
+	}
+	for _, r := range u.Roles {
+		if r.Name == "ROLE_MODERATOR" {
+			return user.User{}, &user.RoleError{Err: user.ErrInvalidRole, InvalidRole: user.InvalidRole{Role: r.Name, Reason: user.RoleReasonNotFound}}
+		}
+	}
+	return GetSampleUser(), nil
+}
+
+func (m *mockUserService) UpdateUser(ctx context.Context, id int64, u user.User) (user.User, error) {
+	if id != 1 {
+		return user.User{}, user.ErrUserNotFound
+	}
+	if u.DepartmentID != nil && *u.DepartmentID == "zzzz" {
+		return user.User{}, department.ErrUnknownDepartment
+	}
+	u.ID = id
+	return u, nil
+}
+
+// PatchUser applies the patch to the sample user, like the service keeps the omitted fields.
+func (m *mockUserService) PatchUser(ctx context.Context, id int64, patch user.UserPatch) (user.User, error) {
+	if id != 1 {
+		return user.User{}, user.ErrUserNotFound
+	}
+	if err := patch.Validate(); err != nil {
+		return user.User{}, err
+	}
+	u := GetSampleUser()
+	patch.Apply(&u)
+	if patch.Roles != nil {
+		u.Roles = patch.Roles
+	}
+	return u, nil
+}
+
+func (m *mockUserService) ValidatePassword(ctx context.Context, id int64, password string) error {
+	return nil
+}
+
+func (m *mockUserService) ResetPassword(ctx context.Context, id int64, password string) error {
+	return nil
+}
+
+func (m *mockUserService) UpdateLastLogin(ctx context.Context, id int64, lastLogin time.Time) (bool, error) {
+	return true, nil
+}
+
+func (m *mockUserService) DeleteUser(ctx context.Context, id int64) error {
+	if id != 1 {
+		return user.ErrUserNotFound
+	}
+	return nil
+}
+
+func (m *mockUserService) RestoreUser(ctx context.Context, id int64) (user.User, error) {
+	switch id {
+	case 1:
+		return user.User{}, user.ErrUserNotDeleted
+	case 2:
+		restored := GetSampleUser()
+		restored.ID = 2
+		return restored, nil
+	default:
+		return user.User{}, user.ErrUserNotFound
+	}
+}
+
+func (m *mockUserService) EnableUser(ctx context.Context, id int64) (user.User, error) {
+	if id != 1 {
+		return user.User{}, user.ErrUserNotFound
+	}
+	return GetSampleUser(), nil
+}
+
+func (m *mockUserService) DisableUser(ctx context.Context, id int64) (user.User, error) {
+	switch id {
+	case 1:
+		disabled := GetSampleUser()
+		enabled, changedBy := false, int64(3)
+		disabled.IsEnabled, disabled.EnabledChangedBy = &enabled, &changedBy
+		return disabled, nil
+	case 3:
+		return user.User{}, user.ErrDisableSelf
+	default:
+		return user.User{}, user.ErrUserNotFound
+	}
+}
+
+func (m *mockUserService) GetSessions(ctx context.Context, userID int64) ([]refreshtoken.Session, error) {
+	if userID != 3 {
+		return []refreshtoken.Session{}, nil
+	}
+	return []refreshtoken.Session{{ID: sampleSessionID, Device: "curl/8.5.0", DeviceLabel: "curl", IPAddress: "192.0.2.10", Current: true}}, nil
+}
+
+func (m *mockUserService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	if userID != 3 || sessionID != sampleSessionID {
+		return user.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (m *mockUserService) RevokeSessions(ctx context.Context, id int64) error {
+	if id != 1 {
+		return user.ErrUserNotFound
+	}
+	return nil
+}
+
+func (m *mockUserService) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return user.ErrTokenNotRevocable
+	}
+	return nil
+}
+
+func (m *mockUserService) UpdateAvatar(ctx context.Context, userID int64, contentType string, data []byte) (user.User, error) {
+	ext, ok := user.AvatarTypes[contentType]
+	if !ok {
+		return user.User{}, user.ErrAvatarType
+	}
+	u := GetSampleUser()
+	u.ID = userID
+	avatarURL := fmt.Sprintf("/files/avatars/%d/avatar%s", userID, ext)
+	u.AvatarURL = &avatarURL
+	return u, nil
+}
+
+// GetUserAudit returns the trail of users 1 and 2, which is kept when a user is deleted.
+func (m *mockUserService) GetUserAudit(ctx context.Context, id int64, page pagination.Params) ([]user.AuditEntry, *pagination.Meta, error) {
+	if id != 1 && id != 2 {
+		return nil, nil, user.ErrUserNotFound
+	}
+	actorID := int64(3)
+	entries := []user.AuditEntry{
+		{ID: 1, UserID: id, Action: user.AuditCreated, ActorID: &actorID, ActorName: "caller"},
+		{ID: 2, UserID: id, Action: user.AuditDisabled, ActorID: &actorID, ActorName: "caller",
+			Changes: user.AuditChanges{"isEnabled": {Before: true, After: false}}},
+	}
+	return pagination.Paginate(entries, page, func(e user.AuditEntry) string { return fmt.Sprint(e.ID) })
+}
+
+// RecordLoginAttempt records the login attempt in the mock.
+func (m *mockUserService) RecordLoginAttempt(ctx context.Context, attempt user.LoginAttempt) error {
+	m.attempts = append(m.attempts, attempt)
+	return nil
+}
+
+// GetUserLogins returns the login attempts of users 1 and 2, which are kept when a user is deleted.
+func (m *mockUserService) GetUserLogins(ctx context.Context, id int64, filter user.LoginAttemptFilter, page pagination.Params) ([]user.LoginAttempt, *pagination.Meta, error) {
+	if id != 1 && id != 2 {
+		return nil, nil, user.ErrUserNotFound
+	}
+	filter.UserID = id
+	return m.GetLoginAttempts(ctx, filter, page)
+}
+
+// GetLoginAttempts returns a failed and a successful login attempt of the user of the filter, or of user 1.
+func (m *mockUserService) GetLoginAttempts(ctx context.Context, filter user.LoginAttemptFilter, page pagination.Params) ([]user.LoginAttempt, *pagination.Meta, error) {
+	m.loginFilter = filter
+	userID := filter.UserID
+	if userID == 0 {
+		userID = 1
+	}
+	attempts := []user.LoginAttempt{
+		{ID: 1, UserID: &userID, UserName: "jane", Method: user.LoginMethodPassword, FailureReason: "invalid password", IPAddress: "192.0.2.1"},
+		{ID: 2, UserID: &userID, UserName: "jane", Method: user.LoginMethodPassword, Success: true, IPAddress: "192.0.2.1"},
+	}
+	return pagination.Paginate(attempts, page, func(a user.LoginAttempt) string { return fmt.Sprint(a.ID) })
+}
+
+// RecordMaskedExport records the masked export in the mock.
+func (m *mockUserService) RecordMaskedExport(ctx context.Context, e export.MaskedExport) error {
+	m.exports = append(m.exports, e)
+	return nil
+}
+
+// sampleAPIKeyID is the ID of the API key of the service account 5.
+const sampleAPIKeyID = "5f0c3e2a-8d7b-4c1e-9a6f-2b3d4e5f6a7b"
+
+// IssueAPIKey issues a key to the service account 5.
+func (m *mockUserService) IssueAPIKey(ctx context.Context, userID int64, req user.APIKeyRequest) (user.IssuedAPIKey, error) {
+	if err := req.Validate(); err != nil {
+		return user.IssuedAPIKey{}, err
+	}
+	switch userID {
+	case 5:
+		key := user.APIKeyPrefix + "c2VjcmV0LWtleS1vZi10aGUtc2VydmljZS1hY2NvdW50"
+		return user.IssuedAPIKey{
+			APIKey: user.APIKey{ID: sampleAPIKeyID, UserID: userID, Name: req.Name, Prefix: key[:12], ExpiresAt: time.Now().Add(90 * 24 * time.Hour)},
+			Key:    key,
+		}, nil
+	case 1:
+		return user.IssuedAPIKey{}, user.ErrNotServiceAccount
+	}
+	return user.IssuedAPIKey{}, user.ErrUserNotFound
+}
+
+// GetAPIKeys returns the sample API key of the service account 5.
+func (m *mockUserService) GetAPIKeys(ctx context.Context, userID int64) ([]user.APIKey, error) {
+	if userID != 5 {
+		return nil, user.ErrUserNotFound
+	}
+	return []user.APIKey{{ID: sampleAPIKeyID, UserID: userID, Name: "hr-sync", Prefix: user.APIKeyPrefix + "c2VjcmV0"}}, nil
+}
+
+// RevokeAPIKey revokes the sample API key of the service account 5.
+func (m *mockUserService) RevokeAPIKey(ctx context.Context, userID int64, id string) (user.APIKey, error) {
+	if userID != 5 || id != sampleAPIKeyID {
+		return user.APIKey{}, user.ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	return user.APIKey{ID: id, UserID: userID, RevokedAt: &now}, nil
+}
+
+// ResolveAPIKey knows no key.
+func (m *mockUserService) ResolveAPIKey(ctx context.Context, key string) (apikey.Identity, bool, error) {
+	return apikey.Identity{}, false, nil
+}
+
+// sampleEmailToken is the confirmation token of the staged e-mail change.
+const sampleEmailToken = "c2FtcGxlLWVtYWlsLWNoYW5nZS10b2tlbg"
+
+// RequestEmailChange refuses taken@example.com and accepts the other e-mails.
+func (m *mockUserService) RequestEmailChange(ctx context.Context, userID int64, req user.EmailChangeRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if req.Email == "taken@example.com" {
+		return user.ErrEmailTaken
+	}
+	return nil
+}
+
+// ConfirmEmailChange only knows sampleEmailToken.
+func (m *mockUserService) ConfirmEmailChange(ctx context.Context, userID int64, req user.EmailConfirmationRequest) (user.User, error) {
+	if err := req.Validate(); err != nil {
+		return user.User{}, err
+	}
+	if req.Token != sampleEmailToken {
+		return user.User{}, user.ErrInvalidEmailToken
+	}
+	return user.User{ID: userID, Email: "new@example.com"}, nil
+}
+
+func (m *mockUserService) RegisterUser(ctx context.Context, u user.User) (user.User, error) {
+	u.ID = 2
+	return u, nil
+}
+
+// ResolveExternalIdentity only links the subject "linked-subject", to the sample user.
+func (m *mockUserService) ResolveExternalIdentity(ctx context.Context, login user.ExternalLogin, autoProvision bool) (user.User, error) {
+	if login.Subject != "linked-subject" {
+		return user.User{}, user.ErrIdentityNotLinked
+	}
+	return GetSampleUser(), nil
+}
+
+func (m *mockUserService) ExpireUsers(ctx context.Context, now time.Time) ([]user.ExpiredUser, error) {
+	return nil, nil
+}
+
+func (m *mockUserService) TransferMembers(ctx context.Context, req user.TransferRequest) (user.Transfer, error) {
+	if req.ToDepartmentID == "d999" {
+		return user.Transfer{}, department.ErrUnknownDepartment
+	}
+	return user.Transfer{FromDepartmentID: req.FromDepartmentID, ToDepartmentID: req.ToDepartmentID, Transferred: []int64{1, 2}}, nil
+}
+
+// RequestRole refuses ROLE_ADMIN, held by the callers, and the missing ROLE_MODERATOR.
+func (m *mockUserService) RequestRole(ctx context.Context, userID int64, req user.RoleRequestCreate) (user.RoleRequest, error) {
+	if err := req.Validate(); err != nil {
+		return user.RoleRequest{}, err
+	}
+	switch req.Role {
+	case "ROLE_ADMIN":
+		return user.RoleRequest{}, user.ErrRoleAlreadyHeld
+	case "ROLE_MODERATOR":
+		return user.RoleRequest{}, &user.RoleError{Err: user.ErrInvalidRole, InvalidRole: user.InvalidRole{Role: req.Role, Reason: user.RoleReasonNotFound}}
+	}
+	return user.RoleRequest{ID: 3, UserID: userID, RoleName: req.Role, Justification: req.Justification, Status: user.RoleRequestPending}, nil
+}
+
+// GetRoleRequests lists the pending role request 1 of user 3.
+func (m *mockUserService) GetRoleRequests(ctx context.Context, filter user.RoleRequestFilter, page pagination.Params) ([]user.RoleRequest, *pagination.Meta, error) {
+	requests := []user.RoleRequest{}
+	if (filter.UserID == 0 || filter.UserID == 3) && (filter.Status == "" || filter.Status == user.RoleRequestPending) {
+		requests = append(requests, user.RoleRequest{ID: 1, UserID: 3, RoleName: "ROLE_USER", Status: user.RoleRequestPending})
+	}
+	return pagination.Paginate(requests, page, func(r user.RoleRequest) string { return fmt.Sprint(r.ID) })
+}
+
+func (m *mockUserService) ApproveRoleRequest(ctx context.Context, id int64, decision user.RoleRequestDecision) (user.RoleRequest, error) {
+	return decideMockRoleRequest(id, user.RoleRequestApproved, decision)
+}
+
+func (m *mockUserService) DenyRoleRequest(ctx context.Context, id int64, decision user.RoleRequestDecision) (user.RoleRequest, error) {
+	return decideMockRoleRequest(id, user.RoleRequestDenied, decision)
+}
+
+// decideMockRoleRequest decides the pending role request 1.
+func decideMockRoleRequest(id int64, status string, decision user.RoleRequestDecision) (user.RoleRequest, error) {
+	if err := decision.Validate(); err != nil {
+		return user.RoleRequest{}, err
+	}
+	switch id {
+	case 1:
+		return user.RoleRequest{ID: id, UserID: 3, RoleName: "ROLE_USER", Status: status}, nil
+	case 2:
+		return user.RoleRequest{}, user.ErrRoleRequestDecided
+	}
+	return user.RoleRequest{}, user.ErrRoleRequestNotFound
+}
+
+// SetupUserRouter initializes the Gin router with the user routes backed by the mock service.
+func SetupUserRouter() *gin.Engine {
+	r, _ := setupUserRouter()
+	return r
+}
+
+// setupUserRouter also returns the mock service, to check what the handlers passed to it.
+func setupUserRouter() (*gin.Engine, *mockUserService) {
+	gin.SetMode(gin.TestMode)
+	validator.InitValidator()
+	service := &mockUserService{}
+	handler := user.NewUserHandler(service)
+
+	r := gin.New()
+	userGroup := r.Group("/api/v1/users")
+	{
+		userGroup.GET("", handler.GetAllUsers)
+		userGroup.POST("", handler.CreateUser)
+		userGroup.GET("/export", handler.ExportUsers)
+		userGroup.GET("/stats", handler.GetUserStats)
+		userGroup.GET("/:id", handler.GetUserByID)
+		userGroup.PUT("/:id", handler.UpdateUser)
+		userGroup.PATCH("/:id", handler.PatchUser)
+		userGroup.DELETE("/:id", handler.DeleteUser)
+		userGroup.POST("/:id/restore", handler.RestoreUser)
+		userGroup.POST("/:id/enable", handler.EnableUser)
+		userGroup.POST("/:id/disable", handler.DisableUser)
+		userGroup.POST("/:id/revoke-sessions", handler.RevokeUserSessions)
+		userGroup.POST("/transfer", handler.TransferMembers)
+		userGroup.GET("/:id/audit", handler.GetUserAudit)
+		userGroup.GET("/:id/logins", handler.GetUserLogins)
+		userGroup.GET("/logins", handler.GetLoginAttempts)
+		userGroup.POST("/:id/api-keys", handler.IssueAPIKey)
+		userGroup.GET("/:id/api-keys", handler.GetAPIKeys)
+		userGroup.DELETE("/:id/api-keys/:keyId", handler.RevokeAPIKey)
+		userGroup.GET("/me/sessions", handler.GetMySessions)
+		userGroup.DELETE("/me/sessions/:id", handler.RevokeMySession)
+		userGroup.DELETE("/me/token", handler.RevokeMyToken)
+		userGroup.PUT("/me/avatar", handler.UpdateMyAvatar)
+		userGroup.POST("/me/email", handler.RequestMyEmailChange)
+		userGroup.POST("/me/email/confirm", handler.ConfirmMyEmailChange)
+		userGroup.POST("/me/role-requests", handler.RequestMyRole)
+		userGroup.GET("/me/role-requests", handler.GetMyRoleRequests)
+	}
+	r.GET("/api/v1/roles/:id/users", handler.GetRoleUsers)
+	r.GET("/api/v1/role-requests", handler.GetRoleRequests)
+	r.POST("/api/v1/role-requests/:id/approve", handler.ApproveRoleRequest)
+	r.POST("/api/v1/role-requests/:id/deny", handler.DenyRoleRequest)
+
+	return r, service
+}
+
+func TestUpdateUser(t *testing.T) {
+	r := SetupUserRouter()
+
+	u := GetSampleUser()
+	u.Password = "P@ssw0rd123"
+	u.FirstName = "Renamed"
+	body, _ := json.Marshal(u)
+
+	for id, expected := range map[string]int{"1": http.StatusOK, "9": http.StatusNotFound, "x": http.StatusBadRequest} {
+		req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/"+id, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, "Unexpected status code for user "+id)
+	}
+}
+
+func TestAssignUserToDepartment(t *testing.T) {
+	r := SetupUserRouter()
+
+	for departmentID, expected := range map[string]int{"d001": http.StatusOK, "zzzz": http.StatusUnprocessableEntity} {
+		u := GetSampleUser()
+		u.Password = "P@ssw0rd123"
+		u.DepartmentID = &departmentID
+		body, _ := json.Marshal(u)
+
+		req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/1", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, expected, resp.Code, "Unexpected status code for department "+departmentID)
+		if expected == http.StatusOK {
+			assert.Contains(t, resp.Body.String(), `"departmentId":"d001"`)
+		}
+	}
+}
+
+func TestCreateUserWithInvalidRole(t *testing.T) {
+	r := SetupUserRouter()
+
+	u := GetSampleUser()
+	u.Roles = []role.Role{{Name: "ROLE_USER"}, {Name: "ROLE_MODERATOR"}}
+	body := userPayload(u, "P@ssw0rd123")
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"code":"InvalidRole"`)
+	assert.Contains(t, resp.Body.String(), `"role":"ROLE_MODERATOR"`)
+}
+
+func TestRoleConstraintError(t *testing.T) {
+	roles := []role.Role{{ID: 1, Name: "ROLE_ADMIN"}, {ID: 3, Name: "ROLE_USER"}}
+
+	// The violations raised by PostgreSQL on the user_roles relation (ON UPDATE RESTRICT, ON DELETE SET NULL)
+	cases := []struct {
+		name   string
+		err    *pgconn.PgError
+		role   string
+		reason string
+	}{
+		{"missing role", &pgconn.PgError{Code: "23503", TableName: "user_roles", ConstraintName: "fk_user_roles_role",
+			Detail: `Key (role_id)=(3) is not present in table "roles".`}, "ROLE_USER", user.RoleReasonNotFound},
+		{"restricted role update", &pgconn.PgError{Code: "23503", TableName: "roles", ConstraintName: "fk_user_roles_role",
+			Detail: `Key (id)=(1) is still referenced from table "user_roles".`}, "ROLE_ADMIN", user.RoleReasonInUse},
+		{"role deletion setting NULL", &pgconn.PgError{Code: "23502", TableName: "user_roles", ColumnName: "role_id",
+			Detail: `Failing row contains (7, null).`}, "", user.RoleReasonInUse},
+		{"duplicated role", &pgconn.PgError{Code: "23505", TableName: "user_roles", ConstraintName: "user_roles_pkey",
+			Detail: `Key (user_id, role_id)=(7, 3) already exists.`}, "ROLE_USER", user.RoleReasonDuplicated},
+	}
+
+	for _, tc := range cases {
+		err := user.RoleConstraintError(fmt.Errorf("save association: %w", tc.err), roles)
+
+		var roleErr *user.RoleError
+		if assert.ErrorAs(t, err, &roleErr, tc.name) {
+			assert.ErrorIs(t, err, user.ErrInvalidRole, tc.name)
+			assert.Equal(t, tc.role, roleErr.Role, tc.name)
+			assert.Equal(t, tc.reason, roleErr.Reason, tc.name)
+		}
+	}
+
+	// A missing user is reported as such
+	err := user.RoleConstraintError(&pgconn.PgError{Code: "23503", TableName: "user_roles", ConstraintName: "fk_user_roles_user",
+		Detail: `Key (user_id)=(7) is not present in table "users".`}, roles)
+	assert.ErrorIs(t, err, user.ErrUserNotFound)
+
+	// The violations of the other tables and the other errors are returned unchanged
+	other := &pgconn.PgError{Code: "23505", TableName: "users", ConstraintName: "users_email_key"}
+	assert.Same(t, other, user.RoleConstraintError(other, roles))
+	assert.EqualError(t, user.RoleConstraintError(errors.New("connection reset"), roles), "connection reset")
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	r := SetupUserRouter()
+
+	cases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{http.MethodDelete, "/api/v1/users/1", http.StatusOK},
+		{http.MethodDelete, "/api/v1/users/9", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/users/2/restore", http.StatusOK},
+		{http.MethodPost, "/api/v1/users/1/restore", http.StatusConflict},
+		{http.MethodPost, "/api/v1/users/9/restore", http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, "Unexpected status code for "+tc.method+" "+tc.path)
+	}
+
+	// The restored user links to its resource
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/users/2/restore", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), `"self":"/api/v1/users/2"`)
+}
+
+func TestEnableAndDisableUser(t *testing.T) {
+	r := SetupUserRouter()
+
+	cases := []struct {
+		path     string
+		expected int
+	}{
+		{"/api/v1/users/1/enable", http.StatusOK},
+		{"/api/v1/users/9/enable", http.StatusNotFound},
+		{"/api/v1/users/x/enable", http.StatusBadRequest},
+		{"/api/v1/users/1/disable", http.StatusOK},
+		{"/api/v1/users/3/disable", http.StatusConflict},
+		{"/api/v1/users/9/disable", http.StatusNotFound},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, tc.path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, tc.expected, resp.Code, "Unexpected status code for "+tc.path)
+	}
+
+	// The disabled user records who disabled it and links to its resource
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/users/1/disable", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), "User disabled successfully")
+	assert.Contains(t, resp.Body.String(), `"enabledChangedBy":3`)
+	assert.Contains(t, resp.Body.String(), `"self":"/api/v1/users/1"`)
+}
+
+func TestGetAllUsersFilterAndSort(t *testing.T) {
+	r, service := setupUserRouter()
+
+	// The filter and the order are passed to the service
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/users?role=role_admin&enabled=true&userType=USER_ACCOUNT&createdFrom=2025-01-01&createdTo=2025-01-31&sort=-createdAt&page=1&limit=10", nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "ROLE_ADMIN", service.filter.Role)
+	assert.True(t, *service.filter.Enabled)
+	assert.Equal(t, "USER_ACCOUNT", service.filter.UserType)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), *service.filter.CreatedFrom)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), *service.filter.CreatedTo, "Expected the end date to include the whole day")
+	assert.Equal(t, user.UserSort{Field: "createdAt", Desc: true}, service.sort)
+
+	// Invalid filters, orders and cursor pagination on another order are rejected
+	for _, query := range []string{
+		"role=ROLE_ROOT",
+		"enabled=maybe",
+		"deleted=maybe",
+		"userType=BOT",
+		"createdFrom=yesterday",
+		"createdFrom=2025-02-01&createdTo=2025-01-01",
+		"sort=password",
+		"sort=userName&limit=10",
+		"sort=userName&after=MQ",
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/users?"+query, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "Unexpected status code for "+query)
+	}
+}
+
+func TestGetRoleUsers(t *testing.T) {
+	r, service := setupUserRouter()
+	serve := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The users of the role are filtered like the listing, the deleted ones included on demand
+	resp := serve("/api/v1/roles/1/users?enabled=false&deleted=true")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, uint(1), service.filter.RoleID)
+	assert.False(t, *service.filter.Enabled)
+	assert.True(t, service.filter.Deleted)
+
+	assert.Equal(t, http.StatusNotFound, serve("/api/v1/roles/9/users").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/api/v1/roles/abc/users").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/api/v1/roles/0/users").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/api/v1/roles/1/users?deleted=maybe").Code)
+}
+
+func TestUserPasswordIsWriteOnly(t *testing.T) {
+	r := SetupUserRouter()
+
+	// The password is accepted in the request but never returned
+	u := GetSampleUser()
+	u.Password = "P@ssw0rd123"
+	body, _ := json.Marshal(u)
+	assert.NotContains(t, string(body), "P@ssw0rd123", "Expected the password to be omitted from the JSON encoding")
+
+	var payload map[string]any
+	_ = json.Unmarshal(body, &payload)
+	payload["password"] = "P@ssw0rd123"
+	body, _ = json.Marshal(payload)
+
+	req, _ := http.NewRequest(http.MethodPut, "/api/v1/users/1", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), `"password"`)
+}
+
+func TestHashPassword(t *testing.T) {
+	// Reload the default cost once the environment is restored
+	t.Cleanup(user.LoadEnv)
+	t.Setenv("BCRYPT_COST", "4")
+	user.LoadEnv()
+
+	hash, err := user.HashPassword("P@ssw0rd123")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "P@ssw0rd123", hash)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("P@ssw0rd123")), "Expected the login comparison to accept the hash")
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, cost, "Expected the configured cost")
+}
+
+// userPayload encodes a user with its password, which the JSON encoding of the user omits.
+func userPayload(u user.User, password string) []byte {
+	var payload map[string]any
+	body, _ := json.Marshal(u)
+	_ = json.Unmarshal(body, &payload)
+	payload["password"] = password
+	body, _ = json.Marshal(payload)
+	return body
+}
+
+func TestCreateUserPasswordPolicy(t *testing.T) {
+	r := SetupUserRouter()
+
+	create := func(password string) *httptest.ResponseRecorder {
+		body := userPayload(GetSampleUser(), password)
+
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/users", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for password, expected := range map[string]string{
+		"Sh0rt":         "password must contain at least 8 characters, an uppercase letter, a lowercase letter and a digit",
+		"alllowercase1": "password must contain at least 8 characters, an uppercase letter, a lowercase letter and a digit",
+		"Password123":   "password is too common",
+		"ADMIN":         "password must contain",
+	} {
+		resp := create(password)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "Unexpected status code for password "+password)
+		assert.Contains(t, resp.Body.String(), `"field":"password"`)
+		assert.Contains(t, resp.Body.String(), expected, "Unexpected message for password "+password)
+	}
+
+	// The password cannot be the user name or the e-mail, compared case-insensitively
+	u := GetSampleUser()
+	u.UserName = "Admin2024"
+	u.Password = "aDMIN2024"
+	assert.Error(t, u.Validate())
+	u.Email = "Secret2024@example.com"
+	u.Password = "secret2024"
+	assert.Error(t, u.Validate())
+	u.Password = "C0rrect-Horse"
+	assert.NoError(t, u.Validate())
+
+	// The policy is configurable
+	t.Cleanup(validator.LoadEnv)
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_REQUIRE_SYMBOL", "TRUE")
+	validator.LoadEnv()
+
+	assert.Contains(t, create("C0rrectHorse").Body.String(), "at least 12 characters, an uppercase letter, a lowercase letter, a digit and a symbol")
+	assert.Equal(t, http.StatusCreated, create("C0rrect-Horse").Code)
+}
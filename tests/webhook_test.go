@@ -0,0 +1,434 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoanesber/Go-Department-CRUD/internal/webhook"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/dbcontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/contextdata/metacontext"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/event"
+	"github.com/yoanesber/Go-Department-CRUD/pkg/validator"
+	"gorm.io/gorm"
+)
+
+// fakeWebhookRepository keeps the webhooks and their deliveries in memory.
+// Like the unique index of the table, it keeps a single delivery per webhook and event.
+type fakeWebhookRepository struct {
+	webhook.WebhookRepository
+	mu         sync.Mutex
+	webhooks   map[int64]webhook.Webhook
+	deliveries []webhook.Delivery
+}
+
+func newFakeWebhookRepository(webhooks ...webhook.Webhook) *fakeWebhookRepository {
+	r := &fakeWebhookRepository{webhooks: map[int64]webhook.Webhook{}}
+	for _, w := range webhooks {
+		r.webhooks[w.ID] = w
+	}
+	return r
+}
+
+func (r *fakeWebhookRepository) GetAllWebhooks(tx *gorm.DB) ([]webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var webhooks []webhook.Webhook
+	for _, w := range r.webhooks {
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+func (r *fakeWebhookRepository) GetWebhookByID(tx *gorm.DB, id int64) (webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.webhooks[id]
+	if !ok {
+		return webhook.Webhook{}, webhook.ErrWebhookNotFound
+	}
+	return w, nil
+}
+
+func (r *fakeWebhookRepository) GetActiveWebhooksByEvent(tx *gorm.DB, eventType string) ([]webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var webhooks []webhook.Webhook
+	for _, w := range r.webhooks {
+		if w.Active && w.Events.Contains(eventType) {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (r *fakeWebhookRepository) CreateWebhook(ctx context.Context, tx *gorm.DB, w webhook.Webhook) (webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w.ID = int64(len(r.webhooks) + 1)
+	r.webhooks[w.ID] = w
+	return w, nil
+}
+
+func (r *fakeWebhookRepository) UpdateWebhook(ctx context.Context, tx *gorm.DB, w webhook.Webhook) (webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks[w.ID] = w
+	return w, nil
+}
+
+func (r *fakeWebhookRepository) DeleteWebhook(ctx context.Context, tx *gorm.DB, w webhook.Webhook, deletedBy *int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.webhooks, w.ID)
+	return nil
+}
+
+func (r *fakeWebhookRepository) CreateDeliveries(ctx context.Context, tx *gorm.DB, deliveries []webhook.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range deliveries {
+		duplicate := false
+		for _, existing := range r.deliveries {
+			duplicate = duplicate || (existing.WebhookID == d.WebhookID && existing.EventID == d.EventID)
+		}
+		if !duplicate {
+			d.ID = int64(len(r.deliveries) + 1)
+			r.deliveries = append(r.deliveries, d)
+		}
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepository) ClaimDueDeliveries(ctx context.Context, tx *gorm.DB, limit int, maxAttempts int, now time.Time, leaseUntil time.Time) ([]webhook.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var claimed []webhook.Delivery
+	for i, d := range r.deliveries {
+		if len(claimed) < limit && d.DeliveredAt == nil && d.Attempts < maxAttempts && !d.NextAttemptAt.After(now) {
+			r.deliveries[i].NextAttemptAt = leaseUntil
+			d.Webhook = r.webhooks[d.WebhookID]
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
+
+func (r *fakeWebhookRepository) MarkDelivered(ctx context.Context, tx *gorm.DB, id int64, deliveredAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[id-1].Attempts++
+	r.deliveries[id-1].DeliveredAt = &deliveredAt
+	r.deliveries[id-1].LastError = nil
+	return nil
+}
+
+func (r *fakeWebhookRepository) MarkDeliveryFailed(ctx context.Context, tx *gorm.DB, id int64, lastError string, nextAttemptAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[id-1].Attempts++
+	r.deliveries[id-1].LastError = &lastError
+	r.deliveries[id-1].NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+// delivery returns a copy of the delivery with the given ID.
+func (r *fakeWebhookRepository) delivery(id int64) webhook.Delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deliveries[id-1]
+}
+
+// makeDue makes every pending delivery due now.
+func (r *fakeWebhookRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.deliveries {
+		r.deliveries[i].NextAttemptAt = time.Now()
+	}
+}
+
+func TestWebhookSign(t *testing.T) {
+	body := []byte(`{"id":"e1","type":"department.created"}`)
+
+	// The signature is the HMAC-SHA256 of "<timestamp>.<body>"
+	mac := hmac.New(sha256.New, []byte("webhook-secret-0123456789"))
+	mac.Write([]byte("1700000000." + string(body)))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), webhook.Sign("webhook-secret-0123456789", "1700000000", body))
+
+	// The timestamp, the body and the secret are all signed
+	signature := webhook.Sign("webhook-secret-0123456789", "1700000000", body)
+	assert.NotEqual(t, signature, webhook.Sign("webhook-secret-0123456789", "1700000001", body))
+	assert.NotEqual(t, signature, webhook.Sign("webhook-secret-0123456789", "1700000000", []byte(`{"id":"e2"}`)))
+	assert.NotEqual(t, signature, webhook.Sign("another-secret-0123456789", "1700000000", body))
+}
+
+func TestWebhookValidateTarget(t *testing.T) {
+	t.Cleanup(webhook.LoadEnv)
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "")
+	webhook.LoadEnv()
+
+	for _, allowed := range []string{"https://hooks.example.com/departments", "http://203.0.113.10:8080/hook"} {
+		assert.NoError(t, webhook.ValidateTarget(allowed), allowed)
+	}
+
+	for _, refused := range []string{
+		"ftp://hooks.example.com/departments",
+		"file:///etc/passwd",
+		"https:///departments",
+		"http://127.0.0.1:9090/admin/drain",
+		"http://localhost:9090/admin/drain",
+		"http://api.localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.20/hook",
+		"http://0.0.0.0/hook",
+	} {
+		assert.ErrorIs(t, webhook.ValidateTarget(refused), webhook.ErrWebhookTarget, refused)
+	}
+
+	// The hosts of the internal receivers can be allowed explicitly
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "receiver.internal, 10.0.0.5")
+	webhook.LoadEnv()
+	assert.NoError(t, webhook.ValidateTarget("http://10.0.0.5/hook"))
+	assert.NoError(t, webhook.ValidateTarget("https://receiver.internal/hook"))
+	assert.ErrorIs(t, webhook.ValidateTarget("http://127.0.0.1:9090/admin/drain"), webhook.ErrWebhookTarget)
+}
+
+func TestWebhookCreateDeliveriesIgnoresDuplicates(t *testing.T) {
+	db, _ := openRecordingDB(t)
+	var statement string
+	require.NoError(t, db.Callback().Create().After("gorm:create").Register("test:statement", func(tx *gorm.DB) {
+		statement = tx.Statement.SQL.String()
+	}))
+
+	// The delivery already created for the webhook and the event is skipped by the unique index
+	err := webhook.NewWebhookRepository().CreateDeliveries(context.Background(), db.Session(&gorm.Session{DryRun: true}), []webhook.Delivery{
+		{WebhookID: 1, EventID: "e1", EventType: event.DepartmentCreated, Payload: "{}", NextAttemptAt: time.Now()},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, statement, `INSERT INTO "webhook_deliveries"`)
+	assert.Contains(t, statement, "ON CONFLICT DO NOTHING")
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	t.Cleanup(webhook.LoadEnv)
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+	t.Setenv("WEBHOOK_MAX_RETRIES", "3")
+	webhook.LoadEnv()
+
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies [][]byte
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	db, _ := openRecordingDB(t)
+	repo := newFakeWebhookRepository(
+		webhook.Webhook{ID: 1, URL: server.URL + "/hook", Secret: "webhook-secret-0123456789", Events: webhook.EventTypes{event.DepartmentCreated}, Active: true},
+		webhook.Webhook{ID: 2, URL: server.URL + "/other", Secret: "webhook-secret-0123456789", Events: webhook.EventTypes{event.DepartmentDeleted}, Active: true},
+	)
+	d := webhook.NewDispatcher(db, repo)
+
+	// The event is delivered once to each subscribed webhook, even when it is queued again
+	e := event.NewEvent(event.DepartmentCreated, "D001", map[string]string{"id": "D001"})
+	require.NoError(t, webhook.QueueDeliveries(context.Background(), db, repo, e))
+	require.NoError(t, webhook.QueueDeliveries(context.Background(), db, repo, e))
+	require.Len(t, repo.deliveries, 1)
+
+	// A failed delivery is scheduled again, the worker does not wait for the retry
+	started := time.Now()
+	n, err := d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Less(t, time.Since(started), time.Second)
+
+	failed := repo.delivery(1)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Nil(t, failed.DeliveredAt)
+	require.NotNil(t, failed.LastError)
+	assert.Contains(t, *failed.LastError, "unexpected status code 500")
+	assert.WithinDuration(t, time.Now().Add(time.Second), failed.NextAttemptAt, 500*time.Millisecond)
+
+	// The retry is not due yet
+	n, err = d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	mu.Lock()
+	status = http.StatusNoContent
+	mu.Unlock()
+	repo.makeDue()
+	n, err = d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	delivered := repo.delivery(1)
+	assert.Equal(t, 2, delivered.Attempts)
+	assert.NotNil(t, delivered.DeliveredAt)
+	assert.Nil(t, delivered.LastError)
+
+	// Each request is signed with the secret of the webhook
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 2)
+	for i, r := range received {
+		assert.Equal(t, "/hook", r.URL.Path)
+		assert.Equal(t, event.DepartmentCreated, r.Header.Get(webhook.HeaderEvent))
+		assert.Equal(t, e.ID, r.Header.Get(webhook.HeaderDelivery))
+		expected := "sha256=" + webhook.Sign("webhook-secret-0123456789", r.Header.Get(webhook.HeaderTimestamp), bodies[i])
+		assert.Equal(t, expected, r.Header.Get(webhook.HeaderSignature))
+
+		var payload event.Event
+		require.NoError(t, json.Unmarshal(bodies[i], &payload))
+		assert.Equal(t, e.ID, payload.ID)
+	}
+}
+
+func TestWebhookDeliveryAbandoned(t *testing.T) {
+	t.Cleanup(webhook.LoadEnv)
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "127.0.0.1")
+	t.Setenv("WEBHOOK_MAX_RETRIES", "1")
+	webhook.LoadEnv()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	db, _ := openRecordingDB(t)
+	repo := newFakeWebhookRepository(webhook.Webhook{ID: 1, URL: server.URL, Secret: "webhook-secret-0123456789", Events: webhook.EventTypes{event.DepartmentUpdated}, Active: true})
+	d := webhook.NewDispatcher(db, repo)
+	require.NoError(t, webhook.QueueDeliveries(context.Background(), db, repo, event.NewEvent(event.DepartmentUpdated, "D001", nil)))
+
+	// The delivery is attempted WEBHOOK_MAX_RETRIES times after the first attempt, then abandoned
+	for attempt := 1; attempt <= 2; attempt++ {
+		n, err := d.DispatchDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		repo.makeDue()
+	}
+
+	n, err := d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 2, repo.delivery(1).Attempts)
+}
+
+func TestWebhookDeliveryRefusesPrivateAddresses(t *testing.T) {
+	t.Cleanup(webhook.LoadEnv)
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "")
+	webhook.LoadEnv()
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	t.Cleanup(server.Close)
+
+	// A webhook stored before the validation, or whose name resolves to the loopback, is refused by the dialer
+	db, _ := openRecordingDB(t)
+	repo := newFakeWebhookRepository(webhook.Webhook{ID: 1, URL: server.URL, Secret: "webhook-secret-0123456789", Events: webhook.EventTypes{event.DepartmentCreated}, Active: true})
+	d := webhook.NewDispatcher(db, repo)
+	require.NoError(t, webhook.QueueDeliveries(context.Background(), db, repo, event.NewEvent(event.DepartmentCreated, "D001", nil)))
+
+	n, err := d.DispatchDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 0, calls)
+	require.NotNil(t, repo.delivery(1).LastError)
+	assert.Contains(t, *repo.delivery(1).LastError, "is not a public address")
+}
+
+func TestWebhookCRUD(t *testing.T) {
+	validator.InitValidator()
+	t.Cleanup(webhook.LoadEnv)
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", "")
+	webhook.LoadEnv()
+
+	db, _ := openRecordingDB(t)
+	repo := newFakeWebhookRepository()
+	handler := webhook.NewWebhookHandler(webhook.NewWebhookService(repo))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		ctx := dbcontext.InjectDB(c.Request.Context(), db)
+		ctx = metacontext.InjectRequestMeta(ctx, metacontext.RequestMeta{UserID: 1, UserName: "admin", Roles: []string{"ROLE_ADMIN"}})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	})
+	r.GET("/webhooks", handler.GetAllWebhooks)
+	r.GET("/webhooks/:id", handler.GetWebhookByID)
+	r.POST("/webhooks", handler.CreateWebhook)
+	r.PUT("/webhooks/:id", handler.UpdateWebhook)
+	r.DELETE("/webhooks/:id", handler.DeleteWebhook)
+
+	call := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// The signing secret is generated and returned once
+	resp := call(http.MethodPost, "/webhooks", `{"url":"https://hooks.example.com/departments","events":["department.created"],"active":true}`)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var created struct {
+		Data webhook.Webhook `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	assert.Equal(t, int64(1), created.Data.ID)
+	assert.Len(t, created.Data.Secret, 64)
+
+	resp = call(http.MethodGet, "/webhooks/1", "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), created.Data.Secret)
+	assert.Contains(t, call(http.MethodGet, "/webhooks", "").Body.String(), "https://hooks.example.com/departments")
+
+	resp = call(http.MethodPut, "/webhooks/1", `{"url":"https://hooks.example.com/v2","events":["department.deleted"],"active":false}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "https://hooks.example.com/v2", repo.webhooks[1].URL)
+	assert.Equal(t, created.Data.Secret, repo.webhooks[1].Secret)
+
+	// The internal targets are refused
+	for _, target := range []string{"http://127.0.0.1:9090/admin/drain", "http://169.254.169.254/latest/meta-data/", "ftp://hooks.example.com/departments"} {
+		resp = call(http.MethodPost, "/webhooks", `{"url":"`+target+`","events":["department.created"],"active":true}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code, target)
+		assert.Contains(t, resp.Body.String(), `"WebhookTargetNotAllowed"`, target)
+	}
+	resp = call(http.MethodPut, "/webhooks/1", `{"url":"http://localhost:9090/admin","events":["department.created"],"active":true}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+	// The unknown webhooks are not found
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		resp = call(method, "/webhooks/99", `{"url":"https://hooks.example.com/departments","events":["department.created"],"active":true}`)
+		assert.Equal(t, http.StatusNotFound, resp.Code, method)
+		assert.Contains(t, resp.Body.String(), `"WebhookNotFound"`, method)
+	}
+
+	assert.Equal(t, http.StatusOK, call(http.MethodDelete, "/webhooks/1", "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/webhooks/1", "").Code)
+}